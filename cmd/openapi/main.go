@@ -0,0 +1,20 @@
+// Command openapi prints the OpenAPI document of the Xanthus REST API.
+//
+//	go run ./cmd/openapi > docs/openapi.json
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func main() {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(api.OpenAPIDocument()); err != nil {
+		log.Fatal("Failed to write OpenAPI document:", err)
+	}
+}
@@ -0,0 +1,17 @@
+// Command xanthusctl is a command-line client for the Xanthus REST API.
+//
+//	export XANTHUS_URL=https://xanthus.example.com
+//	export XANTHUS_TOKEN=xan_...
+//	xanthusctl vps list
+//	xanthusctl -o json app list
+package main
+
+import (
+	"os"
+
+	"github.com/chrishham/xanthus/internal/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,144 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func adoptList(e *env, args []string) error {
+	if err := requireArgs(args, 0); err != nil {
+		return err
+	}
+
+	var candidates api.AdoptionCandidates
+	if err := e.client.Do(http.MethodGet, "/adopt", nil, &candidates); err != nil {
+		return err
+	}
+	if e.out.format == FormatJSON {
+		return e.out.json(candidates)
+	}
+
+	for _, msg := range candidates.Errors {
+		fmt.Fprintf(e.stdout, "Warning: %s\n", msg)
+	}
+	if len(candidates.Servers)+len(candidates.Zones)+len(candidates.Records)+len(candidates.Releases) == 0 {
+		fmt.Fprintln(e.stdout, "Nothing to adopt")
+		return nil
+	}
+
+	if len(candidates.Servers) > 0 {
+		fmt.Fprintln(e.stdout, "Servers (adopt with `adopt server <provider> <id>`):")
+		rows := make([][]string, 0, len(candidates.Servers))
+		for _, s := range candidates.Servers {
+			rows = append(rows, []string{s.Provider, strconv.Itoa(s.ID), s.Name, s.PublicIPv4, s.ServerType, s.Location})
+		}
+		if err := e.out.table(candidates, []string{"PROVIDER", "ID", "NAME", "IPV4", "TYPE", "LOCATION"}, rows); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout)
+	}
+	if len(candidates.Zones) > 0 {
+		fmt.Fprintln(e.stdout, "Zones (adopt with `dns configure <domain>`):")
+		rows := make([][]string, 0, len(candidates.Zones))
+		for _, z := range candidates.Zones {
+			rows = append(rows, []string{z.Domain, z.Status})
+		}
+		if err := e.out.table(candidates, []string{"DOMAIN", "STATUS"}, rows); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout)
+	}
+	if len(candidates.Records) > 0 {
+		fmt.Fprintln(e.stdout, "A records not used by any application:")
+		rows := make([][]string, 0, len(candidates.Records))
+		for _, r := range candidates.Records {
+			server := "-"
+			if r.ServerID != 0 {
+				server = strconv.Itoa(r.ServerID)
+			}
+			rows = append(rows, []string{r.Name, r.Content, strconv.FormatBool(r.Proxied), server})
+		}
+		if err := e.out.table(candidates, []string{"NAME", "CONTENT", "PROXIED", "VPS"}, rows); err != nil {
+			return err
+		}
+		fmt.Fprintln(e.stdout)
+	}
+	if len(candidates.Releases) > 0 {
+		fmt.Fprintln(e.stdout, "Helm releases (adopt with `adopt release <vps-id> <namespace>/<release>`):")
+		rows := make([][]string, 0, len(candidates.Releases))
+		for _, r := range candidates.Releases {
+			appType := r.AppType
+			if appType == "" {
+				appType = "-"
+			}
+			rows = append(rows, []string{strconv.Itoa(r.ServerID), r.Namespace + "/" + r.Name, r.Chart, appType, r.Status, strings.Join(r.Hosts, ",")})
+		}
+		if err := e.out.table(candidates, []string{"VPS", "RELEASE", "CHART", "APP TYPE", "STATUS", "HOSTS"}, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func adoptServer(e *env, args []string) error {
+	var req api.AdoptServerRequest
+	flags := flag.NewFlagSet("adopt server", flag.ContinueOnError)
+	var passwordStdin bool
+	flags.StringVar(&req.SSHUser, "user", "", "SSH user (defaults to the provider's default user)")
+	flags.IntVar(&req.SSHPort, "port", 0, "SSH port (defaults to 22)")
+	flags.BoolVar(&passwordStdin, "password-stdin", false, "Read the SSH password from stdin to install the Xanthus key")
+	positional, err := parseFlags(flags, args, 2)
+	if err != nil {
+		return err
+	}
+	req.Provider = positional[0]
+	if req.ID, err = strconv.Atoi(positional[1]); err != nil {
+		return errUsage
+	}
+	if passwordStdin {
+		password, err := bufio.NewReader(e.stdin).ReadString('\n')
+		if err != nil && password == "" {
+			return fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		req.Password = strings.TrimRight(password, "\r\n")
+	}
+
+	var server api.VPS
+	if err := e.client.Do(http.MethodPost, "/adopt/servers", req, &server); err != nil {
+		return err
+	}
+	return printVPS(e, server)
+}
+
+func adoptRelease(e *env, args []string) error {
+	var req api.AdoptReleaseRequest
+	flags := flag.NewFlagSet("adopt release", flag.ContinueOnError)
+	flags.StringVar(&req.AppType, "type", "", "Application type from the catalog (defaults to the type inferred from the chart)")
+	flags.StringVar(&req.Name, "name", "", "Application name (defaults to the release name)")
+	flags.StringVar(&req.Subdomain, "subdomain", "", "Subdomain the application is served on (defaults to the ingress host)")
+	flags.StringVar(&req.Domain, "domain", "", "Managed domain the application is served on (defaults to the ingress host)")
+	positional, err := parseFlags(flags, args, 2)
+	if err != nil {
+		return err
+	}
+	if req.ServerID, err = strconv.Atoi(positional[0]); err != nil {
+		return errUsage
+	}
+	namespace, release, ok := strings.Cut(positional[1], "/")
+	if !ok || namespace == "" || release == "" {
+		return errUsage
+	}
+	req.Namespace, req.Release = namespace, release
+
+	var app api.Application
+	if err := e.client.Do(http.MethodPost, "/adopt/releases", req, &app); err != nil {
+		return err
+	}
+	return printApplication(e, &app, app)
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"flag"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func appList(e *env, args []string) error {
+	if err := requireArgs(args, 0); err != nil {
+		return err
+	}
+
+	var apps []api.Application
+	if err := e.client.Do(http.MethodGet, "/applications", nil, &apps); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(apps))
+	for _, app := range apps {
+		rows = append(rows, []string{app.ID, app.Name, app.AppType, app.AppVersion, app.Status, app.VPSName, app.URL})
+	}
+	return e.out.table(apps, []string{"ID", "NAME", "TYPE", "VERSION", "STATUS", "VPS", "URL"}, rows)
+}
+
+func appGet(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var app api.Application
+	if err := e.client.Do(http.MethodGet, "/applications/"+args[0], nil, &app); err != nil {
+		return err
+	}
+	return printApplication(e, &app, app)
+}
+
+func appDeploy(e *env, args []string) error {
+	var req api.CreateApplicationRequest
+	flags := flag.NewFlagSet("app deploy", flag.ContinueOnError)
+	flags.StringVar(&req.AppType, "type", "", "Application type from the catalog (e.g. code-server)")
+	flags.StringVar(&req.Name, "name", "", "Application name")
+	flags.StringVar(&req.Description, "description", "", "Application description")
+	flags.StringVar(&req.Subdomain, "subdomain", "", "Subdomain to serve the application on")
+	flags.StringVar(&req.Domain, "domain", "", "Managed domain")
+	flags.StringVar(&req.VPSID, "vps", "", "ID of the server to deploy to")
+	flags.StringVar(&req.Version, "version", "", "Application version (defaults to the catalog version)")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if req.AppType == "" || req.Name == "" || req.Subdomain == "" || req.Domain == "" || req.VPSID == "" {
+		return errUsage
+	}
+
+	var resp api.CreateApplicationResponse
+	if err := e.client.Do(http.MethodPost, "/applications", req, &resp); err != nil {
+		return err
+	}
+	if resp.Application == nil {
+		return e.out.message("Application deployed")
+	}
+
+	extra := [][2]string{}
+	if resp.Username != "" {
+		extra = append(extra, [2]string{"Username", resp.Username})
+	}
+	if resp.InitialPassword != "" {
+		extra = append(extra, [2]string{"Initial password", resp.InitialPassword})
+	}
+	return printApplication(e, resp, *resp.Application, extra...)
+}
+
+func appUpgrade(e *env, args []string) error {
+	if err := requireArgs(args, 2); err != nil {
+		return err
+	}
+
+	var app api.Application
+	req := api.UpgradeApplicationRequest{Version: args[1]}
+	if err := e.client.Do(http.MethodPost, "/applications/"+args[0]+"/upgrade", req, &app); err != nil {
+		return err
+	}
+	return printApplication(e, &app, app)
+}
+
+func appDelete(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	if err := e.client.Do(http.MethodDelete, "/applications/"+args[0], nil, nil); err != nil {
+		return err
+	}
+	return e.out.message("Application %s deleted", args[0])
+}
+
+func appPassword(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var password api.ApplicationPassword
+	if err := e.client.Do(http.MethodGet, "/applications/"+args[0]+"/password", nil, &password); err != nil {
+		return err
+	}
+
+	pairs := [][2]string{}
+	if password.Username != "" {
+		pairs = append(pairs, [2]string{"Username", password.Username})
+	}
+	pairs = append(pairs, [2]string{"Password", password.Password})
+	return e.out.fields(password, pairs)
+}
+
+// printApplication prints an application; data is what gets encoded in JSON mode
+func printApplication(e *env, data interface{}, app api.Application, extra ...[2]string) error {
+	pairs := [][2]string{
+		{"ID", app.ID},
+		{"Name", app.Name},
+		{"Type", app.AppType},
+		{"Version", app.AppVersion},
+		{"Status", app.Status},
+		{"VPS", app.VPSName + " (" + app.VPSID + ")"},
+		{"URL", app.URL},
+	}
+	if app.ErrorMsg != "" {
+		pairs = append(pairs, [2]string{"Error", app.ErrorMsg})
+	}
+	return e.out.fields(data, append(pairs, extra...))
+}
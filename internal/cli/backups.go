@@ -0,0 +1,189 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func backupTargetList(e *env, args []string) error {
+	if err := requireArgs(args, 0); err != nil {
+		return err
+	}
+
+	var targets []api.BackupTarget
+	if err := e.client.Do(http.MethodGet, "/backups/targets", nil, &targets); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(targets))
+	for _, t := range targets {
+		rows = append(rows, []string{t.Name, t.Endpoint, t.Bucket, t.Region, t.AccessKey})
+	}
+	return e.out.table(targets, []string{"NAME", "ENDPOINT", "BUCKET", "REGION", "ACCESS KEY"}, rows)
+}
+
+func backupTargetAdd(e *env, args []string) error {
+	var req api.CreateBackupTargetRequest
+	flags := flag.NewFlagSet("backup target add", flag.ContinueOnError)
+	flags.StringVar(&req.Name, "name", "", "Target name")
+	flags.StringVar(&req.Endpoint, "endpoint", "", "S3 endpoint URL")
+	flags.StringVar(&req.Bucket, "bucket", "", "Bucket")
+	flags.StringVar(&req.Region, "region", "", "Bucket region")
+	flags.StringVar(&req.AccessKey, "access-key", "", "Access key ID")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if req.Name == "" || req.Endpoint == "" || req.Bucket == "" || req.AccessKey == "" {
+		return errUsage
+	}
+
+	secrets, err := readLines(e, 2)
+	if err != nil {
+		return fmt.Errorf("failed to read secret key and repository password from stdin: %w", err)
+	}
+	req.SecretKey, req.Password = secrets[0], secrets[1]
+
+	var target api.BackupTarget
+	if err := e.client.Do(http.MethodPost, "/backups/targets", req, &target); err != nil {
+		return err
+	}
+	return e.out.message("Backup target %s stores backups in %s/%s", target.Name, target.Endpoint, target.Bucket)
+}
+
+func backupTargetDelete(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	if err := e.client.Do(http.MethodDelete, "/backups/targets/"+url.PathEscape(args[0]), nil, nil); err != nil {
+		return err
+	}
+	return e.out.message("Backup target %s deleted", args[0])
+}
+
+func backupPolicyGet(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var policy api.BackupPolicy
+	if err := e.client.Do(http.MethodGet, "/applications/"+url.PathEscape(args[0])+"/backup", nil, &policy); err != nil {
+		return err
+	}
+	return printBackupPolicy(e, policy)
+}
+
+func backupPolicySet(e *env, args []string) error {
+	var req api.SetBackupPolicyRequest
+	flags := flag.NewFlagSet("backup policy set", flag.ContinueOnError)
+	flags.StringVar(&req.Target, "target", "", "Backup target")
+	flags.StringVar(&req.Schedule, "schedule", "", "Cron schedule in the server's timezone (default \"0 3 * * *\")")
+	flags.IntVar(&req.KeepLast, "keep-last", 0, "Keep the last n snapshots")
+	flags.IntVar(&req.KeepDaily, "keep-daily", 0, "Keep the last snapshot of n days")
+	flags.IntVar(&req.KeepWeekly, "keep-weekly", 0, "Keep the last snapshot of n weeks")
+	positional, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	if req.Target == "" {
+		return errUsage
+	}
+
+	var policy api.BackupPolicy
+	if err := e.client.Do(http.MethodPut, "/applications/"+url.PathEscape(positional[0])+"/backup", req, &policy); err != nil {
+		return err
+	}
+	return printBackupPolicy(e, policy)
+}
+
+func backupPolicyDelete(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	if err := e.client.Do(http.MethodDelete, "/applications/"+url.PathEscape(args[0])+"/backup", nil, nil); err != nil {
+		return err
+	}
+	return e.out.message("Backups of %s stopped, existing snapshots are kept", args[0])
+}
+
+func backupList(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var snapshots []api.BackupSnapshot
+	if err := e.client.Do(http.MethodGet, "/applications/"+url.PathEscape(args[0])+"/backups", nil, &snapshots); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(snapshots))
+	for _, s := range snapshots {
+		rows = append(rows, []string{s.ShortID, s.Time.Format(time.RFC3339), strings.Join(s.Paths, ", ")})
+	}
+	return e.out.table(snapshots, []string{"ID", "TIME", "PATHS"}, rows)
+}
+
+func backupRun(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	if err := e.client.Do(http.MethodPost, "/applications/"+url.PathEscape(args[0])+"/backups", nil, nil); err != nil {
+		return err
+	}
+	return e.out.message("Backed up %s", args[0])
+}
+
+func backupRestore(e *env, args []string) error {
+	if err := requireArgs(args, 2); err != nil {
+		return err
+	}
+
+	path := "/applications/" + url.PathEscape(args[0]) + "/backups/" + url.PathEscape(args[1]) + "/restore"
+	if err := e.client.Do(http.MethodPost, path, nil, nil); err != nil {
+		return err
+	}
+	return e.out.message("Restored %s from snapshot %s", args[0], args[1])
+}
+
+func printBackupPolicy(e *env, p api.BackupPolicy) error {
+	return e.out.fields(p, [][2]string{
+		{"Application", p.AppID},
+		{"Target", p.Target},
+		{"Schedule", p.Schedule},
+		{"Keep last", strconv.Itoa(p.Retention.KeepLast)},
+		{"Keep daily", strconv.Itoa(p.Retention.KeepDaily)},
+		{"Keep weekly", strconv.Itoa(p.Retention.KeepWeekly)},
+		{"Volumes", strings.Join(p.Volumes, ", ")},
+		{"Updated", p.UpdatedAt},
+	})
+}
+
+// readLines reads n non-empty lines from stdin
+func readLines(e *env, n int) ([]string, error) {
+	reader := bufio.NewReader(e.stdin)
+	lines := make([]string, 0, n)
+	for len(lines) < n {
+		line, err := reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			lines = append(lines, line)
+		}
+		if err != nil {
+			if len(lines) < n {
+				return nil, fmt.Errorf("expected %d lines, got %d", n, len(lines))
+			}
+			break
+		}
+	}
+	return lines, nil
+}
@@ -0,0 +1,218 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Default server and environment variables read by xanthusctl
+const (
+	DefaultURL = "http://localhost:8081"
+	EnvURL     = "XANTHUS_URL"
+	EnvToken   = "XANTHUS_TOKEN"
+)
+
+// errUsage signals that the command line was invalid and usage has been printed
+var errUsage = errors.New("usage")
+
+// env carries everything a command needs to run
+type env struct {
+	client *Client
+	out    *printer
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// command is one xanthusctl subcommand, e.g. "vps list"
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(e *env, args []string) error
+}
+
+// commands returns every subcommand in the order shown by help
+func commands() []command {
+	return []command{
+		{"vps list", "", "List servers", vpsList},
+		{"vps get", "<id>", "Show a server", vpsGet},
+		{"vps create", "--name <name> [--provider <provider>] [--location <location>] [--type <server-type>]", "Create a server with K3s", vpsCreate},
+		{"vps add", "--name <name> --host <host> [--user <user>] [--port <port>] [--password-stdin]", "Add an existing server over SSH and install K3s", vpsAdd},
+		{"vps delete", "<id>", "Delete a server", vpsDelete},
+		{"vps power", "<id> poweroff|poweron|reboot", "Change the power state of a server", vpsPower},
+		{"vps trust-host-key", "<id>", "Trust the SSH host key a server presents now, after it was rebuilt", vpsTrustHostKey},
+		{"vps nodes", "<id>", "List the nodes of a server's cluster", vpsNodes},
+		{"vps join", "--name <name> [--provider <provider>] [--location <location>] [--type <server-type>] [--host <host> [--user <user>] [--port <port>] [--password-stdin]] <server-id>", "Join a new agent node to a server's cluster", vpsJoin},
+		{"vps capacity", "<id>", "Show the free CPU, memory and disk of a server's cluster", vpsCapacity},
+		{"vps metrics", "[--range <duration>] <id>", "Show the CPU, memory, disk and network use of a server over time", vpsMetrics},
+		{"vps k3s versions", "<id>", "Show the K3s version of a server's cluster and the releases it can be upgraded to", vpsK3sVersions},
+		{"vps k3s upgrade", "<id> <version>", "Upgrade the K3s of a server's cluster, one node at a time", vpsK3sUpgrade},
+		{"vps rebuild", "[--replace] [--restore-backups] <id>", "Rebuild a lost server from stored state and redeploy its applications", vpsRebuild},
+
+		{"app list", "", "List applications", appList},
+		{"app get", "<id>", "Show an application", appGet},
+		{"app deploy", "--type <app-type> --name <name> --subdomain <sub> --domain <domain> --vps <id> [--version <v>]", "Deploy an application", appDeploy},
+		{"app upgrade", "<id> <version>", "Upgrade an application", appUpgrade},
+		{"app delete", "<id>", "Delete an application", appDelete},
+		{"app metrics", "[--range <duration>] <id>", "Show the CPU and memory use of an application over time", appMetrics},
+		{"app password", "<id>", "Show the password of a code-server or ArgoCD application", appPassword},
+
+		{"dns list", "", "List managed domains", dnsList},
+		{"dns configure", "[--acme] [--dns-only] <domain>", "Configure SSL and DNS for a Cloudflare domain", dnsConfigure},
+		{"dns renew", "<domain>", "Renew a domain certificate and install it on its servers", dnsRenew},
+		{"dns remove", "<domain>", "Revert the Cloudflare changes made for a domain", dnsRemove},
+
+		{"user list", "", "List Xanthus users", userList},
+		{"user add", "[--role admin|operator|viewer] <username>", "Create a user, reading the password from stdin", userAdd},
+		{"user role", "<username> admin|operator|viewer", "Change the role of a user", userRole},
+		{"user passwd", "<username>", "Reset the password of a user, reading it from stdin", userPassword},
+		{"user delete", "<username>", "Delete a user", userDelete},
+
+		{"job list", "[--limit <n>]", "List recent jobs", jobList},
+		{"job get", "<id>", "Show a job with its steps and log", jobGet},
+		{"job watch", "<id>", "Follow a job's progress until it finishes", jobWatch},
+		{"job cancel", "<id>", "Cancel a running job", jobCancel},
+
+		{"reconcile show", "", "Show the drift found by the last reconciliation", reconcileShow},
+		{"reconcile run", "[--heal]", "Compare stored state with the infrastructure now, optionally healing drift", reconcileRun},
+
+		{"stack plan", "[--prune] <file>|-", "Show the changes that converge the current state to a stack file", stackPlan},
+		{"stack apply", "[--prune] <file>|-", "Converge the current state to a stack file", stackApply},
+
+		{"adopt list", "", "List servers, zones, DNS records and Helm releases not managed by Xanthus", adoptList},
+		{"adopt server", "[--user <user>] [--port <port>] [--password-stdin] <provider> <id>", "Adopt a provider server, installing K3s unless present", adoptServer},
+		{"adopt release", "[--type <app-type>] [--name <name>] [--subdomain <sub>] [--domain <domain>] <vps-id> <namespace>/<release>", "Adopt a Helm release as an application", adoptRelease},
+
+		{"backup target list", "", "List backup targets", backupTargetList},
+		{"backup target add", "--name <name> --endpoint <url> --bucket <bucket> [--region <region>] --access-key <key>", "Add an S3-compatible backup target, reading the secret key and repository password from stdin", backupTargetAdd},
+		{"backup target delete", "<name>", "Delete a backup target no application uses", backupTargetDelete},
+		{"backup policy get", "<app-id>", "Show the backup policy of an application", backupPolicyGet},
+		{"backup policy set", "--target <name> [--schedule <cron>] [--keep-last <n>] [--keep-daily <n>] [--keep-weekly <n>] <app-id>", "Back up the volumes of an application on a schedule", backupPolicySet},
+		{"backup policy delete", "<app-id>", "Stop backing up an application, keeping its snapshots", backupPolicyDelete},
+		{"backup list", "<app-id>", "List the snapshots of an application", backupList},
+		{"backup run", "<app-id>", "Back up an application now", backupRun},
+		{"backup restore", "<app-id> <snapshot>|latest", "Restore the volumes of an application from a snapshot", backupRestore},
+
+		{"rotate-keys", "[--cloudflare-token-stdin]", "Re-encrypt all secrets under a new key, optionally switching to a new Cloudflare token", rotateKeys},
+		{"ssh-key", "", "Show the SSH public key installed on servers", sshKey},
+		{"rotate-ssh-key", "", "Replace the SSH key on every server and retire the old one", rotateSSHKey},
+
+		{"terminal", "<vps-id>", "Open an interactive shell on a server", terminal},
+	}
+}
+
+// Run executes xanthusctl with args (without the program name) and returns the exit code
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("xanthusctl", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	serverURL := flags.String("url", envOr(EnvURL, DefaultURL), "Xanthus server URL (env "+EnvURL+")")
+	token := flags.String("token", os.Getenv(EnvToken), "API token (env "+EnvToken+")")
+	output := flags.String("output", FormatTable, "Output format: table or json")
+	flags.StringVar(output, "o", FormatTable, "Shorthand for --output")
+	flags.Usage = func() { usage(stderr, flags) }
+
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	if *output != FormatTable && *output != FormatJSON {
+		fmt.Fprintf(stderr, "Error: unknown output format %q (expected table or json)\n", *output)
+		return 2
+	}
+
+	cmd, rest, ok := findCommand(flags.Args())
+	if !ok {
+		usage(stderr, flags)
+		return 2
+	}
+
+	if *token == "" {
+		fmt.Fprintf(stderr, "Error: no API token. Pass --token or set %s.\n", EnvToken)
+		return 2
+	}
+
+	e := &env{
+		client: NewClient(*serverURL, *token),
+		out:    &printer{format: *output, out: stdout},
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+	}
+
+	if err := cmd.run(e, rest); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(stderr, "Usage: xanthusctl %s %s\n", cmd.name, cmd.args)
+			return 2
+		}
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// findCommand matches the longest command name at the start of args
+func findCommand(args []string) (command, []string, bool) {
+	var found command
+	length := 0
+	for _, cmd := range commands() {
+		words := strings.Fields(cmd.name)
+		if len(args) < len(words) || len(words) <= length {
+			continue
+		}
+		if strings.Join(args[:len(words)], " ") == cmd.name {
+			found, length = cmd, len(words)
+		}
+	}
+	if length == 0 {
+		return command{}, nil, false
+	}
+	return found, args[length:], true
+}
+
+// usage prints the global flags and the command list
+func usage(w io.Writer, flags *flag.FlagSet) {
+	fmt.Fprintln(w, "Usage: xanthusctl [flags] <command> [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-14s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	flags.PrintDefaults()
+}
+
+// parseFlags parses command flags, then checks the number of positional arguments
+func parseFlags(flags *flag.FlagSet, args []string, positional int) ([]string, error) {
+	flags.SetOutput(io.Discard)
+	if err := flags.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if flags.NArg() != positional {
+		return nil, errUsage
+	}
+	return flags.Args(), nil
+}
+
+// requireArgs checks the number of positional arguments of a command without flags
+func requireArgs(args []string, n int) error {
+	if len(args) != n {
+		return errUsage
+	}
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"flag"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func dnsList(e *env, args []string) error {
+	if err := requireArgs(args, 0); err != nil {
+		return err
+	}
+
+	var domains []api.Domain
+	if err := e.client.Do(http.MethodGet, "/dns/domains", nil, &domains); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(domains))
+	for _, d := range domains {
+		rows = append(rows, []string{d.Domain, d.Issuer, d.SSLMode, strconv.FormatBool(d.AlwaysUseHTTPS), d.ExpiresAt, d.ConfiguredAt})
+	}
+	return e.out.table(domains, []string{"DOMAIN", "ISSUER", "SSL MODE", "ALWAYS HTTPS", "EXPIRES", "CONFIGURED"}, rows)
+}
+
+func dnsConfigure(e *env, args []string) error {
+	var req api.ConfigureDomainRequest
+	flags := flag.NewFlagSet("dns configure", flag.ContinueOnError)
+	var useACME bool
+	flags.BoolVar(&useACME, "acme", false, "Issue a Let's Encrypt certificate instead of a Cloudflare origin certificate")
+	flags.BoolVar(&req.DNSOnly, "dns-only", false, "Create application records without the Cloudflare proxy (requires --acme)")
+	positional, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	req.Domain = positional[0]
+	if useACME {
+		req.Issuer = "acme"
+	}
+
+	var domain api.Domain
+	if err := e.client.Do(http.MethodPost, "/dns/domains", req, &domain); err != nil {
+		return err
+	}
+	return e.out.fields(domain, [][2]string{
+		{"Domain", domain.Domain},
+		{"Zone", domain.ZoneID},
+		{"Issuer", domain.Issuer},
+		{"DNS only", strconv.FormatBool(domain.DNSOnly)},
+		{"SSL mode", domain.SSLMode},
+		{"Always HTTPS", strconv.FormatBool(domain.AlwaysUseHTTPS)},
+		{"Configured", domain.ConfiguredAt},
+		{"Expires", domain.ExpiresAt},
+	})
+}
+
+func dnsRenew(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var domain api.Domain
+	if err := e.client.Do(http.MethodPost, "/dns/domains/"+url.PathEscape(args[0])+"/renew", nil, &domain); err != nil {
+		return err
+	}
+	return e.out.fields(domain, [][2]string{
+		{"Domain", domain.Domain},
+		{"Issuer", domain.Issuer},
+		{"Renewed", domain.RenewedAt},
+		{"Expires", domain.ExpiresAt},
+	})
+}
+
+func dnsRemove(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	if err := e.client.Do(http.MethodDelete, "/dns/domains/"+url.PathEscape(args[0]), nil, nil); err != nil {
+		return err
+	}
+	return e.out.message("Domain %s removed", args[0])
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func jobList(e *env, args []string) error {
+	flags := flag.NewFlagSet("job list", flag.ContinueOnError)
+	limit := flags.Int("limit", 20, "Number of jobs to show")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	var jobs []api.Job
+	if err := e.client.Do(http.MethodGet, "/jobs?limit="+strconv.Itoa(*limit), nil, &jobs); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(jobs))
+	for _, job := range jobs {
+		rows = append(rows, []string{job.ID, job.Type, job.Target, string(job.Status), job.CreatedAt.Format(time.RFC3339), jobDuration(job)})
+	}
+	return e.out.table(jobs, []string{"ID", "TYPE", "TARGET", "STATUS", "CREATED", "DURATION"}, rows)
+}
+
+func jobGet(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var job api.Job
+	if err := e.client.Do(http.MethodGet, "/jobs/"+url.PathEscape(args[0]), nil, &job); err != nil {
+		return err
+	}
+	if e.out.format == FormatJSON {
+		return e.out.json(job)
+	}
+
+	pairs := [][2]string{
+		{"ID", job.ID},
+		{"Type", job.Type},
+		{"Target", job.Target},
+		{"Status", string(job.Status)},
+		{"Attempt", fmt.Sprintf("%d of %d", job.Attempt, job.MaxAttempts)},
+		{"Created", job.CreatedAt.Format(time.RFC3339)},
+		{"Duration", jobDuration(job)},
+	}
+	if job.Error != "" {
+		pairs = append(pairs, [2]string{"Error", job.Error})
+	}
+	if err := e.out.fields(job, pairs); err != nil {
+		return err
+	}
+
+	if len(job.Steps) > 0 {
+		fmt.Fprintln(e.stdout)
+		rows := make([][]string, 0, len(job.Steps))
+		for _, step := range job.Steps {
+			rows = append(rows, []string{step.Name, string(step.Status), step.StartedAt.Format(time.RFC3339)})
+		}
+		if err := e.out.table(job, []string{"STEP", "STATUS", "STARTED"}, rows); err != nil {
+			return err
+		}
+	}
+
+	if len(job.Logs) > 0 {
+		fmt.Fprintln(e.stdout)
+		for _, line := range job.Logs {
+			fmt.Fprintf(e.stdout, "%s  %s\n", line.Time.Format(time.TimeOnly), line.Message)
+		}
+	}
+	return nil
+}
+
+func jobCancel(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var job api.Job
+	if err := e.client.Do(http.MethodPost, "/jobs/"+url.PathEscape(args[0])+"/cancel", nil, &job); err != nil {
+		return err
+	}
+	return e.out.message("Cancellation of job %s requested", job.ID)
+}
+
+func jobWatch(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var final *api.Job
+	started := false
+	err := e.client.Stream("/jobs/"+url.PathEscape(args[0])+"/events", func(name string, data []byte) error {
+		var event api.JobEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("failed to decode event: %w", err)
+		}
+		if e.out.format == FormatJSON {
+			return e.out.json(event)
+		}
+
+		switch name {
+		case "status":
+			// The first status event carries the log so far
+			if !started {
+				for _, line := range event.Job.Logs {
+					fmt.Fprintf(e.stdout, "%s  %s\n", line.Time.Format(time.TimeOnly), line.Message)
+				}
+				started = true
+			}
+			if event.Job.Finished() {
+				final = event.Job
+			}
+		case "log":
+			// Steps and pod status changes are logged too
+			fmt.Fprintf(e.stdout, "%s  %s\n", event.Time.Format(time.TimeOnly), event.Message)
+		}
+		return nil
+	})
+	if err != nil || final == nil {
+		return err
+	}
+
+	if final.Status != "succeeded" {
+		return errors.New("job " + string(final.Status) + ": " + final.Error)
+	}
+	return e.out.message("Job %s succeeded in %s", final.ID, jobDuration(*final))
+}
+
+// jobDuration returns how long a job ran, or has been running
+func jobDuration(job api.Job) string {
+	if job.StartedAt == nil {
+		return "-"
+	}
+	end := time.Now()
+	if job.FinishedAt != nil {
+		end = *job.FinishedAt
+	}
+	return end.Sub(*job.StartedAt).Round(time.Second).String()
+}
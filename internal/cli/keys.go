@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"flag"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func rotateKeys(e *env, args []string) error {
+	var req api.RotateKeysRequest
+	var tokenStdin bool
+	flags := flag.NewFlagSet("rotate-keys", flag.ContinueOnError)
+	flags.BoolVar(&tokenStdin, "cloudflare-token-stdin", false, "Read a new Cloudflare token from stdin and switch to it")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if tokenStdin {
+		token, err := readPassword(e)
+		if err != nil {
+			return err
+		}
+		req.CloudflareToken = token
+	}
+
+	var rotation api.KeyRotation
+	if err := e.client.Do(http.MethodPost, "/keys/rotate", req, &rotation); err != nil {
+		return err
+	}
+	if rotation.CloudflareTokenRotated {
+		return e.out.message("Re-encrypted %d secrets with key %s and switched to the new Cloudflare token, the old token can now be revoked", len(rotation.Reencrypted), rotation.KeyID)
+	}
+	return e.out.message("Re-encrypted %d secrets with key %s", len(rotation.Reencrypted), rotation.KeyID)
+}
+
+func sshKey(e *env, args []string) error {
+	if err := requireArgs(args, 0); err != nil {
+		return err
+	}
+
+	var key api.SSHKey
+	if err := e.client.Do(http.MethodGet, "/keys/ssh", nil, &key); err != nil {
+		return err
+	}
+	return e.out.fields(key, [][2]string{
+		{"Public key", key.PublicKey},
+		{"Fingerprint", key.Fingerprint},
+		{"Created", key.CreatedAt},
+		{"Legacy", strconv.FormatBool(key.Legacy)},
+	})
+}
+
+func rotateSSHKey(e *env, args []string) error {
+	if err := requireArgs(args, 0); err != nil {
+		return err
+	}
+
+	var rotation api.SSHKeyRotation
+	if err := e.client.Do(http.MethodPost, "/keys/ssh/rotate", nil, &rotation); err != nil {
+		return err
+	}
+	return e.out.fields(rotation, [][2]string{
+		{"Fingerprint", rotation.Fingerprint},
+		{"Old fingerprint", rotation.OldFingerprint},
+		{"Servers", strings.Join(rotation.Servers, ", ")},
+		{"Warnings", strings.Join(rotation.Warnings, "; ")},
+	})
+}
@@ -0,0 +1,76 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func vpsMetrics(e *env, args []string) error {
+	flags := flag.NewFlagSet("vps metrics", flag.ContinueOnError)
+	span := flags.String("range", "1h", "Time range, e.g. 6h or 7d")
+	positional, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var series api.MetricsSeries
+	if err := e.client.Do(http.MethodGet, "/vps/"+positional[0]+"/metrics?range="+url.QueryEscape(*span), nil, &series); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(series.Points))
+	for _, p := range series.Points {
+		rows = append(rows, []string{
+			p.Time.Local().Format(time.DateTime),
+			fmt.Sprintf("%.1f%%", p.CPUPercent),
+			formatBytes(p.MemoryBytes) + " / " + formatBytes(p.MemoryTotalBytes),
+			formatBytes(p.DiskBytes) + " / " + formatBytes(p.DiskTotalBytes),
+			formatBytes(p.NetRxBytesPerSec) + "/s",
+			formatBytes(p.NetTxBytesPerSec) + "/s",
+		})
+	}
+	return e.out.table(series, []string{"TIME", "CPU", "MEMORY", "DISK", "NET IN", "NET OUT"}, rows)
+}
+
+func appMetrics(e *env, args []string) error {
+	flags := flag.NewFlagSet("app metrics", flag.ContinueOnError)
+	span := flags.String("range", "1h", "Time range, e.g. 6h or 7d")
+	positional, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var series api.MetricsSeries
+	if err := e.client.Do(http.MethodGet, "/applications/"+positional[0]+"/metrics?range="+url.QueryEscape(*span), nil, &series); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(series.Points))
+	for _, p := range series.Points {
+		rows = append(rows, []string{
+			p.Time.Local().Format(time.DateTime),
+			fmt.Sprintf("%.0fm", p.CPUCores*1000),
+			formatBytes(p.MemoryBytes),
+		})
+	}
+	return e.out.table(series, []string{"TIME", "CPU", "MEMORY"}, rows)
+}
+
+// formatBytes formats a byte count with a binary unit, e.g. 1.5 GiB
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f B", bytes)
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// Output formats
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+)
+
+// printer renders command results as a table or as JSON
+type printer struct {
+	format string
+	out    io.Writer
+}
+
+// table prints rows under headers, or data as JSON when JSON output was requested
+func (p *printer) table(data interface{}, headers []string, rows [][]string) error {
+	if p.format == FormatJSON {
+		return p.json(data)
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// fields prints a single object as key/value lines, or as JSON
+func (p *printer) fields(data interface{}, pairs [][2]string) error {
+	if p.format == FormatJSON {
+		return p.json(data)
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	for _, pair := range pairs {
+		fmt.Fprintf(w, "%s:\t%s\n", pair[0], pair[1])
+	}
+	return w.Flush()
+}
+
+// message prints a confirmation, or {"message": ...} as JSON
+func (p *printer) message(format string, args ...interface{}) error {
+	text := fmt.Sprintf(format, args...)
+	if p.format == FormatJSON {
+		return p.json(map[string]string{"message": text})
+	}
+	_, err := fmt.Fprintln(p.out, text)
+	return err
+}
+
+func (p *printer) json(data interface{}) error {
+	encoder := json.NewEncoder(p.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
@@ -0,0 +1,12 @@
+//go:build !linux && !darwin
+
+package cli
+
+// isTerminal always reports false; the terminal is used in line mode on this platform
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,68 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func reconcileShow(e *env, args []string) error {
+	if err := requireArgs(args, 0); err != nil {
+		return err
+	}
+
+	var report api.ReconcileReport
+	if err := e.client.Do(http.MethodGet, "/reconcile", nil, &report); err != nil {
+		return err
+	}
+	return printReconcileReport(e, &report)
+}
+
+func reconcileRun(e *env, args []string) error {
+	var req api.ReconcileRequest
+	flags := flag.NewFlagSet("reconcile run", flag.ContinueOnError)
+	flags.BoolVar(&req.Heal, "heal", false, "Fix the drift that can be fixed safely")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+
+	var report api.ReconcileReport
+	if err := e.client.Do(http.MethodPost, "/reconcile", req, &report); err != nil {
+		return err
+	}
+	return printReconcileReport(e, &report)
+}
+
+func printReconcileReport(e *env, report *api.ReconcileReport) error {
+	if e.out.format == FormatJSON {
+		return e.out.json(report)
+	}
+
+	fmt.Fprintf(e.stdout, "Checked %d servers and %d applications at %s\n", report.Servers, report.Applications, report.FinishedAt.Local().Format(time.RFC3339))
+	for _, msg := range report.Errors {
+		fmt.Fprintf(e.stdout, "Warning: %s\n", msg)
+	}
+	if len(report.Drift) == 0 {
+		fmt.Fprintln(e.stdout, "No drift found")
+		return nil
+	}
+	fmt.Fprintln(e.stdout)
+
+	rows := make([][]string, 0, len(report.Drift))
+	for _, drift := range report.Drift {
+		state := "-"
+		switch {
+		case drift.Healed:
+			state = "healed"
+		case drift.HealError != "":
+			state = "failed: " + drift.HealError
+		case drift.Healable:
+			state = "healable"
+		}
+		rows = append(rows, []string{drift.Kind, drift.Resource, state, drift.Message})
+	}
+	return e.out.table(report, []string{"KIND", "RESOURCE", "HEAL", "MESSAGE"}, rows)
+}
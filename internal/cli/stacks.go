@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func stackPlan(e *env, args []string) error {
+	return runStack(e, "plan", args)
+}
+
+func stackApply(e *env, args []string) error {
+	return runStack(e, "apply", args)
+}
+
+// runStack sends a stack file, read from a path or "-" for stdin, to /stacks/<action>
+func runStack(e *env, action string, args []string) error {
+	var req api.StackRequest
+	flags := flag.NewFlagSet("stack "+action, flag.ContinueOnError)
+	flags.BoolVar(&req.Prune, "prune", false, "Delete servers, domains and applications missing from the stack")
+	positional, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	if positional[0] == "-" {
+		data, err = io.ReadAll(e.stdin)
+	} else {
+		data, err = os.ReadFile(positional[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read stack file: %w", err)
+	}
+	req.Stack = string(data)
+
+	var plan api.StackPlan
+	if err := e.client.Do(http.MethodPost, "/stacks/"+action, req, &plan); err != nil {
+		return err
+	}
+	if len(plan.Changes) == 0 && e.out.format != FormatJSON {
+		return e.out.message("Stack %s is up to date", plan.Stack)
+	}
+
+	rows := make([][]string, 0, len(plan.Changes))
+	for _, change := range plan.Changes {
+		rows = append(rows, []string{change.Action, change.Kind, change.Name, strings.Join(change.Details, "; ")})
+	}
+	return e.out.table(plan, []string{"ACTION", "KIND", "NAME", "DETAILS"}, rows)
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+	"github.com/gorilla/websocket"
+)
+
+// terminalMessage is a frame exchanged with the terminal WebSocket
+type terminalMessage struct {
+	Type    string `json:"type"`
+	Data    string `json:"data,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func terminal(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var session api.TerminalSession
+	if err := e.client.Do(http.MethodPost, "/vps/"+args[0]+"/terminal", nil, &session); err != nil {
+		return err
+	}
+	defer e.client.Do(http.MethodDelete, "/terminal/"+session.ID, nil, nil)
+
+	wsURL, err := e.client.websocketURL(session.WebSocketURL)
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Authorization", "Bearer "+e.client.token)
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, header)
+	if err != nil {
+		return fmt.Errorf("failed to attach to terminal: %w", err)
+	}
+	defer conn.Close()
+
+	if file, ok := e.stdin.(*os.File); ok && isTerminal(int(file.Fd())) {
+		restore, err := makeRaw(int(file.Fd()))
+		if err != nil {
+			return fmt.Errorf("failed to put terminal into raw mode: %w", err)
+		}
+		defer restore()
+	}
+
+	go forwardInput(conn, e.stdin)
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return nil
+			}
+			return fmt.Errorf("terminal connection lost: %w", err)
+		}
+
+		var msg terminalMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			continue
+		}
+
+		switch msg.Type {
+		case "output":
+			io.WriteString(e.stdout, msg.Data)
+		case "error":
+			return fmt.Errorf("terminal: %s", msg.Message)
+		case "exit":
+			return nil
+		}
+	}
+}
+
+// forwardInput sends everything read from in to the remote shell
+func forwardInput(conn *websocket.Conn, in io.Reader) {
+	buffer := make([]byte, 1024)
+	for {
+		n, err := in.Read(buffer)
+		if n > 0 {
+			if werr := conn.WriteJSON(terminalMessage{Type: "input", Data: string(buffer[:n])}); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func userList(e *env, args []string) error {
+	if err := requireArgs(args, 0); err != nil {
+		return err
+	}
+
+	var users []api.User
+	if err := e.client.Do(http.MethodGet, "/users", nil, &users); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(users))
+	for _, u := range users {
+		lastLogin := "never"
+		if u.LastLoginAt != nil {
+			lastLogin = u.LastLoginAt.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{u.Username, u.Role, u.CreatedAt.Format(time.RFC3339), lastLogin})
+	}
+	return e.out.table(users, []string{"USERNAME", "ROLE", "CREATED", "LAST LOGIN"}, rows)
+}
+
+func userAdd(e *env, args []string) error {
+	var req api.CreateUserRequest
+	flags := flag.NewFlagSet("user add", flag.ContinueOnError)
+	flags.StringVar(&req.Role, "role", "viewer", "Role: admin, operator or viewer")
+	positional, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	req.Username = positional[0]
+	if req.Password, err = readPassword(e); err != nil {
+		return err
+	}
+
+	var user api.User
+	if err := e.client.Do(http.MethodPost, "/users", req, &user); err != nil {
+		return err
+	}
+	return e.out.message("User %s created with role %s", user.Username, user.Role)
+}
+
+func userRole(e *env, args []string) error {
+	if err := requireArgs(args, 2); err != nil {
+		return err
+	}
+
+	var user api.User
+	if err := e.client.Do(http.MethodPatch, "/users/"+url.PathEscape(args[0]), api.UpdateUserRequest{Role: args[1]}, &user); err != nil {
+		return err
+	}
+	return e.out.message("User %s is now %s", user.Username, user.Role)
+}
+
+func userPassword(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+	password, err := readPassword(e)
+	if err != nil {
+		return err
+	}
+
+	var user api.User
+	if err := e.client.Do(http.MethodPatch, "/users/"+url.PathEscape(args[0]), api.UpdateUserRequest{Password: password}, &user); err != nil {
+		return err
+	}
+	return e.out.message("Password of %s reset, their sessions have been ended", user.Username)
+}
+
+func userDelete(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	if err := e.client.Do(http.MethodDelete, "/users/"+url.PathEscape(args[0]), nil, nil); err != nil {
+		return err
+	}
+	return e.out.message("User %s deleted", args[0])
+}
+
+// readPassword reads a password from the first line of stdin
+func readPassword(e *env) (string, error) {
+	password, err := bufio.NewReader(e.stdin).ReadString('\n')
+	if err != nil && password == "" {
+		return "", fmt.Errorf("failed to read password from stdin: %w", err)
+	}
+	return strings.TrimRight(password, "\r\n"), nil
+}
@@ -0,0 +1,328 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+)
+
+func vpsList(e *env, args []string) error {
+	if err := requireArgs(args, 0); err != nil {
+		return err
+	}
+
+	var servers []api.VPS
+	if err := e.client.Do(http.MethodGet, "/vps", nil, &servers); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(servers))
+	for _, s := range servers {
+		rows = append(rows, []string{strconv.Itoa(s.ID), s.Name, s.Provider, s.ServerType, s.Location, s.PublicIPv4, fmt.Sprintf("%.2f", s.MonthlyRate)})
+	}
+	return e.out.table(servers, []string{"ID", "NAME", "PROVIDER", "TYPE", "LOCATION", "IPV4", "EUR/MONTH"}, rows)
+}
+
+func vpsGet(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var server api.VPS
+	if err := e.client.Do(http.MethodGet, "/vps/"+args[0], nil, &server); err != nil {
+		return err
+	}
+	return printVPS(e, server)
+}
+
+func vpsCreate(e *env, args []string) error {
+	var req api.CreateVPSRequest
+	flags := flag.NewFlagSet("vps create", flag.ContinueOnError)
+	var cpus, memory float64
+	flags.StringVar(&req.Provider, "provider", "", "Cloud provider (hetzner, digitalocean or oci, defaults to hetzner)")
+	flags.StringVar(&req.Name, "name", "", "Server name")
+	flags.StringVar(&req.Location, "location", "", "Location or region (e.g. nbg1)")
+	flags.StringVar(&req.ServerType, "type", "", "Server type or shape (e.g. cpx21)")
+	flags.StringVar(&req.Timezone, "timezone", "", "Server timezone (defaults to the location's)")
+	flags.Float64Var(&cpus, "cpus", 0, "CPU count for flexible server types")
+	flags.Float64Var(&memory, "memory", 0, "Memory in GB for flexible server types")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	// Hetzner servers need an explicit location and type; other providers have defaults
+	hetzner := req.Provider == "" || strings.EqualFold(req.Provider, "hetzner")
+	if req.Name == "" || (hetzner && (req.Location == "" || req.ServerType == "")) {
+		return errUsage
+	}
+	req.CPUs, req.MemoryGB = float32(cpus), float32(memory)
+
+	var server api.VPS
+	if err := e.client.Do(http.MethodPost, "/vps", req, &server); err != nil {
+		return err
+	}
+	return printVPS(e, server)
+}
+
+func vpsAdd(e *env, args []string) error {
+	var req api.AddVPSRequest
+	flags := flag.NewFlagSet("vps add", flag.ContinueOnError)
+	var passwordStdin bool
+	flags.StringVar(&req.Name, "name", "", "Server name")
+	flags.StringVar(&req.Host, "host", "", "IP address or hostname of the server")
+	flags.StringVar(&req.SSHUser, "user", "", "SSH user, root or a passwordless sudo user (defaults to root)")
+	flags.IntVar(&req.SSHPort, "port", 0, "SSH port (defaults to 22)")
+	flags.StringVar(&req.Timezone, "timezone", "", "Server timezone (defaults to the server's)")
+	flags.BoolVar(&passwordStdin, "password-stdin", false, "Read the SSH password from stdin to install the Xanthus key")
+	if _, err := parseFlags(flags, args, 0); err != nil {
+		return err
+	}
+	if req.Name == "" || req.Host == "" {
+		return errUsage
+	}
+	if passwordStdin {
+		password, err := bufio.NewReader(e.stdin).ReadString('\n')
+		if err != nil && password == "" {
+			return fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		req.Password = strings.TrimRight(password, "\r\n")
+	}
+
+	var server api.VPS
+	if err := e.client.Do(http.MethodPost, "/vps/existing", req, &server); err != nil {
+		return err
+	}
+	return printVPS(e, server)
+}
+
+func vpsDelete(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	if err := e.client.Do(http.MethodDelete, "/vps/"+args[0], nil, nil); err != nil {
+		return err
+	}
+	return e.out.message("Server %s deleted", args[0])
+}
+
+func vpsTrustHostKey(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var server api.VPS
+	if err := e.client.Do(http.MethodPost, "/vps/"+args[0]+"/trust-host-key", nil, &server); err != nil {
+		return err
+	}
+	return e.out.message("Server %s is now pinned to host key %s", args[0], server.HostKeyFingerprint)
+}
+
+func vpsPower(e *env, args []string) error {
+	if err := requireArgs(args, 2); err != nil {
+		return err
+	}
+
+	req := api.VPSPowerRequest{Action: args[1]}
+	if err := e.client.Do(http.MethodPost, "/vps/"+args[0]+"/power", req, nil); err != nil {
+		return err
+	}
+	return e.out.message("%s requested for server %s", req.Action, args[0])
+}
+
+func vpsRebuild(e *env, args []string) error {
+	var req api.RebuildVPSRequest
+	flags := flag.NewFlagSet("vps rebuild", flag.ContinueOnError)
+	flags.BoolVar(&req.Replace, "replace", false, "Delete the server first if its provider still has it")
+	flags.BoolVar(&req.RestoreBackups, "restore-backups", false, "Restore the latest backup of applications with a backup policy")
+	args, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var result api.RebuildResult
+	if err := e.client.Do(http.MethodPost, "/vps/"+args[0]+"/rebuild", req, &result); err != nil {
+		return err
+	}
+	if e.out.format == FormatJSON {
+		return e.out.json(result)
+	}
+
+	fmt.Fprintf(e.stdout, "Server %s rebuilt: ID %d → %d, IPv4 %s → %s\n", result.Server.Name, result.OldServerID, result.Server.ServerID, result.OldIPv4, result.Server.PublicIPv4)
+	fmt.Fprintf(e.stdout, "Moved %d DNS records and recreated %d port forwards\n", len(result.DNSRecords), result.PortForwards)
+	for _, msg := range result.Errors {
+		fmt.Fprintf(e.stdout, "Warning: %s\n", msg)
+	}
+	if len(result.Applications) == 0 {
+		return nil
+	}
+	fmt.Fprintln(e.stdout)
+
+	rows := make([][]string, 0, len(result.Applications))
+	for _, app := range result.Applications {
+		restored := "no"
+		if app.Restored {
+			restored = "yes"
+		}
+		rows = append(rows, []string{app.ID, app.Name, app.Status, restored, app.Error})
+	}
+	return e.out.table(result, []string{"ID", "NAME", "STATUS", "RESTORED", "ERROR"}, rows)
+}
+
+func vpsNodes(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var nodes []api.ClusterNode
+	if err := e.client.Do(http.MethodGet, "/vps/"+args[0]+"/nodes", nil, &nodes); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(nodes))
+	for _, n := range nodes {
+		serverID, ready := "-", "no"
+		if n.ServerID != 0 {
+			serverID = strconv.Itoa(n.ServerID)
+		}
+		if n.Ready {
+			ready = "yes"
+		}
+		rows = append(rows, []string{n.Name, serverID, n.Role, ready, n.InternalIP, n.KubeletVersion, fmt.Sprintf("%g", n.CPUs), fmt.Sprintf("%.1f", n.MemoryGB)})
+	}
+	return e.out.table(nodes, []string{"NAME", "VPS", "ROLE", "READY", "INTERNAL IP", "VERSION", "CPUS", "MEMORY GB"}, rows)
+}
+
+func vpsCapacity(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var info api.ClusterInfo
+	if err := e.client.Do(http.MethodGet, "/vps/"+args[0]+"/capacity", nil, &info); err != nil {
+		return err
+	}
+	return e.out.fields(info, [][2]string{
+		{"Nodes", strconv.Itoa(info.NodeCount)},
+		{"Free CPU", fmt.Sprintf("%.2f", info.AvailableCPU)},
+		{"Free memory", fmt.Sprintf("%d GB", info.AvailableMemoryGB)},
+		{"Free disk", fmt.Sprintf("%d GB", info.AvailableDiskGB)},
+		{"Kubernetes", info.KubernetesVersion},
+		{"Helm", info.HelmVersion},
+	})
+}
+
+func vpsK3sVersions(e *env, args []string) error {
+	if err := requireArgs(args, 1); err != nil {
+		return err
+	}
+
+	var versions api.K3sVersions
+	if err := e.client.Do(http.MethodGet, "/vps/"+args[0]+"/k3s", nil, &versions); err != nil {
+		return err
+	}
+	if e.out.format == FormatJSON {
+		return e.out.json(versions)
+	}
+
+	fmt.Fprintf(e.stdout, "K3s %s\n", versions.Current)
+	if len(versions.Available) == 0 {
+		fmt.Fprintln(e.stdout, "No upgrades available")
+	} else {
+		fmt.Fprintf(e.stdout, "Upgrades available: %s\n", strings.Join(versions.Available, ", "))
+	}
+	fmt.Fprintln(e.stdout)
+	return printK3sNodes(e, versions.Nodes)
+}
+
+func vpsK3sUpgrade(e *env, args []string) error {
+	if err := requireArgs(args, 2); err != nil {
+		return err
+	}
+
+	var result api.K3sUpgradeResult
+	req := api.UpgradeK3sRequest{Version: args[1]}
+	if err := e.client.Do(http.MethodPost, "/vps/"+args[0]+"/k3s/upgrade", req, &result); err != nil {
+		return err
+	}
+	if e.out.format == FormatJSON {
+		return e.out.json(result)
+	}
+
+	fmt.Fprintf(e.stdout, "K3s upgraded from %s to %s\n\n", result.From, result.To)
+	return printK3sNodes(e, result.Nodes)
+}
+
+func printK3sNodes(e *env, nodes []api.ClusterNode) error {
+	rows := make([][]string, 0, len(nodes))
+	for _, n := range nodes {
+		ready := "no"
+		if n.Ready {
+			ready = "yes"
+		}
+		rows = append(rows, []string{n.Name, n.Role, ready, n.KubeletVersion})
+	}
+	return e.out.table(nodes, []string{"NAME", "ROLE", "READY", "VERSION"}, rows)
+}
+
+func vpsJoin(e *env, args []string) error {
+	var req api.JoinNodeRequest
+	flags := flag.NewFlagSet("vps join", flag.ContinueOnError)
+	var cpus, memory float64
+	var passwordStdin bool
+	flags.StringVar(&req.Name, "name", "", "Node name")
+	flags.StringVar(&req.Provider, "provider", "", "Cloud provider, or manual to add a server by --host (defaults to the server's)")
+	flags.StringVar(&req.Location, "location", "", "Location or region (defaults to the server's)")
+	flags.StringVar(&req.ServerType, "type", "", "Server type or shape (e.g. cpx21)")
+	flags.StringVar(&req.Timezone, "timezone", "", "Node timezone")
+	flags.Float64Var(&cpus, "cpus", 0, "CPU count for flexible server types")
+	flags.Float64Var(&memory, "memory", 0, "Memory in GB for flexible server types")
+	flags.StringVar(&req.Host, "host", "", "IP address or hostname of a manual node")
+	flags.StringVar(&req.SSHUser, "user", "", "SSH user of a manual node (defaults to root)")
+	flags.IntVar(&req.SSHPort, "port", 0, "SSH port of a manual node (defaults to 22)")
+	flags.BoolVar(&passwordStdin, "password-stdin", false, "Read the SSH password of a manual node from stdin to install the Xanthus key")
+	args, err := parseFlags(flags, args, 1)
+	if err != nil {
+		return err
+	}
+	if req.Name == "" {
+		return errUsage
+	}
+	if req.Host != "" && req.Provider == "" {
+		req.Provider = "manual"
+	}
+	req.CPUs, req.MemoryGB = float32(cpus), float32(memory)
+	if passwordStdin {
+		lines, err := readLines(e, 1)
+		if err != nil {
+			return fmt.Errorf("failed to read password from stdin: %w", err)
+		}
+		req.Password = lines[0]
+	}
+
+	var node api.VPS
+	if err := e.client.Do(http.MethodPost, "/vps/"+args[0]+"/nodes", req, &node); err != nil {
+		return err
+	}
+	return e.out.message("Node %s (ID %d) joined the cluster of server %s", node.Name, node.ID, args[0])
+}
+
+func printVPS(e *env, s api.VPS) error {
+	return e.out.fields(s, [][2]string{
+		{"ID", strconv.Itoa(s.ID)},
+		{"Name", s.Name},
+		{"Provider", s.Provider},
+		{"Type", s.ServerType},
+		{"Location", s.Location},
+		{"IPv4", s.PublicIPv4},
+		{"SSH user", s.SSHUser},
+		{"Host key", s.HostKeyFingerprint},
+		{"Timezone", s.Timezone},
+		{"Monthly rate", fmt.Sprintf("%.2f", s.MonthlyRate)},
+		{"Created", s.CreatedAt},
+	})
+}
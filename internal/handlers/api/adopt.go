@@ -0,0 +1,106 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListAdoptionCandidates lists the resources Xanthus could take over
+func (h *Handler) ListAdoptionCandidates(c *gin.Context) {
+	token, accountID := credentials(c)
+	candidates, err := h.adoption().Discover(c.Request.Context(), token, accountID)
+	if err != nil {
+		log.Printf("API: error discovering unmanaged resources: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to list unmanaged resources: "+err.Error())
+		return
+	}
+	respond(c, http.StatusOK, candidates)
+}
+
+// AdoptServer stores the configuration of a provider server Xanthus didn't create
+func (h *Handler) AdoptServer(c *gin.Context) {
+	var req AdoptServerRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, accountID := credentials(c)
+	var config *services.VPSConfig
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeAdoptServer, Target: fmt.Sprintf("%s/%d", req.Provider, req.ID)}, func(ctx context.Context) error {
+		var err error
+		config, err = h.adoption().AdoptServer(ctx, token, accountID, services.AdoptServerRequest{
+			Provider: req.Provider,
+			ID:       req.ID,
+			SSHUser:  req.SSHUser,
+			SSHPort:  req.SSHPort,
+			Password: req.Password,
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("API: error adopting %s server %d: %v", req.Provider, req.ID, err)
+		respondAdoptionError(c, err)
+		return
+	}
+
+	h.vpsService.InvalidateVPSCache(accountID)
+	log.Printf("✅ API: adopted %s server %s (ID: %d)", config.Provider, config.Name, config.ServerID)
+	respond(c, http.StatusCreated, vpsFromConfig(config))
+}
+
+// AdoptRelease stores an application for a Helm release on a managed server
+func (h *Handler) AdoptRelease(c *gin.Context) {
+	var req AdoptReleaseRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, accountID := credentials(c)
+	var app *models.Application
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeAdoptRelease, Target: req.Namespace + "/" + req.Release}, func(ctx context.Context) error {
+		var err error
+		app, err = h.adoption().AdoptRelease(ctx, token, accountID, services.AdoptReleaseRequest{
+			ServerID:  req.ServerID,
+			Namespace: req.Namespace,
+			Release:   req.Release,
+			AppType:   req.AppType,
+			Name:      req.Name,
+			Subdomain: req.Subdomain,
+			Domain:    req.Domain,
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("API: error adopting release %s/%s on server %d: %v", req.Namespace, req.Release, req.ServerID, err)
+		respondAdoptionError(c, err)
+		return
+	}
+
+	log.Printf("✅ API: adopted release %s/%s as application %s", req.Namespace, req.Release, app.ID)
+	respond(c, http.StatusCreated, app)
+}
+
+// respondAdoptionError maps adoption errors to status codes
+func respondAdoptionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAdoptionNotFound):
+		respondError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrAlreadyManaged):
+		respondError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidAdoptionRequest):
+		respondError(c, http.StatusBadRequest, err.Error())
+	default:
+		respondError(c, http.StatusBadGateway, "Adoption failed: "+err.Error())
+	}
+}
+
+func (h *Handler) adoption() *services.AdoptionService {
+	return services.NewAdoptionService(h.appsHandler.GetCatalog())
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/handlers/applications"
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListApplications returns all applications
+func (h *Handler) ListApplications(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	apps, err := h.appsHandler.GetApplicationService().ListApplications(token, accountID)
+	if err != nil {
+		log.Printf("API: error listing applications: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to list applications")
+		return
+	}
+
+	respond(c, http.StatusOK, apps)
+}
+
+// GetApplication returns a single application
+func (h *Handler) GetApplication(c *gin.Context) {
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+	respond(c, http.StatusOK, app)
+}
+
+// CreateApplication deploys an application from the catalog
+func (h *Handler) CreateApplication(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	var req CreateApplicationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	validator := applications.NewValidationHelper()
+	if err := validator.ValidateSubdomainAvailability(token, accountID, req.Subdomain, req.Domain); err != nil {
+		respondError(c, http.StatusConflict, err.Error())
+		return
+	}
+
+	predefinedApp, exists := h.appsHandler.GetCatalog().GetApplicationByID(req.AppType)
+	if !exists {
+		respondError(c, http.StatusBadRequest, "Invalid application type")
+		return
+	}
+
+	vpsConfig, err := applications.NewVPSConnectionHelper().GetVPSConfigByID(token, accountID, req.VPSID)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid VPS selection")
+		return
+	}
+
+	if req.Version != "" {
+		predefinedApp.Version = req.Version
+	}
+
+	if err := validator.ValidateClusterCapacity(token, accountID, req.VPSID, predefinedApp); err != nil {
+		respondError(c, http.StatusConflict, err.Error())
+		return
+	}
+
+	appData := map[string]interface{}{
+		"subdomain":   req.Subdomain,
+		"domain":      req.Domain,
+		"vps_id":      req.VPSID,
+		"vps_name":    vpsConfig.Name,
+		"description": req.Description,
+		"values":      req.Values,
+	}
+
+	var app *models.Application
+	err = h.runJob(c, services.JobSpec{Type: services.JobTypeAppDeploy, Target: req.Subdomain + "." + req.Domain}, func(ctx context.Context) error {
+		var err error
+		app, err = h.appsHandler.GetApplicationService().CreateApplication(ctx, token, accountID, appData, predefinedApp)
+		if err == nil && app.Status == "Failed" {
+			return errors.New(app.ErrorMsg)
+		}
+		return err
+	})
+	if app == nil {
+		log.Printf("API: error creating application: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to create application")
+		return
+	}
+
+	response := CreateApplicationResponse{Application: app}
+	if app.Status == string(applications.StatusDeployed) &&
+		(app.AppType == string(applications.TypeCodeServer) || app.AppType == string(applications.TypeArgoCD)) {
+		if password, err := applications.NewPasswordHelper().GetDecryptedPassword(token, accountID, app.ID); err == nil {
+			response.InitialPassword = password
+			if app.AppType == string(applications.TypeArgoCD) {
+				response.Username = "admin"
+			}
+		}
+	}
+
+	respond(c, http.StatusCreated, response)
+}
+
+// GetApplicationPassword returns the current password of a code-server or ArgoCD application
+func (h *Handler) GetApplicationPassword(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	var (
+		password ApplicationPassword
+		err      error
+	)
+	switch app.AppType {
+	case string(applications.TypeArgoCD):
+		password.Username = "admin"
+		password.Password, err = applications.NewArgoCDHandlers().GetPassword(token, accountID, app.ID, struct {
+			VPSID     string
+			Namespace string
+		}{app.VPSID, app.Namespace})
+	case string(applications.TypeCodeServer):
+		password.Password, err = applications.NewPasswordHelper().GetDecryptedPassword(token, accountID, app.ID)
+	default:
+		respondError(c, http.StatusBadRequest, "Password retrieval is only supported for code-server and ArgoCD applications")
+		return
+	}
+
+	if err != nil {
+		log.Printf("API: error retrieving %s password: %v", app.AppType, err)
+		respondError(c, http.StatusInternalServerError, "Failed to retrieve password")
+		return
+	}
+
+	respond(c, http.StatusOK, password)
+}
+
+// UpgradeApplication upgrades an application to another version
+func (h *Handler) UpgradeApplication(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	var req UpgradeApplicationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if app.AppType == string(applications.TypeCodeServer) && req.Version != "latest" {
+		valid, err := applications.NewCodeServerHandlers().ValidateVersion(req.Version)
+		if err != nil {
+			respondError(c, http.StatusInternalServerError, "Failed to validate version")
+			return
+		}
+		if !valid {
+			respondError(c, http.StatusBadRequest, "Invalid version specified")
+			return
+		}
+	}
+
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeAppUpgrade, Target: app.ID, MaxAttempts: 2}, func(ctx context.Context) error {
+		return services.NewApplicationDeploymentService().UpgradeApplication(ctx, token, accountID, app.ID, req.Version)
+	})
+	if err != nil {
+		log.Printf("API: error upgrading application %s: %v", app.ID, err)
+		respondError(c, http.StatusInternalServerError, "Failed to upgrade application")
+		return
+	}
+
+	upgraded, err := h.appsHandler.GetApplicationService().GetApplication(token, accountID, app.ID)
+	if err != nil {
+		upgraded = app
+	}
+	respond(c, http.StatusOK, upgraded)
+}
+
+// DeleteApplication removes an application and its resources
+func (h *Handler) DeleteApplication(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeAppDelete, Target: app.ID}, func(ctx context.Context) error {
+		return h.appsHandler.GetApplicationService().DeleteApplication(ctx, token, accountID, app.ID)
+	})
+	if err != nil {
+		log.Printf("API: error deleting application %s: %v", app.ID, err)
+		respondError(c, http.StatusInternalServerError, "Failed to delete application")
+		return
+	}
+
+	respondMessage(c, http.StatusOK, "Application deleted")
+}
+
+// ListPortForwards returns the port forwards of an application
+func (h *Handler) ListPortForwards(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	portForwards, err := applications.NewPortForwardService().ListPortForwards(token, accountID, app.ID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list port forwards")
+		return
+	}
+
+	respond(c, http.StatusOK, portForwards)
+}
+
+// CreatePortForward exposes an application port on a subdomain
+func (h *Handler) CreatePortForward(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	var req CreatePortForwardRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if req.Port < 1 || req.Port > 65535 {
+		respondError(c, http.StatusBadRequest, "Port must be between 1 and 65535")
+		return
+	}
+
+	if app.AppType != string(applications.TypeCodeServer) {
+		respondError(c, http.StatusBadRequest, "Port forwarding is only supported for code-server applications")
+		return
+	}
+
+	portForward, err := applications.NewPortForwardService().CreatePortForward(token, accountID, app.ID, req.Port, req.Subdomain)
+	if err != nil {
+		log.Printf("API: error creating port forward: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to create port forward: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusCreated, portForward)
+}
+
+// DeletePortForward removes a port forward
+func (h *Handler) DeletePortForward(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	if err := applications.NewPortForwardService().DeletePortForward(token, accountID, app.ID, c.Param("port_id")); err != nil {
+		log.Printf("API: error deleting port forward: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to delete port forward: "+err.Error())
+		return
+	}
+
+	respondMessage(c, http.StatusOK, "Port forward deleted")
+}
+
+// lookupApplication loads the application named by the :id path parameter
+func (h *Handler) lookupApplication(c *gin.Context) (*Application, bool) {
+	token, accountID := credentials(c)
+
+	app, err := h.appsHandler.GetApplicationService().GetApplication(token, accountID, c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Application not found")
+		return nil, false
+	}
+
+	return app, true
+}
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListBackupTargets lists the buckets backups can be stored in
+func (h *Handler) ListBackupTargets(c *gin.Context) {
+	token, accountID := credentials(c)
+	targets, err := services.NewBackupService().ListTargets(token, accountID)
+	if err != nil {
+		log.Printf("API: error listing backup targets: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to list backup targets")
+		return
+	}
+	respond(c, http.StatusOK, targets)
+}
+
+// CreateBackupTarget adds a backup target or replaces the one with the same name
+func (h *Handler) CreateBackupTarget(c *gin.Context) {
+	var req CreateBackupTargetRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, accountID := credentials(c)
+	target, err := services.NewBackupService().PutTarget(token, accountID, services.BackupTargetRequest{
+		Name:      req.Name,
+		Endpoint:  req.Endpoint,
+		Bucket:    req.Bucket,
+		Region:    req.Region,
+		AccessKey: req.AccessKey,
+		SecretKey: req.SecretKey,
+		Password:  req.Password,
+	})
+	if err != nil {
+		log.Printf("API: error storing backup target %s: %v", req.Name, err)
+		respondBackupError(c, err)
+		return
+	}
+	respond(c, http.StatusCreated, target)
+}
+
+// DeleteBackupTarget deletes a backup target no application uses
+func (h *Handler) DeleteBackupTarget(c *gin.Context) {
+	token, accountID := credentials(c)
+	name := c.Param("name")
+	if err := services.NewBackupService().DeleteTarget(token, accountID, name); err != nil {
+		log.Printf("API: error deleting backup target %s: %v", name, err)
+		respondBackupError(c, err)
+		return
+	}
+	respondMessage(c, http.StatusOK, "Backup target deleted")
+}
+
+// GetBackupPolicy returns the backup policy of an application
+func (h *Handler) GetBackupPolicy(c *gin.Context) {
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	policy, err := services.NewBackupService().GetPolicy(token, accountID, app.ID)
+	if err != nil {
+		respondBackupError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, policy)
+}
+
+// SetBackupPolicy installs the backup schedule of an application
+func (h *Handler) SetBackupPolicy(c *gin.Context) {
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	var req SetBackupPolicyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, accountID := credentials(c)
+	var policy *services.BackupPolicy
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeBackupPolicy, Target: app.ID}, func(ctx context.Context) error {
+		var err error
+		policy, err = services.NewBackupService().SetPolicy(ctx, token, accountID, services.BackupPolicy{
+			AppID:    app.ID,
+			Target:   req.Target,
+			Schedule: req.Schedule,
+			Retention: services.BackupRetention{
+				KeepLast:   req.KeepLast,
+				KeepDaily:  req.KeepDaily,
+				KeepWeekly: req.KeepWeekly,
+			},
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("API: error setting backup policy of %s: %v", app.ID, err)
+		respondBackupError(c, err)
+		return
+	}
+
+	log.Printf("✅ API: backing up %s to %s on %q", app.ID, policy.Target, policy.Schedule)
+	respond(c, http.StatusOK, policy)
+}
+
+// DeleteBackupPolicy stops backing up an application; its snapshots are kept
+func (h *Handler) DeleteBackupPolicy(c *gin.Context) {
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	if err := services.NewBackupService().DeletePolicy(c.Request.Context(), token, accountID, app.ID); err != nil {
+		log.Printf("API: error deleting backup policy of %s: %v", app.ID, err)
+		respondBackupError(c, err)
+		return
+	}
+	respondMessage(c, http.StatusOK, "Backup policy deleted")
+}
+
+// ListBackupSnapshots lists the snapshots of an application, newest first
+func (h *Handler) ListBackupSnapshots(c *gin.Context) {
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	snapshots, err := services.NewBackupService().ListSnapshots(c.Request.Context(), token, accountID, app.ID)
+	if err != nil {
+		log.Printf("API: error listing snapshots of %s: %v", app.ID, err)
+		respondBackupError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, snapshots)
+}
+
+// RunBackup backs up an application now, outside its schedule
+func (h *Handler) RunBackup(c *gin.Context) {
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeBackupRun, Target: app.ID}, func(ctx context.Context) error {
+		return services.NewBackupService().RunBackup(ctx, token, accountID, app.ID)
+	})
+	if err != nil {
+		log.Printf("API: error backing up %s: %v", app.ID, err)
+		respondBackupError(c, err)
+		return
+	}
+
+	log.Printf("✅ API: backed up %s", app.ID)
+	respondMessage(c, http.StatusOK, "Backup completed")
+}
+
+// RestoreBackup replaces the volumes of an application with a snapshot
+func (h *Handler) RestoreBackup(c *gin.Context) {
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	snapshot := c.Param("snapshot")
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeBackupRestore, Target: app.ID}, func(ctx context.Context) error {
+		return services.NewBackupService().Restore(ctx, token, accountID, app.ID, snapshot)
+	})
+	if err != nil {
+		log.Printf("API: error restoring %s from snapshot %s: %v", app.ID, snapshot, err)
+		respondBackupError(c, err)
+		return
+	}
+
+	log.Printf("✅ API: restored %s from snapshot %s", app.ID, snapshot)
+	respondMessage(c, http.StatusOK, "Snapshot restored")
+}
+
+// respondBackupError maps backup errors to status codes
+func respondBackupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidBackupRequest):
+		respondError(c, http.StatusBadRequest, err.Error())
+	case errors.Is(err, services.ErrBackupNotFound):
+		respondError(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrBackupTargetInUse):
+		respondError(c, http.StatusConflict, err.Error())
+	default:
+		respondError(c, http.StatusBadGateway, "Backup failed: "+err.Error())
+	}
+}
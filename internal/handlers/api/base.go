@@ -0,0 +1,91 @@
+// Package api implements the versioned JSON REST API served under /api/v1.
+package api
+
+import (
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/handlers"
+	"github.com/chrishham/xanthus/internal/handlers/applications"
+	"github.com/chrishham/xanthus/internal/middleware"
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// Version is the API version served by this package
+const Version = "v1"
+
+// Handler serves the /api/v1 endpoints
+type Handler struct {
+	kvService   *services.KVService
+	vpsService  *services.VPSService
+	cfService   *services.CloudflareService
+	tokens      func() *services.APITokenService
+	users       func() *services.UserService
+	keyRotation func() *services.KeyRotationService
+	sshKeys     func() *services.SSHKeyService
+	jobs        func() *services.JobManager
+	reconciler  func() *services.Reconciler
+	metrics     func() *services.MetricsCollector
+	appsHandler *applications.Handler
+	versions    *handlers.VersionHandler
+	terminals   *services.WebSocketTerminalService
+}
+
+// NewHandler creates the API handler. Applications, versions and terminal sessions
+// share state with the web UI handlers so work started from either side is visible to both.
+func NewHandler(appsHandler *applications.Handler, versionHandler *handlers.VersionHandler, terminalService *services.WebSocketTerminalService) *Handler {
+	return &Handler{
+		kvService:   services.NewKVService(),
+		vpsService:  services.NewVPSService(),
+		cfService:   services.NewCloudflareService(),
+		tokens:      middleware.GetAPITokenService,
+		users:       middleware.GetUserService,
+		keyRotation: services.NewKeyRotationService,
+		sshKeys:     services.NewSSHKeyService,
+		jobs:        services.GetJobManager,
+		reconciler:  services.GetReconciler,
+		metrics:     services.GetMetricsCollector,
+		appsHandler: appsHandler,
+		versions:    versionHandler,
+		terminals:   terminalService,
+	}
+}
+
+// credentials returns the Cloudflare token and account resolved by APIAuthMiddleware
+func credentials(c *gin.Context) (token, accountID string) {
+	return c.GetString("cf_token"), c.GetString("account_id")
+}
+
+// runJob runs fn as a job of the caller's account and waits for it. The job ID
+// is returned in the X-Job-ID header so the caller can inspect it under /jobs.
+func (h *Handler) runJob(c *gin.Context, spec services.JobSpec, fn services.JobFunc) error {
+	token, accountID := credentials(c)
+	job, err := h.jobs().Run(token, accountID, spec, fn)
+	c.Header(utils.JobIDHeader, job.ID)
+	return err
+}
+
+// respond writes a successful API response
+func respond(c *gin.Context, status int, data interface{}) {
+	c.JSON(status, utils.SuccessResponse{Success: true, Data: data})
+}
+
+// respondMessage writes a successful API response that only carries a message
+func respondMessage(c *gin.Context, status int, message string) {
+	c.JSON(status, utils.SuccessResponse{Success: true, Message: message})
+}
+
+// respondError writes an API error response
+func respondError(c *gin.Context, status int, message string) {
+	utils.JSONError(c, status, message)
+}
+
+// bindJSON decodes the request body, answering 400 on failure
+func bindJSON(c *gin.Context, v interface{}) bool {
+	if err := c.ShouldBindJSON(v); err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
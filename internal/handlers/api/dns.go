@@ -0,0 +1,104 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListDomains returns the domains managed by Xanthus
+func (h *Handler) ListDomains(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	configs, err := h.kvService.ListDomainSSLConfigs(token, accountID)
+	if err != nil {
+		log.Printf("API: error listing domains: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to list domains")
+		return
+	}
+
+	domains := make([]Domain, 0, len(configs))
+	for _, config := range configs {
+		domains = append(domains, domainFromConfig(config))
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Domain < domains[j].Domain })
+
+	respond(c, http.StatusOK, domains)
+}
+
+// ConfigureDomain configures SSL and DNS for a Cloudflare domain
+func (h *Handler) ConfigureDomain(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	var req ConfigureDomainRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	sslConfig, err := h.cfService.ConfigureDomain(c.Request.Context(), h.kvService, token, accountID, req.Domain, req.Issuer, req.DNSOnly)
+	switch {
+	case errors.Is(err, services.ErrDomainConfigured):
+		respondError(c, http.StatusConflict, "Domain already configured")
+		return
+	case errors.Is(err, services.ErrInvalidIssuer):
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	case err != nil:
+		log.Printf("API: error configuring domain %s: %v", req.Domain, err)
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("SSL configuration failed: %v", err))
+		return
+	}
+
+	log.Printf("✅ API: SSL configuration completed for domain: %s", req.Domain)
+	respond(c, http.StatusCreated, domainFromConfig(sslConfig))
+}
+
+// RemoveDomain reverts the Cloudflare changes made for a domain
+func (h *Handler) RemoveDomain(c *gin.Context) {
+	token, accountID := credentials(c)
+	domain := c.Param("domain")
+
+	config, err := h.kvService.GetDomainSSLConfig(token, accountID, domain)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "Domain configuration not found")
+		return
+	}
+
+	if err := h.cfService.RemoveDomainFromXanthus(token, domain, config); err != nil {
+		log.Printf("API: error reverting Cloudflare changes for domain %s: %v", domain, err)
+		respondError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to revert Cloudflare changes: %v", err))
+		return
+	}
+
+	if err := h.kvService.DeleteDomainSSLConfig(token, accountID, domain); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to remove configuration")
+		return
+	}
+
+	respondMessage(c, http.StatusOK, "Domain removed")
+}
+
+// RenewDomain renews the certificate of a managed domain and installs it on its servers
+func (h *Handler) RenewDomain(c *gin.Context) {
+	token, accountID := credentials(c)
+	domain := c.Param("domain")
+
+	if _, err := h.kvService.GetDomainSSLConfig(token, accountID, domain); err != nil {
+		respondError(c, http.StatusNotFound, "Domain configuration not found")
+		return
+	}
+
+	config, err := services.GetCertRenewalService().RenewDomain(c.Request.Context(), token, accountID, domain)
+	if err != nil {
+		log.Printf("API: error renewing certificate for domain %s: %v", domain, err)
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Certificate renewal failed: %v", err))
+		return
+	}
+
+	respond(c, http.StatusOK, domainFromConfig(config))
+}
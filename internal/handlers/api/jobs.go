@@ -0,0 +1,129 @@
+package api
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultJobListLimit is how many jobs GET /jobs returns without ?limit=
+	defaultJobListLimit = 50
+	// jobEventKeepAlive is how often an idle event stream sends a comment,
+	// so proxies do not time it out
+	jobEventKeepAlive = 15 * time.Second
+)
+
+// ListJobs returns the most recent jobs, newest first
+func (h *Handler) ListJobs(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	limit := defaultJobListLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			respondError(c, http.StatusBadRequest, "limit must be a positive number")
+			return
+		}
+		limit = n
+	}
+
+	jobs, err := h.jobs().List(token, accountID, limit)
+	if err != nil {
+		log.Printf("API: error listing jobs: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to list jobs")
+		return
+	}
+
+	respond(c, http.StatusOK, jobs)
+}
+
+// GetJob returns a job with its steps and log
+func (h *Handler) GetJob(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	job, err := h.jobs().Get(token, accountID, c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	respond(c, http.StatusOK, job)
+}
+
+// StreamJobEvents streams a job's progress as server-sent events. The first
+// event is a status event with the job so far; step, log and pod events
+// follow as they happen, and the stream ends with the job's final status.
+func (h *Handler) StreamJobEvents(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	job, events, unsubscribe, err := h.jobs().Subscribe(token, accountID, c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	c.SSEvent(services.JobEventStatus, services.JobEvent{Type: services.JobEventStatus, Time: time.Now(), Job: job})
+	c.Writer.Flush()
+	if events == nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(jobEventKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			c.SSEvent(event.Type, event)
+		case <-keepAlive.C:
+			if _, err := c.Writer.WriteString(": keep-alive\n\n"); err != nil {
+				return
+			}
+		case <-c.Request.Context().Done():
+			return
+		}
+		c.Writer.Flush()
+	}
+}
+
+// CancelJob asks a running job to stop
+func (h *Handler) CancelJob(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	job, err := h.jobs().Cancel(token, accountID, c.Param("id"))
+	if err != nil {
+		respondJobError(c, err)
+		return
+	}
+
+	respond(c, http.StatusAccepted, job)
+}
+
+// respondJobError maps job manager errors to API responses
+func respondJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrJobNotFound):
+		respondError(c, http.StatusNotFound, "Job not found")
+	case errors.Is(err, services.ErrJobFinished):
+		respondError(c, http.StatusConflict, "Job already finished")
+	default:
+		log.Printf("API: error reading job %s: %v", c.Param("id"), err)
+		respondError(c, http.StatusInternalServerError, "Failed to read job")
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// RotateKeys re-encrypts every stored secret under a new data-encryption key.
+// With a new Cloudflare token, the keyring and instance credentials move to it
+// so the old token can be revoked afterwards.
+func (h *Handler) RotateKeys(c *gin.Context) {
+	var req RotateKeysRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, accountID := credentials(c)
+	newToken := req.CloudflareToken
+	if newToken != "" {
+		if !utils.VerifyCloudflareToken(newToken) {
+			respondError(c, http.StatusBadRequest, "The new Cloudflare token is invalid")
+			return
+		}
+		exists, newAccountID, err := utils.CheckKVNamespaceExists(newToken)
+		if err != nil || !exists || newAccountID != accountID {
+			respondError(c, http.StatusBadRequest, "The new Cloudflare token must have access to the Xanthus namespace of account "+accountID)
+			return
+		}
+	}
+
+	// The instance moves to the new token before the keyring is re-wrapped
+	// for it, and back to the old one if the re-wrap fails, so it can always
+	// unlock the keyring after a restart
+	var storeToken func(string) error
+	if newToken != "" && newToken != token {
+		storeToken = func(instanceToken string) error {
+			if _, instanceAccount, err := h.users().InstanceCredentials(); err == nil && instanceAccount == accountID {
+				return h.users().SetInstanceToken(instanceToken)
+			}
+			return nil
+		}
+	}
+
+	result, err := h.keyRotation().Rotate(token, newToken, accountID, storeToken)
+	if err != nil {
+		log.Printf("Error rotating keys for account %s: %v", accountID, err)
+		respondError(c, http.StatusInternalServerError, "Failed to rotate keys: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusOK, KeyRotation{
+		KeyID:                  result.KeyID,
+		Reencrypted:            result.Reencrypted,
+		CloudflareTokenRotated: storeToken != nil,
+	})
+}
+
+// GetSSHKey returns the public SSH key installed on every server
+func (h *Handler) GetSSHKey(c *gin.Context) {
+	token, accountID := credentials(c)
+	pair, err := h.sshKeys().KeyPair(token, accountID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to get SSH key: "+err.Error())
+		return
+	}
+	respond(c, http.StatusOK, SSHKey{
+		PublicKey:   pair.PublicKey,
+		Fingerprint: pair.Fingerprint,
+		CreatedAt:   pair.CreatedAt,
+		Legacy:      pair.Legacy,
+	})
+}
+
+// RotateSSHKey moves every server to a new SSH key and retires the old one
+func (h *Handler) RotateSSHKey(c *gin.Context) {
+	token, accountID := credentials(c)
+	result, err := h.sshKeys().RotateKey(c.Request.Context(), token, accountID)
+	if err != nil {
+		log.Printf("Error rotating SSH key for account %s: %v", accountID, err)
+		respondError(c, http.StatusInternalServerError, "Failed to rotate SSH key: "+err.Error())
+		return
+	}
+	respond(c, http.StatusOK, SSHKeyRotation{
+		Fingerprint:    result.Fingerprint,
+		OldFingerprint: result.OldFingerprint,
+		Servers:        result.Servers,
+		Warnings:       result.Warnings,
+	})
+}
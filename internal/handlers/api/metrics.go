@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMetricsRange = time.Hour
+	maxMetricsRange     = 30 * 24 * time.Hour
+)
+
+// GetVPSMetrics returns the usage history of a server and the usage of the
+// pods of its cluster at the latest sample
+func (h *Handler) GetVPSMetrics(c *gin.Context) {
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+	span, ok := metricsRange(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	series, err := h.metrics().VPSMetrics(token, accountID, config.ServerID, span)
+	respondMetrics(c, series, err)
+}
+
+// GetApplicationMetrics returns the usage history of the pods of an application
+func (h *Handler) GetApplicationMetrics(c *gin.Context) {
+	app, ok := h.lookupApplication(c)
+	if !ok {
+		return
+	}
+	span, ok := metricsRange(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	series, err := h.metrics().ApplicationMetrics(token, accountID, app.ID, span)
+	respondMetrics(c, series, err)
+}
+
+func respondMetrics(c *gin.Context, series *services.MetricsSeries, err error) {
+	switch {
+	case errors.Is(err, services.ErrNoMetrics):
+		respondError(c, http.StatusNotFound, err.Error())
+	case err != nil:
+		log.Printf("API: error reading metrics: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to read metrics")
+	default:
+		respond(c, http.StatusOK, series)
+	}
+}
+
+// metricsRange parses the ?range= of a metrics request, a duration like 6h or
+// a number of days like 7d
+func metricsRange(c *gin.Context) (time.Duration, bool) {
+	value := c.Query("range")
+	if value == "" {
+		return defaultMetricsRange, true
+	}
+
+	span, err := time.ParseDuration(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, atoiErr := strconv.Atoi(days)
+		span, err = time.Duration(n)*24*time.Hour, atoiErr
+	}
+	if err != nil || span <= 0 || span > maxMetricsRange {
+		respondError(c, http.StatusBadRequest, fmt.Sprintf("range must be a duration like 6h or 7d, up to %dd", int(maxMetricsRange.Hours()/24)))
+		return 0, false
+	}
+	return span, true
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// pathParamPattern matches gin path parameters (":id")
+var pathParamPattern = regexp.MustCompile(`:([A-Za-z_]+)`)
+
+// OpenAPIDocument returns the OpenAPI document of the API without needing live services
+func OpenAPIDocument() map[string]interface{} {
+	return (&Handler{}).OpenAPI()
+}
+
+// OpenAPI generates an OpenAPI 3.0 document from the route table and the schema types
+func (h *Handler) OpenAPI() map[string]interface{} {
+	gen := &schemaGenerator{schemas: map[string]interface{}{}}
+
+	errorRef := gen.schemaFor(reflect.TypeOf(utils.ErrorResponse{}))
+	errorResponse := func(description string) map[string]interface{} {
+		return map[string]interface{}{
+			"description": description,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": errorRef},
+			},
+		}
+	}
+
+	paths := map[string]interface{}{}
+	for _, route := range h.Routes() {
+		path := pathParamPattern.ReplaceAllString(route.Path, "{$1}")
+
+		content := map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": gen.envelope(route.Response)},
+		}
+		if stream, ok := route.Response.(EventStream); ok {
+			content = map[string]interface{}{
+				"text/event-stream": map[string]interface{}{"schema": gen.schemaFor(reflect.TypeOf(stream.Event))},
+			}
+		}
+
+		operation := map[string]interface{}{
+			"operationId": operationID(route.Handler),
+			"summary":     route.Summary,
+			"tags":        []string{route.Tag},
+			"description": "Requires scope `" + route.Scope + "`.",
+			"x-scope":     route.Scope,
+			"responses": map[string]interface{}{
+				strconv.Itoa(route.Status): map[string]interface{}{
+					"description": http.StatusText(route.Status),
+					"content":     content,
+				},
+				"400": errorResponse("Invalid request"),
+				"401": errorResponse("Missing, invalid, expired or revoked credentials"),
+				"403": errorResponse("Credentials lack the required scope"),
+				"500": errorResponse("Internal error"),
+			},
+		}
+
+		var parameters []interface{}
+		for _, match := range pathParamPattern.FindAllStringSubmatch(route.Path, -1) {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     match[1],
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+			operation["responses"].(map[string]interface{})["404"] = errorResponse("Not found")
+		}
+
+		if route.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": gen.schemaFor(reflect.TypeOf(route.Request))},
+				},
+			}
+		}
+
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = map[string]interface{}{}
+			paths[path] = item
+		}
+		item[strings.ToLower(route.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "Xanthus API",
+			"version":     Version,
+			"description": "REST API for managing servers, applications, DNS and Xanthus itself. Authenticate with an API token: `Authorization: Bearer xan_...`.",
+		},
+		"servers":  []interface{}{map[string]interface{}{"url": "/api/" + Version}},
+		"security": []interface{}{map[string]interface{}{"bearerAuth": []string{}}, map[string]interface{}{"cookieAuth": []string{}}},
+		"paths":    paths,
+		"components": map[string]interface{}{
+			"schemas": gen.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer", "description": "Xanthus API token"},
+				"cookieAuth": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": "xanthus_session", "description": "Web UI session"},
+			},
+		},
+	}
+}
+
+// schemaGenerator renders Go types as OpenAPI schemas, collecting named structs as components
+type schemaGenerator struct {
+	schemas map[string]interface{}
+}
+
+// envelope wraps a payload type in the standard success response
+func (g *schemaGenerator) envelope(payload interface{}) map[string]interface{} {
+	properties := map[string]interface{}{
+		"success": map[string]interface{}{"type": "boolean"},
+	}
+	if payload == nil {
+		properties["message"] = map[string]interface{}{"type": "string"}
+	} else {
+		properties["data"] = g.schemaFor(reflect.TypeOf(payload))
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+// schemaFor returns the schema (or component reference) of a type
+func (g *schemaGenerator) schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": g.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, exists := g.schemas[t.Name()]; !exists {
+			g.schemas[t.Name()] = map[string]interface{}{} // Placeholder for recursive types
+			g.schemas[t.Name()] = g.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+// structSchema renders the JSON-visible fields of a struct
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+
+	g.collectFields(t, properties, &required)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// collectFields adds struct fields to properties, flattening embedded structs like encoding/json does
+func (g *schemaGenerator) collectFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			g.collectFields(field.Type, properties, required)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		schema := g.schemaFor(field.Type)
+		if enum := field.Tag.Get("enum"); enum != "" {
+			schema["enum"] = strings.Split(enum, ",")
+		}
+		properties[name] = schema
+
+		if strings.Contains(field.Tag.Get("binding"), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// operationID derives the operation ID from the handler method name ("ListVPS" -> "listVPS")
+func operationID(handler gin.HandlerFunc) string {
+	name := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+	name = strings.TrimSuffix(name[strings.LastIndex(name, ".")+1:], "-fm")
+	return strings.ToLower(name[:1]) + name[1:]
+}
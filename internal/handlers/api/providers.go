@@ -0,0 +1,76 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListProviders returns the cloud providers servers can be created on
+func (h *Handler) ListProviders(c *gin.Context) {
+	names := services.CloudProviderNames()
+	providers := make([]Provider, 0, len(names))
+	for _, name := range names {
+		providers = append(providers, Provider{Name: name})
+	}
+	respond(c, http.StatusOK, providers)
+}
+
+// ListProviderLocations returns the locations of a provider
+func (h *Handler) ListProviderLocations(c *gin.Context) {
+	provider, ok := h.lookupProvider(c)
+	if !ok {
+		return
+	}
+
+	locations, err := provider.ListLocations(c.Request.Context())
+	if err != nil {
+		log.Printf("API: error listing %s locations: %v", provider.Name(), err)
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to list locations: %v", err))
+		return
+	}
+	if locations == nil {
+		locations = []Location{}
+	}
+	respond(c, http.StatusOK, locations)
+}
+
+// ListProviderServerTypes returns the server types of a provider, optionally in one location
+func (h *Handler) ListProviderServerTypes(c *gin.Context) {
+	provider, ok := h.lookupProvider(c)
+	if !ok {
+		return
+	}
+
+	serverTypes, err := provider.ListServerTypes(c.Request.Context(), c.Query("location"))
+	if err != nil {
+		log.Printf("API: error listing %s server types: %v", provider.Name(), err)
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to list server types: %v", err))
+		return
+	}
+	if serverTypes == nil {
+		serverTypes = []ServerType{}
+	}
+	respond(c, http.StatusOK, serverTypes)
+}
+
+// lookupProvider creates the provider named by the :provider path parameter
+func (h *Handler) lookupProvider(c *gin.Context) (services.CloudProvider, bool) {
+	token, accountID := credentials(c)
+
+	name, ok := services.CanonicalProviderName(c.Param("provider"))
+	if !ok {
+		respondError(c, http.StatusNotFound, "Unknown provider")
+		return nil, false
+	}
+
+	provider, err := h.vpsService.CloudProvider(token, accountID, name)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return provider, true
+}
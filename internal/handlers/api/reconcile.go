@@ -0,0 +1,48 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// GetReconcileReport returns the report of the last reconciliation
+func (h *Handler) GetReconcileReport(c *gin.Context) {
+	token, accountID := credentials(c)
+	report, err := h.reconciler().LastReport(token, accountID)
+	if errors.Is(err, services.ErrNoReconcileReport) {
+		respondError(c, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	respond(c, http.StatusOK, report)
+}
+
+// Reconcile compares the stored state with the infrastructure now
+func (h *Handler) Reconcile(c *gin.Context) {
+	var req ReconcileRequest
+	if c.Request.ContentLength != 0 && !bindJSON(c, &req) {
+		return
+	}
+
+	token, accountID := credentials(c)
+	var report *services.ReconcileReport
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeReconcile, Target: accountID}, func(ctx context.Context) error {
+		var err error
+		report, err = h.reconciler().Run(ctx, token, accountID, req.Heal)
+		return err
+	})
+	if err != nil {
+		log.Printf("API: reconciliation of account %s failed: %v", accountID, err)
+		respondError(c, http.StatusInternalServerError, "Failed to reconcile: "+err.Error())
+		return
+	}
+	respond(c, http.StatusOK, report)
+}
@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/middleware"
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// Route describes one API endpoint. The same table registers the gin routes
+// and generates the OpenAPI document, so the two cannot drift apart.
+type Route struct {
+	Method   string
+	Path     string // Relative to /api/v1, in gin syntax (e.g. "/vps/:id")
+	Tag      string
+	Summary  string
+	Scope    string      // Scope the caller must hold
+	Request  interface{} // Zero value of the JSON request body type, or nil
+	Response interface{} // Zero value of the "data" payload type, nil for message-only responses, or an EventStream
+	Status   int         // Status code of a successful response
+	Handler  gin.HandlerFunc
+}
+
+// EventStream marks a route that answers with server-sent events instead of
+// a JSON envelope; Event is the zero value of the event data type
+type EventStream struct {
+	Event interface{}
+}
+
+// Routes returns every /api/v1 endpoint
+func (h *Handler) Routes() []Route {
+	return []Route{
+		// VPS
+		{http.MethodGet, "/vps", "VPS", "List servers", services.ScopeVPSRead, nil, []VPS{}, http.StatusOK, h.ListVPS},
+		{http.MethodPost, "/vps", "VPS", "Create a server with K3s", services.ScopeVPSWrite, CreateVPSRequest{}, VPS{}, http.StatusCreated, h.CreateVPS},
+		{http.MethodPost, "/vps/existing", "VPS", "Add an existing server over SSH and install K3s", services.ScopeVPSWrite, AddVPSRequest{}, VPS{}, http.StatusCreated, h.AddVPS},
+		{http.MethodGet, "/vps/:id", "VPS", "Get a server", services.ScopeVPSRead, nil, VPS{}, http.StatusOK, h.GetVPS},
+		{http.MethodPost, "/vps/:id/power", "VPS", "Power off, power on or reboot a server", services.ScopeVPSWrite, VPSPowerRequest{}, nil, http.StatusOK, h.PowerVPS},
+		{http.MethodDelete, "/vps/:id", "VPS", "Delete a server", services.ScopeVPSWrite, nil, nil, http.StatusOK, h.DeleteVPS},
+		{http.MethodPost, "/vps/:id/trust-host-key", "VPS", "Re-trust the SSH host key a server presents now", services.ScopeVPSWrite, nil, VPS{}, http.StatusOK, h.TrustVPSHostKey},
+		{http.MethodGet, "/vps/:id/nodes", "VPS", "List the nodes of a server's cluster", services.ScopeVPSRead, nil, []ClusterNode{}, http.StatusOK, h.ListClusterNodes},
+		{http.MethodPost, "/vps/:id/nodes", "VPS", "Join a new agent node to a server's cluster", services.ScopeVPSWrite, JoinNodeRequest{}, VPS{}, http.StatusCreated, h.JoinClusterNode},
+		{http.MethodGet, "/vps/:id/metrics", "VPS", "Get the CPU, memory, disk and network use of a server over ?range= (default 1h, up to 30d) and the use of its cluster's pods", services.ScopeVPSRead, nil, MetricsSeries{}, http.StatusOK, h.GetVPSMetrics},
+		{http.MethodGet, "/vps/:id/capacity", "VPS", "Measure the free CPU, memory and disk of a server's cluster", services.ScopeVPSRead, nil, ClusterInfo{}, http.StatusOK, h.GetClusterCapacity},
+		{http.MethodGet, "/vps/:id/k3s", "VPS", "Show the K3s version of a server's cluster and the releases it can be upgraded to", services.ScopeVPSRead, nil, K3sVersions{}, http.StatusOK, h.GetK3sVersions},
+		{http.MethodPost, "/vps/:id/k3s/upgrade", "VPS", "Upgrade the K3s of a server's cluster, one node at a time", services.ScopeVPSWrite, UpgradeK3sRequest{}, K3sUpgradeResult{}, http.StatusOK, h.UpgradeK3s},
+		{http.MethodPost, "/vps/:id/rebuild", "VPS", "Rebuild a lost server and redeploy its applications", services.ScopeVPSWrite, RebuildVPSRequest{}, RebuildResult{}, http.StatusOK, h.RebuildVPS},
+
+		// Providers
+		{http.MethodGet, "/providers", "Providers", "List cloud providers", services.ScopeVPSRead, nil, []Provider{}, http.StatusOK, h.ListProviders},
+		{http.MethodGet, "/providers/:provider/locations", "Providers", "List the locations of a provider", services.ScopeVPSRead, nil, []Location{}, http.StatusOK, h.ListProviderLocations},
+		{http.MethodGet, "/providers/:provider/server-types", "Providers", "List the server types of a provider, optionally in ?location=", services.ScopeVPSRead, nil, []ServerType{}, http.StatusOK, h.ListProviderServerTypes},
+
+		// Terminal
+		{http.MethodPost, "/vps/:id/terminal", "Terminal", "Open an SSH terminal session", services.ScopeVPSWrite, nil, TerminalSession{}, http.StatusCreated, h.CreateTerminal},
+		{http.MethodGet, "/terminal/:session_id", "Terminal", "Attach to a terminal session (WebSocket upgrade)", services.ScopeVPSWrite, nil, nil, http.StatusSwitchingProtocols, h.AttachTerminal},
+		{http.MethodDelete, "/terminal/:session_id", "Terminal", "Close a terminal session", services.ScopeVPSWrite, nil, nil, http.StatusOK, h.StopTerminal},
+
+		// Applications
+		{http.MethodGet, "/applications", "Applications", "List applications", services.ScopeAppsRead, nil, []Application{}, http.StatusOK, h.ListApplications},
+		{http.MethodPost, "/applications", "Applications", "Deploy an application", services.ScopeAppsWrite, CreateApplicationRequest{}, CreateApplicationResponse{}, http.StatusCreated, h.CreateApplication},
+		{http.MethodGet, "/applications/:id", "Applications", "Get an application", services.ScopeAppsRead, nil, Application{}, http.StatusOK, h.GetApplication},
+		{http.MethodGet, "/applications/:id/metrics", "Applications", "Get the CPU and memory use of an application's pods over ?range= (default 1h, up to 30d)", services.ScopeAppsRead, nil, MetricsSeries{}, http.StatusOK, h.GetApplicationMetrics},
+		{http.MethodGet, "/applications/:id/password", "Applications", "Get the password of a code-server or ArgoCD application", services.ScopeAppsWrite, nil, ApplicationPassword{}, http.StatusOK, h.GetApplicationPassword},
+		{http.MethodPost, "/applications/:id/upgrade", "Applications", "Upgrade an application", services.ScopeAppsWrite, UpgradeApplicationRequest{}, Application{}, http.StatusOK, h.UpgradeApplication},
+		{http.MethodDelete, "/applications/:id", "Applications", "Delete an application", services.ScopeAppsWrite, nil, nil, http.StatusOK, h.DeleteApplication},
+
+		// Port forwards
+		{http.MethodGet, "/applications/:id/port-forwards", "Port forwards", "List port forwards", services.ScopeAppsRead, nil, []PortForward{}, http.StatusOK, h.ListPortForwards},
+		{http.MethodPost, "/applications/:id/port-forwards", "Port forwards", "Create a port forward", services.ScopeAppsWrite, CreatePortForwardRequest{}, PortForward{}, http.StatusCreated, h.CreatePortForward},
+		{http.MethodDelete, "/applications/:id/port-forwards/:port_id", "Port forwards", "Delete a port forward", services.ScopeAppsWrite, nil, nil, http.StatusOK, h.DeletePortForward},
+
+		// DNS
+		{http.MethodGet, "/dns/domains", "DNS", "List managed domains", services.ScopeDNSRead, nil, []Domain{}, http.StatusOK, h.ListDomains},
+		{http.MethodPost, "/dns/domains", "DNS", "Configure a domain", services.ScopeDNSWrite, ConfigureDomainRequest{}, Domain{}, http.StatusCreated, h.ConfigureDomain},
+		{http.MethodDelete, "/dns/domains/:domain", "DNS", "Remove a managed domain", services.ScopeDNSWrite, nil, nil, http.StatusOK, h.RemoveDomain},
+		{http.MethodPost, "/dns/domains/:domain/renew", "DNS", "Renew a domain certificate now", services.ScopeDNSWrite, nil, Domain{}, http.StatusOK, h.RenewDomain},
+
+		// Versions
+		{http.MethodGet, "/version", "Versions", "Get the running version", services.ScopeVersionsRead, nil, VersionInfo{}, http.StatusOK, h.GetVersion},
+		{http.MethodGet, "/version/releases", "Versions", "List available releases", services.ScopeVersionsRead, nil, []Release{}, http.StatusOK, h.ListReleases},
+		{http.MethodPost, "/version/update", "Versions", "Update to a release", services.ScopeVersionsWrite, UpdateRequest{}, UpdateStatus{}, http.StatusAccepted, h.StartUpdate},
+		{http.MethodPost, "/version/rollback", "Versions", "Roll back to the previous version", services.ScopeVersionsWrite, nil, UpdateStatus{}, http.StatusAccepted, h.RollbackUpdate},
+		{http.MethodGet, "/version/status", "Versions", "Get update progress", services.ScopeVersionsRead, nil, UpdateStatus{}, http.StatusOK, h.GetUpdateStatus},
+
+		// Jobs
+		{http.MethodGet, "/jobs", "Jobs", "List recent jobs, newest first (?limit=)", services.ScopeJobsRead, nil, []Job{}, http.StatusOK, h.ListJobs},
+		{http.MethodGet, "/jobs/:id", "Jobs", "Get a job with its steps and log", services.ScopeJobsRead, nil, Job{}, http.StatusOK, h.GetJob},
+		{http.MethodGet, "/jobs/:id/events", "Jobs", "Stream a job's progress as server-sent events", services.ScopeJobsRead, nil, EventStream{JobEvent{}}, http.StatusOK, h.StreamJobEvents},
+		{http.MethodPost, "/jobs/:id/cancel", "Jobs", "Cancel a running job", services.ScopeJobsWrite, nil, Job{}, http.StatusAccepted, h.CancelJob},
+
+		// Reconciliation
+		{http.MethodGet, "/reconcile", "Reconciliation", "Get the last drift report", services.ScopeReconcileRead, nil, ReconcileReport{}, http.StatusOK, h.GetReconcileReport},
+		{http.MethodPost, "/reconcile", "Reconciliation", "Compare stored state with the infrastructure now, optionally healing drift", services.ScopeReconcileWrite, ReconcileRequest{}, ReconcileReport{}, http.StatusOK, h.Reconcile},
+
+		// Stacks
+		{http.MethodPost, "/stacks/plan", "Stacks", "Compute the changes that converge the current state to a stack file", services.ScopeStacksRead, StackRequest{}, StackPlan{}, http.StatusOK, h.PlanStack},
+		{http.MethodPost, "/stacks/apply", "Stacks", "Converge the current state to a stack file", services.ScopeStacksWrite, StackRequest{}, StackPlan{}, http.StatusOK, h.ApplyStack},
+
+		// Adoption
+		{http.MethodGet, "/adopt", "Adoption", "List servers, zones, DNS records and Helm releases not managed by Xanthus", services.ScopeAdoptRead, nil, AdoptionCandidates{}, http.StatusOK, h.ListAdoptionCandidates},
+		{http.MethodPost, "/adopt/servers", "Adoption", "Adopt a provider server, installing K3s unless present", services.ScopeAdoptWrite, AdoptServerRequest{}, VPS{}, http.StatusCreated, h.AdoptServer},
+		{http.MethodPost, "/adopt/releases", "Adoption", "Adopt a Helm release on a managed server as an application", services.ScopeAdoptWrite, AdoptReleaseRequest{}, Application{}, http.StatusCreated, h.AdoptRelease},
+
+		// Backups
+		{http.MethodGet, "/backups/targets", "Backups", "List backup targets", services.ScopeBackupsRead, nil, []BackupTarget{}, http.StatusOK, h.ListBackupTargets},
+		{http.MethodPost, "/backups/targets", "Backups", "Add or replace a backup target", services.ScopeBackupsWrite, CreateBackupTargetRequest{}, BackupTarget{}, http.StatusCreated, h.CreateBackupTarget},
+		{http.MethodDelete, "/backups/targets/:name", "Backups", "Delete a backup target no application uses", services.ScopeBackupsWrite, nil, nil, http.StatusOK, h.DeleteBackupTarget},
+		{http.MethodGet, "/applications/:id/backup", "Backups", "Get the backup policy of an application", services.ScopeBackupsRead, nil, BackupPolicy{}, http.StatusOK, h.GetBackupPolicy},
+		{http.MethodPut, "/applications/:id/backup", "Backups", "Back up the volumes of an application on a schedule", services.ScopeBackupsWrite, SetBackupPolicyRequest{}, BackupPolicy{}, http.StatusOK, h.SetBackupPolicy},
+		{http.MethodDelete, "/applications/:id/backup", "Backups", "Stop backing up an application, keeping its snapshots", services.ScopeBackupsWrite, nil, nil, http.StatusOK, h.DeleteBackupPolicy},
+		{http.MethodGet, "/applications/:id/backups", "Backups", "List the snapshots of an application, newest first", services.ScopeBackupsRead, nil, []BackupSnapshot{}, http.StatusOK, h.ListBackupSnapshots},
+		{http.MethodPost, "/applications/:id/backups", "Backups", "Back up an application now", services.ScopeBackupsWrite, nil, nil, http.StatusOK, h.RunBackup},
+		{http.MethodPost, "/applications/:id/backups/:snapshot/restore", "Backups", "Restore an application's volumes from a snapshot (\"latest\" for the newest)", services.ScopeBackupsWrite, nil, nil, http.StatusOK, h.RestoreBackup},
+
+		// API tokens
+		{http.MethodGet, "/tokens", "Tokens", "List API tokens", services.ScopeTokensManage, nil, []APIToken{}, http.StatusOK, h.ListTokens},
+		{http.MethodPost, "/tokens", "Tokens", "Issue an API token", services.ScopeTokensManage, CreateTokenRequest{}, CreateTokenResponse{}, http.StatusCreated, h.CreateToken},
+		{http.MethodDelete, "/tokens/:id", "Tokens", "Revoke an API token", services.ScopeTokensManage, nil, nil, http.StatusOK, h.RevokeToken},
+
+		// Users
+		{http.MethodGet, "/users", "Users", "List users", services.ScopeUsersManage, nil, []User{}, http.StatusOK, h.ListUsers},
+		{http.MethodPost, "/users", "Users", "Create a user", services.ScopeUsersManage, CreateUserRequest{}, User{}, http.StatusCreated, h.CreateUser},
+		{http.MethodPatch, "/users/:username", "Users", "Change the role or password of a user", services.ScopeUsersManage, UpdateUserRequest{}, User{}, http.StatusOK, h.UpdateUser},
+		{http.MethodDelete, "/users/:username", "Users", "Delete a user", services.ScopeUsersManage, nil, nil, http.StatusOK, h.DeleteUser},
+
+		// Encryption keys
+		{http.MethodPost, "/keys/rotate", "Keys", "Re-encrypt all secrets under a new key", services.ScopeKeysManage, RotateKeysRequest{}, KeyRotation{}, http.StatusOK, h.RotateKeys},
+		{http.MethodGet, "/keys/ssh", "Keys", "Get the SSH public key installed on servers", services.ScopeVPSRead, nil, SSHKey{}, http.StatusOK, h.GetSSHKey},
+		{http.MethodPost, "/keys/ssh/rotate", "Keys", "Replace the SSH key on every server", services.ScopeKeysManage, nil, SSHKeyRotation{}, http.StatusOK, h.RotateSSHKey},
+	}
+}
+
+// Register mounts the API on group (expected to be /api/v1). The OpenAPI
+// document is public; every other endpoint requires an API token or session.
+func (h *Handler) Register(group *gin.RouterGroup) {
+	group.GET("/openapi.json", h.HandleOpenAPI)
+
+	authenticated := group.Group("")
+	authenticated.Use(middleware.APIAuthMiddleware())
+	for _, route := range h.Routes() {
+		authenticated.Handle(route.Method, route.Path, middleware.RequireScope(route.Scope), route.Handler)
+	}
+}
+
+// HandleOpenAPI serves the generated OpenAPI document
+func (h *Handler) HandleOpenAPI(c *gin.Context) {
+	c.JSON(http.StatusOK, h.OpenAPI())
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// PlanStack returns the changes applying a stack file would make
+func (h *Handler) PlanStack(c *gin.Context) {
+	stack, req, ok := h.bindStack(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	plan, err := h.stacks().Plan(token, accountID, stack, req.Prune)
+	if err != nil {
+		log.Printf("API: error planning stack %s: %v", stack.Name, err)
+		respondError(c, http.StatusInternalServerError, "Failed to plan stack: "+err.Error())
+		return
+	}
+	respond(c, http.StatusOK, plan)
+}
+
+// ApplyStack converges the current state to a stack file
+func (h *Handler) ApplyStack(c *gin.Context) {
+	stack, req, ok := h.bindStack(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	var plan *services.StackPlan
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeStackApply, Target: stack.Name}, func(ctx context.Context) error {
+		var err error
+		plan, err = h.stacks().Apply(ctx, token, accountID, stack, req.Prune)
+		return err
+	})
+	if errors.Is(err, services.ErrStackBlocked) {
+		var blocked []string
+		for _, change := range plan.Changes {
+			if change.Action == services.StackActionBlocked {
+				blocked = append(blocked, change.Kind+" "+change.Name)
+			}
+		}
+		respondError(c, http.StatusConflict, err.Error()+": "+strings.Join(blocked, ", "))
+		return
+	}
+	if err != nil {
+		log.Printf("API: error applying stack %s: %v", stack.Name, err)
+		respondError(c, http.StatusInternalServerError, "Failed to apply stack: "+err.Error())
+		return
+	}
+	respond(c, http.StatusOK, plan)
+}
+
+// bindStack decodes the request and parses its stack file, answering 400 on failure
+func (h *Handler) bindStack(c *gin.Context) (*services.Stack, *StackRequest, bool) {
+	var req StackRequest
+	if !bindJSON(c, &req) {
+		return nil, nil, false
+	}
+	stack, err := services.ParseStack([]byte(req.Stack))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return nil, nil, false
+	}
+	return stack, &req, true
+}
+
+func (h *Handler) stacks() *services.StackService {
+	return services.NewStackService(h.appsHandler.GetCatalog())
+}
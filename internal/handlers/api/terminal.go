@@ -0,0 +1,110 @@
+package api
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Terminal attach requests are authenticated by an API token or, from the web
+// UI, by the session cookie. Browsers can't send a bearer token on a WebSocket,
+// so requests with one don't come from a page and any origin is accepted. The
+// cookie is sent on cross-site WebSockets too, so those requests must come
+// from a page of this host, as the default origin check of the upgrader requires.
+var (
+	tokenTerminalUpgrader   = websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	sessionTerminalUpgrader = websocket.Upgrader{}
+)
+
+// CreateTerminal opens an SSH session to a VPS that can then be attached to over a WebSocket
+func (h *Handler) CreateTerminal(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+
+	privateKey, err := h.sshKeys().PrivateKey(token, accountID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "SSH private key not found")
+		return
+	}
+
+	user, err := h.vpsService.ResolveSSHUser(token, accountID, config.ServerID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to resolve SSH user: %v", err))
+		return
+	}
+
+	session, err := h.terminals.CreateSession(config.ServerID, config.SSHAddress(), user, privateKey, token, accountID)
+	if err != nil {
+		log.Printf("API: error creating terminal session for VPS %d: %v", config.ServerID, err)
+		respondError(c, http.StatusInternalServerError, "Failed to create terminal session: "+err.Error())
+		return
+	}
+
+	respond(c, http.StatusCreated, TerminalSession{
+		ID:           session.ID,
+		ServerID:     session.ServerID,
+		Host:         session.Host,
+		Status:       session.Status,
+		WebSocketURL: fmt.Sprintf("/api/%s/terminal/%s", Version, session.ID),
+	})
+}
+
+// AttachTerminal upgrades the request to a WebSocket bridged to the session's shell
+func (h *Handler) AttachTerminal(c *gin.Context) {
+	session, ok := h.lookupTerminal(c)
+	if !ok {
+		return
+	}
+
+	upgrader := &sessionTerminalUpgrader
+	if c.GetString("api_token_id") != "" {
+		upgrader = &tokenTerminalUpgrader
+	}
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("API: failed to upgrade terminal connection: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	if err := h.terminals.HandleWebSocketConnection(session.ID, conn); err != nil {
+		log.Printf("API: terminal session %s ended: %v", session.ID, err)
+	}
+}
+
+// StopTerminal closes a terminal session and its SSH connection
+func (h *Handler) StopTerminal(c *gin.Context) {
+	session, ok := h.lookupTerminal(c)
+	if !ok {
+		return
+	}
+
+	if err := h.terminals.StopSession(session.ID); err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to stop session: "+err.Error())
+		return
+	}
+
+	respondMessage(c, http.StatusOK, "Terminal session closed")
+}
+
+// lookupTerminal loads the session named by the :session_id path parameter,
+// hiding sessions that belong to other accounts
+func (h *Handler) lookupTerminal(c *gin.Context) (*services.WebSocketTerminalSession, bool) {
+	_, accountID := credentials(c)
+
+	session, err := h.terminals.GetSession(c.Param("session_id"))
+	if err != nil || session.AccountID != accountID {
+		respondError(c, http.StatusNotFound, "Terminal session not found")
+		return nil, false
+	}
+
+	return session, true
+}
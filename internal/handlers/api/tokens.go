@@ -0,0 +1,79 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListTokens returns the API tokens issued for the account
+func (h *Handler) ListTokens(c *gin.Context) {
+	_, accountID := credentials(c)
+
+	tokens, err := h.tokens().ListTokens(accountID)
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list API tokens")
+		return
+	}
+
+	result := make([]APIToken, 0, len(tokens))
+	for i := range tokens {
+		result = append(result, tokenFromService(&tokens[i]))
+	}
+
+	respond(c, http.StatusOK, result)
+}
+
+// CreateToken issues a new API token. A token can only grant scopes its creator holds.
+func (h *Handler) CreateToken(c *gin.Context) {
+	cfToken, accountID := credentials(c)
+
+	var req CreateTokenRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	callerScopes := c.GetStringSlice("api_scopes")
+	for _, scope := range req.Scopes {
+		if !services.HasScope(callerScopes, scope) {
+			respondError(c, http.StatusForbidden, "Cannot grant scope not held by the caller: "+scope)
+			return
+		}
+	}
+
+	if req.ExpiresInDays < 0 {
+		respondError(c, http.StatusBadRequest, "expires_in_days must not be negative")
+		return
+	}
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+
+	token, rawToken, err := h.tokens().CreateToken(cfToken, accountID, req.Name, req.Scopes, ttl)
+	if err != nil {
+		respondError(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	respond(c, http.StatusCreated, CreateTokenResponse{
+		APIToken: tokenFromService(token),
+		Token:    rawToken,
+	})
+}
+
+// RevokeToken revokes an API token
+func (h *Handler) RevokeToken(c *gin.Context) {
+	_, accountID := credentials(c)
+
+	if err := h.tokens().RevokeToken(accountID, c.Param("id")); err != nil {
+		if errors.Is(err, services.ErrAPITokenNotFound) {
+			respondError(c, http.StatusNotFound, "API token not found")
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "Failed to revoke API token")
+		return
+	}
+
+	respondMessage(c, http.StatusOK, "API token revoked")
+}
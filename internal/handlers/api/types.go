@@ -0,0 +1,470 @@
+package api
+
+import (
+	"time"
+
+	"github.com/chrishham/xanthus/internal/handlers"
+	"github.com/chrishham/xanthus/internal/handlers/applications"
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/services"
+)
+
+// The types in this file define the public API schema. They are rendered into
+// the OpenAPI document, so field changes are API changes.
+
+// VPS describes a server managed by Xanthus
+type VPS struct {
+	ID           int     `json:"id"`
+	Name         string  `json:"name"`
+	Provider     string  `json:"provider"`
+	ServerType   string  `json:"server_type"`
+	Location     string  `json:"location"`
+	Region       string  `json:"region,omitempty"`
+	Architecture string  `json:"architecture,omitempty"`
+	PublicIPv4   string  `json:"public_ipv4"`
+	SSHUser      string  `json:"ssh_user"`
+	SSHPort      int     `json:"ssh_port"`
+	Timezone     string  `json:"timezone"`
+	HourlyRate   float64 `json:"hourly_rate"`
+	MonthlyRate  float64 `json:"monthly_rate"`
+	CreatedAt    string  `json:"created_at"`
+	// SSH host key fingerprint every connection is checked against
+	HostKeyFingerprint string `json:"host_key_fingerprint,omitempty"`
+	// Server node whose cluster this agent node joined
+	ClusterServerID int    `json:"cluster_server_id,omitempty"`
+	PrivateIPv4     string `json:"private_ipv4,omitempty"`
+}
+
+// CreateVPSRequest creates a server with K3s. Provider defaults to Hetzner;
+// cpus and memory_gb size flexible server types such as OCI's VM.Standard.A1.Flex.
+type CreateVPSRequest struct {
+	Provider   string  `json:"provider,omitempty"`
+	Name       string  `json:"name" binding:"required"`
+	Location   string  `json:"location"`
+	ServerType string  `json:"server_type"`
+	Timezone   string  `json:"timezone,omitempty"`
+	CPUs       float32 `json:"cpus,omitempty"`
+	MemoryGB   float32 `json:"memory_gb,omitempty"`
+}
+
+// AddVPSRequest adds an existing server reachable over SSH (provider Manual).
+// password is only used once, to install the Xanthus SSH key.
+type AddVPSRequest struct {
+	Name     string `json:"name" binding:"required"`
+	Host     string `json:"host" binding:"required"`
+	SSHUser  string `json:"ssh_user,omitempty"`
+	SSHPort  int    `json:"ssh_port,omitempty"`
+	Password string `json:"password,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Provider is a cloud provider servers can be created on
+type Provider struct {
+	Name string `json:"name"`
+}
+
+// Location is a region or datacenter of a provider
+type Location = services.CloudLocation
+
+// ServerType is a server size offered by a provider, with gross prices in EUR
+type ServerType = services.CloudServerType
+
+// TerminalSession is an SSH session to a VPS, attached to over a WebSocket.
+// Clients send {"type":"input","data":...} frames and receive {"type":"output","data":...} frames.
+type TerminalSession struct {
+	ID           string `json:"id"`
+	ServerID     int    `json:"server_id"`
+	Host         string `json:"host"`
+	Status       string `json:"status"`
+	WebSocketURL string `json:"websocket_url"`
+}
+
+// VPSPowerRequest requests a power action on a VPS
+type VPSPowerRequest struct {
+	Action string `json:"action" binding:"required" enum:"poweroff,poweron,reboot"`
+}
+
+// RebuildVPSRequest rebuilds a lost server from its stored state
+type RebuildVPSRequest struct {
+	Replace        bool `json:"replace"`         // delete the server first if its provider still has it
+	RestoreBackups bool `json:"restore_backups"` // restore the latest backup of applications with a backup policy
+}
+
+// JoinNodeRequest adds an agent node to the cluster of a server. provider and
+// location default to the server's; a node in the server's location is
+// connected over a private network where the provider has them. Nodes of
+// provider Manual are added by host, like AddVPSRequest.
+type JoinNodeRequest struct {
+	Name       string  `json:"name" binding:"required"`
+	Provider   string  `json:"provider,omitempty"`
+	Location   string  `json:"location,omitempty"`
+	ServerType string  `json:"server_type,omitempty"`
+	Timezone   string  `json:"timezone,omitempty"`
+	CPUs       float32 `json:"cpus,omitempty"`
+	MemoryGB   float32 `json:"memory_gb,omitempty"`
+	Host       string  `json:"host,omitempty"`
+	SSHUser    string  `json:"ssh_user,omitempty"`
+	SSHPort    int     `json:"ssh_port,omitempty"`
+	Password   string  `json:"password,omitempty"`
+}
+
+// ClusterNode is a Kubernetes node of a server's cluster
+type ClusterNode = services.ClusterNode
+
+// MetricsSeries is the usage history of a server or application
+type MetricsSeries = services.MetricsSeries
+
+// ClusterInfo describes the free capacity of a server's cluster
+type ClusterInfo = services.ClusterInfo
+
+// K3sVersions describes the K3s version of a server's cluster and the releases it can be upgraded to
+type K3sVersions = services.K3sVersions
+
+// UpgradeK3sRequest upgrades a server's cluster to a K3s release listed by GET /vps/{id}/k3s
+type UpgradeK3sRequest struct {
+	Version string `json:"version" binding:"required"` // e.g. v1.31.2+k3s1
+}
+
+// K3sUpgradeResult describes an upgraded cluster
+type K3sUpgradeResult = services.K3sUpgradeResult
+
+// RebuildResult describes a rebuilt server and its redeployed applications
+type RebuildResult = services.RebuildResult
+
+// Application describes a deployed application
+type Application = models.Application
+
+// CreateApplicationRequest deploys an application from the catalog
+type CreateApplicationRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	AppType     string `json:"app_type" binding:"required"`
+	Subdomain   string `json:"subdomain" binding:"required"`
+	Domain      string `json:"domain" binding:"required"`
+	VPSID       string `json:"vps_id" binding:"required"`
+	Version     string `json:"version"`
+	Values      string `json:"values,omitempty"` // Helm values overriding the catalog defaults, as YAML
+}
+
+// CreateApplicationResponse is returned after an application has been deployed
+type CreateApplicationResponse struct {
+	Application     *Application `json:"application"`
+	InitialPassword string       `json:"initial_password,omitempty"`
+	Username        string       `json:"username,omitempty"`
+}
+
+// ApplicationPassword carries the credentials of an application
+type ApplicationPassword struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password"`
+}
+
+// UpgradeApplicationRequest upgrades an application to a new version
+type UpgradeApplicationRequest struct {
+	Version string `json:"version" binding:"required"`
+}
+
+// PortForward exposes an application port on its own subdomain
+type PortForward = applications.PortForward
+
+// CreatePortForwardRequest creates a port forward
+type CreatePortForwardRequest struct {
+	Port      int    `json:"port" binding:"required"`
+	Subdomain string `json:"subdomain" binding:"required"`
+}
+
+// Domain describes a Cloudflare domain managed by Xanthus
+type Domain struct {
+	Domain         string `json:"domain"`
+	ZoneID         string `json:"zone_id"`
+	SSLMode        string `json:"ssl_mode"`
+	AlwaysUseHTTPS bool   `json:"always_use_https"`
+	Issuer         string `json:"issuer" enum:"cloudflare-origin,acme"`
+	DNSOnly        bool   `json:"dns_only"`
+	ConfiguredAt   string `json:"configured_at"`
+	ExpiresAt      string `json:"expires_at,omitempty"`
+	RenewedAt      string `json:"renewed_at,omitempty"`
+	RenewalError   string `json:"renewal_error,omitempty"`
+}
+
+// ConfigureDomainRequest puts a Cloudflare domain under Xanthus management.
+// The certificate is a Cloudflare origin certificate unless issuer is "acme";
+// DNS only (unproxied) records require an ACME certificate.
+type ConfigureDomainRequest struct {
+	Domain  string `json:"domain" binding:"required"`
+	Issuer  string `json:"issuer,omitempty" enum:"cloudflare-origin,acme"`
+	DNSOnly bool   `json:"dns_only,omitempty"`
+}
+
+// VersionInfo describes the running Xanthus version
+type VersionInfo struct {
+	Version         string `json:"version"`
+	PreviousVersion string `json:"previous_version,omitempty"`
+	CanRollback     bool   `json:"can_rollback"`
+}
+
+// Release is a published Xanthus release
+type Release struct {
+	Version     string    `json:"version"`
+	Name        string    `json:"name"`
+	Notes       string    `json:"notes"`
+	Prerelease  bool      `json:"prerelease"`
+	PublishedAt time.Time `json:"published_at"`
+	URL         string    `json:"url"`
+}
+
+// UpdateRequest starts a self-update
+type UpdateRequest struct {
+	Version string `json:"version" binding:"required"`
+}
+
+// UpdateStatus reports the progress of an update or rollback
+type UpdateStatus = services.UpdateStatus
+
+// Job reports a long-running operation with its steps and log
+type Job = services.Job
+
+// JobEvent is a server-sent event of GET /jobs/{id}/events: a step
+// transition, an output line, a pod status change or the job's status
+type JobEvent = services.JobEvent
+
+// ReconcileRequest runs a reconciliation now
+type ReconcileRequest struct {
+	Heal bool `json:"heal"` // fix the drift that can be fixed safely
+}
+
+// StackRequest carries a stack file to plan or apply
+type StackRequest struct {
+	Stack string `json:"stack" binding:"required"` // the stack file, as YAML
+	Prune bool   `json:"prune"`                    // delete servers, domains and applications missing from the stack
+}
+
+// StackPlan lists the changes that converge the current state to a stack
+type StackPlan = services.StackPlan
+
+// ReconcileReport lists the differences between stored state and the infrastructure
+type ReconcileReport = services.ReconcileReport
+
+// AdoptionCandidates lists the servers, zones, DNS records and Helm releases Xanthus doesn't manage
+type AdoptionCandidates = services.AdoptionCandidates
+
+// AdoptServerRequest adopts a server listed by GET /adopt. password is only
+// used once, to install the Xanthus SSH key.
+type AdoptServerRequest struct {
+	Provider string `json:"provider" binding:"required"`
+	ID       int    `json:"id" binding:"required"`
+	SSHUser  string `json:"ssh_user,omitempty"`
+	SSHPort  int    `json:"ssh_port,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// AdoptReleaseRequest adopts a Helm release listed by GET /adopt as an
+// application. app_type defaults to the type inferred from the chart, and
+// subdomain and domain to the release's ingress host.
+type AdoptReleaseRequest struct {
+	ServerID  int    `json:"server_id" binding:"required"`
+	Namespace string `json:"namespace" binding:"required"`
+	Release   string `json:"release" binding:"required"`
+	AppType   string `json:"app_type,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Subdomain string `json:"subdomain,omitempty"`
+	Domain    string `json:"domain,omitempty"`
+}
+
+// BackupTarget is an S3-compatible bucket backups are stored in. Its secret
+// key and repository password are never returned.
+type BackupTarget = services.BackupTarget
+
+// CreateBackupTargetRequest adds a backup target or replaces the one with the same name
+type CreateBackupTargetRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Endpoint  string `json:"endpoint" binding:"required"` // e.g. "https://s3.eu-central-1.amazonaws.com"
+	Bucket    string `json:"bucket" binding:"required"`
+	Region    string `json:"region"`
+	AccessKey string `json:"access_key" binding:"required"`
+	SecretKey string `json:"secret_key" binding:"required"`
+	Password  string `json:"password" binding:"required"` // encrypts the backups; they can't be restored without it
+}
+
+// BackupPolicy backs up the persistent volumes of an application on a schedule
+type BackupPolicy = services.BackupPolicy
+
+// SetBackupPolicyRequest backs up an application's volumes on a schedule.
+// Without retention counts the last 7 daily and 4 weekly snapshots are kept.
+type SetBackupPolicyRequest struct {
+	Target     string `json:"target" binding:"required"`
+	Schedule   string `json:"schedule"` // cron expression in the server's timezone, default "0 3 * * *"
+	KeepLast   int    `json:"keep_last"`
+	KeepDaily  int    `json:"keep_daily"`
+	KeepWeekly int    `json:"keep_weekly"`
+}
+
+// BackupSnapshot is a backup of an application's volumes
+type BackupSnapshot = services.BackupSnapshot
+
+// APIToken describes an issued API token. The secret is never returned after creation.
+type APIToken struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateTokenRequest issues a new API token
+type CreateTokenRequest struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required"`
+	ExpiresInDays int      `json:"expires_in_days"`
+}
+
+// CreateTokenResponse carries the plaintext token, shown only once
+type CreateTokenResponse struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+// User describes a Xanthus user. Password hashes are never returned.
+type User struct {
+	Username    string     `json:"username"`
+	Role        string     `json:"role" enum:"admin,operator,viewer"`
+	CreatedAt   time.Time  `json:"created_at"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+}
+
+// CreateUserRequest adds a user
+type CreateUserRequest struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required" enum:"admin,operator,viewer"`
+}
+
+// UpdateUserRequest changes the role and/or resets the password of a user
+type UpdateUserRequest struct {
+	Role     string `json:"role,omitempty" enum:"admin,operator,viewer"`
+	Password string `json:"password,omitempty"`
+}
+
+// RotateKeysRequest rotates the data-encryption key, optionally switching to a new Cloudflare token
+type RotateKeysRequest struct {
+	CloudflareToken string `json:"cloudflare_token,omitempty"`
+}
+
+// KeyRotation reports the secrets re-encrypted by a key rotation
+type KeyRotation struct {
+	KeyID                  string   `json:"key_id"`
+	Reencrypted            []string `json:"reencrypted"`
+	CloudflareTokenRotated bool     `json:"cloudflare_token_rotated"`
+}
+
+// SSHKey is the public half of the SSH key Xanthus uses to reach servers
+type SSHKey struct {
+	PublicKey   string `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	Legacy      bool   `json:"legacy"` // still the key derived from the TLS CSR private key
+}
+
+// SSHKeyRotation reports the servers moved to a new SSH key
+type SSHKeyRotation struct {
+	Fingerprint    string   `json:"fingerprint"`
+	OldFingerprint string   `json:"old_fingerprint"`
+	Servers        []string `json:"servers"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// vpsFromConfig converts a stored VPS configuration to its API representation
+func vpsFromConfig(config *services.VPSConfig) VPS {
+	return VPS{
+		ID:           config.ServerID,
+		Name:         config.Name,
+		Provider:     config.Provider,
+		ServerType:   config.ServerType,
+		Location:     config.Location,
+		Region:       config.Region,
+		Architecture: config.Architecture,
+		PublicIPv4:   config.PublicIPv4,
+		SSHUser:      config.SSHUser,
+		SSHPort:      config.SSHPort,
+		Timezone:     config.Timezone,
+		HourlyRate:   config.HourlyRate,
+		MonthlyRate:  config.MonthlyRate,
+		CreatedAt:    config.CreatedAt,
+
+		HostKeyFingerprint: config.HostKeyFingerprint,
+		ClusterServerID:    config.ClusterServerID,
+		PrivateIPv4:        config.PrivateIPv4,
+	}
+}
+
+// domainFromConfig converts a stored domain SSL configuration, dropping key material
+func domainFromConfig(config *services.DomainSSLConfig) Domain {
+	return Domain{
+		Domain:         config.Domain,
+		ZoneID:         config.ZoneID,
+		SSLMode:        config.SSLMode,
+		AlwaysUseHTTPS: config.AlwaysUseHTTPS,
+		Issuer:         domainIssuer(config),
+		DNSOnly:        config.DNSOnly,
+		ConfiguredAt:   config.ConfiguredAt,
+		ExpiresAt:      domainExpiry(config),
+		RenewedAt:      config.RenewedAt,
+		RenewalError:   config.RenewalError,
+	}
+}
+
+// domainIssuer returns the certificate issuer of a domain; configurations from
+// before ACME support have none and use Cloudflare origin certificates
+func domainIssuer(config *services.DomainSSLConfig) string {
+	if config.Issuer == "" {
+		return services.IssuerCloudflareOrigin
+	}
+	return config.Issuer
+}
+
+// domainExpiry returns the certificate expiry of a domain, parsed from the
+// certificate when the renewal scheduler hasn't recorded it yet
+func domainExpiry(config *services.DomainSSLConfig) string {
+	expiry, err := config.Expiry()
+	if err != nil {
+		return ""
+	}
+	return expiry.UTC().Format(time.RFC3339)
+}
+
+// releaseFromGitHub converts a GitHub release to its API representation
+func releaseFromGitHub(release handlers.GitHubRelease) Release {
+	return Release{
+		Version:     release.TagName,
+		Name:        release.Name,
+		Notes:       release.Body,
+		Prerelease:  release.Prerelease,
+		PublishedAt: release.PublishedAt,
+		URL:         release.HTMLURL,
+	}
+}
+
+// tokenFromService converts a stored API token, dropping hash and credential
+func tokenFromService(token *services.APIToken) APIToken {
+	return APIToken{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scopes:     token.Scopes,
+		CreatedAt:  token.CreatedAt,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		RevokedAt:  token.RevokedAt,
+	}
+}
+
+// userFromService converts a stored user, dropping the password hash
+func userFromService(user *services.User) User {
+	return User{
+		Username:    user.Username,
+		Role:        user.Role,
+		CreatedAt:   user.CreatedAt,
+		LastLoginAt: user.LastLoginAt,
+	}
+}
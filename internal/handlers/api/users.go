@@ -0,0 +1,106 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListUsers returns every Xanthus user
+func (h *Handler) ListUsers(c *gin.Context) {
+	users, err := h.users().ListUsers()
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "Failed to list users")
+		return
+	}
+
+	result := make([]User, 0, len(users))
+	for i := range users {
+		result = append(result, userFromService(&users[i]))
+	}
+
+	respond(c, http.StatusOK, result)
+}
+
+// CreateUser adds a user
+func (h *Handler) CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	user, err := h.users().CreateUser(req.Username, req.Password, req.Role)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	respond(c, http.StatusCreated, userFromService(user))
+}
+
+// UpdateUser changes the role and/or resets the password of a user
+func (h *Handler) UpdateUser(c *gin.Context) {
+	var req UpdateUserRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if req.Role == "" && req.Password == "" {
+		respondError(c, http.StatusBadRequest, "Nothing to update: set role and/or password")
+		return
+	}
+
+	users := h.users()
+	username := c.Param("username")
+
+	if req.Role != "" {
+		if _, err := users.SetRole(username, req.Role); err != nil {
+			respondUserError(c, err)
+			return
+		}
+	}
+	if req.Password != "" {
+		if err := users.SetPassword(username, req.Password); err != nil {
+			respondUserError(c, err)
+			return
+		}
+	}
+
+	user, err := users.GetUser(username)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	respond(c, http.StatusOK, userFromService(user))
+}
+
+// DeleteUser removes a user
+func (h *Handler) DeleteUser(c *gin.Context) {
+	username := c.Param("username")
+	if username == c.GetString("username") {
+		respondError(c, http.StatusBadRequest, "You can't delete your own account")
+		return
+	}
+
+	if err := h.users().DeleteUser(username); err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	respondMessage(c, http.StatusOK, "User deleted")
+}
+
+// respondUserError maps user service errors to API responses
+func respondUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		respondError(c, http.StatusNotFound, "User not found")
+	case errors.Is(err, services.ErrUserExists), errors.Is(err, services.ErrLastAdmin):
+		respondError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidUser):
+		respondError(c, http.StatusBadRequest, err.Error())
+	default:
+		respondError(c, http.StatusInternalServerError, "Failed to update users")
+	}
+}
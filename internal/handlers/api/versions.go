@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// GetVersion returns the running Xanthus version
+func (h *Handler) GetVersion(c *gin.Context) {
+	service := h.versions.SelfUpdateService()
+	respond(c, http.StatusOK, VersionInfo{
+		Version:         service.GetCurrentVersion(),
+		PreviousVersion: service.GetPreviousVersion(),
+		CanRollback:     service.CanRollback(),
+	})
+}
+
+// ListReleases returns the published Xanthus releases, newest first
+func (h *Handler) ListReleases(c *gin.Context) {
+	releases, err := h.versions.AvailableReleases()
+	if err != nil {
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to fetch releases: %v", err))
+		return
+	}
+
+	result := make([]Release, 0, len(releases))
+	for _, release := range releases {
+		result = append(result, releaseFromGitHub(release))
+	}
+
+	respond(c, http.StatusOK, result)
+}
+
+// StartUpdate starts a self-update to the requested release
+func (h *Handler) StartUpdate(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	var req UpdateRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	service := h.versions.SelfUpdateService()
+	if service.IsUpdateInProgress() {
+		respondError(c, http.StatusConflict, "Update already in progress")
+		return
+	}
+
+	releases, err := h.versions.AvailableReleases()
+	if err != nil {
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to validate version: %v", err))
+		return
+	}
+
+	for _, release := range releases {
+		if release.TagName == req.Version {
+			job, err := service.StartUpdateJob(h.jobs(), token, accountID, req.Version)
+			if err != nil {
+				respondError(c, http.StatusConflict, "Update already in progress")
+				return
+			}
+			c.Header(utils.JobIDHeader, job.ID)
+			respond(c, http.StatusAccepted, service.GetUpdateStatus())
+			return
+		}
+	}
+
+	respondError(c, http.StatusBadRequest, "Version not found")
+}
+
+// RollbackUpdate restores the previously installed version
+func (h *Handler) RollbackUpdate(c *gin.Context) {
+	token, accountID := credentials(c)
+	service := h.versions.SelfUpdateService()
+
+	if service.IsUpdateInProgress() {
+		respondError(c, http.StatusConflict, "Cannot rollback while update is in progress")
+		return
+	}
+
+	previousVersion := service.GetPreviousVersion()
+	if !service.CanRollback() || previousVersion == "" {
+		respondError(c, http.StatusBadRequest, "No previous version available for rollback")
+		return
+	}
+
+	job, err := service.StartRollbackJob(h.jobs(), token, accountID, previousVersion)
+	if err != nil {
+		respondError(c, http.StatusConflict, "Cannot rollback while update is in progress")
+		return
+	}
+	c.Header(utils.JobIDHeader, job.ID)
+	respond(c, http.StatusAccepted, service.GetUpdateStatus())
+}
+
+// GetUpdateStatus returns the progress of the current or last update
+func (h *Handler) GetUpdateStatus(c *gin.Context) {
+	respond(c, http.StatusOK, h.versions.SelfUpdateService().GetUpdateStatus())
+}
@@ -0,0 +1,405 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// ListVPS returns all servers managed by Xanthus
+func (h *Handler) ListVPS(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	configs, err := h.kvService.ListVPSConfigs(token, accountID)
+	if err != nil {
+		log.Printf("API: error listing VPS configs: %v", err)
+		respondError(c, http.StatusInternalServerError, "Failed to list servers")
+		return
+	}
+
+	servers := make([]VPS, 0, len(configs))
+	for _, config := range configs {
+		servers = append(servers, vpsFromConfig(config))
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ID < servers[j].ID })
+
+	respond(c, http.StatusOK, servers)
+}
+
+// GetVPS returns a single server
+func (h *Handler) GetVPS(c *gin.Context) {
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+	respond(c, http.StatusOK, vpsFromConfig(config))
+}
+
+// CreateVPS creates a server with K3s and Helm on any supported provider
+func (h *Handler) CreateVPS(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	var req CreateVPSRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	provider := services.ProviderHetzner
+	if req.Provider != "" {
+		name, ok := services.CanonicalProviderName(req.Provider)
+		if !ok {
+			respondError(c, http.StatusBadRequest, fmt.Sprintf("Unsupported provider: %s", req.Provider))
+			return
+		}
+		provider = name
+	}
+	if provider == services.ProviderHetzner && (req.Location == "" || req.ServerType == "") {
+		respondError(c, http.StatusBadRequest, "location and server_type are required for Hetzner")
+		return
+	}
+
+	var server *services.CloudServer
+	var config *services.VPSConfig
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeVPSCreate, Target: req.Name}, func(ctx context.Context) error {
+		var err error
+		server, config, err = h.vpsService.CreateServer(ctx, token, accountID, provider, services.CloudServerRequest{
+			Name:       req.Name,
+			ServerType: req.ServerType,
+			Location:   req.Location,
+			Timezone:   req.Timezone,
+			CPUs:       req.CPUs,
+			MemoryGB:   req.MemoryGB,
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("API: error creating server %s: %v", req.Name, err)
+		switch {
+		case errors.Is(err, services.ErrInvalidServerRequest):
+			respondError(c, http.StatusBadRequest, err.Error())
+		case strings.Contains(err.Error(), "server name is already used") || strings.Contains(err.Error(), "uniqueness_error"):
+			respondError(c, http.StatusConflict, "A server with this name already exists")
+		default:
+			respondError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to create server: %v", err))
+		}
+		return
+	}
+
+	h.vpsService.InvalidateVPSCache(accountID)
+	log.Printf("✅ API: created %s server %s (ID: %d)", provider, server.Name, server.ID)
+	respond(c, http.StatusCreated, vpsFromConfig(config))
+}
+
+// AddVPS adds an existing server by its SSH address and starts the K3s bootstrap on it
+func (h *Handler) AddVPS(c *gin.Context) {
+	token, accountID := credentials(c)
+
+	var req AddVPSRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	var config *services.VPSConfig
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeVPSAdd, Target: req.Name}, func(ctx context.Context) error {
+		var err error
+		config, err = h.vpsService.AddExistingServer(ctx, token, accountID, services.ExistingServerRequest{
+			Name:     req.Name,
+			Host:     req.Host,
+			SSHUser:  req.SSHUser,
+			SSHPort:  req.SSHPort,
+			Password: req.Password,
+			Timezone: req.Timezone,
+		})
+		return err
+	})
+	if err != nil {
+		log.Printf("API: error adding server %s (%s): %v", req.Name, req.Host, err)
+		if errors.Is(err, services.ErrInvalidServerRequest) {
+			respondError(c, http.StatusBadRequest, err.Error())
+		} else {
+			respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to add server: %v", err))
+		}
+		return
+	}
+
+	h.vpsService.InvalidateVPSCache(accountID)
+	log.Printf("✅ API: added server %s (ID: %d)", config.Name, config.ServerID)
+	respond(c, http.StatusCreated, vpsFromConfig(config))
+}
+
+// PowerVPS powers a server off or on, or reboots it
+func (h *Handler) PowerVPS(c *gin.Context) {
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+
+	var req VPSPowerRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, accountID := credentials(c)
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeVPSPower, Target: fmt.Sprintf("%s %s", req.Action, config.Name)}, func(ctx context.Context) error {
+		return h.vpsService.PowerAction(ctx, token, accountID, config.ServerID, req.Action)
+	})
+	if err != nil {
+		log.Printf("API: %s on VPS %d failed: %v", req.Action, config.ServerID, err)
+		if errors.Is(err, services.ErrPowerActionUnsupported) {
+			respondError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to perform %s: %v", req.Action, err))
+		return
+	}
+
+	respondMessage(c, http.StatusOK, fmt.Sprintf("%s requested for server %d", req.Action, config.ServerID))
+}
+
+// TrustVPSHostKey pins the SSH host key a server presents now, e.g. after it was rebuilt
+func (h *Handler) TrustVPSHostKey(c *gin.Context) {
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	config, err := h.vpsService.TrustHostKey(token, accountID, config.ServerID)
+	if err != nil {
+		log.Printf("API: re-trusting the host key of VPS %s failed: %v", c.Param("id"), err)
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to read the host key: %v", err))
+		return
+	}
+
+	respond(c, http.StatusOK, vpsFromConfig(config))
+}
+
+// DeleteVPS deletes a server, its applications and its configuration
+func (h *Handler) DeleteVPS(c *gin.Context) {
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeVPSDelete, Target: config.Name}, func(ctx context.Context) error {
+		_, err := h.vpsService.DeleteServer(ctx, token, accountID, config.ServerID)
+		return err
+	})
+	if err != nil {
+		log.Printf("API: deleting VPS %d failed: %v", config.ServerID, err)
+		if errors.Is(err, services.ErrInvalidServerRequest) {
+			respondError(c, http.StatusConflict, err.Error())
+			return
+		}
+		respondError(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete server: %v", err))
+		return
+	}
+
+	h.vpsService.InvalidateVPSCache(accountID)
+	log.Printf("✅ API: deleted server %s (ID: %d)", config.Name, config.ServerID)
+	respondMessage(c, http.StatusOK, "Server deleted")
+}
+
+// RebuildVPS replaces a lost server with a new one of the same type and
+// location, redeploys its applications and points their DNS records at it
+func (h *Handler) RebuildVPS(c *gin.Context) {
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+
+	var req RebuildVPSRequest
+	if c.Request.ContentLength != 0 && !bindJSON(c, &req) {
+		return
+	}
+
+	token, accountID := credentials(c)
+	var result *services.RebuildResult
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeVPSRebuild, Target: config.Name}, func(ctx context.Context) error {
+		var err error
+		result, err = services.NewRebuildService(h.appsHandler.GetCatalog()).Rebuild(ctx, token, accountID, services.RebuildRequest{
+			ServerID:       config.ServerID,
+			Replace:        req.Replace,
+			RestoreBackups: req.RestoreBackups,
+		})
+		return err
+	})
+	h.vpsService.InvalidateVPSCache(accountID)
+	if err != nil {
+		log.Printf("API: rebuilding VPS %d failed: %v", config.ServerID, err)
+		switch {
+		case errors.Is(err, services.ErrRebuildUnsupported):
+			respondError(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, services.ErrServerStillExists):
+			respondError(c, http.StatusConflict, err.Error())
+		default:
+			respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to rebuild server: %v", err))
+		}
+		return
+	}
+
+	log.Printf("✅ API: rebuilt server %s (ID: %d → %d)", config.Name, result.OldServerID, result.Server.ServerID)
+	respond(c, http.StatusOK, result)
+}
+
+// ListClusterNodes lists the Kubernetes nodes of the cluster a server belongs to
+func (h *Handler) ListClusterNodes(c *gin.Context) {
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	nodes, err := services.NewClusterService().ListNodes(token, accountID, config.ServerID)
+	if err != nil {
+		log.Printf("API: listing the nodes of VPS %d failed: %v", config.ServerID, err)
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to list nodes: %v", err))
+		return
+	}
+	respond(c, http.StatusOK, nodes)
+}
+
+// JoinClusterNode creates or adds a server as an agent node of a server's cluster
+func (h *Handler) JoinClusterNode(c *gin.Context) {
+	server, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+
+	var req JoinNodeRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, accountID := credentials(c)
+	var config *services.VPSConfig
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeVPSJoin, Target: fmt.Sprintf("%s to %s", req.Name, server.Name)}, func(ctx context.Context) error {
+		var err error
+		config, err = services.NewClusterService().Join(ctx, token, accountID, services.JoinNodeRequest{
+			ServerID:   server.ServerID,
+			Provider:   req.Provider,
+			Name:       req.Name,
+			ServerType: req.ServerType,
+			Location:   req.Location,
+			Timezone:   req.Timezone,
+			CPUs:       req.CPUs,
+			MemoryGB:   req.MemoryGB,
+			Host:       req.Host,
+			SSHUser:    req.SSHUser,
+			SSHPort:    req.SSHPort,
+			Password:   req.Password,
+		})
+		return err
+	})
+	h.vpsService.InvalidateVPSCache(accountID)
+	if err != nil {
+		log.Printf("API: joining %s to VPS %d failed: %v", req.Name, server.ServerID, err)
+		switch {
+		case errors.Is(err, services.ErrInvalidClusterRequest), errors.Is(err, services.ErrInvalidServerRequest):
+			respondError(c, http.StatusBadRequest, err.Error())
+		default:
+			respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to join node: %v", err))
+		}
+		return
+	}
+
+	log.Printf("✅ API: %s (ID: %d) joined the cluster of %s", config.Name, config.ServerID, server.Name)
+	respond(c, http.StatusCreated, vpsFromConfig(config))
+}
+
+// GetClusterCapacity measures the free capacity of the cluster a server belongs to
+func (h *Handler) GetClusterCapacity(c *gin.Context) {
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	info, err := services.NewCapacityService().ClusterInfo(token, accountID, config.ServerID)
+	if err != nil {
+		log.Printf("API: measuring the capacity of VPS %d failed: %v", config.ServerID, err)
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to measure capacity: %v", err))
+		return
+	}
+	respond(c, http.StatusOK, info)
+}
+
+// GetK3sVersions shows the K3s version of the cluster a server belongs to
+// and the releases it can be upgraded to
+func (h *Handler) GetK3sVersions(c *gin.Context) {
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+
+	token, accountID := credentials(c)
+	versions, err := services.NewK3sUpgradeService().Versions(token, accountID, config.ServerID)
+	if err != nil {
+		log.Printf("API: listing the K3s versions of VPS %d failed: %v", config.ServerID, err)
+		respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to list K3s versions: %v", err))
+		return
+	}
+	respond(c, http.StatusOK, versions)
+}
+
+// UpgradeK3s upgrades the K3s of the cluster a server belongs to
+func (h *Handler) UpgradeK3s(c *gin.Context) {
+	config, ok := h.lookupVPS(c)
+	if !ok {
+		return
+	}
+
+	var req UpgradeK3sRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	token, accountID := credentials(c)
+	var result *services.K3sUpgradeResult
+	err := h.runJob(c, services.JobSpec{Type: services.JobTypeK3sUpgrade, Target: fmt.Sprintf("%s to %s", config.Name, req.Version)}, func(ctx context.Context) error {
+		var err error
+		result, err = services.NewK3sUpgradeService().Upgrade(ctx, token, accountID, config.ServerID, req.Version)
+		return err
+	})
+	if err != nil {
+		log.Printf("API: upgrading K3s of VPS %d to %s failed: %v", config.ServerID, req.Version, err)
+		switch {
+		case errors.Is(err, services.ErrInvalidUpgradeRequest):
+			respondError(c, http.StatusBadRequest, err.Error())
+		default:
+			respondError(c, http.StatusBadGateway, fmt.Sprintf("Failed to upgrade K3s: %v", err))
+		}
+		return
+	}
+
+	log.Printf("✅ API: upgraded K3s of %s from %s to %s", config.Name, result.From, result.To)
+	respond(c, http.StatusOK, result)
+}
+
+// lookupVPS loads the VPS named by the :id path parameter
+func (h *Handler) lookupVPS(c *gin.Context) (*services.VPSConfig, bool) {
+	token, accountID := credentials(c)
+
+	serverID, err := utils.ParseServerID(c.Param("id"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "Invalid server ID")
+		return nil, false
+	}
+
+	config, err := h.kvService.GetVPSConfig(token, accountID, serverID)
+	if err != nil {
+		respondError(c, http.StatusNotFound, "VPS not found")
+		return nil, false
+	}
+
+	return config, true
+}
@@ -44,3 +44,13 @@ func (h *Handler) GetApplicationService() *services.SimpleApplicationService {
 	}
 	return services.NewSimpleApplicationService()
 }
+
+// GetCatalog returns the application catalog used by this handler
+func (h *Handler) GetCatalog() services.ApplicationCatalog {
+	return h.catalog
+}
+
+// GetVersionService returns the service resolving the latest versions of catalog applications
+func (h *Handler) GetVersionService() *services.EnhancedDefaultVersionService {
+	return h.serviceFactory.GetEnhancedVersionService()
+}
@@ -1,9 +1,9 @@
 package applications
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
+	"log"
 	"strconv"
 	"strings"
 	"time"
@@ -30,27 +30,21 @@ func NewVPSConnectionHelper() *VPSConnectionHelper {
 // GetVPSConnection establishes an SSH connection to a VPS
 func (v *VPSConnectionHelper) GetVPSConnection(token, accountID, vpsID string) (*services.SSHConnection, error) {
 	// Get VPS configuration
-	var vpsConfig struct {
-		PublicIPv4 string `json:"public_ipv4"`
-		SSHUser    string `json:"ssh_user"`
-	}
+	var vpsConfig services.VPSConfig
 	err := v.kvService.GetValue(token, accountID, fmt.Sprintf("vps:%s:config", vpsID), &vpsConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get VPS configuration: %v", err)
 	}
 
 	// Get SSH private key
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		PrivateKey string `json:"private_key"`
-	}
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+	privateKey, err := services.NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
 		return nil, fmt.Errorf("failed to get SSH private key: %v", err)
 	}
 
 	// Create SSH connection
 	vpsIDInt, _ := strconv.Atoi(vpsID)
-	conn, err := v.sshService.GetOrCreateConnection(vpsConfig.PublicIPv4, vpsConfig.SSHUser, csrConfig.PrivateKey, vpsIDInt)
+	conn, err := v.sshService.GetOrCreateConnection(vpsConfig.SSHAddress(), vpsConfig.SSHUser, privateKey, vpsIDInt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to VPS: %v", err)
 	}
@@ -89,14 +83,11 @@ func NewSSHKeyHelper() *SSHKeyHelper {
 
 // GetSSHPrivateKey retrieves the SSH private key for VPS connections
 func (s *SSHKeyHelper) GetSSHPrivateKey(token, accountID string) (string, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		PrivateKey string `json:"private_key"`
-	}
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+	privateKey, err := services.NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
 		return "", fmt.Errorf("failed to get SSH private key: %v", err)
 	}
-	return csrConfig.PrivateKey, nil
+	return privateKey, nil
 }
 
 // ValidationHelper provides common validation functions
@@ -162,58 +153,46 @@ func (v *ValidationHelper) ValidateSubdomainAvailability(token, accountID, subdo
 	return nil
 }
 
-// getExistingApplications retrieves all existing applications from KV store
-func (v *ValidationHelper) getExistingApplications(token, accountID string, kvService *services.KVService) ([]models.Application, error) {
-	// Get the Xanthus namespace ID
-	namespaceID, err := kvService.GetXanthusNamespaceID(token, accountID)
+// ValidateClusterCapacity checks that an application fits in the free capacity
+// of the cluster of a VPS. Only an application that doesn't fit is an error:
+// a cluster that can't be measured is logged and the deployment goes ahead.
+func (v *ValidationHelper) ValidateClusterCapacity(token, accountID, vpsID string, app *models.PredefinedApplication) error {
+	serverID, err := utils.ParseServerID(vpsID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get namespace ID: %w", err)
+		return fmt.Errorf("invalid VPS ID: %s", vpsID)
 	}
 
-	// List all keys with app: prefix
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/storage/kv/namespaces/%s/keys?prefix=app:",
-		accountID, namespaceID)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	info, err := services.NewCapacityService().CheckApplication(token, accountID, serverID, *app)
+	if errors.Is(err, services.ErrInsufficientCapacity) {
+		return err
 	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var keysResp struct {
-		Success bool `json:"success"`
-		Result  []struct {
-			Name string `json:"name"`
-		} `json:"result"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&keysResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
+		log.Printf("Warning: Could not measure the capacity of VPS %d before deploying %s: %v", serverID, app.ID, err)
+		return nil
 	}
+	log.Printf("VPS %d has %.2f CPU, %d GB memory and %d GB disk free for %s", serverID, info.AvailableCPU, info.AvailableMemoryGB, info.AvailableDiskGB, app.ID)
+	return nil
+}
 
-	if !keysResp.Success {
-		return nil, fmt.Errorf("KV API failed")
+// getExistingApplications retrieves all existing applications from KV store
+func (v *ValidationHelper) getExistingApplications(token, accountID string, kvService *services.KVService) ([]models.Application, error) {
+	// List all keys with app: prefix
+	keyNames, err := kvService.ListKeys(token, accountID, "app:")
+	if err != nil {
+		return nil, err
 	}
 
 	applications := []models.Application{}
 
 	// Fetch each application, but skip password keys
-	for _, key := range keysResp.Result {
+	for _, keyName := range keyNames {
 		// Skip password keys (they end with ":password")
-		if strings.HasSuffix(key.Name, ":password") {
+		if strings.HasSuffix(keyName, ":password") {
 			continue
 		}
 
 		var app models.Application
-		if err := kvService.GetValue(token, accountID, key.Name, &app); err == nil {
+		if err := kvService.GetValue(token, accountID, keyName, &app); err == nil {
 			applications = append(applications, app)
 		}
 	}
@@ -299,7 +278,7 @@ func NewPasswordHelper() *PasswordHelper {
 
 // StoreEncryptedPassword stores an encrypted password in KV
 func (p *PasswordHelper) StoreEncryptedPassword(token, accountID, appID, password string) error {
-	encryptedPassword, err := utils.EncryptData(password, token)
+	encryptedPassword, err := utils.EncryptSecret(token, accountID, password)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt password: %v", err)
 	}
@@ -336,7 +315,7 @@ func (p *PasswordHelper) GetDecryptedPassword(token, accountID, appID string) (s
 	err = p.kvService.GetValue(token, accountID, fmt.Sprintf("app:%s:password", appID), &passwordData)
 	if err == nil {
 		// Found in KV, decrypt and return
-		password, err := utils.DecryptData(passwordData.Password, token)
+		password, err := utils.DecryptSecret(token, accountID, passwordData.Password)
 		if err != nil {
 			return "", fmt.Errorf("failed to decrypt password: %v", err)
 		}
@@ -378,7 +357,7 @@ func (p *PasswordHelper) retrievePasswordFromVPSWithoutStorage(token, accountID,
 
 	// Generate release name (should match the deployment logic)
 	// Release name format: subdomain-apptype (e.g., final-test-code-server)
-	releaseName := fmt.Sprintf("%s-%s", app.Subdomain, app.AppType)
+	releaseName := app.HelmReleaseName()
 
 	// Retrieve password based on application type
 	switch app.AppType {
@@ -409,7 +388,7 @@ func (p *PasswordHelper) retrievePasswordFromVPS(token, accountID, appID string)
 
 	// Generate release name (should match the deployment logic)
 	// Release name format: subdomain-apptype (e.g., final-test-code-server)
-	releaseName := fmt.Sprintf("%s-%s", app.Subdomain, app.AppType)
+	releaseName := app.HelmReleaseName()
 
 	// Retrieve password based on application type
 	switch app.AppType {
@@ -676,29 +655,7 @@ func (p *PortForwardService) storePortForward(token, accountID, appID string, po
 
 // createKubernetesService creates a Kubernetes service for port forwarding
 func (p *PortForwardService) createKubernetesService(conn *services.SSHConnection, app *models.Application, portForward *PortForward) error {
-	// Use the actual deployment's release name pattern: subdomain-apptype
-	// This matches how applications are actually deployed
-	releaseName := fmt.Sprintf("%s-%s", app.Subdomain, app.AppType)
-
-	serviceYAML := fmt.Sprintf(`apiVersion: v1
-kind: Service
-metadata:
-  name: %s
-  namespace: %s
-  labels:
-    app: %s
-    port-forward: "true"
-spec:
-  selector:
-    app.kubernetes.io/name: %s
-    app.kubernetes.io/instance: %s
-  ports:
-  - name: port-%d
-    port: 80
-    targetPort: %d
-    protocol: TCP
-  type: ClusterIP
-`, portForward.ServiceName, app.Namespace, portForward.ServiceName, app.AppType, releaseName, portForward.Port, portForward.Port)
+	serviceYAML := services.PortForwardServiceYAML(app, portForward.ServiceName, portForward.Port)
 
 	// Apply the service using kubectl
 	cmd := fmt.Sprintf("cat <<'EOF' | kubectl apply -f -\n%s\nEOF", serviceYAML)
@@ -712,34 +669,7 @@ spec:
 
 // createKubernetesIngress creates a Kubernetes ingress for port forwarding
 func (p *PortForwardService) createKubernetesIngress(conn *services.SSHConnection, app *models.Application, portForward *PortForward) error {
-	ingressYAML := fmt.Sprintf(`apiVersion: networking.k8s.io/v1
-kind: Ingress
-metadata:
-  name: %s
-  namespace: %s
-  labels:
-    app: %s
-    port-forward: "true"
-  annotations:
-    traefik.ingress.kubernetes.io/router.entrypoints: websecure
-    traefik.ingress.kubernetes.io/router.tls: "true"
-spec:
-  tls:
-  - secretName: %s-tls
-    hosts:
-    - %s.%s
-  rules:
-  - host: %s.%s
-    http:
-      paths:
-      - path: /
-        pathType: Prefix
-        backend:
-          service:
-            name: %s
-            port:
-              number: 80
-`, portForward.IngressName, app.Namespace, portForward.ServiceName, portForward.Domain, portForward.Subdomain, portForward.Domain, portForward.Subdomain, portForward.Domain, portForward.ServiceName)
+	ingressYAML := services.PortForwardIngressYAML(app, portForward.IngressName, portForward.ServiceName, portForward.Subdomain, portForward.Domain)
 
 	// Apply the ingress using kubectl
 	cmd := fmt.Sprintf("cat <<'EOF' | kubectl apply -f -\n%s\nEOF", ingressYAML)
@@ -783,9 +713,15 @@ func (p *PortForwardService) createPortForwardDNS(token, accountID, vpsID string
 		return fmt.Errorf("failed to get zone ID for domain %s: %v", portForward.Domain, err)
 	}
 
+	// Domains with an ACME certificate may be configured DNS only, without the Cloudflare proxy
+	proxied := true
+	if domainConfig, err := services.NewKVService().GetDomainSSLConfig(token, accountID, portForward.Domain); err == nil && domainConfig.DNSOnly {
+		proxied = false
+	}
+
 	// Create A record for subdomain
 	recordName := fmt.Sprintf("%s.%s", portForward.Subdomain, portForward.Domain)
-	_, err = cfService.CreateDNSRecord(token, zoneID, "A", recordName, vpsConfig.PublicIPv4, true)
+	_, err = cfService.CreateDNSRecord(token, zoneID, "A", recordName, vpsConfig.PublicIPv4, proxied)
 	if err != nil {
 		return fmt.Errorf("failed to create DNS A record for %s: %v", recordName, err)
 	}
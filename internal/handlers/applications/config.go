@@ -72,7 +72,7 @@ func Constants() *ApplicationConstants {
 		PasswordPrefix: ":password",
 		VPSPrefix:      "vps:",
 
-		SSHKeySecret:    "config:ssl:csr",
+		SSHKeySecret:    "config:ssh:keypair",
 		TLSSecretSuffix: "-tls",
 
 		ReleaseNameFormat: "%s-%s", // subdomain-appid
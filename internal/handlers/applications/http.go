@@ -1,6 +1,8 @@
 package applications
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,6 +11,7 @@ import (
 
 	"github.com/chrishham/xanthus/internal/models"
 	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
 	"github.com/gin-gonic/gin"
 	"gopkg.in/yaml.v3"
 )
@@ -100,9 +103,12 @@ func (h *Handler) HandleApplicationsPrerequisites(c *gin.Context) {
 		return
 	}
 
-	// Convert to server list
+	// Convert to server list; applications are deployed to server nodes, never to agents
 	managedServers := []gin.H{}
 	for serverID, config := range vpsConfigs {
+		if config.IsAgent() {
+			continue
+		}
 		managedServers = append(managedServers, gin.H{
 			"id":   fmt.Sprintf("%d", serverID),
 			"name": config.Name,
@@ -195,6 +201,12 @@ func (h *Handler) HandleApplicationsCreate(c *gin.Context) {
 		predefinedApp.Version = appData.Version
 	}
 
+	// Refuse deployments the cluster has no room for, rather than failing them half-way
+	if err := validator.ValidateClusterCapacity(token, accountID, appData.VPS, predefinedApp); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Convert struct to map for service compatibility
 	appDataMap := map[string]interface{}{
 		"subdomain":   appData.Subdomain,
@@ -206,8 +218,20 @@ func (h *Handler) HandleApplicationsCreate(c *gin.Context) {
 
 	// Create application using service
 	appService := h.GetApplicationService()
-	app, err := appService.CreateApplication(token, accountID, appDataMap, predefinedApp)
-	if err != nil {
+	var app *models.Application
+	job, err := services.GetJobManager().Run(token, accountID, services.JobSpec{
+		Type:   services.JobTypeAppDeploy,
+		Target: fmt.Sprintf("%s.%s", appData.Subdomain, appData.Domain),
+	}, func(ctx context.Context) error {
+		var err error
+		app, err = appService.CreateApplication(ctx, token, accountID, appDataMap, predefinedApp)
+		if err == nil && app.Status == "Failed" {
+			return errors.New(app.ErrorMsg)
+		}
+		return err
+	})
+	c.Header(utils.JobIDHeader, job.ID)
+	if app == nil {
 		log.Printf("Error creating application: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create application"})
 		return
@@ -283,7 +307,14 @@ func (h *Handler) HandleApplicationUpgrade(c *gin.Context) {
 
 	// Upgrade application using service
 	deploymentService := services.NewApplicationDeploymentService()
-	err = deploymentService.UpgradeApplication(token, accountID, appID, upgradeData.Version)
+	job, err := services.GetJobManager().Run(token, accountID, services.JobSpec{
+		Type:        services.JobTypeAppUpgrade,
+		Target:      appID,
+		MaxAttempts: 2, // helm upgrade is idempotent
+	}, func(ctx context.Context) error {
+		return deploymentService.UpgradeApplication(ctx, token, accountID, appID, upgradeData.Version)
+	})
+	c.Header(utils.JobIDHeader, job.ID)
 	if err != nil {
 		log.Printf("Error upgrading application: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upgrade application"})
@@ -485,7 +516,13 @@ func (h *Handler) HandleApplicationDelete(c *gin.Context) {
 
 	// Delete application using service
 	appService := h.GetApplicationService()
-	err := appService.DeleteApplication(token, accountID, appID)
+	job, err := services.GetJobManager().Run(token, accountID, services.JobSpec{
+		Type:   services.JobTypeAppDelete,
+		Target: appID,
+	}, func(ctx context.Context) error {
+		return appService.DeleteApplication(ctx, token, accountID, appID)
+	})
+	c.Header(utils.JobIDHeader, job.ID)
 	if err != nil {
 		log.Printf("Error deleting application: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete application"})
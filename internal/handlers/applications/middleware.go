@@ -7,50 +7,26 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// AuthMiddleware validates Cloudflare token and sets account ID in context
+// AuthMiddleware requires credentials resolved by the global auth middleware
 func (h *Handler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := c.Cookie("cf_token")
-		if err != nil || !utils.VerifyCloudflareToken(token) {
+		if _, err := utils.ValidateTokenAndGetAccount(c); err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 			c.Abort()
 			return
 		}
-
-		// Get account ID and set in context
-		_, accountID, err := utils.CheckKVNamespaceExists(token)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to access account"})
-			c.Abort()
-			return
-		}
-
-		c.Set("cf_token", token)
-		c.Set("account_id", accountID)
 		c.Next()
 	}
 }
 
-// AuthMiddlewareHTML validates Cloudflare token for HTML pages (redirects to login)
+// AuthMiddlewareHTML requires a signed-in user for HTML pages (redirects to login)
 func (h *Handler) AuthMiddlewareHTML() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := c.Cookie("cf_token")
-		if err != nil || !utils.VerifyCloudflareToken(token) {
+		if _, err := utils.ValidateTokenAndGetAccount(c); err != nil {
 			c.Redirect(http.StatusTemporaryRedirect, "/login")
 			c.Abort()
 			return
 		}
-
-		// Get account ID and set in context
-		_, accountID, err := utils.CheckKVNamespaceExists(token)
-		if err != nil {
-			c.Data(http.StatusOK, "text/html", []byte("❌ Error accessing account"))
-			c.Abort()
-			return
-		}
-
-		c.Set("cf_token", token)
-		c.Set("account_id", accountID)
 		c.Next()
 	}
 }
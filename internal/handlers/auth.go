@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/chrishham/xanthus/internal/middleware"
 	"github.com/chrishham/xanthus/internal/services"
 	"github.com/chrishham/xanthus/internal/utils"
 	"github.com/gin-gonic/gin"
@@ -26,19 +29,48 @@ func (h *AuthHandler) HandleRoot(c *gin.Context) {
 	c.Redirect(http.StatusTemporaryRedirect, "/login")
 }
 
-// HandleLoginPage renders the login page
+// HandleLoginPage renders the login page, or the setup form until the first admin exists
 func (h *AuthHandler) HandleLoginPage(c *gin.Context) {
-	c.HTML(http.StatusOK, "login.html", nil)
+	c.HTML(http.StatusOK, "login.html", gin.H{
+		"Setup": !middleware.GetUserService().IsSetUp(),
+	})
 }
 
-// HandleLogin processes login with Cloudflare token
+// HandleLogin signs a user in with their username and password. On a fresh
+// install it instead sets Xanthus up with a Cloudflare token and the first admin.
 func (h *AuthHandler) HandleLogin(c *gin.Context) {
+	users := middleware.GetUserService()
+	if !users.IsSetUp() {
+		h.handleSetup(c, users)
+		return
+	}
+
+	user, err := users.Authenticate(c.PostForm("username"), c.PostForm("password"))
+	if err != nil {
+		if !errors.Is(err, services.ErrInvalidCredentials) {
+			log.Printf("Error authenticating user: %v", err)
+		}
+		c.Data(http.StatusOK, "text/html", []byte("❌ Invalid username or password."))
+		return
+	}
+
+	h.startSession(c, users, user)
+}
+
+// handleSetup stores the Cloudflare token of the instance and creates the first admin
+func (h *AuthHandler) handleSetup(c *gin.Context, users *services.UserService) {
 	token := c.PostForm("cf_token")
 	if token == "" {
 		c.Data(http.StatusBadRequest, "text/html", []byte("API token is required"))
 		return
 	}
 
+	username, password := strings.TrimSpace(c.PostForm("username")), c.PostForm("password")
+	if username == "" || password == "" {
+		c.Data(http.StatusBadRequest, "text/html", []byte("Admin username and password are required"))
+		return
+	}
+
 	if utils.VerifyCloudflareToken(token) {
 		// Check if Xanthus KV namespace exists, create if not
 		exists, accountID, err := utils.CheckKVNamespaceExists(token)
@@ -84,18 +116,45 @@ func (h *AuthHandler) HandleLogin(c *gin.Context) {
 			log.Println("✅ CSR already exists in KV")
 		}
 
-		// Valid token - proceed to main app (24 hours = 86400 seconds)
-		c.SetCookie("cf_token", token, 86400, "/", "", false, true)
-		c.Header("HX-Redirect", "/main")
-		c.Status(http.StatusOK)
+		user, err := users.Setup(token, accountID, username, password)
+		if err != nil {
+			log.Printf("Error setting up Xanthus: %v", err)
+			c.Data(http.StatusOK, "text/html", []byte(fmt.Sprintf("❌ Error creating admin account: %s", err.Error())))
+			return
+		}
+
+		// Valid token - proceed to main app
+		services.GetBackgroundAccounts().Register(token, accountID)
+		h.startSession(c, users, user)
 	} else {
 		c.Data(http.StatusOK, "text/html", []byte("❌ Invalid Cloudflare API token. Please check your token and try again."))
 	}
 }
 
-// HandleLogout clears authentication and redirects to login
+// startSession issues the session cookie and sends the browser to the main page
+func (h *AuthHandler) startSession(c *gin.Context, users *services.UserService, user *services.User) {
+	sessionID, _, err := users.CreateSession(user.Username)
+	if err != nil {
+		log.Printf("Error creating session: %v", err)
+		c.Data(http.StatusOK, "text/html", []byte("❌ Error creating session"))
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(services.SessionCookieName, sessionID, int(services.SessionTTL.Seconds()), "/", "", false, true)
+	c.Header("HX-Redirect", "/main")
+	c.Status(http.StatusOK)
+}
+
+// HandleLogout ends the session and redirects to login
 func (h *AuthHandler) HandleLogout(c *gin.Context) {
-	c.SetCookie("cf_token", "", -1, "/", "", false, true)
+	if sessionID, err := c.Cookie(services.SessionCookieName); err == nil && sessionID != "" {
+		if err := middleware.GetUserService().DeleteSession(sessionID); err != nil {
+			log.Printf("Error deleting session: %v", err)
+		}
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(services.SessionCookieName, "", -1, "/", "", false, true)
 	c.Redirect(http.StatusTemporaryRedirect, "/login")
 }
 
@@ -2,8 +2,6 @@ package handlers
 
 import (
 	"fmt"
-	"net/http"
-	"time"
 
 	"github.com/chrishham/xanthus/internal/services"
 	"github.com/chrishham/xanthus/internal/utils"
@@ -73,19 +71,15 @@ func (h *BaseHandler) getHetznerKey(c *gin.Context, token, accountID string) (st
 	return hetznerKey, true
 }
 
-// getSSHPrivateKey retrieves SSH private key from CSR config
+// getSSHPrivateKey retrieves the account's SSH private key
 func (h *BaseHandler) getSSHPrivateKey(c *gin.Context, token, accountID string) (string, bool) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		PrivateKey string `json:"private_key"`
-	}
-
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+	privateKey, err := services.NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
 		utils.JSONSSHKeyNotFound(c)
 		return "", false
 	}
 
-	return csrConfig.PrivateKey, true
+	return privateKey, true
 }
 
 // performServerAction is a generic helper for server power management actions
@@ -32,6 +32,13 @@ type CloudflareDomain struct {
 	Managed    bool   `json:"managed"`
 	CreatedOn  string `json:"created_on"`
 	ModifiedOn string `json:"modified_on"`
+
+	// Certificate of managed domains
+	Issuer         string `json:"issuer,omitempty"`
+	CertExpiresAt  string `json:"cert_expires_at,omitempty"`
+	CertDaysLeft   int    `json:"cert_days_left"`
+	CertRenewalDue bool   `json:"cert_renewal_due"`
+	RenewalError   string `json:"renewal_error,omitempty"`
 }
 
 // CloudflareDomainsResponse represents the API response for domain zones
@@ -46,16 +53,8 @@ type CloudflareDomainsResponse struct {
 
 // HandleDNSConfigPage renders the DNS configuration page
 func (h *DNSHandler) HandleDNSConfigPage(c *gin.Context) {
-	token, err := c.Cookie("cf_token")
-	if err != nil || !utils.VerifyCloudflareToken(token) {
-		c.Redirect(http.StatusTemporaryRedirect, "/login")
-		return
-	}
-
-	// Get account ID
-	_, accountID, err := utils.CheckKVNamespaceExists(token)
-	if err != nil {
-		c.Data(http.StatusOK, "text/html", []byte("❌ Error accessing account"))
+	token, accountID, valid := utils.ValidateTokenAndGetAccountHTML(c)
+	if !valid {
 		return
 	}
 
@@ -74,11 +73,7 @@ func (h *DNSHandler) HandleDNSConfigPage(c *gin.Context) {
 		log.Printf("Error fetching managed domains: %v", err)
 		// Continue without marking domains as managed
 	} else {
-		for i := range domains {
-			if _, exists := managedDomains[domains[i].Name]; exists {
-				domains[i].Managed = true
-			}
-		}
+		markManagedDomains(domains, managedDomains)
 	}
 
 	c.HTML(http.StatusOK, "dns-config.html", gin.H{
@@ -89,16 +84,8 @@ func (h *DNSHandler) HandleDNSConfigPage(c *gin.Context) {
 
 // HandleDNSList returns a JSON list of domains
 func (h *DNSHandler) HandleDNSList(c *gin.Context) {
-	token, err := c.Cookie("cf_token")
-	if err != nil || !utils.VerifyCloudflareToken(token) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
-		return
-	}
-
-	// Get account ID
-	_, accountID, err := utils.CheckKVNamespaceExists(token)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get account ID"})
+	token, accountID, valid := utils.ValidateTokenAndGetAccountJSON(c)
+	if !valid {
 		return
 	}
 
@@ -117,21 +104,41 @@ func (h *DNSHandler) HandleDNSList(c *gin.Context) {
 		log.Printf("Error fetching managed domains: %v", err)
 		// Continue without marking domains as managed
 	} else {
-		for i := range domains {
-			if _, exists := managedDomains[domains[i].Name]; exists {
-				domains[i].Managed = true
-			}
-		}
+		markManagedDomains(domains, managedDomains)
 	}
 
 	c.JSON(http.StatusOK, gin.H{"domains": domains})
 }
 
+// markManagedDomains flags the domains configured in Xanthus and adds their certificate status
+func markManagedDomains(domains []CloudflareDomain, managedDomains map[string]*services.DomainSSLConfig) {
+	renewal := services.GetCertRenewalService()
+	now := time.Now()
+
+	for i := range domains {
+		config, exists := managedDomains[domains[i].Name]
+		if !exists {
+			continue
+		}
+
+		domains[i].Managed = true
+		domains[i].Issuer = config.Issuer
+		if domains[i].Issuer == "" {
+			domains[i].Issuer = services.IssuerCloudflareOrigin
+		}
+		domains[i].RenewalError = config.RenewalError
+		domains[i].CertRenewalDue = renewal.NeedsRenewal(config, now)
+		if expiry, err := config.Expiry(); err == nil {
+			domains[i].CertExpiresAt = expiry.UTC().Format("2006-01-02")
+			domains[i].CertDaysLeft = int(expiry.Sub(now).Hours() / 24)
+		}
+	}
+}
+
 // HandleDNSConfigure handles the DNS configuration automation for a domain
 func (h *DNSHandler) HandleDNSConfigure(c *gin.Context) {
-	token, err := c.Cookie("cf_token")
-	if err != nil || !utils.VerifyCloudflareToken(token) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+	token, accountID, valid := utils.ValidateTokenAndGetAccountJSON(c)
+	if !valid {
 		return
 	}
 
@@ -141,13 +148,6 @@ func (h *DNSHandler) HandleDNSConfigure(c *gin.Context) {
 		return
 	}
 
-	// Get account ID
-	_, accountID, err := utils.CheckKVNamespaceExists(token)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get account ID"})
-		return
-	}
-
 	// Initialize services
 	cfService := services.NewCloudflareService()
 	kvService := services.NewKVService()
@@ -162,24 +162,55 @@ func (h *DNSHandler) HandleDNSConfigure(c *gin.Context) {
 		return
 	}
 
-	// Get CSR from KV
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		CSR        string `json:"csr"`
-		PrivateKey string `json:"private_key"`
-		CreatedAt  string `json:"created_at"`
-	}
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
-		log.Printf("Error getting CSR from KV: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "CSR not found. Please logout and login again."})
-		return
-	}
+	// Issue the certificate: Cloudflare origin certificate by default, or a publicly
+	// trusted ACME certificate, which is required for DNS only (unproxied) records
+	issuer := c.DefaultPostForm("issuer", services.IssuerCloudflareOrigin)
+	dnsOnly := c.PostForm("dns_only") == "true" || c.PostForm("dns_only") == "on"
+
+	var sslConfig *services.DomainSSLConfig
+	switch issuer {
+	case services.IssuerACME:
+		acmeService, err := services.LoadACMEService(kvService, token, accountID)
+		if err != nil {
+			log.Printf("Error loading ACME account: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load ACME account"})
+			return
+		}
 
-	// Configure SSL for the domain
-	sslConfig, err := cfService.ConfigureDomainSSL(token, domain, csrConfig.CSR, csrConfig.PrivateKey)
-	if err != nil {
-		log.Printf("Error configuring SSL for domain %s: %v", domain, err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("SSL configuration failed: %v", err)})
+		sslConfig, err = cfService.ConfigureDomainACME(c.Request.Context(), token, domain, acmeService, dnsOnly)
+		if err != nil {
+			log.Printf("Error configuring ACME certificate for domain %s: %v", domain, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("SSL configuration failed: %v", err)})
+			return
+		}
+	case services.IssuerCloudflareOrigin:
+		if dnsOnly {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "DNS only domains need a Let's Encrypt certificate"})
+			return
+		}
+
+		// Get CSR from KV
+		client := &http.Client{Timeout: 10 * time.Second}
+		var csrConfig struct {
+			CSR        string `json:"csr"`
+			PrivateKey string `json:"private_key"`
+			CreatedAt  string `json:"created_at"`
+		}
+		if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+			log.Printf("Error getting CSR from KV: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "CSR not found. Please logout and login again."})
+			return
+		}
+
+		// Configure SSL for the domain
+		sslConfig, err = cfService.ConfigureDomainSSL(token, domain, csrConfig.CSR, csrConfig.PrivateKey)
+		if err != nil {
+			log.Printf("Error configuring SSL for domain %s: %v", domain, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("SSL configuration failed: %v", err)})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown certificate issuer"})
 		return
 	}
 
@@ -198,11 +229,10 @@ func (h *DNSHandler) HandleDNSConfigure(c *gin.Context) {
 	})
 }
 
-// HandleDNSRemove handles removing DNS configuration for a domain
-func (h *DNSHandler) HandleDNSRemove(c *gin.Context) {
-	token, err := c.Cookie("cf_token")
-	if err != nil || !utils.VerifyCloudflareToken(token) {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+// HandleDNSRenew renews the certificate of a managed domain and installs it on its servers
+func (h *DNSHandler) HandleDNSRenew(c *gin.Context) {
+	token, accountID, valid := utils.ValidateTokenAndGetAccountJSON(c)
+	if !valid {
 		return
 	}
 
@@ -212,10 +242,35 @@ func (h *DNSHandler) HandleDNSRemove(c *gin.Context) {
 		return
 	}
 
-	// Get account ID
-	_, accountID, err := utils.CheckKVNamespaceExists(token)
+	if _, err := services.NewKVService().GetDomainSSLConfig(token, accountID, domain); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Domain configuration not found"})
+		return
+	}
+
+	config, err := services.GetCertRenewalService().RenewDomain(c.Request.Context(), token, accountID, domain)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get account ID"})
+		log.Printf("Error renewing certificate for domain %s: %v", domain, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Certificate renewal failed: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"message":    "Certificate renewed",
+		"expires_at": config.ExpiresAt,
+	})
+}
+
+// HandleDNSRemove handles removing DNS configuration for a domain
+func (h *DNSHandler) HandleDNSRemove(c *gin.Context) {
+	token, accountID, valid := utils.ValidateTokenAndGetAccountJSON(c)
+	if !valid {
+		return
+	}
+
+	domain := c.PostForm("domain")
+	if domain == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Domain is required"})
 		return
 	}
 
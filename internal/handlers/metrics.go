@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/middleware"
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler serves the metrics of the Xanthus server itself to Prometheus
+type MetricsHandler struct {
+	// Metrics read from the services when scraped; those counted as things
+	// happen are registered in utils.Metrics()
+	gauges *utils.MetricsRegistry
+}
+
+// NewMetricsHandler creates a metrics handler reporting the terminal sessions
+// of terminals and the version cache of versions
+func NewMetricsHandler(terminals *services.WebSocketTerminalService, versions services.EnhancedVersionService) *MetricsHandler {
+	gauges := utils.NewMetricsRegistry()
+	single := func(value float64) []utils.MetricSample { return []utils.MetricSample{{Value: value}} }
+
+	gauges.NewCollected("xanthus_ssh_connections_cached", "SSH connections kept open for reuse",
+		utils.KindGauge, nil, func() []utils.MetricSample { return single(float64(services.GetSSHPoolStats().Cached)) })
+	gauges.NewCollected("xanthus_ssh_dials_total", "SSH connections established",
+		utils.KindCounter, nil, func() []utils.MetricSample { return single(float64(services.GetSSHPoolStats().Dials)) })
+	gauges.NewCollected("xanthus_ssh_dial_failures_total", "SSH connections that could not be established",
+		utils.KindCounter, nil, func() []utils.MetricSample { return single(float64(services.GetSSHPoolStats().DialFailures)) })
+	gauges.NewCollected("xanthus_ssh_connection_reuses_total", "SSH commands served by a cached connection",
+		utils.KindCounter, nil, func() []utils.MetricSample { return single(float64(services.GetSSHPoolStats().Reuses)) })
+	gauges.NewCollected("xanthus_ssh_sessions_active", "Persistent SSH sessions of multi-step operations",
+		utils.KindGauge, nil, func() []utils.MetricSample {
+			return single(float64(services.GetGlobalSessionManager().GetActiveSessionCount()))
+		})
+	gauges.NewCollected("xanthus_terminal_sessions_active", "Open web terminal sessions",
+		utils.KindGauge, nil, func() []utils.MetricSample { return single(float64(terminals.GetActiveSessionCount())) })
+
+	// The account cache of the authentication middleware and the cache of the
+	// latest versions of catalog applications
+	caches := func(account string, version func(services.CacheStats) float64) func() []utils.MetricSample {
+		return func() []utils.MetricSample {
+			accounts := 0.0
+			switch value := middleware.GetCacheService().GetCacheStats()[account].(type) {
+			case int:
+				accounts = float64(value)
+			case int64:
+				accounts = float64(value)
+			}
+			return []utils.MetricSample{
+				{Value: accounts, Labels: []string{"accounts"}},
+				{Value: version(versions.GetCacheStats()), Labels: []string{"versions"}},
+			}
+		}
+	}
+	gauges.NewCollected("xanthus_cache_hits_total", "Cache lookups that found a fresh entry", utils.KindCounter, []string{"cache"},
+		caches("hits", func(s services.CacheStats) float64 { return float64(s.Hits) }))
+	gauges.NewCollected("xanthus_cache_misses_total", "Cache lookups that found no fresh entry", utils.KindCounter, []string{"cache"},
+		caches("misses", func(s services.CacheStats) float64 { return float64(s.Misses) }))
+	gauges.NewCollected("xanthus_cache_entries", "Entries in a cache, including expired ones not cleaned up yet", utils.KindGauge, []string{"cache"},
+		caches("total_entries", func(s services.CacheStats) float64 { return float64(s.Entries) }))
+
+	return &MetricsHandler{gauges: gauges}
+}
+
+// HandleMetrics writes every metric in the Prometheus text exposition format
+func (h *MetricsHandler) HandleMetrics(c *gin.Context) {
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	for _, registry := range []*utils.MetricsRegistry{utils.Metrics(), h.gauges} {
+		if err := registry.Write(c.Writer); err != nil {
+			log.Printf("Error writing metrics: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/chrishham/xanthus/internal/middleware"
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// UsersHandler contains dependencies for user management operations
+type UsersHandler struct {
+	// Add dependencies here as needed
+}
+
+// NewUsersHandler creates a new users handler instance
+func NewUsersHandler() *UsersHandler {
+	return &UsersHandler{}
+}
+
+// HandleUsersPage renders the user management page
+func (h *UsersHandler) HandleUsersPage(c *gin.Context) {
+	users, err := middleware.GetUserService().ListUsers()
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		c.HTML(http.StatusInternalServerError, "error.html", gin.H{"error": "Failed to load users"})
+		return
+	}
+
+	c.HTML(http.StatusOK, "users.html", gin.H{
+		"ActivePage":  "users",
+		"Users":       users,
+		"Roles":       services.Roles,
+		"CurrentUser": c.GetString("username"),
+	})
+}
+
+// HandleUsersCreate adds a user
+func (h *UsersHandler) HandleUsersCreate(c *gin.Context) {
+	user, err := middleware.GetUserService().CreateUser(c.PostForm("username"), c.PostForm("password"), c.PostForm("role"))
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	log.Printf("👤 %s created user %s (%s)", c.GetString("username"), user.Username, user.Role)
+	utils.JSONSuccess(c, "User created", gin.H{"username": user.Username, "role": user.Role})
+}
+
+// HandleUsersRole changes the role of a user
+func (h *UsersHandler) HandleUsersRole(c *gin.Context) {
+	user, err := middleware.GetUserService().SetRole(c.Param("username"), c.PostForm("role"))
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	log.Printf("👤 %s changed the role of %s to %s", c.GetString("username"), user.Username, user.Role)
+	utils.JSONSuccess(c, "Role updated", gin.H{"username": user.Username, "role": user.Role})
+}
+
+// HandleUsersPassword resets the password of a user
+func (h *UsersHandler) HandleUsersPassword(c *gin.Context) {
+	if err := middleware.GetUserService().SetPassword(c.Param("username"), c.PostForm("password")); err != nil {
+		respondUserError(c, err)
+		return
+	}
+	utils.JSONSuccessSimple(c, "Password reset")
+}
+
+// HandleUsersDelete removes a user
+func (h *UsersHandler) HandleUsersDelete(c *gin.Context) {
+	username := c.Param("username")
+	if username == c.GetString("username") {
+		utils.JSONBadRequest(c, "You can't delete your own account")
+		return
+	}
+
+	if err := middleware.GetUserService().DeleteUser(username); err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	log.Printf("👤 %s deleted user %s", c.GetString("username"), username)
+	utils.JSONSuccessSimple(c, "User deleted")
+}
+
+// HandleAccount returns the signed-in user
+func (h *UsersHandler) HandleAccount(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"username": c.GetString("username"),
+		"role":     c.GetString("role"),
+	})
+}
+
+// HandleAccountPassword changes the password of the signed-in user
+func (h *UsersHandler) HandleAccountPassword(c *gin.Context) {
+	users := middleware.GetUserService()
+	user, err := users.GetUser(c.GetString("username"))
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	if !user.CheckPassword(c.PostForm("current_password")) {
+		utils.JSONBadRequest(c, "Current password is incorrect")
+		return
+	}
+
+	if err := users.SetPassword(user.Username, c.PostForm("new_password")); err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	// Changing the password ends every session, so sign this browser in again
+	sessionID, _, err := users.CreateSession(user.Username)
+	if err != nil {
+		utils.JSONInternalServerError(c, "Password changed, but failed to renew the session")
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(services.SessionCookieName, sessionID, int(services.SessionTTL.Seconds()), "/", "", false, true)
+	utils.JSONSuccessSimple(c, "Password changed")
+}
+
+// respondUserError maps user service errors to HTTP responses
+func respondUserError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUserNotFound):
+		utils.JSONNotFound(c, err.Error())
+	case errors.Is(err, services.ErrUserExists), errors.Is(err, services.ErrLastAdmin):
+		utils.JSONError(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidUser):
+		utils.JSONBadRequest(c, err.Error())
+	default:
+		log.Printf("Error managing users: %v", err)
+		utils.JSONInternalServerError(c, "Failed to update users")
+	}
+}
@@ -95,25 +95,12 @@ func (h *VersionHandler) GetAvailableVersions(c *gin.Context) {
 		return
 	}
 
-	releases, err := h.fetchGitHubReleases()
+	availableReleases, err := h.AvailableReleases()
 	if err != nil {
 		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to fetch available versions: %v", err))
 		return
 	}
 
-	// Filter out drafts and sort by version
-	var availableReleases []GitHubRelease
-	for _, release := range releases {
-		if !release.Draft {
-			availableReleases = append(availableReleases, release)
-		}
-	}
-
-	// Sort by version (newest first)
-	sort.Slice(availableReleases, func(i, j int) bool {
-		return h.compareVersions(availableReleases[i].TagName, availableReleases[j].TagName) > 0
-	})
-
 	currentVersion := h.versionService.GetCurrentVersion()
 
 	versionInfo := VersionInfo{
@@ -172,11 +159,19 @@ func (h *VersionHandler) TriggerUpdate(c *gin.Context) {
 	}
 
 	// Start update process
-	go h.versionService.StartUpdate(token, accountID, req.Version, targetRelease.Body)
+	job, err := h.versionService.StartUpdateJob(services.GetJobManager(), token, accountID, req.Version)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Update already in progress",
+		})
+		return
+	}
 
+	c.Header(utils.JobIDHeader, job.ID)
 	c.JSON(http.StatusAccepted, gin.H{
 		"message": "Update started",
 		"version": req.Version,
+		"job_id":  job.ID,
 	})
 }
 
@@ -223,12 +218,48 @@ func (h *VersionHandler) RollbackVersion(c *gin.Context) {
 	}
 
 	// Start rollback process
-	go h.versionService.StartRollback(token, accountID, previousVersion)
+	job, err := h.versionService.StartRollbackJob(services.GetJobManager(), token, accountID, previousVersion)
+	if err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Cannot rollback while update is in progress",
+		})
+		return
+	}
 
+	c.Header(utils.JobIDHeader, job.ID)
 	c.JSON(http.StatusAccepted, gin.H{
 		"message": "Rollback started",
 		"version": previousVersion,
+		"job_id":  job.ID,
+	})
+}
+
+// SelfUpdateService returns the service tracking updates of this instance
+func (h *VersionHandler) SelfUpdateService() *services.SelfUpdateService {
+	return h.versionService
+}
+
+// AvailableReleases returns published (non-draft) releases, newest first
+func (h *VersionHandler) AvailableReleases() ([]GitHubRelease, error) {
+	releases, err := h.fetchGitHubReleases()
+	if err != nil {
+		return nil, err
+	}
+
+	// Filter out drafts and sort by version
+	var availableReleases []GitHubRelease
+	for _, release := range releases {
+		if !release.Draft {
+			availableReleases = append(availableReleases, release)
+		}
+	}
+
+	// Sort by version (newest first)
+	sort.Slice(availableReleases, func(i, j int) bool {
+		return h.compareVersions(availableReleases[i].TagName, availableReleases[j].TagName) > 0
 	})
+
+	return availableReleases, nil
 }
 
 // fetchGitHubReleases fetches releases from GitHub API
@@ -1,10 +1,7 @@
 package vps
 
 import (
-	"fmt"
 	"log"
-	"net/http"
-	"time"
 
 	"github.com/chrishham/xanthus/internal/services"
 	"github.com/chrishham/xanthus/internal/utils"
@@ -41,6 +38,13 @@ func (h *BaseHandler) validateTokenAndAccountHTML(c *gin.Context) (token, accoun
 	return utils.ValidateTokenAndGetAccountHTML(c)
 }
 
+// runJob runs fn as a job of the account and waits for it, naming the job in the X-Job-ID header
+func (h *BaseHandler) runJob(c *gin.Context, token, accountID string, spec services.JobSpec, fn services.JobFunc) error {
+	job, err := services.GetJobManager().Run(token, accountID, spec, fn)
+	c.Header(utils.JobIDHeader, job.ID)
+	return err
+}
+
 // getVPSConfig retrieves VPS configuration for a given server ID
 // Handles authentication, server ID parsing, and error responses
 func (h *BaseHandler) getVPSConfig(c *gin.Context, serverIDStr string) (*services.VPSConfig, bool) {
@@ -75,68 +79,13 @@ func (h *BaseHandler) getHetznerKey(c *gin.Context, token, accountID string) (st
 	return hetznerKey, true
 }
 
-// getSSHPrivateKey retrieves SSH private key from CSR config
+// getSSHPrivateKey retrieves the account's SSH private key
 func (h *BaseHandler) getSSHPrivateKey(c *gin.Context, token, accountID string) (string, bool) {
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		PrivateKey string `json:"private_key"`
-	}
-
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+	privateKey, err := services.NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
 		utils.JSONSSHKeyNotFound(c)
 		return "", false
 	}
 
-	return csrConfig.PrivateKey, true
-}
-
-// performServerAction is a generic helper for server power management actions
-func (h *BaseHandler) performServerAction(c *gin.Context, action string) {
-	token, accountID, valid := h.validateTokenAndAccount(c)
-	if !valid {
-		return
-	}
-
-	serverIDStr := c.PostForm("server_id")
-	serverID, err := utils.ParseServerID(serverIDStr)
-	if err != nil {
-		utils.JSONServerIDInvalid(c)
-		return
-	}
-
-	hetznerKey, valid := h.getHetznerKey(c, token, accountID)
-	if !valid {
-		return
-	}
-
-	var actionErr error
-	switch action {
-	case "poweroff":
-		actionErr = h.hetznerService.PowerOffServer(hetznerKey, serverID)
-	case "poweron":
-		actionErr = h.hetznerService.PowerOnServer(hetznerKey, serverID)
-	case "reboot":
-		actionErr = h.hetznerService.RebootServer(hetznerKey, serverID)
-	default:
-		utils.JSONBadRequest(c, "Invalid action")
-		return
-	}
-
-	if actionErr != nil {
-		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to perform %s: %v", action, actionErr))
-		return
-	}
-
-	// Convert action to past tense for response
-	actionText := action
-	switch action {
-	case "poweroff":
-		actionText = "powered off"
-	case "poweron":
-		actionText = "powered on"
-	case "reboot":
-		actionText = "rebooted"
-	}
-
-	utils.JSONVPSPowerActionSuccess(c, actionText, serverIDStr)
+	return privateKey, true
 }
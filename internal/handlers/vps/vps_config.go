@@ -59,7 +59,7 @@ func (h *VPSConfigHandler) HandleVPSConfigure(c *gin.Context) {
 	serverID, _ := utils.ParseServerID(serverIDStr)
 
 	// Connect to VPS and configure SSL
-	conn, err := h.sshService.ConnectToVPS(vpsConfig.PublicIPv4, vpsConfig.SSHUser, privateKey)
+	conn, err := h.sshService.ConnectToVPS(vpsConfig.SSHAddress(), vpsConfig.SSHUser, privateKey)
 	if err != nil {
 		utils.JSONInternalServerError(c, fmt.Sprintf("SSH connection failed: %v", err))
 		return
@@ -103,7 +103,7 @@ func (h *VPSConfigHandler) HandleVPSDeploy(c *gin.Context) {
 	serverID, _ := utils.ParseServerID(serverIDStr)
 
 	// Connect to VPS and deploy manifest
-	conn, err := h.sshService.ConnectToVPS(vpsConfig.PublicIPv4, vpsConfig.SSHUser, privateKey)
+	conn, err := h.sshService.ConnectToVPS(vpsConfig.SSHAddress(), vpsConfig.SSHUser, privateKey)
 	if err != nil {
 		utils.JSONInternalServerError(c, fmt.Sprintf("SSH connection failed: %v", err))
 		return
@@ -171,7 +171,7 @@ func (h *VPSConfigHandler) HandleVPSValidateKey(c *gin.Context) {
 	// Store the key
 	log.Printf("HandleVPSValidateKey: Storing API key for account %s", accountID)
 	client := &http.Client{Timeout: 10 * time.Second}
-	encryptedKey, err := utils.EncryptData(apiKey, token)
+	encryptedKey, err := utils.EncryptSecret(token, accountID, apiKey)
 	if err != nil {
 		log.Printf("HandleVPSValidateKey: Encryption failed for account %s: %v", accountID, err)
 		utils.JSONInternalServerError(c, "Failed to encrypt API key")
@@ -193,6 +193,60 @@ func (h *VPSConfigHandler) HandleVPSValidateKey(c *gin.Context) {
 	utils.JSONResponse(c, http.StatusOK, gin.H{"success": true})
 }
 
+// HandleDigitalOceanCheckKey checks if a DigitalOcean API token is configured
+func (h *VPSConfigHandler) HandleDigitalOceanCheckKey(c *gin.Context) {
+	token, accountID, valid := h.validateTokenAndAccount(c)
+	if !valid {
+		return
+	}
+
+	apiKey, err := utils.GetDigitalOceanAPIKey(token, accountID)
+	if err != nil || apiKey == "" {
+		utils.JSONResponse(c, http.StatusOK, gin.H{"exists": false})
+		return
+	}
+
+	// Mask the key for security (show only first 4 and last 4 characters)
+	maskedKey := ""
+	if len(apiKey) > 8 {
+		maskedKey = apiKey[:4] + "..." + apiKey[len(apiKey)-4:]
+	}
+
+	utils.JSONResponse(c, http.StatusOK, gin.H{
+		"exists":     true,
+		"masked_key": maskedKey,
+	})
+}
+
+// HandleDigitalOceanValidateKey validates and stores a DigitalOcean API token
+func (h *VPSConfigHandler) HandleDigitalOceanValidateKey(c *gin.Context) {
+	token, accountID, valid := h.validateTokenAndAccount(c)
+	if !valid {
+		return
+	}
+
+	apiKey := c.PostForm("key")
+	if apiKey == "" {
+		utils.JSONBadRequest(c, "API key is required")
+		return
+	}
+
+	if err := services.NewDigitalOceanService().ValidateAPIKey(c.Request.Context(), apiKey); err != nil {
+		log.Printf("HandleDigitalOceanValidateKey: Validation failed for account %s: %v", accountID, err)
+		utils.JSONBadRequest(c, "Invalid DigitalOcean API token")
+		return
+	}
+
+	if err := utils.SetDigitalOceanAPIKey(token, accountID, apiKey); err != nil {
+		log.Printf("HandleDigitalOceanValidateKey: Storing key failed for account %s: %v", accountID, err)
+		utils.JSONInternalServerError(c, "Failed to store API key")
+		return
+	}
+
+	log.Printf("✅ Stored DigitalOcean API token for account %s", accountID)
+	utils.JSONResponse(c, http.StatusOK, gin.H{"success": true})
+}
+
 // HandleSetupHetzner configures Hetzner API key in setup
 func (h *VPSConfigHandler) HandleSetupHetzner(c *gin.Context) {
 	token, accountID, valid := h.validateTokenAndAccountHTML(c)
@@ -224,7 +278,7 @@ func (h *VPSConfigHandler) HandleSetupHetzner(c *gin.Context) {
 
 	// Store encrypted Hetzner API key in KV
 	client := &http.Client{Timeout: 10 * time.Second}
-	encryptedKey, err := utils.EncryptData(hetznerKey, token)
+	encryptedKey, err := utils.EncryptSecret(token, accountID, hetznerKey)
 	if err != nil {
 		log.Printf("Error encrypting Hetzner key: %v", err)
 		c.Data(http.StatusOK, "text/html", []byte("❌ Error storing API key"))
@@ -259,7 +313,7 @@ func (h *VPSConfigHandler) HandleVPSGetTimezone(c *gin.Context) {
 	}
 
 	// Connect to VPS and get timezone
-	conn, err := h.sshService.ConnectToVPS(vpsConfig.PublicIPv4, vpsConfig.SSHUser, privateKey)
+	conn, err := h.sshService.ConnectToVPS(vpsConfig.SSHAddress(), vpsConfig.SSHUser, privateKey)
 	if err != nil {
 		utils.JSONInternalServerError(c, fmt.Sprintf("SSH connection failed: %v", err))
 		return
@@ -325,7 +379,7 @@ func (h *VPSConfigHandler) HandleVPSSetTimezone(c *gin.Context) {
 	serverID, _ := utils.ParseServerID(serverIDStr)
 
 	// Connect to VPS and set timezone
-	conn, err := h.sshService.ConnectToVPS(vpsConfig.PublicIPv4, vpsConfig.SSHUser, privateKey)
+	conn, err := h.sshService.ConnectToVPS(vpsConfig.SSHAddress(), vpsConfig.SSHUser, privateKey)
 	if err != nil {
 		utils.JSONInternalServerError(c, fmt.Sprintf("SSH connection failed: %v", err))
 		return
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"time"
 
 	"github.com/chrishham/xanthus/internal/models"
 	"github.com/chrishham/xanthus/internal/services"
@@ -70,7 +69,7 @@ func (h *VPSInfoHandler) HandleVPSStatus(c *gin.Context) {
 	serverID, _ := utils.ParseServerID(serverIDStr)
 
 	// Check VPS health via SSH
-	status, err := h.sshService.CheckVPSHealth(vpsConfig.PublicIPv4, vpsConfig.SSHUser, privateKey, serverID)
+	status, err := h.sshService.CheckVPSHealth(vpsConfig.SSHAddress(), vpsConfig.SSHUser, privateKey, serverID)
 	if err != nil {
 		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to check VPS status: %v", err))
 		return
@@ -109,7 +108,7 @@ func (h *VPSInfoHandler) HandleVPSLogs(c *gin.Context) {
 	serverID, _ := utils.ParseServerID(serverIDStr)
 
 	// Connect to VPS and get logs
-	logs, err := h.sshService.GetVPSLogs(vpsConfig.PublicIPv4, vpsConfig.SSHUser, privateKey, lines)
+	logs, err := h.sshService.GetVPSLogs(vpsConfig.SSHAddress(), vpsConfig.SSHUser, privateKey, lines)
 	if err != nil {
 		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to fetch logs: %v", err))
 		return
@@ -152,7 +151,7 @@ func (h *VPSInfoHandler) HandleK3sLogs(c *gin.Context) {
 	serverID, _ := utils.ParseServerID(serverIDStr)
 
 	// Connect to VPS and get K3s logs
-	logs, err := h.sshService.GetVPSK3sLogs(vpsConfig.PublicIPv4, vpsConfig.SSHUser, privateKey, lines)
+	logs, err := h.sshService.GetVPSK3sLogs(vpsConfig.SSHAddress(), vpsConfig.SSHUser, privateKey, lines)
 	if err != nil {
 		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to fetch K3s logs: %v", err))
 		return
@@ -185,7 +184,7 @@ func (h *VPSInfoHandler) HandleVPSInfo(c *gin.Context) {
 	serverID, _ := utils.ParseServerID(serverIDStr)
 
 	// Connect to VPS and get info file
-	conn, err := h.sshService.ConnectToVPS(vpsConfig.PublicIPv4, vpsConfig.SSHUser, privateKey)
+	conn, err := h.sshService.ConnectToVPS(vpsConfig.SSHAddress(), vpsConfig.SSHUser, privateKey)
 	if err != nil {
 		utils.JSONInternalServerError(c, fmt.Sprintf("SSH connection failed: %v", err))
 		return
@@ -199,11 +198,23 @@ func (h *VPSInfoHandler) HandleVPSInfo(c *gin.Context) {
 		return
 	}
 
-	utils.JSONResponse(c, http.StatusOK, gin.H{
+	response := gin.H{
 		"server_id": serverID,
 		"info":      info,
 		"config":    vpsConfig,
-	})
+	}
+	if membership, err := services.NewClusterService().Membership(token, accountID, vpsConfig); err != nil {
+		log.Printf("Warning: Could not determine the cluster of VPS %d: %v", serverID, err)
+	} else {
+		response["cluster"] = membership
+	}
+	if version, err := h.sshService.GetK3sVersion(conn); err != nil {
+		log.Printf("Warning: Could not get the K3s version of VPS %d: %v", serverID, err)
+	} else {
+		response["k3s_version"] = version
+	}
+
+	utils.JSONResponse(c, http.StatusOK, response)
 }
 
 // HandleVPSSSHKey returns SSH private key for VPS access
@@ -213,15 +224,9 @@ func (h *VPSInfoHandler) HandleVPSSSHKey(c *gin.Context) {
 		return
 	}
 
-	// Get CSR configuration which contains the SSH private key
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		CSR        string `json:"csr"`
-		PrivateKey string `json:"private_key"`
-		CreatedAt  string `json:"created_at"`
-	}
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
-		log.Printf("Error getting CSR config: %v", err)
+	privateKey, err := services.NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
+		log.Printf("Error getting SSH key: %v", err)
 		utils.JSONSSHKeyNotFound(c)
 		return
 	}
@@ -231,13 +236,13 @@ func (h *VPSInfoHandler) HandleVPSSSHKey(c *gin.Context) {
 	if download == "true" {
 		c.Header("Content-Type", "application/octet-stream")
 		c.Header("Content-Disposition", "attachment; filename=xanthus-key.pem")
-		c.String(http.StatusOK, csrConfig.PrivateKey)
+		c.String(http.StatusOK, privateKey)
 		return
 	}
 
 	// Return SSH private key and usage instructions
 	utils.JSONResponse(c, http.StatusOK, gin.H{
-		"private_key": csrConfig.PrivateKey,
+		"private_key": privateKey,
 		"instructions": map[string]interface{}{
 			"save_to_file":    "Save the private key to a file (e.g., ~/.ssh/xanthus-key.pem)",
 			"set_permissions": "chmod 600 ~/.ssh/xanthus-key.pem",
@@ -282,7 +287,7 @@ func (h *VPSInfoHandler) HandleVPSTerminal(c *gin.Context) {
 
 	// Create terminal session
 	terminalService := services.NewTerminalService()
-	session, err := terminalService.CreateSession(serverID, vpsConfig.PublicIPv4, resolvedSSHUser, privateKey)
+	session, err := terminalService.CreateSession(serverID, vpsConfig.SSHAddress(), resolvedSSHUser, privateKey)
 	if err != nil {
 		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to create terminal session: %v", err))
 		return
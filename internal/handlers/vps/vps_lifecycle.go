@@ -1,6 +1,8 @@
 package vps
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -26,157 +28,117 @@ func NewVPSLifecycleHandler() *VPSLifecycleHandler {
 	}
 }
 
-// HandleVPSCreate creates a new VPS instance on Hetzner Cloud with K3s setup
+// HandleVPSCreate creates a new server with K3s setup on any supported provider.
+// Accepts a form or JSON body; provider defaults to Hetzner.
 func (h *VPSLifecycleHandler) HandleVPSCreate(c *gin.Context) {
 	token, accountID, valid := h.validateTokenAndAccount(c)
 	if !valid {
 		return
 	}
 
-	// Validate required parameters
-	name := c.PostForm("name")
-	location := c.PostForm("location")
-	serverType := c.PostForm("server_type")
-
-	if name == "" {
-		utils.JSONBadRequest(c, "Server name is required")
-		return
-	}
-	if location == "" {
-		utils.JSONBadRequest(c, "Server location is required")
-		return
-	}
-	if serverType == "" {
-		utils.JSONBadRequest(c, "Server type is required")
-		return
-	}
-
-	// Get Hetzner API key
-	log.Printf("VPS Create: Attempting to retrieve Hetzner API key for account %s", accountID)
-	hetznerKey, valid := h.getHetznerKey(c, token, accountID)
-	if !valid {
-		log.Printf("VPS Create: Failed to retrieve Hetzner API key for account %s", accountID)
+	var req struct {
+		Provider   string  `form:"provider" json:"provider"`
+		Name       string  `form:"name" json:"name"`
+		Location   string  `form:"location" json:"location"`
+		ServerType string  `form:"server_type" json:"server_type"`
+		Timezone   string  `form:"timezone" json:"timezone"`
+		OCPU       float32 `form:"ocpu" json:"ocpu"`           // CPU count for flexible shapes
+		Memory     float32 `form:"memory" json:"memory"`       // Memory in GB for flexible shapes
+		OCIToken   string  `form:"oci_token" json:"oci_token"` // Optional - for first-time OCI setup
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		utils.JSONBadRequest(c, "Invalid request data: "+err.Error())
 		return
 	}
-	log.Printf("VPS Create: Successfully retrieved Hetzner API key for account %s", accountID)
 
-	// Get SSL CSR configuration
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		CSR        string `json:"csr"`
-		PrivateKey string `json:"private_key"`
-		CreatedAt  string `json:"created_at"`
+	provider, ok := services.CanonicalProviderName(req.Provider)
+	if req.Provider == "" {
+		provider, ok = services.ProviderHetzner, true
 	}
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
-		log.Printf("Error getting CSR from KV: %v", err)
-		utils.JSONInternalServerError(c, "SSL CSR configuration not found. Please logout and login again.")
+	if !ok {
+		utils.JSONBadRequest(c, fmt.Sprintf("Unsupported provider: %s", req.Provider))
 		return
 	}
 
-	// Convert CSR private key to SSH public key
-	sshPublicKey, err := h.cfService.ConvertPrivateKeyToSSH(csrConfig.PrivateKey)
-	if err != nil {
-		log.Printf("Error converting private key to SSH: %v", err)
-		utils.JSONInternalServerError(c, "Failed to generate SSH key from CSR")
+	if req.Name == "" {
+		utils.JSONBadRequest(c, "Server name is required")
 		return
 	}
-
-	// Validate SSH public key format
-	if !strings.HasPrefix(sshPublicKey, "ssh-rsa ") {
-		keyPreview := sshPublicKey
-		if len(keyPreview) > 50 {
-			keyPreview = keyPreview[:50] + "..."
+	if provider == services.ProviderHetzner {
+		if req.Location == "" {
+			utils.JSONBadRequest(c, "Server location is required")
+			return
+		}
+		if req.ServerType == "" {
+			utils.JSONBadRequest(c, "Server type is required")
+			return
 		}
-		log.Printf("Invalid SSH public key format: %s", keyPreview)
-		utils.JSONInternalServerError(c, "Generated SSH key has invalid format")
-		return
-	}
-	log.Printf("✅ Generated SSH public key (length: %d)", len(sshPublicKey))
-
-	// Create or find SSH key in Hetzner Cloud
-	sshKeyName := fmt.Sprintf("xanthus-key-%d", time.Now().Unix())
-	sshKey, err := h.hetznerService.CreateOrFindSSHKey(hetznerKey, sshKeyName, sshPublicKey)
-	if err != nil {
-		log.Printf("Error creating/finding SSH key in Hetzner: %v", err)
-		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to create SSH key in Hetzner Cloud: %v", err))
-		return
 	}
 
-	// Use the actual key name from the found/created key
-	sshKeyName = sshKey.Name
-	log.Printf("✅ Using SSH key: %s (ID: %d)", sshKeyName, sshKey.ID)
-
-	// SSL certificates will be configured when applications are deployed
-	var domainCert, domainKey string
-	log.Printf("✅ VPS will be created without SSL certificates. SSL will be configured during application deployment")
-
-	// Get server type pricing information
-	serverTypes, err := utils.FetchHetznerServerTypes(hetznerKey)
-	if err != nil {
-		log.Printf("Warning: Could not fetch server types for pricing: %v", err)
-	}
-
-	var hourlyRate, monthlyRate float64
-	for _, st := range serverTypes {
-		if st.Name == serverType {
-			if len(st.Prices) > 0 {
-				// Use gross prices (including VAT)
-				if hourlyGross := st.Prices[0].PriceHourly.Gross; hourlyGross != "" {
-					if _, err := fmt.Sscanf(hourlyGross, "%f", &hourlyRate); err == nil {
-						// Add IPv4 cost: €0.50/month = €0.00069444/hour (30.41 days avg per month)
-						hourlyRate += 0.50 / (30.41 * 24)
-					}
-				}
-				if monthlyGross := st.Prices[0].PriceMonthly.Gross; monthlyGross != "" {
-					if _, err := fmt.Sscanf(monthlyGross, "%f", &monthlyRate); err == nil {
-						// Add IPv4 cost
-						monthlyRate += 0.50
-					}
-				}
+	// Store a first-time OCI auth token so the provider can be created from KV
+	if provider == services.ProviderOCI && req.OCIToken != "" {
+		if _, err := utils.GetOCIAuthToken(token, accountID); err != nil {
+			log.Printf("VPS Create: No existing OCI token found, storing provided token for account %s", accountID)
+			if err := utils.SetOCIAuthToken(token, accountID, req.OCIToken); err != nil {
+				utils.JSONInternalServerError(c, fmt.Sprintf("Failed to store OCI auth token: %v", err))
+				return
 			}
-			break
 		}
 	}
 
-	// Create VPS using the VPS service
-	server, vpsConfig, err := h.vpsService.CreateVPSWithConfig(
-		token, accountID, hetznerKey,
-		name, serverType, location, "",
-		sshKeyName, sshPublicKey,
-		domainCert, domainKey,
-		hourlyRate, monthlyRate,
-	)
+	log.Printf("VPS Create: Creating %s server %s (%s in %s)", provider, req.Name, req.ServerType, req.Location)
+	var server *services.CloudServer
+	var vpsConfig *services.VPSConfig
+	err := h.runJob(c, token, accountID, services.JobSpec{Type: services.JobTypeVPSCreate, Target: req.Name}, func(ctx context.Context) error {
+		var err error
+		server, vpsConfig, err = h.vpsService.CreateServer(ctx, token, accountID, provider, services.CloudServerRequest{
+			Name:       req.Name,
+			ServerType: req.ServerType,
+			Location:   req.Location,
+			Timezone:   req.Timezone,
+			CPUs:       req.OCPU,
+			MemoryGB:   req.Memory,
+		})
+		return err
+	})
+	if provider == services.ProviderHetzner {
+		// Clean up temporary Hetzner key cache whether or not creation succeeded
+		utils.ClearTempHetznerKey(accountID)
+	}
 	if err != nil {
 		log.Printf("Error creating server: %v", err)
 
 		// Check for specific error types and provide user-friendly messages
 		errorStr := err.Error()
-		if strings.Contains(errorStr, "server name is already used") || strings.Contains(errorStr, "uniqueness_error") {
-			utils.ClearTempHetznerKey(accountID) // Clean up on error
+		switch {
+		case errors.Is(err, services.ErrInvalidServerRequest):
+			utils.JSONBadRequest(c, errorStr)
+		case strings.Contains(errorStr, "server name is already used") || strings.Contains(errorStr, "uniqueness_error"):
 			c.JSON(http.StatusConflict, gin.H{"error": "A server with this name already exists. Please choose a different name."})
-			return
+		default:
+			utils.JSONInternalServerError(c, fmt.Sprintf("Failed to create server: %v", err))
 		}
-
-		// Generic error for other cases
-		utils.ClearTempHetznerKey(accountID) // Clean up on error
-		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to create server: %v", err))
 		return
 	}
 
-	// DNS records will be configured when applications are deployed
-	log.Printf("✅ VPS created successfully. DNS records will be configured during application deployment")
-
-	log.Printf("✅ Created server: %s (ID: %d) with IPv4: %s", server.Name, server.ID, server.PublicNet.IPv4.IP)
+	// Invalidate VPS cache to ensure immediate UI update
+	h.vpsService.InvalidateVPSCache(accountID)
 
-	// Clean up temporary Hetzner key cache after successful VPS creation
-	utils.ClearTempHetznerKey(accountID)
-	log.Printf("Cleaned up temporary Hetzner key cache for account %s", accountID)
+	log.Printf("✅ Created %s server: %s (ID: %d) with IPv4: %s", provider, server.Name, server.ID, server.PublicIPv4)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "Server created successfully with K3s and Helm. DNS will be configured when applications are deployed",
-		"server":  server,
-		"config":  vpsConfig,
+		"server": gin.H{
+			"id":   server.ID,
+			"name": server.Name,
+			"public_net": gin.H{
+				"ipv4": gin.H{
+					"ip": server.PublicIPv4,
+				},
+			},
+		},
+		"config": vpsConfig,
 	})
 }
 
@@ -194,29 +156,23 @@ func (h *VPSLifecycleHandler) HandleVPSDelete(c *gin.Context) {
 		return
 	}
 
-	// Get Hetzner API key
-	hetznerKey, valid := h.getHetznerKey(c, token, accountID)
-	if !valid {
-		return
-	}
-
 	// Delete VPS and cleanup using VPS service
-	vpsConfig, err := h.vpsService.DeleteVPSAndCleanup(token, accountID, hetznerKey, serverID)
+	var vpsConfig *services.VPSConfig
+	err = h.runJob(c, token, accountID, services.JobSpec{Type: services.JobTypeVPSDelete, Target: serverIDStr}, func(ctx context.Context) error {
+		var err error
+		vpsConfig, err = h.vpsService.DeleteServer(ctx, token, accountID, serverID)
+		return err
+	})
 	if err != nil {
 		log.Printf("Error deleting server %d: %v", serverID, err)
 		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to delete server: %v", err))
 		return
 	}
 
-	serverName := fmt.Sprintf("Server %d", serverID)
-	if vpsConfig != nil {
-		serverName = vpsConfig.Name
-	}
-
 	// Invalidate VPS cache to ensure immediate UI update
 	h.vpsService.InvalidateVPSCache(accountID)
 
-	log.Printf("✅ Deleted server: %s (ID: %d) and cleaned up configuration", serverName, serverID)
+	log.Printf("✅ Deleted server: %s (ID: %d) and cleaned up configuration", vpsConfig.Name, serverID)
 	utils.VPSDeletionSuccess(c)
 }
 
@@ -227,24 +183,10 @@ func (h *VPSLifecycleHandler) HandleSSHKey(c *gin.Context) {
 		return
 	}
 
-	// Get SSL CSR configuration which contains the private key
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		CSR        string `json:"csr"`
-		PrivateKey string `json:"private_key"`
-		CreatedAt  string `json:"created_at"`
-	}
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
-		log.Printf("Error getting CSR from KV: %v", err)
-		utils.JSONInternalServerError(c, "SSL CSR configuration not found. Please logout and login again.")
-		return
-	}
-
-	// Convert CSR private key to SSH public key
-	sshPublicKey, err := h.cfService.ConvertPrivateKeyToSSH(csrConfig.PrivateKey)
+	sshPublicKey, err := services.NewSSHKeyService().PublicKey(token, accountID)
 	if err != nil {
-		log.Printf("Error converting private key to SSH: %v", err)
-		utils.JSONInternalServerError(c, "Failed to generate SSH key from CSR")
+		log.Printf("Error getting SSH key: %v", err)
+		utils.JSONInternalServerError(c, "Failed to get the SSH key")
 		return
 	}
 
@@ -280,35 +222,33 @@ func (h *VPSLifecycleHandler) HandleAddOCI(c *gin.Context) {
 		return
 	}
 
-	// Get SSH private key for connection
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		CSR        string `json:"csr"`
-		PrivateKey string `json:"private_key"`
-		CreatedAt  string `json:"created_at"`
-	}
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
-		log.Printf("Error getting CSR from KV: %v", err)
-		utils.JSONInternalServerError(c, "SSL CSR configuration not found. Please logout and login again.")
-		return
-	}
-
-	// Convert to SSH public key for validation
-	sshPublicKey, err := h.cfService.ConvertPrivateKeyToSSH(csrConfig.PrivateKey)
+	// Get the SSH keypair for the connection
+	sshKey, err := services.NewSSHKeyService().KeyPair(token, accountID)
 	if err != nil {
-		log.Printf("Error converting private key to SSH: %v", err)
-		utils.JSONInternalServerError(c, "Failed to generate SSH key from CSR")
+		log.Printf("Error getting SSH key: %v", err)
+		utils.JSONInternalServerError(c, "Failed to get the SSH key")
 		return
 	}
 
 	// Generate a mock server ID for OCI (using timestamp)
 	serverID := int(time.Now().Unix())
 
+	// Record the OCID of the instance when OCI credentials are configured, so
+	// the reconciler and rebuilds don't have to find it by name or IP
+	instanceID := ""
+	if provider, err := services.NewCloudProvider(services.ProviderOCI, token, accountID); err == nil {
+		if oci, ok := provider.(*services.OCIProvider); ok {
+			if instanceID, err = oci.FindInstanceID(c.Request.Context(), req.Name, req.PublicIP); err != nil {
+				log.Printf("Warning: could not look up the OCID of %s: %v", req.Name, err)
+			}
+		}
+	}
+
 	// Create VPS config for OCI instance
 	vpsConfig, err := h.vpsService.CreateOCIVPSConfig(
 		token, accountID,
-		req.Name, req.PublicIP, req.Username, req.Shape,
-		serverID, csrConfig.PrivateKey, sshPublicKey,
+		req.Name, req.PublicIP, req.Username, req.Shape, instanceID,
+		serverID, sshKey.PrivateKey, sshKey.PublicKey,
 	)
 	if err != nil {
 		log.Printf("Error creating OCI VPS config: %v", err)
@@ -334,368 +274,144 @@ func (h *VPSLifecycleHandler) HandleAddOCI(c *gin.Context) {
 	})
 }
 
-// HandleVPSPowerOff powers off a VPS instance
-func (h *VPSLifecycleHandler) HandleVPSPowerOff(c *gin.Context) {
-	h.performServerAction(c, "poweroff")
-}
-
-// HandleVPSPowerOn powers on a VPS instance
-func (h *VPSLifecycleHandler) HandleVPSPowerOn(c *gin.Context) {
-	h.performServerAction(c, "poweron")
-}
-
-// HandleVPSReboot reboots a VPS instance
-func (h *VPSLifecycleHandler) HandleVPSReboot(c *gin.Context) {
-	h.performServerAction(c, "reboot")
-}
-
-// HandleOCICreate creates a new OCI compute instance with K3s setup
-func (h *VPSLifecycleHandler) HandleOCICreate(c *gin.Context) {
+// HandleAddExisting adds a server Xanthus didn't create (provider Manual) by its SSH address
+func (h *VPSLifecycleHandler) HandleAddExisting(c *gin.Context) {
 	token, accountID, valid := h.validateTokenAndAccount(c)
 	if !valid {
 		return
 	}
 
-	// Parse request data
 	var req struct {
-		Name     string  `json:"name" binding:"required"`
-		Shape    string  `json:"shape" binding:"required"`
-		Region   string  `json:"region"`
-		Timezone string  `json:"timezone"`
-		OCPU     float32 `json:"ocpu"`      // OCPU count for flexible shapes
-		Memory   float32 `json:"memory"`    // Memory in GB for flexible shapes
-		OCIToken string  `json:"oci_token"` // Optional - for first-time setup
-	}
-
-	if err := c.ShouldBindJSON(&req); err != nil {
-		utils.JSONBadRequest(c, "Invalid request data: "+err.Error())
-		return
-	}
-
-	// Set defaults for OCPU and Memory if not provided
-	if req.OCPU == 0 {
-		req.OCPU = 1.0 // Default to 1 OCPU
-	}
-	if req.Memory == 0 {
-		req.Memory = 6.0 // Default to 6GB
-	}
-
-	// Validate Always Free tier limits for VM.Standard.A1.Flex
-	if req.Shape == "VM.Standard.A1.Flex" {
-		if req.OCPU > 4 {
-			utils.JSONBadRequest(c, "OCPU count cannot exceed 4 for Always Free tier (VM.Standard.A1.Flex)")
-			return
-		}
-		if req.Memory > 24 {
-			utils.JSONBadRequest(c, "Memory cannot exceed 24GB for Always Free tier (VM.Standard.A1.Flex)")
-			return
-		}
-		if req.OCPU < 1 {
-			utils.JSONBadRequest(c, "OCPU count must be at least 1")
-			return
-		}
-		if req.Memory < 1 {
-			utils.JSONBadRequest(c, "Memory must be at least 1GB")
-			return
-		}
-	}
-
-	// Get or store OCI auth token
-	var ociToken string
-	var err error
-
-	// First try to get existing token from KV store
-	ociToken, err = utils.GetOCIAuthToken(token, accountID)
+		Name     string `form:"name" json:"name" binding:"required"`
+		Host     string `form:"host" json:"host" binding:"required"`
+		SSHUser  string `form:"ssh_user" json:"ssh_user"`
+		SSHPort  int    `form:"ssh_port" json:"ssh_port"`
+		Password string `form:"password" json:"password"`
+		Timezone string `form:"timezone" json:"timezone"`
+	}
+	if err := c.ShouldBind(&req); err != nil {
+		utils.JSONBadRequest(c, "Name and host are required")
+		return
+	}
+
+	var vpsConfig *services.VPSConfig
+	err := h.runJob(c, token, accountID, services.JobSpec{Type: services.JobTypeVPSAdd, Target: req.Name}, func(ctx context.Context) error {
+		var err error
+		vpsConfig, err = h.vpsService.AddExistingServer(ctx, token, accountID, services.ExistingServerRequest{
+			Name:     req.Name,
+			Host:     req.Host,
+			SSHUser:  req.SSHUser,
+			SSHPort:  req.SSHPort,
+			Password: req.Password,
+			Timezone: req.Timezone,
+		})
+		return err
+	})
 	if err != nil {
-		// If no existing token and one is provided in request, store and use it
-		if req.OCIToken != "" {
-			log.Printf("OCI Create: No existing token found, storing provided token for account %s", accountID)
-			if storeErr := utils.SetOCIAuthToken(token, accountID, req.OCIToken); storeErr != nil {
-				log.Printf("OCI Create: Failed to store OCI auth token for account %s: %v", accountID, storeErr)
-				utils.JSONInternalServerError(c, fmt.Sprintf("Failed to store OCI auth token: %v", storeErr))
-				return
-			}
-			ociToken = req.OCIToken
-			log.Printf("✅ Stored OCI auth token for account %s for future reuse", accountID)
+		log.Printf("Error adding server %s (%s): %v", req.Name, req.Host, err)
+		if errors.Is(err, services.ErrInvalidServerRequest) {
+			utils.JSONBadRequest(c, err.Error())
 		} else {
-			log.Printf("OCI Create: Failed to retrieve OCI auth token for account %s: %v", accountID, err)
-			utils.JSONInternalServerError(c, "OCI auth token not found. Please provide oci_token in the request or configure your OCI credentials first.")
-			return
+			utils.JSONInternalServerError(c, fmt.Sprintf("Failed to add server: %v", err))
 		}
-	} else {
-		log.Printf("✅ Reusing existing OCI auth token for account %s", accountID)
-	}
-
-	// Create OCI service
-	ociService, err := services.NewOCIService(ociToken)
-	if err != nil {
-		log.Printf("OCI Create: Failed to create OCI service: %v", err)
-		utils.JSONInternalServerError(c, "Failed to initialize OCI service")
-		return
-	}
-
-	// Test connection
-	ctx := c.Request.Context()
-	if err := ociService.TestConnection(ctx); err != nil {
-		log.Printf("OCI Create: Connection test failed: %v", err)
-		utils.JSONInternalServerError(c, "Failed to connect to OCI")
-		return
-	}
-
-	// Get SSH keys
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		CSR        string `json:"csr"`
-		PrivateKey string `json:"private_key"`
-		CreatedAt  string `json:"created_at"`
-	}
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
-		log.Printf("Error getting CSR from KV: %v", err)
-		utils.JSONInternalServerError(c, "SSL CSR configuration not found. Please logout and login again.")
 		return
 	}
 
-	// Convert to SSH public key
-	sshPublicKey, err := h.cfService.ConvertPrivateKeyToSSH(csrConfig.PrivateKey)
-	if err != nil {
-		log.Printf("Error converting private key to SSH: %v", err)
-		utils.JSONInternalServerError(c, "Failed to generate SSH key from CSR")
-		return
-	}
-
-	// Use default timezone if not provided
-	timezone := req.Timezone
-	if timezone == "" {
-		timezone = "UTC"
-	}
-
-	// Create VPS with K3s using OCI service
-	log.Printf("Creating OCI instance: %s with shape %s (%v OCPU, %v GB RAM)", req.Name, req.Shape, req.OCPU, req.Memory)
-	ociInstance, err := ociService.CreateVPSWithK3s(ctx, req.Name, req.Shape, sshPublicKey, timezone, req.OCPU, req.Memory)
-	if err != nil {
-		log.Printf("Error creating OCI instance: %v", err)
-		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to create OCI instance: %v", err))
-		return
-	}
-
-	// Create VPS config in KV store
-	serverID := int(time.Now().Unix()) // Generate unique ID
-	vpsConfig, err := h.vpsService.CreateOCIVPSConfig(
-		token, accountID,
-		ociInstance.DisplayName, ociInstance.PublicIP, "ubuntu", ociInstance.Shape,
-		serverID, csrConfig.PrivateKey, sshPublicKey,
-	)
-	if err != nil {
-		log.Printf("Error creating OCI VPS config: %v", err)
-		// Instance was created but config failed - log this for cleanup
-		log.Printf("WARNING: OCI instance %s (%s) was created but config storage failed", ociInstance.ID, ociInstance.PublicIP)
-		utils.JSONInternalServerError(c, "Instance created but configuration storage failed")
-		return
-	}
-
-	// Also store the OCI instance ID for future management
-	vpsConfig.ProviderInstanceID = ociInstance.ID
-	if err := h.vpsService.UpdateVPSConfig(token, accountID, serverID, vpsConfig); err != nil {
-		log.Printf("Warning: Failed to update VPS config with OCI instance ID: %v", err)
-	}
-
-	log.Printf("✅ Created OCI instance: %s (ID: %s) with IP: %s", ociInstance.DisplayName, ociInstance.ID, ociInstance.PublicIP)
+	h.vpsService.InvalidateVPSCache(accountID)
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "OCI instance created successfully with K3s and Helm",
+		"message": "Server added successfully. K3s setup is running in the background.",
 		"server": gin.H{
-			"id":     serverID,
-			"name":   ociInstance.DisplayName,
-			"oci_id": ociInstance.ID,
+			"id":   vpsConfig.ServerID,
+			"name": vpsConfig.Name,
 			"public_net": gin.H{
 				"ipv4": gin.H{
-					"ip": ociInstance.PublicIP,
+					"ip": vpsConfig.PublicIPv4,
 				},
 			},
-			"lifecycle_state":     ociInstance.LifecycleState,
-			"shape":               ociInstance.Shape,
-			"availability_domain": ociInstance.AvailabilityDomain,
 		},
 		"config": vpsConfig,
 	})
 }
 
-// HandleOCIDelete deletes an OCI instance and cleans up configuration
-func (h *VPSLifecycleHandler) HandleOCIDelete(c *gin.Context) {
-	token, accountID, valid := h.validateTokenAndAccount(c)
-	if !valid {
-		return
-	}
-
-	serverIDStr := c.PostForm("server_id")
-	serverID, err := utils.ParseServerID(serverIDStr)
-	if err != nil {
-		utils.JSONServerIDInvalid(c)
-		return
-	}
-
-	// Get VPS config to get the OCI instance ID
-	vpsConfig, err := h.vpsService.GetVPSConfig(token, accountID, serverID)
-	if err != nil {
-		log.Printf("Error getting VPS config for deletion: %v", err)
-		utils.JSONInternalServerError(c, "Failed to get VPS configuration")
-		return
-	}
-
-	// Verify it's an OCI instance
-	if vpsConfig.Provider != "oci" && vpsConfig.Provider != "OCI" && vpsConfig.Provider != "Oracle Cloud Infrastructure (OCI)" {
-		utils.JSONBadRequest(c, "This endpoint is only for OCI instances")
-		return
-	}
-
-	// Get OCI auth token
-	ociToken, err := utils.GetOCIAuthToken(token, accountID)
-	if err != nil {
-		log.Printf("OCI Delete: Failed to retrieve OCI auth token: %v", err)
-		// Still try to clean up local config even if we can't delete the instance
-		log.Printf("Cleaning up local configuration for server %d", serverID)
-		if err := h.vpsService.DeleteVPSConfig(token, accountID, serverID); err != nil {
-			log.Printf("Error cleaning up VPS config: %v", err)
-		}
-		utils.JSONInternalServerError(c, "OCI auth token not found, but local configuration cleaned up")
-		return
-	}
-
-	// Create OCI service
-	ociService, err := services.NewOCIService(ociToken)
-	if err != nil {
-		log.Printf("OCI Delete: Failed to create OCI service: %v", err)
-		utils.JSONInternalServerError(c, "Failed to initialize OCI service")
-		return
-	}
-
-	ctx := c.Request.Context()
-
-	// Delete the OCI instance if we have the instance ID
-	if vpsConfig.ProviderInstanceID != "" {
-		log.Printf("Deleting OCI instance: %s", vpsConfig.ProviderInstanceID)
-		if err := ociService.DeleteVPSWithCleanup(ctx, vpsConfig.ProviderInstanceID, false); err != nil {
-			// Check if it's a 404 error (instance not found)
-			if strings.Contains(err.Error(), "not_found") || strings.Contains(err.Error(), "404") {
-				log.Printf("OCI instance %s not found (already deleted), continuing with local cleanup", vpsConfig.ProviderInstanceID)
-			} else {
-				log.Printf("Error deleting OCI instance %s: %v", vpsConfig.ProviderInstanceID, err)
-			}
-			// Continue with local cleanup even if cloud deletion fails
-		} else {
-			log.Printf("✅ Deleted OCI instance: %s", vpsConfig.ProviderInstanceID)
-		}
-	} else {
-		log.Printf("Warning: No OCI instance ID found for server %d, skipping cloud deletion", serverID)
-	}
-
-	// Clean up local configuration
-	if err := h.vpsService.DeleteVPSConfig(token, accountID, serverID); err != nil {
-		log.Printf("Error cleaning up VPS config: %v", err)
-		utils.JSONInternalServerError(c, "Failed to clean up VPS configuration")
-		return
-	}
-
-	// Invalidate VPS cache to ensure immediate UI update
-	h.vpsService.InvalidateVPSCache(accountID)
-
-	log.Printf("✅ Deleted OCI instance and cleaned up configuration for server: %s (ID: %d)", vpsConfig.Name, serverID)
-	utils.VPSDeletionSuccess(c)
-}
-
-// HandleOCIPowerOff powers off an OCI instance
-func (h *VPSLifecycleHandler) HandleOCIPowerOff(c *gin.Context) {
-	h.performOCIServerAction(c, "poweroff")
+// HandleVPSPowerOff powers off a VPS instance
+func (h *VPSLifecycleHandler) HandleVPSPowerOff(c *gin.Context) {
+	h.performServerAction(c, services.PowerActionOff)
 }
 
-// HandleOCIPowerOn powers on an OCI instance
-func (h *VPSLifecycleHandler) HandleOCIPowerOn(c *gin.Context) {
-	h.performOCIServerAction(c, "poweron")
+// HandleVPSPowerOn powers on a VPS instance
+func (h *VPSLifecycleHandler) HandleVPSPowerOn(c *gin.Context) {
+	h.performServerAction(c, services.PowerActionOn)
 }
 
-// HandleOCIReboot reboots an OCI instance
-func (h *VPSLifecycleHandler) HandleOCIReboot(c *gin.Context) {
-	h.performOCIServerAction(c, "reboot")
+// HandleVPSReboot reboots a VPS instance
+func (h *VPSLifecycleHandler) HandleVPSReboot(c *gin.Context) {
+	h.performServerAction(c, services.PowerActionReboot)
 }
 
-// performOCIServerAction is a helper for OCI server power management actions
-func (h *VPSLifecycleHandler) performOCIServerAction(c *gin.Context, action string) {
+// HandleVPSTrustHostKey pins the SSH host key a server presents now, e.g. after it was rebuilt
+func (h *VPSLifecycleHandler) HandleVPSTrustHostKey(c *gin.Context) {
 	token, accountID, valid := h.validateTokenAndAccount(c)
 	if !valid {
 		return
 	}
 
-	serverIDStr := c.PostForm("server_id")
-	serverID, err := utils.ParseServerID(serverIDStr)
+	serverID, err := utils.ParseServerID(c.Param("id"))
 	if err != nil {
 		utils.JSONServerIDInvalid(c)
 		return
 	}
 
-	// Get VPS config to get the OCI instance ID
-	vpsConfig, err := h.vpsService.GetVPSConfig(token, accountID, serverID)
+	vpsConfig, err := h.vpsService.TrustHostKey(token, accountID, serverID)
 	if err != nil {
-		log.Printf("Error getting VPS config for action %s: %v", action, err)
-		utils.JSONInternalServerError(c, "Failed to get VPS configuration")
+		log.Printf("Error re-trusting the host key of server %d: %v", serverID, err)
+		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to read the host key: %v", err))
 		return
 	}
 
-	// Verify it's an OCI instance
-	if vpsConfig.Provider != "oci" && vpsConfig.Provider != "OCI" && vpsConfig.Provider != "Oracle Cloud Infrastructure (OCI)" {
-		utils.JSONBadRequest(c, "This endpoint is only for OCI instances")
-		return
-	}
+	utils.JSONSuccess(c, "Host key trusted", gin.H{"fingerprint": vpsConfig.HostKeyFingerprint})
+}
 
-	if vpsConfig.ProviderInstanceID == "" {
-		utils.JSONInternalServerError(c, "OCI instance ID not found in configuration")
+// performServerAction is a helper for server power management actions on any provider
+func (h *VPSLifecycleHandler) performServerAction(c *gin.Context, action string) {
+	token, accountID, valid := h.validateTokenAndAccount(c)
+	if !valid {
 		return
 	}
 
-	// Get OCI auth token
-	ociToken, err := utils.GetOCIAuthToken(token, accountID)
+	serverIDStr := c.PostForm("server_id")
+	serverID, err := utils.ParseServerID(serverIDStr)
 	if err != nil {
-		log.Printf("OCI %s: Failed to retrieve OCI auth token: %v", action, err)
-		utils.JSONInternalServerError(c, "OCI auth token not found")
+		utils.JSONServerIDInvalid(c)
 		return
 	}
 
-	// Create OCI service
-	ociService, err := services.NewOCIService(ociToken)
+	err = h.runJob(c, token, accountID, services.JobSpec{Type: services.JobTypeVPSPower, Target: fmt.Sprintf("%s %s", action, serverIDStr)}, func(ctx context.Context) error {
+		return h.vpsService.PowerAction(ctx, token, accountID, serverID, action)
+	})
 	if err != nil {
-		log.Printf("OCI %s: Failed to create OCI service: %v", action, err)
-		utils.JSONInternalServerError(c, "Failed to initialize OCI service")
+		log.Printf("Error performing %s on server %d: %v", action, serverID, err)
+		if errors.Is(err, services.ErrPowerActionUnsupported) {
+			utils.JSONBadRequest(c, err.Error())
+			return
+		}
+		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to perform %s: %v", action, err))
 		return
 	}
 
-	ctx := c.Request.Context()
-
-	// Perform the action
-	var actionErr error
+	// Convert action to past tense for response
+	actionText := action
 	switch action {
-	case "poweroff":
-		actionErr = ociService.PowerOffInstance(ctx, vpsConfig.ProviderInstanceID)
-	case "poweron":
-		actionErr = ociService.PowerOnInstance(ctx, vpsConfig.ProviderInstanceID)
-	case "reboot":
-		actionErr = ociService.RebootInstance(ctx, vpsConfig.ProviderInstanceID)
-	default:
-		utils.JSONBadRequest(c, "Invalid action")
-		return
+	case services.PowerActionOff:
+		actionText = "powered off"
+	case services.PowerActionOn:
+		actionText = "powered on"
+	case services.PowerActionReboot:
+		actionText = "rebooted"
 	}
 
-	if actionErr != nil {
-		log.Printf("Error performing %s on OCI instance %s: %v", action, vpsConfig.ProviderInstanceID, actionErr)
-		utils.JSONInternalServerError(c, fmt.Sprintf("Failed to %s instance", action))
-		return
-	}
-
-	log.Printf("✅ Successfully performed %s on OCI instance: %s", action, vpsConfig.ProviderInstanceID)
-
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"message": fmt.Sprintf("Server %s completed successfully", action),
-	})
+	utils.JSONVPSPowerActionSuccess(c, actionText, serverIDStr)
 }
 
 // HandleOCIValidateToken validates an OCI auth token
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -57,20 +58,13 @@ func (h *WebSocketTerminalHandler) HandleWebSocketTerminal(c *gin.Context) {
 		return
 	}
 
-	// Authenticate WebSocket connection
-	token := h.authenticateWebSocket(c)
-	if token == "" {
+	// Authenticated by the session middleware
+	accountID := c.GetString("account_id")
+	if accountID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
 		return
 	}
 
-	// Get account ID
-	_, accountID, err := utils.CheckKVNamespaceExists(token)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to access account"})
-		return
-	}
-
 	// Upgrade HTTP connection to WebSocket
 	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
@@ -96,38 +90,12 @@ func (h *WebSocketTerminalHandler) HandleWebSocketTerminal(c *gin.Context) {
 	// Handle WebSocket terminal session
 	if err := h.terminalService.HandleWebSocketConnection(sessionID, conn); err != nil {
 		log.Printf("WebSocket terminal session error: %v", err)
-		h.sendErrorMessage(conn, "Terminal session error")
-	}
-}
-
-// authenticateWebSocket authenticates WebSocket connections
-func (h *WebSocketTerminalHandler) authenticateWebSocket(c *gin.Context) string {
-	// Try to get token from multiple sources
-
-	// 1. Try Authorization header
-	authHeader := c.GetHeader("Authorization")
-	if authHeader != "" {
-		if len(authHeader) > 7 && authHeader[:7] == "Bearer " {
-			token := authHeader[7:]
-			if utils.VerifyCloudflareToken(token) {
-				return token
-			}
+		if errors.Is(err, services.ErrHostKeyMismatch) {
+			h.sendErrorMessage(conn, err.Error())
+			return
 		}
+		h.sendErrorMessage(conn, "Terminal session error")
 	}
-
-	// 2. Try query parameter (for WebSocket connections from frontend)
-	token := c.Query("token")
-	if token != "" && utils.VerifyCloudflareToken(token) {
-		return token
-	}
-
-	// 3. Try cookie (fallback for same-origin requests)
-	token, err := c.Cookie("cf_token")
-	if err == nil && utils.VerifyCloudflareToken(token) {
-		return token
-	}
-
-	return ""
 }
 
 // sendErrorMessage sends an error message over WebSocket
@@ -1,7 +1,11 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/chrishham/xanthus/internal/services"
@@ -12,101 +16,155 @@ import (
 // Global cache service instance
 var cacheService = services.NewCacheService()
 
-// AuthMiddleware validates Cloudflare token from cookies
-func AuthMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		token, err := c.Cookie("cf_token")
-		if err != nil {
-			c.Redirect(http.StatusTemporaryRedirect, "/login")
-			c.Abort()
-			return
-		}
+// GetCacheService returns the cache of account information used by the authentication middleware
+func GetCacheService() *services.CacheService {
+	return cacheService
+}
 
-		// Check cache first for account info
-		accountInfo, cached := cacheService.GetAccountInfo(token)
-		if cached {
-			// Use cached account info
-			c.Set("cf_token", token)
-			c.Set("account_id", accountInfo.AccountID)
-			c.Set("namespace_id", accountInfo.NamespaceID)
-			c.Next()
-			return
-		}
+// API token service, created on first use so the state store is configured by then
+var (
+	apiTokenService     *services.APITokenService
+	apiTokenServiceOnce sync.Once
+)
 
-		// Cache miss - verify token and get account info
-		if !utils.VerifyCloudflareToken(token) {
-			c.Redirect(http.StatusTemporaryRedirect, "/login")
-			c.Abort()
-			return
+// GetAPITokenService returns the API token service used by APIAuthMiddleware
+func GetAPITokenService() *services.APITokenService {
+	apiTokenServiceOnce.Do(func() {
+		if apiTokenService == nil {
+			apiTokenService = services.NewAPITokenService()
 		}
+	})
+	return apiTokenService
+}
 
-		// Get account ID and namespace info
-		namespaceExists, accountID, err := utils.CheckKVNamespaceExists(token)
-		if err != nil {
-			c.Data(http.StatusOK, "text/html", []byte("❌ Error accessing account"))
-			c.Abort()
-			return
-		}
+// SetAPITokenService replaces the API token service used by APIAuthMiddleware
+func SetAPITokenService(service *services.APITokenService) {
+	apiTokenServiceOnce.Do(func() {})
+	apiTokenService = service
+}
 
-		// Get namespace ID for caching
-		namespaceID := ""
-		if namespaceExists {
-			namespaceID, _ = utils.GetXanthusNamespaceID(&http.Client{}, token, accountID)
+// User service, created on first use so the state store is configured by then
+var (
+	userService     *services.UserService
+	userServiceOnce sync.Once
+)
+
+// GetUserService returns the user service that owns web UI sessions
+func GetUserService() *services.UserService {
+	userServiceOnce.Do(func() {
+		if userService == nil {
+			userService = services.NewUserService()
 		}
+	})
+	return userService
+}
 
-		// Cache account info for 10 minutes
-		cacheService.SetAccountInfo(token, &services.AccountInfo{
-			AccountID:   accountID,
-			NamespaceID: namespaceID,
-		}, 10*time.Minute)
+// SetUserService replaces the user service that owns web UI sessions
+func SetUserService(service *services.UserService) {
+	userServiceOnce.Do(func() {})
+	userService = service
+}
 
-		// Store in context for handlers
-		c.Set("cf_token", token)
-		c.Set("account_id", accountID)
-		c.Set("namespace_id", namespaceID)
+// AuthMiddleware authenticates web UI requests with the session cookie and
+// acts on the Cloudflare account of the instance
+func AuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if err := authenticateSession(c); err != nil {
+			if errors.Is(err, errSessionRequired) {
+				c.Redirect(http.StatusTemporaryRedirect, "/login")
+			} else {
+				c.Data(http.StatusOK, "text/html", []byte("❌ Error accessing account"))
+			}
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
 
-// APIAuthMiddleware validates Cloudflare token for API endpoints
+// APIAuthMiddleware authenticates API requests.
+// Clients send a Xanthus API token as "Authorization: Bearer xan_...". Requests from
+// the web UI fall back to the session cookie and are granted the scopes of the user's role.
 func APIAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		token, err := c.Cookie("cf_token")
-		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
-			c.Abort()
+		if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+			authenticateAPIToken(c, authHeader)
 			return
 		}
 
-		// Check cache first for account info
-		accountInfo, cached := cacheService.GetAccountInfo(token)
-		if cached {
-			// Use cached account info
-			c.Set("cf_token", token)
-			c.Set("account_id", accountInfo.AccountID)
-			c.Set("namespace_id", accountInfo.NamespaceID)
-			c.Next()
+		if _, err := c.Cookie(services.SessionCookieName); err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
 			return
 		}
 
-		// Cache miss - verify token and get account info
-		if !utils.VerifyCloudflareToken(token) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication token"})
+		// Browsers send the session cookie with cross-site requests too
+		if !isSafeMethod(c.Request.Method) && !isSameOrigin(c.Request) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Cross-origin requests must authenticate with an API token"})
 			c.Abort()
 			return
 		}
 
-		// Get account ID and namespace info
-		namespaceExists, accountID, err := utils.CheckKVNamespaceExists(token)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to access account"})
+		if err := authenticateSession(c); err != nil {
+			if errors.Is(err, errSessionRequired) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication token"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to access account"})
+			}
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
+
+// isSafeMethod reports whether an HTTP method only reads
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// isSameOrigin reports whether a request was sent by a page of this server,
+// judged by its Origin header or, failing that, its Referer
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+	u, err := url.Parse(origin)
+	if origin == "" || err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
 
-		// Get namespace ID for caching
-		namespaceID := ""
-		if namespaceExists {
+// errSessionRequired means the request carries no valid session
+var errSessionRequired = errors.New("session required")
+
+// authenticateSession resolves the session cookie to a user and populates the
+// request context with the instance credentials and the scopes of the user's role
+func authenticateSession(c *gin.Context) error {
+	sessionID, err := c.Cookie(services.SessionCookieName)
+	if err != nil || sessionID == "" {
+		return errSessionRequired
+	}
+
+	users := GetUserService()
+	user, _, err := users.ResolveSession(sessionID)
+	if err != nil {
+		return errSessionRequired
+	}
+
+	token, accountID, err := users.InstanceCredentials()
+	if err != nil {
+		return err
+	}
+
+	// Check cache first for the namespace ID
+	namespaceID := ""
+	if accountInfo, cached := cacheService.GetAccountInfo(token); cached {
+		namespaceID = accountInfo.NamespaceID
+	} else {
+		if utils.UsesCloudflareKV() {
 			namespaceID, _ = utils.GetXanthusNamespaceID(&http.Client{}, token, accountID)
 		}
 
@@ -115,11 +173,71 @@ func APIAuthMiddleware() gin.HandlerFunc {
 			AccountID:   accountID,
 			NamespaceID: namespaceID,
 		}, 10*time.Minute)
+	}
 
-		// Store in context for handlers
-		c.Set("cf_token", token)
-		c.Set("account_id", accountID)
-		c.Set("namespace_id", namespaceID)
+	// Store in context for handlers
+	c.Set("cf_token", token)
+	c.Set("account_id", accountID)
+	c.Set("namespace_id", namespaceID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("api_scopes", services.RoleScopes(user.Role))
+	services.GetBackgroundAccounts().Register(token, accountID)
+	return nil
+}
+
+// authenticateAPIToken validates a bearer API token and populates the request context
+func authenticateAPIToken(c *gin.Context, authHeader string) {
+	rawToken, found := strings.CutPrefix(authHeader, "Bearer ")
+	if !found || !strings.HasPrefix(rawToken, services.APITokenPrefix) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Expected a Xanthus API token (Authorization: Bearer xan_...)"})
+		c.Abort()
+		return
+	}
+
+	apiToken, cfToken, err := GetAPITokenService().Authenticate(strings.TrimSpace(rawToken))
+	if err != nil {
+		message := "Invalid API token"
+		if errors.Is(err, services.ErrAPITokenRevoked) || errors.Is(err, services.ErrAPITokenExpired) {
+			message = err.Error()
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": message})
+		c.Abort()
+		return
+	}
+
+	// Tokens of the instance account act with its current Cloudflare token, so
+	// they keep working after the instance token has been rotated
+	if instanceToken, instanceAccount, err := GetUserService().InstanceCredentials(); err == nil && instanceAccount == apiToken.AccountID {
+		cfToken = instanceToken
+	}
+
+	namespaceID := ""
+	if accountInfo, cached := cacheService.GetAccountInfo(cfToken); cached {
+		namespaceID = accountInfo.NamespaceID
+	}
+
+	c.Set("cf_token", cfToken)
+	c.Set("account_id", apiToken.AccountID)
+	c.Set("namespace_id", namespaceID)
+	services.GetBackgroundAccounts().Register(cfToken, apiToken.AccountID)
+	c.Set("api_token_id", apiToken.ID)
+	c.Set("api_scopes", apiToken.Scopes)
+	c.Next()
+}
+
+// RequireScope rejects requests whose API token or user role does not grant scope
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !services.HasScope(c.GetStringSlice("api_scopes"), scope) {
+			message := "API token is missing required scope: " + scope
+			if role := c.GetString("role"); role != "" {
+				message = "The " + role + " role is missing required scope: " + scope
+			}
+			c.JSON(http.StatusForbidden, gin.H{"error": message})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	httpRequests = utils.Metrics().NewCounter("xanthus_http_requests_total",
+		"HTTP requests by method, route and status code", "method", "route", "code")
+	httpDuration = utils.Metrics().NewHistogram("xanthus_http_request_duration_seconds",
+		"Latency of HTTP requests by method and route", utils.DefaultLatencyBuckets, "method", "route")
+)
+
+// RequestMetrics records the count and latency of requests per gin route.
+// Routes are labelled by their pattern, like /api/v1/vps/:id, so the number
+// of series doesn't grow with IDs; requests matching no route are "unmatched".
+func RequestMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		httpDuration.Observe(time.Since(start).Seconds(), c.Request.Method, route)
+		httpRequests.Inc(c.Request.Method, route, strconv.Itoa(c.Writer.Status()))
+	}
+}
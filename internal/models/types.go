@@ -132,8 +132,10 @@ type Application struct {
 	VPSName     string `json:"vps_name"`
 	Namespace   string `json:"namespace"`
 	Status      string `json:"status"`
-	ErrorMsg    string `json:"error_msg,omitempty"` // Error message for failed deployments
-	URL         string `json:"url"`                 // Full URL to access the application
+	ErrorMsg    string `json:"error_msg,omitempty"`    // Error message for failed deployments
+	URL         string `json:"url"`                    // Full URL to access the application
+	Values      string `json:"values,omitempty"`       // Helm values overriding the catalog defaults, as YAML
+	ReleaseName string `json:"release_name,omitempty"` // Helm release of an adopted application; see HelmReleaseName
 	CreatedAt   string `json:"created_at"`
 	UpdatedAt   string `json:"updated_at"`
 	// Legacy fields for backward compatibility
@@ -141,6 +143,15 @@ type Application struct {
 	ChartVersion string `json:"chart_version,omitempty"`
 }
 
+// HelmReleaseName returns the name of the application's Helm release. Releases
+// deployed by Xanthus are named <subdomain>-<app type>; adopted ones keep theirs.
+func (a *Application) HelmReleaseName() string {
+	if a.ReleaseName != "" {
+		return a.ReleaseName
+	}
+	return a.Subdomain + "-" + a.AppType
+}
+
 // GitHubRelease represents a GitHub release with version information
 type GitHubRelease struct {
 	TagName     string    `json:"tag_name"`
@@ -2,9 +2,11 @@ package router
 
 import (
 	"github.com/chrishham/xanthus/internal/handlers"
+	"github.com/chrishham/xanthus/internal/handlers/api"
 	"github.com/chrishham/xanthus/internal/handlers/applications"
 	"github.com/chrishham/xanthus/internal/handlers/vps"
 	"github.com/chrishham/xanthus/internal/middleware"
+	"github.com/chrishham/xanthus/internal/services"
 	"github.com/gin-gonic/gin"
 )
 
@@ -21,6 +23,9 @@ type RouteConfig struct {
 	WebSocketTerminalHandler *handlers.WebSocketTerminalHandler
 	PagesHandler             *handlers.PagesHandler
 	VersionHandler           *handlers.VersionHandler
+	UsersHandler             *handlers.UsersHandler
+	APIHandler               *api.Handler
+	MetricsHandler           *handlers.MetricsHandler
 }
 
 // SetupRoutes configures all application routes
@@ -28,6 +33,7 @@ func SetupRoutes(r *gin.Engine, config RouteConfig) {
 	setupPublicRoutes(r, config)
 	setupProtectedRoutes(r, config)
 	setupAPIRoutes(r, config)
+	setupMetricsRoutes(r, config)
 }
 
 // setupPublicRoutes configures routes that don't require authentication
@@ -39,26 +45,48 @@ func setupPublicRoutes(r *gin.Engine, config RouteConfig) {
 	r.GET("/health", config.AuthHandler.HandleHealth)
 }
 
-// setupProtectedRoutes configures routes that require authentication
+// setupProtectedRoutes configures routes that require a signed-in user.
+// Routes that change infrastructure or reveal secrets also require the matching
+// scope of the user's role (see services.RoleScopes).
 func setupProtectedRoutes(r *gin.Engine, config RouteConfig) {
 	// Apply authentication middleware to protected routes
 	protected := r.Group("/")
 	protected.Use(middleware.AuthMiddleware())
 
+	vpsWrite := middleware.RequireScope(services.ScopeVPSWrite)
+	appsWrite := middleware.RequireScope(services.ScopeAppsWrite)
+	dnsWrite := middleware.RequireScope(services.ScopeDNSWrite)
+	versionsWrite := middleware.RequireScope(services.ScopeVersionsWrite)
+
 	// Main application pages
 	protected.GET("/main", config.PagesHandler.HandleMainPage)
 	protected.GET("/setup", config.PagesHandler.HandleSetupPage)
-	protected.POST("/setup/hetzner", config.VPSConfigHandler.HandleSetupHetzner)
-	protected.GET("/terminal-page/:session_id", config.TerminalHandler.HandleTerminalPage)
+	protected.POST("/setup/hetzner", vpsWrite, config.VPSConfigHandler.HandleSetupHetzner)
+	protected.GET("/terminal-page/:session_id", vpsWrite, config.TerminalHandler.HandleTerminalPage)
 	protected.GET("/logout", config.AuthHandler.HandleLogout)
 
+	// Account of the signed-in user
+	protected.GET("/account", config.UsersHandler.HandleAccount)
+	protected.POST("/account/password", config.UsersHandler.HandleAccountPassword)
+
+	// User management routes
+	users := protected.Group("/users", middleware.RequireScope(services.ScopeUsersManage))
+	{
+		users.GET("", config.UsersHandler.HandleUsersPage)
+		users.POST("/create", config.UsersHandler.HandleUsersCreate)
+		users.POST("/:username/role", config.UsersHandler.HandleUsersRole)
+		users.POST("/:username/password", config.UsersHandler.HandleUsersPassword)
+		users.DELETE("/:username", config.UsersHandler.HandleUsersDelete)
+	}
+
 	// DNS management routes
 	dns := protected.Group("/dns")
 	{
 		dns.GET("", config.DNSHandler.HandleDNSConfigPage)
 		dns.GET("/list", config.DNSHandler.HandleDNSList)
-		dns.POST("/configure", config.DNSHandler.HandleDNSConfigure)
-		dns.POST("/remove", config.DNSHandler.HandleDNSRemove)
+		dns.POST("/configure", dnsWrite, config.DNSHandler.HandleDNSConfigure)
+		dns.POST("/renew", dnsWrite, config.DNSHandler.HandleDNSRenew)
+		dns.POST("/remove", dnsWrite, config.DNSHandler.HandleDNSRemove)
 	}
 
 	// VPS management routes
@@ -74,72 +102,71 @@ func setupProtectedRoutes(r *gin.Engine, config RouteConfig) {
 
 		// Info/monitoring routes
 		vps.GET("/list", config.VPSInfoHandler.HandleVPSList)
-		vps.GET("/ssh-key", config.VPSInfoHandler.HandleVPSSSHKey)
+		vps.GET("/ssh-key", vpsWrite, config.VPSInfoHandler.HandleVPSSSHKey)
 		vps.GET("/:id/status", config.VPSInfoHandler.HandleVPSStatus)
 		vps.GET("/:id/info", config.VPSInfoHandler.HandleVPSInfo)
 		vps.GET("/:id/logs", config.VPSInfoHandler.HandleVPSLogs)
 		vps.GET("/:id/k3s-logs", config.VPSInfoHandler.HandleK3sLogs)
 		vps.GET("/:id/applications", config.VPSInfoHandler.HandleVPSApplications)
-		vps.POST("/:id/terminal", config.VPSInfoHandler.HandleVPSTerminal)
-		vps.GET("/:id/ssh-debug", config.VPSInfoHandler.HandleVPSSSHUserDebug)
+		vps.POST("/:id/terminal", vpsWrite, config.VPSInfoHandler.HandleVPSTerminal)
+		vps.GET("/:id/ssh-debug", vpsWrite, config.VPSInfoHandler.HandleVPSSSHUserDebug)
 
 		// Lifecycle routes
-		vps.POST("/create", config.VPSLifecycleHandler.HandleVPSCreate)
-		vps.POST("/delete", config.VPSLifecycleHandler.HandleVPSDelete)
-		vps.POST("/poweroff", config.VPSLifecycleHandler.HandleVPSPowerOff)
-		vps.POST("/poweron", config.VPSLifecycleHandler.HandleVPSPowerOn)
-		vps.POST("/reboot", config.VPSLifecycleHandler.HandleVPSReboot)
+		vps.POST("/create", vpsWrite, config.VPSLifecycleHandler.HandleVPSCreate)
+		vps.POST("/delete", vpsWrite, config.VPSLifecycleHandler.HandleVPSDelete)
+		vps.POST("/poweroff", vpsWrite, config.VPSLifecycleHandler.HandleVPSPowerOff)
+		vps.POST("/poweron", vpsWrite, config.VPSLifecycleHandler.HandleVPSPowerOn)
+		vps.POST("/reboot", vpsWrite, config.VPSLifecycleHandler.HandleVPSReboot)
+		vps.POST("/:id/trust-host-key", vpsWrite, config.VPSLifecycleHandler.HandleVPSTrustHostKey)
 
 		// Provider-specific routes
-		vps.GET("/oci-ssh-key", config.VPSLifecycleHandler.HandleSSHKey)
-		vps.POST("/add-oci", config.VPSLifecycleHandler.HandleAddOCI)
+		vps.GET("/oci-ssh-key", vpsWrite, config.VPSLifecycleHandler.HandleSSHKey)
+		vps.POST("/add-oci", vpsWrite, config.VPSLifecycleHandler.HandleAddOCI)
+		vps.POST("/add-existing", vpsWrite, config.VPSLifecycleHandler.HandleAddExisting)
 
 		// OCI automation routes
 		oci := vps.Group("/oci")
 		{
 			oci.GET("/check-token", config.VPSLifecycleHandler.HandleOCICheckToken)
-			oci.POST("/validate-token", config.VPSLifecycleHandler.HandleOCIValidateToken)
-			oci.POST("/store-token", config.VPSLifecycleHandler.HandleOCIStoreToken)
+			oci.POST("/validate-token", vpsWrite, config.VPSLifecycleHandler.HandleOCIValidateToken)
+			oci.POST("/store-token", vpsWrite, config.VPSLifecycleHandler.HandleOCIStoreToken)
 			oci.GET("/home-region", config.VPSLifecycleHandler.HandleOCIGetHomeRegion)
-			oci.POST("/create", config.VPSLifecycleHandler.HandleOCICreate)
-			oci.POST("/delete", config.VPSLifecycleHandler.HandleOCIDelete)
-			oci.POST("/poweroff", config.VPSLifecycleHandler.HandleOCIPowerOff)
-			oci.POST("/poweron", config.VPSLifecycleHandler.HandleOCIPowerOn)
-			oci.POST("/reboot", config.VPSLifecycleHandler.HandleOCIReboot)
 		}
 
 		// Configuration routes
 		vps.GET("/check-key", config.VPSConfigHandler.HandleVPSCheckKey)
-		vps.POST("/validate-key", config.VPSConfigHandler.HandleVPSValidateKey)
-		vps.POST("/:id/configure", config.VPSConfigHandler.HandleVPSConfigure)
-		vps.POST("/:id/deploy", config.VPSConfigHandler.HandleVPSDeploy)
+		vps.POST("/validate-key", vpsWrite, config.VPSConfigHandler.HandleVPSValidateKey)
+		vps.GET("/digitalocean/check-key", config.VPSConfigHandler.HandleDigitalOceanCheckKey)
+		vps.POST("/digitalocean/validate-key", vpsWrite, config.VPSConfigHandler.HandleDigitalOceanValidateKey)
+		vps.POST("/:id/configure", vpsWrite, config.VPSConfigHandler.HandleVPSConfigure)
+		vps.POST("/:id/deploy", vpsWrite, config.VPSConfigHandler.HandleVPSDeploy)
 
 		// Timezone routes
 		vps.GET("/timezones", config.VPSConfigHandler.HandleVPSListTimezones)
 		vps.GET("/:id/timezone", config.VPSConfigHandler.HandleVPSGetTimezone)
-		vps.POST("/:id/timezone", config.VPSConfigHandler.HandleVPSSetTimezone)
+		vps.POST("/:id/timezone", vpsWrite, config.VPSConfigHandler.HandleVPSSetTimezone)
 
 		// Configuration update route
-		vps.POST("/:id/update-config", config.VPSLifecycleHandler.HandleUpdateVPSConfig)
+		vps.POST("/:id/update-config", vpsWrite, config.VPSLifecycleHandler.HandleUpdateVPSConfig)
 	}
 
 	// Terminal management routes (legacy GoTTY)
-	terminal := protected.Group("/terminal")
+	terminal := protected.Group("/terminal", vpsWrite)
 	{
 		terminal.GET("/:session_id", config.TerminalHandler.HandleTerminalView)
 		terminal.DELETE("/:session_id", config.TerminalHandler.HandleTerminalStop)
 	}
 
 	// WebSocket terminal routes
-	wsTerminal := protected.Group("/ws-terminal")
+	wsTerminal := protected.Group("/ws-terminal", vpsWrite)
 	{
 		wsTerminal.POST("/create", config.WebSocketTerminalHandler.HandleTerminalCreate)
 		wsTerminal.GET("/list", config.WebSocketTerminalHandler.HandleTerminalList)
 		wsTerminal.DELETE("/:session_id", config.WebSocketTerminalHandler.HandleTerminalStop)
 	}
 
-	// WebSocket endpoint (with special auth handling)
-	ws := r.Group("/ws")
+	// WebSocket endpoint, authenticated with the session cookie of the page that opens it
+	ws := protected.Group("/ws", vpsWrite)
 	{
 		ws.GET("/terminal/:session_id", config.WebSocketTerminalHandler.HandleWebSocketTerminal)
 	}
@@ -150,16 +177,16 @@ func setupProtectedRoutes(r *gin.Engine, config RouteConfig) {
 		apps.GET("", config.AppsHandler.HandleApplicationsPage)
 		apps.GET("/list", config.AppsHandler.HandleApplicationsList)
 		apps.GET("/prerequisites", config.AppsHandler.HandleApplicationsPrerequisites)
-		apps.POST("/create", config.AppsHandler.HandleApplicationsCreate)
+		apps.POST("/create", appsWrite, config.AppsHandler.HandleApplicationsCreate)
 		apps.GET("/versions/:app_type", config.AppsHandler.HandleApplicationVersions)
-		apps.POST("/:id/upgrade", config.AppsHandler.HandleApplicationUpgrade)
-		apps.GET("/:id/password", config.AppsHandler.HandleApplicationPasswordGet)
-		apps.POST("/:id/password", config.AppsHandler.HandleApplicationPasswordChange)
-		apps.GET("/:id/token", config.AppsHandler.HandleApplicationToken)
+		apps.POST("/:id/upgrade", appsWrite, config.AppsHandler.HandleApplicationUpgrade)
+		apps.GET("/:id/password", appsWrite, config.AppsHandler.HandleApplicationPasswordGet)
+		apps.POST("/:id/password", appsWrite, config.AppsHandler.HandleApplicationPasswordChange)
+		apps.GET("/:id/token", appsWrite, config.AppsHandler.HandleApplicationToken)
 		apps.GET("/:id/port-forwards", config.AppsHandler.HandlePortForwardsList)
-		apps.POST("/:id/port-forwards", config.AppsHandler.HandlePortForwardsCreate)
-		apps.DELETE("/:id/port-forwards/:port_id", config.AppsHandler.HandlePortForwardsDelete)
-		apps.DELETE("/:id", config.AppsHandler.HandleApplicationDelete)
+		apps.POST("/:id/port-forwards", appsWrite, config.AppsHandler.HandlePortForwardsCreate)
+		apps.DELETE("/:id/port-forwards/:port_id", appsWrite, config.AppsHandler.HandlePortForwardsDelete)
+		apps.DELETE("/:id", appsWrite, config.AppsHandler.HandleApplicationDelete)
 	}
 
 	// Version management routes
@@ -167,20 +194,32 @@ func setupProtectedRoutes(r *gin.Engine, config RouteConfig) {
 	{
 		version.GET("/current", config.VersionHandler.GetCurrentVersion)
 		version.GET("/available", config.VersionHandler.GetAvailableVersions)
-		version.POST("/update", config.VersionHandler.TriggerUpdate)
+		version.POST("/update", versionsWrite, config.VersionHandler.TriggerUpdate)
 		version.GET("/status", config.VersionHandler.GetUpdateStatus)
-		version.POST("/rollback", config.VersionHandler.RollbackVersion)
+		version.POST("/rollback", versionsWrite, config.VersionHandler.RollbackVersion)
 	}
 
 	// About route
 	protected.GET("/about", config.VersionHandler.GetAboutInfo)
 }
 
-// setupAPIRoutes configures API routes with appropriate middleware
+// setupAPIRoutes configures the versioned JSON API
 func setupAPIRoutes(r *gin.Engine, config RouteConfig) {
-	// API routes could be added here if needed
-	api := r.Group("/api")
-	api.Use(middleware.APIAuthMiddleware())
+	if config.APIHandler == nil {
+		return
+	}
+
+	// Authenticated with API tokens (or the web UI session); see api.Handler.Register
+	v1 := r.Group("/api/" + api.Version)
+	config.APIHandler.Register(v1)
+}
+
+// setupMetricsRoutes serves the Prometheus metrics of Xanthus itself, scraped
+// with an API token granting metrics:read
+func setupMetricsRoutes(r *gin.Engine, config RouteConfig) {
+	if config.MetricsHandler == nil {
+		return
+	}
 
-	// Add API routes here when needed
+	r.GET("/metrics", middleware.APIAuthMiddleware(), middleware.RequireScope(services.ScopeMetricsRead), config.MetricsHandler.HandleMetrics)
 }
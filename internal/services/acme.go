@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// ACME directories and the environment variables that configure the ACME issuer
+const (
+	LetsEncryptDirectoryURL        = "https://acme-v02.api.letsencrypt.org/directory"
+	LetsEncryptStagingDirectoryURL = "https://acme-staging-v02.api.letsencrypt.org/directory"
+	EnvACMEDirectoryURL            = "XANTHUS_ACME_DIRECTORY_URL"
+	EnvACMEEmail                   = "XANTHUS_ACME_EMAIL"
+)
+
+// Certificate issuers stored in DomainSSLConfig.Issuer
+const (
+	IssuerCloudflareOrigin = "cloudflare-origin"
+	IssuerACME             = "acme"
+)
+
+// acmeAccountKey is the KV key of the ACME account
+const acmeAccountKey = "config:acme:account"
+
+// ACMEDirectoryURL returns the configured ACME directory, Let's Encrypt by default.
+// Point XANTHUS_ACME_DIRECTORY_URL at Let's Encrypt staging or a Pebble instance for testing.
+func ACMEDirectoryURL() string {
+	if url := strings.TrimSpace(os.Getenv(EnvACMEDirectoryURL)); url != "" {
+		return url
+	}
+	return LetsEncryptDirectoryURL
+}
+
+// DNS01Solver publishes the TXT records of ACME dns-01 challenges
+type DNS01Solver interface {
+	// PresentTXT creates a TXT record and returns its ID for CleanUpTXT
+	PresentTXT(ctx context.Context, name, value string) (string, error)
+
+	// WaitTXT waits until the record is visible to the ACME server's resolvers
+	WaitTXT(ctx context.Context, name, value string) error
+
+	// CleanUpTXT removes a record created by PresentTXT
+	CleanUpTXT(ctx context.Context, recordID string) error
+}
+
+// ACMEAccount is the ACME account of a Xanthus installation, stored in KV
+type ACMEAccount struct {
+	DirectoryURL string `json:"directory_url"`
+	Email        string `json:"email,omitempty"`
+	PrivateKey   string `json:"private_key"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// ACMECertificate is a certificate issued by an ACME CA
+type ACMECertificate struct {
+	Certificate string    // PEM chain, leaf first
+	PrivateKey  string    // PEM PKCS#8
+	NotAfter    time.Time // expiry of the leaf
+	URL         string    // certificate URL at the CA
+}
+
+// ACMEService issues publicly trusted certificates through ACME dns-01 challenges
+type ACMEService struct {
+	client *acme.Client
+	email  string
+}
+
+// NewACMEService creates an ACME client for a directory and account key
+func NewACMEService(directoryURL string, accountKey crypto.Signer, email string) *ACMEService {
+	return &ACMEService{
+		client: &acme.Client{
+			Key:          accountKey,
+			DirectoryURL: directoryURL,
+			UserAgent:    "xanthus",
+		},
+		email: email,
+	}
+}
+
+// LoadACMEService returns an ACME client for the configured directory using the
+// account stored in KV. A new account key is generated on first use, or when the
+// directory changes.
+func LoadACMEService(kv *KVService, token, accountID string) (*ACMEService, error) {
+	directoryURL := ACMEDirectoryURL()
+
+	var account ACMEAccount
+	if err := kv.GetValue(token, accountID, acmeAccountKey, &account); err == nil && account.DirectoryURL == directoryURL {
+		key, err := parseACMEAccountKey(account.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		return NewACMEService(directoryURL, key, account.Email), nil
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ACME account key: %w", err)
+	}
+	keyPEM, err := encodePrivateKeyPEM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	account = ACMEAccount{
+		DirectoryURL: directoryURL,
+		Email:        strings.TrimSpace(os.Getenv(EnvACMEEmail)),
+		PrivateKey:   keyPEM,
+		CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := kv.PutValue(token, accountID, acmeAccountKey, account); err != nil {
+		return nil, fmt.Errorf("failed to store ACME account: %w", err)
+	}
+
+	log.Printf("🔑 Created ACME account key for %s", directoryURL)
+	return NewACMEService(directoryURL, key, account.Email), nil
+}
+
+// DirectoryURL returns the ACME directory the service issues from
+func (as *ACMEService) DirectoryURL() string {
+	return as.client.DirectoryURL
+}
+
+// ObtainCertificate registers the account if needed, solves a dns-01 challenge
+// for every domain through solver and returns the issued certificate with a new key.
+// Wildcards ("*.example.com") are supported.
+func (as *ACMEService) ObtainCertificate(ctx context.Context, domains []string, solver DNS01Solver) (*ACMECertificate, error) {
+	if len(domains) == 0 {
+		return nil, fmt.Errorf("no domains to issue a certificate for")
+	}
+
+	account := &acme.Account{}
+	if as.email != "" {
+		account.Contact = []string{"mailto:" + as.email}
+	}
+	if _, err := as.client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	order, err := as.client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create ACME order: %w", err)
+	}
+
+	// Publish every challenge before accepting any: a domain and its wildcard
+	// share the same record name and both values must be visible at once
+	type pendingChallenge struct {
+		authzURL  string
+		challenge *acme.Challenge
+		name      string
+		value     string
+	}
+	var pending []pendingChallenge
+	var recordIDs []string
+	defer func() {
+		for _, id := range recordIDs {
+			if err := solver.CleanUpTXT(context.Background(), id); err != nil {
+				log.Printf("Warning: Failed to remove ACME challenge record %s: %v", id, err)
+			}
+		}
+	}()
+
+	for _, authzURL := range order.AuthzURLs {
+		authz, err := as.client.GetAuthorization(ctx, authzURL)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get ACME authorization: %w", err)
+		}
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+
+		var challenge *acme.Challenge
+		for _, c := range authz.Challenges {
+			if c.Type == "dns-01" {
+				challenge = c
+				break
+			}
+		}
+		if challenge == nil {
+			return nil, fmt.Errorf("ACME server offered no dns-01 challenge for %s", authz.Identifier.Value)
+		}
+
+		value, err := as.client.DNS01ChallengeRecord(challenge.Token)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute dns-01 record: %w", err)
+		}
+		name := "_acme-challenge." + strings.TrimPrefix(authz.Identifier.Value, "*.")
+
+		recordID, err := solver.PresentTXT(ctx, name, value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create TXT record %s: %w", name, err)
+		}
+		recordIDs = append(recordIDs, recordID)
+		pending = append(pending, pendingChallenge{authzURL: authzURL, challenge: challenge, name: name, value: value})
+	}
+
+	for _, p := range pending {
+		if err := solver.WaitTXT(ctx, p.name, p.value); err != nil {
+			return nil, fmt.Errorf("TXT record %s did not propagate: %w", p.name, err)
+		}
+	}
+
+	for _, p := range pending {
+		if _, err := as.client.Accept(ctx, p.challenge); err != nil {
+			return nil, fmt.Errorf("failed to accept dns-01 challenge for %s: %w", p.name, err)
+		}
+		if _, err := as.client.WaitAuthorization(ctx, p.authzURL); err != nil {
+			return nil, fmt.Errorf("dns-01 challenge for %s failed: %w", p.name, err)
+		}
+	}
+
+	if order, err = as.client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("ACME order failed: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate certificate key: %w", err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: domains}, certKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate request: %w", err)
+	}
+
+	chain, certURL, err := as.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finalize ACME order: %w", err)
+	}
+
+	leaf, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse issued certificate: %w", err)
+	}
+
+	var certPEM strings.Builder
+	for _, der := range chain {
+		certPEM.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	}
+	keyPEM, err := encodePrivateKeyPEM(certKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ACMECertificate{
+		Certificate: certPEM.String(),
+		PrivateKey:  keyPEM,
+		NotAfter:    leaf.NotAfter,
+		URL:         certURL,
+	}, nil
+}
+
+// CloudflareDNS01Solver publishes dns-01 challenges as TXT records in a Cloudflare zone
+type CloudflareDNS01Solver struct {
+	cf       *CloudflareService
+	token    string
+	zoneID   string
+	resolver *net.Resolver
+	timeout  time.Duration
+}
+
+// NewCloudflareDNS01Solver creates a solver for a zone. Records are considered
+// propagated once the public resolver returns them, or after two minutes.
+func NewCloudflareDNS01Solver(cf *CloudflareService, token, zoneID string) *CloudflareDNS01Solver {
+	return &CloudflareDNS01Solver{cf: cf, token: token, zoneID: zoneID, resolver: net.DefaultResolver, timeout: 2 * time.Minute}
+}
+
+// PresentTXT creates the TXT record
+func (s *CloudflareDNS01Solver) PresentTXT(ctx context.Context, name, value string) (string, error) {
+	record, err := s.cf.CreateDNSRecord(s.token, s.zoneID, "TXT", name, value, false)
+	if err != nil {
+		return "", err
+	}
+	return record.ID, nil
+}
+
+// WaitTXT polls DNS until the record is visible. Cloudflare usually serves new
+// records within seconds, so a timeout is logged rather than treated as fatal;
+// cancelling ctx still stops the wait with its error.
+func (s *CloudflareDNS01Solver) WaitTXT(ctx context.Context, name, value string) error {
+	waitCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+	for {
+		if records, err := s.resolver.LookupTXT(waitCtx, name); err == nil {
+			for _, record := range records {
+				if record == value {
+					return nil
+				}
+			}
+		}
+		select {
+		case <-waitCtx.Done():
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			log.Printf("Warning: TXT record %s not visible after %s, continuing", name, s.timeout)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// CleanUpTXT deletes the TXT record
+func (s *CloudflareDNS01Solver) CleanUpTXT(ctx context.Context, recordID string) error {
+	return s.cf.DeleteDNSRecord(s.token, s.zoneID, recordID)
+}
+
+// parseACMEAccountKey decodes a stored PKCS#8 account key
+func parseACMEAccountKey(keyPEM string) (crypto.Signer, error) {
+	block, _ := pem.Decode([]byte(keyPEM))
+	if block == nil {
+		return nil, fmt.Errorf("failed to parse PEM block containing the ACME account key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse ACME account key: %w", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("ACME account key is not a signing key")
+	}
+	return signer, nil
+}
+
+// encodePrivateKeyPEM encodes a private key as PEM PKCS#8
+func encodePrivateKeyPEM(key crypto.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key: %w", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})), nil
+}
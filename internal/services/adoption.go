@@ -0,0 +1,708 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+var (
+	// ErrAlreadyManaged is returned when adopting a resource Xanthus already manages
+	ErrAlreadyManaged = errors.New("already managed by Xanthus")
+	// ErrAdoptionNotFound is returned when the resource to adopt doesn't exist
+	ErrAdoptionNotFound = errors.New("resource to adopt not found")
+	// ErrInvalidAdoptionRequest is wrapped by adoption errors caused by the request
+	ErrInvalidAdoptionRequest = errors.New("invalid adoption request")
+)
+
+// UnmanagedServer is a server at a provider that Xanthus doesn't manage
+type UnmanagedServer struct {
+	Provider   string `json:"provider"`
+	ID         int    `json:"id"`
+	InstanceID string `json:"instance_id,omitempty"`
+	Name       string `json:"name"`
+	PublicIPv4 string `json:"public_ipv4"`
+	ServerType string `json:"server_type"`
+	Location   string `json:"location"`
+	CreatedAt  string `json:"created_at,omitempty"`
+}
+
+// UnmanagedZone is a Cloudflare zone that isn't configured in Xanthus
+type UnmanagedZone struct {
+	Domain string `json:"domain"`
+	ZoneID string `json:"zone_id"`
+	Status string `json:"status"`
+}
+
+// UnmanagedRecord is an A record in a managed zone that no server, application
+// or port forward accounts for
+type UnmanagedRecord struct {
+	Domain   string `json:"domain"`
+	Name     string `json:"name"`
+	Content  string `json:"content"`
+	Proxied  bool   `json:"proxied"`
+	ServerID int    `json:"server_id,omitempty"` // Managed server the record points to
+}
+
+// UnmanagedRelease is a Helm release on a managed server without an application
+type UnmanagedRelease struct {
+	ServerID   int      `json:"server_id"`
+	ServerName string   `json:"server_name"`
+	Namespace  string   `json:"namespace"`
+	Name       string   `json:"name"`
+	Chart      string   `json:"chart"`
+	AppVersion string   `json:"app_version"`
+	Status     string   `json:"status"`
+	AppType    string   `json:"app_type,omitempty"` // Inferred from the chart, empty when unknown
+	Hosts      []string `json:"hosts"`
+}
+
+// AdoptionCandidates lists the resources Xanthus could take over
+type AdoptionCandidates struct {
+	Servers  []UnmanagedServer  `json:"servers"`
+	Zones    []UnmanagedZone    `json:"zones"`
+	Records  []UnmanagedRecord  `json:"records"`
+	Releases []UnmanagedRelease `json:"releases"`
+	// Errors are sources that could not be listed, e.g. because a provider API failed
+	Errors []string `json:"errors"`
+}
+
+// AdoptServerRequest identifies a provider server to adopt
+type AdoptServerRequest struct {
+	Provider string
+	ID       int    // As listed in UnmanagedServer.ID
+	SSHUser  string // defaults to the provider's default user
+	SSHPort  int    // defaults to the provider's default port
+	Password string // optional, used once to install the Xanthus SSH key
+}
+
+// AdoptReleaseRequest identifies a Helm release to adopt as an application
+type AdoptReleaseRequest struct {
+	ServerID  int
+	Namespace string
+	Release   string
+	AppType   string // defaults to the type inferred from the chart
+	Name      string // defaults to the release name
+	Subdomain string // Subdomain and Domain default to the release's ingress host
+	Domain    string
+}
+
+// AdoptionService finds servers, zones, DNS records and Helm releases created
+// outside Xanthus and brings them under management
+type AdoptionService struct {
+	kv       *KVService
+	keys     *SSHKeyService
+	ssh      *SSHService
+	cf       *CloudflareService
+	provider *ProviderResolver
+	catalog  ApplicationCatalog
+}
+
+// NewAdoptionService creates an adoption service on the process-wide state store
+func NewAdoptionService(catalog ApplicationCatalog) *AdoptionService {
+	return NewAdoptionServiceWithStore(utils.GetStateStore(), nil, catalog)
+}
+
+// NewAdoptionServiceWithStore creates an adoption service on the given state
+// store and keyring; a nil keyring stands for the process-wide one
+func NewAdoptionServiceWithStore(store utils.StateStore, keyring *utils.Keyring, catalog ApplicationCatalog) *AdoptionService {
+	kv := NewKVServiceWithStore(store)
+	return &AdoptionService{
+		kv:       kv,
+		keys:     NewSSHKeyServiceWithStore(store, keyring),
+		ssh:      NewSSHService(),
+		cf:       NewCloudflareService(),
+		provider: NewProviderResolver(kv),
+		catalog:  catalog,
+	}
+}
+
+// Discover lists the unmanaged servers of every configured provider, the
+// unmanaged Cloudflare zones and records, and the unmanaged Helm releases on
+// managed servers
+func (s *AdoptionService) Discover(ctx context.Context, token, accountID string) (*AdoptionCandidates, error) {
+	configs, err := s.kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	apps, portForwards, err := listStoredApplications(s.kv, token, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := &AdoptionCandidates{
+		Servers:  []UnmanagedServer{},
+		Zones:    []UnmanagedZone{},
+		Records:  []UnmanagedRecord{},
+		Releases: []UnmanagedRelease{},
+		Errors:   []string{},
+	}
+
+	if err := StartJobStep(ctx, "Listing provider servers"); err != nil {
+		return nil, err
+	}
+	s.discoverServers(ctx, token, accountID, configs, candidates)
+
+	if err := StartJobStep(ctx, "Listing Cloudflare zones"); err != nil {
+		return nil, err
+	}
+	s.discoverDNS(token, accountID, configs, apps, portForwards, candidates)
+
+	if err := StartJobStep(ctx, "Listing Helm releases"); err != nil {
+		return nil, err
+	}
+	s.discoverReleases(ctx, token, accountID, configs, apps, candidates)
+
+	return candidates, nil
+}
+
+// DiscoverServers lists the servers of every configured provider that Xanthus doesn't manage
+func (s *AdoptionService) DiscoverServers(ctx context.Context, token, accountID string) (*AdoptionCandidates, error) {
+	configs, err := s.kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+
+	candidates := &AdoptionCandidates{Servers: []UnmanagedServer{}, Errors: []string{}}
+	s.discoverServers(ctx, token, accountID, configs, candidates)
+	return candidates, nil
+}
+
+// discoverServers lists the servers of each provider with credentials. Providers
+// that aren't configured for the account are skipped.
+func (s *AdoptionService) discoverServers(ctx context.Context, token, accountID string, configs map[int]*VPSConfig, candidates *AdoptionCandidates) {
+	for _, name := range CloudProviderNames() {
+		if name == ProviderManual {
+			continue
+		}
+		cp, err := NewCloudProvider(name, token, accountID)
+		if err != nil {
+			continue
+		}
+
+		servers, err := cp.ListServers(ctx)
+		if err != nil {
+			candidates.Errors = append(candidates.Errors, fmt.Sprintf("servers %s: %v", name, err))
+			continue
+		}
+		for _, server := range servers {
+			if managedServer(configs, cp.Name(), server) != nil {
+				continue
+			}
+			candidates.Servers = append(candidates.Servers, UnmanagedServer{
+				Provider:   cp.Name(),
+				ID:         server.ID,
+				InstanceID: server.InstanceID,
+				Name:       server.Name,
+				PublicIPv4: server.PublicIPv4,
+				ServerType: server.ServerType,
+				Location:   server.Location,
+				CreatedAt:  server.CreatedAt,
+			})
+		}
+	}
+
+	sort.Slice(candidates.Servers, func(i, j int) bool {
+		a, b := candidates.Servers[i], candidates.Servers[j]
+		if a.Provider != b.Provider {
+			return a.Provider < b.Provider
+		}
+		return a.Name < b.Name
+	})
+}
+
+// managedServer returns the stored configuration of a provider server, matched
+// by provider ID or by public IP for servers that were added over SSH
+func managedServer(configs map[int]*VPSConfig, provider string, server CloudServer) *VPSConfig {
+	for _, config := range configs {
+		if providerName(config.Provider) == provider {
+			if config.ServerID == server.ID || (server.InstanceID != "" && config.ProviderInstanceID == server.InstanceID) {
+				return config
+			}
+		}
+		if server.PublicIPv4 != "" && config.PublicIPv4 == server.PublicIPv4 {
+			return config
+		}
+	}
+	return nil
+}
+
+// discoverDNS lists the zones that aren't configured and the A records of
+// configured zones that nothing stored in Xanthus accounts for
+func (s *AdoptionService) discoverDNS(token, accountID string, configs map[int]*VPSConfig, apps map[string]*models.Application, portForwards map[string][]storedPortForward, candidates *AdoptionCandidates) {
+	domainConfigs, err := s.kv.ListDomainSSLConfigs(token, accountID)
+	if err != nil {
+		candidates.Errors = append(candidates.Errors, fmt.Sprintf("dns: failed to list domains: %v", err))
+		return
+	}
+
+	zones, err := s.cf.ListZones(token)
+	if err != nil {
+		candidates.Errors = append(candidates.Errors, fmt.Sprintf("dns: failed to list zones: %v", err))
+		return
+	}
+
+	serverIDs := make(map[string]int)
+	for _, config := range configs {
+		if config.PublicIPv4 != "" {
+			serverIDs[config.PublicIPv4] = config.ServerID
+		}
+	}
+	known := make(map[string]bool)
+	for _, app := range apps {
+		if app.Domain == "" {
+			continue
+		}
+		known[hostName(app.Subdomain, app.Domain)] = true
+		for _, forward := range portForwards[app.ID] {
+			known[hostName(forward.Subdomain, forward.Domain)] = true
+		}
+	}
+
+	sort.Slice(zones, func(i, j int) bool { return zones[i].Name < zones[j].Name })
+	for _, zone := range zones {
+		if domainConfigs[zone.Name] == nil {
+			candidates.Zones = append(candidates.Zones, UnmanagedZone{Domain: zone.Name, ZoneID: zone.ID, Status: zone.Status})
+			continue
+		}
+
+		records, err := s.cf.GetDNSRecords(token, zone.ID)
+		if err != nil {
+			candidates.Errors = append(candidates.Errors, fmt.Sprintf("dns %s: %v", zone.Name, err))
+			continue
+		}
+		// The records created for a server itself are accounted for
+		serverHosts := map[string]bool{zone.Name: true, "*." + zone.Name: true, "www." + zone.Name: true}
+		for _, record := range records {
+			host := strings.TrimSuffix(record.Name, ".")
+			if record.Type != "A" || known[host] || serverHosts[host] {
+				continue
+			}
+			candidates.Records = append(candidates.Records, UnmanagedRecord{
+				Domain:   zone.Name,
+				Name:     host,
+				Content:  record.Content,
+				Proxied:  record.Proxied,
+				ServerID: serverIDs[record.Content],
+			})
+		}
+	}
+
+	sort.Slice(candidates.Records, func(i, j int) bool { return candidates.Records[i].Name < candidates.Records[j].Name })
+}
+
+// discoverReleases lists the Helm releases on managed servers that have no application
+func (s *AdoptionService) discoverReleases(ctx context.Context, token, accountID string, configs map[int]*VPSConfig, apps map[string]*models.Application, candidates *AdoptionCandidates) {
+	if len(configs) == 0 {
+		return
+	}
+
+	sshPrivateKey, err := s.keys.PrivateKey(token, accountID)
+	if err != nil {
+		candidates.Errors = append(candidates.Errors, fmt.Sprintf("releases: %v", err))
+		return
+	}
+
+	for _, id := range sortedServerIDs(configs) {
+		if ctx.Err() != nil {
+			return
+		}
+		config := configs[id]
+
+		releases, hosts, err := s.inspectReleases(config, sshPrivateKey)
+		if err != nil {
+			candidates.Errors = append(candidates.Errors, fmt.Sprintf("releases %s: %v", config.Name, err))
+			continue
+		}
+
+		claimed := claimedReleases(apps, config.ServerID)
+		for _, key := range sortedReleaseKeys(releases) {
+			release := releases[key]
+			if claimed[key] || release.Namespace == "kube-system" {
+				continue
+			}
+			candidates.Releases = append(candidates.Releases, UnmanagedRelease{
+				ServerID:   config.ServerID,
+				ServerName: config.Name,
+				Namespace:  release.Namespace,
+				Name:       release.Name,
+				Chart:      release.Chart,
+				AppVersion: release.AppVersion,
+				Status:     release.Status,
+				AppType:    s.inferAppType(release.Chart),
+				Hosts:      hosts[key],
+			})
+		}
+	}
+}
+
+// claimedReleases returns the namespace/name of the releases of a server's applications
+func claimedReleases(apps map[string]*models.Application, serverID int) map[string]bool {
+	vpsID := strconv.Itoa(serverID)
+	claimed := make(map[string]bool)
+	for _, app := range apps {
+		if app.VPSID == vpsID {
+			claimed[app.Namespace+"/"+app.HelmReleaseName()] = true
+		}
+	}
+	return claimed
+}
+
+// inspectReleases returns the Helm releases of a server's cluster and the
+// ingress hosts of each, keyed by namespace/name
+func (s *AdoptionService) inspectReleases(config *VPSConfig, sshPrivateKey string) (map[string]*helmRelease, map[string][]string, error) {
+	conn, err := s.ssh.GetOrCreateConnection(config.SSHAddress(), config.SSHUser, sshPrivateKey, config.ServerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	releases, err := listHelmReleases(s.ssh, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := s.ssh.ExecuteCommand(conn, "kubectl get ingress --all-namespaces --output json")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	var ingresses struct {
+		Items []struct {
+			Metadata struct {
+				Namespace   string            `json:"namespace"`
+				Labels      map[string]string `json:"labels"`
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+			Spec struct {
+				Rules []struct {
+					Host string `json:"host"`
+				} `json:"rules"`
+			} `json:"spec"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(result.Output), &ingresses); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse ingresses: %w", err)
+	}
+
+	hosts := make(map[string][]string)
+	for _, ingress := range ingresses.Items {
+		release := ingress.Metadata.Annotations["meta.helm.sh/release-name"]
+		if release == "" {
+			release = ingress.Metadata.Labels["app.kubernetes.io/instance"]
+		}
+		if release == "" {
+			continue
+		}
+		key := ingress.Metadata.Namespace + "/" + release
+		for _, rule := range ingress.Spec.Rules {
+			if rule.Host != "" {
+				hosts[key] = append(hosts[key], rule.Host)
+			}
+		}
+	}
+	return releases, hosts, nil
+}
+
+// inferAppType returns the catalog application whose chart a release was
+// installed from, e.g. "argo-cd-5.46.0" is argocd. Unknown charts give "".
+func (s *AdoptionService) inferAppType(chart string) string {
+	name := chart
+	if i := strings.LastIndex(chart, "-"); i > 0 && i+1 < len(chart) && chart[i+1] >= '0' && chart[i+1] <= '9' {
+		name = chart[:i]
+	}
+	if s.catalog == nil {
+		return ""
+	}
+	for _, app := range s.catalog.GetApplications() {
+		if path.Base(app.HelmChart.Chart) == name || app.ID == name {
+			return app.ID
+		}
+	}
+	return ""
+}
+
+// AdoptServer stores the configuration of a provider server Xanthus didn't
+// create. It installs the account's SSH key (using req.Password when the key
+// isn't trusted yet) and starts the K3s bootstrap unless K3s and Helm are
+// already installed.
+func (s *AdoptionService) AdoptServer(ctx context.Context, token, accountID string, req AdoptServerRequest) (*VPSConfig, error) {
+	if _, ok := CanonicalProviderName(req.Provider); !ok {
+		return nil, fmt.Errorf("%w: unsupported provider %q", ErrInvalidAdoptionRequest, req.Provider)
+	}
+	cp, err := NewCloudProvider(req.Provider, token, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if cp.Name() == ProviderManual {
+		return nil, fmt.Errorf("%w: servers without a provider are added with their SSH address", ErrInvalidAdoptionRequest)
+	}
+
+	if err := StartJobStep(ctx, fmt.Sprintf("Looking up server on %s", cp.Name())); err != nil {
+		return nil, err
+	}
+	servers, err := cp.ListServers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s servers: %w", cp.Name(), err)
+	}
+	var server *CloudServer
+	for i := range servers {
+		if servers[i].ID == req.ID {
+			server = &servers[i]
+			break
+		}
+	}
+	if server == nil {
+		return nil, fmt.Errorf("%w: %s server %d", ErrAdoptionNotFound, cp.Name(), req.ID)
+	}
+
+	configs, err := s.kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	if existing := managedServer(configs, cp.Name(), *server); existing != nil {
+		return nil, fmt.Errorf("%w: %s is managed as %s", ErrAlreadyManaged, server.Name, existing.Name)
+	}
+	if server.PublicIPv4 == "" {
+		return nil, fmt.Errorf("%w: %s has no public IPv4 address", ErrInvalidAdoptionRequest, server.Name)
+	}
+
+	defaults := s.provider.GetProviderDefaults(cp.Name())
+	if req.SSHUser == "" {
+		req.SSHUser = defaults.DefaultSSHUser
+	}
+	if req.SSHPort == 0 {
+		req.SSHPort = defaults.DefaultSSHPort
+	}
+
+	hourlyRate, monthlyRate, err := cp.Pricing(ctx, server.ServerType, server.Location)
+	if err != nil {
+		log.Printf("Warning: Could not get pricing for %s %s: %v", cp.Name(), server.ServerType, err)
+	}
+
+	vpsConfig := &VPSConfig{
+		ServerID:           server.ID,
+		Name:               server.Name,
+		ServerType:         server.ServerType,
+		Location:           server.Location,
+		PublicIPv4:         server.PublicIPv4,
+		CreatedAt:          server.CreatedAt,
+		SSHKeyName:         "xanthus-adopted-key",
+		SSHUser:            req.SSHUser,
+		SSHPort:            req.SSHPort,
+		HourlyRate:         hourlyRate,
+		MonthlyRate:        monthlyRate,
+		Provider:           cp.Name(),
+		ProviderInstanceID: server.InstanceID,
+		OCPU:               server.CPUs,
+		Memory:             server.MemoryGB,
+		Architecture:       server.Architecture,
+	}
+	if vpsConfig.CreatedAt == "" {
+		vpsConfig.CreatedAt = time.Now().Format(time.RFC3339)
+	}
+
+	sshKey, err := s.keys.KeyPair(token, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Password != "" {
+		if err := StartJobStep(ctx, "Installing SSH key"); err != nil {
+			return nil, err
+		}
+		passwordConn, err := s.ssh.ConnectWithPassword(vpsConfig.SSHAddress(), req.SSHUser, req.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect with password: %w", err)
+		}
+		err = installAuthorizedKey(s.ssh, passwordConn, sshKey.PublicKey)
+		passwordConn.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := StartJobStep(ctx, "Inspecting server"); err != nil {
+		return nil, err
+	}
+	conn, err := s.ssh.ConnectToVPS(vpsConfig.SSHAddress(), req.SSHUser, sshKey.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect with the Xanthus SSH key (add it to ~/.ssh/authorized_keys or provide a password): %w", err)
+	}
+	defer conn.Close()
+
+	facts, err := gatherManualServerFacts(s.ssh, conn)
+	if err != nil {
+		return nil, err
+	}
+	if vpsConfig.OCPU == 0 {
+		vpsConfig.OCPU = facts.CPUs
+	}
+	if vpsConfig.Memory == 0 {
+		vpsConfig.Memory = facts.MemoryGB
+	}
+	if vpsConfig.Architecture == "" {
+		vpsConfig.Architecture = facts.Architecture
+	}
+	vpsConfig.Timezone = facts.Timezone
+
+	result, err := s.ssh.ExecuteCommand(conn, "command -v k3s >/dev/null && command -v helm >/dev/null && echo installed || echo missing")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for K3s: %w", err)
+	}
+	installed := strings.TrimSpace(result.Output) == "installed"
+
+	if err := s.kv.StoreVPSConfig(token, accountID, vpsConfig); err != nil {
+		return nil, fmt.Errorf("failed to store VPS configuration: %w", err)
+	}
+
+	if installed {
+		JobLogf(ctx, "K3s and Helm are already installed on %s", vpsConfig.Name)
+		sudo := sudoPrefix(req.SSHUser)
+		if _, err := s.ssh.ExecuteCommand(conn, fmt.Sprintf("%smkdir -p /opt/xanthus && echo READY | %stee /opt/xanthus/status >/dev/null", sudo, sudo)); err != nil {
+			log.Printf("Warning: Failed to record setup status of %s: %v", vpsConfig.Name, err)
+		}
+	} else {
+		if err := StartJobStep(ctx, "Starting K3s bootstrap"); err != nil {
+			return nil, err
+		}
+		script, err := CloudInitScript(RenderCloudInit(cp.CloudInit(), CloudInitVars{Timezone: vpsConfig.Timezone}))
+		if err == nil {
+			err = startManualBootstrap(s.ssh, conn, req.SSHUser, script)
+		}
+		if err != nil {
+			if deleteErr := s.kv.DeleteVPSConfig(token, accountID, vpsConfig.ServerID); deleteErr != nil {
+				log.Printf("Warning: Failed to remove configuration of %s after bootstrap failed: %v", vpsConfig.Name, deleteErr)
+			}
+			return nil, err
+		}
+	}
+
+	log.Printf("✅ Adopted %s server %s as server %d", cp.Name(), vpsConfig.Name, vpsConfig.ServerID)
+	return vpsConfig, nil
+}
+
+// AdoptRelease stores an application for a Helm release on a managed server.
+// The release keeps its name and namespace; upgrades install the catalog chart
+// of the application type over it.
+func (s *AdoptionService) AdoptRelease(ctx context.Context, token, accountID string, req AdoptReleaseRequest) (*models.Application, error) {
+	if req.Namespace == "" || req.Release == "" {
+		return nil, fmt.Errorf("%w: namespace and release are required", ErrInvalidAdoptionRequest)
+	}
+
+	config, err := s.kv.GetVPSConfig(token, accountID, req.ServerID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: server %d", ErrAdoptionNotFound, req.ServerID)
+	}
+
+	apps, _, err := listStoredApplications(s.kv, token, accountID)
+	if err != nil {
+		return nil, err
+	}
+	key := req.Namespace + "/" + req.Release
+	if claimedReleases(apps, config.ServerID)[key] {
+		return nil, fmt.Errorf("%w: release %s on %s", ErrAlreadyManaged, key, config.Name)
+	}
+
+	sshPrivateKey, err := s.keys.PrivateKey(token, accountID)
+	if err != nil {
+		return nil, err
+	}
+	releases, hosts, err := s.inspectReleases(config, sshPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect the cluster on %s: %w", config.Name, err)
+	}
+	release := releases[key]
+	if release == nil {
+		return nil, fmt.Errorf("%w: release %s on %s", ErrAdoptionNotFound, key, config.Name)
+	}
+
+	appType := req.AppType
+	if appType == "" {
+		appType = s.inferAppType(release.Chart)
+	}
+	if appType == "" {
+		return nil, fmt.Errorf("%w: the application type of chart %s can't be inferred, specify it", ErrInvalidAdoptionRequest, release.Chart)
+	}
+	if s.catalog != nil {
+		if _, ok := s.catalog.GetApplicationByID(appType); !ok {
+			return nil, fmt.Errorf("%w: unknown application type %s", ErrInvalidAdoptionRequest, appType)
+		}
+	}
+
+	subdomain, domain := req.Subdomain, req.Domain
+	if domain == "" {
+		domainConfigs, err := s.kv.ListDomainSSLConfigs(token, accountID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list domains: %w", err)
+		}
+		subdomain, domain = splitManagedHost(hosts[key], domainConfigs)
+	}
+
+	name := req.Name
+	if name == "" {
+		name = release.Name
+	}
+
+	now := time.Now()
+	app := &models.Application{
+		ID:          fmt.Sprintf("app-%d", now.Unix()),
+		Name:        name,
+		Description: fmt.Sprintf("Adopted Helm release %s (%s)", release.Name, release.Chart),
+		AppType:     appType,
+		AppVersion:  release.AppVersion,
+		Subdomain:   subdomain,
+		Domain:      domain,
+		VPSID:       strconv.Itoa(config.ServerID),
+		VPSName:     config.Name,
+		Namespace:   release.Namespace,
+		Status:      ApplicationStatusFromHelm(release.Status),
+		ReleaseName: release.Name,
+		CreatedAt:   now.Format(time.RFC3339),
+		UpdatedAt:   now.Format(time.RFC3339),
+	}
+	if domain != "" {
+		app.URL = "https://" + hostName(subdomain, domain)
+	}
+	for i := 1; apps[app.ID] != nil; i++ {
+		app.ID = fmt.Sprintf("app-%d-%d", now.Unix(), i)
+	}
+
+	if err := s.kv.PutValue(token, accountID, "app:"+app.ID, app); err != nil {
+		return nil, fmt.Errorf("failed to store application: %w", err)
+	}
+
+	JobLogf(ctx, "Adopted Helm release %s on %s as application %s", key, config.Name, app.ID)
+	return app, nil
+}
+
+// splitManagedHost returns the subdomain and domain of the first host in a managed domain
+func splitManagedHost(hosts []string, domains map[string]*DomainSSLConfig) (string, string) {
+	for _, host := range hosts {
+		for domain := range domains {
+			if host == domain {
+				return "", domain
+			}
+			if strings.HasSuffix(host, "."+domain) {
+				return strings.TrimSuffix(host, "."+domain), domain
+			}
+		}
+	}
+	return "", ""
+}
+
+// hostName joins a subdomain and a domain; an empty or wildcard subdomain is the domain itself
+func hostName(subdomain, domain string) string {
+	if subdomain == "" || subdomain == "*" {
+		return domain
+	}
+	return subdomain + "." + domain
+}
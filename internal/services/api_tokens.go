@@ -0,0 +1,353 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// API token scopes. ScopeAll grants every scope.
+const (
+	ScopeAll            = "*"
+	ScopeVPSRead        = "vps:read"
+	ScopeVPSWrite       = "vps:write"
+	ScopeAppsRead       = "apps:read"
+	ScopeAppsWrite      = "apps:write"
+	ScopeDNSRead        = "dns:read"
+	ScopeDNSWrite       = "dns:write"
+	ScopeVersionsRead   = "versions:read"
+	ScopeVersionsWrite  = "versions:write"
+	ScopeTokensManage   = "tokens:manage"
+	ScopeUsersManage    = "users:manage"
+	ScopeKeysManage     = "keys:manage"
+	ScopeJobsRead       = "jobs:read"
+	ScopeJobsWrite      = "jobs:write"
+	ScopeReconcileRead  = "reconcile:read"
+	ScopeReconcileWrite = "reconcile:write"
+	ScopeStacksRead     = "stacks:read"
+	ScopeStacksWrite    = "stacks:write"
+	ScopeAdoptRead      = "adopt:read"
+	ScopeAdoptWrite     = "adopt:write"
+	ScopeBackupsRead    = "backups:read"
+	ScopeBackupsWrite   = "backups:write"
+	ScopeMetricsRead    = "metrics:read"
+)
+
+// APITokenScopes lists every scope that can be granted to an API token
+var APITokenScopes = []string{
+	ScopeVPSRead, ScopeVPSWrite,
+	ScopeAppsRead, ScopeAppsWrite,
+	ScopeDNSRead, ScopeDNSWrite,
+	ScopeVersionsRead, ScopeVersionsWrite,
+	ScopeJobsRead, ScopeJobsWrite,
+	ScopeReconcileRead, ScopeReconcileWrite,
+	ScopeStacksRead, ScopeStacksWrite,
+	ScopeAdoptRead, ScopeAdoptWrite,
+	ScopeBackupsRead, ScopeBackupsWrite,
+	ScopeMetricsRead,
+	ScopeTokensManage, ScopeUsersManage, ScopeKeysManage,
+}
+
+const (
+	// APITokenPrefix marks Xanthus-issued API tokens ("xan_<id>_<secret>")
+	APITokenPrefix = "xan_"
+
+	apiTokenKeyPrefix = "api_token:"
+
+	// lastUsedResolution limits how often last_used_at is written back to the store
+	lastUsedResolution = time.Minute
+)
+
+// API token errors
+var (
+	ErrAPITokenNotFound = errors.New("API token not found")
+	ErrAPITokenInvalid  = errors.New("invalid API token")
+	ErrAPITokenRevoked  = errors.New("API token has been revoked")
+	ErrAPITokenExpired  = errors.New("API token has expired")
+)
+
+// APIToken is a Xanthus-issued credential for the REST API.
+// Only the SHA-256 of the token is stored. The Cloudflare token the API token
+// acts on behalf of is encrypted with a key derived from the API token itself,
+// so it can only be recovered by someone presenting the token.
+type APIToken struct {
+	ID                  string     `json:"id"`
+	Name                string     `json:"name"`
+	AccountID           string     `json:"account_id"`
+	Scopes              []string   `json:"scopes"`
+	TokenHash           string     `json:"token_hash"`
+	EncryptedCredential string     `json:"encrypted_credential"`
+	CreatedAt           time.Time  `json:"created_at"`
+	ExpiresAt           *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt          *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt           *time.Time `json:"revoked_at,omitempty"`
+}
+
+// HasScope reports whether the token grants scope
+func (t *APIToken) HasScope(scope string) bool {
+	return HasScope(t.Scopes, scope)
+}
+
+// HasScope reports whether a scope list grants scope
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == ScopeAll || s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenService issues, lists, revokes and authenticates API tokens
+type APITokenService struct {
+	store utils.StateStore
+	mutex sync.Mutex
+}
+
+// NewAPITokenService creates an API token service.
+// Tokens must be resolvable before any Cloudflare credentials are known, so when
+// state lives in Cloudflare KV the token records are kept in the local data directory.
+func NewAPITokenService() *APITokenService {
+	store := utils.GetStateStore()
+	if utils.UsesCloudflareKV() {
+		local, err := utils.NewLocalStateStore(utils.DataDir())
+		if err != nil {
+			log.Printf("Warning: API tokens unavailable: %v", err)
+		} else {
+			store = local
+		}
+	}
+	return NewAPITokenServiceWithStore(store)
+}
+
+// NewAPITokenServiceWithStore creates an API token service backed by store
+func NewAPITokenServiceWithStore(store utils.StateStore) *APITokenService {
+	return &APITokenService{store: store}
+}
+
+// ValidateScopes checks that every requested scope is known
+func (s *APITokenService) ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+
+	for _, scope := range scopes {
+		if scope == ScopeAll {
+			continue
+		}
+		known := false
+		for _, valid := range APITokenScopes {
+			if scope == valid {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("unknown scope %q", scope)
+		}
+	}
+	return nil
+}
+
+// CreateToken issues a new API token acting with the given Cloudflare token.
+// The plaintext token is returned once and cannot be recovered later.
+func (s *APITokenService) CreateToken(cfToken, accountID, name string, scopes []string, ttl time.Duration) (*APIToken, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, "", fmt.Errorf("token name is required")
+	}
+	if err := s.ValidateScopes(scopes); err != nil {
+		return nil, "", err
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate token ID: %w", err)
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate token secret: %w", err)
+	}
+	rawToken := APITokenPrefix + id + "_" + secret
+
+	encrypted, err := utils.EncryptData(cfToken, rawToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encrypt credential: %w", err)
+	}
+
+	token := &APIToken{
+		ID:                  id,
+		Name:                strings.TrimSpace(name),
+		AccountID:           accountID,
+		Scopes:              scopes,
+		TokenHash:           hashAPIToken(rawToken),
+		EncryptedCredential: encrypted,
+		CreatedAt:           time.Now().UTC(),
+	}
+	if ttl > 0 {
+		expiresAt := token.CreatedAt.Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := s.save(token); err != nil {
+		return nil, "", err
+	}
+
+	return token, rawToken, nil
+}
+
+// ListTokens returns the tokens issued for an account, newest first
+func (s *APITokenService) ListTokens(accountID string) ([]APIToken, error) {
+	keys, err := s.store.ListKeys("", "", apiTokenKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API tokens: %w", err)
+	}
+
+	tokens := []APIToken{}
+	for _, key := range keys {
+		token, err := s.load(strings.TrimPrefix(key, apiTokenKeyPrefix))
+		if err != nil {
+			continue
+		}
+		if token.AccountID == accountID {
+			tokens = append(tokens, *token)
+		}
+	}
+
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.After(tokens[j].CreatedAt)
+	})
+	return tokens, nil
+}
+
+// RevokeToken revokes a token of the account. Revoked tokens are kept for auditing.
+func (s *APITokenService) RevokeToken(accountID, id string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, err := s.load(id)
+	if err != nil || token.AccountID != accountID {
+		return ErrAPITokenNotFound
+	}
+
+	if token.RevokedAt == nil {
+		now := time.Now().UTC()
+		token.RevokedAt = &now
+	}
+	return s.save(token)
+}
+
+// Authenticate validates a raw API token and returns it together with the
+// Cloudflare token it acts with
+func (s *APITokenService) Authenticate(rawToken string) (*APIToken, string, error) {
+	id, ok := parseAPITokenID(rawToken)
+	if !ok {
+		return nil, "", ErrAPITokenInvalid
+	}
+
+	token, err := s.load(id)
+	if err != nil {
+		return nil, "", ErrAPITokenInvalid
+	}
+
+	if subtle.ConstantTimeCompare([]byte(token.TokenHash), []byte(hashAPIToken(rawToken))) != 1 {
+		return nil, "", ErrAPITokenInvalid
+	}
+
+	now := time.Now().UTC()
+	if token.RevokedAt != nil {
+		return nil, "", ErrAPITokenRevoked
+	}
+	if token.ExpiresAt != nil && now.After(*token.ExpiresAt) {
+		return nil, "", ErrAPITokenExpired
+	}
+
+	cfToken, err := utils.DecryptData(token.EncryptedCredential, rawToken)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decrypt credential: %w", err)
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) > lastUsedResolution {
+		s.touch(id, now)
+	}
+
+	return token, cfToken, nil
+}
+
+// touch records when a token was last used; failures only affect bookkeeping
+func (s *APITokenService) touch(id string, usedAt time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	token, err := s.load(id)
+	if err != nil {
+		return
+	}
+	token.LastUsedAt = &usedAt
+	if err := s.save(token); err != nil {
+		log.Printf("Warning: failed to update last use of API token %s: %v", id, err)
+	}
+}
+
+// load reads a token record
+func (s *APITokenService) load(id string) (*APIToken, error) {
+	data, err := s.store.Get("", "", apiTokenKeyPrefix+id)
+	if err != nil {
+		return nil, err
+	}
+
+	var token APIToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, fmt.Errorf("failed to decode API token %s: %w", id, err)
+	}
+	return &token, nil
+}
+
+// save writes a token record
+func (s *APITokenService) save(token *APIToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to encode API token: %w", err)
+	}
+	if err := s.store.Put("", "", apiTokenKeyPrefix+token.ID, data); err != nil {
+		return fmt.Errorf("failed to store API token: %w", err)
+	}
+	return nil
+}
+
+// parseAPITokenID extracts the ID from "xan_<id>_<secret>"
+func parseAPITokenID(rawToken string) (string, bool) {
+	if !strings.HasPrefix(rawToken, APITokenPrefix) {
+		return "", false
+	}
+	parts := strings.Split(strings.TrimPrefix(rawToken, APITokenPrefix), "_")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", false
+	}
+	return parts[0], true
+}
+
+// hashAPIToken returns the hex SHA-256 of a raw token
+func hashAPIToken(rawToken string) string {
+	sum := sha256.Sum256([]byte(rawToken))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomHex returns n random bytes hex encoded
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
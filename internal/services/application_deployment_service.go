@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"embed"
 	"fmt"
 	"io/fs"
@@ -41,8 +42,9 @@ func NewApplicationDeploymentServiceWithEmbedFS(embedFS *embed.FS) *ApplicationD
 	}
 }
 
-// DeployApplication deploys an application using Helm and appropriate handlers
-func (ads *ApplicationDeploymentService) DeployApplication(token, accountID string, appData interface{}, predefinedApp *models.PredefinedApplication, appID string) error {
+// DeployApplication deploys an application using Helm and appropriate handlers,
+// reporting progress to the job ctx belongs to
+func (ads *ApplicationDeploymentService) DeployApplication(ctx context.Context, token, accountID string, appData interface{}, predefinedApp *models.PredefinedApplication, appID string) error {
 	log.Printf("🚀 CLAUDE DEBUG: DeployApplication called for %s with type %s", appID, predefinedApp.ID)
 	log.Printf("🚀 CLAUDE DEBUG: Helm config: %+v", predefinedApp.HelmChart)
 
@@ -60,25 +62,23 @@ func (ads *ApplicationDeploymentService) DeployApplication(token, accountID stri
 	vpsID := appDataMap["vps_id"].(string)
 
 	// Get VPS configuration for SSH details
-	var vpsConfig struct {
-		PublicIPv4 string `json:"public_ipv4"`
-		SSHUser    string `json:"ssh_user"`
+	if err := StartJobStep(ctx, "Connecting to VPS"); err != nil {
+		return err
 	}
+	var vpsConfig VPSConfig
 	err := kvService.GetValue(token, accountID, fmt.Sprintf("vps:%s:config", vpsID), &vpsConfig)
 	if err != nil {
 		return fmt.Errorf("failed to get VPS configuration: %v", err)
 	}
 
 	// Get SSH private key
-	var csrConfig struct {
-		PrivateKey string `json:"private_key"`
-	}
-	if err := kvService.GetValue(token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+	sshPrivateKey, err := NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
 		return fmt.Errorf("failed to get SSH private key: %v", err)
 	}
 
 	// Create SSH connection
-	conn, err := sshService.ConnectToVPS(vpsConfig.PublicIPv4, vpsConfig.SSHUser, csrConfig.PrivateKey)
+	conn, err := sshService.ConnectToVPS(vpsConfig.SSHAddress(), vpsConfig.SSHUser, sshPrivateKey)
 	if err != nil {
 		return fmt.Errorf("failed to connect to VPS: %v", err)
 	}
@@ -90,6 +90,9 @@ func (ads *ApplicationDeploymentService) DeployApplication(token, accountID stri
 	namespace := predefinedApp.ID
 
 	// Create namespace if it doesn't exist
+	if err := StartJobStep(ctx, "Preparing Helm chart"); err != nil {
+		return err
+	}
 	_, err = sshService.ExecuteCommand(conn, fmt.Sprintf("kubectl create namespace %s --dry-run=client -o yaml | kubectl apply -f -", namespace))
 	if err != nil {
 		return fmt.Errorf("failed to create namespace: %v", err)
@@ -103,10 +106,10 @@ func (ads *ApplicationDeploymentService) DeployApplication(token, accountID stri
 
 	if predefinedApp.ID == "code-server" && helmConfig.Repository == "local" {
 		log.Printf("DEBUG: Using LOCAL CHART for code-server")
-		deployErr = ads.deployCodeServerWithLocalChart(conn, predefinedApp, releaseName, namespace, subdomain, domain, vpsConfig.PublicIPv4, vpsConfig.SSHUser, csrConfig.PrivateKey)
+		deployErr = ads.deployCodeServerWithLocalChart(ctx, conn, predefinedApp, releaseName, namespace, subdomain, domain, vpsConfig.SSHAddress(), vpsConfig.SSHUser, sshPrivateKey)
 	} else {
 		log.Printf("DEBUG: Using EXTERNAL CHART - App: %s, Repo: %s", predefinedApp.ID, helmConfig.Repository)
-		deployErr = ads.deployWithExternalChart(conn, predefinedApp, releaseName, namespace, subdomain, domain)
+		deployErr = ads.deployWithExternalChart(ctx, conn, predefinedApp, releaseName, namespace, subdomain, domain)
 	}
 
 	if deployErr != nil {
@@ -120,7 +123,7 @@ func (ads *ApplicationDeploymentService) DeployApplication(token, accountID stri
 }
 
 // deployCodeServerWithLocalChart deploys code-server using the local Helm chart
-func (ads *ApplicationDeploymentService) deployCodeServerWithLocalChart(conn *SSHConnection, predefinedApp *models.PredefinedApplication, releaseName, namespace, subdomain, domain, vpsIP, sshUser, privateKey string) error {
+func (ads *ApplicationDeploymentService) deployCodeServerWithLocalChart(ctx context.Context, conn *SSHConnection, predefinedApp *models.PredefinedApplication, releaseName, namespace, subdomain, domain, vpsIP, sshUser, privateKey string) error {
 	// Get latest version
 	versionService := NewDefaultVersionService()
 	version, err := versionService.GetLatestVersion(predefinedApp.ID)
@@ -163,12 +166,16 @@ func (ads *ApplicationDeploymentService) deployCodeServerWithLocalChart(conn *SS
 	}
 
 	// Install using Helm (first check if release exists)
+	if err := StartJobStep(ctx, "Installing Helm release"); err != nil {
+		return err
+	}
 	checkCmd := fmt.Sprintf("helm list -n %s | grep %s", namespace, releaseName)
 	result, err := ads.sshService.ExecuteCommand(conn, checkCmd)
 
 	if err != nil || strings.TrimSpace(result.Output) == "" {
 		// Release doesn't exist, install it
 		return ads.helmService.InstallChart(
+			ctx,
 			vpsIP,
 			sshUser,
 			privateKey,
@@ -181,6 +188,7 @@ func (ads *ApplicationDeploymentService) deployCodeServerWithLocalChart(conn *SS
 	} else {
 		// Release exists, upgrade it
 		return ads.helmService.UpgradeChart(
+			ctx,
 			vpsIP,
 			sshUser,
 			privateKey,
@@ -194,7 +202,7 @@ func (ads *ApplicationDeploymentService) deployCodeServerWithLocalChart(conn *SS
 }
 
 // deployWithExternalChart deploys applications using external charts (ArgoCD, etc.)
-func (ads *ApplicationDeploymentService) deployWithExternalChart(conn *SSHConnection, predefinedApp *models.PredefinedApplication, releaseName, namespace, subdomain, domain string) error {
+func (ads *ApplicationDeploymentService) deployWithExternalChart(ctx context.Context, conn *SSHConnection, predefinedApp *models.PredefinedApplication, releaseName, namespace, subdomain, domain string) error {
 	var chartName string
 
 	// Handle different chart repository types based on HelmChart configuration
@@ -244,11 +252,22 @@ func (ads *ApplicationDeploymentService) deployWithExternalChart(conn *SSHConnec
 	}
 
 	// Install via Helm
+	if err := StartJobStep(ctx, "Installing Helm release"); err != nil {
+		return err
+	}
 	installCmd := fmt.Sprintf("helm install %s %s --namespace %s --values %s --wait --timeout 10m",
 		releaseName, chartName, namespace, valuesPath)
 
-	result, err := ads.sshService.ExecuteCommand(conn, installCmd)
+	output := JobOutput(ctx, "helm: ")
+	defer output.Close()
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	go watchReleasePods(watchCtx, ads.sshService, conn, namespace, releaseName)
+	result, err := ads.sshService.ExecuteCommandStream(ctx, conn, installCmd, output)
 	if err != nil {
+		if result == nil {
+			return fmt.Errorf("helm install failed: %v", err)
+		}
 		return fmt.Errorf("helm install failed: %v, output: %s", err, result.Output)
 	}
 
@@ -349,7 +368,7 @@ func (ads *ApplicationDeploymentService) copyFileToVPS(conn *SSHConnection, loca
 }
 
 // UpgradeApplication upgrades an existing application to a new version
-func (ads *ApplicationDeploymentService) UpgradeApplication(token, accountID, appID, version string) error {
+func (ads *ApplicationDeploymentService) UpgradeApplication(ctx context.Context, token, accountID, appID, version string) error {
 	// Get application details
 	appService := NewSimpleApplicationService()
 	app, err := appService.GetApplication(token, accountID, appID)
@@ -370,7 +389,7 @@ func (ads *ApplicationDeploymentService) UpgradeApplication(token, accountID, ap
 	log.Printf("Starting upgrade of application %s to version %s", appID, version)
 
 	// Perform the actual Helm upgrade
-	err = ads.performUpgrade(token, accountID, app)
+	err = ads.performUpgrade(ctx, token, accountID, app)
 	if err != nil {
 		// Update status to failed on error
 		app.Status = "failed"
@@ -390,7 +409,7 @@ func (ads *ApplicationDeploymentService) UpgradeApplication(token, accountID, ap
 }
 
 // performUpgrade performs the actual Helm upgrade operation
-func (ads *ApplicationDeploymentService) performUpgrade(token, accountID string, app *models.Application) error {
+func (ads *ApplicationDeploymentService) performUpgrade(ctx context.Context, token, accountID string, app *models.Application) error {
 	kvService := NewKVService()
 
 	// Get predefined application configuration using the catalog service
@@ -402,27 +421,25 @@ func (ads *ApplicationDeploymentService) performUpgrade(token, accountID string,
 	}
 
 	// Get VPS configuration for SSH details
-	var vpsConfig struct {
-		PublicIPv4 string `json:"public_ipv4"`
-		SSHUser    string `json:"ssh_user"`
-	}
+	var vpsConfig VPSConfig
 	err := kvService.GetValue(token, accountID, fmt.Sprintf("vps:%s:config", app.VPSID), &vpsConfig)
 	if err != nil {
 		return fmt.Errorf("failed to get VPS configuration: %v", err)
 	}
 
 	// Get SSH private key
-	var csrConfig struct {
-		PrivateKey string `json:"private_key"`
-	}
-	if err := kvService.GetValue(token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+	sshPrivateKey, err := NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
 		return fmt.Errorf("failed to get SSH private key: %v", err)
 	}
 
 	// Generate release name and namespace (same as deployment)
 	// Release name starts with subdomain as specified in requirements
-	releaseName := fmt.Sprintf("%s-%s", app.Subdomain, app.AppType)
-	namespace := app.AppType // Use type-based namespace as per CLAUDE.md
+	releaseName := app.HelmReleaseName()
+	namespace := app.Namespace
+	if namespace == "" {
+		namespace = app.AppType
+	}
 
 	// Generate updated values file with new version
 	valuesContent, err := ads.generateValuesFromTemplate(predefinedApp, app.AppVersion, app.Subdomain, app.Domain, releaseName)
@@ -431,8 +448,11 @@ func (ads *ApplicationDeploymentService) performUpgrade(token, accountID string,
 	}
 
 	// Establish SSH connection
+	if err := StartJobStep(ctx, "Preparing Helm chart"); err != nil {
+		return err
+	}
 	sshService := NewSSHService()
-	conn, err := sshService.ConnectToVPS(vpsConfig.PublicIPv4, vpsConfig.SSHUser, csrConfig.PrivateKey)
+	conn, err := sshService.ConnectToVPS(vpsConfig.SSHAddress(), vpsConfig.SSHUser, sshPrivateKey)
 	if err != nil {
 		return fmt.Errorf("failed to connect to VPS: %v", err)
 	}
@@ -484,18 +504,33 @@ func (ads *ApplicationDeploymentService) performUpgrade(token, accountID string,
 		return fmt.Errorf("failed to upload values file: %v", err)
 	}
 
+	// Upload the application's values overrides, which take precedence
+	var overridesPath string
+	if strings.TrimSpace(app.Values) != "" {
+		overridesPath = fmt.Sprintf("/tmp/%s-overrides.yaml", releaseName)
+		_, err = sshService.ExecuteCommand(conn, fmt.Sprintf("cat > %s << 'EOF'\n%s\nEOF", overridesPath, app.Values))
+		if err != nil {
+			return fmt.Errorf("failed to upload values overrides: %v", err)
+		}
+	}
+
 	// Perform Helm upgrade
+	if err := StartJobStep(ctx, "Upgrading Helm release"); err != nil {
+		return err
+	}
 	helmService := NewHelmService()
 
 	err = helmService.UpgradeChart(
-		vpsConfig.PublicIPv4,
+		ctx,
+		vpsConfig.SSHAddress(),
 		vpsConfig.SSHUser,
-		csrConfig.PrivateKey,
+		sshPrivateKey,
 		releaseName,
 		chartName,
 		app.AppVersion,
 		namespace,
 		valuesPath,
+		overridesPath,
 	)
 	if err != nil {
 		return fmt.Errorf("helm upgrade failed: %v", err)
@@ -728,7 +763,7 @@ func (ads *ApplicationDeploymentService) storeEncryptedPassword(token, accountID
 	kvService := NewKVService()
 
 	// Encrypt the password
-	encryptedPassword, err := utils.EncryptData(password, token)
+	encryptedPassword, err := utils.EncryptSecret(token, accountID, password)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt password: %v", err)
 	}
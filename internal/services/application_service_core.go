@@ -1,17 +1,17 @@
 package services
 
 import (
+	"context"
 	"embed"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/chrishham/xanthus/internal/models"
-	"github.com/chrishham/xanthus/internal/utils"
 )
 
 // SimpleApplicationService provides core CRUD operations for applications using existing services
@@ -37,65 +37,24 @@ func NewSimpleApplicationServiceWithEmbedFS(embedFS *embed.FS) *SimpleApplicatio
 func (s *SimpleApplicationService) ListApplications(token, accountID string) ([]models.Application, error) {
 	kvService := NewKVService()
 
-	// Get the Xanthus namespace ID (with caching)
-	cacheKey := "legacy_ns:" + accountID // Use accountID for user isolation
-	namespaceID, exists := kvService.namespaceIDCache[cacheKey]
-
-	if !exists {
-		var err error
-		namespaceID, err = kvService.GetXanthusNamespaceID(token, accountID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get namespace ID: %w", err)
-		}
-		kvService.namespaceIDCache[cacheKey] = namespaceID
-	}
-
 	// List all keys with app: prefix
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/storage/kv/namespaces/%s/keys?prefix=app:",
-		accountID, namespaceID)
-	fmt.Printf("Listing keys from KV with URL: %s\n", url)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	keyNames, err := kvService.ListKeys(token, accountID, "app:")
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var keysResp struct {
-		Success bool `json:"success"`
-		Result  []struct {
-			Name string `json:"name"`
-		} `json:"result"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&keysResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if !keysResp.Success {
-		return nil, fmt.Errorf("KV API failed")
+		return nil, err
 	}
 
-	fmt.Printf("Found %d keys with app: prefix\n", len(keysResp.Result))
-	for i, key := range keysResp.Result {
-		fmt.Printf("Key %d: %s\n", i, key.Name)
+	fmt.Printf("Found %d keys with app: prefix\n", len(keyNames))
+	for i, keyName := range keyNames {
+		fmt.Printf("Key %d: %s\n", i, keyName)
 	}
 
 	// Filter out password keys first
 	var appKeys []string
-	for _, key := range keysResp.Result {
-		if !strings.HasSuffix(key.Name, ":password") {
-			appKeys = append(appKeys, key.Name)
+	for _, keyName := range keyNames {
+		if !strings.HasSuffix(keyName, ":password") {
+			appKeys = append(appKeys, keyName)
 		} else {
-			fmt.Printf("Skipping password key: %s\n", key.Name)
+			fmt.Printf("Skipping password key: %s\n", keyName)
 		}
 	}
 
@@ -168,10 +127,11 @@ func (s *SimpleApplicationService) GetApplication(token, accountID, appID string
 	return nil, fmt.Errorf("application not found: %s", appID)
 }
 
-// CreateApplication creates a new application
-func (s *SimpleApplicationService) CreateApplication(token, accountID string, appData interface{}, predefinedApp *models.PredefinedApplication) (*models.Application, error) {
+// CreateApplication creates a new application and deploys it. A failed
+// deployment is recorded in the application's status rather than returned.
+func (s *SimpleApplicationService) CreateApplication(ctx context.Context, token, accountID string, appData interface{}, predefinedApp *models.PredefinedApplication) (*models.Application, error) {
 	// Parse application data based on type
-	var subdomain, domain, vpsID, vpsName, description string
+	var subdomain, domain, vpsID, vpsName, description, values string
 
 	switch data := appData.(type) {
 	case map[string]interface{}:
@@ -190,6 +150,9 @@ func (s *SimpleApplicationService) CreateApplication(token, accountID string, ap
 		if desc, ok := data["description"].(string); ok {
 			description = desc
 		}
+		if vals, ok := data["values"].(string); ok {
+			values = vals
+		}
 	default:
 		return nil, fmt.Errorf("invalid application data format")
 	}
@@ -221,6 +184,7 @@ func (s *SimpleApplicationService) CreateApplication(token, accountID string, ap
 		Namespace:   namespace,
 		Status:      "Creating",
 		URL:         fmt.Sprintf("https://%s.%s", subdomain, domain),
+		Values:      values,
 		CreatedAt:   time.Now().Format(time.RFC3339),
 		UpdatedAt:   time.Now().Format(time.RFC3339),
 	}
@@ -239,7 +203,7 @@ func (s *SimpleApplicationService) CreateApplication(token, accountID string, ap
 	fmt.Printf("Starting deployment for application %s\n", appID)
 	// Convert back to map for deployment
 	dataMap := appData.(map[string]interface{})
-	err := s.deployApplication(token, accountID, dataMap, predefinedApp, appID)
+	err := s.deployApplication(ctx, token, accountID, dataMap, predefinedApp, appID)
 	if err != nil {
 		fmt.Printf("Deployment failed for %s: %v\n", appID, err)
 		app.Status = "Failed"
@@ -274,8 +238,59 @@ func (s *SimpleApplicationService) UpdateApplication(token, accountID string, ap
 	return nil
 }
 
+// RedeployApplication installs a stored application again with its recorded
+// version, values, release name and namespace, e.g. on a rebuilt server. Like
+// CreateApplication it records the outcome in the application's status; the
+// deployment error is returned as well.
+func (s *SimpleApplicationService) RedeployApplication(ctx context.Context, token, accountID string, app *models.Application, predefinedApp *models.PredefinedApplication) error {
+	kvService := NewKVService()
+	kvKey := fmt.Sprintf("app:%s", app.ID)
+
+	predefined := *predefinedApp
+	if app.AppVersion != "" {
+		predefined.Version = app.AppVersion
+	}
+	namespace := app.Namespace
+	if namespace == "" {
+		namespace = predefined.ID
+	}
+
+	app.Status = "Deploying"
+	app.UpdatedAt = time.Now().Format(time.RFC3339)
+	if err := kvService.PutValue(token, accountID, kvKey, app); err != nil {
+		return fmt.Errorf("failed to update application: %w", err)
+	}
+
+	err := s.deployApplication(ctx, token, accountID, map[string]interface{}{
+		"subdomain":    app.Subdomain,
+		"domain":       app.Domain,
+		"vps_id":       app.VPSID,
+		"values":       app.Values,
+		"release_name": app.HelmReleaseName(),
+		"namespace":    namespace,
+	}, &predefined, app.ID)
+	if err != nil {
+		app.Status = "Failed"
+		app.ErrorMsg = err.Error()
+	} else {
+		app.Status = "Running"
+		app.ErrorMsg = ""
+	}
+
+	// Generated passwords belong to the previous installation and are read again on demand
+	passwordKey := fmt.Sprintf("app:%s:password", app.ID)
+	kvService.DeleteValue(token, accountID, passwordKey) // Ignore error - password key might not exist
+
+	app.UpdatedAt = time.Now().Format(time.RFC3339)
+	if putErr := kvService.PutValue(token, accountID, kvKey, app); putErr != nil {
+		fmt.Printf("Warning: Failed to update application status: %v\n", putErr)
+	}
+
+	return err
+}
+
 // DeleteApplication deletes an application and cleans up all resources
-func (s *SimpleApplicationService) DeleteApplication(token, accountID, appID string) error {
+func (s *SimpleApplicationService) DeleteApplication(ctx context.Context, token, accountID, appID string) error {
 	kvService := NewKVService()
 
 	// First, get the application details before deletion
@@ -285,12 +300,18 @@ func (s *SimpleApplicationService) DeleteApplication(token, accountID, appID str
 	}
 
 	// Delete Helm deployment from VPS
+	if err := StartJobStep(ctx, "Uninstalling Helm release"); err != nil {
+		return err
+	}
 	if err := s.deleteApplicationDeployment(token, accountID, app); err != nil {
 		fmt.Printf("Warning: Failed to delete Helm deployment for %s: %v\n", appID, err)
 		// Continue with cleanup even if Helm deletion fails
 	}
 
 	// Delete DNS A record from Cloudflare
+	if err := StartJobStep(ctx, "Removing DNS records"); err != nil {
+		return err
+	}
 	if err := s.deleteApplicationDNS(token, app); err != nil {
 		fmt.Printf("Warning: Failed to delete DNS record for %s: %v\n", appID, err)
 		// Continue with cleanup even if DNS deletion fails
@@ -304,7 +325,15 @@ func (s *SimpleApplicationService) DeleteApplication(token, accountID, appID str
 		}
 	}
 
+	// Stop scheduled backups; the snapshots stay in their bucket
+	if err := NewBackupService().DeletePolicy(ctx, token, accountID, appID); err != nil && !errors.Is(err, ErrBackupNotFound) {
+		fmt.Printf("Warning: Failed to delete backup policy for %s: %v\n", appID, err)
+	}
+
 	// Delete the main application key from KV
+	if err := StartJobStep(ctx, "Removing application record"); err != nil {
+		return err
+	}
 	kvKey := fmt.Sprintf("app:%s", appID)
 	if err := kvService.DeleteValue(token, accountID, kvKey); err != nil {
 		return fmt.Errorf("failed to delete application from KV: %w", err)
@@ -334,24 +363,21 @@ func (s *SimpleApplicationService) deleteApplicationDeployment(token, accountID
 		return fmt.Errorf("failed to get VPS config: %w", err)
 	}
 
-	// Get SSH private key from KV
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		PrivateKey string `json:"private_key"`
-	}
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+	// Get SSH private key
+	sshPrivateKey, err := NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
 		return fmt.Errorf("failed to get SSH key: %w", err)
 	}
 
 	// Establish SSH connection
-	conn, err := sshService.GetOrCreateConnection(vpsConfig.PublicIPv4, vpsConfig.SSHUser, csrConfig.PrivateKey, serverID)
+	conn, err := sshService.GetOrCreateConnection(vpsConfig.SSHAddress(), vpsConfig.SSHUser, sshPrivateKey, serverID)
 	if err != nil {
 		return fmt.Errorf("failed to connect to VPS: %w", err)
 	}
 
 	// Uninstall Helm release
 	// Release name starts with subdomain as specified in requirements
-	releaseName := fmt.Sprintf("%s-%s", app.Subdomain, app.AppType)
+	releaseName := app.HelmReleaseName()
 	uninstallCmd := fmt.Sprintf("helm uninstall %s --namespace %s", releaseName, app.Namespace)
 
 	result, err := sshService.ExecuteCommand(conn, uninstallCmd)
@@ -456,13 +482,9 @@ func (s *SimpleApplicationService) deleteApplicationPortForwards(token, accountI
 		// Continue with DNS cleanup even if we can't clean up Kubernetes resources
 	} else {
 		// Get SSH private key
-		client := &http.Client{Timeout: 10 * time.Second}
-		var csrConfig struct {
-			PrivateKey string `json:"private_key"`
-		}
-		if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err == nil {
+		if sshPrivateKey, err := NewSSHKeyService().PrivateKey(token, accountID); err == nil {
 			// Establish SSH connection
-			if conn, err := sshService.GetOrCreateConnection(vpsConfig.PublicIPv4, vpsConfig.SSHUser, csrConfig.PrivateKey, serverID); err == nil {
+			if conn, err := sshService.GetOrCreateConnection(vpsConfig.SSHAddress(), vpsConfig.SSHUser, sshPrivateKey, serverID); err == nil {
 				// Clean up Kubernetes resources for each port forward
 				for _, pf := range portForwards {
 					// Delete Kubernetes ingress
@@ -676,24 +698,21 @@ func (s *SimpleApplicationService) GetApplicationRealTimeStatus(token, accountID
 		return "Unknown", fmt.Errorf("failed to get VPS config: %w", err)
 	}
 
-	// Get SSH private key from KV
-	client := &http.Client{Timeout: 10 * time.Second}
-	var csrConfig struct {
-		PrivateKey string `json:"private_key"`
-	}
-	if err := utils.GetKVValue(client, token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+	// Get SSH private key
+	sshPrivateKey, err := NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
 		return "Unknown", fmt.Errorf("failed to get SSH key: %w", err)
 	}
 
 	// Establish SSH connection
-	conn, err := sshService.GetOrCreateConnection(vpsConfig.PublicIPv4, vpsConfig.SSHUser, csrConfig.PrivateKey, serverID)
+	conn, err := sshService.GetOrCreateConnection(vpsConfig.SSHAddress(), vpsConfig.SSHUser, sshPrivateKey, serverID)
 	if err != nil {
 		return "Unknown", fmt.Errorf("failed to connect to VPS: %w", err)
 	}
 
 	// Check Helm deployment status
 	// Release name starts with subdomain as specified in requirements
-	releaseName := fmt.Sprintf("%s-%s", app.Subdomain, app.AppType)
+	releaseName := app.HelmReleaseName()
 	statusCmd := fmt.Sprintf("helm status %s -n %s --output json 2>/dev/null || echo '{\"info\":{\"status\":\"not-found\"}}'",
 		releaseName, app.Namespace)
 
@@ -714,18 +733,22 @@ func (s *SimpleApplicationService) GetApplicationRealTimeStatus(token, accountID
 		return "Unknown", nil
 	}
 
-	// Map Helm status to application status
-	switch strings.ToLower(helmStatus.Info.Status) {
+	return ApplicationStatusFromHelm(helmStatus.Info.Status), nil
+}
+
+// ApplicationStatusFromHelm maps the status of a Helm release to an application status
+func ApplicationStatusFromHelm(status string) string {
+	switch strings.ToLower(status) {
 	case "deployed":
-		return "Running", nil
+		return "Running"
 	case "failed":
-		return "Failed", nil
+		return "Failed"
 	case "pending-install", "pending-upgrade":
-		return "Deploying", nil
+		return "Deploying"
 	case "not-found":
-		return "Not Deployed", nil
+		return "Not Deployed"
 	default:
-		return helmStatus.Info.Status, nil
+		return status
 	}
 }
 
@@ -756,57 +779,17 @@ func (s *SimpleApplicationService) checkExistingArgoCDInstallation(token, accoun
 
 // getAllApplications retrieves all applications from KV store
 func (s *SimpleApplicationService) getAllApplications(token, accountID string, kvService *KVService) ([]models.Application, error) {
-	// Get the Xanthus namespace ID (with caching)
-	cacheKey := "legacy_ns:" + accountID // Use accountID for user isolation
-	namespaceID, exists := kvService.namespaceIDCache[cacheKey]
-
-	if !exists {
-		var err error
-		namespaceID, err = kvService.GetXanthusNamespaceID(token, accountID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get namespace ID: %w", err)
-		}
-		kvService.namespaceIDCache[cacheKey] = namespaceID
-	}
-
 	// List all keys with app: prefix
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/storage/kv/namespaces/%s/keys?prefix=app:",
-		accountID, namespaceID)
-
-	req, err := http.NewRequest("GET", url, nil)
+	keyNames, err := kvService.ListKeys(token, accountID, "app:")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var keysResp struct {
-		Success bool `json:"success"`
-		Result  []struct {
-			Name string `json:"name"`
-		} `json:"result"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&keysResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if !keysResp.Success {
-		return nil, fmt.Errorf("KV API failed")
+		return nil, err
 	}
 
 	// Filter out password keys first
 	var appKeys []string
-	for _, key := range keysResp.Result {
-		if !strings.HasSuffix(key.Name, ":password") {
-			appKeys = append(appKeys, key.Name)
+	for _, keyName := range keyNames {
+		if !strings.HasSuffix(keyName, ":password") {
+			appKeys = append(appKeys, keyName)
 		}
 	}
 
@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"os"
@@ -13,7 +14,7 @@ import (
 )
 
 // deployApplication deploys a predefined application using its Helm configuration
-func (s *SimpleApplicationService) deployApplication(token, accountID string, appData map[string]interface{}, predefinedApp *models.PredefinedApplication, appID string) error {
+func (s *SimpleApplicationService) deployApplication(ctx context.Context, token, accountID string, appData map[string]interface{}, predefinedApp *models.PredefinedApplication, appID string) error {
 	kvService := NewKVService()
 	sshService := NewSSHService()
 
@@ -29,27 +30,27 @@ func (s *SimpleApplicationService) deployApplication(token, accountID string, ap
 	}
 
 	// Get VPS configuration for SSH details and timezone
-	var vpsConfig struct {
-		PublicIPv4 string `json:"public_ipv4"`
-		SSHUser    string `json:"ssh_user"`
-		Timezone   string `json:"timezone"`
+	if err := StartJobStep(ctx, "Connecting to VPS"); err != nil {
+		return err
 	}
+	var vpsConfig VPSConfig
 	err := kvService.GetValue(token, accountID, fmt.Sprintf("vps:%s:config", vpsID), &vpsConfig)
 	if err != nil {
 		return fmt.Errorf("failed to get VPS configuration: %v", err)
 	}
+	if vpsConfig.IsAgent() {
+		return fmt.Errorf("%s is an agent node, deploy to its server node %d", vpsConfig.Name, vpsConfig.ClusterServerID)
+	}
 
 	// Get SSH private key
-	var csrConfig struct {
-		PrivateKey string `json:"private_key"`
-	}
-	if err := kvService.GetValue(token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+	sshPrivateKey, err := NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
 		return fmt.Errorf("failed to get SSH private key: %v", err)
 	}
 
 	// Create SSH connection
 	vpsIDInt, _ := strconv.Atoi(vpsID)
-	conn, err := sshService.GetOrCreateConnection(vpsConfig.PublicIPv4, vpsConfig.SSHUser, csrConfig.PrivateKey, vpsIDInt)
+	conn, err := sshService.GetOrCreateConnection(vpsConfig.SSHAddress(), vpsConfig.SSHUser, sshPrivateKey, vpsIDInt)
 	if err != nil {
 		return fmt.Errorf("failed to connect to VPS: %v", err)
 	}
@@ -58,8 +59,18 @@ func (s *SimpleApplicationService) deployApplication(token, accountID string, ap
 	// Release name starts with subdomain as specified in requirements
 	releaseName := fmt.Sprintf("%s-%s", subdomain, predefinedApp.ID)
 	namespace := predefinedApp.ID
+	// Redeployed applications keep the names they were installed or adopted with
+	if name, ok := appData["release_name"].(string); ok && name != "" {
+		releaseName = name
+	}
+	if ns, ok := appData["namespace"].(string); ok && ns != "" {
+		namespace = ns
+	}
 
 	// Create namespace if it doesn't exist
+	if err := StartJobStep(ctx, "Preparing Helm chart"); err != nil {
+		return err
+	}
 	_, err = sshService.ExecuteCommand(conn, fmt.Sprintf("kubectl create namespace %s --dry-run=client -o yaml | kubectl apply -f -", namespace))
 	if err != nil {
 		return fmt.Errorf("failed to create namespace: %v", err)
@@ -122,12 +133,34 @@ func (s *SimpleApplicationService) deployApplication(token, accountID string, ap
 		return fmt.Errorf("failed to upload values file: %v", err)
 	}
 
+	// Overrides from the request take precedence over the generated values
+	valuesArgs := "--values " + valuesPath
+	if overrides, _ := appData["values"].(string); strings.TrimSpace(overrides) != "" {
+		overridesPath := fmt.Sprintf("/tmp/%s-overrides.yaml", releaseName)
+		_, err = sshService.ExecuteCommand(conn, fmt.Sprintf("cat > %s << 'EOF'\n%s\nEOF", overridesPath, overrides))
+		if err != nil {
+			return fmt.Errorf("failed to upload values overrides: %v", err)
+		}
+		valuesArgs += " --values " + overridesPath
+	}
+
 	// Install via Helm
-	installCmd := fmt.Sprintf("helm install %s %s --namespace %s --values %s --wait --timeout 10m",
-		releaseName, chartName, namespace, valuesPath)
+	if err := StartJobStep(ctx, "Installing Helm release"); err != nil {
+		return err
+	}
+	installCmd := fmt.Sprintf("helm install %s %s --namespace %s %s --wait --timeout 10m",
+		releaseName, chartName, namespace, valuesArgs)
 
-	result, err := sshService.ExecuteCommand(conn, installCmd)
+	output := JobOutput(ctx, "helm: ")
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	go watchReleasePods(watchCtx, sshService, conn, namespace, releaseName)
+	result, err := sshService.ExecuteCommandStream(ctx, conn, installCmd, output)
+	stopWatch()
+	output.Close()
 	if err != nil {
+		if result == nil {
+			return fmt.Errorf("helm install failed: %v", err)
+		}
 		// Check for resource exhaustion and clean up if detected
 		if deploymentErr := s.handleDeploymentFailure(conn, sshService, releaseName, namespace, result.Output, err); deploymentErr != nil {
 			return deploymentErr
@@ -136,7 +169,10 @@ func (s *SimpleApplicationService) deployApplication(token, accountID string, ap
 	}
 
 	// Configure SSL certificates on VPS - this is required for HTTPS access
-	if err := s.configureVPSSSL(token, accountID, domain, vpsConfig, csrConfig); err != nil {
+	if err := StartJobStep(ctx, "Configuring TLS"); err != nil {
+		return err
+	}
+	if err := s.configureVPSSSL(token, accountID, domain, vpsConfig, sshPrivateKey); err != nil {
 		return fmt.Errorf("failed to configure SSL certificates on VPS: %v", err)
 	}
 
@@ -151,7 +187,10 @@ func (s *SimpleApplicationService) deployApplication(token, accountID string, ap
 	}
 
 	// Configure DNS record for the application
-	if err := s.configureApplicationDNS(token, subdomain, domain, vpsConfig.PublicIPv4); err != nil {
+	if err := StartJobStep(ctx, "Configuring DNS"); err != nil {
+		return err
+	}
+	if err := s.configureApplicationDNS(token, subdomain, domain, vpsConfig.PublicIPv4, !domainConfig.DNSOnly); err != nil {
 		return fmt.Errorf("failed to configure DNS for application: %v", err)
 	}
 
@@ -162,13 +201,7 @@ func (s *SimpleApplicationService) deployApplication(token, accountID string, ap
 }
 
 // configureVPSSSL configures SSL certificates on the VPS for the given domain
-func (s *SimpleApplicationService) configureVPSSSL(token, accountID, domain string, vpsConfig struct {
-	PublicIPv4 string `json:"public_ipv4"`
-	SSHUser    string `json:"ssh_user"`
-	Timezone   string `json:"timezone"`
-}, csrConfig struct {
-	PrivateKey string `json:"private_key"`
-}) error {
+func (s *SimpleApplicationService) configureVPSSSL(token, accountID, domain string, vpsConfig VPSConfig, sshPrivateKey string) error {
 	kvService := NewKVService()
 	sshService := NewSSHService()
 	cfService := NewCloudflareService()
@@ -209,7 +242,7 @@ func (s *SimpleApplicationService) configureVPSSSL(token, accountID, domain stri
 	}
 
 	// Connect to VPS and configure SSL certificates
-	conn, err := sshService.GetOrCreateConnection(vpsConfig.PublicIPv4, vpsConfig.SSHUser, csrConfig.PrivateKey, 0)
+	conn, err := sshService.GetOrCreateConnection(vpsConfig.SSHAddress(), vpsConfig.SSHUser, sshPrivateKey, 0)
 	if err != nil {
 		return fmt.Errorf("failed to connect to VPS: %v", err)
 	}
@@ -225,8 +258,9 @@ func (s *SimpleApplicationService) configureVPSSSL(token, accountID, domain stri
 	return nil
 }
 
-// configureApplicationDNS creates DNS A record for the application subdomain
-func (s *SimpleApplicationService) configureApplicationDNS(token, subdomain, domain, vpsIP string) error {
+// configureApplicationDNS creates DNS A record for the application subdomain,
+// behind the Cloudflare proxy unless the domain is configured DNS only
+func (s *SimpleApplicationService) configureApplicationDNS(token, subdomain, domain, vpsIP string, proxied bool) error {
 	cfService := NewCloudflareService()
 
 	// Get zone ID for the domain
@@ -237,15 +271,13 @@ func (s *SimpleApplicationService) configureApplicationDNS(token, subdomain, dom
 
 	// Handle bare domain (blank or asterisk subdomain)
 	if subdomain == "" || subdomain == "*" {
-		// Create A record for bare domain
-		_, err := cfService.CreateDNSRecord(token, zoneID, "A", domain, vpsIP, true)
-		return err
+		// Point A record for bare domain, which exists already when redeploying
+		return cfService.PointARecord(token, zoneID, domain, vpsIP, proxied)
 	}
 
-	// Create A record for subdomain
+	// Point A record for subdomain
 	recordName := fmt.Sprintf("%s.%s", subdomain, domain)
-	_, err = cfService.CreateDNSRecord(token, zoneID, "A", recordName, vpsIP, true)
-	return err
+	return cfService.PointARecord(token, zoneID, recordName, vpsIP, proxied)
 }
 
 // retrieveApplicationPassword retrieves and stores the auto-generated password for applications that create them
@@ -354,25 +386,20 @@ func (s *SimpleApplicationService) detectVPSTimezone(token, accountID, vpsID str
 	sshService := NewSSHService()
 
 	// Get VPS configuration for SSH details
-	var vpsConfig struct {
-		PublicIPv4 string `json:"public_ipv4"`
-		SSHUser    string `json:"ssh_user"`
-	}
+	var vpsConfig VPSConfig
 	err := kvService.GetValue(token, accountID, fmt.Sprintf("vps:%s:config", vpsID), &vpsConfig)
 	if err != nil {
 		return ""
 	}
 
 	// Get SSH private key
-	var csrConfig struct {
-		PrivateKey string `json:"private_key"`
-	}
-	if err := kvService.GetValue(token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+	sshPrivateKey, err := NewSSHKeyService().PrivateKey(token, accountID)
+	if err != nil {
 		return ""
 	}
 
 	// Create SSH connection
-	conn, err := sshService.ConnectToVPS(vpsConfig.PublicIPv4, vpsConfig.SSHUser, csrConfig.PrivateKey)
+	conn, err := sshService.ConnectToVPS(vpsConfig.SSHAddress(), vpsConfig.SSHUser, sshPrivateKey)
 	if err != nil {
 		return ""
 	}
@@ -392,7 +419,7 @@ func (s *SimpleApplicationService) storeEncryptedPassword(token, accountID, appI
 	kvService := NewKVService()
 
 	// Encrypt the password
-	encryptedPassword, err := utils.EncryptData(password, token)
+	encryptedPassword, err := utils.EncryptSecret(token, accountID, password)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt password: %v", err)
 	}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"sort"
+	"sync"
+)
+
+// BackgroundAccount is a Cloudflare account background jobs act on
+type BackgroundAccount struct {
+	Token     string
+	AccountID string
+}
+
+// BackgroundAccountRegistry remembers the Cloudflare credentials scheduled jobs
+// act with: the token Xanthus was set up with, registered at startup, plus the
+// accounts of API tokens as they are used and XANTHUS_CLOUDFLARE_TOKEN if set.
+type BackgroundAccountRegistry struct {
+	mu       sync.RWMutex
+	accounts map[string]string // account ID -> token
+}
+
+// NewBackgroundAccountRegistry creates an empty registry
+func NewBackgroundAccountRegistry() *BackgroundAccountRegistry {
+	return &BackgroundAccountRegistry{accounts: make(map[string]string)}
+}
+
+var backgroundAccounts = NewBackgroundAccountRegistry()
+
+// GetBackgroundAccounts returns the registry shared by the auth middleware and background jobs
+func GetBackgroundAccounts() *BackgroundAccountRegistry {
+	return backgroundAccounts
+}
+
+// Register records the latest token seen for an account
+func (r *BackgroundAccountRegistry) Register(token, accountID string) {
+	if token == "" || accountID == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.accounts[accountID] = token
+}
+
+// Forget removes an account, e.g. after its token stopped working
+func (r *BackgroundAccountRegistry) Forget(accountID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.accounts, accountID)
+}
+
+// Accounts returns the registered accounts ordered by account ID
+func (r *BackgroundAccountRegistry) Accounts() []BackgroundAccount {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	accounts := make([]BackgroundAccount, 0, len(r.accounts))
+	for accountID, token := range r.accounts {
+		accounts = append(accounts, BackgroundAccount{Token: token, AccountID: accountID})
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].AccountID < accounts[j].AccountID })
+	return accounts
+}
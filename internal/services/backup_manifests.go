@@ -0,0 +1,150 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chrishham/xanthus/internal/models"
+)
+
+// resticImage runs backups and restores; restore --delete needs restic 0.17
+const resticImage = "restic/restic:0.17.3"
+
+// backupSecretYAML renders the Secret holding the restic environment of an application
+func backupSecretYAML(app *models.Application, env map[string]string) string {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var data strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&data, "  %s: %s\n", name, base64.StdEncoding.EncodeToString([]byte(env[name])))
+	}
+
+	return fmt.Sprintf(`apiVersion: v1
+kind: Secret
+metadata:
+  name: %s
+  namespace: %s
+  labels:
+%s
+type: Opaque
+data:
+%s`, backupResourceName(app), app.Namespace, indent(backupLabels(app), 4), data.String())
+}
+
+// backupCronJobYAML renders the CronJob that backs up the volumes of a policy
+// and forgets the snapshots its retention doesn't keep
+func backupCronJobYAML(app *models.Application, policy BackupPolicy, timezone string) string {
+	forget := fmt.Sprintf("restic forget --host %s --prune", app.ID)
+	if policy.Retention.KeepLast > 0 {
+		forget += fmt.Sprintf(" --keep-last %d", policy.Retention.KeepLast)
+	}
+	if policy.Retention.KeepDaily > 0 {
+		forget += fmt.Sprintf(" --keep-daily %d", policy.Retention.KeepDaily)
+	}
+	if policy.Retention.KeepWeekly > 0 {
+		forget += fmt.Sprintf(" --keep-weekly %d", policy.Retention.KeepWeekly)
+	}
+	script := strings.Join([]string{
+		"set -e",
+		"restic cat config >/dev/null 2>&1 || restic init",
+		fmt.Sprintf("restic backup --host %s --tag xanthus /data", app.ID),
+		forget,
+	}, "\n")
+
+	timeZone := ""
+	if timezone != "" {
+		timeZone = fmt.Sprintf("  timeZone: %q\n", timezone)
+	}
+
+	return fmt.Sprintf(`apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: %s
+  namespace: %s
+  labels:
+%s
+spec:
+  schedule: %q
+%s  concurrencyPolicy: Forbid
+  successfulJobsHistoryLimit: 3
+  failedJobsHistoryLimit: 3
+  jobTemplate:
+    spec:
+      backoffLimit: 0
+      template:
+        metadata:
+          labels:
+%s
+        spec:
+%s`, backupResourceName(app), app.Namespace, indent(backupLabels(app), 4), policy.Schedule, timeZone,
+		indent(backupLabels(app), 12), indent(resticPodSpec(app, script, policy.Volumes, true), 10))
+}
+
+// resticJobYAML renders a one-off Job running script with the application's
+// restic environment and its volumes mounted under /data
+func resticJobYAML(app *models.Application, name, script string, volumes []string, readOnly bool) string {
+	return fmt.Sprintf(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: %s
+  namespace: %s
+  labels:
+%s
+spec:
+  backoffLimit: 0
+  ttlSecondsAfterFinished: 86400
+  template:
+    metadata:
+      labels:
+%s
+    spec:
+%s`, name, app.Namespace, indent(backupLabels(app), 4), indent(backupLabels(app), 8), indent(resticPodSpec(app, script, volumes, readOnly), 6))
+}
+
+// resticPodSpec renders a pod spec running script in the restic image
+func resticPodSpec(app *models.Application, script string, volumes []string, readOnly bool) string {
+	var mounts, claims strings.Builder
+	for i, volume := range volumes {
+		fmt.Fprintf(&mounts, "  - name: data-%d\n    mountPath: /data/%s\n    readOnly: %t\n", i, volume, readOnly)
+		fmt.Fprintf(&claims, "- name: data-%d\n  persistentVolumeClaim:\n    claimName: %s\n", i, volume)
+	}
+
+	spec := fmt.Sprintf(`restartPolicy: Never
+containers:
+- name: restic
+  image: %s
+  command: ["/bin/sh", "-c"]
+  args:
+  - |
+%s
+  envFrom:
+  - secretRef:
+      name: %s
+`, resticImage, indent(script, 4), backupResourceName(app))
+	if len(volumes) > 0 {
+		spec += "  volumeMounts:\n" + mounts.String() + "volumes:\n" + claims.String()
+	}
+	return strings.TrimSuffix(spec, "\n")
+}
+
+func backupLabels(app *models.Application) string {
+	return fmt.Sprintf("app.kubernetes.io/managed-by: xanthus\nxanthus.io/backup: %s", app.ID)
+}
+
+// indent prefixes every line of text with n spaces
+func indent(text string, n int) string {
+	prefix := strings.Repeat(" ", n)
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
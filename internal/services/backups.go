@@ -0,0 +1,643 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+const (
+	backupTargetKeyPrefix = "backup:target:"
+	backupPolicyKeyPrefix = "backup:policy:"
+
+	// DefaultBackupSchedule is the cron schedule of policies that don't set one
+	DefaultBackupSchedule = "0 3 * * *"
+
+	backupJobTimeout     = time.Hour
+	backupJobPollEvery   = 5 * time.Second
+	backupScaleDownLimit = 5 * time.Minute
+)
+
+var (
+	// ErrInvalidBackupRequest is wrapped by backup errors caused by the request
+	ErrInvalidBackupRequest = errors.New("invalid backup request")
+	// ErrBackupNotFound is returned for unknown backup targets and applications without a backup policy
+	ErrBackupNotFound = errors.New("backup not found")
+	// ErrBackupTargetInUse is returned when deleting a target that policies still use
+	ErrBackupTargetInUse = errors.New("backup target is in use")
+)
+
+var (
+	backupTargetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,62}$`)
+	cronFieldPattern        = regexp.MustCompile(`^[0-9*/,\-]+$`)
+	snapshotIDPattern       = regexp.MustCompile(`^([0-9a-f]{8,64}|latest)$`)
+)
+
+// BackupTarget is an S3-compatible bucket restic repositories are kept in.
+// Its secrets are stored encrypted and never returned.
+type BackupTarget struct {
+	Name      string `json:"name"`
+	Endpoint  string `json:"endpoint"` // e.g. "https://s3.eu-central-1.amazonaws.com" or "http://minio.local:9000"
+	Bucket    string `json:"bucket"`
+	Region    string `json:"region,omitempty"`
+	AccessKey string `json:"access_key"`
+	CreatedAt string `json:"created_at"`
+}
+
+// BackupTargetRequest creates or replaces a backup target
+type BackupTargetRequest struct {
+	Name      string
+	Endpoint  string
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	// Password encrypts the restic repositories; backups can't be read without it
+	Password string
+}
+
+// storedBackupTarget is a backup target as kept in the state store
+type storedBackupTarget struct {
+	BackupTarget
+	EncryptedSecretKey string `json:"encrypted_secret_key"`
+	EncryptedPassword  string `json:"encrypted_password"`
+}
+
+// BackupRetention says which snapshots `restic forget` keeps
+type BackupRetention struct {
+	KeepLast   int `json:"keep_last,omitempty"`
+	KeepDaily  int `json:"keep_daily,omitempty"`
+	KeepWeekly int `json:"keep_weekly,omitempty"`
+}
+
+// BackupPolicy backs up the persistent volumes of an application on a schedule
+type BackupPolicy struct {
+	AppID     string          `json:"app_id"`
+	Target    string          `json:"target"`
+	Schedule  string          `json:"schedule"` // cron expression, in the server's timezone
+	Retention BackupRetention `json:"retention"`
+	Volumes   []string        `json:"volumes"` // PersistentVolumeClaims backed up
+	UpdatedAt string          `json:"updated_at"`
+}
+
+// BackupSnapshot is a restic snapshot of an application's volumes
+type BackupSnapshot struct {
+	ID      string    `json:"id"`
+	ShortID string    `json:"short_id"`
+	Time    time.Time `json:"time"`
+	Paths   []string  `json:"paths"`
+	Tags    []string  `json:"tags,omitempty"`
+}
+
+// BackupService backs up the persistent volumes of applications with restic
+// jobs on their cluster, into S3-compatible buckets, and restores them
+type BackupService struct {
+	kv      *KVService
+	keys    *SSHKeyService
+	ssh     *SSHService
+	keyring *utils.Keyring // nil for the process-wide keyring, loaded on first use
+}
+
+// NewBackupService creates a backup service on the process-wide state store
+func NewBackupService() *BackupService {
+	return NewBackupServiceWithStore(utils.GetStateStore(), nil)
+}
+
+// NewBackupServiceWithStore creates a backup service on the given state store
+// and keyring; a nil keyring stands for the process-wide one
+func NewBackupServiceWithStore(store utils.StateStore, keyring *utils.Keyring) *BackupService {
+	return &BackupService{
+		kv:      NewKVServiceWithStore(store),
+		keys:    NewSSHKeyServiceWithStore(store, keyring),
+		ssh:     NewSSHService(),
+		keyring: keyring,
+	}
+}
+
+func (s *BackupService) ring() *utils.Keyring {
+	if s.keyring == nil {
+		return utils.GetKeyring()
+	}
+	return s.keyring
+}
+
+// ListTargets returns the backup targets, without their secrets
+func (s *BackupService) ListTargets(token, accountID string) ([]BackupTarget, error) {
+	keys, err := s.kv.ListKeys(token, accountID, backupTargetKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup targets: %w", err)
+	}
+	sort.Strings(keys)
+
+	targets := make([]BackupTarget, 0, len(keys))
+	for _, key := range keys {
+		var stored storedBackupTarget
+		if err := s.kv.GetValue(token, accountID, key, &stored); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		targets = append(targets, stored.BackupTarget)
+	}
+	return targets, nil
+}
+
+// PutTarget creates a backup target or replaces the one with the same name.
+// Policies using it pick up the change when they are set again.
+func (s *BackupService) PutTarget(token, accountID string, req BackupTargetRequest) (*BackupTarget, error) {
+	if !backupTargetNamePattern.MatchString(req.Name) {
+		return nil, fmt.Errorf("%w: target names are lowercase letters, digits and dashes", ErrInvalidBackupRequest)
+	}
+	endpoint, err := url.Parse(req.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("%w: endpoint must be an http or https URL", ErrInvalidBackupRequest)
+	}
+	if req.Bucket == "" || req.AccessKey == "" || req.SecretKey == "" || req.Password == "" {
+		return nil, fmt.Errorf("%w: bucket, access key, secret key and password are required", ErrInvalidBackupRequest)
+	}
+
+	stored := storedBackupTarget{BackupTarget: BackupTarget{
+		Name:      req.Name,
+		Endpoint:  strings.TrimSuffix(req.Endpoint, "/"),
+		Bucket:    strings.Trim(req.Bucket, "/"),
+		Region:    req.Region,
+		AccessKey: req.AccessKey,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}}
+	if stored.EncryptedSecretKey, err = s.ring().Encrypt(token, accountID, req.SecretKey); err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret key: %w", err)
+	}
+	if stored.EncryptedPassword, err = s.ring().Encrypt(token, accountID, req.Password); err != nil {
+		return nil, fmt.Errorf("failed to encrypt repository password: %w", err)
+	}
+
+	if err := s.kv.PutValue(token, accountID, backupTargetKeyPrefix+req.Name, stored); err != nil {
+		return nil, fmt.Errorf("failed to store backup target: %w", err)
+	}
+	return &stored.BackupTarget, nil
+}
+
+// DeleteTarget deletes a backup target no policy uses. The backups in its bucket are kept.
+func (s *BackupService) DeleteTarget(token, accountID, name string) error {
+	if _, err := s.target(token, accountID, name); err != nil {
+		return err
+	}
+
+	policies, err := s.ListPolicies(token, accountID)
+	if err != nil {
+		return err
+	}
+	for _, policy := range policies {
+		if policy.Target == name {
+			return fmt.Errorf("%w: application %s backs up to %s", ErrBackupTargetInUse, policy.AppID, name)
+		}
+	}
+
+	return s.kv.DeleteValue(token, accountID, backupTargetKeyPrefix+name)
+}
+
+// ListPolicies returns the backup policies of every application
+func (s *BackupService) ListPolicies(token, accountID string) ([]BackupPolicy, error) {
+	keys, err := s.kv.ListKeys(token, accountID, backupPolicyKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup policies: %w", err)
+	}
+	sort.Strings(keys)
+
+	policies := make([]BackupPolicy, 0, len(keys))
+	for _, key := range keys {
+		var policy BackupPolicy
+		if err := s.kv.GetValue(token, accountID, key, &policy); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// GetPolicy returns the backup policy of an application
+func (s *BackupService) GetPolicy(token, accountID, appID string) (*BackupPolicy, error) {
+	var policy BackupPolicy
+	if err := s.kv.GetValue(token, accountID, backupPolicyKeyPrefix+appID, &policy); err != nil {
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: application %s has no backup policy", ErrBackupNotFound, appID)
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// SetPolicy validates a backup policy, installs its schedule as a CronJob
+// next to the application and stores it. Setting the policy again, e.g. on a
+// rebuilt server, reinstalls the CronJob.
+func (s *BackupService) SetPolicy(ctx context.Context, token, accountID string, policy BackupPolicy) (*BackupPolicy, error) {
+	if policy.Schedule == "" {
+		policy.Schedule = DefaultBackupSchedule
+	}
+	if !validCronSchedule(policy.Schedule) {
+		return nil, fmt.Errorf("%w: schedule %q is not a cron expression", ErrInvalidBackupRequest, policy.Schedule)
+	}
+	if policy.Retention.KeepLast < 0 || policy.Retention.KeepDaily < 0 || policy.Retention.KeepWeekly < 0 {
+		return nil, fmt.Errorf("%w: retention counts can't be negative", ErrInvalidBackupRequest)
+	}
+	if policy.Retention == (BackupRetention{}) {
+		policy.Retention = BackupRetention{KeepDaily: 7, KeepWeekly: 4}
+	}
+
+	target, err := s.target(token, accountID, policy.Target)
+	if err != nil {
+		return nil, err
+	}
+	app, err := s.application(token, accountID, policy.AppID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := StartJobStep(ctx, "Finding volumes"); err != nil {
+		return nil, err
+	}
+	cluster, err := s.connect(token, accountID, app)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := s.volumes(cluster, app)
+	if err != nil {
+		return nil, err
+	}
+	if len(volumes) == 0 {
+		return nil, fmt.Errorf("%w: %s has no persistent volumes to back up", ErrInvalidBackupRequest, app.Name)
+	}
+	policy.Volumes = volumes
+
+	if err := StartJobStep(ctx, "Installing backup schedule"); err != nil {
+		return nil, err
+	}
+	if err := s.applySecret(token, accountID, cluster, app, target); err != nil {
+		return nil, err
+	}
+	cronJob := backupCronJobYAML(app, policy, cluster.config.Timezone)
+	if err := applyManifest(s.ssh, cluster.conn, cronJob); err != nil {
+		return nil, fmt.Errorf("failed to install backup CronJob: %w", err)
+	}
+
+	policy.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := s.kv.PutValue(token, accountID, backupPolicyKeyPrefix+policy.AppID, policy); err != nil {
+		return nil, fmt.Errorf("failed to store backup policy: %w", err)
+	}
+	JobLogf(ctx, "Backing up %s of %s on %q", strings.Join(volumes, ", "), app.Name, policy.Schedule)
+	return &policy, nil
+}
+
+// DeletePolicy stops the scheduled backups of an application. Its snapshots are kept.
+func (s *BackupService) DeletePolicy(ctx context.Context, token, accountID, appID string) error {
+	if _, err := s.GetPolicy(token, accountID, appID); err != nil {
+		return err
+	}
+
+	if app, err := s.application(token, accountID, appID); err == nil {
+		if cluster, err := s.connect(token, accountID, app); err == nil {
+			name := backupResourceName(app)
+			cmd := fmt.Sprintf("kubectl delete cronjob,secret --namespace %s %s --ignore-not-found=true", app.Namespace, name)
+			if _, err := s.ssh.ExecuteCommand(cluster.conn, cmd); err != nil {
+				log.Printf("Warning: Failed to delete backup schedule of %s: %v", appID, err)
+			}
+		} else {
+			log.Printf("Warning: Failed to delete backup schedule of %s: %v", appID, err)
+		}
+	}
+
+	return s.kv.DeleteValue(token, accountID, backupPolicyKeyPrefix+appID)
+}
+
+// RunBackup backs up an application now, outside its schedule
+func (s *BackupService) RunBackup(ctx context.Context, token, accountID, appID string) error {
+	app, cluster, err := s.policyCluster(token, accountID, appID)
+	if err != nil {
+		return err
+	}
+
+	if err := StartJobStep(ctx, "Backing up volumes"); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d", backupResourceName(app), time.Now().Unix())
+	cmd := fmt.Sprintf("kubectl create job --namespace %s --from=cronjob/%s %s", app.Namespace, backupResourceName(app), name)
+	if result, err := s.ssh.ExecuteCommand(cluster.conn, cmd); err != nil {
+		return fmt.Errorf("failed to start backup job: %v, output: %s", err, commandOutput(result))
+	}
+	_, err = s.waitForJob(ctx, cluster, app.Namespace, name)
+	return err
+}
+
+// ListSnapshots returns the snapshots of an application, newest first
+func (s *BackupService) ListSnapshots(ctx context.Context, token, accountID, appID string) ([]BackupSnapshot, error) {
+	app, cluster, err := s.policyCluster(token, accountID, appID)
+	if err != nil {
+		return nil, err
+	}
+
+	script := fmt.Sprintf("restic cat config >/dev/null 2>&1 || { echo '[]'; exit 0; }\nrestic snapshots --json --host %s", app.ID)
+	name := fmt.Sprintf("%s-snapshots-%d", backupResourceName(app), time.Now().Unix())
+	if err := applyManifest(s.ssh, cluster.conn, resticJobYAML(app, name, script, nil, true)); err != nil {
+		return nil, fmt.Errorf("failed to start snapshot listing: %w", err)
+	}
+	defer s.ssh.ExecuteCommand(cluster.conn, fmt.Sprintf("kubectl delete job --namespace %s %s --ignore-not-found=true", app.Namespace, name))
+
+	output, err := s.waitForJob(ctx, cluster, app.Namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return parseSnapshots(output)
+}
+
+// Restore replaces the contents of an application's volumes with a snapshot
+// ("latest" for the newest). The application is scaled down while restoring
+// and scaled back up afterwards, also when the restore fails.
+func (s *BackupService) Restore(ctx context.Context, token, accountID, appID, snapshotID string) error {
+	if !snapshotIDPattern.MatchString(snapshotID) {
+		return fmt.Errorf("%w: invalid snapshot ID %q", ErrInvalidBackupRequest, snapshotID)
+	}
+	app, cluster, err := s.policyCluster(token, accountID, appID)
+	if err != nil {
+		return err
+	}
+	volumes, err := s.volumes(cluster, app)
+	if err != nil {
+		return err
+	}
+	if len(volumes) == 0 {
+		return fmt.Errorf("%w: %s has no persistent volumes to restore", ErrInvalidBackupRequest, app.Name)
+	}
+
+	if err := StartJobStep(ctx, fmt.Sprintf("Stopping %s", app.Name)); err != nil {
+		return err
+	}
+	replicas, err := s.scaleDown(cluster, app)
+	defer func() {
+		for workload, count := range replicas {
+			cmd := fmt.Sprintf("kubectl scale --namespace %s %s --replicas=%d", app.Namespace, workload, count)
+			if _, err := s.ssh.ExecuteCommand(cluster.conn, cmd); err != nil {
+				JobLogf(ctx, "Warning: Failed to scale %s back to %d replicas: %v", workload, count, err)
+			}
+		}
+	}()
+	if err != nil {
+		return err
+	}
+
+	if err := StartJobStep(ctx, fmt.Sprintf("Restoring snapshot %s", snapshotID)); err != nil {
+		return err
+	}
+	script := fmt.Sprintf("restic restore %s --host %s --target / --delete", snapshotID, app.ID)
+	name := fmt.Sprintf("%s-restore-%d", backupResourceName(app), time.Now().Unix())
+	if err := applyManifest(s.ssh, cluster.conn, resticJobYAML(app, name, script, volumes, false)); err != nil {
+		return fmt.Errorf("failed to start restore job: %w", err)
+	}
+	if _, err := s.waitForJob(ctx, cluster, app.Namespace, name); err != nil {
+		return err
+	}
+
+	if err := StartJobStep(ctx, fmt.Sprintf("Starting %s", app.Name)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// backupCluster is an SSH connection to the server of an application
+type backupCluster struct {
+	config *VPSConfig
+	conn   *SSHConnection
+}
+
+func (s *BackupService) target(token, accountID, name string) (*storedBackupTarget, error) {
+	var target storedBackupTarget
+	if err := s.kv.GetValue(token, accountID, backupTargetKeyPrefix+name, &target); err != nil {
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: backup target %q", ErrBackupNotFound, name)
+		}
+		return nil, err
+	}
+	return &target, nil
+}
+
+func (s *BackupService) application(token, accountID, appID string) (*models.Application, error) {
+	var app models.Application
+	if err := s.kv.GetValue(token, accountID, "app:"+appID, &app); err != nil {
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: application %s", ErrBackupNotFound, appID)
+		}
+		return nil, err
+	}
+	if app.Namespace == "" {
+		app.Namespace = app.AppType
+	}
+	return &app, nil
+}
+
+func (s *BackupService) connect(token, accountID string, app *models.Application) (*backupCluster, error) {
+	serverID, err := strconv.Atoi(app.VPSID)
+	if err != nil {
+		return nil, fmt.Errorf("application %s has no server", app.Name)
+	}
+	config, err := s.kv.GetVPSConfig(token, accountID, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VPS config: %w", err)
+	}
+	privateKey, err := s.keys.PrivateKey(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSH private key: %w", err)
+	}
+	conn, err := s.ssh.GetOrCreateConnection(config.SSHAddress(), config.SSHUser, privateKey, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", config.Name, err)
+	}
+	return &backupCluster{config: config, conn: conn}, nil
+}
+
+// policyCluster loads an application with a backup policy and connects to its server
+func (s *BackupService) policyCluster(token, accountID, appID string) (*models.Application, *backupCluster, error) {
+	if _, err := s.GetPolicy(token, accountID, appID); err != nil {
+		return nil, nil, err
+	}
+	app, err := s.application(token, accountID, appID)
+	if err != nil {
+		return nil, nil, err
+	}
+	cluster, err := s.connect(token, accountID, app)
+	if err != nil {
+		return nil, nil, err
+	}
+	return app, cluster, nil
+}
+
+// volumes lists the PersistentVolumeClaims of the application's Helm release
+func (s *BackupService) volumes(cluster *backupCluster, app *models.Application) ([]string, error) {
+	cmd := fmt.Sprintf("kubectl get pvc --namespace %s -l app.kubernetes.io/instance=%s -o jsonpath='{.items[*].metadata.name}'", app.Namespace, app.HelmReleaseName())
+	result, err := s.ssh.ExecuteCommand(cluster.conn, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes of %s: %v, output: %s", app.Name, err, commandOutput(result))
+	}
+	volumes := strings.Fields(result.Output)
+	sort.Strings(volumes)
+	return volumes, nil
+}
+
+// applySecret installs the repository location and credentials next to the application
+func (s *BackupService) applySecret(token, accountID string, cluster *backupCluster, app *models.Application, target *storedBackupTarget) error {
+	secretKey, err := s.ring().Decrypt(token, accountID, target.EncryptedSecretKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt secret key of %s: %w", target.Name, err)
+	}
+	password, err := s.ring().Decrypt(token, accountID, target.EncryptedPassword)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt repository password of %s: %w", target.Name, err)
+	}
+
+	env := map[string]string{
+		"RESTIC_REPOSITORY":     resticRepository(&target.BackupTarget, app),
+		"RESTIC_PASSWORD":       password,
+		"AWS_ACCESS_KEY_ID":     target.AccessKey,
+		"AWS_SECRET_ACCESS_KEY": secretKey,
+	}
+	if target.Region != "" {
+		env["AWS_DEFAULT_REGION"] = target.Region
+	}
+	if err := applyManifest(s.ssh, cluster.conn, backupSecretYAML(app, env)); err != nil {
+		return fmt.Errorf("failed to install backup credentials: %w", err)
+	}
+	return nil
+}
+
+// scaleDown scales the Deployments and StatefulSets of the application's
+// release to zero and waits for their pods to stop. It returns the replica
+// counts to restore, also when it fails halfway.
+func (s *BackupService) scaleDown(cluster *backupCluster, app *models.Application) (map[string]int, error) {
+	selector := "app.kubernetes.io/instance=" + app.HelmReleaseName()
+	cmd := fmt.Sprintf(`kubectl get deployment,statefulset --namespace %s -l %s -o jsonpath='{range .items[*]}{.kind}/{.metadata.name}={.spec.replicas}{"\n"}{end}'`, app.Namespace, selector)
+	result, err := s.ssh.ExecuteCommand(cluster.conn, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list workloads of %s: %v, output: %s", app.Name, err, commandOutput(result))
+	}
+
+	replicas := make(map[string]int)
+	for _, line := range strings.Split(strings.TrimSpace(result.Output), "\n") {
+		workload, count, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(count)
+		if err != nil || n == 0 {
+			continue
+		}
+		workload = strings.ToLower(workload)
+		cmd := fmt.Sprintf("kubectl scale --namespace %s %s --replicas=0", app.Namespace, workload)
+		if result, err := s.ssh.ExecuteCommand(cluster.conn, cmd); err != nil {
+			return replicas, fmt.Errorf("failed to scale down %s: %v, output: %s", workload, err, commandOutput(result))
+		}
+		replicas[workload] = n
+	}
+
+	cmd = fmt.Sprintf("kubectl wait --for=delete pod --namespace %s -l %s --timeout=%s", app.Namespace, selector, backupScaleDownLimit)
+	if result, err := s.ssh.ExecuteCommand(cluster.conn, cmd); err != nil {
+		return replicas, fmt.Errorf("pods of %s did not stop: %v, output: %s", app.Name, err, commandOutput(result))
+	}
+	return replicas, nil
+}
+
+// waitForJob waits for a Kubernetes Job to finish, logs its output to the
+// current job and returns the output
+func (s *BackupService) waitForJob(ctx context.Context, cluster *backupCluster, namespace, name string) (string, error) {
+	deadline := time.Now().Add(backupJobTimeout)
+	status := fmt.Sprintf("kubectl get job --namespace %s %s -o jsonpath='{.status.succeeded}/{.status.failed}'", namespace, name)
+	for {
+		result, err := s.ssh.ExecuteCommand(cluster.conn, status)
+		if err != nil {
+			return "", fmt.Errorf("failed to get status of job %s: %v, output: %s", name, err, commandOutput(result))
+		}
+		succeeded, failed, _ := strings.Cut(strings.TrimSpace(result.Output), "/")
+		if succeeded != "" && succeeded != "0" || failed != "" && failed != "0" {
+			logs, _ := s.ssh.ExecuteCommand(cluster.conn, fmt.Sprintf("kubectl logs --namespace %s job/%s", namespace, name))
+			output := commandOutput(logs)
+			for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+				if line != "" && !strings.HasPrefix(line, "[") {
+					JobLogf(ctx, "restic: %s", line)
+				}
+			}
+			if succeeded == "" || succeeded == "0" {
+				return output, fmt.Errorf("job %s failed: %s", name, lastLine(output))
+			}
+			return output, nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("job %s did not finish within %s", name, backupJobTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(backupJobPollEvery):
+		}
+	}
+}
+
+// resticRepository returns the repository URL of an application in a target
+func resticRepository(target *BackupTarget, app *models.Application) string {
+	return fmt.Sprintf("s3:%s/%s/xanthus/%s", target.Endpoint, target.Bucket, app.ID)
+}
+
+// backupResourceName names the CronJob and Secret of an application's backups
+func backupResourceName(app *models.Application) string {
+	return "xanthus-backup-" + app.ID
+}
+
+// parseSnapshots parses the output of `restic snapshots --json`, newest first
+func parseSnapshots(output string) ([]BackupSnapshot, error) {
+	start := strings.Index(output, "[")
+	if start < 0 {
+		return nil, fmt.Errorf("unexpected restic output: %s", lastLine(output))
+	}
+	var snapshots []BackupSnapshot
+	if err := json.Unmarshal([]byte(output[start:]), &snapshots); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshots: %w", err)
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Time.After(snapshots[j].Time) })
+	return snapshots, nil
+}
+
+// validCronSchedule reports whether schedule is a five-field cron expression or a macro like @daily
+func validCronSchedule(schedule string) bool {
+	switch schedule {
+	case "@yearly", "@annually", "@monthly", "@weekly", "@daily", "@midnight", "@hourly":
+		return true
+	}
+	fields := strings.Fields(schedule)
+	if len(fields) != 5 {
+		return false
+	}
+	for _, field := range fields {
+		if !cronFieldPattern.MatchString(field) {
+			return false
+		}
+	}
+	return true
+}
+
+func commandOutput(result *CommandResult) string {
+	if result == nil {
+		return ""
+	}
+	return result.Output
+}
+
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return lines[len(lines)-1]
+}
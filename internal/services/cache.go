@@ -3,6 +3,7 @@ package services
 import (
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,8 +15,10 @@ type CacheEntry struct {
 
 // CacheService provides in-memory caching for frequently accessed data
 type CacheService struct {
-	cache map[string]CacheEntry
-	mutex sync.RWMutex
+	cache  map[string]CacheEntry
+	mutex  sync.RWMutex
+	hits   atomic.Int64
+	misses atomic.Int64
 }
 
 // NewCacheService creates a new cache service instance
@@ -32,9 +35,11 @@ func (cs *CacheService) Get(key string) (interface{}, bool) {
 
 	entry, exists := cs.cache[key]
 	if !exists || time.Now().After(entry.Expiration) {
+		cs.misses.Add(1)
 		return nil, false
 	}
 
+	cs.hits.Add(1)
 	return entry.Value, true
 }
 
@@ -139,5 +144,7 @@ func (cs *CacheService) GetCacheStats() map[string]interface{} {
 		"total_entries":   len(cs.cache),
 		"active_entries":  active,
 		"expired_entries": expired,
+		"hits":            cs.hits.Load(),
+		"misses":          cs.misses.Load(),
 	}
 }
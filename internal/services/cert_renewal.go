@@ -0,0 +1,393 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables that configure certificate renewal
+const (
+	EnvCertRenewalDays   = "XANTHUS_CERT_RENEWAL_DAYS"
+	EnvCertCheckInterval = "XANTHUS_CERT_CHECK_INTERVAL"
+)
+
+// Certificate renewal defaults: renew 30 days before expiry, check twice a day
+const (
+	DefaultCertRenewalWindow = 30 * 24 * time.Hour
+	DefaultCertCheckInterval = 12 * time.Hour
+)
+
+// ErrDistributionPending means a domain's certificate was renewed but is not
+// installed on every server yet; certificate checks keep retrying the installation
+var ErrDistributionPending = errors.New("the renewed certificate is not installed on every server yet")
+
+// CertificateNotAfter returns the expiry of the first certificate in a PEM chain
+func CertificateNotAfter(certPEM string) (time.Time, error) {
+	rest := []byte(certPEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return time.Time{}, fmt.Errorf("no certificate found in PEM data")
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		return cert.NotAfter, nil
+	}
+}
+
+// Expiry returns when the domain's certificate expires, from ExpiresAt or the certificate itself
+func (c *DomainSSLConfig) Expiry() (time.Time, error) {
+	if c.ExpiresAt != "" {
+		if expiresAt, err := time.Parse(time.RFC3339, c.ExpiresAt); err == nil {
+			return expiresAt, nil
+		}
+	}
+	return CertificateNotAfter(c.Certificate)
+}
+
+// setCertificate stores a new certificate and its expiry on the configuration
+func (c *DomainSSLConfig) setCertificate(certificate, privateKey string) {
+	c.Certificate = certificate
+	c.PrivateKey = privateKey
+	c.ExpiresAt = ""
+	if notAfter, err := CertificateNotAfter(certificate); err == nil {
+		c.ExpiresAt = notAfter.UTC().Format(time.RFC3339)
+	}
+}
+
+// CertRenewalService tracks the expiry of domain certificates and renews them
+// before they expire, then pushes the new certificate to every VPS serving the domain
+type CertRenewalService struct {
+	kv       *KVService
+	cf       *CloudflareService
+	ssh      *SSHService
+	window   time.Duration
+	interval time.Duration
+	mu       sync.Mutex // serializes renewals
+}
+
+var (
+	certRenewalService     *CertRenewalService
+	certRenewalServiceOnce sync.Once
+)
+
+// GetCertRenewalService returns the renewal service shared by the scheduler and the handlers,
+// created on first use so the state store is configured by then
+func GetCertRenewalService() *CertRenewalService {
+	certRenewalServiceOnce.Do(func() {
+		certRenewalService = NewCertRenewalService()
+	})
+	return certRenewalService
+}
+
+// NewCertRenewalService creates a renewal service configured from the environment
+func NewCertRenewalService() *CertRenewalService {
+	window := DefaultCertRenewalWindow
+	if days, err := strconv.Atoi(strings.TrimSpace(os.Getenv(EnvCertRenewalDays))); err == nil && days > 0 {
+		window = time.Duration(days) * 24 * time.Hour
+	}
+
+	interval := DefaultCertCheckInterval
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv(EnvCertCheckInterval))); err == nil && d > 0 {
+		interval = d
+	}
+
+	return NewCertRenewalServiceWithKV(NewKVService(), window, interval)
+}
+
+// NewCertRenewalServiceWithKV creates a renewal service on a specific KV service
+func NewCertRenewalServiceWithKV(kv *KVService, window, interval time.Duration) *CertRenewalService {
+	return &CertRenewalService{
+		kv:       kv,
+		cf:       NewCloudflareService(),
+		ssh:      NewSSHService(),
+		window:   window,
+		interval: interval,
+	}
+}
+
+// Window returns how long before expiry certificates are renewed
+func (s *CertRenewalService) Window() time.Duration {
+	return s.window
+}
+
+// NeedsRenewal reports whether the domain's certificate expires within the renewal window.
+// Certificates that can't be parsed are renewed.
+func (s *CertRenewalService) NeedsRenewal(config *DomainSSLConfig, now time.Time) bool {
+	expiry, err := config.Expiry()
+	if err != nil {
+		return true
+	}
+	return expiry.Sub(now) < s.window
+}
+
+// Start checks the certificates of every background account now and then
+// periodically, until ctx is cancelled
+func (s *CertRenewalService) Start(ctx context.Context) {
+	log.Printf("🔐 Certificate renewal scheduler started (renewing %d days before expiry, checking every %s)",
+		int(s.window.Hours()/24), s.interval)
+
+	go func() {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		for {
+			for _, account := range GetBackgroundAccounts().Accounts() {
+				if err := s.CheckAccount(ctx, account.Token, account.AccountID); err != nil {
+					log.Printf("Certificate check failed for account %s: %v", account.AccountID, err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// CheckAccount records the expiry of every domain certificate of an account and
+// renews those inside the renewal window. Failed renewals are recorded on the
+// domain and retried on the next check, as are renewed certificates that
+// couldn't be installed on every server.
+func (s *CertRenewalService) CheckAccount(ctx context.Context, token, accountID string) error {
+	configs, err := s.kv.ListDomainSSLConfigs(token, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to list domains: %w", err)
+	}
+
+	domains := make([]string, 0, len(configs))
+	for domain := range configs {
+		domains = append(domains, domain)
+	}
+	sort.Strings(domains)
+
+	now := time.Now()
+	for _, domain := range domains {
+		config := configs[domain]
+
+		if !s.NeedsRenewal(config, now) {
+			// Backfill the expiry of certificates issued before it was tracked
+			if config.ExpiresAt == "" {
+				config.setCertificate(config.Certificate, config.PrivateKey)
+				if err := s.kv.StoreDomainSSLConfig(token, accountID, config); err != nil {
+					log.Printf("Warning: Failed to record certificate expiry for %s: %v", domain, err)
+				}
+			}
+			if config.DistributionPending {
+				if err := s.retryDistribution(token, accountID, domain); err != nil {
+					log.Printf("❌ Installing the certificate of %s failed again: %v", domain, err)
+				}
+			}
+			continue
+		}
+
+		if _, err := s.RenewDomain(ctx, token, accountID, domain); errors.Is(err, ErrDistributionPending) {
+			log.Printf("⚠️ Renewed the certificate of %s, installing it will be retried: %v", domain, err)
+		} else if err != nil {
+			log.Printf("❌ Certificate renewal failed for %s: %v", domain, err)
+		}
+	}
+	return nil
+}
+
+// RenewDomain issues a new certificate for a domain from the domain's issuer,
+// stores it and installs it on every VPS with applications on the domain
+func (s *CertRenewalService) RenewDomain(ctx context.Context, token, accountID, domain string) (*DomainSSLConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config, err := s.kv.GetDomainSSLConfig(token, accountID, domain)
+	if err != nil {
+		return nil, fmt.Errorf("domain configuration not found: %w", err)
+	}
+
+	var csrConfig CSRConfig
+	if err := s.kv.GetValue(token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+		return nil, s.recordFailure(token, accountID, config, fmt.Errorf("SSL CSR configuration not found: %w", err))
+	}
+
+	log.Printf("🔄 Renewing certificate for %s", domain)
+	oldCertificateID := config.CertificateID
+
+	switch config.Issuer {
+	case IssuerACME:
+		issuer, err := LoadACMEService(s.kv, token, accountID)
+		if err != nil {
+			return nil, s.recordFailure(token, accountID, config, err)
+		}
+		cert, err := issuer.ObtainCertificate(ctx, []string{domain, "*." + domain}, NewCloudflareDNS01Solver(s.cf, token, config.ZoneID))
+		if err != nil {
+			return nil, s.recordFailure(token, accountID, config, fmt.Errorf("failed to obtain ACME certificate: %w", err))
+		}
+		config.setCertificate(cert.Certificate, cert.PrivateKey)
+	default:
+		cert, err := s.cf.CreateOriginCertificate(token, domain, csrConfig.CSR)
+		if err != nil {
+			return nil, s.recordFailure(token, accountID, config, fmt.Errorf("failed to create origin certificate: %w", err))
+		}
+		fullCert, err := s.cf.AppendRootCertificate(cert.Certificate)
+		if err != nil {
+			return nil, s.recordFailure(token, accountID, config, fmt.Errorf("failed to append root certificate: %w", err))
+		}
+		config.CertificateID = cert.ID
+		config.setCertificate(fullCert, csrConfig.PrivateKey)
+	}
+
+	if oldCertificateID != "" && oldCertificateID != config.CertificateID {
+		config.ReplacedCertificateID = oldCertificateID
+	}
+	config.RenewedAt = time.Now().UTC().Format(time.RFC3339)
+	config.RenewalError = ""
+	// Cleared once every server has the new certificate; until then, checks
+	// retry installing it even though it no longer needs renewal
+	config.DistributionPending = true
+	if err := s.kv.StoreDomainSSLConfig(token, accountID, config); err != nil {
+		return nil, fmt.Errorf("failed to store renewed certificate: %w", err)
+	}
+
+	if err := s.distribute(token, accountID, config); err != nil {
+		return config, err
+	}
+
+	log.Printf("✅ Renewed certificate for %s, valid until %s", domain, config.ExpiresAt)
+	return config, nil
+}
+
+// retryDistribution installs the stored certificate of a domain that is not
+// on every server yet
+func (s *CertRenewalService) retryDistribution(token, accountID, domain string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config, err := s.kv.GetDomainSSLConfig(token, accountID, domain)
+	if err != nil {
+		return fmt.Errorf("domain configuration not found: %w", err)
+	}
+	if !config.DistributionPending {
+		return nil
+	}
+	if err := s.distribute(token, accountID, config); err != nil {
+		return err
+	}
+	log.Printf("✅ Installed the certificate of %s on every server", domain)
+	return nil
+}
+
+// distribute installs the stored certificate of a domain on its servers, then
+// revokes the origin certificate it replaced and clears the pending
+// installation. Failures are recorded on the domain and wrap
+// ErrDistributionPending. Callers hold s.mu.
+func (s *CertRenewalService) distribute(token, accountID string, config *DomainSSLConfig) error {
+	sshPrivateKey, err := NewSSHKeyServiceWithStore(s.kv.Store(), nil).PrivateKey(token, accountID)
+	if err != nil {
+		return s.recordFailure(token, accountID, config, fmt.Errorf("%w: %w", ErrDistributionPending, err))
+	}
+	if err := s.DistributeCertificate(token, accountID, config, sshPrivateKey); err != nil {
+		// The previous certificate stays valid until it expires; keep it until every server has the new one
+		return s.recordFailure(token, accountID, config, fmt.Errorf("%w: %w", ErrDistributionPending, err))
+	}
+
+	if config.ReplacedCertificateID != "" {
+		if err := s.cf.DeleteOriginCertificate(token, config.ReplacedCertificateID); err != nil {
+			log.Printf("Warning: Failed to revoke previous origin certificate %s: %v", config.ReplacedCertificateID, err)
+		}
+		config.ReplacedCertificateID = ""
+	}
+	config.DistributionPending = false
+	config.RenewalError = ""
+	if err := s.kv.StoreDomainSSLConfig(token, accountID, config); err != nil {
+		return fmt.Errorf("failed to store domain configuration: %w", err)
+	}
+	return nil
+}
+
+// DistributeCertificate installs the domain's certificate in K3s and in the
+// *-tls secrets of the application namespaces on every VPS with applications on the domain
+func (s *CertRenewalService) DistributeCertificate(token, accountID string, config *DomainSSLConfig, sshPrivateKey string) error {
+	applications, err := NewSimpleApplicationService().ListApplications(token, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to list applications: %w", err)
+	}
+
+	namespacesByVPS := make(map[string][]string)
+	for _, app := range applications {
+		if app.Domain != config.Domain || app.VPSID == "" {
+			continue
+		}
+		namespaces := namespacesByVPS[app.VPSID]
+		if app.Namespace != "" && !slices.Contains(namespaces, app.Namespace) {
+			namespaces = append(namespaces, app.Namespace)
+		}
+		namespacesByVPS[app.VPSID] = namespaces
+	}
+
+	vpsIDs := make([]string, 0, len(namespacesByVPS))
+	for vpsID := range namespacesByVPS {
+		vpsIDs = append(vpsIDs, vpsID)
+	}
+	sort.Strings(vpsIDs)
+
+	var errs []error
+	for _, vpsID := range vpsIDs {
+		serverID, err := strconv.Atoi(vpsID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid VPS ID %q", vpsID))
+			continue
+		}
+		vpsConfig, err := s.kv.GetVPSConfig(token, accountID, serverID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("VPS %s: configuration not found: %w", vpsID, err))
+			continue
+		}
+
+		conn, err := s.ssh.GetOrCreateConnection(vpsConfig.SSHAddress(), vpsConfig.SSHUser, sshPrivateKey, serverID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("VPS %s: failed to connect: %w", vpsConfig.Name, err))
+			continue
+		}
+
+		if err := s.ssh.ConfigureK3s(conn, config.Certificate, config.PrivateKey); err != nil {
+			errs = append(errs, fmt.Errorf("VPS %s: %w", vpsConfig.Name, err))
+			continue
+		}
+		for _, namespace := range namespacesByVPS[vpsID] {
+			if err := s.ssh.CreateTLSSecret(conn, config.Domain, config.Certificate, config.PrivateKey, namespace); err != nil {
+				errs = append(errs, fmt.Errorf("VPS %s: %w", vpsConfig.Name, err))
+			}
+		}
+		log.Printf("📦 Installed certificate for %s on VPS %s (%d namespaces)", config.Domain, vpsConfig.Name, len(namespacesByVPS[vpsID]))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to install certificate on every server: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// recordFailure stores a renewal error on the domain, so it shows up on the DNS page
+func (s *CertRenewalService) recordFailure(token, accountID string, config *DomainSSLConfig, err error) error {
+	config.RenewalError = err.Error()
+	if storeErr := s.kv.StoreDomainSSLConfig(token, accountID, config); storeErr != nil {
+		log.Printf("Warning: Failed to record renewal error for %s: %v", config.Domain, storeErr)
+	}
+	return err
+}
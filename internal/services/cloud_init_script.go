@@ -0,0 +1,136 @@
+package services
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// cloudConfig is the subset of the cloud-config format used by the Xanthus templates
+type cloudConfig struct {
+	PackageUpdate  bool                 `yaml:"package_update"`
+	PackageUpgrade bool                 `yaml:"package_upgrade"`
+	Timezone       string               `yaml:"timezone"`
+	Packages       []string             `yaml:"packages"`
+	BootCmd        []cloudConfigCommand `yaml:"bootcmd"`
+	WriteFiles     []cloudConfigFile    `yaml:"write_files"`
+	RunCmd         []cloudConfigCommand `yaml:"runcmd"`
+}
+
+// cloudConfigFile is a write_files entry
+type cloudConfigFile struct {
+	Path        string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Encoding    string `yaml:"encoding"`
+	Permissions string `yaml:"permissions"`
+	Owner       string `yaml:"owner"`
+	Append      bool   `yaml:"append"`
+}
+
+// cloudConfigCommand is a bootcmd or runcmd entry: a shell string, or an argv list
+type cloudConfigCommand struct {
+	Shell string
+	Argv  []string
+}
+
+// UnmarshalYAML accepts both forms of a cloud-config command
+func (c *cloudConfigCommand) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.SequenceNode {
+		return node.Decode(&c.Argv)
+	}
+	return node.Decode(&c.Shell)
+}
+
+// script returns the command as a line of shell
+func (c cloudConfigCommand) script() string {
+	if c.Argv == nil {
+		return c.Shell
+	}
+	quoted := make([]string, len(c.Argv))
+	for i, arg := range c.Argv {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// CloudInitScript converts a rendered cloud-config document into a bash script
+// that performs the same steps, for servers that are bootstrapped over SSH
+// instead of by cloud-init. The script must run as root.
+func CloudInitScript(userData string) (string, error) {
+	var config cloudConfig
+	if err := yaml.Unmarshal([]byte(userData), &config); err != nil {
+		return "", fmt.Errorf("failed to parse cloud-config: %w", err)
+	}
+
+	var b strings.Builder
+	b.WriteString("#!/bin/bash\n")
+	b.WriteString("# Generated by Xanthus from its cloud-init template\n")
+	b.WriteString("set -e\n")
+	b.WriteString("export DEBIAN_FRONTEND=noninteractive\n\n")
+
+	for _, cmd := range config.BootCmd {
+		b.WriteString(cmd.script() + "\n")
+	}
+
+	if config.Timezone != "" {
+		fmt.Fprintf(&b, "timedatectl set-timezone %s\n", shellQuote(config.Timezone))
+	}
+
+	if config.PackageUpdate || config.PackageUpgrade || len(config.Packages) > 0 {
+		b.WriteString("apt-get update -y\n")
+	}
+	if config.PackageUpgrade {
+		b.WriteString("apt-get upgrade -y\n")
+	}
+	if len(config.Packages) > 0 {
+		quoted := make([]string, len(config.Packages))
+		for i, pkg := range config.Packages {
+			quoted[i] = shellQuote(pkg)
+		}
+		fmt.Fprintf(&b, "apt-get install -y %s\n", strings.Join(quoted, " "))
+	}
+
+	for _, file := range config.WriteFiles {
+		if file.Path == "" {
+			return "", fmt.Errorf("write_files entry without a path")
+		}
+		content := file.Content
+		if file.Encoding == "b64" || file.Encoding == "base64" {
+			decoded, err := base64.StdEncoding.DecodeString(content)
+			if err != nil {
+				return "", fmt.Errorf("failed to decode %s: %w", file.Path, err)
+			}
+			content = string(decoded)
+		}
+
+		redirect := ">"
+		if file.Append {
+			redirect = ">>"
+		}
+		path := shellQuote(file.Path)
+		fmt.Fprintf(&b, "\nmkdir -p \"$(dirname %s)\"\n", path)
+		fmt.Fprintf(&b, "echo %s | base64 -d %s %s\n", base64.StdEncoding.EncodeToString([]byte(content)), redirect, path)
+		if file.Permissions != "" {
+			fmt.Fprintf(&b, "chmod %s %s\n", shellQuote(file.Permissions), path)
+		}
+		if file.Owner != "" {
+			fmt.Fprintf(&b, "chown %s %s\n", shellQuote(file.Owner), path)
+		}
+	}
+
+	if len(config.RunCmd) > 0 {
+		b.WriteString("\n")
+	}
+	for _, cmd := range config.RunCmd {
+		b.WriteString(cmd.script() + "\n")
+	}
+
+	return b.String(), nil
+}
+
+// shellQuote quotes s for use as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
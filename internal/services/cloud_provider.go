@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Provider names as stored in VPSConfig.Provider
+const (
+	ProviderHetzner = "Hetzner"
+	ProviderOCI     = "Oracle Cloud Infrastructure (OCI)"
+)
+
+// Power actions accepted by CloudProvider.PowerAction
+const (
+	PowerActionOff    = "poweroff"
+	PowerActionOn     = "poweron"
+	PowerActionReboot = "reboot"
+)
+
+// ErrInvalidServerRequest is wrapped by CreateServer errors caused by the request
+// (e.g. a size outside the provider's limits) rather than by the provider
+var ErrInvalidServerRequest = errors.New("invalid server request")
+
+// ErrPowerActionUnsupported is wrapped by PowerAction errors for actions the provider can't perform
+var ErrPowerActionUnsupported = errors.New("power action not supported")
+
+// CloudProvider is implemented by every cloud Xanthus can create servers on.
+// An instance is bound to one account's provider credentials.
+type CloudProvider interface {
+	// Name returns the provider name stored in VPSConfig.Provider
+	Name() string
+
+	// ListLocations returns the regions or datacenters servers can be created in
+	ListLocations(ctx context.Context) ([]CloudLocation, error)
+
+	// ListServerTypes returns the server types (sizes, shapes) available in a location
+	ListServerTypes(ctx context.Context, location string) ([]CloudServerType, error)
+
+	// Pricing returns the gross hourly and monthly price of a server type,
+	// including any mandatory extras such as a public IPv4. Free or unknown prices are 0.
+	Pricing(ctx context.Context, serverType, location string) (hourly, monthly float64, err error)
+
+	// RegisterSSHKey makes publicKey available to new servers and returns the
+	// name to pass as CloudServerRequest.SSHKeyName
+	RegisterSSHKey(ctx context.Context, name, publicKey string) (string, error)
+
+	// UnregisterSSHKey removes a key registered by RegisterSSHKey, so it is no
+	// longer offered to new servers. A key that isn't registered is not an error.
+	UnregisterSSHKey(ctx context.Context, publicKey string) error
+
+	// CloudInit returns the provider's cloud-init template, rendered with RenderCloudInit
+	CloudInit() string
+
+	// CreateServer creates a server and waits until its public address is known
+	CreateServer(ctx context.Context, req CloudServerRequest) (*CloudServer, error)
+
+	// DeleteServer deletes the server described by config. A server that no longer exists is not an error.
+	DeleteServer(ctx context.Context, config *VPSConfig) error
+
+	// PowerAction performs one of the PowerAction* actions
+	PowerAction(ctx context.Context, config *VPSConfig, action string) error
+
+	// ServerExists reports whether the server described by config still exists,
+	// so servers deleted outside Xanthus can be found
+	ServerExists(ctx context.Context, config *VPSConfig) (bool, error)
+
+	// ListServers returns every server in the account, including servers not
+	// created by Xanthus, so they can be adopted
+	ListServers(ctx context.Context) ([]CloudServer, error)
+}
+
+// PrivateNetworkProvider is implemented by providers that can connect servers
+// over a private network, so the nodes of a cluster don't talk over the internet
+type PrivateNetworkProvider interface {
+	// AttachPrivateNetwork attaches the server described by config to the
+	// private network called name, creating it in the server's zone if needed,
+	// and returns the network's ID (to pass as CloudServerRequest.PrivateNetwork)
+	// and the server's private IPv4
+	AttachPrivateNetwork(ctx context.Context, config *VPSConfig, name string) (networkID, privateIPv4 string, err error)
+}
+
+// CloudLocation is a region or datacenter of a provider
+type CloudLocation struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Country     string `json:"country,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+// CloudServerType is a server size offered by a provider
+type CloudServerType struct {
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	Architecture string  `json:"architecture"`
+	Cores        float64 `json:"cores"`
+	MemoryGB     float64 `json:"memory_gb"`
+	DiskGB       float64 `json:"disk_gb"`
+	HourlyPrice  float64 `json:"hourly_price"`
+	MonthlyPrice float64 `json:"monthly_price"`
+	Flexible     bool    `json:"flexible,omitempty"` // CPUs and memory are chosen at creation
+}
+
+// CloudServerRequest describes a server to create
+type CloudServerRequest struct {
+	Name         string
+	ServerType   string
+	Location     string
+	SSHKeyName   string // As returned by RegisterSSHKey
+	SSHPublicKey string
+	UserData     string // Rendered cloud-init user data
+	Timezone     string
+	CPUs         float32 // Flexible server types only
+	MemoryGB     float32 // Flexible server types only
+	// Join makes the server an agent node of an existing cluster instead of a cluster of its own
+	Join *ClusterJoin
+	// PrivateNetwork is the ID of a private network to attach the server to,
+	// as returned by PrivateNetworkProvider.AttachPrivateNetwork
+	PrivateNetwork string
+}
+
+// CloudServer is a server created by a provider
+type CloudServer struct {
+	ID           int    // Numeric ID used as VPSConfig.ServerID
+	InstanceID   string // Provider-native ID when it is not numeric (e.g. an OCI OCID)
+	Name         string
+	PublicIPv4   string
+	PrivateIPv4  string // Address on CloudServerRequest.PrivateNetwork, if any
+	ServerType   string
+	Location     string
+	Architecture string
+	CPUs         float32
+	MemoryGB     float32
+	CreatedAt    string
+}
+
+// CloudInitVars are the values substituted into cloud-init templates
+type CloudInitVars struct {
+	Timezone   string
+	Domain     string
+	DomainCert string // Base64 encoded PEM
+	DomainKey  string // Base64 encoded PEM
+
+	// Agent nodes only
+	K3sServer  string // Address of the server node's API
+	K3sToken   string
+	K3sVersion string
+	NodeName   string
+}
+
+// RenderCloudInit substitutes the ${VAR} placeholders of a cloud-init template.
+// Every placeholder is replaced, with an empty value when unset, so the scripts
+// never run with undefined variables.
+func RenderCloudInit(template string, vars CloudInitVars) string {
+	return strings.NewReplacer(
+		"${TIMEZONE}", vars.Timezone,
+		"${DOMAIN}", vars.Domain,
+		"${DOMAIN_CERT}", vars.DomainCert,
+		"${DOMAIN_KEY}", vars.DomainKey,
+		"${K3S_SERVER}", vars.K3sServer,
+		"${K3S_TOKEN}", vars.K3sToken,
+		"${K3S_VERSION}", vars.K3sVersion,
+		"${NODE_NAME}", vars.NodeName,
+	).Replace(template)
+}
+
+// CloudProviderFactory creates a provider bound to the credentials of an account
+type CloudProviderFactory func(token, accountID string) (CloudProvider, error)
+
+var cloudProviders = struct {
+	sync.RWMutex
+	factories map[string]CloudProviderFactory
+	aliases   map[string]string
+}{
+	factories: map[string]CloudProviderFactory{},
+	aliases:   map[string]string{},
+}
+
+// RegisterCloudProvider makes a provider available under its name and any
+// aliases (matched case-insensitively). Providers register themselves in init.
+func RegisterCloudProvider(name string, factory CloudProviderFactory, aliases ...string) {
+	cloudProviders.Lock()
+	defer cloudProviders.Unlock()
+
+	cloudProviders.factories[name] = factory
+	cloudProviders.aliases[strings.ToLower(name)] = name
+	for _, alias := range aliases {
+		cloudProviders.aliases[strings.ToLower(alias)] = name
+	}
+}
+
+// CanonicalProviderName resolves a provider name or alias ("oci", "hetzner") to its registered name
+func CanonicalProviderName(provider string) (string, bool) {
+	cloudProviders.RLock()
+	defer cloudProviders.RUnlock()
+
+	name, ok := cloudProviders.aliases[strings.ToLower(strings.TrimSpace(provider))]
+	return name, ok
+}
+
+// CloudProviderNames returns the registered provider names, sorted
+func CloudProviderNames() []string {
+	cloudProviders.RLock()
+	defer cloudProviders.RUnlock()
+
+	names := make([]string, 0, len(cloudProviders.factories))
+	for name := range cloudProviders.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewCloudProvider creates the named provider for an account. An empty name selects Hetzner,
+// which is what VPS configurations created before providers were recorded used.
+func NewCloudProvider(provider, token, accountID string) (CloudProvider, error) {
+	if provider == "" {
+		provider = ProviderHetzner
+	}
+
+	name, ok := CanonicalProviderName(provider)
+	if !ok {
+		return nil, fmt.Errorf("unsupported provider: %s", provider)
+	}
+
+	cloudProviders.RLock()
+	factory := cloudProviders.factories[name]
+	cloudProviders.RUnlock()
+
+	return factory(token, accountID)
+}
+
+// hashServerID derives a numeric server ID from a provider's string identifier
+// (e.g. an instance OCID), since VPS configurations are keyed by integer IDs
+func hashServerID(id string) int {
+	hash := 0
+	for _, char := range id {
+		hash = hash*31 + int(char)
+	}
+	if hash < 0 {
+		hash = -hash
+	}
+	// Use last 8 digits to avoid overflow and ensure uniqueness within reasonable bounds
+	return hash % 100000000
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// ProviderDigitalOcean is the provider name stored in VPSConfig.Provider for droplets
+const ProviderDigitalOcean = "DigitalOcean"
+
+func init() {
+	RegisterCloudProvider(ProviderDigitalOcean, func(token, accountID string) (CloudProvider, error) {
+		apiKey, err := utils.GetDigitalOceanAPIKey(token, accountID)
+		if err != nil {
+			return nil, fmt.Errorf("DigitalOcean API token not configured: %w", err)
+		}
+		return NewDigitalOceanProvider(apiKey), nil
+	}, "digitalocean", "do")
+}
+
+// DigitalOceanProvider implements CloudProvider on top of DigitalOceanService.
+// Prices are reported in USD, the currency DigitalOcean bills in.
+type DigitalOceanProvider struct {
+	service *DigitalOceanService
+	apiKey  string
+}
+
+// NewDigitalOceanProvider creates a DigitalOcean provider for an API token
+func NewDigitalOceanProvider(apiKey string) *DigitalOceanProvider {
+	return NewDigitalOceanProviderWithService(NewDigitalOceanService(), apiKey)
+}
+
+// NewDigitalOceanProviderWithService creates a DigitalOcean provider using a specific service
+func NewDigitalOceanProviderWithService(service *DigitalOceanService, apiKey string) *DigitalOceanProvider {
+	return &DigitalOceanProvider{service: service, apiKey: apiKey}
+}
+
+// Name returns the provider name
+func (p *DigitalOceanProvider) Name() string {
+	return ProviderDigitalOcean
+}
+
+// ListLocations returns the regions droplets can currently be created in
+func (p *DigitalOceanProvider) ListLocations(ctx context.Context) ([]CloudLocation, error) {
+	regions, err := p.service.ListRegions(ctx, p.apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []CloudLocation
+	for _, region := range regions {
+		if !region.Available {
+			continue
+		}
+		result = append(result, CloudLocation{
+			Name:        region.Slug,
+			Description: region.Name,
+			City:        digitalOceanRegionCity(region.Name),
+		})
+	}
+	return result, nil
+}
+
+// ListServerTypes returns the droplet sizes available in a location
+func (p *DigitalOceanProvider) ListServerTypes(ctx context.Context, location string) ([]CloudServerType, error) {
+	sizes, err := p.service.ListSizes(ctx, p.apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []CloudServerType
+	for _, size := range sizes {
+		if !size.Available || (location != "" && !slices.Contains(size.Regions, location)) {
+			continue
+		}
+		result = append(result, CloudServerType{
+			Name:         size.Slug,
+			Description:  size.Description,
+			Architecture: digitalOceanArchitecture(size.Slug, ""),
+			Cores:        float64(size.VCPUs),
+			MemoryGB:     float64(size.Memory) / 1024,
+			DiskGB:       float64(size.Disk),
+			HourlyPrice:  size.PriceHourly,
+			MonthlyPrice: size.PriceMonthly,
+		})
+	}
+	return result, nil
+}
+
+// Pricing returns the price of a droplet size; a public IPv4 is included
+func (p *DigitalOceanProvider) Pricing(ctx context.Context, serverType, location string) (float64, float64, error) {
+	sizes, err := p.service.ListSizes(ctx, p.apiKey)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, size := range sizes {
+		if size.Slug == serverType {
+			return size.PriceHourly, size.PriceMonthly, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("unknown droplet size: %s", serverType)
+}
+
+// RegisterSSHKey uploads the key, reusing an existing key with the same public key,
+// and returns its fingerprint
+func (p *DigitalOceanProvider) RegisterSSHKey(ctx context.Context, name, publicKey string) (string, error) {
+	key, err := p.service.CreateOrFindSSHKey(ctx, p.apiKey, name, publicKey)
+	if err != nil {
+		return "", err
+	}
+	return key.Fingerprint, nil
+}
+
+// UnregisterSSHKey deletes the key with this public key from the account
+func (p *DigitalOceanProvider) UnregisterSSHKey(ctx context.Context, publicKey string) error {
+	key, err := p.service.FindSSHKeyByPublicKey(ctx, p.apiKey, publicKey)
+	if err != nil || key == nil {
+		return err
+	}
+	return p.service.DeleteSSHKey(ctx, p.apiKey, key.ID)
+}
+
+// CloudInit returns the cloud-init template, shared with Hetzner since both boot Ubuntu as root
+func (p *DigitalOceanProvider) CloudInit() string {
+	return defaultUserData
+}
+
+// CreateServer creates a droplet and waits for its public address
+func (p *DigitalOceanProvider) CreateServer(ctx context.Context, req CloudServerRequest) (*CloudServer, error) {
+	droplet, err := p.service.CreateDroplet(ctx, p.apiKey, req.Name, req.Location, req.ServerType, req.SSHKeyName, req.UserData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CloudServer{
+		ID:           droplet.ID,
+		Name:         droplet.Name,
+		PublicIPv4:   droplet.PublicIPv4(),
+		ServerType:   req.ServerType,
+		Location:     req.Location,
+		Architecture: digitalOceanArchitecture(req.ServerType, droplet.Image.Slug+" "+droplet.Image.Name),
+		CreatedAt:    droplet.CreatedAt,
+	}, nil
+}
+
+// DeleteServer deletes a droplet
+func (p *DigitalOceanProvider) DeleteServer(ctx context.Context, config *VPSConfig) error {
+	if err := p.service.DeleteDroplet(ctx, p.apiKey, config.ServerID); err != nil && !strings.Contains(err.Error(), "not_found") {
+		return err
+	}
+	return nil
+}
+
+// PowerAction powers a droplet off or on, or reboots it
+func (p *DigitalOceanProvider) PowerAction(ctx context.Context, config *VPSConfig, action string) error {
+	switch action {
+	case PowerActionOff:
+		return p.service.PowerOffDroplet(ctx, p.apiKey, config.ServerID)
+	case PowerActionOn:
+		return p.service.PowerOnDroplet(ctx, p.apiKey, config.ServerID)
+	case PowerActionReboot:
+		return p.service.RebootDroplet(ctx, p.apiKey, config.ServerID)
+	default:
+		return fmt.Errorf("unknown power action: %s", action)
+	}
+}
+
+// ServerExists looks the droplet up by ID
+func (p *DigitalOceanProvider) ServerExists(ctx context.Context, config *VPSConfig) (bool, error) {
+	if _, err := p.service.GetDroplet(ctx, p.apiKey, config.ServerID); err != nil {
+		if strings.Contains(err.Error(), "not_found") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ListServers returns every droplet of the account
+func (p *DigitalOceanProvider) ListServers(ctx context.Context) ([]CloudServer, error) {
+	droplets, err := p.service.ListDroplets(ctx, p.apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]CloudServer, 0, len(droplets))
+	for _, droplet := range droplets {
+		result = append(result, CloudServer{
+			ID:           droplet.ID,
+			Name:         droplet.Name,
+			PublicIPv4:   droplet.PublicIPv4(),
+			ServerType:   droplet.SizeSlug,
+			Location:     droplet.Region.Slug,
+			Architecture: digitalOceanArchitecture(droplet.SizeSlug, droplet.Image.Slug+" "+droplet.Image.Name),
+			CPUs:         float32(droplet.VCPUs),
+			MemoryGB:     float32(droplet.Memory) / 1024,
+			CreatedAt:    droplet.CreatedAt,
+		})
+	}
+	return result, nil
+}
+
+// digitalOceanRegionCity strips the datacenter number from a region name ("New York 3" -> "New York")
+func digitalOceanRegionCity(name string) string {
+	if i := strings.LastIndex(name, " "); i > 0 && strings.Trim(name[i+1:], "0123456789") == "" {
+		return name[:i]
+	}
+	return name
+}
+
+// digitalOceanArchitecture reports the CPU architecture of a droplet from its size and image
+func digitalOceanArchitecture(size, image string) string {
+	for _, name := range []string{strings.ToLower(size), strings.ToLower(image)} {
+		if strings.Contains(name, "arm64") || strings.Contains(name, "aarch64") {
+			return "arm"
+		}
+	}
+	return "x86"
+}
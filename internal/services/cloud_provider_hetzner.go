@@ -0,0 +1,319 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// hetznerIPv4MonthlyPrice is the gross monthly price of the primary IPv4 address,
+// which Hetzner bills separately from the server type
+const hetznerIPv4MonthlyPrice = 0.50
+
+func init() {
+	RegisterCloudProvider(ProviderHetzner, func(token, accountID string) (CloudProvider, error) {
+		apiKey, err := utils.GetHetznerAPIKey(token, accountID)
+		if err != nil {
+			return nil, fmt.Errorf("Hetzner API key not configured: %w", err)
+		}
+		return NewHetznerProvider(apiKey), nil
+	}, "hetzner", "hcloud")
+}
+
+// HetznerProvider implements CloudProvider on top of HetznerService
+type HetznerProvider struct {
+	service *HetznerService
+	apiKey  string
+}
+
+// NewHetznerProvider creates a Hetzner Cloud provider for an API key
+func NewHetznerProvider(apiKey string) *HetznerProvider {
+	return &HetznerProvider{service: NewHetznerService(), apiKey: apiKey}
+}
+
+// Name returns the provider name
+func (p *HetznerProvider) Name() string {
+	return ProviderHetzner
+}
+
+// ListLocations returns the Hetzner datacenter locations
+func (p *HetznerProvider) ListLocations(ctx context.Context) ([]CloudLocation, error) {
+	locations, err := utils.FetchHetznerLocations(p.apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]CloudLocation, 0, len(locations))
+	for _, location := range locations {
+		result = append(result, CloudLocation{
+			Name:        location.Name,
+			Description: location.Description,
+			Country:     location.Country,
+			City:        location.City,
+		})
+	}
+	return result, nil
+}
+
+// ListServerTypes returns the shared vCPU server types priced in a location
+func (p *HetznerProvider) ListServerTypes(ctx context.Context, location string) ([]CloudServerType, error) {
+	serverTypes, err := utils.FetchHetznerServerTypes(p.apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []CloudServerType
+	for _, st := range utils.FilterSharedVCPUServers(serverTypes) {
+		price, ok := hetznerPriceFor(st, location)
+		if !ok {
+			continue
+		}
+		hourly, monthly := hetznerGrossPrices(price)
+		result = append(result, CloudServerType{
+			Name:         st.Name,
+			Description:  st.Description,
+			Architecture: st.Architecture,
+			Cores:        float64(st.Cores),
+			MemoryGB:     st.Memory,
+			DiskGB:       float64(st.Disk),
+			HourlyPrice:  hourly,
+			MonthlyPrice: monthly,
+		})
+	}
+	return result, nil
+}
+
+// Pricing returns the gross price of a server type in a location, including the IPv4 address
+func (p *HetznerProvider) Pricing(ctx context.Context, serverType, location string) (float64, float64, error) {
+	serverTypes, err := utils.FetchHetznerServerTypes(p.apiKey)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, st := range serverTypes {
+		if st.Name != serverType {
+			continue
+		}
+		price, ok := hetznerPriceFor(st, location)
+		if !ok {
+			return 0, 0, fmt.Errorf("server type %s has no price for location %s", serverType, location)
+		}
+		hourly, monthly := hetznerGrossPrices(price)
+		return hourly, monthly, nil
+	}
+	return 0, 0, fmt.Errorf("unknown server type: %s", serverType)
+}
+
+// RegisterSSHKey uploads the key, reusing an existing key with the same public key
+func (p *HetznerProvider) RegisterSSHKey(ctx context.Context, name, publicKey string) (string, error) {
+	key, err := p.service.CreateOrFindSSHKey(p.apiKey, name, publicKey)
+	if err != nil {
+		return "", err
+	}
+	return key.Name, nil
+}
+
+// UnregisterSSHKey deletes the key with this public key from the project,
+// provided Xanthus uploaded it
+func (p *HetznerProvider) UnregisterSSHKey(ctx context.Context, publicKey string) error {
+	key, err := p.service.FindSSHKeyByPublicKey(p.apiKey, publicKey)
+	if err != nil || key == nil || key.Labels["managed_by"] != "xanthus" {
+		return err
+	}
+	return p.service.DeleteSSHKey(p.apiKey, key.ID)
+}
+
+// CloudInit returns the cloud-init template for Hetzner servers
+func (p *HetznerProvider) CloudInit() string {
+	return defaultUserData
+}
+
+// CreateServer creates an Ubuntu server, attached to req.PrivateNetwork if set
+func (p *HetznerProvider) CreateServer(ctx context.Context, req CloudServerRequest) (*CloudServer, error) {
+	var networks []int
+	if req.PrivateNetwork != "" {
+		networkID, err := strconv.Atoi(req.PrivateNetwork)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid Hetzner network ID %q", ErrInvalidServerRequest, req.PrivateNetwork)
+		}
+		networks = append(networks, networkID)
+	}
+
+	server, err := p.service.CreateServerWithUserData(p.apiKey, req.Name, req.ServerType, req.Location, req.SSHKeyName, req.UserData, networks...)
+	if err != nil {
+		return nil, err
+	}
+
+	privateIP := ""
+	if len(networks) > 0 {
+		if privateIP, err = p.waitForPrivateIP(ctx, server.ID, networks[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	return &CloudServer{
+		ID:          server.ID,
+		Name:        server.Name,
+		PublicIPv4:  server.PublicNet.IPv4.IP,
+		PrivateIPv4: privateIP,
+		ServerType:  req.ServerType,
+		Location:    req.Location,
+		CreatedAt:   server.Created,
+	}, nil
+}
+
+// AttachPrivateNetwork attaches a server to the network called name, creating
+// the network in the server's network zone first if it doesn't exist
+func (p *HetznerProvider) AttachPrivateNetwork(ctx context.Context, config *VPSConfig, name string) (string, string, error) {
+	network, err := p.service.FindNetwork(p.apiKey, name)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to look up network %s: %w", name, err)
+	}
+	if network == nil {
+		zone, ok := hetznerNetworkZone(config.Location)
+		if !ok {
+			return "", "", fmt.Errorf("no network zone known for location %s", config.Location)
+		}
+		if network, err = p.service.CreateNetwork(p.apiKey, name, zone); err != nil {
+			return "", "", fmt.Errorf("failed to create network %s: %w", name, err)
+		}
+	}
+
+	attached := false
+	for _, id := range network.Servers {
+		attached = attached || id == config.ServerID
+	}
+	if !attached {
+		if err := p.service.AttachServerToNetwork(p.apiKey, config.ServerID, network.ID); err != nil {
+			return "", "", fmt.Errorf("failed to attach %s to network %s: %w", config.Name, name, err)
+		}
+	}
+
+	privateIP, err := p.waitForPrivateIP(ctx, config.ServerID, network.ID)
+	if err != nil {
+		return "", "", err
+	}
+	return strconv.Itoa(network.ID), privateIP, nil
+}
+
+// waitForPrivateIP waits until a server has an address on a network, which
+// Hetzner assigns asynchronously
+func (p *HetznerProvider) waitForPrivateIP(ctx context.Context, serverID, networkID int) (string, error) {
+	for attempt := 0; attempt < 30; attempt++ {
+		server, err := p.service.GetServer(p.apiKey, serverID)
+		if err != nil {
+			return "", err
+		}
+		for _, net := range server.PrivateNet {
+			if net.Network == networkID && net.IP != "" {
+				return net.IP, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(2 * time.Second):
+		}
+	}
+	return "", fmt.Errorf("server %d got no address on network %d", serverID, networkID)
+}
+
+// DeleteServer deletes a server
+func (p *HetznerProvider) DeleteServer(ctx context.Context, config *VPSConfig) error {
+	if err := p.service.DeleteServer(p.apiKey, config.ServerID); err != nil && !strings.Contains(err.Error(), "not_found") {
+		return err
+	}
+	return nil
+}
+
+// PowerAction powers a server off or on, or reboots it
+func (p *HetznerProvider) PowerAction(ctx context.Context, config *VPSConfig, action string) error {
+	switch action {
+	case PowerActionOff:
+		return p.service.PowerOffServer(p.apiKey, config.ServerID)
+	case PowerActionOn:
+		return p.service.PowerOnServer(p.apiKey, config.ServerID)
+	case PowerActionReboot:
+		return p.service.RebootServer(p.apiKey, config.ServerID)
+	default:
+		return fmt.Errorf("unknown power action: %s", action)
+	}
+}
+
+// ServerExists looks the server up by ID
+func (p *HetznerProvider) ServerExists(ctx context.Context, config *VPSConfig) (bool, error) {
+	if _, err := p.service.GetServer(p.apiKey, config.ServerID); err != nil {
+		if strings.Contains(err.Error(), "not_found") {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// ListServers returns every server of the project, not only those labeled managed_by=xanthus
+func (p *HetznerProvider) ListServers(ctx context.Context) ([]CloudServer, error) {
+	servers, err := p.service.ListAllServers(p.apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]CloudServer, 0, len(servers))
+	for _, server := range servers {
+		result = append(result, CloudServer{
+			ID:           server.ID,
+			Name:         server.Name,
+			PublicIPv4:   server.PublicNet.IPv4.IP,
+			ServerType:   server.ServerType.Name,
+			Location:     server.Datacenter.Location.Name,
+			Architecture: server.ServerType.Architecture,
+			CPUs:         float32(server.ServerType.Cores),
+			MemoryGB:     float32(server.ServerType.Memory),
+			CreatedAt:    server.Created,
+		})
+	}
+	return result, nil
+}
+
+// hetznerNetworkZone returns the network zone of a location such as "fsn1" or "fsn1-dc14"
+func hetznerNetworkZone(location string) (string, bool) {
+	city, _, _ := strings.Cut(location, "-")
+	switch city {
+	case "fsn1", "nbg1", "hel1":
+		return "eu-central", true
+	case "ash":
+		return "us-east", true
+	case "hil":
+		return "us-west", true
+	case "sin":
+		return "ap-southeast", true
+	}
+	return "", false
+}
+
+// hetznerPriceFor returns the price entry of a location, or the first one when location is empty
+func hetznerPriceFor(serverType models.HetznerServerType, location string) (models.HetznerPrice, bool) {
+	for _, price := range serverType.Prices {
+		if location == "" || price.Location == location {
+			return price, true
+		}
+	}
+	return models.HetznerPrice{}, false
+}
+
+// hetznerGrossPrices parses a price entry and adds the IPv4 address (30.41 days per month on average)
+func hetznerGrossPrices(price models.HetznerPrice) (hourly, monthly float64) {
+	if _, err := fmt.Sscanf(price.PriceHourly.Gross, "%f", &hourly); err == nil {
+		hourly += hetznerIPv4MonthlyPrice / (30.41 * 24)
+	}
+	if _, err := fmt.Sscanf(price.PriceMonthly.Gross, "%f", &monthly); err == nil {
+		monthly += hetznerIPv4MonthlyPrice
+	}
+	return hourly, monthly
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// ProviderManual is the provider of servers that were not created by Xanthus
+// but added with their SSH address ("bring your own server")
+const ProviderManual = "Manual"
+
+// Paths of the SSH bootstrap on manually added servers
+const (
+	manualBootstrapScript = "/opt/xanthus/bootstrap.sh"
+	manualBootstrapLog    = "/opt/xanthus/bootstrap.log"
+)
+
+func init() {
+	RegisterCloudProvider(ProviderManual, func(token, accountID string) (CloudProvider, error) {
+		privateKey, err := NewSSHKeyService().PrivateKey(token, accountID)
+		if err != nil {
+			return nil, err
+		}
+		return NewManualProvider(NewSSHService(), privateKey), nil
+	}, "manual", "byo", "ssh")
+}
+
+// ManualProvider implements CloudProvider for servers Xanthus only reaches over
+// SSH. Nothing is created or deleted at a cloud; power actions are shutdown and
+// reboot commands run on the server.
+type ManualProvider struct {
+	ssh        *SSHService
+	privateKey string
+}
+
+// NewManualProvider creates a provider that connects with the account's SSH private key
+func NewManualProvider(sshService *SSHService, privateKey string) *ManualProvider {
+	return &ManualProvider{ssh: sshService, privateKey: privateKey}
+}
+
+// ExistingServerRequest describes a server to add to Xanthus by its SSH address
+type ExistingServerRequest struct {
+	Name     string
+	Host     string
+	SSHUser  string       // defaults to root
+	SSHPort  int          // defaults to 22
+	Password string       // optional, used once to install the Xanthus SSH key
+	Timezone string       // defaults to the server's current timezone
+	Join     *ClusterJoin // joins an existing cluster as an agent node instead
+}
+
+// Name returns the provider name
+func (p *ManualProvider) Name() string {
+	return ProviderManual
+}
+
+// ListLocations returns no locations, manual servers live wherever their owner put them
+func (p *ManualProvider) ListLocations(ctx context.Context) ([]CloudLocation, error) {
+	return []CloudLocation{}, nil
+}
+
+// ListServerTypes returns no server types, the hardware is reported by the server itself
+func (p *ManualProvider) ListServerTypes(ctx context.Context, location string) ([]CloudServerType, error) {
+	return []CloudServerType{}, nil
+}
+
+// Pricing returns zero; Xanthus doesn't know what the server costs its owner
+func (p *ManualProvider) Pricing(ctx context.Context, serverType, location string) (float64, float64, error) {
+	return 0, 0, nil
+}
+
+// RegisterSSHKey is a no-op, the key is installed on the server when it is added
+func (p *ManualProvider) RegisterSSHKey(ctx context.Context, name, publicKey string) (string, error) {
+	return name, nil
+}
+
+// UnregisterSSHKey is a no-op, the key only lives in the servers' authorized_keys
+func (p *ManualProvider) UnregisterSSHKey(ctx context.Context, publicKey string) error {
+	return nil
+}
+
+// CloudInit returns the cloud-init template, which CloudInitScript turns into the SSH bootstrap
+func (p *ManualProvider) CloudInit() string {
+	return defaultUserData
+}
+
+// CreateServer always fails: manual servers are added, not created
+func (p *ManualProvider) CreateServer(ctx context.Context, req CloudServerRequest) (*CloudServer, error) {
+	return nil, fmt.Errorf("%w: servers of provider %s are added by SSH address, not created", ErrInvalidServerRequest, ProviderManual)
+}
+
+// DeleteServer leaves the server running; deleting it only makes Xanthus forget it
+func (p *ManualProvider) DeleteServer(ctx context.Context, config *VPSConfig) error {
+	log.Printf("Forgetting manually added server %s (%s), the machine itself is left untouched", config.Name, config.SSHAddress())
+	return nil
+}
+
+// PowerAction shuts the server down or reboots it over SSH. A server that is off
+// can't be reached, so powering on is not supported.
+func (p *ManualProvider) PowerAction(ctx context.Context, config *VPSConfig, action string) error {
+	var mode string
+	switch action {
+	case PowerActionOff:
+		mode = "-h"
+	case PowerActionReboot:
+		mode = "-r"
+	case PowerActionOn:
+		return fmt.Errorf("%w: servers of provider %s must be powered on by their owner", ErrPowerActionUnsupported, ProviderManual)
+	default:
+		return fmt.Errorf("unknown power action: %s", action)
+	}
+
+	conn, err := p.ssh.ConnectToVPS(config.SSHAddress(), config.SSHUser, p.privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", config.Name, err)
+	}
+	defer conn.Close()
+
+	// Detach and delay the shutdown so the command returns before the connection drops
+	command := fmt.Sprintf("%snohup sh -c 'sleep 2; shutdown %s now' >/dev/null 2>&1 &", sudoPrefix(config.SSHUser), mode)
+	if _, err := p.ssh.ExecuteCommand(conn, command); err != nil {
+		return fmt.Errorf("failed to %s %s: %w", action, config.Name, err)
+	}
+	return nil
+}
+
+// ServerExists always reports true: a manually added server is only known by
+// its SSH address, so whether it is still there shows when connecting to it
+func (p *ManualProvider) ServerExists(ctx context.Context, config *VPSConfig) (bool, error) {
+	return true, nil
+}
+
+// ListServers returns nothing: manually added servers are not listed by any API
+func (p *ManualProvider) ListServers(ctx context.Context) ([]CloudServer, error) {
+	return nil, nil
+}
+
+// installAuthorizedKey appends publicKey to the user's authorized_keys unless it is already there
+func installAuthorizedKey(sshService *SSHService, conn *SSHConnection, publicKey string) error {
+	key := shellQuote(strings.TrimSpace(publicKey))
+	command := fmt.Sprintf("mkdir -p ~/.ssh && chmod 700 ~/.ssh && touch ~/.ssh/authorized_keys && "+
+		"chmod 600 ~/.ssh/authorized_keys && (grep -qxF %s ~/.ssh/authorized_keys || echo %s >> ~/.ssh/authorized_keys)", key, key)
+	if _, err := sshService.ExecuteCommand(conn, command); err != nil {
+		return fmt.Errorf("failed to install SSH key: %w", err)
+	}
+	return nil
+}
+
+// manualServerFacts is what a manually added server reports about itself
+type manualServerFacts struct {
+	CPUs         float32
+	MemoryGB     float32
+	Architecture string
+	Timezone     string
+}
+
+// gatherManualServerFacts reads the CPU count, memory, architecture and timezone of a server
+func gatherManualServerFacts(sshService *SSHService, conn *SSHConnection) (*manualServerFacts, error) {
+	result, err := sshService.ExecuteCommand(conn, "nproc; awk '/MemTotal/ {print $2}' /proc/meminfo; uname -m; "+
+		"timedatectl show --property=Timezone --value 2>/dev/null || cat /etc/timezone 2>/dev/null || echo UTC")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read server details: %w", err)
+	}
+
+	lines := strings.Split(result.Output, "\n")
+	if len(lines) < 4 {
+		return nil, fmt.Errorf("unexpected server details: %q", result.Output)
+	}
+
+	facts := &manualServerFacts{
+		Architecture: strings.TrimSpace(lines[2]),
+		Timezone:     strings.TrimSpace(lines[3]),
+	}
+	if cpus, err := strconv.Atoi(strings.TrimSpace(lines[0])); err == nil {
+		facts.CPUs = float32(cpus)
+	}
+	if memKB, err := strconv.ParseFloat(strings.TrimSpace(lines[1]), 64); err == nil {
+		facts.MemoryGB = float32(memKB / (1024 * 1024))
+	}
+	return facts, nil
+}
+
+// startManualBootstrap uploads the bootstrap script and runs it detached, so it
+// survives the SSH session. Progress is reported through /opt/xanthus/status.
+func startManualBootstrap(sshService *SSHService, conn *SSHConnection, user, script string) error {
+	sudo := sudoPrefix(user)
+	if sudo != "" {
+		if _, err := sshService.ExecuteCommand(conn, "sudo -n true"); err != nil {
+			return fmt.Errorf("user %s needs passwordless sudo to bootstrap the server: %w", user, err)
+		}
+	}
+
+	upload := fmt.Sprintf("%[1]smkdir -p /opt/xanthus && echo %[2]s | base64 -d | %[1]stee %[3]s >/dev/null && %[1]schmod 0700 %[3]s",
+		sudo, base64.StdEncoding.EncodeToString([]byte(script)), manualBootstrapScript)
+	if _, err := sshService.ExecuteCommand(conn, upload); err != nil {
+		return fmt.Errorf("failed to upload bootstrap script: %w", err)
+	}
+
+	run := fmt.Sprintf("%ssh -c 'echo INSTALLING > /opt/xanthus/status; nohup sh -c \"%s || echo FAILED > /opt/xanthus/status\" > %s 2>&1 &'",
+		sudo, manualBootstrapScript, manualBootstrapLog)
+	if _, err := sshService.ExecuteCommand(conn, run); err != nil {
+		return fmt.Errorf("failed to start bootstrap script: %w", err)
+	}
+	return nil
+}
+
+// sudoPrefix returns "sudo " unless user is root
+func sudoPrefix(user string) string {
+	if user == "" || user == "root" {
+		return ""
+	}
+	return "sudo "
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/oracle/oci-go-sdk/v65/common"
+	"github.com/oracle/oci-go-sdk/v65/core"
+)
+
+// OCI Always Free tier limits for VM.Standard.A1.Flex
+const (
+	ociDefaultShape        = "VM.Standard.A1.Flex"
+	ociFreeTierMaxOCPU     = 4
+	ociFreeTierMaxMemoryGB = 24
+)
+
+func init() {
+	RegisterCloudProvider(ProviderOCI, func(token, accountID string) (CloudProvider, error) {
+		authToken, err := utils.GetOCIAuthToken(token, accountID)
+		if err != nil {
+			return nil, fmt.Errorf("OCI auth token not configured: %w", err)
+		}
+		return NewOCIProvider(authToken)
+	}, "oci", "oracle")
+}
+
+// OCIProvider implements CloudProvider on top of OCIService
+type OCIProvider struct {
+	service *OCIService
+}
+
+// NewOCIProvider creates an Oracle Cloud provider for an OCI auth token
+func NewOCIProvider(authToken string) (*OCIProvider, error) {
+	service, err := NewOCIService(authToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCI service: %w", err)
+	}
+	return &OCIProvider{service: service}, nil
+}
+
+// Name returns the provider name
+func (p *OCIProvider) Name() string {
+	return ProviderOCI
+}
+
+// ListLocations returns the region of the OCI credentials, the only one instances are created in
+func (p *OCIProvider) ListLocations(ctx context.Context) ([]CloudLocation, error) {
+	return []CloudLocation{{Name: p.service.region, Description: p.service.region}}, nil
+}
+
+// ListServerTypes returns the compute shapes available to the tenancy
+func (p *OCIProvider) ListServerTypes(ctx context.Context, location string) ([]CloudServerType, error) {
+	shapes, err := p.service.ListComputeShapes(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]CloudServerType, 0, len(shapes))
+	for _, shape := range shapes {
+		result = append(result, CloudServerType{
+			Name:         shape.Shape,
+			Description:  shape.ProcessorDescription,
+			Architecture: ociArchitecture(shape.Shape),
+			Cores:        float64(shape.Ocpus),
+			MemoryGB:     float64(shape.MemoryInGBs),
+			Flexible:     shape.IsFlexible,
+		})
+	}
+	return result, nil
+}
+
+// Pricing returns zero; Xanthus targets the Always Free tier and does not track OCI costs
+func (p *OCIProvider) Pricing(ctx context.Context, serverType, location string) (float64, float64, error) {
+	return 0, 0, nil
+}
+
+// RegisterSSHKey is a no-op, OCI injects the public key through instance metadata
+func (p *OCIProvider) RegisterSSHKey(ctx context.Context, name, publicKey string) (string, error) {
+	return name, nil
+}
+
+// UnregisterSSHKey is a no-op, instance metadata only seeds authorized_keys at first boot
+func (p *OCIProvider) UnregisterSSHKey(ctx context.Context, publicKey string) error {
+	return nil
+}
+
+// CloudInit returns the cloud-init template for OCI instances
+func (p *OCIProvider) CloudInit() string {
+	return ociCloudInitScript
+}
+
+// CreateServer creates an instance, setting up the Xanthus network on first use
+func (p *OCIProvider) CreateServer(ctx context.Context, req CloudServerRequest) (*CloudServer, error) {
+	if req.ServerType == "" {
+		req.ServerType = ociDefaultShape
+	}
+	if req.CPUs == 0 {
+		req.CPUs = 1
+	}
+	if req.MemoryGB == 0 {
+		req.MemoryGB = 6
+	}
+	if err := validateOCIShapeConfig(req.ServerType, req.CPUs, req.MemoryGB); err != nil {
+		return nil, err
+	}
+
+	log.Printf("Creating OCI instance: %s with shape %s (%v OCPU, %v GB RAM)", req.Name, req.ServerType, req.CPUs, req.MemoryGB)
+	instance, err := p.service.CreateVPSWithUserData(ctx, req.Name, req.ServerType, req.SSHPublicKey, req.UserData, req.Timezone, req.CPUs, req.MemoryGB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCI instance: %w", err)
+	}
+
+	return &CloudServer{
+		ID:           hashServerID(instance.ID),
+		InstanceID:   instance.ID,
+		Name:         instance.DisplayName,
+		PublicIPv4:   instance.PublicIP,
+		ServerType:   instance.Shape,
+		Location:     p.service.region,
+		Architecture: ociArchitecture(instance.Shape),
+		CPUs:         req.CPUs,
+		MemoryGB:     req.MemoryGB,
+		CreatedAt:    time.Now().Format(time.RFC3339),
+	}, nil
+}
+
+// DeleteServer terminates an instance. Instances added before their OCID was
+// recorded are looked up by name or public IP.
+func (p *OCIProvider) DeleteServer(ctx context.Context, config *VPSConfig) error {
+	instanceID := config.ProviderInstanceID
+	if instanceID == "" {
+		instances, err := p.service.ListInstances(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list OCI instances: %w", err)
+		}
+		for _, instance := range instances {
+			if instance.DisplayName == config.Name || instance.PublicIP == config.PublicIPv4 {
+				instanceID = instance.ID
+				break
+			}
+		}
+		if instanceID == "" {
+			log.Printf("Warning: No OCI instance found for server %d, skipping cloud deletion", config.ServerID)
+			return nil
+		}
+	}
+
+	if err := p.service.DeleteVPSWithCleanup(ctx, instanceID, false); err != nil {
+		if isOCINotFound(err) {
+			log.Printf("OCI instance %s not found (already deleted)", instanceID)
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// PowerAction powers an instance off or on, or reboots it
+func (p *OCIProvider) PowerAction(ctx context.Context, config *VPSConfig, action string) error {
+	if config.ProviderInstanceID == "" {
+		return fmt.Errorf("OCI instance ID not found in configuration")
+	}
+
+	switch action {
+	case PowerActionOff:
+		return p.service.PowerOffInstance(ctx, config.ProviderInstanceID)
+	case PowerActionOn:
+		return p.service.PowerOnInstance(ctx, config.ProviderInstanceID)
+	case PowerActionReboot:
+		return p.service.RebootInstance(ctx, config.ProviderInstanceID)
+	default:
+		return fmt.Errorf("unknown power action: %s", action)
+	}
+}
+
+// ServerExists looks the instance up by OCID, or by name or public IP for
+// instances added before their OCID was recorded. Terminated instances are gone.
+func (p *OCIProvider) ServerExists(ctx context.Context, config *VPSConfig) (bool, error) {
+	if config.ProviderInstanceID == "" {
+		instance, err := p.findInstance(ctx, config.Name, config.PublicIPv4)
+		if err != nil {
+			return false, err
+		}
+		return !ociInstanceGone(instance.LifecycleState), nil
+	}
+
+	state, err := p.service.InstanceState(ctx, config.ProviderInstanceID)
+	if err != nil {
+		if isOCINotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return !ociInstanceGone(state), nil
+}
+
+// FindInstanceID returns the OCID of the instance with the given public IP or
+// name, for instances added by hand rather than created by Xanthus
+func (p *OCIProvider) FindInstanceID(ctx context.Context, name, publicIP string) (string, error) {
+	instance, err := p.findInstance(ctx, name, publicIP)
+	if err != nil {
+		return "", err
+	}
+	if ociInstanceGone(instance.LifecycleState) {
+		return "", fmt.Errorf("OCI instance %s is %s", instance.ID, strings.ToLower(instance.LifecycleState))
+	}
+	return instance.ID, nil
+}
+
+// findInstance searches every instance of the tenancy, whether or not it is
+// tagged managed_by=xanthus, for one with the given public IP or name. Live
+// instances win over terminated ones with the same name. Finding none is an
+// error rather than a missing server: without an OCID Xanthus can't tell a
+// deleted instance from one it can't see.
+func (p *OCIProvider) findInstance(ctx context.Context, name, publicIP string) (*OCIInstance, error) {
+	instances, err := p.service.ListAllInstances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OCI instances: %w", err)
+	}
+
+	var gone *OCIInstance
+	for i := range instances {
+		instance := &instances[i]
+		if ociInstanceGone(instance.LifecycleState) {
+			if gone == nil && name != "" && instance.DisplayName == name {
+				gone = instance
+			}
+			continue
+		}
+		if (publicIP != "" && instance.PublicIP == publicIP) || (name != "" && instance.DisplayName == name) {
+			return instance, nil
+		}
+	}
+	if gone != nil {
+		return gone, nil
+	}
+	return nil, fmt.Errorf("no OCI instance is named %s or has public IP %s", name, publicIP)
+}
+
+// ListServers returns every running or stopped instance of the tenancy, not only those tagged managed_by=xanthus
+func (p *OCIProvider) ListServers(ctx context.Context) ([]CloudServer, error) {
+	instances, err := p.service.ListAllInstances(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list OCI instances: %w", err)
+	}
+
+	result := make([]CloudServer, 0, len(instances))
+	for _, instance := range instances {
+		if ociInstanceGone(instance.LifecycleState) {
+			continue
+		}
+		server := CloudServer{
+			ID:           hashServerID(instance.ID),
+			InstanceID:   instance.ID,
+			Name:         instance.DisplayName,
+			PublicIPv4:   instance.PublicIP,
+			ServerType:   instance.Shape,
+			Location:     p.service.region,
+			Architecture: ociArchitecture(instance.Shape),
+		}
+		if instance.TimeCreated != nil {
+			server.CreatedAt = instance.TimeCreated.Format(time.RFC3339)
+		}
+		result = append(result, server)
+	}
+	return result, nil
+}
+
+// ociInstanceGone reports whether an instance lifecycle state means the instance was deleted
+func ociInstanceGone(state string) bool {
+	return state == string(core.InstanceLifecycleStateTerminating) || state == string(core.InstanceLifecycleStateTerminated)
+}
+
+// validateOCIShapeConfig enforces the Always Free tier limits of VM.Standard.A1.Flex
+func validateOCIShapeConfig(shape string, ocpu, memory float32) error {
+	if shape != ociDefaultShape {
+		return nil
+	}
+	switch {
+	case ocpu > ociFreeTierMaxOCPU:
+		return fmt.Errorf("%w: OCPU count cannot exceed %d for Always Free tier (%s)", ErrInvalidServerRequest, ociFreeTierMaxOCPU, shape)
+	case memory > ociFreeTierMaxMemoryGB:
+		return fmt.Errorf("%w: memory cannot exceed %dGB for Always Free tier (%s)", ErrInvalidServerRequest, ociFreeTierMaxMemoryGB, shape)
+	case ocpu < 1:
+		return fmt.Errorf("%w: OCPU count must be at least 1", ErrInvalidServerRequest)
+	case memory < 1:
+		return fmt.Errorf("%w: memory must be at least 1GB", ErrInvalidServerRequest)
+	}
+	return nil
+}
+
+// ociArchitecture reports the CPU architecture of a shape
+func ociArchitecture(shape string) string {
+	if strings.Contains(shape, ".A1.") || strings.Contains(shape, ".A2.") {
+		return "ARM64 Ampere Altra"
+	}
+	return "x86_64"
+}
+
+// isOCINotFound reports whether an OCI API error is a 404
+func isOCINotFound(err error) bool {
+	var serviceErr common.ServiceError
+	if errors.As(err, &serviceErr) {
+		return serviceErr.GetHTTPStatusCode() == http.StatusNotFound
+	}
+	return strings.Contains(err.Error(), "NotAuthorizedOrNotFound")
+}
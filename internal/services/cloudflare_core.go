@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"strings"
 	"time"
+
+	"github.com/chrishham/xanthus/internal/models"
 )
 
 const (
@@ -118,3 +120,28 @@ func (cs *CloudflareService) GetZoneID(token, domain string) (string, error) {
 
 	return zones[0].ID, nil
 }
+
+// ListZones retrieves every zone the token can access
+func (cs *CloudflareService) ListZones(token string) ([]models.CloudflareDomain, error) {
+	var zones []models.CloudflareDomain
+	for page := 1; ; page++ {
+		resp, err := cs.makeRequest("GET", fmt.Sprintf("/zones?per_page=50&page=%d", page), token, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resultBytes, err := json.Marshal(resp.Result)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal result: %w", err)
+		}
+		var batch []models.CloudflareDomain
+		if err := json.Unmarshal(resultBytes, &batch); err != nil {
+			return nil, fmt.Errorf("failed to parse zones: %w", err)
+		}
+		zones = append(zones, batch...)
+
+		if len(batch) < 50 {
+			return zones, nil
+		}
+	}
+}
@@ -81,6 +81,37 @@ func (cs *CloudflareService) CreateDNSRecord(token, zoneID, recordType, name, co
 	return &record, nil
 }
 
+// UpdateDNSRecordContent points an existing DNS record at new content, keeping its name and proxy setting
+func (cs *CloudflareService) UpdateDNSRecordContent(token, zoneID, recordID, content string) error {
+	body := map[string]interface{}{
+		"content": content,
+	}
+	_, err := cs.makeRequest("PATCH", fmt.Sprintf("/zones/%s/dns_records/%s", zoneID, recordID), token, body)
+	return err
+}
+
+// PointARecord creates the A record name pointing to ip or, when it already
+// exists, points it at ip. It is safe to call again for the same record.
+func (cs *CloudflareService) PointARecord(token, zoneID, name, ip string, proxied bool) error {
+	records, err := cs.GetDNSRecords(token, zoneID)
+	if err != nil {
+		return fmt.Errorf("failed to get existing DNS records: %w", err)
+	}
+
+	for _, record := range records {
+		if record.Type != "A" || strings.TrimSuffix(record.Name, ".") != name {
+			continue
+		}
+		if record.Content == ip {
+			return nil
+		}
+		return cs.UpdateDNSRecordContent(token, zoneID, record.ID, ip)
+	}
+
+	_, err = cs.CreateDNSRecord(token, zoneID, "A", name, ip, proxied)
+	return err
+}
+
 // ConfigureDNSForVPS configures DNS records for a VPS deployment
 func (cs *CloudflareService) ConfigureDNSForVPS(token, domain, vpsIP string) error {
 	// Get zone ID for the domain
@@ -1,15 +1,18 @@
 package services
 
 import (
+	"context"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"golang.org/x/crypto/ssh"
 	"io"
+	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -24,15 +27,22 @@ type Certificate struct {
 
 // DomainSSLConfig represents SSL configuration for a domain
 type DomainSSLConfig struct {
-	Domain          string `json:"domain"`
-	ZoneID          string `json:"zone_id"`
-	CertificateID   string `json:"certificate_id"`
-	Certificate     string `json:"certificate"`
-	PrivateKey      string `json:"private_key"`
-	ConfiguredAt    string `json:"configured_at"`
-	SSLMode         string `json:"ssl_mode"`
-	AlwaysUseHTTPS  bool   `json:"always_use_https"`
-	PageRuleCreated bool   `json:"page_rule_created"`
+	Domain                string `json:"domain"`
+	ZoneID                string `json:"zone_id"`
+	CertificateID         string `json:"certificate_id"`
+	Certificate           string `json:"certificate"`
+	PrivateKey            string `json:"private_key"`
+	ConfiguredAt          string `json:"configured_at"`
+	SSLMode               string `json:"ssl_mode"`
+	AlwaysUseHTTPS        bool   `json:"always_use_https"`
+	PageRuleCreated       bool   `json:"page_rule_created"`
+	Issuer                string `json:"issuer,omitempty"`   // IssuerCloudflareOrigin when empty
+	DNSOnly               bool   `json:"dns_only,omitempty"` // records are created without the Cloudflare proxy
+	ExpiresAt             string `json:"expires_at,omitempty"`
+	RenewedAt             string `json:"renewed_at,omitempty"`
+	RenewalError          string `json:"renewal_error,omitempty"`           // last failed renewal, cleared on success
+	DistributionPending   bool   `json:"distribution_pending,omitempty"`    // the renewed certificate is not on every server yet
+	ReplacedCertificateID string `json:"replaced_certificate_id,omitempty"` // revoked once every server has the renewed certificate
 }
 
 // CSRConfig represents a Certificate Signing Request configuration
@@ -325,14 +335,13 @@ func (cs *CloudflareService) ConfigureDomainSSL(token, domain, csr, csrPrivateKe
 		return nil, fmt.Errorf("failed to create origin certificate: %w", err)
 	}
 	config.CertificateID = cert.ID
-	config.PrivateKey = csrPrivateKey
 
 	// Step 4: Append Cloudflare Root Certificate
 	fullCert, err := cs.AppendRootCertificate(cert.Certificate)
 	if err != nil {
 		return nil, fmt.Errorf("failed to append root certificate: %w", err)
 	}
-	config.Certificate = fullCert
+	config.setCertificate(fullCert, csrPrivateKey)
 
 	// Step 5: Enable Always Use HTTPS
 	if err := cs.EnableAlwaysHTTPS(token, zoneID); err != nil {
@@ -349,6 +358,100 @@ func (cs *CloudflareService) ConfigureDomainSSL(token, domain, csr, csrPrivateKe
 	return config, nil
 }
 
+// ConfigureDomainACME sets up a domain like ConfigureDomainSSL, but with a publicly
+// trusted certificate for the domain and its wildcard, issued by an ACME CA through
+// dns-01 challenges in the domain's zone. With dnsOnly, application records are
+// created without the Cloudflare proxy and clients connect to the server directly.
+func (cs *CloudflareService) ConfigureDomainACME(ctx context.Context, token, domain string, issuer *ACMEService, dnsOnly bool) (*DomainSSLConfig, error) {
+	config := &DomainSSLConfig{
+		Domain:       domain,
+		ConfiguredAt: time.Now().UTC().Format(time.RFC3339),
+		Issuer:       IssuerACME,
+		DNSOnly:      dnsOnly,
+	}
+
+	// Step 1: Get Zone ID
+	zoneID, err := cs.GetZoneID(token, domain)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get zone ID: %w", err)
+	}
+	config.ZoneID = zoneID
+
+	// Step 2: Set SSL mode to Full (strict), the ACME certificate is trusted by Cloudflare too
+	if err := cs.SetSSLMode(token, zoneID); err != nil {
+		return nil, fmt.Errorf("failed to set SSL mode: %w", err)
+	}
+	config.SSLMode = "strict"
+
+	// Step 3: Obtain the certificate through dns-01 challenges in the zone
+	log.Printf("Requesting ACME certificate for %s from %s", domain, issuer.DirectoryURL())
+	cert, err := issuer.ObtainCertificate(ctx, []string{domain, "*." + domain}, NewCloudflareDNS01Solver(cs, token, zoneID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to obtain ACME certificate: %w", err)
+	}
+	config.setCertificate(cert.Certificate, cert.PrivateKey)
+
+	// Step 4: Enable Always Use HTTPS
+	if err := cs.EnableAlwaysHTTPS(token, zoneID); err != nil {
+		return nil, fmt.Errorf("failed to enable always HTTPS: %w", err)
+	}
+	config.AlwaysUseHTTPS = true
+
+	// Step 5: Create Page Rule for www redirect
+	if err := cs.CreatePageRule(token, zoneID, domain); err != nil {
+		return nil, fmt.Errorf("failed to create page rule: %w", err)
+	}
+	config.PageRuleCreated = true
+
+	return config, nil
+}
+
+// Errors returned by ConfigureDomain for requests that can't be fulfilled
+var (
+	ErrDomainConfigured = errors.New("domain already configured")
+	ErrInvalidIssuer    = errors.New("invalid certificate issuer")
+)
+
+// ConfigureDomain configures SSL and DNS for a Cloudflare domain with the given
+// issuer (IssuerCloudflareOrigin when empty) and stores the configuration
+func (cs *CloudflareService) ConfigureDomain(ctx context.Context, kv *KVService, token, accountID, domain, issuer string, dnsOnly bool) (*DomainSSLConfig, error) {
+	if existing, err := kv.GetDomainSSLConfig(token, accountID, domain); err == nil && existing != nil {
+		return nil, ErrDomainConfigured
+	}
+
+	var config *DomainSSLConfig
+	switch issuer {
+	case IssuerACME:
+		acme, err := LoadACMEService(kv, token, accountID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ACME account: %w", err)
+		}
+		if config, err = cs.ConfigureDomainACME(ctx, token, domain, acme, dnsOnly); err != nil {
+			return nil, err
+		}
+	case "", IssuerCloudflareOrigin:
+		if dnsOnly {
+			return nil, fmt.Errorf("%w: DNS only domains need a publicly trusted certificate, use issuer %q", ErrInvalidIssuer, IssuerACME)
+		}
+
+		var csrConfig CSRConfig
+		if err := kv.GetValue(token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+			return nil, fmt.Errorf("CSR not found, log in to the web UI once to generate it: %w", err)
+		}
+		var err error
+		if config, err = cs.ConfigureDomainSSL(token, domain, csrConfig.CSR, csrConfig.PrivateKey); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrInvalidIssuer, issuer)
+	}
+
+	if err := kv.StoreDomainSSLConfig(token, accountID, config); err != nil {
+		return nil, fmt.Errorf("failed to store domain configuration: %w", err)
+	}
+	return config, nil
+}
+
 // ConvertPrivateKeyToSSH converts a PEM-encoded RSA private key to SSH public key format
 func (cs *CloudflareService) ConvertPrivateKeyToSSH(privateKeyPEM string) (string, error) {
 	// Parse the PEM private key
@@ -0,0 +1,536 @@
+package services
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+//go:embed k3s-agent-cloudinit.yaml
+var agentUserData string
+
+// Cluster roles reported by ClusterNode.Role and ClusterMembership.Role
+const (
+	ClusterRoleServer = "server"
+	ClusterRoleAgent  = "agent"
+)
+
+// ErrInvalidClusterRequest is wrapped by cluster errors caused by the request
+var ErrInvalidClusterRequest = errors.New("invalid cluster request")
+
+var nodeNamePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ClusterJoin is what an agent node needs to join a server node's cluster
+type ClusterJoin struct {
+	ServerID int    // VPSConfig.ServerID of the server node
+	Address  string // Address the agent reaches the server's API on, private when possible
+	Token    string // The server's node token
+	Version  string // K3s version of the server, e.g. "v1.30.4+k3s1"
+}
+
+// userData renders the agent cloud-init template
+func (j *ClusterJoin) userData(nodeName, timezone string) string {
+	return RenderCloudInit(agentUserData, CloudInitVars{
+		Timezone:   timezone,
+		K3sServer:  j.Address,
+		K3sToken:   j.Token,
+		K3sVersion: j.Version,
+		NodeName:   nodeName,
+	})
+}
+
+// JoinNodeRequest describes an agent node to add to a server's cluster. Cloud
+// servers are created with Provider, ServerType and Location; servers of
+// provider Manual are added by Host like AddExistingServer.
+type JoinNodeRequest struct {
+	ServerID   int    // The server node
+	Provider   string // defaults to the server node's provider
+	Name       string // VPS and Kubernetes node name
+	ServerType string
+	Location   string // defaults to the server node's location
+	Timezone   string
+	CPUs       float32 // Flexible server types only
+	MemoryGB   float32 // Flexible server types only
+
+	// Manual servers only
+	Host     string
+	SSHUser  string
+	SSHPort  int
+	Password string
+}
+
+// ClusterNode is a Kubernetes node of a cluster
+type ClusterNode struct {
+	Name           string  `json:"name"`
+	ServerID       int     `json:"server_id,omitempty"` // 0 for nodes Xanthus doesn't manage
+	Role           string  `json:"role"`
+	Ready          bool    `json:"ready"`
+	InternalIP     string  `json:"internal_ip"`
+	KubeletVersion string  `json:"kubelet_version"`
+	CPUs           float64 `json:"cpus"`
+	MemoryGB       float64 `json:"memory_gb"`
+}
+
+// ClusterMembership describes the cluster a VPS belongs to
+type ClusterMembership struct {
+	Role       string `json:"role"`
+	ServerID   int    `json:"server_id"` // The server node; the VPS itself for server nodes
+	ServerName string `json:"server_name"`
+	Agents     []int  `json:"agents,omitempty"` // Agent nodes, for server nodes
+}
+
+// ClusterService turns VPSs into multi-node K3s clusters: agent nodes are
+// created or added with a cloud-init that joins the cluster of a server node
+type ClusterService struct {
+	kv   *KVService
+	keys *SSHKeyService
+	ssh  *SSHService
+	vps  *VPSService
+
+	joinTimeout  time.Duration // How long to wait for a new node to become Ready
+	pollInterval time.Duration
+}
+
+// NewClusterService creates a cluster service on the process-wide state store
+func NewClusterService() *ClusterService {
+	return NewClusterServiceWithStore(utils.GetStateStore(), nil)
+}
+
+// NewClusterServiceWithStore creates a cluster service on the given state
+// store and keyring; a nil keyring stands for the process-wide one
+func NewClusterServiceWithStore(store utils.StateStore, keyring *utils.Keyring) *ClusterService {
+	kv := NewKVServiceWithStore(store)
+	keys := NewSSHKeyServiceWithStore(store, keyring)
+
+	vps := NewVPSService()
+	vps.kv = kv
+	vps.keys = keys
+	vps.provider = NewProviderResolver(kv)
+
+	return clusterServiceFor(vps)
+}
+
+// clusterServiceFor creates a cluster service sharing the stores of a VPS service
+func clusterServiceFor(vps *VPSService) *ClusterService {
+	return &ClusterService{
+		kv:           vps.kv,
+		keys:         vps.keys,
+		ssh:          vps.ssh,
+		vps:          vps,
+		joinTimeout:  20 * time.Minute,
+		pollInterval: 15 * time.Second,
+	}
+}
+
+// Join adds an agent node to the cluster of a server node. On providers with
+// private networks the nodes are connected over one when the agent is in the
+// server's location. It returns once the node is Ready.
+func (s *ClusterService) Join(ctx context.Context, token, accountID string, req JoinNodeRequest) (*VPSConfig, error) {
+	server, err := s.kv.GetVPSConfig(token, accountID, req.ServerID)
+	if err != nil {
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			return nil, fmt.Errorf("%w: server %d not found", ErrInvalidClusterRequest, req.ServerID)
+		}
+		return nil, fmt.Errorf("failed to get VPS config: %w", err)
+	}
+	if server.IsAgent() {
+		return nil, fmt.Errorf("%w: %s is an agent node, join its server node %d instead", ErrInvalidClusterRequest, server.Name, server.ClusterServerID)
+	}
+	if !nodeNamePattern.MatchString(req.Name) {
+		return nil, fmt.Errorf("%w: node name %q must be lowercase letters, digits and dashes", ErrInvalidClusterRequest, req.Name)
+	}
+
+	provider := server.Provider
+	if req.Provider != "" {
+		var ok bool
+		if provider, ok = CanonicalProviderName(req.Provider); !ok {
+			return nil, fmt.Errorf("%w: unsupported provider %s", ErrInvalidClusterRequest, req.Provider)
+		}
+	}
+	if provider == ProviderManual && req.Host == "" {
+		return nil, fmt.Errorf("%w: the host of a manual agent node is required", ErrInvalidClusterRequest)
+	}
+	if req.Location == "" && provider == server.Provider {
+		req.Location = server.Location
+	}
+
+	if err := StartJobStep(ctx, fmt.Sprintf("Reading the cluster of %s", server.Name)); err != nil {
+		return nil, err
+	}
+	conn, err := s.connect(token, accountID, server)
+	if err != nil {
+		return nil, err
+	}
+	join := &ClusterJoin{ServerID: server.ServerID, Address: server.PublicIPv4}
+	result, err := s.ssh.ExecuteCommand(conn, sudoPrefix(server.SSHUser)+"cat /var/lib/rancher/k3s/server/node-token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the node token of %s (is it a K3s server?): %v, output: %s", server.Name, err, commandOutput(result))
+	}
+	join.Token = strings.TrimSpace(result.Output)
+
+	nodes, err := s.nodes(conn)
+	if err != nil {
+		return nil, err
+	}
+	for _, node := range nodes {
+		if node.Name == req.Name {
+			return nil, fmt.Errorf("%w: the cluster of %s already has a node called %s", ErrInvalidClusterRequest, server.Name, req.Name)
+		}
+		if node.Role == ClusterRoleServer && join.Version == "" {
+			join.Version = node.KubeletVersion
+		}
+	}
+
+	privateNetwork := ""
+	if provider == server.Provider && req.Location == server.Location {
+		privateNetwork = s.privateNetwork(ctx, token, accountID, server, conn)
+		if server.PrivateIPv4 != "" && privateNetwork != "" {
+			join.Address = server.PrivateIPv4
+		}
+	}
+	JobLogf(ctx, "Joining %s to the cluster at %s (K3s %s)", req.Name, join.Address, join.Version)
+
+	var config *VPSConfig
+	if provider == ProviderManual {
+		config, err = s.vps.AddExistingServer(ctx, token, accountID, ExistingServerRequest{
+			Name:     req.Name,
+			Host:     req.Host,
+			SSHUser:  req.SSHUser,
+			SSHPort:  req.SSHPort,
+			Password: req.Password,
+			Timezone: req.Timezone,
+			Join:     join,
+		})
+	} else {
+		_, config, err = s.vps.CreateServer(ctx, token, accountID, provider, CloudServerRequest{
+			Name:           req.Name,
+			ServerType:     req.ServerType,
+			Location:       req.Location,
+			Timezone:       req.Timezone,
+			CPUs:           req.CPUs,
+			MemoryGB:       req.MemoryGB,
+			Join:           join,
+			PrivateNetwork: privateNetwork,
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := StartJobStep(ctx, fmt.Sprintf("Waiting for %s to join", config.Name)); err != nil {
+		return config, err
+	}
+	if err := s.waitForNode(ctx, conn, config.Name); err != nil {
+		return config, err
+	}
+
+	log.Printf("✅ %s joined the cluster of %s", config.Name, server.Name)
+	return config, nil
+}
+
+// ListNodes returns the nodes of the cluster a VPS belongs to
+func (s *ClusterService) ListNodes(token, accountID string, serverID int) ([]ClusterNode, error) {
+	config, err := s.serverNode(token, accountID, serverID)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := s.connect(token, accountID, config)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := s.nodes(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	configs, err := s.kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VPS configs: %w", err)
+	}
+	for i := range nodes {
+		for _, c := range configs {
+			member := c.ServerID == config.ServerID || c.ClusterServerID == config.ServerID
+			if member && c.Name == nodes[i].Name {
+				nodes[i].ServerID = c.ServerID
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// serverNode returns the server node of the cluster a VPS belongs to
+func (s *ClusterService) serverNode(token, accountID string, serverID int) (*VPSConfig, error) {
+	config, err := s.kv.GetVPSConfig(token, accountID, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VPS config: %w", err)
+	}
+	if config.IsAgent() {
+		if config, err = s.kv.GetVPSConfig(token, accountID, config.ClusterServerID); err != nil {
+			return nil, fmt.Errorf("failed to get the server node of %d: %w", serverID, err)
+		}
+	}
+	return config, nil
+}
+
+// Membership describes the cluster of a VPS from the stored configurations,
+// without connecting to it
+func (s *ClusterService) Membership(token, accountID string, config *VPSConfig) (*ClusterMembership, error) {
+	if config.IsAgent() {
+		membership := &ClusterMembership{Role: ClusterRoleAgent, ServerID: config.ClusterServerID}
+		if server, err := s.kv.GetVPSConfig(token, accountID, config.ClusterServerID); err == nil {
+			membership.ServerName = server.Name
+		}
+		return membership, nil
+	}
+
+	agents, err := s.agents(token, accountID, config.ServerID)
+	if err != nil {
+		return nil, err
+	}
+	membership := &ClusterMembership{Role: ClusterRoleServer, ServerID: config.ServerID, ServerName: config.Name}
+	for _, agent := range agents {
+		membership.Agents = append(membership.Agents, agent.ServerID)
+	}
+	return membership, nil
+}
+
+// agents returns the agent nodes that joined a server node, sorted by name
+func (s *ClusterService) agents(token, accountID string, serverID int) ([]*VPSConfig, error) {
+	configs, err := s.kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list VPS configs: %w", err)
+	}
+	var agents []*VPSConfig
+	for _, c := range configs {
+		if c.ClusterServerID == serverID {
+			agents = append(agents, c)
+		}
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents, nil
+}
+
+// leave drains an agent node and removes it from its cluster. Manual agents
+// have K3s uninstalled, since the machine outlives its configuration. A
+// server node that is gone is not an error: there is no cluster left to leave.
+func (s *ClusterService) leave(ctx context.Context, token, accountID string, agent *VPSConfig) error {
+	server, err := s.kv.GetVPSConfig(token, accountID, agent.ClusterServerID)
+	if err != nil {
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			return nil
+		}
+		return fmt.Errorf("failed to get the server node of %s: %w", agent.Name, err)
+	}
+
+	if err := StartJobStep(ctx, fmt.Sprintf("Removing %s from the cluster of %s", agent.Name, server.Name)); err != nil {
+		return err
+	}
+	conn, err := s.connect(token, accountID, server)
+	if err != nil {
+		return err
+	}
+
+	drain := fmt.Sprintf("kubectl drain %s --ignore-daemonsets --delete-emptydir-data --force --timeout=300s", agent.Name)
+	if result, err := s.ssh.ExecuteCommand(conn, drain); err != nil {
+		JobLogf(ctx, "Warning: Failed to drain %s: %v, output: %s", agent.Name, err, lastLine(commandOutput(result)))
+	}
+
+	if agent.Provider == ProviderManual {
+		if agentConn, err := s.connect(token, accountID, agent); err != nil {
+			JobLogf(ctx, "Warning: Failed to connect to %s to uninstall K3s: %v", agent.Name, err)
+		} else if result, err := s.ssh.ExecuteCommand(agentConn, sudoPrefix(agent.SSHUser)+"/usr/local/bin/k3s-agent-uninstall.sh"); err != nil {
+			JobLogf(ctx, "Warning: Failed to uninstall K3s from %s: %v, output: %s", agent.Name, err, lastLine(commandOutput(result)))
+		}
+	}
+
+	if result, err := s.ssh.ExecuteCommand(conn, "kubectl delete node --ignore-not-found "+agent.Name); err != nil {
+		return fmt.Errorf("failed to remove node %s: %v, output: %s", agent.Name, err, commandOutput(result))
+	}
+	return nil
+}
+
+// privateNetwork attaches the server node to a private network named after it
+// and returns the network to create the agent in, or "" when the provider has
+// no private networks or the server isn't reachable on one
+func (s *ClusterService) privateNetwork(ctx context.Context, token, accountID string, server *VPSConfig, conn *SSHConnection) string {
+	cp, err := s.vps.CloudProvider(token, accountID, server.Provider)
+	if err != nil {
+		return ""
+	}
+	networks, ok := cp.(PrivateNetworkProvider)
+	if !ok {
+		return ""
+	}
+
+	if server.PrivateNetwork == "" {
+		networkID, privateIP, err := networks.AttachPrivateNetwork(ctx, server, "xanthus-"+server.Name)
+		if err != nil {
+			JobLogf(ctx, "Warning: Nodes will connect over the internet, attaching %s to a private network failed: %v", server.Name, err)
+			return ""
+		}
+		server.PrivateNetwork = networkID
+		server.PrivateIPv4 = privateIP
+		if err := s.kv.StoreVPSConfig(token, accountID, server); err != nil {
+			log.Printf("Warning: Failed to store the private network of %s: %v", server.Name, err)
+		}
+	}
+
+	// The interface of a network attached to a running server may take a while to come up
+	check := fmt.Sprintf("ip -4 -o addr show | grep -q ' %s/'", server.PrivateIPv4)
+	for attempt := 0; attempt < 6; attempt++ {
+		if _, err := s.ssh.ExecuteCommand(conn, check); err == nil {
+			return server.PrivateNetwork
+		}
+		select {
+		case <-ctx.Done():
+			return ""
+		case <-time.After(5 * time.Second):
+		}
+	}
+	JobLogf(ctx, "Warning: %s has no address on its private network yet, nodes will connect over the internet", server.Name)
+	return ""
+}
+
+// waitForNode waits until a node is Ready in the cluster of conn
+func (s *ClusterService) waitForNode(ctx context.Context, conn *SSHConnection, name string) error {
+	deadline := time.Now().Add(s.joinTimeout)
+	cmd := fmt.Sprintf(`kubectl get node %s -o jsonpath='{.status.conditions[?(@.type=="Ready")].status}'`, name)
+	for {
+		if result, err := s.ssh.ExecuteCommand(conn, cmd); err == nil && strings.TrimSpace(result.Output) == "True" {
+			JobLogf(ctx, "Node %s is ready", name)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("node %s did not become ready within %s, see /opt/xanthus/setup.log on it", name, s.joinTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
+
+// nodes lists the Kubernetes nodes of the cluster of conn
+func (s *ClusterService) nodes(conn *SSHConnection) ([]ClusterNode, error) {
+	result, err := s.ssh.ExecuteCommand(conn, "kubectl get nodes -o json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %v, output: %s", err, commandOutput(result))
+	}
+	return parseClusterNodes(result.Output)
+}
+
+func (s *ClusterService) connect(token, accountID string, config *VPSConfig) (*SSHConnection, error) {
+	privateKey, err := s.keys.PrivateKey(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get SSH private key: %w", err)
+	}
+	conn, err := s.ssh.GetOrCreateConnection(config.SSHAddress(), config.SSHUser, privateKey, config.ServerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", config.Name, err)
+	}
+	return conn, nil
+}
+
+// parseClusterNodes parses the output of `kubectl get nodes -o json`, server nodes first
+func parseClusterNodes(output string) ([]ClusterNode, error) {
+	var list struct {
+		Items []struct {
+			Metadata struct {
+				Name   string            `json:"name"`
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+			Status struct {
+				Capacity   map[string]string `json:"capacity"`
+				Conditions []struct {
+					Type   string `json:"type"`
+					Status string `json:"status"`
+				} `json:"conditions"`
+				Addresses []struct {
+					Type    string `json:"type"`
+					Address string `json:"address"`
+				} `json:"addresses"`
+				NodeInfo struct {
+					KubeletVersion string `json:"kubeletVersion"`
+				} `json:"nodeInfo"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(output), &list); err != nil {
+		return nil, fmt.Errorf("failed to parse nodes: %w", err)
+	}
+
+	nodes := make([]ClusterNode, 0, len(list.Items))
+	for _, item := range list.Items {
+		node := ClusterNode{
+			Name:           item.Metadata.Name,
+			Role:           ClusterRoleAgent,
+			KubeletVersion: item.Status.NodeInfo.KubeletVersion,
+			CPUs:           parseCPUQuantity(item.Status.Capacity["cpu"]),
+			MemoryGB:       parseMemoryQuantity(item.Status.Capacity["memory"]),
+		}
+		if _, ok := item.Metadata.Labels["node-role.kubernetes.io/control-plane"]; ok {
+			node.Role = ClusterRoleServer
+		}
+		for _, condition := range item.Status.Conditions {
+			if condition.Type == "Ready" {
+				node.Ready = condition.Status == "True"
+			}
+		}
+		for _, address := range item.Status.Addresses {
+			if address.Type == "InternalIP" {
+				node.InternalIP = address.Address
+			}
+		}
+		nodes = append(nodes, node)
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Role != nodes[j].Role {
+			return nodes[i].Role == ClusterRoleServer
+		}
+		return nodes[i].Name < nodes[j].Name
+	})
+	return nodes, nil
+}
+
+// parseCPUQuantity parses a Kubernetes CPU quantity such as "4" or "3500m"
+func parseCPUQuantity(quantity string) float64 {
+	if milli, ok := strings.CutSuffix(quantity, "m"); ok {
+		n, _ := strconv.ParseFloat(milli, 64)
+		return n / 1000
+	}
+	n, _ := strconv.ParseFloat(quantity, 64)
+	return n
+}
+
+// parseMemoryQuantity parses a Kubernetes memory quantity such as "8030880Ki" into GiB
+func parseMemoryQuantity(quantity string) float64 {
+	units := []struct {
+		suffix string
+		bytes  float64
+	}{
+		{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+		{"k", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+	}
+	for _, unit := range units {
+		if value, ok := strings.CutSuffix(quantity, unit.suffix); ok {
+			n, _ := strconv.ParseFloat(value, 64)
+			return n * unit.bytes / (1 << 30)
+		}
+	}
+	n, _ := strconv.ParseFloat(quantity, 64)
+	return n / (1 << 30)
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// ErrInsufficientCapacity is wrapped by capacity checks of applications that
+// won't fit in the cluster they are deployed to
+var ErrInsufficientCapacity = errors.New("insufficient cluster capacity")
+
+// CapacityService measures the free capacity of clusters over SSH
+type CapacityService struct {
+	ssh       *SSHService
+	cluster   *ClusterService
+	validator *EnhancedApplicationValidator
+}
+
+// NewCapacityService creates a capacity service on the process-wide state store
+func NewCapacityService() *CapacityService {
+	return NewCapacityServiceWithStore(utils.GetStateStore(), nil)
+}
+
+// NewCapacityServiceWithStore creates a capacity service on the given state
+// store and keyring; a nil keyring stands for the process-wide one
+func NewCapacityServiceWithStore(store utils.StateStore, keyring *utils.Keyring) *CapacityService {
+	cluster := NewClusterServiceWithStore(store, keyring)
+	return &CapacityService{
+		ssh:       cluster.ssh,
+		cluster:   cluster,
+		validator: NewEnhancedApplicationValidator(models.NewDefaultApplicationValidator()),
+	}
+}
+
+// ClusterInfo measures the cluster a VPS belongs to: the allocatable CPU and
+// memory of its Ready, schedulable nodes minus what their pods request, the
+// disk space free for volumes on the server node and the Kubernetes and Helm
+// versions
+func (s *CapacityService) ClusterInfo(token, accountID string, serverID int) (*ClusterInfo, error) {
+	server, err := s.cluster.serverNode(token, accountID, serverID)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.cluster.connect(token, accountID, server)
+	if err != nil {
+		return nil, err
+	}
+
+	run := func(what, cmd string) (string, error) {
+		result, err := s.ssh.ExecuteCommand(conn, cmd)
+		if err != nil {
+			return "", fmt.Errorf("failed to get %s of %s: %v, output: %s", what, server.Name, err, lastLine(commandOutput(result)))
+		}
+		return result.Output, nil
+	}
+
+	nodes, err := run("nodes", "kubectl get nodes -o json")
+	if err != nil {
+		return nil, err
+	}
+	pods, err := run("pods", "kubectl get pods -A -o json --field-selector=status.phase!=Succeeded,status.phase!=Failed")
+	if err != nil {
+		return nil, err
+	}
+	info, err := ParseClusterCapacity(nodes, pods)
+	if err != nil {
+		return nil, err
+	}
+
+	// Volumes are provisioned by local-path under /var/lib/rancher on the server node
+	disk, err := run("free disk space", "df -BG --output=avail /var/lib/rancher | tail -1")
+	if err != nil {
+		return nil, err
+	}
+	if info.AvailableDiskGB, err = strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(disk), "G")); err != nil {
+		return nil, fmt.Errorf("failed to parse free disk space %q of %s", strings.TrimSpace(disk), server.Name)
+	}
+
+	version, err := run("Kubernetes version", "kubectl version -o json")
+	if err != nil {
+		return nil, err
+	}
+	var versions struct {
+		ServerVersion struct {
+			GitVersion string `json:"gitVersion"`
+		} `json:"serverVersion"`
+	}
+	if err := json.Unmarshal([]byte(version), &versions); err != nil {
+		return nil, fmt.Errorf("failed to parse Kubernetes version of %s: %w", server.Name, err)
+	}
+	info.KubernetesVersion = versions.ServerVersion.GitVersion
+
+	helm, err := run("Helm version", "helm version --short")
+	if err != nil {
+		return nil, err
+	}
+	info.HelmVersion = strings.TrimSpace(helm)
+
+	return info, nil
+}
+
+// CheckApplication checks that an application fits in the cluster a VPS
+// belongs to, returning an error wrapping ErrInsufficientCapacity if it
+// doesn't. The returned ClusterInfo is nil when the cluster couldn't be measured.
+func (s *CapacityService) CheckApplication(token, accountID string, serverID int, app models.PredefinedApplication) (*ClusterInfo, error) {
+	info, err := s.ClusterInfo(token, accountID, serverID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validator.ValidateCapacity(app, *info); err != nil {
+		return info, fmt.Errorf("%w: %v", ErrInsufficientCapacity, err)
+	}
+	return info, nil
+}
+
+// ParseClusterCapacity sums the free CPU and memory of the Ready, schedulable
+// nodes in the output of `kubectl get nodes -o json` given the pods of
+// `kubectl get pods -A -o json`. Memory is rounded down to whole GB.
+func ParseClusterCapacity(nodesJSON, podsJSON string) (*ClusterInfo, error) {
+	var nodes struct {
+		Items []struct {
+			Metadata struct {
+				Name string `json:"name"`
+			} `json:"metadata"`
+			Spec struct {
+				Unschedulable bool `json:"unschedulable"`
+			} `json:"spec"`
+			Status struct {
+				Allocatable map[string]string `json:"allocatable"`
+				Conditions  []struct {
+					Type   string `json:"type"`
+					Status string `json:"status"`
+				} `json:"conditions"`
+			} `json:"status"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(nodesJSON), &nodes); err != nil {
+		return nil, fmt.Errorf("failed to parse nodes: %w", err)
+	}
+	var pods struct {
+		Items []struct {
+			Spec struct {
+				NodeName   string `json:"nodeName"`
+				Containers []struct {
+					Resources struct {
+						Requests map[string]string `json:"requests"`
+					} `json:"resources"`
+				} `json:"containers"`
+			} `json:"spec"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(podsJSON), &pods); err != nil {
+		return nil, fmt.Errorf("failed to parse pods: %w", err)
+	}
+
+	requestedCPU := map[string]float64{}
+	requestedMemory := map[string]float64{}
+	for _, pod := range pods.Items {
+		for _, container := range pod.Spec.Containers {
+			requestedCPU[pod.Spec.NodeName] += parseCPUQuantity(container.Resources.Requests["cpu"])
+			requestedMemory[pod.Spec.NodeName] += parseMemoryQuantity(container.Resources.Requests["memory"])
+		}
+	}
+
+	info := &ClusterInfo{}
+	var memory float64
+	for _, node := range nodes.Items {
+		ready := false
+		for _, condition := range node.Status.Conditions {
+			if condition.Type == "Ready" {
+				ready = condition.Status == "True"
+			}
+		}
+		if !ready || node.Spec.Unschedulable {
+			continue
+		}
+
+		name := node.Metadata.Name
+		info.NodeCount++
+		info.AvailableCPU += math.Max(0, parseCPUQuantity(node.Status.Allocatable["cpu"])-requestedCPU[name])
+		memory += math.Max(0, parseMemoryQuantity(node.Status.Allocatable["memory"])-requestedMemory[name])
+	}
+	info.AvailableCPU = math.Round(info.AvailableCPU*100) / 100
+	info.AvailableMemoryGB = int(memory)
+	return info, nil
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	DigitalOceanBaseURL = "https://api.digitalocean.com/v2"
+
+	// digitalOceanImage is the image droplets are created from; cloudinit.yaml targets Ubuntu 24.04
+	digitalOceanImage = "ubuntu-24-04-x64"
+)
+
+// DigitalOceanService handles DigitalOcean API operations
+type DigitalOceanService struct {
+	client       *http.Client
+	baseURL      string
+	pollInterval time.Duration
+	pollTimeout  time.Duration
+}
+
+// NewDigitalOceanService creates a new DigitalOcean service instance
+func NewDigitalOceanService() *DigitalOceanService {
+	return NewDigitalOceanServiceWithBaseURL(DigitalOceanBaseURL)
+}
+
+// NewDigitalOceanServiceWithBaseURL creates a DigitalOcean service talking to
+// another API endpoint, such as a test server
+func NewDigitalOceanServiceWithBaseURL(baseURL string) *DigitalOceanService {
+	return &DigitalOceanService{
+		client:       &http.Client{Timeout: 30 * time.Second},
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		pollInterval: 5 * time.Second,
+		pollTimeout:  5 * time.Minute,
+	}
+}
+
+// DigitalOceanError represents a DigitalOcean API error
+type DigitalOceanError struct {
+	ID      string `json:"id"`
+	Message string `json:"message"`
+}
+
+// DigitalOceanDroplet represents a DigitalOcean droplet
+type DigitalOceanDroplet struct {
+	ID        int                   `json:"id"`
+	Name      string                `json:"name"`
+	Status    string                `json:"status"` // new, active, off or archive
+	Memory    int                   `json:"memory"` // MB
+	VCPUs     int                   `json:"vcpus"`
+	Disk      int                   `json:"disk"` // GB
+	SizeSlug  string                `json:"size_slug"`
+	Region    DigitalOceanRegion    `json:"region"`
+	Networks  DigitalOceanNetworks  `json:"networks"`
+	Tags      []string              `json:"tags"`
+	CreatedAt string                `json:"created_at"`
+	Image     DigitalOceanImageInfo `json:"image"`
+}
+
+// DigitalOceanNetworks lists the addresses of a droplet
+type DigitalOceanNetworks struct {
+	V4 []DigitalOceanNetwork `json:"v4"`
+}
+
+// DigitalOceanNetwork is one address of a droplet
+type DigitalOceanNetwork struct {
+	IPAddress string `json:"ip_address"`
+	Type      string `json:"type"` // public or private
+}
+
+// DigitalOceanImageInfo represents image information
+type DigitalOceanImageInfo struct {
+	Slug         string `json:"slug"`
+	Name         string `json:"name"`
+	Distribution string `json:"distribution"`
+}
+
+// PublicIPv4 returns the public IPv4 address of a droplet, or "" before one is assigned
+func (d *DigitalOceanDroplet) PublicIPv4() string {
+	for _, network := range d.Networks.V4 {
+		if network.Type == "public" {
+			return network.IPAddress
+		}
+	}
+	return ""
+}
+
+// DigitalOceanRegion represents a DigitalOcean datacenter region
+type DigitalOceanRegion struct {
+	Slug      string   `json:"slug"`
+	Name      string   `json:"name"`
+	Sizes     []string `json:"sizes"`
+	Available bool     `json:"available"`
+}
+
+// DigitalOceanSize represents a droplet size and its price in USD
+type DigitalOceanSize struct {
+	Slug         string   `json:"slug"`
+	Description  string   `json:"description"`
+	Memory       int      `json:"memory"` // MB
+	VCPUs        int      `json:"vcpus"`
+	Disk         int      `json:"disk"` // GB
+	PriceMonthly float64  `json:"price_monthly"`
+	PriceHourly  float64  `json:"price_hourly"`
+	Regions      []string `json:"regions"`
+	Available    bool     `json:"available"`
+}
+
+// DigitalOceanSSHKey represents an SSH key registered with DigitalOcean
+type DigitalOceanSSHKey struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Fingerprint string `json:"fingerprint"`
+	PublicKey   string `json:"public_key"`
+}
+
+// DigitalOceanCreateDropletRequest represents the droplet creation request
+type DigitalOceanCreateDropletRequest struct {
+	Name     string   `json:"name"`
+	Region   string   `json:"region"`
+	Size     string   `json:"size"`
+	Image    string   `json:"image"`
+	SSHKeys  []string `json:"ssh_keys"` // IDs or fingerprints
+	UserData string   `json:"user_data,omitempty"`
+	IPv6     bool     `json:"ipv6"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// makeRequest makes an authenticated request to the DigitalOcean API and decodes the response into out
+func (ds *DigitalOceanService) makeRequest(ctx context.Context, method, endpoint, apiKey string, body, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		reqBody = bytes.NewReader(jsonBody)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, ds.baseURL+endpoint, reqBody)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := ds.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if resp.StatusCode >= 400 {
+		var apiErr DigitalOceanError
+		if err := json.Unmarshal(bodyBytes, &apiErr); err == nil && apiErr.Message != "" {
+			return fmt.Errorf("API error %s: %s", apiErr.ID, apiErr.Message)
+		}
+		return fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	if out != nil && len(bodyBytes) > 0 {
+		if err := json.Unmarshal(bodyBytes, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
+
+// digitalOceanPage is one page of a list response, with the items under field
+type digitalOceanPage map[string]json.RawMessage
+
+// listAll requests every page of a list endpoint, following links.pages.next,
+// and decodes the items under field of each page
+func listAll[T any](ctx context.Context, ds *DigitalOceanService, endpoint, apiKey, field string) ([]T, error) {
+	var all []T
+	for endpoint != "" {
+		var page digitalOceanPage
+		if err := ds.makeRequest(ctx, "GET", endpoint, apiKey, nil, &page); err != nil {
+			return nil, err
+		}
+
+		var items []T
+		if raw, ok := page[field]; ok {
+			if err := json.Unmarshal(raw, &items); err != nil {
+				return nil, fmt.Errorf("failed to decode %s: %w", field, err)
+			}
+		}
+		all = append(all, items...)
+
+		var links struct {
+			Pages struct {
+				Next string `json:"next"`
+			} `json:"pages"`
+		}
+		if raw, ok := page["links"]; ok {
+			if err := json.Unmarshal(raw, &links); err != nil {
+				return nil, fmt.Errorf("failed to decode pagination links: %w", err)
+			}
+		}
+		endpoint = ""
+		if next := links.Pages.Next; next != "" {
+			// The API token is only ever sent to the API itself
+			if !strings.HasPrefix(next, ds.baseURL+"/") {
+				return nil, fmt.Errorf("unexpected next page URL: %s", next)
+			}
+			endpoint = strings.TrimPrefix(next, ds.baseURL)
+		}
+	}
+	return all, nil
+}
+
+// ValidateAPIKey checks that an API token can access the account
+func (ds *DigitalOceanService) ValidateAPIKey(ctx context.Context, apiKey string) error {
+	return ds.makeRequest(ctx, "GET", "/account", apiKey, nil, nil)
+}
+
+// ListRegions retrieves the datacenter regions
+func (ds *DigitalOceanService) ListRegions(ctx context.Context, apiKey string) ([]DigitalOceanRegion, error) {
+	return listAll[DigitalOceanRegion](ctx, ds, "/regions?per_page=200", apiKey, "regions")
+}
+
+// ListSizes retrieves the droplet sizes with their prices
+func (ds *DigitalOceanService) ListSizes(ctx context.Context, apiKey string) ([]DigitalOceanSize, error) {
+	return listAll[DigitalOceanSize](ctx, ds, "/sizes?per_page=200", apiKey, "sizes")
+}
+
+// ListDroplets retrieves all droplets
+func (ds *DigitalOceanService) ListDroplets(ctx context.Context, apiKey string) ([]DigitalOceanDroplet, error) {
+	return listAll[DigitalOceanDroplet](ctx, ds, "/droplets?per_page=200", apiKey, "droplets")
+}
+
+// GetDroplet retrieves a specific droplet
+func (ds *DigitalOceanService) GetDroplet(ctx context.Context, apiKey string, dropletID int) (*DigitalOceanDroplet, error) {
+	var resp struct {
+		Droplet DigitalOceanDroplet `json:"droplet"`
+	}
+	if err := ds.makeRequest(ctx, "GET", fmt.Sprintf("/droplets/%d", dropletID), apiKey, nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.Droplet, nil
+}
+
+// CreateDroplet creates an Ubuntu droplet and waits until it is active with a public IPv4
+func (ds *DigitalOceanService) CreateDroplet(ctx context.Context, apiKey, name, region, size, sshKeyFingerprint, userData string) (*DigitalOceanDroplet, error) {
+	createReq := DigitalOceanCreateDropletRequest{
+		Name:     name,
+		Region:   region,
+		Size:     size,
+		Image:    digitalOceanImage,
+		SSHKeys:  []string{sshKeyFingerprint},
+		UserData: userData,
+		Tags:     []string{"xanthus"},
+	}
+
+	var resp struct {
+		Droplet DigitalOceanDroplet `json:"droplet"`
+	}
+	if err := ds.makeRequest(ctx, "POST", "/droplets", apiKey, createReq, &resp); err != nil {
+		return nil, err
+	}
+
+	return ds.waitForDroplet(ctx, apiKey, resp.Droplet.ID)
+}
+
+// waitForDroplet polls a new droplet until it is active and has a public IPv4
+func (ds *DigitalOceanService) waitForDroplet(ctx context.Context, apiKey string, dropletID int) (*DigitalOceanDroplet, error) {
+	deadline := time.Now().Add(ds.pollTimeout)
+	for {
+		droplet, err := ds.GetDroplet(ctx, apiKey, dropletID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get droplet %d: %w", dropletID, err)
+		}
+		if droplet.Status == "active" && droplet.PublicIPv4() != "" {
+			return droplet, nil
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("droplet %d did not become active within %v", dropletID, ds.pollTimeout)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(ds.pollInterval):
+		}
+	}
+}
+
+// DeleteDroplet deletes a droplet
+func (ds *DigitalOceanService) DeleteDroplet(ctx context.Context, apiKey string, dropletID int) error {
+	return ds.makeRequest(ctx, "DELETE", fmt.Sprintf("/droplets/%d", dropletID), apiKey, nil, nil)
+}
+
+// PowerOffDroplet powers off a droplet
+func (ds *DigitalOceanService) PowerOffDroplet(ctx context.Context, apiKey string, dropletID int) error {
+	return ds.dropletAction(ctx, apiKey, dropletID, "power_off")
+}
+
+// PowerOnDroplet powers on a droplet
+func (ds *DigitalOceanService) PowerOnDroplet(ctx context.Context, apiKey string, dropletID int) error {
+	return ds.dropletAction(ctx, apiKey, dropletID, "power_on")
+}
+
+// RebootDroplet reboots a droplet
+func (ds *DigitalOceanService) RebootDroplet(ctx context.Context, apiKey string, dropletID int) error {
+	return ds.dropletAction(ctx, apiKey, dropletID, "reboot")
+}
+
+// dropletAction starts a droplet action such as power_off
+func (ds *DigitalOceanService) dropletAction(ctx context.Context, apiKey string, dropletID int, actionType string) error {
+	body := map[string]string{"type": actionType}
+	return ds.makeRequest(ctx, "POST", fmt.Sprintf("/droplets/%d/actions", dropletID), apiKey, body, nil)
+}
+
+// ListSSHKeys retrieves the SSH keys of the account
+func (ds *DigitalOceanService) ListSSHKeys(ctx context.Context, apiKey string) ([]DigitalOceanSSHKey, error) {
+	return listAll[DigitalOceanSSHKey](ctx, ds, "/account/keys?per_page=200", apiKey, "ssh_keys")
+}
+
+// CreateSSHKey registers a new SSH key
+func (ds *DigitalOceanService) CreateSSHKey(ctx context.Context, apiKey, name, publicKey string) (*DigitalOceanSSHKey, error) {
+	body := map[string]string{"name": name, "public_key": publicKey}
+	var resp struct {
+		SSHKey DigitalOceanSSHKey `json:"ssh_key"`
+	}
+	if err := ds.makeRequest(ctx, "POST", "/account/keys", apiKey, body, &resp); err != nil {
+		return nil, err
+	}
+	return &resp.SSHKey, nil
+}
+
+// DeleteSSHKey deletes an SSH key
+func (ds *DigitalOceanService) DeleteSSHKey(ctx context.Context, apiKey string, keyID int) error {
+	return ds.makeRequest(ctx, "DELETE", fmt.Sprintf("/account/keys/%d", keyID), apiKey, nil, nil)
+}
+
+// FindSSHKeyByPublicKey finds an SSH key by its public key content
+func (ds *DigitalOceanService) FindSSHKeyByPublicKey(ctx context.Context, apiKey, publicKey string) (*DigitalOceanSSHKey, error) {
+	keys, err := ds.ListSSHKeys(ctx, apiKey)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		if strings.TrimSpace(key.PublicKey) == strings.TrimSpace(publicKey) {
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
+
+// CreateOrFindSSHKey returns the SSH key with this public key, registering it if needed
+func (ds *DigitalOceanService) CreateOrFindSSHKey(ctx context.Context, apiKey, name, publicKey string) (*DigitalOceanSSHKey, error) {
+	existingKey, err := ds.FindSSHKeyByPublicKey(ctx, apiKey, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for existing SSH key: %w", err)
+	}
+	if existingKey != nil {
+		return existingKey, nil
+	}
+
+	return ds.CreateSSHKey(ctx, apiKey, name, publicKey)
+}
@@ -17,12 +17,12 @@ type EnhancedApplicationValidator struct {
 
 // ClusterInfo represents cluster information for resource validation
 type ClusterInfo struct {
-	AvailableCPU      float64
-	AvailableMemoryGB int
-	AvailableDiskGB   int
-	KubernetesVersion string
-	HelmVersion       string
-	NodeCount         int
+	AvailableCPU      float64 `json:"available_cpu"`
+	AvailableMemoryGB int     `json:"available_memory_gb"`
+	AvailableDiskGB   int     `json:"available_disk_gb"`
+	KubernetesVersion string  `json:"kubernetes_version"`
+	HelmVersion       string  `json:"helm_version"`
+	NodeCount         int     `json:"node_count"`
 }
 
 // NewEnhancedApplicationValidator creates a new enhanced validator
@@ -98,6 +98,12 @@ func (v *EnhancedApplicationValidator) ValidateWithCluster(app models.Predefined
 	}
 
 	// Cluster-specific validation
+	return v.ValidateCapacity(app, cluster)
+}
+
+// ValidateCapacity validates that an application fits in a cluster, without
+// validating the application itself
+func (v *EnhancedApplicationValidator) ValidateCapacity(app models.PredefinedApplication, cluster ClusterInfo) error {
 	if err := v.validateResourceRequirements(app.Requirements, cluster); err != nil {
 		return err
 	}
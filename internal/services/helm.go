@@ -1,6 +1,7 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"strings"
 )
@@ -17,8 +18,9 @@ func NewHelmService() *HelmService {
 	}
 }
 
-// InstallChart installs a Helm chart on the specified VPS using a values file
-func (h *HelmService) InstallChart(vpsIP, sshUser, privateKey, releaseName, chartName, chartVersion, namespace, valuesFile string) error {
+// InstallChart installs a Helm chart on the specified VPS using a values file,
+// streaming Helm's output and pod status changes to the job ctx belongs to
+func (h *HelmService) InstallChart(ctx context.Context, vpsIP, sshUser, privateKey, releaseName, chartName, chartVersion, namespace, valuesFile string) error {
 	// Try to get existing connection from session manager
 	sessionManager := GetGlobalSessionManager()
 	var conn *SSHConnection
@@ -92,16 +94,25 @@ func (h *HelmService) InstallChart(vpsIP, sshUser, privateKey, releaseName, char
 	}
 
 	// Execute Helm install
-	result, err := h.sshService.ExecuteCommand(conn, helmCmd)
+	output := JobOutput(ctx, "helm: ")
+	defer output.Close()
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	go watchReleasePods(watchCtx, h.sshService, conn, namespace, releaseName)
+	result, err := h.sshService.ExecuteCommandStream(ctx, conn, helmCmd, output)
 	if err != nil {
+		if result == nil {
+			return fmt.Errorf("failed to install Helm chart: %v", err)
+		}
 		return fmt.Errorf("failed to install Helm chart: command failed: %v, output: %s", err, result.Output)
 	}
 
 	return nil
 }
 
-// UpgradeChart upgrades an existing Helm release using a values file
-func (h *HelmService) UpgradeChart(vpsIP, sshUser, privateKey, releaseName, chartName, chartVersion, namespace, valuesFile string) error {
+// UpgradeChart upgrades an existing Helm release using values files, later
+// files taking precedence, streaming Helm's output to the job ctx belongs to
+func (h *HelmService) UpgradeChart(ctx context.Context, vpsIP, sshUser, privateKey, releaseName, chartName, chartVersion, namespace string, valuesFiles ...string) error {
 	// Try to get existing connection from session manager
 	sessionManager := GetGlobalSessionManager()
 	var conn *SSHConnection
@@ -144,14 +155,21 @@ func (h *HelmService) UpgradeChart(vpsIP, sshUser, privateKey, releaseName, char
 			releaseName, chartName, chartVersion, namespace)
 	}
 
-	// Add values file if provided
-	if valuesFile != "" {
-		helmCmd += fmt.Sprintf(" -f %s", valuesFile)
+	// Add values files if provided
+	for _, valuesFile := range valuesFiles {
+		if valuesFile != "" {
+			helmCmd += fmt.Sprintf(" -f %s", valuesFile)
+		}
 	}
 
 	// Execute Helm upgrade
-	result, err := h.sshService.ExecuteCommand(conn, helmCmd)
+	output := JobOutput(ctx, "helm: ")
+	defer output.Close()
+	result, err := h.sshService.ExecuteCommandStream(ctx, conn, helmCmd, output)
 	if err != nil {
+		if result == nil {
+			return fmt.Errorf("failed to upgrade Helm chart: %v", err)
+		}
 		return fmt.Errorf("failed to upgrade Helm chart: command failed: %v, output: %s", err, result.Output)
 	}
 
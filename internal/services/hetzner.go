@@ -7,7 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strings"
+	"net/url"
 	"time"
 )
 import _ "embed"
@@ -83,13 +83,14 @@ type HetznerPrivateNet struct {
 
 // HetznerServerTypeInfo represents server type information
 type HetznerServerTypeInfo struct {
-	ID          int     `json:"id"`
-	Name        string  `json:"name"`
-	Description string  `json:"description"`
-	Cores       int     `json:"cores"`
-	Memory      float64 `json:"memory"`
-	Disk        int     `json:"disk"`
-	CPUType     string  `json:"cpu_type"`
+	ID           int     `json:"id"`
+	Name         string  `json:"name"`
+	Description  string  `json:"description"`
+	Cores        int     `json:"cores"`
+	Memory       float64 `json:"memory"`
+	Disk         int     `json:"disk"`
+	CPUType      string  `json:"cpu_type"`
+	Architecture string  `json:"architecture"`
 }
 
 // HetznerDatacenterInfo represents datacenter information
@@ -167,6 +168,7 @@ type HetznerCreateServerRequest struct {
 	Image            string            `json:"image"`
 	SSHKeys          []string          `json:"ssh_keys,omitempty"`
 	UserData         string            `json:"user_data,omitempty"`
+	Networks         []int             `json:"networks,omitempty"`
 	Labels           map[string]string `json:"labels,omitempty"`
 	StartAfterCreate bool              `json:"start_after_create"`
 }
@@ -191,6 +193,14 @@ type HetznerSSHKey struct {
 	Labels      map[string]string `json:"labels"`
 }
 
+// HetznerNetwork is a private network servers can be attached to
+type HetznerNetwork struct {
+	ID      int    `json:"id"`
+	Name    string `json:"name"`
+	IPRange string `json:"ip_range"`
+	Servers []int  `json:"servers"`
+}
+
 // HetznerSSHKeysResponse represents the API response for SSH keys
 type HetznerSSHKeysResponse struct {
 	SSHKeys []HetznerSSHKey `json:"ssh_keys"`
@@ -270,6 +280,34 @@ func (hs *HetznerService) ListServers(apiKey string) ([]HetznerServer, error) {
 	return serversResp.Servers, nil
 }
 
+// ListAllServers retrieves every server of the project, including servers not created by Xanthus
+func (hs *HetznerService) ListAllServers(apiKey string) ([]HetznerServer, error) {
+	var servers []HetznerServer
+	for page := 1; ; page++ {
+		respBody, err := hs.makeRequest("GET", fmt.Sprintf("/servers?per_page=50&page=%d", page), apiKey, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var serversResp struct {
+			Servers []HetznerServer `json:"servers"`
+			Meta    struct {
+				Pagination struct {
+					NextPage int `json:"next_page"`
+				} `json:"pagination"`
+			} `json:"meta"`
+		}
+		if err := json.Unmarshal(respBody, &serversResp); err != nil {
+			return nil, fmt.Errorf("failed to parse servers response: %w", err)
+		}
+		servers = append(servers, serversResp.Servers...)
+
+		if serversResp.Meta.Pagination.NextPage == 0 {
+			return servers, nil
+		}
+	}
+}
+
 // GetServer retrieves details for a specific server
 func (hs *HetznerService) GetServer(apiKey string, serverID int) (*HetznerServer, error) {
 	respBody, err := hs.makeRequest("GET", fmt.Sprintf("/servers/%d", serverID), apiKey, nil)
@@ -289,6 +327,19 @@ func (hs *HetznerService) GetServer(apiKey string, serverID int) (*HetznerServer
 
 // CreateServer creates a new VPS instance using cloud-init script
 func (hs *HetznerService) CreateServer(apiKey, name, serverType, location, sshKeyName string, domain, domainCert, domainKey, timezone string) (*HetznerServer, error) {
+	vars := CloudInitVars{Timezone: timezone}
+	if domain != "" && domainCert != "" && domainKey != "" {
+		vars.Domain = domain
+		vars.DomainCert = base64.StdEncoding.EncodeToString([]byte(domainCert))
+		vars.DomainKey = base64.StdEncoding.EncodeToString([]byte(domainKey))
+	}
+
+	return hs.CreateServerWithUserData(apiKey, name, serverType, location, sshKeyName, RenderCloudInit(defaultUserData, vars))
+}
+
+// CreateServerWithUserData creates a new Ubuntu VPS instance with the given
+// cloud-init user data, attached to the given private networks
+func (hs *HetznerService) CreateServerWithUserData(apiKey, name, serverType, location, sshKeyName, userData string, networks ...int) (*HetznerServer, error) {
 	// Use SSH key name directly - Hetzner accepts both names and IDs
 	var sshKeys []string
 	if sshKeyName != "" {
@@ -301,43 +352,14 @@ func (hs *HetznerService) CreateServer(apiKey, name, serverType, location, sshKe
 		sshKeys = []string{sshKeyName}
 	}
 
-	// Ubuntu 24.04 LTS image
-	image := "ubuntu-24.04"
-
-	// Use cloud-init script with proper readiness verification
-	userData := defaultUserData
-
-	// Replace template variables - always replace to avoid undefined variables
-	if domain != "" && domainCert != "" && domainKey != "" {
-		// Base64 encode the certificate and key
-		certB64 := base64.StdEncoding.EncodeToString([]byte(domainCert))
-		keyB64 := base64.StdEncoding.EncodeToString([]byte(domainKey))
-
-		// Replace environment variables in the cloud-init script
-		userData = strings.ReplaceAll(userData, "${DOMAIN}", domain)
-		userData = strings.ReplaceAll(userData, "${DOMAIN_CERT}", certB64)
-		userData = strings.ReplaceAll(userData, "${DOMAIN_KEY}", keyB64)
-	} else {
-		// Replace with empty values to avoid undefined variables
-		userData = strings.ReplaceAll(userData, "${DOMAIN}", "")
-		userData = strings.ReplaceAll(userData, "${DOMAIN_CERT}", "")
-		userData = strings.ReplaceAll(userData, "${DOMAIN_KEY}", "")
-	}
-
-	// Replace timezone variable
-	if timezone != "" {
-		userData = strings.ReplaceAll(userData, "${TIMEZONE}", timezone)
-	} else {
-		userData = strings.ReplaceAll(userData, "${TIMEZONE}", "")
-	}
-
 	createReq := HetznerCreateServerRequest{
 		Name:             name,
 		ServerType:       serverType,
 		Location:         location,
-		Image:            image,
+		Image:            "ubuntu-24.04",
 		SSHKeys:          sshKeys,
 		UserData:         userData,
+		Networks:         networks,
 		StartAfterCreate: true,
 		Labels: map[string]string{
 			"managed_by": "xanthus",
@@ -385,6 +407,56 @@ func (hs *HetznerService) RebootServer(apiKey string, serverID int) error {
 	return err
 }
 
+// FindNetwork returns the private network called name, or nil if there is none
+func (hs *HetznerService) FindNetwork(apiKey, name string) (*HetznerNetwork, error) {
+	respBody, err := hs.makeRequest("GET", "/networks?name="+url.QueryEscape(name), apiKey, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var networksResp struct {
+		Networks []HetznerNetwork `json:"networks"`
+	}
+	if err := json.Unmarshal(respBody, &networksResp); err != nil {
+		return nil, fmt.Errorf("failed to parse networks response: %w", err)
+	}
+	if len(networksResp.Networks) == 0 {
+		return nil, nil
+	}
+	return &networksResp.Networks[0], nil
+}
+
+// CreateNetwork creates a 10.0.0.0/16 private network with one cloud subnet in networkZone (e.g. "eu-central")
+func (hs *HetznerService) CreateNetwork(apiKey, name, networkZone string) (*HetznerNetwork, error) {
+	body := map[string]interface{}{
+		"name":     name,
+		"ip_range": "10.0.0.0/16",
+		"subnets": []map[string]string{
+			{"type": "cloud", "ip_range": "10.0.0.0/24", "network_zone": networkZone},
+		},
+		"labels": map[string]string{"managed_by": "xanthus"},
+	}
+	respBody, err := hs.makeRequest("POST", "/networks", apiKey, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var networkResp struct {
+		Network HetznerNetwork `json:"network"`
+	}
+	if err := json.Unmarshal(respBody, &networkResp); err != nil {
+		return nil, fmt.Errorf("failed to parse network response: %w", err)
+	}
+	return &networkResp.Network, nil
+}
+
+// AttachServerToNetwork attaches a server to a private network, which assigns it an address
+func (hs *HetznerService) AttachServerToNetwork(apiKey string, serverID, networkID int) error {
+	body := map[string]int{"network": networkID}
+	_, err := hs.makeRequest("POST", fmt.Sprintf("/servers/%d/actions/attach_to_network", serverID), apiKey, body)
+	return err
+}
+
 // getSSHKeyID retrieves the ID of an SSH key by name
 func (hs *HetznerService) getSSHKeyID(apiKey, keyName string) (int, error) {
 	resp, err := hs.makeRequest("GET", "/ssh_keys", apiKey, nil)
@@ -431,6 +503,12 @@ func (hs *HetznerService) CreateSSHKey(apiKey, name, publicKey string) (*Hetzner
 	return &keyResp.SSHKey, nil
 }
 
+// DeleteSSHKey deletes an SSH key
+func (hs *HetznerService) DeleteSSHKey(apiKey string, keyID int) error {
+	_, err := hs.makeRequest("DELETE", fmt.Sprintf("/ssh_keys/%d", keyID), apiKey, nil)
+	return err
+}
+
 // ListSSHKeys retrieves all SSH keys
 func (hs *HetznerService) ListSSHKeys(apiKey string) ([]HetznerSSHKey, error) {
 	respBody, err := hs.makeRequest("GET", "/ssh_keys", apiKey, nil)
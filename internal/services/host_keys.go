@@ -0,0 +1,228 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// ErrHostKeyMismatch is returned when a server presents a different SSH host key than the pinned one
+var ErrHostKeyMismatch = errors.New("SSH host key mismatch")
+
+// HostKeyMismatchError describes a server whose SSH host key changed since it was trusted
+type HostKeyMismatchError struct {
+	Address  string
+	Expected string // SHA256 fingerprint of the pinned key
+	Actual   string // SHA256 fingerprint of the presented key
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	return fmt.Sprintf("%s: %s presented %s but %s is pinned. If the server was rebuilt, re-trust its host key; otherwise someone may be intercepting the connection",
+		ErrHostKeyMismatch, e.Address, e.Actual, e.Expected)
+}
+
+// Is makes errors.Is(err, ErrHostKeyMismatch) match
+func (e *HostKeyMismatchError) Is(target error) bool {
+	return target == ErrHostKeyMismatch
+}
+
+// KnownHosts holds the pinned SSH host keys of managed servers, keyed by SSH
+// address. Pins come from VPSConfig whenever a configuration is read or
+// stored. A server without a pin is trusted on first use: its key is
+// remembered and written to its VPSConfig the next time the configuration is
+// loaded.
+type KnownHosts struct {
+	mu      sync.RWMutex
+	pinned  map[string]ssh.PublicKey
+	learned map[string]ssh.PublicKey
+}
+
+var (
+	knownHosts     *KnownHosts
+	knownHostsOnce sync.Once
+)
+
+// GetKnownHosts returns the process-wide known hosts
+func GetKnownHosts() *KnownHosts {
+	knownHostsOnce.Do(func() {
+		knownHosts = NewKnownHosts()
+	})
+	return knownHosts
+}
+
+// NewKnownHosts creates an empty set of known hosts
+func NewKnownHosts() *KnownHosts {
+	return &KnownHosts{
+		pinned:  make(map[string]ssh.PublicKey),
+		learned: make(map[string]ssh.PublicKey),
+	}
+}
+
+// Pin trusts key (authorized_keys format) for address
+func (k *KnownHosts) Pin(address, key string) error {
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key))
+	if err != nil {
+		return fmt.Errorf("invalid host key for %s: %w", address, err)
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	address = sshAddress(address)
+	k.pinned[address] = publicKey
+	delete(k.learned, address)
+	return nil
+}
+
+// Forget drops the pinned and learned keys of address
+func (k *KnownHosts) Forget(address string) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	address = sshAddress(address)
+	delete(k.pinned, address)
+	delete(k.learned, address)
+}
+
+// Learned returns the key trusted on first use for address, in authorized_keys format
+func (k *KnownHosts) Learned(address string) (string, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.learned[sshAddress(address)]
+	if !ok {
+		return "", false
+	}
+	return marshalHostKey(key), true
+}
+
+// Remember pins the host key of config, or records in config a key learned
+// on first use. It reports whether config changed and should be stored.
+func (k *KnownHosts) Remember(config *VPSConfig) bool {
+	if config == nil || config.PublicIPv4 == "" {
+		return false
+	}
+
+	if config.HostKey != "" {
+		if err := k.Pin(config.SSHAddress(), config.HostKey); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		return false
+	}
+
+	key, ok := k.Learned(config.SSHAddress())
+	if !ok {
+		return false
+	}
+	setHostKey(config, key)
+	if err := k.Pin(config.SSHAddress(), key); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	log.Printf("🔐 Pinned SSH host key %s for %s (%s)", config.HostKeyFingerprint, config.Name, config.SSHAddress())
+	return true
+}
+
+// Load pins the host keys of every server of an account, so connections made
+// before a server's configuration is next read are still verified
+func (k *KnownHosts) Load(kv *KVService, token, accountID string) error {
+	configs, err := kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return err
+	}
+	pinned := 0
+	for _, config := range configs {
+		if config.HostKey != "" {
+			pinned++
+		}
+	}
+	log.Printf("🔐 Loaded %d pinned SSH host keys for account %s (%d servers)", pinned, accountID, len(configs))
+	return nil
+}
+
+// KnownHostsLine returns the pinned key of address as an OpenSSH known_hosts line
+func (k *KnownHosts) KnownHostsLine(address string) (string, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	address = sshAddress(address)
+	key, ok := k.pinned[address]
+	if !ok {
+		return "", false
+	}
+	return knownhosts.Line([]string{address}, key), true
+}
+
+// HostKeyCallback verifies server keys against the pins, trusting unknown servers on first use
+func (k *KnownHosts) HostKeyCallback() ssh.HostKeyCallback {
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		address := sshAddress(hostname)
+
+		k.mu.Lock()
+		defer k.mu.Unlock()
+
+		if pinned, ok := k.pinned[address]; ok {
+			if !bytes.Equal(pinned.Marshal(), key.Marshal()) {
+				err := &HostKeyMismatchError{
+					Address:  address,
+					Expected: ssh.FingerprintSHA256(pinned),
+					Actual:   ssh.FingerprintSHA256(key),
+				}
+				log.Printf("🚨 %v", err)
+				return err
+			}
+			return nil
+		}
+
+		if _, ok := k.learned[address]; !ok {
+			log.Printf("🔐 Trusting SSH host key %s of %s on first use", ssh.FingerprintSHA256(key), address)
+		}
+		k.learned[address] = key
+		return nil
+	}
+}
+
+// errHostKeyScanned aborts a handshake once the host key has been captured
+var errHostKeyScanned = errors.New("host key scanned")
+
+// ScanHostKey connects to host and returns its SSH host key in authorized_keys
+// format without authenticating or checking pins
+func (ss *SSHService) ScanHostKey(host string) (string, error) {
+	var scanned ssh.PublicKey
+	config := &ssh.ClientConfig{
+		User: "xanthus",
+		Auth: []ssh.AuthMethod{},
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			scanned = key
+			return errHostKeyScanned
+		},
+		Timeout: ss.timeout,
+	}
+
+	address := sshAddress(host)
+	client, err := ssh.Dial("tcp", address, config)
+	if client != nil {
+		client.Close()
+	}
+	if scanned == nil {
+		return "", fmt.Errorf("failed to read the host key of %s: %w", address, err)
+	}
+	return marshalHostKey(scanned), nil
+}
+
+// setHostKey records a trusted host key in config
+func setHostKey(config *VPSConfig, key string) {
+	config.HostKey = key
+	config.HostKeyFingerprint = ""
+	if publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(key)); err == nil {
+		config.HostKeyFingerprint = ssh.FingerprintSHA256(publicKey)
+	}
+	config.HostKeyTrustedAt = time.Now().UTC().Format(time.RFC3339)
+}
+
+// marshalHostKey formats key like an authorized_keys line, without a comment
+func marshalHostKey(key ssh.PublicKey) string {
+	return string(bytes.TrimSpace(ssh.MarshalAuthorizedKey(key)))
+}
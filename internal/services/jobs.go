@@ -0,0 +1,744 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// JobStatus is the state of a job or of one of its steps
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobCancelled JobStatus = "cancelled"
+)
+
+// Job types
+const (
+	JobTypeVPSCreate     = "vps.create"
+	JobTypeVPSAdd        = "vps.add"
+	JobTypeVPSDelete     = "vps.delete"
+	JobTypeVPSPower      = "vps.power"
+	JobTypeVPSSetup      = "vps.setup"
+	JobTypeVPSRebuild    = "vps.rebuild"
+	JobTypeVPSJoin       = "vps.join"
+	JobTypeK3sUpgrade    = "k3s.upgrade"
+	JobTypeAppDeploy     = "app.deploy"
+	JobTypeAppUpgrade    = "app.upgrade"
+	JobTypeAppDelete     = "app.delete"
+	JobTypeSelfUpdate    = "xanthus.update"
+	JobTypeSelfRollback  = "xanthus.rollback"
+	JobTypeReconcile     = "reconcile"
+	JobTypeStackApply    = "stack.apply"
+	JobTypeAdoptServer   = "adopt.server"
+	JobTypeAdoptRelease  = "adopt.release"
+	JobTypeBackupPolicy  = "backup.policy"
+	JobTypeBackupRun     = "backup.run"
+	JobTypeBackupRestore = "backup.restore"
+	jobKeyPrefix         = "job:"
+	maxJobLogLines       = 500
+	maxStoredJobs        = 200
+	jobLogPersistEvery   = 2 * time.Second
+	defaultJobRetryDelay = 10 * time.Second
+	jobEventBuffer       = 256
+	maxJobOutputLine     = 4096
+)
+
+// Job event types
+const (
+	JobEventStatus = "status"
+	JobEventStep   = "step"
+	JobEventLog    = "log"
+	JobEventPod    = "pod"
+)
+
+// jobsFinished counts finished jobs for /metrics; deployments are the app.deploy jobs
+var jobsFinished = utils.Metrics().NewCounter("xanthus_jobs_total",
+	"Finished jobs by type and status, e.g. deployments by type=\"app.deploy\"", "type", "status")
+
+var (
+	// ErrJobNotFound is returned for unknown job IDs
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobFinished is returned when cancelling a job that already finished
+	ErrJobFinished = errors.New("job already finished")
+)
+
+// Job is a long-running operation whose progress is kept in the state store,
+// so it can be inspected after the fact and across restarts
+type Job struct {
+	ID          string     `json:"id"`
+	Type        string     `json:"type"`
+	Target      string     `json:"target,omitempty"`
+	Status      JobStatus  `json:"status"`
+	Error       string     `json:"error,omitempty"`
+	Steps       []JobStep  `json:"steps"`
+	Logs        []JobLog   `json:"logs"`
+	Attempt     int        `json:"attempt"`
+	MaxAttempts int        `json:"max_attempts"`
+	CreatedAt   time.Time  `json:"created_at"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobStep is a named phase of a job
+type JobStep struct {
+	Name       string     `json:"name"`
+	Status     JobStatus  `json:"status"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// JobLog is a line of job output
+type JobLog struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// Finished reports whether the job reached a final status
+func (j *Job) Finished() bool {
+	return j.Status == JobSucceeded || j.Status == JobFailed || j.Status == JobCancelled
+}
+
+// JobEvent is a change to a running job, pushed to subscribers as it happens
+type JobEvent struct {
+	Type    string     `json:"type"`
+	Time    time.Time  `json:"time"`
+	Step    *JobStep   `json:"step,omitempty"`
+	Message string     `json:"message,omitempty"`
+	Pod     *PodStatus `json:"pod,omitempty"`
+	// Job is set on status events
+	Job *Job `json:"job,omitempty"`
+}
+
+// PodStatus is the readiness of a pod started by a job
+type PodStatus struct {
+	Name     string `json:"name"`
+	Ready    string `json:"ready"`
+	Status   string `json:"status"`
+	Restarts string `json:"restarts"`
+}
+
+// JobSpec describes a job to start
+type JobSpec struct {
+	Type   string
+	Target string
+	// MaxAttempts retries failed work; only use it for idempotent operations
+	MaxAttempts int
+	RetryDelay  time.Duration
+}
+
+// JobFunc is the work of a job. It should stop when ctx is cancelled and can
+// report progress with StartJobStep and JobLogf.
+type JobFunc func(ctx context.Context) error
+
+// JobManager runs jobs in the background and records them in the state store
+type JobManager struct {
+	kv     *KVService
+	mu     sync.Mutex
+	active map[string]*runningJob
+}
+
+var (
+	jobManager     *JobManager
+	jobManagerOnce sync.Once
+)
+
+// GetJobManager returns the job manager shared by the handlers, created on
+// first use so the state store is configured by then
+func GetJobManager() *JobManager {
+	jobManagerOnce.Do(func() {
+		jobManager = NewJobManager()
+	})
+	return jobManager
+}
+
+// NewJobManager creates a job manager on the process-wide state store
+func NewJobManager() *JobManager {
+	return NewJobManagerWithStore(utils.GetStateStore())
+}
+
+// NewJobManagerWithStore creates a job manager on the given state store
+func NewJobManagerWithStore(store utils.StateStore) *JobManager {
+	return &JobManager{kv: NewKVServiceWithStore(store), active: make(map[string]*runningJob)}
+}
+
+// Start runs fn as a job in the background and returns the queued job
+func (m *JobManager) Start(token, accountID string, spec JobSpec, fn JobFunc) *Job {
+	return m.start(token, accountID, spec, fn).snapshot()
+}
+
+// Run runs fn as a job and waits for it, returning the finished job and fn's
+// error. The job keeps running if the caller goes away, so callers that used
+// to do the work inline keep their behaviour while the job stays inspectable.
+func (m *JobManager) Run(token, accountID string, spec JobSpec, fn JobFunc) (*Job, error) {
+	rj := m.start(token, accountID, spec, fn)
+	<-rj.done
+	return rj.snapshot(), rj.err
+}
+
+// Get returns a job of the account
+func (m *JobManager) Get(token, accountID, id string) (*Job, error) {
+	if rj := m.lookup(accountID, id); rj != nil {
+		return rj.snapshot(), nil
+	}
+
+	var job Job
+	if err := m.kv.GetValue(token, accountID, jobKeyPrefix+id, &job); err != nil {
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			return nil, ErrJobNotFound
+		}
+		return nil, fmt.Errorf("failed to read job %s: %w", id, err)
+	}
+	return m.settleOrphan(token, accountID, &job), nil
+}
+
+// List returns the account's most recent jobs, newest first
+func (m *JobManager) List(token, accountID string, limit int) ([]*Job, error) {
+	keys, err := m.kv.ListKeys(token, accountID, jobKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	// Job IDs start with their creation time, so they sort chronologically
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	jobs := make([]*Job, 0, len(keys))
+	for _, key := range keys {
+		job, err := m.Get(token, accountID, strings.TrimPrefix(key, jobKeyPrefix))
+		if err != nil {
+			log.Printf("Warning: Failed to read %s: %v", key, err)
+			continue
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Subscribe returns the current state of a job together with a channel of its
+// further events, which is closed when the job finishes. The channel is nil
+// for jobs that already finished. Call the returned function to unsubscribe.
+// Events are dropped rather than blocking the job when a subscriber falls
+// behind, so the snapshot from Get stays the source of truth.
+func (m *JobManager) Subscribe(token, accountID, id string) (*Job, <-chan JobEvent, func(), error) {
+	if rj := m.lookup(accountID, id); rj != nil {
+		job, events, unsubscribe := rj.subscribe()
+		return job, events, unsubscribe, nil
+	}
+
+	job, err := m.Get(token, accountID, id)
+	return job, nil, func() {}, err
+}
+
+// Cancel asks a running job to stop. The job is marked cancelled once its work returns.
+func (m *JobManager) Cancel(token, accountID, id string) (*Job, error) {
+	rj := m.lookup(accountID, id)
+	if rj == nil {
+		if _, err := m.Get(token, accountID, id); err != nil {
+			return nil, err
+		}
+		return nil, ErrJobFinished
+	}
+
+	rj.logf("Cancellation requested")
+	rj.cancel()
+	return rj.snapshot(), nil
+}
+
+func (m *JobManager) lookup(accountID, id string) *runningJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rj, ok := m.active[id]
+	if !ok || rj.accountID != accountID {
+		return nil
+	}
+	return rj
+}
+
+// settleOrphan fails stored jobs that were still running when Xanthus stopped
+func (m *JobManager) settleOrphan(token, accountID string, job *Job) *Job {
+	if job.Finished() {
+		return job
+	}
+
+	now := time.Now()
+	job.Status = JobFailed
+	job.Error = "interrupted: Xanthus restarted while the job was running"
+	job.FinishedAt = &now
+	for i := range job.Steps {
+		if job.Steps[i].Status == JobRunning {
+			job.Steps[i].Status = JobFailed
+			job.Steps[i].FinishedAt = &now
+		}
+	}
+	if err := m.kv.PutValue(token, accountID, jobKeyPrefix+job.ID, job); err != nil {
+		log.Printf("Warning: Failed to store interrupted job %s: %v", job.ID, err)
+	}
+	return job
+}
+
+func (m *JobManager) start(token, accountID string, spec JobSpec, fn JobFunc) *runningJob {
+	if spec.MaxAttempts < 1 {
+		spec.MaxAttempts = 1
+	}
+	if spec.RetryDelay <= 0 {
+		spec.RetryDelay = defaultJobRetryDelay
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rj := &runningJob{
+		manager:   m,
+		token:     token,
+		accountID: accountID,
+		cancel:    cancel,
+		done:      make(chan struct{}),
+		job: Job{
+			ID:          newJobID(),
+			Type:        spec.Type,
+			Target:      spec.Target,
+			Status:      JobQueued,
+			Steps:       []JobStep{},
+			Logs:        []JobLog{},
+			MaxAttempts: spec.MaxAttempts,
+			CreatedAt:   time.Now(),
+		},
+	}
+
+	m.mu.Lock()
+	m.active[rj.job.ID] = rj
+	m.mu.Unlock()
+
+	rj.persist()
+	log.Printf("⚙️ Job %s (%s %s) queued", rj.job.ID, spec.Type, spec.Target)
+
+	go rj.run(context.WithValue(ctx, jobContextKey{}, rj), spec, fn)
+	return rj
+}
+
+// prune deletes the oldest finished jobs beyond maxStoredJobs
+func (m *JobManager) prune(token, accountID string) {
+	keys, err := m.kv.ListKeys(token, accountID, jobKeyPrefix)
+	if err != nil || len(keys) <= maxStoredJobs {
+		return
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys[:len(keys)-maxStoredJobs] {
+		if m.lookup(accountID, strings.TrimPrefix(key, jobKeyPrefix)) != nil {
+			continue
+		}
+		if err := m.kv.DeleteValue(token, accountID, key); err != nil {
+			log.Printf("Warning: Failed to delete old job %s: %v", key, err)
+		}
+	}
+}
+
+// newJobID returns a unique ID that sorts by creation time
+func newJobID() string {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		panic(fmt.Sprintf("crypto/rand failed: %v", err))
+	}
+	return fmt.Sprintf("job-%s-%s", time.Now().UTC().Format("20060102T150405.000"), hex.EncodeToString(suffix))
+}
+
+// runningJob is a job executing in this process
+type runningJob struct {
+	manager   *JobManager
+	token     string
+	accountID string
+	cancel    context.CancelFunc
+	done      chan struct{}
+	err       error
+
+	mu          sync.Mutex
+	job         Job
+	persistedAt time.Time
+	persistMu   sync.Mutex
+	subscribers map[chan JobEvent]struct{}
+	closed      bool
+}
+
+type jobContextKey struct{}
+
+func (rj *runningJob) run(ctx context.Context, spec JobSpec, fn JobFunc) {
+	defer func() {
+		rj.manager.mu.Lock()
+		delete(rj.manager.active, rj.job.ID)
+		rj.manager.mu.Unlock()
+		rj.cancel()
+		rj.closeSubscribers()
+		close(rj.done)
+		rj.manager.prune(rj.token, rj.accountID)
+	}()
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		rj.begin(attempt)
+		err = rj.call(ctx, fn)
+		if err == nil || ctx.Err() != nil || attempt >= spec.MaxAttempts {
+			break
+		}
+
+		delay := spec.RetryDelay * time.Duration(attempt)
+		rj.logf("Attempt %d of %d failed: %v; retrying in %s", attempt, spec.MaxAttempts, err, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	rj.finish(err, ctx.Err() != nil)
+}
+
+// call runs fn, turning a panic into an error
+func (rj *runningJob) call(ctx context.Context, fn JobFunc) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+func (rj *runningJob) begin(attempt int) {
+	rj.mu.Lock()
+	now := time.Now()
+	rj.job.Status = JobRunning
+	rj.job.Attempt = attempt
+	if rj.job.StartedAt == nil {
+		rj.job.StartedAt = &now
+	}
+	rj.publishStatus(now)
+	rj.mu.Unlock()
+
+	rj.persist()
+}
+
+func (rj *runningJob) finish(err error, cancelled bool) {
+	rj.mu.Lock()
+	rj.err = err
+	// Work that ends by restarting Xanthus settles the job itself
+	if rj.job.FinishedAt != nil && (err == nil || rj.job.Status == JobFailed) {
+		rj.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	status := JobSucceeded
+	switch {
+	case cancelled:
+		status = JobCancelled
+	case err != nil:
+		status = JobFailed
+	}
+	rj.job.Status = status
+	rj.job.Error = ""
+	if err != nil {
+		rj.job.Error = err.Error()
+	}
+	rj.job.FinishedAt = &now
+	rj.closeStep(status, now)
+	rj.publishStatus(now)
+	id, jobType := rj.job.ID, rj.job.Type
+	rj.mu.Unlock()
+
+	rj.persist()
+	jobsFinished.Inc(jobType, string(status))
+	if err != nil {
+		log.Printf("⚙️ Job %s (%s) %s: %v", id, jobType, status, err)
+	} else {
+		log.Printf("⚙️ Job %s (%s) %s", id, jobType, status)
+	}
+}
+
+// closeStep finishes the running step; the caller holds rj.mu
+func (rj *runningJob) closeStep(status JobStatus, now time.Time) {
+	if n := len(rj.job.Steps); n > 0 && rj.job.Steps[n-1].Status == JobRunning {
+		rj.job.Steps[n-1].Status = status
+		rj.job.Steps[n-1].FinishedAt = &now
+		step := rj.job.Steps[n-1]
+		rj.publish(JobEvent{Type: JobEventStep, Time: now, Step: &step})
+	}
+}
+
+func (rj *runningJob) step(name string) {
+	rj.mu.Lock()
+	now := time.Now()
+	rj.closeStep(JobSucceeded, now)
+	step := JobStep{Name: name, Status: JobRunning, StartedAt: now}
+	rj.job.Steps = append(rj.job.Steps, step)
+	rj.publish(JobEvent{Type: JobEventStep, Time: now, Step: &step})
+	rj.appendLog(now, name)
+	rj.mu.Unlock()
+
+	rj.persist()
+}
+
+func (rj *runningJob) logf(format string, args ...interface{}) {
+	rj.mu.Lock()
+	now := time.Now()
+	rj.appendLog(now, fmt.Sprintf(format, args...))
+	rj.mu.Unlock()
+
+	rj.persistIfDue(now)
+}
+
+func (rj *runningJob) pod(pod PodStatus) {
+	rj.mu.Lock()
+	now := time.Now()
+	rj.publish(JobEvent{Type: JobEventPod, Time: now, Pod: &pod})
+	rj.appendLog(now, fmt.Sprintf("Pod %s: %s, %s ready", pod.Name, pod.Status, pod.Ready))
+	rj.mu.Unlock()
+
+	rj.persistIfDue(now)
+}
+
+// persistIfDue stores the job unless it was stored recently, which keeps
+// chatty output from hammering the state store
+func (rj *runningJob) persistIfDue(now time.Time) {
+	rj.mu.Lock()
+	due := now.Sub(rj.persistedAt) >= jobLogPersistEvery
+	rj.mu.Unlock()
+
+	if due {
+		rj.persist()
+	}
+}
+
+// appendLog adds a log line, keeping the most recent maxJobLogLines; the caller holds rj.mu
+func (rj *runningJob) appendLog(now time.Time, message string) {
+	rj.job.Logs = append(rj.job.Logs, JobLog{Time: now, Message: message})
+	rj.publish(JobEvent{Type: JobEventLog, Time: now, Message: message})
+	if excess := len(rj.job.Logs) - maxJobLogLines; excess > 0 {
+		rj.job.Logs = append([]JobLog(nil), rj.job.Logs[excess:]...)
+	}
+}
+
+func (rj *runningJob) complete(message string) {
+	rj.mu.Lock()
+	now := time.Now()
+	if message != "" {
+		rj.appendLog(now, message)
+	}
+	rj.job.Status = JobSucceeded
+	rj.job.FinishedAt = &now
+	rj.closeStep(JobSucceeded, now)
+	rj.publishStatus(now)
+	rj.mu.Unlock()
+
+	rj.persist()
+}
+
+// snapshot returns a copy of the job
+func (rj *runningJob) snapshot() *Job {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+	return rj.copyJob()
+}
+
+// copyJob returns a copy of the job; the caller holds rj.mu
+func (rj *runningJob) copyJob() *Job {
+	job := rj.job
+	job.Steps = append([]JobStep{}, rj.job.Steps...)
+	job.Logs = append([]JobLog{}, rj.job.Logs...)
+	return &job
+}
+
+func (rj *runningJob) subscribe() (*Job, <-chan JobEvent, func()) {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+
+	if rj.closed {
+		return rj.copyJob(), nil, func() {}
+	}
+
+	events := make(chan JobEvent, jobEventBuffer)
+	if rj.subscribers == nil {
+		rj.subscribers = make(map[chan JobEvent]struct{})
+	}
+	rj.subscribers[events] = struct{}{}
+
+	unsubscribe := func() {
+		rj.mu.Lock()
+		defer rj.mu.Unlock()
+		if _, ok := rj.subscribers[events]; ok {
+			delete(rj.subscribers, events)
+			close(events)
+		}
+	}
+	return rj.copyJob(), events, unsubscribe
+}
+
+// publish sends an event to the subscribers without waiting for them; the caller holds rj.mu
+func (rj *runningJob) publish(event JobEvent) {
+	for events := range rj.subscribers {
+		select {
+		case events <- event:
+		default:
+		}
+	}
+}
+
+// publishStatus sends the whole job to the subscribers; the caller holds rj.mu
+func (rj *runningJob) publishStatus(now time.Time) {
+	if len(rj.subscribers) > 0 {
+		rj.publish(JobEvent{Type: JobEventStatus, Time: now, Job: rj.copyJob()})
+	}
+}
+
+func (rj *runningJob) closeSubscribers() {
+	rj.mu.Lock()
+	defer rj.mu.Unlock()
+
+	rj.closed = true
+	for events := range rj.subscribers {
+		close(events)
+	}
+	rj.subscribers = nil
+}
+
+// persist stores the job; failures only cost inspectability, so they are logged
+func (rj *runningJob) persist() {
+	rj.persistMu.Lock()
+	defer rj.persistMu.Unlock()
+
+	job := rj.snapshot()
+	rj.mu.Lock()
+	rj.persistedAt = time.Now()
+	rj.mu.Unlock()
+
+	if err := rj.manager.kv.PutValue(rj.token, rj.accountID, jobKeyPrefix+job.ID, job); err != nil {
+		log.Printf("Warning: Failed to store job %s: %v", job.ID, err)
+	}
+}
+
+func jobFromContext(ctx context.Context) *runningJob {
+	if ctx == nil {
+		return nil
+	}
+	rj, _ := ctx.Value(jobContextKey{}).(*runningJob)
+	return rj
+}
+
+// JobID returns the ID of the job ctx belongs to, or "" outside jobs
+func JobID(ctx context.Context) string {
+	if rj := jobFromContext(ctx); rj != nil {
+		return rj.job.ID
+	}
+	return ""
+}
+
+// StartJobStep records the start of a named step of the job ctx belongs to and
+// finishes the previous one. It returns ctx's error once the job is cancelled,
+// so steps double as cancellation points.
+func StartJobStep(ctx context.Context, name string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if rj := jobFromContext(ctx); rj != nil {
+		rj.step(name)
+	}
+	return nil
+}
+
+// JobLogf adds a line to the log of the job ctx belongs to and to the process log
+func JobLogf(ctx context.Context, format string, args ...interface{}) {
+	if rj := jobFromContext(ctx); rj != nil {
+		rj.logf(format, args...)
+	}
+	log.Printf(format, args...)
+}
+
+// JobPod records a pod status change of the job ctx belongs to
+func JobPod(ctx context.Context, pod PodStatus) {
+	if rj := jobFromContext(ctx); rj != nil {
+		rj.pod(pod)
+	}
+}
+
+// JobOutput returns a writer that adds every line written to it to the log of
+// the job ctx belongs to, for streaming command output. Close flushes a
+// trailing line without a newline. Outside jobs the output is discarded.
+func JobOutput(ctx context.Context, prefix string) io.WriteCloser {
+	return &jobOutput{rj: jobFromContext(ctx), prefix: prefix}
+}
+
+type jobOutput struct {
+	rj     *runningJob
+	prefix string
+	mu     sync.Mutex
+	line   []byte
+}
+
+func (w *jobOutput) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, b := range p {
+		if b == '\n' || len(w.line) >= maxJobOutputLine {
+			w.flush()
+			if b == '\n' {
+				continue
+			}
+		}
+		w.line = append(w.line, b)
+	}
+	return len(p), nil
+}
+
+func (w *jobOutput) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.flush()
+	return nil
+}
+
+// flush logs the buffered line; the caller holds w.mu
+func (w *jobOutput) flush() {
+	line := strings.TrimRight(string(w.line), "\r ")
+	w.line = w.line[:0]
+	if line == "" || w.rj == nil {
+		return
+	}
+	w.rj.logf("%s%s", w.prefix, line)
+}
+
+// CompleteJob marks the job ctx belongs to as succeeded and stores it right
+// away, for work that ends by replacing the process
+func CompleteJob(ctx context.Context, message string) {
+	if rj := jobFromContext(ctx); rj != nil {
+		rj.complete(message)
+	}
+}
+
+// FailJob marks the job ctx belongs to as failed after CompleteJob, for work
+// whose process was not replaced after all
+func FailJob(ctx context.Context, err error) {
+	if rj := jobFromContext(ctx); rj != nil {
+		rj.finish(err, false)
+	}
+}
@@ -0,0 +1,347 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// K3sRepository is the GitHub repository K3s releases are listed from
+const K3sRepository = "k3s-io/k3s"
+
+var (
+	// ErrInvalidUpgradeRequest is wrapped by upgrade errors caused by the request
+	// or by a cluster that isn't fit to be upgraded
+	ErrInvalidUpgradeRequest = errors.New("invalid upgrade request")
+)
+
+var k3sVersionPattern = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)\+k3s(\d+)$`)
+
+// K3sVersions describes the K3s version of a cluster and the releases it can be upgraded to
+type K3sVersions struct {
+	ServerID  int           `json:"server_id"` // The server node
+	Current   string        `json:"current"`   // Version of the server node
+	Nodes     []ClusterNode `json:"nodes"`
+	Available []string      `json:"available"` // Upgrade targets, newest first
+}
+
+// K3sUpgradeResult describes an upgraded cluster
+type K3sUpgradeResult struct {
+	From  string        `json:"from"`
+	To    string        `json:"to"`
+	Nodes []ClusterNode `json:"nodes"`
+}
+
+// K3sUpgradeService upgrades the K3s of clusters, one node at a time, by
+// re-running the K3s install script with the target version over SSH
+type K3sUpgradeService struct {
+	kv      *KVService
+	ssh     *SSHService
+	cluster *ClusterService
+	source  VersionSource
+
+	nodeTimeout  time.Duration // How long to wait for an upgraded node to be Ready
+	pollInterval time.Duration
+}
+
+// NewK3sUpgradeService creates an upgrade service on the process-wide state
+// store that lists releases from GitHub
+func NewK3sUpgradeService() *K3sUpgradeService {
+	return NewK3sUpgradeServiceWithStore(utils.GetStateStore(), nil, nil)
+}
+
+// NewK3sUpgradeServiceWithStore creates an upgrade service on the given state
+// store and keyring; a nil keyring stands for the process-wide one and a nil
+// source for the GitHub releases of K3sRepository
+func NewK3sUpgradeServiceWithStore(store utils.StateStore, keyring *utils.Keyring, source VersionSource) *K3sUpgradeService {
+	if source == nil {
+		source = NewGitHubVersionSource(K3sRepository)
+	}
+	cluster := NewClusterServiceWithStore(store, keyring)
+	return &K3sUpgradeService{
+		kv:           cluster.kv,
+		ssh:          cluster.ssh,
+		cluster:      cluster,
+		source:       source,
+		nodeTimeout:  10 * time.Minute,
+		pollInterval: 10 * time.Second,
+	}
+}
+
+// Versions returns the K3s version of the cluster a VPS belongs to and the
+// releases it can be upgraded to
+func (s *K3sUpgradeService) Versions(token, accountID string, serverID int) (*K3sVersions, error) {
+	server, err := s.serverNode(token, accountID, serverID)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := s.cluster.ListNodes(token, accountID, server.ServerID)
+	if err != nil {
+		return nil, err
+	}
+	current := serverVersion(nodes)
+	if current == "" {
+		return nil, fmt.Errorf("the cluster of %s has no server node", server.Name)
+	}
+
+	releases, err := s.source.GetVersionHistory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list K3s releases: %w", err)
+	}
+	available := []string{}
+	for _, release := range releases {
+		version := "v" + strings.TrimPrefix(release, "v")
+		if CheckK3sUpgrade(current, version) == nil {
+			available = append(available, version)
+		}
+	}
+	sort.Slice(available, func(i, j int) bool { return compareK3sVersions(available[i], available[j]) > 0 })
+
+	return &K3sVersions{ServerID: server.ServerID, Current: current, Nodes: nodes, Available: available}, nil
+}
+
+// Upgrade upgrades every node of the cluster a VPS belongs to, the server node
+// first. Nodes are drained before their upgrade when the cluster has other
+// nodes to take their pods, and must be Ready at the new version before the
+// next one is upgraded.
+func (s *K3sUpgradeService) Upgrade(ctx context.Context, token, accountID string, serverID int, version string) (*K3sUpgradeResult, error) {
+	if !k3sVersionPattern.MatchString(version) {
+		return nil, fmt.Errorf("%w: %q is not a K3s version like v1.31.2+k3s1", ErrInvalidUpgradeRequest, version)
+	}
+	version = "v" + strings.TrimPrefix(version, "v")
+
+	if err := StartJobStep(ctx, "Checking the cluster"); err != nil {
+		return nil, err
+	}
+	versions, err := s.Versions(token, accountID, serverID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckK3sUpgrade(versions.Current, version); err != nil {
+		return nil, err
+	}
+	released := false
+	for _, available := range versions.Available {
+		released = released || available == version
+	}
+	if !released {
+		return nil, fmt.Errorf("%w: %s is not a recent stable K3s release", ErrInvalidUpgradeRequest, version)
+	}
+	for _, node := range versions.Nodes {
+		if !node.Ready {
+			return nil, fmt.Errorf("%w: node %s is not ready, fix it before upgrading", ErrInvalidUpgradeRequest, node.Name)
+		}
+		if node.ServerID == 0 {
+			return nil, fmt.Errorf("%w: node %s is not managed by Xanthus and can't be upgraded", ErrInvalidUpgradeRequest, node.Name)
+		}
+	}
+
+	server, err := s.serverNode(token, accountID, serverID)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := s.cluster.connect(token, accountID, server)
+	if err != nil {
+		return nil, err
+	}
+	result, err := s.ssh.ExecuteCommand(conn, sudoPrefix(server.SSHUser)+"cat /var/lib/rancher/k3s/server/node-token")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the node token of %s: %v, output: %s", server.Name, err, commandOutput(result))
+	}
+	nodeToken := strings.TrimSpace(result.Output)
+	JobLogf(ctx, "Upgrading %d nodes from K3s %s to %s", len(versions.Nodes), versions.Current, version)
+
+	// Server nodes come first in the node list; agents may not be newer than their server
+	for _, node := range versions.Nodes {
+		if node.KubeletVersion == version {
+			JobLogf(ctx, "Node %s already runs %s", node.Name, version)
+			continue
+		}
+		if err := StartJobStep(ctx, fmt.Sprintf("Upgrading %s", node.Name)); err != nil {
+			return nil, err
+		}
+		config, err := s.kv.GetVPSConfig(token, accountID, node.ServerID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get VPS config of %s: %w", node.Name, err)
+		}
+
+		drain := len(versions.Nodes) > 1
+		if drain {
+			cmd := fmt.Sprintf("kubectl drain %s --ignore-daemonsets --delete-emptydir-data --force --timeout=300s", node.Name)
+			if result, err := s.ssh.ExecuteCommand(conn, cmd); err != nil {
+				s.uncordon(ctx, conn, node.Name)
+				return nil, fmt.Errorf("failed to drain %s: %v, output: %s", node.Name, err, lastLine(commandOutput(result)))
+			}
+		}
+
+		if err := s.install(ctx, token, accountID, config, node, server, nodeToken, version); err != nil {
+			if drain {
+				s.uncordon(ctx, conn, node.Name)
+			}
+			return nil, err
+		}
+		if err := s.waitForVersion(ctx, token, accountID, server, node.Name, version); err != nil {
+			return nil, err
+		}
+		if drain {
+			s.uncordon(ctx, conn, node.Name)
+		}
+	}
+
+	nodes, err := s.cluster.ListNodes(token, accountID, server.ServerID)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("✅ Upgraded the cluster of %s from K3s %s to %s", server.Name, versions.Current, version)
+	return &K3sUpgradeResult{From: versions.Current, To: version, Nodes: nodes}, nil
+}
+
+// install re-runs the K3s install script on a node with the target version,
+// repeating the arguments the server runs with or the agent joined with
+func (s *K3sUpgradeService) install(ctx context.Context, token, accountID string, config *VPSConfig, node ClusterNode, server *VPSConfig, nodeToken, version string) error {
+	conn, err := s.cluster.connect(token, accountID, config)
+	if err != nil {
+		return err
+	}
+
+	env := "INSTALL_K3S_VERSION=" + version
+	args := ""
+	if node.Role == ClusterRoleAgent {
+		address := server.PublicIPv4
+		if config.PrivateNetwork != "" && server.PrivateIPv4 != "" {
+			address = server.PrivateIPv4
+		}
+		env += fmt.Sprintf(" K3S_URL=https://%s:6443 K3S_TOKEN=%s", address, shellQuote(nodeToken))
+		args = fmt.Sprintf(" agent --node-name %s --node-ip %s", node.Name, node.InternalIP)
+	} else {
+		// The install script rewrites the unit with only the arguments it is
+		// given, so flags like --write-kubeconfig-mode 644, which lets a
+		// non-root SSH user run kubectl, are copied from the current unit
+		result, err := s.ssh.ExecuteCommand(conn, "systemctl show k3s --property=ExecStart --value")
+		if err != nil {
+			return fmt.Errorf("failed to read the K3s service of %s: %v, output: %s", node.Name, err, lastLine(commandOutput(result)))
+		}
+		for _, arg := range ParseK3sExecStart(result.Output) {
+			args += " " + shellQuote(arg)
+		}
+	}
+	cmd := fmt.Sprintf("curl -sfL https://get.k3s.io | %senv %s sh -s -%s", sudoPrefix(config.SSHUser), env, args)
+
+	JobLogf(ctx, "Installing K3s %s on %s", version, node.Name)
+	if result, err := s.ssh.ExecuteCommand(conn, cmd); err != nil {
+		return fmt.Errorf("failed to install K3s %s on %s: %v, output: %s", version, node.Name, err, lastLine(commandOutput(result)))
+	}
+	return nil
+}
+
+// ParseK3sExecStart returns the arguments of the k3s binary from the ExecStart
+// property of its systemd unit, as systemctl show prints it:
+// "{ path=/usr/local/bin/k3s ; argv[]=/usr/local/bin/k3s server --flag value ; ... }".
+// Without arguments the server is started as "server".
+func ParseK3sExecStart(execStart string) []string {
+	args := []string{"server"}
+	_, argv, found := strings.Cut(execStart, "argv[]=")
+	if !found {
+		return args
+	}
+	argv, _, _ = strings.Cut(argv, " ;")
+	if fields := strings.Fields(argv); len(fields) > 1 {
+		args = fields[1:]
+	}
+	return args
+}
+
+// waitForVersion waits until a node is Ready and reports the target version.
+// The server node restarts its API during its own upgrade, so every poll reconnects.
+func (s *K3sUpgradeService) waitForVersion(ctx context.Context, token, accountID string, server *VPSConfig, name, version string) error {
+	deadline := time.Now().Add(s.nodeTimeout)
+	cmd := fmt.Sprintf(`kubectl get node %s -o jsonpath='{.status.nodeInfo.kubeletVersion}/{.status.conditions[?(@.type=="Ready")].status}'`, name)
+	for {
+		if conn, err := s.cluster.connect(token, accountID, server); err == nil {
+			if result, err := s.ssh.ExecuteCommand(conn, cmd); err == nil && strings.TrimSpace(result.Output) == version+"/True" {
+				JobLogf(ctx, "Node %s is ready at %s", name, version)
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("node %s was not ready at %s within %s", name, version, s.nodeTimeout)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
+
+func (s *K3sUpgradeService) uncordon(ctx context.Context, conn *SSHConnection, name string) {
+	if result, err := s.ssh.ExecuteCommand(conn, "kubectl uncordon "+name); err != nil {
+		JobLogf(ctx, "Warning: Failed to uncordon %s: %v, output: %s", name, err, lastLine(commandOutput(result)))
+	}
+}
+
+// serverNode returns the server node of the cluster a VPS belongs to
+func (s *K3sUpgradeService) serverNode(token, accountID string, serverID int) (*VPSConfig, error) {
+	config, err := s.cluster.serverNode(token, accountID, serverID)
+	if errors.Is(err, utils.ErrKeyNotFound) {
+		return nil, fmt.Errorf("%w: server %d not found", ErrInvalidUpgradeRequest, serverID)
+	}
+	return config, err
+}
+
+// CheckK3sUpgrade reports whether a cluster at current can be upgraded to
+// target: only to newer versions, and one Kubernetes minor version at a time
+func CheckK3sUpgrade(current, target string) error {
+	c := k3sVersionPattern.FindStringSubmatch(current)
+	t := k3sVersionPattern.FindStringSubmatch(target)
+	if c == nil || t == nil {
+		return fmt.Errorf("%w: can't compare K3s versions %q and %q", ErrInvalidUpgradeRequest, current, target)
+	}
+	if compareK3sVersions(target, current) <= 0 {
+		return fmt.Errorf("%w: %s is not newer than %s", ErrInvalidUpgradeRequest, target, current)
+	}
+	currentMajor, _ := strconv.Atoi(c[1])
+	currentMinor, _ := strconv.Atoi(c[2])
+	targetMajor, _ := strconv.Atoi(t[1])
+	targetMinor, _ := strconv.Atoi(t[2])
+	if targetMajor != currentMajor || targetMinor > currentMinor+1 {
+		return fmt.Errorf("%w: upgrade %s one minor version at a time, to %d.%d first", ErrInvalidUpgradeRequest, current, currentMajor, currentMinor+1)
+	}
+	return nil
+}
+
+// compareK3sVersions compares two versions like v1.31.2+k3s1, returning -1, 0 or 1
+func compareK3sVersions(a, b string) int {
+	pa := k3sVersionPattern.FindStringSubmatch(a)
+	pb := k3sVersionPattern.FindStringSubmatch(b)
+	for i := 1; i <= 4 && pa != nil && pb != nil; i++ {
+		na, _ := strconv.Atoi(pa[i])
+		nb, _ := strconv.Atoi(pb[i])
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// serverVersion returns the version of the first server node
+func serverVersion(nodes []ClusterNode) string {
+	for _, node := range nodes {
+		if node.Role == ClusterRoleServer {
+			return node.KubeletVersion
+		}
+	}
+	return ""
+}
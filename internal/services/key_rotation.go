@@ -0,0 +1,162 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// Keys of secrets stored as a single encrypted JSON string
+var encryptedSecretKeys = []string{
+	"config:hetzner:api_key",
+	"config:digitalocean:api_key",
+	"oci_token",
+}
+
+// KeyRotationResult describes a completed key rotation
+type KeyRotationResult struct {
+	KeyID       string   `json:"key_id"`
+	Reencrypted []string `json:"reencrypted"`
+}
+
+// KeyRotationService re-encrypts every stored secret of an account under a new data-encryption key
+type KeyRotationService struct {
+	kv      *KVService
+	keyring *utils.Keyring
+}
+
+// NewKeyRotationService creates a key rotation service for the process-wide state store and keyring
+func NewKeyRotationService() *KeyRotationService {
+	return NewKeyRotationServiceWithStore(utils.GetStateStore(), utils.GetKeyring())
+}
+
+// NewKeyRotationServiceWithStore creates a key rotation service for the given store and keyring
+func NewKeyRotationServiceWithStore(store utils.StateStore, keyring *utils.Keyring) *KeyRotationService {
+	return &KeyRotationService{kv: NewKVServiceWithStore(store), keyring: keyring}
+}
+
+// Rotate generates a new data-encryption key, re-encrypts every secret in
+// place and re-wraps the keyring for newToken. Pass the current token as
+// newToken to rotate only the data key. storeToken, when not nil, moves the
+// instance to a Cloudflare token: it is called with newToken once every secret
+// has been re-encrypted, and with oldToken again if re-wrapping the keyring
+// then fails. The keyring stays wrapped for the old token until the re-wrap
+// succeeds, so a failed rotation can simply be run again with the old token.
+func (s *KeyRotationService) Rotate(oldToken, newToken, accountID string, storeToken func(token string) error) (*KeyRotationResult, error) {
+	if newToken == "" {
+		newToken = oldToken
+	}
+
+	rotation, err := s.keyring.BeginRotation(oldToken, newToken, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unlock keyring: %w", err)
+	}
+	defer rotation.Abort()
+
+	result := &KeyRotationResult{KeyID: rotation.KeyID(), Reencrypted: []string{}}
+
+	for _, key := range encryptedSecretKeys {
+		var value string
+		if err := s.kv.GetValue(newToken, accountID, key, &value); err != nil {
+			if errors.Is(err, utils.ErrKeyNotFound) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+
+		var reencrypted string
+		if key == "oci_token" && !utils.IsEnvelope(value) {
+			// OCI tokens used to be stored unencrypted
+			reencrypted, err = rotation.Encrypt(value)
+		} else {
+			reencrypted, err = rotation.Reencrypt(value)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-encrypt %s: %w", key, err)
+		}
+		if err := s.kv.PutValue(newToken, accountID, key, reencrypted); err != nil {
+			return nil, fmt.Errorf("failed to store %s: %w", key, err)
+		}
+		result.Reencrypted = append(result.Reencrypted, key)
+	}
+
+	var sshKey storedSSHKeyPair
+	if err := s.kv.GetValue(newToken, accountID, sshKeyPairKey, &sshKey); err == nil {
+		sshKey.EncryptedPrivateKey, err = rotation.Reencrypt(sshKey.EncryptedPrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-encrypt %s: %w", sshKeyPairKey, err)
+		}
+		if err := s.kv.PutValue(newToken, accountID, sshKeyPairKey, sshKey); err != nil {
+			return nil, fmt.Errorf("failed to store %s: %w", sshKeyPairKey, err)
+		}
+		result.Reencrypted = append(result.Reencrypted, sshKeyPairKey)
+	} else if !errors.Is(err, utils.ErrKeyNotFound) {
+		return nil, fmt.Errorf("failed to read %s: %w", sshKeyPairKey, err)
+	}
+
+	targetKeys, err := s.kv.ListKeys(newToken, accountID, backupTargetKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backup targets: %w", err)
+	}
+	for _, key := range targetKeys {
+		var target storedBackupTarget
+		if err := s.kv.GetValue(newToken, accountID, key, &target); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		if target.EncryptedSecretKey, err = rotation.Reencrypt(target.EncryptedSecretKey); err != nil {
+			return nil, fmt.Errorf("failed to re-encrypt %s: %w", key, err)
+		}
+		if target.EncryptedPassword, err = rotation.Reencrypt(target.EncryptedPassword); err != nil {
+			return nil, fmt.Errorf("failed to re-encrypt %s: %w", key, err)
+		}
+		if err := s.kv.PutValue(newToken, accountID, key, target); err != nil {
+			return nil, fmt.Errorf("failed to store %s: %w", key, err)
+		}
+		result.Reencrypted = append(result.Reencrypted, key)
+	}
+
+	keys, err := s.kv.ListKeys(newToken, accountID, "app:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list application secrets: %w", err)
+	}
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ":password") {
+			continue
+		}
+
+		var passwordData map[string]string
+		if err := s.kv.GetValue(newToken, accountID, key, &passwordData); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		reencrypted, err := rotation.Reencrypt(passwordData["password"])
+		if err != nil {
+			return nil, fmt.Errorf("failed to re-encrypt %s: %w", key, err)
+		}
+		passwordData["password"] = reencrypted
+		if err := s.kv.PutValue(newToken, accountID, key, passwordData); err != nil {
+			return nil, fmt.Errorf("failed to store %s: %w", key, err)
+		}
+		result.Reencrypted = append(result.Reencrypted, key)
+	}
+
+	if storeToken != nil {
+		if err := storeToken(newToken); err != nil {
+			return nil, fmt.Errorf("failed to store the new Cloudflare token: %w", err)
+		}
+	}
+	if err := rotation.Finish(); err != nil {
+		if storeToken != nil {
+			// The keyring is still wrapped for the old token
+			if restoreErr := storeToken(oldToken); restoreErr != nil {
+				return nil, fmt.Errorf("failed to retire old keys: %w (restoring the old Cloudflare token also failed: %v)", err, restoreErr)
+			}
+		}
+		return nil, fmt.Errorf("failed to retire old keys: %w", err)
+	}
+
+	log.Printf("🔑 Rotated encryption key for account %s to %s (%d secrets re-encrypted)", accountID, result.KeyID, len(result.Reencrypted))
+	return result, nil
+}
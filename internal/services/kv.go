@@ -1,31 +1,43 @@
 package services
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
+	"log"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/chrishham/xanthus/internal/utils"
 )
 
-// KVService handles Cloudflare KV storage operations
+// KVService handles persisted state operations on top of the configured state store
 type KVService struct {
 	client *http.Client
-	// Cache for namespace ID to avoid repeated API calls
-	namespaceIDCache map[string]string
-	cacheService     *CacheService
+	store  utils.StateStore
 }
 
-// NewKVService creates a new KV service instance
+// NewKVService creates a new KV service instance backed by the process-wide state store
 func NewKVService() *KVService {
+	return NewKVServiceWithStore(utils.GetStateStore())
+}
+
+// NewKVServiceWithStore creates a KV service instance backed by the given state store
+func NewKVServiceWithStore(store utils.StateStore) *KVService {
 	return &KVService{
-		client:           &http.Client{Timeout: 10 * time.Second}, // Reduced timeout
-		namespaceIDCache: make(map[string]string),
-		cacheService:     NewCacheService(),
+		client: &http.Client{Timeout: 10 * time.Second}, // Reduced timeout
+		store:  store,
 	}
 }
 
+// Store returns the state store backing this service
+func (kvs *KVService) Store() utils.StateStore {
+	return kvs.store
+}
+
 // KVNamespace represents a Cloudflare KV namespace
 type KVNamespace struct {
 	ID    string `json:"id"`
@@ -74,149 +86,39 @@ func (kvs *KVService) GetXanthusNamespaceID(token, accountID string) (string, er
 	return "", fmt.Errorf("Xanthus namespace not found")
 }
 
-// PutValue stores a value in Cloudflare KV
+// PutValue stores a value in the state store
 func (kvs *KVService) PutValue(token, accountID, key string, value interface{}) error {
-	// Try to get cached namespace ID first - use accountID for isolation
-	cacheKey := "namespace_id:" + accountID
-	namespaceID := ""
-
-	if cached, exists := kvs.cacheService.Get(cacheKey); exists {
-		namespaceID = cached.(string)
-	} else {
-		// Fallback to API call
-		var err error
-		namespaceID, err = kvs.GetXanthusNamespaceID(token, accountID)
-		if err != nil {
-			return fmt.Errorf("failed to get namespace ID: %w", err)
-		}
-		// Cache for 10 minutes
-		kvs.cacheService.Set(cacheKey, namespaceID, 10*time.Minute)
-	}
-
 	// Marshal value to JSON
 	valueBytes, err := json.Marshal(value)
 	if err != nil {
 		return fmt.Errorf("failed to marshal value: %w", err)
 	}
 
-	// Create request
-	url := fmt.Sprintf("%s/accounts/%s/storage/kv/namespaces/%s/values/%s",
-		CloudflareBaseURL, accountID, namespaceID, key)
-
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(valueBytes))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := kvs.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var kvResp CFResponse
-	if err := json.NewDecoder(resp.Body).Decode(&kvResp); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if !kvResp.Success {
-		return fmt.Errorf("KV put failed: %v", kvResp.Errors)
-	}
-
-	return nil
+	return kvs.store.Put(token, accountID, key, valueBytes)
 }
 
-// GetValue retrieves a value from Cloudflare KV
+// GetValue retrieves a value from the state store
 func (kvs *KVService) GetValue(token, accountID, key string, result interface{}) error {
-	// Try to get cached namespace ID first - use accountID for isolation
-	cacheKey := "namespace_id:" + accountID
-	namespaceID := ""
-
-	if cached, exists := kvs.cacheService.Get(cacheKey); exists {
-		namespaceID = cached.(string)
-	} else {
-		// Fallback to API call
-		var err error
-		namespaceID, err = kvs.GetXanthusNamespaceID(token, accountID)
-		if err != nil {
-			return fmt.Errorf("failed to get namespace ID: %w", err)
-		}
-		// Cache for 10 minutes
-		kvs.cacheService.Set(cacheKey, namespaceID, 10*time.Minute)
-	}
-
-	// Create request
-	url := fmt.Sprintf("%s/accounts/%s/storage/kv/namespaces/%s/values/%s",
-		CloudflareBaseURL, accountID, namespaceID, key)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := kvs.client.Do(req)
+	data, err := kvs.store.Get(token, accountID, key)
 	if err != nil {
-		return fmt.Errorf("failed to make request: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == 404 {
-		return fmt.Errorf("key not found in KV")
-	}
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("KV API returned status %d", resp.StatusCode)
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+	if err := json.Unmarshal(data, result); err != nil {
 		return fmt.Errorf("failed to decode response: %w", err)
 	}
 
 	return nil
 }
 
-// DeleteValue deletes a value from Cloudflare KV
+// DeleteValue deletes a value from the state store
 func (kvs *KVService) DeleteValue(token, accountID, key string) error {
-	// Get the Xanthus namespace ID (with caching)
-	cacheKey := "legacy_ns:" + accountID
-	namespaceID, exists := kvs.namespaceIDCache[cacheKey]
-
-	if !exists {
-		var err error
-		namespaceID, err = kvs.GetXanthusNamespaceID(token, accountID)
-		if err != nil {
-			return fmt.Errorf("failed to get namespace ID: %w", err)
-		}
-		kvs.namespaceIDCache[cacheKey] = namespaceID
-	}
-
-	// Create request
-	url := fmt.Sprintf("%s/accounts/%s/storage/kv/namespaces/%s/values/%s",
-		CloudflareBaseURL, accountID, namespaceID, key)
-
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := kvs.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 && resp.StatusCode != 404 {
-		return fmt.Errorf("KV API returned status %d", resp.StatusCode)
-	}
+	return kvs.store.Delete(token, accountID, key)
+}
 
-	return nil
+// ListKeys returns all keys in the state store that start with prefix
+func (kvs *KVService) ListKeys(token, accountID, prefix string) ([]string, error) {
+	return kvs.store.ListKeys(token, accountID, prefix)
 }
 
 // StoreDomainSSLConfig stores SSL configuration for a domain in KV
@@ -237,50 +139,10 @@ func (kvs *KVService) GetDomainSSLConfig(token, accountID, domain string) (*Doma
 
 // ListDomainSSLConfigs retrieves all domain SSL configurations
 func (kvs *KVService) ListDomainSSLConfigs(token, accountID string) (map[string]*DomainSSLConfig, error) {
-	// Get the Xanthus namespace ID (with caching)
-	cacheKey := "legacy_ns:" + accountID // Use first 10 chars of token as cache key
-	namespaceID, exists := kvs.namespaceIDCache[cacheKey]
-
-	if !exists {
-		var err error
-		namespaceID, err = kvs.GetXanthusNamespaceID(token, accountID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get namespace ID: %w", err)
-		}
-		kvs.namespaceIDCache[cacheKey] = namespaceID
-	}
-
 	// List all keys with domain:*:ssl_config prefix
-	url := fmt.Sprintf("%s/accounts/%s/storage/kv/namespaces/%s/keys?prefix=domain:",
-		CloudflareBaseURL, accountID, namespaceID)
-
-	req, err := http.NewRequest("GET", url, nil)
+	keyNames, err := kvs.ListKeys(token, accountID, "domain:")
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := kvs.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var keysResp struct {
-		Success bool `json:"success"`
-		Result  []struct {
-			Name string `json:"name"`
-		} `json:"result"`
-		Errors []CFError `json:"errors"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&keysResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if !keysResp.Success {
-		return nil, fmt.Errorf("KV API failed: %v", keysResp.Errors)
+		return nil, err
 	}
 
 	// Filter SSL config keys and extract domains
@@ -290,12 +152,12 @@ func (kvs *KVService) ListDomainSSLConfigs(token, accountID string) (map[string]
 	}
 
 	var sslKeys []sslKeyInfo
-	for _, key := range keysResp.Result {
-		if len(key.Name) > 20 && key.Name[len(key.Name)-11:] == ":ssl_config" {
+	for _, keyName := range keyNames {
+		if len(keyName) > 20 && keyName[len(keyName)-11:] == ":ssl_config" {
 			// Extract domain from key format: domain:example.com:ssl_config
-			parts := key.Name[7:]           // Remove "domain:" prefix
+			parts := keyName[7:]            // Remove "domain:" prefix
 			domain := parts[:len(parts)-11] // Remove ":ssl_config" suffix
-			sslKeys = append(sslKeys, sslKeyInfo{keyName: key.Name, domain: domain})
+			sslKeys = append(sslKeys, sslKeyInfo{keyName: keyName, domain: domain})
 		}
 	}
 
@@ -360,10 +222,32 @@ type VPSConfig struct {
 	Memory       float32 `json:"memory,omitempty"`       // Memory in GB (for OCI flexible shapes)
 	Region       string  `json:"region,omitempty"`       // Cloud provider region (e.g., "eu-zurich-1")
 	Architecture string  `json:"architecture,omitempty"` // CPU architecture (e.g., "ARM64", "x86_64")
+	// Pinned SSH host key, checked on every connection (see KnownHosts)
+	HostKey            string `json:"host_key,omitempty"`             // authorized_keys format, e.g. "ssh-ed25519 AAAA..."
+	HostKeyFingerprint string `json:"host_key_fingerprint,omitempty"` // e.g. "SHA256:..."
+	HostKeyTrustedAt   string `json:"host_key_trusted_at,omitempty"`
+	// Cluster membership: agent nodes record the server node whose cluster they joined
+	ClusterServerID int    `json:"cluster_server_id,omitempty"`
+	PrivateIPv4     string `json:"private_ipv4,omitempty"`    // Address on PrivateNetwork
+	PrivateNetwork  string `json:"private_network,omitempty"` // Provider ID of the private network the node is attached to
+}
+
+// IsAgent reports whether the server is an agent node of another server's cluster
+func (c *VPSConfig) IsAgent() bool {
+	return c.ClusterServerID != 0
+}
+
+// SSHAddress returns the host to connect to over SSH, including the port when it isn't 22
+func (c *VPSConfig) SSHAddress() string {
+	if c.SSHPort == 0 || c.SSHPort == 22 {
+		return c.PublicIPv4
+	}
+	return net.JoinHostPort(c.PublicIPv4, strconv.Itoa(c.SSHPort))
 }
 
 // StoreVPSConfig stores VPS configuration in KV
 func (kvs *KVService) StoreVPSConfig(token, accountID string, config *VPSConfig) error {
+	GetKnownHosts().Remember(config)
 	key := fmt.Sprintf("vps:%d:config", config.ServerID)
 	return kvs.PutValue(token, accountID, key, config)
 }
@@ -375,62 +259,34 @@ func (kvs *KVService) GetVPSConfig(token, accountID string, serverID int) (*VPSC
 	if err := kvs.GetValue(token, accountID, key, &config); err != nil {
 		return nil, err
 	}
+	kvs.rememberHostKey(token, accountID, &config)
 	return &config, nil
 }
 
-// ListVPSConfigs retrieves all VPS configurations
-func (kvs *KVService) ListVPSConfigs(token, accountID string) (map[int]*VPSConfig, error) {
-	// Get the Xanthus namespace ID (with caching)
-	cacheKey := "legacy_ns:" + accountID // Use first 10 chars of token as cache key
-	namespaceID, exists := kvs.namespaceIDCache[cacheKey]
-
-	if !exists {
-		var err error
-		namespaceID, err = kvs.GetXanthusNamespaceID(token, accountID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get namespace ID: %w", err)
-		}
-		kvs.namespaceIDCache[cacheKey] = namespaceID
+// rememberHostKey pins the host key of config, storing a key trusted on first use
+func (kvs *KVService) rememberHostKey(token, accountID string, config *VPSConfig) {
+	if !GetKnownHosts().Remember(config) {
+		return
 	}
-
-	// List all keys with vps:*:config prefix
-	url := fmt.Sprintf("%s/accounts/%s/storage/kv/namespaces/%s/keys?prefix=vps:",
-		CloudflareBaseURL, accountID, namespaceID)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+	key := fmt.Sprintf("vps:%d:config", config.ServerID)
+	if err := kvs.PutValue(token, accountID, key, config); err != nil {
+		log.Printf("Warning: Failed to store the SSH host key of %s: %v", config.Name, err)
 	}
+}
 
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := kvs.client.Do(req)
+// ListVPSConfigs retrieves all VPS configurations
+func (kvs *KVService) ListVPSConfigs(token, accountID string) (map[int]*VPSConfig, error) {
+	// List all keys with vps:*:config prefix
+	keyNames, err := kvs.ListKeys(token, accountID, "vps:")
 	if err != nil {
-		return nil, fmt.Errorf("failed to make request: %w", err)
-	}
-	defer resp.Body.Close()
-
-	var keysResp struct {
-		Success bool `json:"success"`
-		Result  []struct {
-			Name string `json:"name"`
-		} `json:"result"`
-		Errors []CFError `json:"errors"`
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&keysResp); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
-
-	if !keysResp.Success {
-		return nil, fmt.Errorf("KV API failed: %v", keysResp.Errors)
+		return nil, err
 	}
 
 	// Filter VPS config keys
 	var vpsKeys []string
-	for _, key := range keysResp.Result {
-		if len(key.Name) > 8 && key.Name[len(key.Name)-7:] == ":config" {
-			vpsKeys = append(vpsKeys, key.Name)
+	for _, keyName := range keyNames {
+		if strings.HasSuffix(keyName, ":config") {
+			vpsKeys = append(vpsKeys, keyName)
 		}
 	}
 
@@ -454,6 +310,8 @@ func (kvs *KVService) ListVPSConfigs(token, accountID string) (map[int]*VPSConfi
 
 			var config VPSConfig
 			if err := kvs.GetValue(token, accountID, keyName, &config); err == nil {
+				kvs.rememberHostKey(token, accountID, &config)
+
 				// Thread-safe map write
 				mu.Lock()
 				configs[config.ServerID] = &config
@@ -470,6 +328,11 @@ func (kvs *KVService) ListVPSConfigs(token, accountID string) (map[int]*VPSConfi
 
 // DeleteVPSConfig removes VPS configuration from KV
 func (kvs *KVService) DeleteVPSConfig(token, accountID string, serverID int) error {
+	// The address may be reused by another server, which must not inherit the pin
+	if config, err := kvs.GetVPSConfig(token, accountID, serverID); err == nil {
+		GetKnownHosts().Forget(config.SSHAddress())
+	}
+
 	key := fmt.Sprintf("vps:%d:config", serverID)
 	return kvs.DeleteValue(token, accountID, key)
 }
@@ -0,0 +1,503 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// EnvMetricsInterval configures how often metrics are collected; 0 disables collection
+const EnvMetricsInterval = "XANTHUS_METRICS_INTERVAL"
+
+// DefaultMetricsInterval is how often the usage of servers and applications is sampled
+const DefaultMetricsInterval = time.Minute
+
+const (
+	vpsMetricsKeyPrefix = "metrics:vps:"
+	appMetricsKeyPrefix = "metrics:app:"
+)
+
+// ErrNoMetrics is returned for servers and applications no metrics were collected for yet
+var ErrNoMetrics = errors.New("no metrics collected yet")
+
+// MetricsResolution is a tier of a metrics history: points Step apart kept for
+// Keep. Raw points are every collected sample.
+type MetricsResolution struct {
+	Name string
+	Step time.Duration
+	Keep time.Duration
+}
+
+// MetricsResolutions are the tiers metrics are downsampled into, finest first
+var MetricsResolutions = []MetricsResolution{
+	{Name: "raw", Keep: 3 * time.Hour},
+	{Name: "5m", Step: 5 * time.Minute, Keep: 48 * time.Hour},
+	{Name: "1h", Step: time.Hour, Keep: 30 * 24 * time.Hour},
+}
+
+// MetricsPoint is the usage of a server or application sampled at Time, or the
+// average of the Samples collected in the bucket starting at Time. Server
+// points have every field; application points only CPU and memory.
+type MetricsPoint struct {
+	Time             time.Time `json:"time"`
+	Samples          int       `json:"samples"`
+	CPUCores         float64   `json:"cpu_cores"`             // Cores in use
+	CPUPercent       float64   `json:"cpu_percent,omitempty"` // Of all cores of the server
+	MemoryBytes      float64   `json:"memory_bytes"`          // In use, excluding reclaimable caches
+	MemoryTotalBytes float64   `json:"memory_total_bytes,omitempty"`
+	DiskBytes        float64   `json:"disk_bytes,omitempty"` // Used on /
+	DiskTotalBytes   float64   `json:"disk_total_bytes,omitempty"`
+	NetRxBytesPerSec float64   `json:"net_rx_bytes_per_sec,omitempty"`
+	NetTxBytesPerSec float64   `json:"net_tx_bytes_per_sec,omitempty"`
+}
+
+// merge folds a sample into the running average of a point
+func (p *MetricsPoint) merge(sample MetricsPoint) {
+	n := float64(p.Samples)
+	avg := func(current *float64, value float64) { *current = (*current*n + value) / (n + 1) }
+	avg(&p.CPUCores, sample.CPUCores)
+	avg(&p.CPUPercent, sample.CPUPercent)
+	avg(&p.MemoryBytes, sample.MemoryBytes)
+	avg(&p.MemoryTotalBytes, sample.MemoryTotalBytes)
+	avg(&p.DiskBytes, sample.DiskBytes)
+	avg(&p.DiskTotalBytes, sample.DiskTotalBytes)
+	avg(&p.NetRxBytesPerSec, sample.NetRxBytesPerSec)
+	avg(&p.NetTxBytesPerSec, sample.NetTxBytesPerSec)
+	p.Samples++
+}
+
+// PodUsage is the CPU and memory a pod uses, from metrics-server
+type PodUsage struct {
+	Namespace   string  `json:"namespace"`
+	Name        string  `json:"name"`
+	Release     string  `json:"release,omitempty"` // Helm release of the pod
+	CPUCores    float64 `json:"cpu_cores"`
+	MemoryBytes float64 `json:"memory_bytes"`
+}
+
+// MetricsHistory is the downsampled usage history of a server or application,
+// keyed by resolution name, with the pods of a server at its latest sample
+type MetricsHistory struct {
+	Series    map[string][]MetricsPoint `json:"series"`
+	Pods      []PodUsage                `json:"pods,omitempty"`
+	UpdatedAt time.Time                 `json:"updated_at"`
+}
+
+// Add records a sample in every resolution and drops points older than each keeps
+func (h *MetricsHistory) Add(sample MetricsPoint) {
+	if h.Series == nil {
+		h.Series = make(map[string][]MetricsPoint)
+	}
+	sample.Samples = 1
+
+	for _, resolution := range MetricsResolutions {
+		points := h.Series[resolution.Name]
+		bucket := sample
+		if resolution.Step > 0 {
+			bucket.Time = sample.Time.Truncate(resolution.Step)
+		}
+		if last := len(points) - 1; resolution.Step > 0 && last >= 0 && points[last].Time.Equal(bucket.Time) {
+			points[last].merge(sample)
+		} else {
+			points = append(points, bucket)
+		}
+
+		cutoff := sample.Time.Add(-resolution.Keep)
+		first := sort.Search(len(points), func(i int) bool { return !points[i].Time.Before(cutoff) })
+		h.Series[resolution.Name] = points[first:]
+	}
+	h.UpdatedAt = sample.Time
+}
+
+// Range returns the points of the finest resolution that covers the last
+// span, newer than now minus span
+func (h *MetricsHistory) Range(span time.Duration, now time.Time) (string, []MetricsPoint) {
+	resolution := MetricsResolutions[len(MetricsResolutions)-1]
+	for _, r := range MetricsResolutions {
+		if span <= r.Keep {
+			resolution = r
+			break
+		}
+	}
+
+	cutoff := now.Add(-span)
+	points := []MetricsPoint{}
+	for _, point := range h.Series[resolution.Name] {
+		if !point.Time.Before(cutoff) {
+			points = append(points, point)
+		}
+	}
+	return resolution.Name, points
+}
+
+// MetricsSeries is the usage of a server or application over a time range
+type MetricsSeries struct {
+	Resolution string         `json:"resolution"`
+	Points     []MetricsPoint `json:"points"`
+	Pods       []PodUsage     `json:"pods,omitempty"` // Of a server, at UpdatedAt
+	UpdatedAt  time.Time      `json:"updated_at"`
+}
+
+// MetricsCollector periodically samples the CPU, memory, disk and network use
+// of every server over SSH, and the use of every pod through metrics-server
+// on server nodes, keeping a downsampled history per server and application
+type MetricsCollector struct {
+	kv       *KVService
+	history  *KVService // Where histories are kept, local when state lives in Cloudflare KV
+	cluster  *ClusterService
+	ssh      *SSHService
+	interval time.Duration
+	mu       sync.Mutex // serializes collections
+}
+
+var (
+	metricsCollector     *MetricsCollector
+	metricsCollectorOnce sync.Once
+)
+
+// GetMetricsCollector returns the collector shared by the scheduler and the handlers,
+// created on first use so the state store is configured by then
+func GetMetricsCollector() *MetricsCollector {
+	metricsCollectorOnce.Do(func() {
+		metricsCollector = NewMetricsCollector()
+	})
+	return metricsCollector
+}
+
+// NewMetricsCollector creates a collector configured from the environment.
+// Histories are written every interval, so when state lives in Cloudflare KV
+// they are kept in the local data directory instead.
+func NewMetricsCollector() *MetricsCollector {
+	interval := DefaultMetricsInterval
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv(EnvMetricsInterval))); err == nil && d >= 0 {
+		interval = d
+	}
+
+	store := utils.GetStateStore()
+	history := store
+	if utils.UsesCloudflareKV() {
+		local, err := utils.NewLocalStateStore(utils.DataDir())
+		if err != nil {
+			log.Printf("Warning: Metrics history unavailable: %v", err)
+			interval = 0
+		} else {
+			history = local
+		}
+	}
+	return NewMetricsCollectorWithStore(store, history, nil, interval)
+}
+
+// NewMetricsCollectorWithStore creates a collector reading servers and
+// applications from store and keeping histories in history; a nil keyring
+// stands for the process-wide one
+func NewMetricsCollectorWithStore(store, history utils.StateStore, keyring *utils.Keyring, interval time.Duration) *MetricsCollector {
+	cluster := NewClusterServiceWithStore(store, keyring)
+	return &MetricsCollector{
+		kv:       cluster.kv,
+		history:  NewKVServiceWithStore(history),
+		cluster:  cluster,
+		ssh:      cluster.ssh,
+		interval: interval,
+	}
+}
+
+// Interval returns how often metrics are collected, 0 when collection is disabled
+func (m *MetricsCollector) Interval() time.Duration {
+	return m.interval
+}
+
+// Start collects the metrics of every background account now and then
+// periodically, until ctx is cancelled
+func (m *MetricsCollector) Start(ctx context.Context) {
+	if m.interval <= 0 {
+		log.Printf("📈 Metrics collection disabled")
+		return
+	}
+	log.Printf("📈 Metrics collector started (every %s)", m.interval)
+
+	go func() {
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		for {
+			for _, account := range GetBackgroundAccounts().Accounts() {
+				if err := m.Collect(ctx, account.Token, account.AccountID); err != nil {
+					log.Printf("Metrics collection failed for account %s: %v", account.AccountID, err)
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Collect samples every server and application of an account once and adds
+// the samples to their histories. Servers that can't be reached are skipped
+// and histories of deleted servers and applications are dropped.
+func (m *MetricsCollector) Collect(ctx context.Context, token, accountID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	configs, err := m.kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return fmt.Errorf("failed to list servers: %w", err)
+	}
+	apps, _, err := listStoredApplications(m.kv, token, accountID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	pods := make(map[string][]PodUsage) // VPS ID -> pods of its cluster
+	for serverID, config := range configs {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		sample, serverPods, err := m.sample(token, accountID, config)
+		if err != nil {
+			log.Printf("Warning: Failed to collect the metrics of %s: %v", config.Name, err)
+			continue
+		}
+		sample.Time = now
+		if serverPods != nil {
+			pods[strconv.Itoa(serverID)] = serverPods
+		}
+		m.record(token, accountID, vpsMetricsKeyPrefix+strconv.Itoa(serverID), *sample, serverPods)
+	}
+
+	for appID, app := range apps {
+		serverPods, ok := pods[app.VPSID]
+		if !ok {
+			continue
+		}
+		sample := ApplicationUsage(app, serverPods)
+		sample.Time = now
+		m.record(token, accountID, appMetricsKeyPrefix+appID, sample, nil)
+	}
+
+	m.prune(token, accountID, configs, apps)
+	return nil
+}
+
+// sample collects the usage of a server and, on server nodes, of the pods of its cluster
+func (m *MetricsCollector) sample(token, accountID string, config *VPSConfig) (*MetricsPoint, []PodUsage, error) {
+	conn, err := m.cluster.connect(token, accountID, config)
+	if err != nil {
+		return nil, nil, err
+	}
+	result, err := m.ssh.ExecuteCommand(conn, nodeMetricsScript)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read usage: %v, output: %s", err, lastLine(commandOutput(result)))
+	}
+	sample, err := ParseNodeMetrics(result.Output)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.IsAgent() {
+		return sample, nil, nil
+	}
+
+	// metrics-server ships with K3s but takes a while to report after a restart
+	top, err := m.ssh.ExecuteCommand(conn, "kubectl top pods -A --no-headers")
+	if err != nil {
+		log.Printf("Warning: Failed to read the pod metrics of %s: %v", config.Name, err)
+		return sample, nil, nil
+	}
+	labels, err := m.ssh.ExecuteCommand(conn, `kubectl get pods -A -o jsonpath='{range .items[*]}{.metadata.namespace} {.metadata.name} {.metadata.labels.app\.kubernetes\.io/instance}{"\n"}{end}'`)
+	if err != nil {
+		log.Printf("Warning: Failed to read the pod releases of %s: %v", config.Name, err)
+		return sample, ParsePodMetrics(top.Output, ""), nil
+	}
+	return sample, ParsePodMetrics(top.Output, labels.Output), nil
+}
+
+// record adds a sample to a stored history
+func (m *MetricsCollector) record(token, accountID, key string, sample MetricsPoint, pods []PodUsage) {
+	var history MetricsHistory
+	if err := m.history.GetValue(token, accountID, key, &history); err != nil && !errors.Is(err, utils.ErrKeyNotFound) {
+		log.Printf("Warning: Failed to read metrics history %s: %v", key, err)
+		return
+	}
+	history.Add(sample)
+	history.Pods = pods
+	if err := m.history.PutValue(token, accountID, key, history); err != nil {
+		log.Printf("Warning: Failed to store metrics history %s: %v", key, err)
+	}
+}
+
+// prune drops the histories of servers and applications that no longer exist
+func (m *MetricsCollector) prune(token, accountID string, configs map[int]*VPSConfig, apps map[string]*models.Application) {
+	keys, err := m.history.ListKeys(token, accountID, "metrics:")
+	if err != nil {
+		log.Printf("Warning: Failed to list metrics histories: %v", err)
+		return
+	}
+	for _, key := range keys {
+		exists := true
+		if id, ok := strings.CutPrefix(key, vpsMetricsKeyPrefix); ok {
+			serverID, _ := strconv.Atoi(id)
+			_, exists = configs[serverID]
+		} else if id, ok := strings.CutPrefix(key, appMetricsKeyPrefix); ok {
+			_, exists = apps[id]
+		}
+		if !exists {
+			if err := m.history.DeleteValue(token, accountID, key); err != nil {
+				log.Printf("Warning: Failed to delete metrics history %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// VPSMetrics returns the usage of a server over the last span
+func (m *MetricsCollector) VPSMetrics(token, accountID string, serverID int, span time.Duration) (*MetricsSeries, error) {
+	return m.series(token, accountID, vpsMetricsKeyPrefix+strconv.Itoa(serverID), span)
+}
+
+// ApplicationMetrics returns the usage of an application's pods over the last span
+func (m *MetricsCollector) ApplicationMetrics(token, accountID, appID string, span time.Duration) (*MetricsSeries, error) {
+	return m.series(token, accountID, appMetricsKeyPrefix+appID, span)
+}
+
+func (m *MetricsCollector) series(token, accountID, key string, span time.Duration) (*MetricsSeries, error) {
+	var history MetricsHistory
+	if err := m.history.GetValue(token, accountID, key, &history); err != nil {
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			return nil, ErrNoMetrics
+		}
+		return nil, fmt.Errorf("failed to read metrics: %w", err)
+	}
+
+	resolution, points := history.Range(span, time.Now().UTC())
+	return &MetricsSeries{Resolution: resolution, Points: points, Pods: history.Pods, UpdatedAt: history.UpdatedAt}, nil
+}
+
+// nodeMetricsScript prints the CPU and network counters of a server one
+// second apart, then its memory, root disk and core count
+const nodeMetricsScript = `net() { awk 'NR > 2 && $1 !~ /^(lo|veth|cni|flannel)/ { rx += $2; tx += $10 } END { print "NET", rx + 0, tx + 0 }' /proc/net/dev; }
+head -1 /proc/stat; net
+sleep 1
+head -1 /proc/stat; net
+awk '/^MemTotal:/ { total = $2 } /^MemAvailable:/ { available = $2 } END { print "MEM", total * 1024, (total - available) * 1024 }' /proc/meminfo
+echo DISK $(df -B1 --output=size,used / | tail -1)
+echo CPUS $(nproc)`
+
+// ParseNodeMetrics parses the output of the node metrics script into a sample.
+// CPU and network use are the differences between its two readings, one
+// second apart; memory in use excludes caches the kernel can reclaim.
+func ParseNodeMetrics(output string) (*MetricsPoint, error) {
+	var cpu [][]float64
+	var net [][2]float64
+	sample := &MetricsPoint{}
+	cpus := 0.0
+
+lines:
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		values := make([]float64, 0, len(fields)-1)
+		for _, field := range fields[1:] {
+			value, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				continue lines // Not a reading, e.g. a warning on stderr
+			}
+			values = append(values, value)
+		}
+
+		switch {
+		case fields[0] == "cpu" && len(values) >= 4:
+			cpu = append(cpu, values)
+		case fields[0] == "NET" && len(values) == 2:
+			net = append(net, [2]float64{values[0], values[1]})
+		case fields[0] == "MEM" && len(values) == 2:
+			sample.MemoryTotalBytes, sample.MemoryBytes = values[0], values[1]
+		case fields[0] == "DISK" && len(values) == 2:
+			sample.DiskTotalBytes, sample.DiskBytes = values[0], values[1]
+		case fields[0] == "CPUS" && len(values) == 1:
+			cpus = values[0]
+		}
+	}
+	if len(cpu) != 2 || len(net) != 2 || cpus == 0 || sample.MemoryTotalBytes == 0 {
+		return nil, fmt.Errorf("incomplete usage output: %s", lastLine(output))
+	}
+
+	// user nice system idle iowait irq softirq steal; idle and iowait are idle time
+	total, idle := 0.0, 0.0
+	for i := range cpu[1] {
+		if i >= len(cpu[0]) || i >= 8 {
+			break
+		}
+		delta := cpu[1][i] - cpu[0][i]
+		total += delta
+		if i == 3 || i == 4 {
+			idle += delta
+		}
+	}
+	if total > 0 {
+		sample.CPUPercent = (total - idle) / total * 100
+	}
+	sample.CPUCores = sample.CPUPercent / 100 * cpus
+	sample.NetRxBytesPerSec = max(0, net[1][0]-net[0][0])
+	sample.NetTxBytesPerSec = max(0, net[1][1]-net[0][1])
+	return sample, nil
+}
+
+// ParsePodMetrics parses the output of `kubectl top pods -A --no-headers`,
+// naming the Helm release of each pod from lines of "namespace name release"
+func ParsePodMetrics(top, releases string) []PodUsage {
+	podReleases := make(map[string]string)
+	for _, line := range strings.Split(releases, "\n") {
+		if fields := strings.Fields(line); len(fields) == 3 {
+			podReleases[fields[0]+"/"+fields[1]] = fields[2]
+		}
+	}
+
+	pods := []PodUsage{}
+	for _, line := range strings.Split(top, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 4 {
+			continue
+		}
+		pods = append(pods, PodUsage{
+			Namespace:   fields[0],
+			Name:        fields[1],
+			Release:     podReleases[fields[0]+"/"+fields[1]],
+			CPUCores:    parseCPUQuantity(fields[2]),
+			MemoryBytes: parseMemoryQuantity(fields[3]) * (1 << 30),
+		})
+	}
+	sort.Slice(pods, func(i, j int) bool { return pods[i].CPUCores > pods[j].CPUCores })
+	return pods
+}
+
+// ApplicationUsage sums the usage of the pods of an application's Helm
+// release, or named after it when they carry no release label
+func ApplicationUsage(app *models.Application, pods []PodUsage) MetricsPoint {
+	release := app.HelmReleaseName()
+	var usage MetricsPoint
+	for _, pod := range pods {
+		if pod.Namespace != app.Namespace {
+			continue
+		}
+		if pod.Release == release || (pod.Release == "" && strings.HasPrefix(pod.Name, release+"-")) {
+			usage.CPUCores += pod.CPUCores
+			usage.MemoryBytes += pod.MemoryBytes
+		}
+	}
+	return usage
+}
@@ -68,6 +68,11 @@ func NewOCIService(authToken string) (*OCIService, error) {
 		return nil, fmt.Errorf("failed to create network client: %w", err)
 	}
 
+	// Record the latency and errors of OCI requests like those of other providers
+	computeClient.HTTPClient = utils.MeteredDispatcher{Base: computeClient.HTTPClient}
+	identityClient.HTTPClient = utils.MeteredDispatcher{Base: identityClient.HTTPClient}
+	networkClient.HTTPClient = utils.MeteredDispatcher{Base: networkClient.HTTPClient}
+
 	return &OCIService{
 		computeClient:  &computeClient,
 		identityClient: &identityClient,
@@ -133,22 +138,39 @@ type OCISubnet struct {
 
 // ListInstances retrieves all instances managed by Xanthus
 func (o *OCIService) ListInstances(ctx context.Context) ([]OCIInstance, error) {
-	// List instances with managed_by=xanthus tag
+	return o.listInstances(ctx, true)
+}
+
+// ListAllInstances retrieves every instance of the tenancy, including instances not created by Xanthus
+func (o *OCIService) ListAllInstances(ctx context.Context) ([]OCIInstance, error) {
+	return o.listInstances(ctx, false)
+}
+
+// listInstances retrieves the instances of the tenancy, optionally only those tagged managed_by=xanthus
+func (o *OCIService) listInstances(ctx context.Context, managedOnly bool) ([]OCIInstance, error) {
 	listInstancesRequest := core.ListInstancesRequest{
 		CompartmentId: &o.tenancyOCID,
 		SortBy:        core.ListInstancesSortByTimecreated,
 		SortOrder:     core.ListInstancesSortOrderDesc,
 	}
 
-	response, err := o.computeClient.ListInstances(ctx, listInstancesRequest)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list instances: %w", err)
+	var items []core.Instance
+	for {
+		response, err := o.computeClient.ListInstances(ctx, listInstancesRequest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list instances: %w", err)
+		}
+		items = append(items, response.Items...)
+		if response.OpcNextPage == nil {
+			break
+		}
+		listInstancesRequest.Page = response.OpcNextPage
 	}
 
 	var instances []OCIInstance
-	for _, instance := range response.Items {
+	for _, instance := range items {
 		// Filter by managed_by tag
-		if managedBy, exists := instance.FreeformTags["managed_by"]; !exists || managedBy != "xanthus" {
+		if managedBy, exists := instance.FreeformTags["managed_by"]; managedOnly && (!exists || managedBy != "xanthus") {
 			continue
 		}
 
@@ -224,6 +246,15 @@ func (o *OCIService) GetInstance(ctx context.Context, instanceID string) (*OCIIn
 	}, nil
 }
 
+// InstanceState returns the lifecycle state of an instance without looking up its addresses
+func (o *OCIService) InstanceState(ctx context.Context, instanceID string) (string, error) {
+	response, err := o.computeClient.GetInstance(ctx, core.GetInstanceRequest{InstanceId: &instanceID})
+	if err != nil {
+		return "", fmt.Errorf("failed to get instance: %w", err)
+	}
+	return string(response.Instance.LifecycleState), nil
+}
+
 // getInstancePublicIP retrieves the public IP address of an instance
 func (o *OCIService) getInstancePublicIP(ctx context.Context, instanceID string) (string, error) {
 	// List VNICs attached to the instance
@@ -571,6 +602,11 @@ func (o *OCIService) GetInstanceConsoleConnection(ctx context.Context, instanceI
 
 // CreateVPSWithK3s creates a complete VPS instance with network setup and K3s installation
 func (o *OCIService) CreateVPSWithK3s(ctx context.Context, displayName, shape, sshPublicKey, timezone string, ocpu, memory float32) (*OCIInstance, error) {
+	return o.CreateVPSWithUserData(ctx, displayName, shape, sshPublicKey, ociCloudInitScript, timezone, ocpu, memory)
+}
+
+// CreateVPSWithUserData creates an instance with the given cloud-init user data, setting up the network if needed
+func (o *OCIService) CreateVPSWithUserData(ctx context.Context, displayName, shape, sshPublicKey, userData, timezone string, ocpu, memory float32) (*OCIInstance, error) {
 	// Get the first availability domain
 	availabilityDomains, err := o.ListAvailabilityDomains(ctx)
 	if err != nil {
@@ -602,7 +638,7 @@ func (o *OCIService) CreateVPSWithK3s(ctx context.Context, displayName, shape, s
 	}
 
 	// Create the instance with cloud-init
-	return o.CreateInstance(ctx, displayName, shape, imageID, availabilityDomain, subnetID, sshPublicKey, ociCloudInitScript, timezone, ocpu, memory)
+	return o.CreateInstance(ctx, displayName, shape, imageID, availabilityDomain, subnetID, sshPublicKey, userData, timezone, ocpu, memory)
 }
 
 // DeleteVPSWithCleanup terminates an instance and optionally cleans up network resources
@@ -938,6 +974,12 @@ func (o *OCIService) CreateOrGetSecurityList(ctx context.Context, vcnID, display
 				},
 			},
 		},
+		{
+			// Kubelet and flannel traffic between the nodes of a cluster. Security
+			// lists created before agent nodes were supported lack this rule.
+			Protocol: common.String("all"),
+			Source:   common.String("10.0.0.0/16"),
+		},
 	}
 
 	// Create new security list
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// podWatchInterval is how often pods are polled while a release is installed
+const podWatchInterval = 5 * time.Second
+
+// watchReleasePods reports status changes of the pods of a Helm release to the
+// job ctx belongs to until ctx is done. It is meant to run alongside
+// `helm install --wait`, which prints nothing until the release is ready.
+func watchReleasePods(ctx context.Context, ss *SSHService, conn *SSHConnection, namespace, releaseName string) {
+	if JobID(ctx) == "" {
+		return
+	}
+
+	command := fmt.Sprintf("kubectl get pods -n %s -l app.kubernetes.io/instance=%s --no-headers 2>/dev/null", namespace, releaseName)
+	seen := make(map[string]PodStatus)
+
+	ticker := time.NewTicker(podWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		result, err := ss.ExecuteCommand(conn, command)
+		if err != nil || ctx.Err() != nil {
+			continue
+		}
+		for _, pod := range parsePodStatuses(result.Output) {
+			if seen[pod.Name] != pod {
+				seen[pod.Name] = pod
+				JobPod(ctx, pod)
+			}
+		}
+	}
+}
+
+// parsePodStatuses parses the output of `kubectl get pods --no-headers`
+func parsePodStatuses(output string) []PodStatus {
+	var pods []PodStatus
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		pods = append(pods, PodStatus{Name: fields[0], Ready: fields[1], Status: fields[2], Restarts: fields[3]})
+	}
+	return pods
+}
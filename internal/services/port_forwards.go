@@ -0,0 +1,77 @@
+package services
+
+import (
+	"fmt"
+
+	"github.com/chrishham/xanthus/internal/models"
+)
+
+// PortForwardServiceYAML renders the Service that sends port 80 to port on
+// the pods of the application's Helm release
+func PortForwardServiceYAML(app *models.Application, serviceName string, port int) string {
+	return fmt.Sprintf(`apiVersion: v1
+kind: Service
+metadata:
+  name: %s
+  namespace: %s
+  labels:
+    app: %s
+    port-forward: "true"
+spec:
+  selector:
+    app.kubernetes.io/name: %s
+    app.kubernetes.io/instance: %s
+  ports:
+  - name: port-%d
+    port: 80
+    targetPort: %d
+    protocol: TCP
+  type: ClusterIP
+`, serviceName, app.Namespace, serviceName, app.AppType, app.HelmReleaseName(), port, port)
+}
+
+// PortForwardIngressYAML renders the Ingress that routes subdomain.domain to
+// the port forward's Service over TLS
+func PortForwardIngressYAML(app *models.Application, ingressName, serviceName, subdomain, domain string) string {
+	return fmt.Sprintf(`apiVersion: networking.k8s.io/v1
+kind: Ingress
+metadata:
+  name: %s
+  namespace: %s
+  labels:
+    app: %s
+    port-forward: "true"
+  annotations:
+    traefik.ingress.kubernetes.io/router.entrypoints: websecure
+    traefik.ingress.kubernetes.io/router.tls: "true"
+spec:
+  tls:
+  - secretName: %s-tls
+    hosts:
+    - %s.%s
+  rules:
+  - host: %s.%s
+    http:
+      paths:
+      - path: /
+        pathType: Prefix
+        backend:
+          service:
+            name: %s
+            port:
+              number: 80
+`, ingressName, app.Namespace, serviceName, domain, subdomain, domain, subdomain, domain, serviceName)
+}
+
+// applyManifest applies a Kubernetes manifest on the server behind conn
+func applyManifest(ssh *SSHService, conn *SSHConnection, manifest string) error {
+	cmd := fmt.Sprintf("cat <<'EOF' | kubectl apply -f -\n%s\nEOF", manifest)
+	result, err := ssh.ExecuteCommand(conn, cmd)
+	if err != nil {
+		if result != nil {
+			return fmt.Errorf("%v, output: %s", err, result.Output)
+		}
+		return err
+	}
+	return nil
+}
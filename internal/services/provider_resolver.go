@@ -83,11 +83,29 @@ func (pr *ProviderResolver) GetProviderDefaults(provider string) *ProviderDefaul
 		return &ProviderDefaults{
 			DefaultSSHUser:      "root",
 			DefaultSSHPort:      22,
-			SupportsAPICreation: false,
+			SupportsAPICreation: true,
 			LocationTimezones: map[string]string{
 				"nyc1":    "America/New_York",
+				"nyc2":    "America/New_York",
+				"nyc3":    "America/New_York",
+				"sfo2":    "America/Los_Angeles",
+				"sfo3":    "America/Los_Angeles",
+				"tor1":    "America/Toronto",
 				"lon1":    "Europe/London",
+				"ams3":    "Europe/Amsterdam",
 				"fra1":    "Europe/Berlin",
+				"sgp1":    "Asia/Singapore",
+				"blr1":    "Asia/Kolkata",
+				"syd1":    "Australia/Sydney",
+				"default": "UTC",
+			},
+		}
+	case ProviderManual:
+		return &ProviderDefaults{
+			DefaultSSHUser:      "root",
+			DefaultSSHPort:      22,
+			SupportsAPICreation: false,
+			LocationTimezones: map[string]string{
 				"default": "UTC",
 			},
 		}
@@ -140,8 +158,12 @@ func (pr *ProviderResolver) ResolveSSHUserFromConfig(vpsConfig *VPSConfig) strin
 }
 
 // GetCorrectSSHUserFromConfig always returns the correct SSH user based on provider defaults
-// This method ignores the stored SSH user and always uses provider defaults
+// This method ignores the stored SSH user and always uses provider defaults, except for
+// manually added servers whose user was chosen by their owner
 func (pr *ProviderResolver) GetCorrectSSHUserFromConfig(vpsConfig *VPSConfig) string {
+	if vpsConfig.Provider == ProviderManual && vpsConfig.SSHUser != "" {
+		return vpsConfig.SSHUser
+	}
 	defaults := pr.GetProviderDefaults(vpsConfig.Provider)
 	return defaults.DefaultSSHUser
 }
@@ -168,7 +190,7 @@ func (pr *ProviderResolver) ResolveTimezone(provider, location string) string {
 // ValidateProviderSupport checks if a provider is supported
 func (pr *ProviderResolver) ValidateProviderSupport(provider string) error {
 	switch provider {
-	case "Hetzner", "Oracle Cloud Infrastructure (OCI)", "oci", "OCI", "AWS", "DigitalOcean":
+	case "Hetzner", "Oracle Cloud Infrastructure (OCI)", "oci", "OCI", "AWS", "DigitalOcean", ProviderManual:
 		return nil
 	default:
 		return fmt.Errorf("unsupported provider: %s", provider)
@@ -182,5 +204,6 @@ func (pr *ProviderResolver) GetSupportedProviders() []string {
 		"Oracle Cloud Infrastructure (OCI)",
 		"AWS",
 		"DigitalOcean",
+		ProviderManual,
 	}
 }
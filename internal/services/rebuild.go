@@ -0,0 +1,403 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+var (
+	// ErrRebuildUnsupported is returned when rebuilding a server Xanthus can't recreate
+	ErrRebuildUnsupported = errors.New("server can't be rebuilt")
+	// ErrServerStillExists is returned when rebuilding a server its provider
+	// still has, unless the rebuild replaces it
+	ErrServerStillExists = errors.New("server still exists at its provider")
+)
+
+// RebuildRequest selects the server to rebuild
+type RebuildRequest struct {
+	ServerID int
+	// Replace deletes the server first when its provider still has it,
+	// e.g. because it is unreachable rather than gone
+	Replace bool
+	// RestoreBackups restores the latest snapshot of every application with a
+	// backup policy after redeploying it
+	RestoreBackups bool
+}
+
+// RebuiltApplication is the outcome of redeploying one application
+type RebuiltApplication struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Restored bool   `json:"restored,omitempty"` // its volumes were restored from the latest backup
+	Error    string `json:"error,omitempty"`
+}
+
+// RebuildResult describes a rebuilt server
+type RebuildResult struct {
+	OldServerID  int                  `json:"old_server_id"`
+	OldIPv4      string               `json:"old_ipv4"`
+	Server       *VPSConfig           `json:"server"`
+	Applications []RebuiltApplication `json:"applications"`
+	PortForwards int                  `json:"port_forwards"`
+	DNSRecords   []string             `json:"dns_records"` // A records moved to the new address
+	// Errors are steps that failed without stopping the rebuild
+	Errors []string `json:"errors"`
+}
+
+// RebuildService recreates a lost server from the state Xanthus stores: a new
+// server of the same type and location, its applications at their recorded
+// versions and values, their port forwards, and DNS pointing at the new address
+type RebuildService struct {
+	kv      *KVService
+	keys    *SSHKeyService
+	ssh     *SSHService
+	cf      *CloudflareService
+	vps     *VPSService
+	apps    *SimpleApplicationService
+	certs   *CertRenewalService
+	backups *BackupService
+	catalog ApplicationCatalog
+
+	setupTimeout time.Duration // How long to wait for cloud-init on the new server
+	pollInterval time.Duration
+}
+
+// NewRebuildService creates a rebuild service on the process-wide state store
+func NewRebuildService(catalog ApplicationCatalog) *RebuildService {
+	return NewRebuildServiceWithStore(utils.GetStateStore(), nil, catalog)
+}
+
+// NewRebuildServiceWithStore creates a rebuild service on the given state
+// store and keyring; a nil keyring stands for the process-wide one
+func NewRebuildServiceWithStore(store utils.StateStore, keyring *utils.Keyring, catalog ApplicationCatalog) *RebuildService {
+	kv := NewKVServiceWithStore(store)
+	keys := NewSSHKeyServiceWithStore(store, keyring)
+
+	vps := NewVPSService()
+	vps.kv = kv
+	vps.keys = keys
+	vps.provider = NewProviderResolver(kv)
+
+	return &RebuildService{
+		kv:           kv,
+		keys:         keys,
+		ssh:          NewSSHService(),
+		cf:           NewCloudflareService(),
+		vps:          vps,
+		apps:         NewSimpleApplicationService(),
+		certs:        NewCertRenewalServiceWithKV(kv, DefaultCertRenewalWindow, DefaultCertCheckInterval),
+		backups:      NewBackupServiceWithStore(store, keyring),
+		catalog:      catalog,
+		setupTimeout: 20 * time.Minute,
+		pollInterval: 15 * time.Second,
+	}
+}
+
+// Rebuild provisions a replacement for a server, re-runs its setup, redeploys
+// its applications and port forwards and repoints DNS to the new address. The
+// old configuration is replaced by the new server's. Failures to redeploy an
+// application are recorded in its status and in the result rather than returned.
+func (s *RebuildService) Rebuild(ctx context.Context, token, accountID string, req RebuildRequest) (*RebuildResult, error) {
+	old, err := s.kv.GetVPSConfig(token, accountID, req.ServerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VPS config: %w", err)
+	}
+	if old.Provider == ProviderManual {
+		return nil, fmt.Errorf("%w: %s was added over SSH and has no provider to create it again", ErrRebuildUnsupported, old.Name)
+	}
+	if old.IsAgent() {
+		return nil, fmt.Errorf("%w: %s is an agent node, delete it and join a new one", ErrRebuildUnsupported, old.Name)
+	}
+
+	cp, err := s.vps.CloudProvider(token, accountID, old.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := StartJobStep(ctx, "Checking the old server"); err != nil {
+		return nil, err
+	}
+	exists, err := cp.ServerExists(ctx, old)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check server %s at %s: %w", old.Name, cp.Name(), err)
+	}
+	if exists {
+		if !req.Replace {
+			return nil, fmt.Errorf("%w: %s is still at %s, rebuild with replace to delete it", ErrServerStillExists, old.Name, cp.Name())
+		}
+		JobLogf(ctx, "Deleting server %s, which %s still has", old.Name, cp.Name())
+		if err := cp.DeleteServer(ctx, old); err != nil {
+			return nil, fmt.Errorf("failed to delete server %s: %w", old.Name, err)
+		}
+	}
+
+	apps, portForwards, err := listStoredApplications(s.kv, token, accountID)
+	if err != nil {
+		return nil, err
+	}
+	oldID := strconv.Itoa(old.ServerID)
+	var serverApps []*models.Application
+	for _, id := range sortedAppIDs(apps) {
+		if apps[id].VPSID == oldID {
+			serverApps = append(serverApps, apps[id])
+		}
+	}
+
+	_, config, err := s.vps.CreateServer(ctx, token, accountID, old.Provider, CloudServerRequest{
+		Name:       old.Name,
+		ServerType: old.ServerType,
+		Location:   old.Location,
+		Timezone:   old.Timezone,
+		CPUs:       old.OCPU,
+		MemoryGB:   old.Memory,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RebuildResult{OldServerID: old.ServerID, OldIPv4: old.PublicIPv4, Server: config}
+
+	// From here on the new server stands in for the old one
+	if err := StartJobStep(ctx, "Moving applications to the new server"); err != nil {
+		return result, err
+	}
+	newID := strconv.Itoa(config.ServerID)
+	for _, app := range serverApps {
+		app.VPSID = newID
+		app.VPSName = config.Name
+		if err := s.kv.PutValue(token, accountID, "app:"+app.ID, app); err != nil {
+			return result, fmt.Errorf("failed to move application %s to the new server: %w", app.Name, err)
+		}
+	}
+	if err := s.kv.DeleteVPSConfig(token, accountID, old.ServerID); err != nil {
+		log.Printf("Warning: Could not delete VPS config for server %d: %v", old.ServerID, err)
+	}
+	JobLogf(ctx, "Server %s replaced: ID %d → %d, IPv4 %s → %s", config.Name, old.ServerID, config.ServerID, old.PublicIPv4, config.PublicIPv4)
+
+	privateKey, err := s.keys.PrivateKey(token, accountID)
+	if err != nil {
+		return result, fmt.Errorf("failed to get SSH private key: %w", err)
+	}
+
+	if err := StartJobStep(ctx, "Waiting for K3s setup"); err != nil {
+		return result, err
+	}
+	if err := s.waitForSetup(ctx, config, privateKey); err != nil {
+		return result, err
+	}
+
+	if err := StartJobStep(ctx, "Repointing DNS records"); err != nil {
+		return result, err
+	}
+	result.DNSRecords = s.repointDNS(token, accountID, old.PublicIPv4, config.PublicIPv4, result)
+
+	domains := make(map[string]bool)
+	for _, app := range serverApps {
+		if err := StartJobStep(ctx, fmt.Sprintf("Redeploying %s", app.Name)); err != nil {
+			return result, err
+		}
+		rebuilt := RebuiltApplication{ID: app.ID, Name: app.Name}
+		if err := s.redeploy(ctx, token, accountID, app); err != nil {
+			JobLogf(ctx, "Warning: Failed to redeploy %s: %v", app.Name, err)
+			rebuilt.Error = err.Error()
+		} else {
+			domains[app.Domain] = true
+			result.PortForwards += s.recreatePortForwards(token, accountID, config, app, portForwards[app.ID], privateKey, result)
+			rebuilt.Restored = s.restoreBackups(ctx, token, accountID, app, req.RestoreBackups, result)
+		}
+		rebuilt.Status = app.Status
+		result.Applications = append(result.Applications, rebuilt)
+	}
+
+	if len(domains) > 0 {
+		if err := StartJobStep(ctx, "Installing certificates"); err != nil {
+			return result, err
+		}
+		for _, domain := range sortedKeys(domains) {
+			domainConfig, err := s.kv.GetDomainSSLConfig(token, accountID, domain)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("certificate of %s: %v", domain, err))
+				continue
+			}
+			if err := s.certs.DistributeCertificate(token, accountID, domainConfig, privateKey); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("certificate of %s: %v", domain, err))
+			}
+		}
+	}
+
+	// Agents keep trying to reach the old server, whose cluster is gone
+	agents, err := clusterServiceFor(s.vps).agents(token, accountID, old.ServerID)
+	if err != nil {
+		result.Errors = append(result.Errors, err.Error())
+	}
+	for _, agent := range agents {
+		result.Errors = append(result.Errors, fmt.Sprintf("agent node %s joined the old cluster, delete it and join it again", agent.Name))
+	}
+
+	for _, message := range result.Errors {
+		JobLogf(ctx, "Warning: %s", message)
+	}
+	return result, nil
+}
+
+// redeploy installs app again from its catalog entry
+func (s *RebuildService) redeploy(ctx context.Context, token, accountID string, app *models.Application) error {
+	predefined, ok := s.catalog.GetApplicationByID(app.AppType)
+	if !ok {
+		app.Status = "Failed"
+		app.ErrorMsg = fmt.Sprintf("unknown application type %s", app.AppType)
+		if err := s.kv.PutValue(token, accountID, "app:"+app.ID, app); err != nil {
+			log.Printf("Warning: Failed to update application status: %v", err)
+		}
+		return errors.New(app.ErrorMsg)
+	}
+	return s.apps.RedeployApplication(ctx, token, accountID, app, predefined)
+}
+
+// restoreBackups reinstalls the backup schedule of a redeployed application,
+// if it has one, and optionally restores its latest snapshot. It reports
+// whether the volumes were restored.
+func (s *RebuildService) restoreBackups(ctx context.Context, token, accountID string, app *models.Application, restore bool, result *RebuildResult) bool {
+	policy, err := s.backups.GetPolicy(token, accountID, app.ID)
+	if errors.Is(err, ErrBackupNotFound) {
+		return false
+	}
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("backup policy of %s: %v", app.Name, err))
+		return false
+	}
+
+	if _, err := s.backups.SetPolicy(ctx, token, accountID, *policy); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("backup schedule of %s: %v", app.Name, err))
+	}
+	if !restore {
+		return false
+	}
+	if err := s.backups.Restore(ctx, token, accountID, app.ID, "latest"); err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("restoring %s: %v", app.Name, err))
+		return false
+	}
+	return true
+}
+
+// recreatePortForwards applies the Service and Ingress of each port forward of
+// app on the new server and points its DNS record there. It returns how many
+// port forwards were recreated.
+func (s *RebuildService) recreatePortForwards(token, accountID string, config *VPSConfig, app *models.Application, forwards []storedPortForward, privateKey string, result *RebuildResult) int {
+	if len(forwards) == 0 {
+		return 0
+	}
+
+	conn, err := s.ssh.GetOrCreateConnection(config.SSHAddress(), config.SSHUser, privateKey, config.ServerID)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("port forwards of %s: failed to connect: %v", app.Name, err))
+		return 0
+	}
+
+	recreated := 0
+	for _, forward := range forwards {
+		host := hostName(forward.Subdomain, forward.Domain)
+		if err := applyManifest(s.ssh, conn, PortForwardServiceYAML(app, forward.ServiceName, forward.Port)); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("port forward %s: failed to create service: %v", host, err))
+			continue
+		}
+		if err := applyManifest(s.ssh, conn, PortForwardIngressYAML(app, forward.IngressName, forward.ServiceName, forward.Subdomain, forward.Domain)); err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("port forward %s: failed to create ingress: %v", host, err))
+			continue
+		}
+
+		proxied := true
+		if domainConfig, err := s.kv.GetDomainSSLConfig(token, accountID, forward.Domain); err == nil && domainConfig.DNSOnly {
+			proxied = false
+		}
+		zoneID, err := s.cf.GetZoneID(token, forward.Domain)
+		if err == nil {
+			err = s.cf.PointARecord(token, zoneID, host, config.PublicIPv4, proxied)
+		}
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("port forward %s: failed to point DNS: %v", host, err))
+			continue
+		}
+		recreated++
+	}
+	return recreated
+}
+
+// repointDNS moves every A record of the managed zones that points to oldIP to
+// newIP and returns the names of the moved records
+func (s *RebuildService) repointDNS(token, accountID, oldIP, newIP string, result *RebuildResult) []string {
+	if oldIP == "" || oldIP == newIP {
+		return nil
+	}
+
+	domainConfigs, err := s.kv.ListDomainSSLConfigs(token, accountID)
+	if err != nil {
+		result.Errors = append(result.Errors, fmt.Sprintf("DNS: failed to list domains: %v", err))
+		return nil
+	}
+
+	var moved []string
+	for _, domain := range sortedKeys(domainConfigs) {
+		zoneID, err := s.cf.GetZoneID(token, domain)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("DNS of %s: %v", domain, err))
+			continue
+		}
+		records, err := s.cf.GetDNSRecords(token, zoneID)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("DNS of %s: %v", domain, err))
+			continue
+		}
+		for _, record := range records {
+			if record.Type != "A" || record.Content != oldIP {
+				continue
+			}
+			if err := s.cf.UpdateDNSRecordContent(token, zoneID, record.ID, newIP); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("DNS record %s: %v", record.Name, err))
+				continue
+			}
+			moved = append(moved, strings.TrimSuffix(record.Name, "."))
+		}
+	}
+	return moved
+}
+
+// waitForSetup polls the cloud-init status of a new server until it reports READY
+func (s *RebuildService) waitForSetup(ctx context.Context, config *VPSConfig, privateKey string) error {
+	deadline := time.Now().Add(s.setupTimeout)
+	status := "UNKNOWN"
+	for {
+		if conn, err := s.ssh.ConnectToVPS(config.SSHAddress(), config.SSHUser, privateKey); err == nil {
+			if result, err := s.ssh.ExecuteCommand(conn, "cat /opt/xanthus/status 2>/dev/null || echo 'UNKNOWN'"); err == nil {
+				status = strings.TrimSpace(result.Output)
+			}
+			conn.Close()
+		}
+
+		switch status {
+		case "READY":
+			JobLogf(ctx, "Server %s is ready", config.Name)
+			return nil
+		case "FAILED":
+			return fmt.Errorf("setup of server %s failed", config.Name)
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("server %s did not finish its setup within %s (status %s)", config.Name, s.setupTimeout, status)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.pollInterval):
+		}
+	}
+}
@@ -0,0 +1,686 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// Environment variables that configure reconciliation
+const (
+	EnvReconcileInterval = "XANTHUS_RECONCILE_INTERVAL"
+	EnvReconcileAutoHeal = "XANTHUS_RECONCILE_AUTOHEAL"
+)
+
+// DefaultReconcileInterval is how often stored state is compared with the infrastructure
+const DefaultReconcileInterval = 15 * time.Minute
+
+const reconcileReportKey = "reconcile:report"
+
+// Drift kinds found by the reconciler
+const (
+	DriftServerMissing     = "server_missing"     // server in Xanthus but deleted at its provider
+	DriftServerUnreachable = "server_unreachable" // cluster could not be inspected over SSH
+	DriftReleaseMissing    = "release_missing"    // application without a Helm release
+	DriftAppStatus         = "app_status"         // recorded application status differs from Helm's
+	DriftReleaseUnmanaged  = "release_unmanaged"  // Helm release without an application
+	DriftIngressMissing    = "ingress_missing"    // port forward without its ingress
+	DriftDNSMissing        = "dns_missing"        // application hostname without an A record
+	DriftDNSMismatch       = "dns_mismatch"       // A record pointing away from the application's server
+	DriftDNSOrphaned       = "dns_orphaned"       // A record to a server that nothing uses
+)
+
+// ErrNoReconcileReport is returned before the first reconciliation of an account
+var ErrNoReconcileReport = errors.New("no reconciliation has run yet")
+
+// Drift is a difference between the state stored by Xanthus and the infrastructure
+type Drift struct {
+	Kind      string `json:"kind"`
+	Resource  string `json:"resource"`
+	Message   string `json:"message"`
+	Healable  bool   `json:"healable"`
+	Healed    bool   `json:"healed,omitempty"`
+	HealError string `json:"heal_error,omitempty"`
+
+	heal func(ctx context.Context) error
+}
+
+// ReconcileReport is the outcome of comparing an account's state with its infrastructure
+type ReconcileReport struct {
+	StartedAt    time.Time `json:"started_at"`
+	FinishedAt   time.Time `json:"finished_at"`
+	Heal         bool      `json:"heal"`
+	Servers      int       `json:"servers"`
+	Applications int       `json:"applications"`
+	Drift        []Drift   `json:"drift"`
+	// Errors are checks that could not run, e.g. because a provider API failed
+	Errors []string `json:"errors"`
+}
+
+// storedPortForward is the part of a stored port forward the reconciler checks
+// and a rebuild recreates
+type storedPortForward struct {
+	Port        int    `json:"port"`
+	Subdomain   string `json:"subdomain"`
+	Domain      string `json:"domain"`
+	ServiceName string `json:"service_name"`
+	IngressName string `json:"ingress_name"`
+}
+
+// helmRelease is an entry of `helm list --output json`
+type helmRelease struct {
+	Name       string `json:"name"`
+	Namespace  string `json:"namespace"`
+	Status     string `json:"status"`
+	Chart      string `json:"chart"`
+	AppVersion string `json:"app_version"`
+}
+
+// Reconciler periodically compares the servers, applications and port forwards
+// stored by Xanthus with the providers, each cluster and Cloudflare DNS. It
+// reports drift and, when healing is enabled, fixes what can be fixed safely.
+type Reconciler struct {
+	kv       *KVService
+	sshKeys  *SSHKeyService
+	cf       *CloudflareService
+	ssh      *SSHService
+	interval time.Duration
+	autoHeal bool
+	mu       sync.Mutex // serializes runs
+}
+
+var (
+	reconciler     *Reconciler
+	reconcilerOnce sync.Once
+)
+
+// GetReconciler returns the reconciler shared by the scheduler and the handlers,
+// created on first use so the state store is configured by then
+func GetReconciler() *Reconciler {
+	reconcilerOnce.Do(func() {
+		reconciler = NewReconciler()
+	})
+	return reconciler
+}
+
+// NewReconciler creates a reconciler configured from the environment
+func NewReconciler() *Reconciler {
+	interval := DefaultReconcileInterval
+	if d, err := time.ParseDuration(strings.TrimSpace(os.Getenv(EnvReconcileInterval))); err == nil && d > 0 {
+		interval = d
+	}
+	autoHeal, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv(EnvReconcileAutoHeal)))
+
+	return NewReconcilerWithStore(utils.GetStateStore(), nil, interval, autoHeal)
+}
+
+// NewReconcilerWithStore creates a reconciler on the given state store and
+// keyring; a nil keyring stands for the process-wide one
+func NewReconcilerWithStore(store utils.StateStore, keyring *utils.Keyring, interval time.Duration, autoHeal bool) *Reconciler {
+	return &Reconciler{
+		kv:       NewKVServiceWithStore(store),
+		sshKeys:  NewSSHKeyServiceWithStore(store, keyring),
+		cf:       NewCloudflareService(),
+		ssh:      NewSSHService(),
+		interval: interval,
+		autoHeal: autoHeal,
+	}
+}
+
+// Interval returns how often the scheduler reconciles
+func (r *Reconciler) Interval() time.Duration {
+	return r.interval
+}
+
+// AutoHeal reports whether scheduled runs heal the drift they find
+func (r *Reconciler) AutoHeal() bool {
+	return r.autoHeal
+}
+
+// Start reconciles every background account after one interval and then
+// periodically, until ctx is cancelled
+func (r *Reconciler) Start(ctx context.Context) {
+	log.Printf("🔁 Reconciler started (every %s, auto-heal %v)", r.interval, r.autoHeal)
+
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			for _, account := range GetBackgroundAccounts().Accounts() {
+				if _, err := r.Run(ctx, account.Token, account.AccountID, r.autoHeal); err != nil {
+					log.Printf("Reconciliation failed for account %s: %v", account.AccountID, err)
+				}
+			}
+		}
+	}()
+}
+
+// LastReport returns the report of the account's most recent reconciliation
+func (r *Reconciler) LastReport(token, accountID string) (*ReconcileReport, error) {
+	var report ReconcileReport
+	if err := r.kv.GetValue(token, accountID, reconcileReportKey, &report); err != nil {
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			return nil, ErrNoReconcileReport
+		}
+		return nil, fmt.Errorf("failed to read reconciliation report: %w", err)
+	}
+	return &report, nil
+}
+
+// Run compares the account's stored state with its infrastructure, heals the
+// drift found when heal is set and stores the report
+func (r *Reconciler) Run(ctx context.Context, token, accountID string, heal bool) (*ReconcileReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &ReconcileReport{StartedAt: time.Now().UTC(), Heal: heal, Drift: []Drift{}, Errors: []string{}}
+
+	configs, err := r.kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	apps, portForwards, err := listStoredApplications(r.kv, token, accountID)
+	if err != nil {
+		return nil, err
+	}
+	report.Servers = len(configs)
+	report.Applications = len(apps)
+
+	if err := StartJobStep(ctx, "Checking servers"); err != nil {
+		return nil, err
+	}
+	present := r.checkServers(ctx, token, accountID, configs, report)
+
+	if err := StartJobStep(ctx, "Inspecting clusters"); err != nil {
+		return nil, err
+	}
+	r.checkClusters(ctx, token, accountID, present, apps, portForwards, report)
+
+	if err := StartJobStep(ctx, "Checking DNS"); err != nil {
+		return nil, err
+	}
+	r.checkDNS(token, accountID, present, apps, portForwards, report)
+
+	if heal {
+		if err := StartJobStep(ctx, "Healing drift"); err != nil {
+			return nil, err
+		}
+		for i := range report.Drift {
+			drift := &report.Drift[i]
+			if drift.heal == nil {
+				continue
+			}
+			if err := drift.heal(ctx); err != nil {
+				drift.HealError = err.Error()
+				JobLogf(ctx, "Failed to heal %s %s: %v", drift.Kind, drift.Resource, err)
+				continue
+			}
+			drift.Healed = true
+			JobLogf(ctx, "🩹 Healed %s %s", drift.Kind, drift.Resource)
+		}
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	if err := r.kv.PutValue(token, accountID, reconcileReportKey, report); err != nil {
+		log.Printf("Warning: Failed to store reconciliation report for account %s: %v", accountID, err)
+	}
+	if len(report.Drift) > 0 {
+		log.Printf("🔁 Reconciliation of account %s found %d drift(s)", accountID, len(report.Drift))
+	}
+	return report, nil
+}
+
+// listStoredApplications returns the stored applications by ID with their port forwards
+func listStoredApplications(kv *KVService, token, accountID string) (map[string]*models.Application, map[string][]storedPortForward, error) {
+	keys, err := kv.ListKeys(token, accountID, "app:")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list applications: %w", err)
+	}
+
+	apps := make(map[string]*models.Application)
+	portForwards := make(map[string][]storedPortForward)
+	for _, key := range keys {
+		parts := strings.Split(key, ":")
+		switch {
+		case len(parts) == 2:
+			var app models.Application
+			if err := kv.GetValue(token, accountID, key, &app); err != nil {
+				log.Printf("Warning: Failed to read %s: %v", key, err)
+				continue
+			}
+			apps[app.ID] = &app
+		case len(parts) == 3 && parts[2] == "port-forwards":
+			var forwards []storedPortForward
+			if err := kv.GetValue(token, accountID, key, &forwards); err != nil {
+				log.Printf("Warning: Failed to read %s: %v", key, err)
+				continue
+			}
+			portForwards[parts[1]] = forwards
+		}
+	}
+	return apps, portForwards, nil
+}
+
+// checkServers asks each server's provider whether it still exists and returns
+// the servers that do. Servers whose provider can't be asked count as present.
+func (r *Reconciler) checkServers(ctx context.Context, token, accountID string, configs map[int]*VPSConfig, report *ReconcileReport) map[int]*VPSConfig {
+	present := make(map[int]*VPSConfig)
+	for _, id := range sortedServerIDs(configs) {
+		config := configs[id]
+
+		exists := true
+		provider, err := NewCloudProvider(config.Provider, token, accountID)
+		if err == nil {
+			exists, err = provider.ServerExists(ctx, config)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("server %s: %v", config.Name, err))
+			present[id] = config
+			continue
+		}
+		if exists {
+			present[id] = config
+			continue
+		}
+
+		serverID := config.ServerID
+		report.Drift = append(report.Drift, Drift{
+			Kind:     DriftServerMissing,
+			Resource: fmt.Sprintf("vps/%d", serverID),
+			Message:  fmt.Sprintf("Server %s no longer exists at %s", config.Name, providerName(config.Provider)),
+			Healable: true,
+			heal: func(ctx context.Context) error {
+				return r.forgetServer(token, accountID, serverID)
+			},
+		})
+	}
+	return present
+}
+
+// forgetServer removes a server deleted outside Xanthus together with its applications
+func (r *Reconciler) forgetServer(token, accountID string, serverID int) error {
+	if err := NewVPSService().deleteAssociatedApplications(token, accountID, strconv.Itoa(serverID)); err != nil {
+		return err
+	}
+	return r.kv.DeleteVPSConfig(token, accountID, serverID)
+}
+
+// checkClusters compares the applications and port forwards of each present
+// server with the Helm releases and ingresses of its cluster
+func (r *Reconciler) checkClusters(ctx context.Context, token, accountID string, servers map[int]*VPSConfig, apps map[string]*models.Application, portForwards map[string][]storedPortForward, report *ReconcileReport) {
+	if len(servers) == 0 {
+		return
+	}
+
+	sshPrivateKey, err := r.sshKeys.PrivateKey(token, accountID)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("clusters: %v", err))
+		return
+	}
+
+	for _, id := range sortedServerIDs(servers) {
+		if ctx.Err() != nil {
+			return
+		}
+		config := servers[id]
+		vpsID := strconv.Itoa(config.ServerID)
+
+		releases, ingresses, err := r.inspectCluster(config, sshPrivateKey)
+		if err != nil {
+			report.Drift = append(report.Drift, Drift{
+				Kind:     DriftServerUnreachable,
+				Resource: fmt.Sprintf("vps/%d", config.ServerID),
+				Message:  fmt.Sprintf("Cluster on %s could not be inspected: %v", config.Name, err),
+			})
+			continue
+		}
+
+		claimed := make(map[string]bool)
+		for _, appID := range sortedAppIDs(apps) {
+			app := apps[appID]
+			if app.VPSID != vpsID {
+				continue
+			}
+			releaseKey := app.Namespace + "/" + app.HelmReleaseName()
+			claimed[releaseKey] = true
+
+			if drift := applicationDrift(app, releases[releaseKey]); drift != nil {
+				status := drift.Message
+				drift.Message = fmt.Sprintf("Application %s is recorded as %q but %s", app.Name, app.Status, status)
+				appCopy := *app
+				drift.heal = func(ctx context.Context) error {
+					return r.recordApplicationStatus(token, accountID, &appCopy, status)
+				}
+				report.Drift = append(report.Drift, *drift)
+			}
+
+			for _, forward := range portForwards[app.ID] {
+				if !ingresses[app.Namespace+"/"+forward.IngressName] {
+					report.Drift = append(report.Drift, Drift{
+						Kind:     DriftIngressMissing,
+						Resource: fmt.Sprintf("app/%s/port-forward/%s", app.ID, forward.Subdomain),
+						Message:  fmt.Sprintf("Ingress %s of port forward %s.%s is missing on %s", forward.IngressName, forward.Subdomain, forward.Domain, config.Name),
+					})
+				}
+			}
+		}
+
+		for _, key := range sortedReleaseKeys(releases) {
+			release := releases[key]
+			if claimed[key] || release.Namespace == "kube-system" {
+				continue
+			}
+			report.Drift = append(report.Drift, Drift{
+				Kind:     DriftReleaseUnmanaged,
+				Resource: fmt.Sprintf("vps/%d/release/%s", config.ServerID, key),
+				Message:  fmt.Sprintf("Helm release %s (%s) on %s has no application in Xanthus", key, release.Chart, config.Name),
+			})
+		}
+	}
+}
+
+// applicationDrift compares an application with its Helm release, which is nil
+// when missing. The message of the returned drift is the status to record.
+func applicationDrift(app *models.Application, release *helmRelease) *Drift {
+	switch strings.ToLower(app.Status) {
+	case "creating", "deploying", "updating", "deleting", "pending":
+		// Operations in progress settle on their own
+		return nil
+	}
+
+	resource := "app/" + app.ID
+	if release == nil {
+		if strings.EqualFold(app.Status, "Not Deployed") || strings.EqualFold(app.Status, "Failed") {
+			return nil
+		}
+		return &Drift{Kind: DriftReleaseMissing, Resource: resource, Message: "Not Deployed", Healable: true}
+	}
+
+	status := ApplicationStatusFromHelm(release.Status)
+	if strings.EqualFold(app.Status, status) {
+		return nil
+	}
+	return &Drift{Kind: DriftAppStatus, Resource: resource, Message: status, Healable: true}
+}
+
+// recordApplicationStatus stores the status an application actually has
+func (r *Reconciler) recordApplicationStatus(token, accountID string, app *models.Application, status string) error {
+	key := "app:" + app.ID
+	var current models.Application
+	if err := r.kv.GetValue(token, accountID, key, &current); err != nil {
+		return fmt.Errorf("failed to read application: %w", err)
+	}
+	if current.Status != app.Status {
+		return fmt.Errorf("application status changed to %q meanwhile", current.Status)
+	}
+
+	current.Status = status
+	if status == "Running" {
+		current.ErrorMsg = ""
+	}
+	current.UpdatedAt = time.Now().Format(time.RFC3339)
+	return r.kv.PutValue(token, accountID, key, &current)
+}
+
+// inspectCluster returns the Helm releases and the ingresses of a server's
+// cluster, keyed by namespace/name
+func (r *Reconciler) inspectCluster(config *VPSConfig, sshPrivateKey string) (map[string]*helmRelease, map[string]bool, error) {
+	conn, err := r.ssh.GetOrCreateConnection(config.SSHAddress(), config.SSHUser, sshPrivateKey, config.ServerID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	releases, err := listHelmReleases(r.ssh, conn)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result, err := r.ssh.ExecuteCommand(conn, `kubectl get ingress --all-namespaces -o jsonpath='{range .items[*]}{.metadata.namespace}/{.metadata.name}{"\n"}{end}'`)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list ingresses: %w", err)
+	}
+	ingresses := make(map[string]bool)
+	for _, line := range strings.Split(result.Output, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			ingresses[line] = true
+		}
+	}
+
+	return releases, ingresses, nil
+}
+
+// listHelmReleases returns the Helm releases of a cluster in every state, keyed by namespace/name
+func listHelmReleases(sshService *SSHService, conn *SSHConnection) (map[string]*helmRelease, error) {
+	result, err := sshService.ExecuteCommand(conn, "helm list --all-namespaces --all --output json")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list Helm releases: %w", err)
+	}
+	var list []helmRelease
+	if err := json.Unmarshal([]byte(result.Output), &list); err != nil {
+		return nil, fmt.Errorf("failed to parse Helm releases: %w", err)
+	}
+	releases := make(map[string]*helmRelease, len(list))
+	for i := range list {
+		releases[list[i].Namespace+"/"+list[i].Name] = &list[i]
+	}
+	return releases, nil
+}
+
+// checkDNS compares the A records of the managed domains with the hostnames of
+// the applications and port forwards on present servers
+func (r *Reconciler) checkDNS(token, accountID string, servers map[int]*VPSConfig, apps map[string]*models.Application, portForwards map[string][]storedPortForward, report *ReconcileReport) {
+	domainConfigs, err := r.kv.ListDomainSSLConfigs(token, accountID)
+	if err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("dns: failed to list domains: %v", err))
+		return
+	}
+
+	serverIPs := make(map[string]bool)
+	for _, config := range servers {
+		if config.PublicIPv4 != "" {
+			serverIPs[config.PublicIPv4] = true
+		}
+	}
+
+	// Hostname -> IP of the server it should point at, grouped by domain
+	expected := make(map[string]map[string]string)
+	expect := func(domain, subdomain, ip string) {
+		if expected[domain] == nil {
+			expected[domain] = make(map[string]string)
+		}
+		expected[domain][hostName(subdomain, domain)] = ip
+	}
+	for _, app := range apps {
+		serverID, err := strconv.Atoi(app.VPSID)
+		if err != nil || servers[serverID] == nil || app.Domain == "" {
+			continue
+		}
+		ip := servers[serverID].PublicIPv4
+		expect(app.Domain, app.Subdomain, ip)
+		for _, forward := range portForwards[app.ID] {
+			expect(forward.Domain, forward.Subdomain, ip)
+		}
+	}
+
+	domains := make(map[string]bool)
+	for domain := range domainConfigs {
+		domains[domain] = true
+	}
+	for domain := range expected {
+		domains[domain] = true
+	}
+	sortedDomains := make([]string, 0, len(domains))
+	for domain := range domains {
+		sortedDomains = append(sortedDomains, domain)
+	}
+	sort.Strings(sortedDomains)
+
+	for _, domain := range sortedDomains {
+		zoneID := ""
+		proxied := true
+		if config := domainConfigs[domain]; config != nil {
+			zoneID = config.ZoneID
+			proxied = !config.DNSOnly
+		}
+		if zoneID == "" {
+			if zoneID, err = r.cf.GetZoneID(token, domain); err != nil {
+				report.Errors = append(report.Errors, fmt.Sprintf("dns %s: %v", domain, err))
+				continue
+			}
+		}
+
+		records, err := r.cf.GetDNSRecords(token, zoneID)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("dns %s: %v", domain, err))
+			continue
+		}
+		report.Drift = append(report.Drift, r.dnsDrift(token, zoneID, domain, proxied, records, expected[domain], serverIPs)...)
+	}
+}
+
+// dnsDrift compares the A records of a zone with the hostnames expected in it
+func (r *Reconciler) dnsDrift(token, zoneID, domain string, proxied bool, records []DNSRecord, expected map[string]string, serverIPs map[string]bool) []Drift {
+	byHost := make(map[string][]DNSRecord)
+	for _, record := range records {
+		if record.Type == "A" {
+			host := strings.TrimSuffix(record.Name, ".")
+			byHost[host] = append(byHost[host], record)
+		}
+	}
+
+	var drifts []Drift
+	hosts := make([]string, 0, len(expected))
+	for host := range expected {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	for _, host := range hosts {
+		host, ip := host, expected[host]
+		current := byHost[host]
+		if len(current) == 0 {
+			drifts = append(drifts, Drift{
+				Kind:     DriftDNSMissing,
+				Resource: "dns/" + host,
+				Message:  fmt.Sprintf("No A record for %s, expected %s", host, ip),
+				Healable: true,
+				heal: func(ctx context.Context) error {
+					_, err := r.cf.CreateDNSRecord(token, zoneID, "A", host, ip, proxied)
+					return err
+				},
+			})
+			continue
+		}
+
+		var wrong []DNSRecord
+		for _, record := range current {
+			if record.Content != ip {
+				wrong = append(wrong, record)
+			}
+		}
+		if len(wrong) == 0 {
+			continue
+		}
+		correct := len(wrong) < len(current)
+		drifts = append(drifts, Drift{
+			Kind:     DriftDNSMismatch,
+			Resource: "dns/" + host,
+			Message:  fmt.Sprintf("A record %s points to %s, expected %s", host, wrong[0].Content, ip),
+			Healable: true,
+			heal: func(ctx context.Context) error {
+				for _, record := range wrong {
+					if err := r.cf.DeleteDNSRecord(token, zoneID, record.ID); err != nil {
+						return err
+					}
+				}
+				if correct {
+					return nil
+				}
+				_, err := r.cf.CreateDNSRecord(token, zoneID, "A", host, ip, proxied)
+				return err
+			},
+		})
+	}
+
+	// The records created for a server itself are not orphans
+	serverHosts := map[string]bool{domain: true, "*." + domain: true, "www." + domain: true}
+	orphanHosts := make([]string, 0)
+	for host := range byHost {
+		if _, ok := expected[host]; !ok && !serverHosts[host] {
+			orphanHosts = append(orphanHosts, host)
+		}
+	}
+	sort.Strings(orphanHosts)
+
+	for _, host := range orphanHosts {
+		for _, record := range byHost[host] {
+			if !serverIPs[record.Content] {
+				continue
+			}
+			record := record
+			drifts = append(drifts, Drift{
+				Kind:     DriftDNSOrphaned,
+				Resource: "dns/" + host,
+				Message:  fmt.Sprintf("A record %s points to server %s but no application uses it", host, record.Content),
+				Healable: true,
+				heal: func(ctx context.Context) error {
+					return r.cf.DeleteDNSRecord(token, zoneID, record.ID)
+				},
+			})
+		}
+	}
+	return drifts
+}
+
+// providerName returns the display name of a stored provider, which is Hetzner when empty
+func providerName(provider string) string {
+	if provider == "" {
+		return ProviderHetzner
+	}
+	return provider
+}
+
+func sortedServerIDs(configs map[int]*VPSConfig) []int {
+	ids := make([]int, 0, len(configs))
+	for id := range configs {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+func sortedAppIDs(apps map[string]*models.Application) []string {
+	ids := make([]string, 0, len(apps))
+	for id := range apps {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func sortedReleaseKeys(releases map[string]*helmRelease) []string {
+	keys := make([]string, 0, len(releases))
+	for key := range releases {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
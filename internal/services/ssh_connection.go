@@ -1,12 +1,11 @@
 package services
 
 import (
-	"crypto/x509"
-	"encoding/pem"
 	"fmt"
 	"golang.org/x/crypto/ssh"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,6 +31,28 @@ type SSHConnection struct {
 	session *ssh.Session
 }
 
+// SSHPoolStats counts the SSH connections of every SSHService of the process
+type SSHPoolStats struct {
+	Cached       int64 // Connections kept open for reuse
+	Dials        int64 // Connections established
+	DialFailures int64 // Connections that could not be established
+	Reuses       int64 // Requests served by a cached connection
+}
+
+var sshPoolStats struct {
+	cached, dials, dialFailures, reuses atomic.Int64
+}
+
+// GetSSHPoolStats returns the SSH connection counts of the process
+func GetSSHPoolStats() SSHPoolStats {
+	return SSHPoolStats{
+		Cached:       sshPoolStats.cached.Load(),
+		Dials:        sshPoolStats.dials.Load(),
+		DialFailures: sshPoolStats.dialFailures.Load(),
+		Reuses:       sshPoolStats.reuses.Load(),
+	}
+}
+
 // NewSSHService creates a new SSH service instance
 func NewSSHService() *SSHService {
 	service := &SSHService{
@@ -67,10 +88,12 @@ func (ss *SSHService) GetOrCreateConnection(host, user, privateKeyPEM string, se
 		// Test if the connection is still alive
 		if ss.isConnectionAlive(cached.conn) {
 			cached.lastUsed = time.Now()
+			sshPoolStats.reuses.Add(1)
 			return cached.conn, nil
 		} else {
 			// Connection is dead, remove it
 			delete(ss.connections, connectionKey)
+			sshPoolStats.cached.Add(-1)
 		}
 	}
 
@@ -88,6 +111,7 @@ func (ss *SSHService) GetOrCreateConnection(host, user, privateKeyPEM string, se
 		host:     host,
 		user:     user,
 	}
+	sshPoolStats.cached.Add(1)
 
 	return conn, nil
 }
@@ -122,6 +146,7 @@ func (ss *SSHService) cleanupStaleConnections() {
 					cached.conn.Close()
 				}
 				delete(ss.connections, key)
+				sshPoolStats.cached.Add(-1)
 			}
 		}
 		ss.mutex.Unlock()
@@ -138,6 +163,7 @@ func (ss *SSHService) CloseAllConnections() {
 			cached.conn.Close()
 		}
 		delete(ss.connections, key)
+		sshPoolStats.cached.Add(-1)
 	}
 }
 
@@ -146,48 +172,55 @@ func (ss *SSHService) ConnectToVPS(host, user, privateKeyPEM string) (*SSHConnec
 	return ss.connectToVPS(host, user, privateKeyPEM)
 }
 
+// ConnectWithPassword establishes an SSH connection using password authentication. It is
+// only used to install the Xanthus key on servers added by hand that don't trust it yet.
+func (ss *SSHService) ConnectWithPassword(host, user, password string) (*SSHConnection, error) {
+	return ss.dial(host, user, ssh.Password(password))
+}
+
 // connectToVPS is the internal method that actually establishes SSH connections
 func (ss *SSHService) connectToVPS(host, user, privateKeyPEM string) (*SSHConnection, error) {
-	// Parse the private key
-	block, _ := pem.Decode([]byte(privateKeyPEM))
-	if block == nil {
-		return nil, fmt.Errorf("failed to parse PEM block containing the private key")
-	}
-
-	// Parse the private key
-	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	// Parse the private key, an OpenSSH ed25519 key or a legacy PKCS#8 RSA key
+	signer, err := ssh.ParsePrivateKey([]byte(privateKeyPEM))
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse private key: %w", err)
 	}
 
-	// Create SSH signer
-	signer, err := ssh.NewSignerFromKey(privateKey)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create SSH signer: %w", err)
-	}
+	return ss.dial(host, user, ssh.PublicKeys(signer))
+}
 
+// dial connects to host, which may carry a port ("203.0.113.7:2222"); port 22 is used otherwise
+func (ss *SSHService) dial(host, user string, auth ssh.AuthMethod) (*SSHConnection, error) {
 	// SSH client configuration
 	config := &ssh.ClientConfig{
-		User: user,
-		Auth: []ssh.AuthMethod{
-			ssh.PublicKeys(signer),
-		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // For now, we'll accept any host key
+		User:            user,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: GetKnownHosts().HostKeyCallback(),
 		Timeout:         ss.timeout,
 	}
 
 	// Connect to the SSH server
-	address := net.JoinHostPort(host, "22")
+	address := sshAddress(host)
 	client, err := ssh.Dial("tcp", address, config)
 	if err != nil {
+		sshPoolStats.dialFailures.Add(1)
 		return nil, fmt.Errorf("failed to connect to %s: %w", address, err)
 	}
+	sshPoolStats.dials.Add(1)
 
 	return &SSHConnection{
 		client: client,
 	}, nil
 }
 
+// sshAddress returns host:port for host, defaulting to port 22
+func sshAddress(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, "22")
+}
+
 // Close closes the SSH connection
 func (conn *SSHConnection) Close() error {
 	if conn.session != nil {
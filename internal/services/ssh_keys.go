@@ -0,0 +1,393 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// sshKeyPairKey is the state key of the account's SSH keypair
+const sshKeyPairKey = "config:ssh:keypair"
+
+// sshKeyComment is the comment of the public key in authorized_keys
+const sshKeyComment = "xanthus"
+
+// sshKeyMu serialises key generation and rotation, so concurrent requests
+// never generate two keys for the same account
+var sshKeyMu sync.Mutex
+
+// legacySSHKeyWarned records the accounts already warned about using the CSR key for SSH
+var legacySSHKeyWarned sync.Map
+
+// SSHKeyPair is the SSH keypair Xanthus uses to reach an account's servers
+type SSHKeyPair struct {
+	PrivateKey  string `json:"-"` // OpenSSH PEM
+	PublicKey   string `json:"public_key"`
+	Fingerprint string `json:"fingerprint"`
+	CreatedAt   string `json:"created_at,omitempty"`
+	// Legacy is set when the servers still trust the key derived from the
+	// TLS CSR private key; rotating replaces it with a dedicated key
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// storedSSHKeyPair is the stored form of SSHKeyPair, with the private key
+// encrypted like every other secret
+type storedSSHKeyPair struct {
+	EncryptedPrivateKey string `json:"encrypted_private_key"`
+	PublicKey           string `json:"public_key"`
+	Fingerprint         string `json:"fingerprint"`
+	CreatedAt           string `json:"created_at"`
+}
+
+// SSHKeyRotationResult describes a completed SSH key rotation
+type SSHKeyRotationResult struct {
+	Fingerprint    string   `json:"fingerprint"`
+	OldFingerprint string   `json:"old_fingerprint"`
+	Servers        []string `json:"servers"`
+	Warnings       []string `json:"warnings,omitempty"`
+}
+
+// SSHKeyService manages the dedicated ed25519 SSH keypair of an account. The
+// key is separate from the TLS CSR private key, so neither one grants the
+// access of the other.
+type SSHKeyService struct {
+	kv      *KVService
+	keyring *utils.Keyring // nil for the process-wide keyring, loaded on first use
+}
+
+// NewSSHKeyService creates an SSH key service for the process-wide state store and keyring
+func NewSSHKeyService() *SSHKeyService {
+	return NewSSHKeyServiceWithStore(utils.GetStateStore(), nil)
+}
+
+// NewSSHKeyServiceWithStore creates an SSH key service for the given store and keyring;
+// a nil keyring stands for the process-wide one
+func NewSSHKeyServiceWithStore(store utils.StateStore, keyring *utils.Keyring) *SSHKeyService {
+	return &SSHKeyService{kv: NewKVServiceWithStore(store), keyring: keyring}
+}
+
+func (s *SSHKeyService) ring() *utils.Keyring {
+	if s.keyring == nil {
+		return utils.GetKeyring()
+	}
+	return s.keyring
+}
+
+// KeyPair returns the account's SSH keypair. An account without servers gets
+// a new ed25519 key on first use. An account whose servers were created
+// before dedicated keys existed keeps using the key derived from the CSR
+// until RotateKey moves its servers to a dedicated one.
+func (s *SSHKeyService) KeyPair(token, accountID string) (*SSHKeyPair, error) {
+	sshKeyMu.Lock()
+	defer sshKeyMu.Unlock()
+	return s.keyPair(token, accountID)
+}
+
+// PrivateKey returns the account's SSH private key in PEM format
+func (s *SSHKeyService) PrivateKey(token, accountID string) (string, error) {
+	pair, err := s.KeyPair(token, accountID)
+	if err != nil {
+		return "", err
+	}
+	return pair.PrivateKey, nil
+}
+
+// PublicKey returns the account's SSH public key in authorized_keys format
+func (s *SSHKeyService) PublicKey(token, accountID string) (string, error) {
+	pair, err := s.KeyPair(token, accountID)
+	if err != nil {
+		return "", err
+	}
+	return pair.PublicKey, nil
+}
+
+func (s *SSHKeyService) keyPair(token, accountID string) (*SSHKeyPair, error) {
+	pair, err := s.load(token, accountID)
+	if err == nil {
+		return pair, nil
+	}
+	if !errors.Is(err, utils.ErrKeyNotFound) {
+		return nil, err
+	}
+
+	hasServers, err := s.hasServers(token, accountID)
+	if err != nil {
+		return nil, err
+	}
+	if hasServers {
+		return s.legacyKeyPair(token, accountID)
+	}
+
+	pair, err = GenerateSSHKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.save(token, accountID, pair); err != nil {
+		return nil, err
+	}
+	log.Printf("🔑 Generated SSH key %s for account %s", pair.Fingerprint, accountID)
+	return pair, nil
+}
+
+// load reads and decrypts the stored keypair
+func (s *SSHKeyService) load(token, accountID string) (*SSHKeyPair, error) {
+	var stored storedSSHKeyPair
+	if err := s.kv.GetValue(token, accountID, sshKeyPairKey, &stored); err != nil {
+		return nil, err
+	}
+	privateKey, err := s.ring().Decrypt(token, accountID, stored.EncryptedPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SSH private key: %w", err)
+	}
+	return &SSHKeyPair{
+		PrivateKey:  privateKey,
+		PublicKey:   stored.PublicKey,
+		Fingerprint: stored.Fingerprint,
+		CreatedAt:   stored.CreatedAt,
+	}, nil
+}
+
+// save encrypts and stores pair as the account's keypair
+func (s *SSHKeyService) save(token, accountID string, pair *SSHKeyPair) error {
+	encrypted, err := s.ring().Encrypt(token, accountID, pair.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt SSH private key: %w", err)
+	}
+	stored := storedSSHKeyPair{
+		EncryptedPrivateKey: encrypted,
+		PublicKey:           pair.PublicKey,
+		Fingerprint:         pair.Fingerprint,
+		CreatedAt:           pair.CreatedAt,
+	}
+	if err := s.kv.PutValue(token, accountID, sshKeyPairKey, stored); err != nil {
+		return fmt.Errorf("failed to store SSH key: %w", err)
+	}
+	return nil
+}
+
+// hasServers reports whether the account manages any server
+func (s *SSHKeyService) hasServers(token, accountID string) (bool, error) {
+	keys, err := s.kv.ListKeys(token, accountID, "vps:")
+	if err != nil {
+		return false, fmt.Errorf("failed to list servers: %w", err)
+	}
+	for _, key := range keys {
+		if strings.HasSuffix(key, ":config") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// legacyKeyPair returns the keypair derived from the CSR private key
+func (s *SSHKeyService) legacyKeyPair(token, accountID string) (*SSHKeyPair, error) {
+	var csrConfig CSRConfig
+	if err := s.kv.GetValue(token, accountID, "config:ssl:csr", &csrConfig); err != nil {
+		return nil, fmt.Errorf("SSH key not found: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(csrConfig.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CSR private key: %w", err)
+	}
+	if _, warned := legacySSHKeyWarned.LoadOrStore(accountID, true); !warned {
+		log.Printf("Warning: Account %s still uses the CSR private key for SSH, rotate the SSH key to give its servers a dedicated key", accountID)
+	}
+	return &SSHKeyPair{
+		PrivateKey:  csrConfig.PrivateKey,
+		PublicKey:   marshalHostKey(signer.PublicKey()),
+		Fingerprint: ssh.FingerprintSHA256(signer.PublicKey()),
+		CreatedAt:   csrConfig.CreatedAt,
+		Legacy:      true,
+	}, nil
+}
+
+// GenerateSSHKeyPair creates a new ed25519 keypair
+func GenerateSSHKeyPair() (*SSHKeyPair, error) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate SSH key: %w", err)
+	}
+	block, err := ssh.MarshalPrivateKey(private, sshKeyComment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SSH private key: %w", err)
+	}
+	publicKey, err := ssh.NewPublicKey(public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode SSH public key: %w", err)
+	}
+	return &SSHKeyPair{
+		PrivateKey:  string(pem.EncodeToMemory(block)),
+		PublicKey:   marshalHostKey(publicKey) + " " + sshKeyComment,
+		Fingerprint: ssh.FingerprintSHA256(publicKey),
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// RotateKey replaces the account's SSH key with a new ed25519 key. The new
+// public key is installed on every server and checked by logging in with it
+// before anything else changes; if any server refuses it, the key is removed
+// again from the servers that got it and the old key stays in use. Once every
+// server accepts the new key it becomes current, is registered with the
+// cloud providers in place of the old one, and the old key is removed from
+// every server's authorized_keys. Problems in these last steps are reported
+// as warnings, since the new key already works everywhere.
+func (s *SSHKeyService) RotateKey(ctx context.Context, token, accountID string) (*SSHKeyRotationResult, error) {
+	sshKeyMu.Lock()
+	defer sshKeyMu.Unlock()
+
+	current, err := s.keyPair(token, accountID)
+	if err != nil {
+		return nil, err
+	}
+	next, err := GenerateSSHKeyPair()
+	if err != nil {
+		return nil, err
+	}
+
+	configs, err := s.kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	servers := make([]*VPSConfig, 0, len(configs))
+	for _, config := range configs {
+		servers = append(servers, config)
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].ServerID < servers[j].ServerID })
+
+	result := &SSHKeyRotationResult{
+		Fingerprint:    next.Fingerprint,
+		OldFingerprint: current.Fingerprint,
+		Servers:        []string{},
+	}
+
+	// Install the new key everywhere, or nowhere
+	sshService := NewSSHService()
+	var installed []*VPSConfig
+	for _, config := range servers {
+		if err := installSSHKey(sshService, config, current, next); err != nil {
+			rollbackSSHKey(sshService, installed, current, next)
+			return nil, fmt.Errorf("failed to install the new SSH key on %s, the old key remains in use: %w", config.Name, err)
+		}
+		installed = append(installed, config)
+		result.Servers = append(result.Servers, config.Name)
+	}
+
+	if err := s.save(token, accountID, next); err != nil {
+		rollbackSSHKey(sshService, installed, current, next)
+		return nil, err
+	}
+	log.Printf("🔑 Rotated SSH key of account %s from %s to %s (%d servers)", accountID, current.Fingerprint, next.Fingerprint, len(servers))
+
+	warn := func(format string, args ...interface{}) {
+		message := fmt.Sprintf(format, args...)
+		log.Printf("Warning: %s", message)
+		result.Warnings = append(result.Warnings, message)
+	}
+
+	// Swap the key registered with each provider that has servers
+	byProvider := make(map[string][]*VPSConfig)
+	for _, config := range servers {
+		byProvider[config.Provider] = append(byProvider[config.Provider], config)
+	}
+	for provider, providerServers := range byProvider {
+		cp, err := NewCloudProvider(provider, token, accountID)
+		if err != nil {
+			warn("could not update the SSH key registered with %s: %v", provider, err)
+			continue
+		}
+		keyName, err := cp.RegisterSSHKey(ctx, fmt.Sprintf("xanthus-key-%d", time.Now().Unix()), next.PublicKey)
+		if err != nil {
+			warn("failed to register the new SSH key with %s: %v", cp.Name(), err)
+			continue
+		}
+		if err := cp.UnregisterSSHKey(ctx, current.PublicKey); err != nil {
+			warn("failed to remove the old SSH key from %s: %v", cp.Name(), err)
+		}
+		for _, config := range providerServers {
+			if config.SSHKeyName == keyName {
+				continue
+			}
+			config.SSHKeyName = keyName
+			if err := s.kv.StoreVPSConfig(token, accountID, config); err != nil {
+				warn("failed to record the SSH key name of %s: %v", config.Name, err)
+			}
+		}
+	}
+
+	// Retire the old key on every server
+	for _, config := range servers {
+		conn, err := sshService.ConnectToVPS(config.SSHAddress(), config.SSHUser, next.PrivateKey)
+		if err != nil {
+			warn("failed to connect to %s to remove the old SSH key: %v", config.Name, err)
+			continue
+		}
+		err = removeAuthorizedKey(sshService, conn, current.PublicKey)
+		conn.Close()
+		if err != nil {
+			warn("failed to remove the old SSH key from %s: %v", config.Name, err)
+		}
+	}
+
+	return result, nil
+}
+
+// installSSHKey adds next to the authorized keys of a server using current, then
+// checks that next can log in
+func installSSHKey(sshService *SSHService, config *VPSConfig, current, next *SSHKeyPair) error {
+	conn, err := sshService.ConnectToVPS(config.SSHAddress(), config.SSHUser, current.PrivateKey)
+	if err != nil {
+		return err
+	}
+	err = installAuthorizedKey(sshService, conn, next.PublicKey)
+	conn.Close()
+	if err != nil {
+		return err
+	}
+
+	conn, err = sshService.ConnectToVPS(config.SSHAddress(), config.SSHUser, next.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("the new key was installed but cannot log in: %w", err)
+	}
+	return conn.Close()
+}
+
+// rollbackSSHKey removes next from the servers it was installed on
+func rollbackSSHKey(sshService *SSHService, installed []*VPSConfig, current, next *SSHKeyPair) {
+	for _, config := range installed {
+		conn, err := sshService.ConnectToVPS(config.SSHAddress(), config.SSHUser, current.PrivateKey)
+		if err == nil {
+			err = removeAuthorizedKey(sshService, conn, next.PublicKey)
+			conn.Close()
+		}
+		if err != nil {
+			log.Printf("Warning: Failed to remove the unused SSH key %s from %s: %v", next.Fingerprint, config.Name, err)
+		}
+	}
+}
+
+// removeAuthorizedKey deletes every authorized_keys line carrying publicKey,
+// whatever its options or comment
+func removeAuthorizedKey(sshService *SSHService, conn *SSHConnection, publicKey string) error {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid public key")
+	}
+	command := fmt.Sprintf("f=~/.ssh/authorized_keys; [ -f \"$f\" ] || exit 0; "+
+		"{ grep -vF %s \"$f\" || true; } > \"$f.xanthus\" && cat \"$f.xanthus\" > \"$f\"; rm -f \"$f.xanthus\"", shellQuote(fields[1]))
+	if _, err := sshService.ExecuteCommand(conn, command); err != nil {
+		return fmt.Errorf("failed to remove SSH key: %w", err)
+	}
+	return nil
+}
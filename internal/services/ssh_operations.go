@@ -1,10 +1,14 @@
 package services
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"golang.org/x/crypto/ssh"
+	"io"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -66,6 +70,69 @@ func (ss *SSHService) ExecuteCommand(conn *SSHConnection, command string) (*Comm
 	return result, nil
 }
 
+// ExecuteCommandStream executes a command on the VPS, copying its combined
+// output to out as it is produced. Cancelling ctx closes the session.
+func (ss *SSHService) ExecuteCommandStream(ctx context.Context, conn *SSHConnection, command string, out io.Writer) (*CommandResult, error) {
+	start := time.Now()
+
+	session, err := conn.client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+	}
+	defer session.Close()
+
+	// stdout and stderr are copied concurrently
+	var output bytes.Buffer
+	writer := &lockedWriter{w: io.MultiWriter(&output, out)}
+	session.Stdout = writer
+	session.Stderr = writer
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Close()
+		case <-done:
+		}
+	}()
+
+	err = session.Run(command)
+	result := &CommandResult{
+		Command:  command,
+		Output:   strings.TrimSpace(output.String()),
+		Duration: time.Since(start).String(),
+	}
+
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		result.Error = ctxErr.Error()
+		result.ExitCode = -1
+		return result, ctxErr
+	}
+	if err != nil {
+		result.Error = err.Error()
+		if exitError, ok := err.(*ssh.ExitError); ok {
+			result.ExitCode = exitError.ExitStatus()
+		} else {
+			result.ExitCode = -1
+		}
+		return result, fmt.Errorf("command failed: %s", err.Error())
+	}
+
+	return result, nil
+}
+
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
 // CheckVPSHealth performs comprehensive health checks on a VPS
 func (ss *SSHService) CheckVPSHealth(host, user, privateKeyPEM string, serverID int) (*VPSStatus, error) {
 	status := &VPSStatus{
@@ -107,6 +174,8 @@ func (ss *SSHService) CheckVPSHealth(host, user, privateKeyPEM string, serverID
 			status.SetupMessage = "Verifying all components..."
 		case "READY":
 			status.SetupMessage = "Server is ready! All components installed and verified."
+		case "FAILED":
+			status.SetupMessage = "Setup failed, see " + manualBootstrapLog + " on the server"
 		case "UNKNOWN":
 			status.SetupMessage = "Setup status unknown (server may still be initializing)"
 		default:
@@ -117,8 +186,8 @@ func (ss *SSHService) CheckVPSHealth(host, user, privateKeyPEM string, serverID
 		status.SetupMessage = "Cannot determine setup status"
 	}
 
-	// Check K3s status
-	if result, err := ss.ExecuteCommand(conn, "systemctl is-active k3s"); err == nil {
+	// Check K3s status, of the agent service on agent nodes
+	if result, err := ss.ExecuteCommand(conn, "systemctl is-active k3s-agent >/dev/null 2>&1 && echo active || systemctl is-active k3s"); err == nil {
 		status.K3sStatus = strings.TrimSpace(result.Output)
 	} else {
 		status.K3sStatus = "unknown"
@@ -140,7 +209,7 @@ func (ss *SSHService) CheckVPSHealth(host, user, privateKeyPEM string, serverID
 		else if ($1 == "SwapFree:") swap_free = $2
 	}
 	END {
-		mem_used = mem_total - mem_free
+		mem_used = mem_total - mem_available
 		buff_cache = buffers + cached
 		swap_used = swap_total - swap_free
 		
@@ -239,7 +308,7 @@ func (ss *SSHService) DeployManifest(conn *SSHConnection, manifest, name string)
 
 // GetK3sLogs retrieves K3s service logs
 func (ss *SSHService) GetK3sLogs(conn *SSHConnection, lines int) (string, error) {
-	command := fmt.Sprintf("journalctl -u k3s -n %d --no-pager", lines)
+	command := fmt.Sprintf("journalctl -u k3s -u k3s-agent -n %d --no-pager", lines)
 	result, err := ss.ExecuteCommand(conn, command)
 	if err != nil {
 		return "", fmt.Errorf("failed to get K3s logs: %w", err)
@@ -404,3 +473,18 @@ func (ss *SSHService) GetVPSInfo(conn *SSHConnection) (string, error) {
 
 	return result.Output, nil
 }
+
+// GetK3sVersion returns the version of the K3s installed on the VPS, like v1.31.2+k3s1
+func (ss *SSHService) GetK3sVersion(conn *SSHConnection) (string, error) {
+	result, err := ss.ExecuteCommand(conn, "k3s --version")
+	if err != nil {
+		return "", fmt.Errorf("failed to get K3s version: %w", err)
+	}
+
+	// k3s version v1.31.2+k3s1 (6da20424)
+	fields := strings.Fields(result.Output)
+	if len(fields) < 3 || fields[1] != "version" {
+		return "", fmt.Errorf("unexpected K3s version output: %s", lastLine(result.Output))
+	}
+	return fields[2], nil
+}
@@ -0,0 +1,611 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// Stack change actions
+const (
+	StackActionCreate = "create"
+	StackActionUpdate = "update"
+	StackActionDelete = "delete"
+	// StackActionBlocked marks a difference apply can't converge, e.g. a server
+	// that would have to be replaced. Plans with blocked changes aren't applied.
+	StackActionBlocked = "blocked"
+)
+
+// Kinds of resources in a stack
+const (
+	StackKindServer      = "server"
+	StackKindDomain      = "domain"
+	StackKindApplication = "application"
+)
+
+// ErrStackBlocked is returned by Apply when the plan has blocked changes
+var ErrStackBlocked = errors.New("the plan has changes that can't be applied")
+
+// Stack describes an environment: its servers, domains and applications
+type Stack struct {
+	Name         string             `yaml:"name" json:"name"`
+	Servers      []StackServer      `yaml:"servers" json:"servers"`
+	Domains      []StackDomain      `yaml:"domains" json:"domains"`
+	Applications []StackApplication `yaml:"applications" json:"applications"`
+}
+
+// StackServer is a server of a stack, identified by its name
+type StackServer struct {
+	Name     string  `yaml:"name" json:"name"`
+	Provider string  `yaml:"provider,omitempty" json:"provider,omitempty"` // Hetzner when empty
+	Location string  `yaml:"location" json:"location"`
+	Type     string  `yaml:"type" json:"type"`
+	Timezone string  `yaml:"timezone,omitempty" json:"timezone,omitempty"`
+	CPUs     float32 `yaml:"cpus,omitempty" json:"cpus,omitempty"`           // flexible shapes only
+	MemoryGB float32 `yaml:"memory_gb,omitempty" json:"memory_gb,omitempty"` // flexible shapes only
+}
+
+// StackDomain is a Cloudflare domain managed by a stack
+type StackDomain struct {
+	Domain  string `yaml:"domain" json:"domain"`
+	Issuer  string `yaml:"issuer,omitempty" json:"issuer,omitempty"` // IssuerCloudflareOrigin when empty
+	DNSOnly bool   `yaml:"dns_only,omitempty" json:"dns_only,omitempty"`
+}
+
+// StackApplication is an application of a stack, identified by its hostname
+type StackApplication struct {
+	Type        string                 `yaml:"type" json:"type"`
+	Subdomain   string                 `yaml:"subdomain" json:"subdomain"`
+	Domain      string                 `yaml:"domain" json:"domain"`
+	Server      string                 `yaml:"server" json:"server"`                       // name of a server of the stack
+	Version     string                 `yaml:"version,omitempty" json:"version,omitempty"` // the catalog version when empty
+	Description string                 `yaml:"description,omitempty" json:"description,omitempty"`
+	Values      map[string]interface{} `yaml:"values,omitempty" json:"values,omitempty"` // Helm values overriding the catalog defaults
+}
+
+// Host returns the hostname the application is served on
+func (a *StackApplication) Host() string {
+	return a.Subdomain + "." + a.Domain
+}
+
+// StackChange is one step of a stack plan
+type StackChange struct {
+	Action  string   `json:"action" enum:"create,update,delete,blocked"`
+	Kind    string   `json:"kind" enum:"server,domain,application"`
+	Name    string   `json:"name"`
+	Details []string `json:"details,omitempty"`
+	Applied bool     `json:"applied,omitempty"`
+	Error   string   `json:"error,omitempty"`
+
+	server *StackServer
+	domain *StackDomain
+	app    *StackApplication
+	id     string // ID of the existing server or application
+}
+
+// StackPlan lists the changes that converge the current state to a stack
+type StackPlan struct {
+	Stack   string        `json:"stack"`
+	Prune   bool          `json:"prune"`
+	Changes []StackChange `json:"changes"`
+}
+
+// Blocked reports whether the plan has changes apply can't make
+func (p *StackPlan) Blocked() bool {
+	for _, change := range p.Changes {
+		if change.Action == StackActionBlocked {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseStack decodes and validates a stack file
+func ParseStack(data []byte) (*Stack, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	var stack Stack
+	if err := decoder.Decode(&stack); err != nil {
+		return nil, fmt.Errorf("invalid stack file: %w", err)
+	}
+	if err := stack.Validate(); err != nil {
+		return nil, err
+	}
+	return &stack, nil
+}
+
+// Validate checks that a stack is complete and consistent
+func (s *Stack) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return errors.New("stack name is required")
+	}
+
+	servers := make(map[string]bool)
+	for _, server := range s.Servers {
+		if server.Name == "" || server.Location == "" || server.Type == "" {
+			return fmt.Errorf("server %q needs a name, location and type", server.Name)
+		}
+		if servers[server.Name] {
+			return fmt.Errorf("server %s is listed twice", server.Name)
+		}
+		if server.Provider != "" {
+			if _, ok := CanonicalProviderName(server.Provider); !ok {
+				return fmt.Errorf("server %s: unsupported provider %s", server.Name, server.Provider)
+			}
+		}
+		servers[server.Name] = true
+	}
+
+	domains := make(map[string]bool)
+	for _, domain := range s.Domains {
+		if domain.Domain == "" {
+			return errors.New("domains need a domain name")
+		}
+		if domains[domain.Domain] {
+			return fmt.Errorf("domain %s is listed twice", domain.Domain)
+		}
+		switch domain.Issuer {
+		case "", IssuerCloudflareOrigin, IssuerACME:
+		default:
+			return fmt.Errorf("domain %s: unknown issuer %s", domain.Domain, domain.Issuer)
+		}
+		domains[domain.Domain] = true
+	}
+
+	hosts := make(map[string]bool)
+	for _, app := range s.Applications {
+		if app.Type == "" || app.Subdomain == "" || app.Domain == "" || app.Server == "" {
+			return fmt.Errorf("application %q needs a type, subdomain, domain and server", app.Subdomain)
+		}
+		if hosts[app.Host()] {
+			return fmt.Errorf("application %s is listed twice", app.Host())
+		}
+		if !servers[app.Server] {
+			return fmt.Errorf("application %s: server %s is not part of the stack", app.Host(), app.Server)
+		}
+		if !domains[app.Domain] {
+			return fmt.Errorf("application %s: domain %s is not part of the stack", app.Host(), app.Domain)
+		}
+		hosts[app.Host()] = true
+	}
+	return nil
+}
+
+// StackService plans and applies stacks against the servers, domains and
+// applications stored in the state store
+type StackService struct {
+	kv      *KVService
+	catalog ApplicationCatalog
+}
+
+// NewStackService creates a stack service for the process-wide state store
+func NewStackService(catalog ApplicationCatalog) *StackService {
+	return NewStackServiceWithStore(utils.GetStateStore(), catalog)
+}
+
+// NewStackServiceWithStore creates a stack service for the given store
+func NewStackServiceWithStore(store utils.StateStore, catalog ApplicationCatalog) *StackService {
+	return &StackService{kv: NewKVServiceWithStore(store), catalog: catalog}
+}
+
+// stackState is the current state a stack is compared with
+type stackState struct {
+	servers map[string]*VPSConfig          // by name
+	domains map[string]*DomainSSLConfig    // by domain
+	apps    map[string]*models.Application // by hostname
+}
+
+func (s *StackService) state(token, accountID string) (*stackState, error) {
+	configs, err := s.kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	domains, err := s.kv.ListDomainSSLConfigs(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domains: %w", err)
+	}
+	keys, err := s.kv.ListKeys(token, accountID, "app:")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list applications: %w", err)
+	}
+
+	state := &stackState{
+		servers: make(map[string]*VPSConfig),
+		domains: domains,
+		apps:    make(map[string]*models.Application),
+	}
+	for _, config := range configs {
+		state.servers[config.Name] = config
+	}
+	for _, key := range keys {
+		if strings.Count(key, ":") != 1 {
+			continue
+		}
+		var app models.Application
+		if err := s.kv.GetValue(token, accountID, key, &app); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", key, err)
+		}
+		state.apps[app.Subdomain+"."+app.Domain] = &app
+	}
+	return state, nil
+}
+
+// Plan compares a stack with the account's current state. With prune, servers,
+// domains and applications missing from the stack are deleted.
+func (s *StackService) Plan(token, accountID string, stack *Stack, prune bool) (*StackPlan, error) {
+	state, err := s.state(token, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &StackPlan{Stack: stack.Name, Prune: prune, Changes: []StackChange{}}
+
+	for i := range stack.Domains {
+		want := &stack.Domains[i]
+		current := state.domains[want.Domain]
+		if current == nil {
+			plan.Changes = append(plan.Changes, StackChange{Action: StackActionCreate, Kind: StackKindDomain, Name: want.Domain, Details: domainDetails(want), domain: want})
+			continue
+		}
+		if details := domainDifferences(want, current); len(details) > 0 {
+			plan.Changes = append(plan.Changes, StackChange{Action: StackActionBlocked, Kind: StackKindDomain, Name: want.Domain, Details: append(details, "remove the domain to change how it is configured")})
+		}
+	}
+
+	for i := range stack.Servers {
+		want := &stack.Servers[i]
+		current := state.servers[want.Name]
+		if current == nil {
+			change := StackChange{Action: StackActionCreate, Kind: StackKindServer, Name: want.Name, Details: serverDetails(want), server: want}
+			if canonical, _ := CanonicalProviderName(want.Provider); canonical == ProviderManual {
+				change.Action = StackActionBlocked
+				change.Details = append(change.Details, "existing servers must be added over SSH first")
+			}
+			plan.Changes = append(plan.Changes, change)
+			continue
+		}
+		if details := serverDifferences(want, current); len(details) > 0 {
+			plan.Changes = append(plan.Changes, StackChange{Action: StackActionBlocked, Kind: StackKindServer, Name: want.Name, Details: append(details, "servers are not replaced, delete the server to recreate it")})
+		}
+	}
+
+	for i := range stack.Applications {
+		want := &stack.Applications[i]
+		if s.catalog != nil {
+			if _, ok := s.catalog.GetApplicationByID(want.Type); !ok {
+				plan.Changes = append(plan.Changes, StackChange{Action: StackActionBlocked, Kind: StackKindApplication, Name: want.Host(), Details: []string{"unknown application type " + want.Type}})
+				continue
+			}
+		}
+
+		current := state.apps[want.Host()]
+		if current == nil {
+			plan.Changes = append(plan.Changes, StackChange{Action: StackActionCreate, Kind: StackKindApplication, Name: want.Host(), Details: applicationDetails(want), app: want})
+			continue
+		}
+
+		server := state.servers[want.Server]
+		if current.AppType != want.Type || server == nil || current.VPSID != strconv.Itoa(server.ServerID) {
+			plan.Changes = append(plan.Changes, StackChange{
+				Action:  StackActionBlocked,
+				Kind:    StackKindApplication,
+				Name:    want.Host(),
+				Details: []string{fmt.Sprintf("%s on %s is to become %s on %s", current.AppType, current.VPSName, want.Type, want.Server), "delete the application to move or retype it"},
+			})
+			continue
+		}
+		details, err := applicationDifferences(want, current)
+		if err != nil {
+			return nil, err
+		}
+		if len(details) > 0 {
+			plan.Changes = append(plan.Changes, StackChange{Action: StackActionUpdate, Kind: StackKindApplication, Name: want.Host(), Details: details, app: want, id: current.ID})
+		}
+	}
+
+	if prune {
+		plan.Changes = append(plan.Changes, pruneChanges(stack, state)...)
+	}
+	return plan, nil
+}
+
+// pruneChanges deletes applications, then servers, then domains missing from the stack
+func pruneChanges(stack *Stack, state *stackState) []StackChange {
+	var changes []StackChange
+
+	hosts := make(map[string]bool)
+	for _, app := range stack.Applications {
+		hosts[app.Host()] = true
+	}
+	for _, host := range sortedKeys(state.apps) {
+		if !hosts[host] {
+			changes = append(changes, StackChange{Action: StackActionDelete, Kind: StackKindApplication, Name: host, id: state.apps[host].ID})
+		}
+	}
+
+	servers := make(map[string]bool)
+	for _, server := range stack.Servers {
+		servers[server.Name] = true
+	}
+	for _, name := range sortedKeys(state.servers) {
+		if !servers[name] {
+			changes = append(changes, StackChange{Action: StackActionDelete, Kind: StackKindServer, Name: name, id: strconv.Itoa(state.servers[name].ServerID)})
+		}
+	}
+
+	domains := make(map[string]bool)
+	for _, domain := range stack.Domains {
+		domains[domain.Domain] = true
+	}
+	for _, domain := range sortedKeys(state.domains) {
+		if !domains[domain] {
+			changes = append(changes, StackChange{Action: StackActionDelete, Kind: StackKindDomain, Name: domain})
+		}
+	}
+	return changes
+}
+
+// Apply converges the account's state to a stack by making the changes of its
+// plan in order. It stops at the first failed change; the returned plan
+// records which changes were applied.
+func (s *StackService) Apply(ctx context.Context, token, accountID string, stack *Stack, prune bool) (*StackPlan, error) {
+	plan, err := s.Plan(token, accountID, stack, prune)
+	if err != nil {
+		return nil, err
+	}
+	if plan.Blocked() {
+		return plan, ErrStackBlocked
+	}
+
+	// Applications refer to servers by name, including servers created here
+	serverIDs := make(map[string]string)
+	configs, err := s.kv.ListVPSConfigs(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list servers: %w", err)
+	}
+	for _, config := range configs {
+		serverIDs[config.Name] = strconv.Itoa(config.ServerID)
+	}
+
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+		if err := StartJobStep(ctx, fmt.Sprintf("%s%s %s %s", strings.ToUpper(change.Action[:1]), change.Action[1:], change.Kind, change.Name)); err != nil {
+			return plan, err
+		}
+		if err := s.applyChange(ctx, token, accountID, change, serverIDs); err != nil {
+			change.Error = err.Error()
+			return plan, fmt.Errorf("failed to %s %s %s: %w", change.Action, change.Kind, change.Name, err)
+		}
+		change.Applied = true
+	}
+	return plan, nil
+}
+
+func (s *StackService) applyChange(ctx context.Context, token, accountID string, change *StackChange, serverIDs map[string]string) error {
+	switch {
+	case change.Kind == StackKindDomain && change.Action == StackActionCreate:
+		_, err := NewCloudflareService().ConfigureDomain(ctx, s.kv, token, accountID, change.domain.Domain, change.domain.Issuer, change.domain.DNSOnly)
+		return err
+
+	case change.Kind == StackKindDomain && change.Action == StackActionDelete:
+		config, err := s.kv.GetDomainSSLConfig(token, accountID, change.Name)
+		if err != nil {
+			return err
+		}
+		if err := NewCloudflareService().RemoveDomainFromXanthus(token, change.Name, config); err != nil {
+			return err
+		}
+		return s.kv.DeleteDomainSSLConfig(token, accountID, change.Name)
+
+	case change.Kind == StackKindServer && change.Action == StackActionCreate:
+		want := change.server
+		_, config, err := NewVPSService().CreateServer(ctx, token, accountID, want.Provider, CloudServerRequest{
+			Name:       want.Name,
+			ServerType: want.Type,
+			Location:   want.Location,
+			Timezone:   want.Timezone,
+			CPUs:       want.CPUs,
+			MemoryGB:   want.MemoryGB,
+		})
+		if err != nil {
+			return err
+		}
+		serverIDs[want.Name] = strconv.Itoa(config.ServerID)
+		return nil
+
+	case change.Kind == StackKindServer && change.Action == StackActionDelete:
+		serverID, err := strconv.Atoi(change.id)
+		if err != nil {
+			return err
+		}
+		_, err = NewVPSService().DeleteServer(ctx, token, accountID, serverID)
+		return err
+
+	case change.Kind == StackKindApplication && change.Action == StackActionCreate:
+		return s.createApplication(ctx, token, accountID, change.app, serverIDs[change.app.Server])
+
+	case change.Kind == StackKindApplication && change.Action == StackActionUpdate:
+		return s.updateApplication(ctx, token, accountID, change.app, change.id)
+
+	case change.Kind == StackKindApplication && change.Action == StackActionDelete:
+		return NewSimpleApplicationService().DeleteApplication(ctx, token, accountID, change.id)
+	}
+	return fmt.Errorf("unsupported change %s of %s", change.Action, change.Kind)
+}
+
+func (s *StackService) createApplication(ctx context.Context, token, accountID string, want *StackApplication, vpsID string) error {
+	predefined, ok := s.catalog.GetApplicationByID(want.Type)
+	if !ok {
+		return fmt.Errorf("unknown application type %s", want.Type)
+	}
+	app := *predefined
+	if want.Version != "" {
+		app.Version = want.Version
+	}
+	values, err := encodeStackValues(want.Values)
+	if err != nil {
+		return err
+	}
+
+	created, err := NewSimpleApplicationService().CreateApplication(ctx, token, accountID, map[string]interface{}{
+		"subdomain":   want.Subdomain,
+		"domain":      want.Domain,
+		"vps_id":      vpsID,
+		"vps_name":    want.Server,
+		"description": want.Description,
+		"values":      values,
+	}, &app)
+	if err != nil {
+		return err
+	}
+	if created.Status == "Failed" {
+		return errors.New(created.ErrorMsg)
+	}
+	return nil
+}
+
+func (s *StackService) updateApplication(ctx context.Context, token, accountID string, want *StackApplication, appID string) error {
+	appService := NewSimpleApplicationService()
+	app, err := appService.GetApplication(token, accountID, appID)
+	if err != nil {
+		return err
+	}
+
+	values, err := encodeStackValues(want.Values)
+	if err != nil {
+		return err
+	}
+	app.Values = values
+	if want.Description != "" {
+		app.Description = want.Description
+	}
+	if err := appService.UpdateApplication(token, accountID, app); err != nil {
+		return err
+	}
+
+	version := want.Version
+	if version == "" {
+		version = app.AppVersion
+	}
+	return NewApplicationDeploymentService().UpgradeApplication(ctx, token, accountID, appID, version)
+}
+
+func domainDetails(want *StackDomain) []string {
+	details := []string{"issuer " + stackIssuer(want.Issuer)}
+	if want.DNSOnly {
+		details = append(details, "DNS only")
+	}
+	return details
+}
+
+func domainDifferences(want *StackDomain, current *DomainSSLConfig) []string {
+	var details []string
+	if stackIssuer(want.Issuer) != stackIssuer(current.Issuer) {
+		details = append(details, fmt.Sprintf("issuer %s → %s", stackIssuer(current.Issuer), stackIssuer(want.Issuer)))
+	}
+	if want.DNSOnly != current.DNSOnly {
+		details = append(details, fmt.Sprintf("DNS only %v → %v", current.DNSOnly, want.DNSOnly))
+	}
+	return details
+}
+
+func stackIssuer(issuer string) string {
+	if issuer == "" {
+		return IssuerCloudflareOrigin
+	}
+	return issuer
+}
+
+func serverDetails(want *StackServer) []string {
+	return []string{providerName(want.Provider), want.Type + " in " + want.Location}
+}
+
+func serverDifferences(want *StackServer, current *VPSConfig) []string {
+	var details []string
+	wantProvider, _ := CanonicalProviderName(providerName(want.Provider))
+	currentProvider, _ := CanonicalProviderName(providerName(current.Provider))
+	if wantProvider != currentProvider {
+		details = append(details, fmt.Sprintf("provider %s → %s", currentProvider, wantProvider))
+	}
+	if want.Location != current.Location {
+		details = append(details, fmt.Sprintf("location %s → %s", current.Location, want.Location))
+	}
+	if want.Type != current.ServerType {
+		details = append(details, fmt.Sprintf("type %s → %s", current.ServerType, want.Type))
+	}
+	return details
+}
+
+func applicationDetails(want *StackApplication) []string {
+	details := []string{want.Type + " on " + want.Server}
+	if want.Version != "" {
+		details = append(details, "version "+want.Version)
+	}
+	if len(want.Values) > 0 {
+		details = append(details, "values overridden")
+	}
+	return details
+}
+
+func applicationDifferences(want *StackApplication, current *models.Application) ([]string, error) {
+	var details []string
+	if want.Version != "" && want.Version != current.AppVersion {
+		details = append(details, fmt.Sprintf("version %s → %s", current.AppVersion, want.Version))
+	}
+
+	wantValues, err := encodeStackValues(want.Values)
+	if err != nil {
+		return nil, err
+	}
+	currentValues, err := normalizeValues(current.Values)
+	if err != nil {
+		currentValues = current.Values
+	}
+	if wantValues != currentValues {
+		details = append(details, "values changed")
+	}
+	return details, nil
+}
+
+// encodeStackValues renders Helm values as the YAML stored with an application
+func encodeStackValues(values map[string]interface{}) (string, error) {
+	if len(values) == 0 {
+		return "", nil
+	}
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("invalid values: %w", err)
+	}
+	return string(data), nil
+}
+
+// normalizeValues re-encodes stored values so they compare equal to encodeStackValues
+func normalizeValues(values string) (string, error) {
+	if strings.TrimSpace(values) == "" {
+		return "", nil
+	}
+	var decoded map[string]interface{}
+	if err := yaml.Unmarshal([]byte(values), &decoded); err != nil {
+		return "", err
+	}
+	return encodeStackValues(decoded)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
 	"os/exec"
 	"strconv"
 	"time"
@@ -76,10 +77,25 @@ func (ts *TerminalService) CreateSession(serverID int, host, user, privateKey st
 	session.cancel = cancel
 
 	// GoTTY command with SSH
-	sshTarget := fmt.Sprintf("%s@%s", user, host)
+	sshHost, sshPort := host, "22"
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		sshHost, sshPort = h, p
+	}
+	sshTarget := fmt.Sprintf("%s@%s", user, sshHost)
+
+	// Check the pinned host key when there is one
+	hostKeyOptions := []string{"-o", "UserKnownHostsFile=/dev/null", "-o", "StrictHostKeyChecking=no"}
+	knownHostsFile := ""
+	if line, ok := GetKnownHosts().KnownHostsLine(host); ok {
+		knownHostsFile = fmt.Sprintf("/tmp/xanthus-known-hosts-%s", sessionID)
+		if err := os.WriteFile(knownHostsFile, []byte(line+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write known hosts file: %v", err)
+		}
+		hostKeyOptions = []string{"-o", "UserKnownHostsFile=" + knownHostsFile, "-o", "StrictHostKeyChecking=yes"}
+	}
 	log.Printf("🚀 Creating terminal session - SSH Target: %s (ServerID: %d)", sshTarget, serverID)
 
-	cmd := exec.CommandContext(ctx, "gotty",
+	args := []string{
 		"--port", strconv.Itoa(port),
 		"--permit-write",
 		"--reconnect",
@@ -88,11 +104,11 @@ func (ts *TerminalService) CreateSession(serverID int, host, user, privateKey st
 		"--close-timeout", "10",
 		"ssh",
 		"-i", keyFile,
-		"-o", "UserKnownHostsFile=/dev/null",
-		"-o", "StrictHostKeyChecking=no",
-		"-o", "ConnectTimeout=10",
-		sshTarget,
-	)
+		"-p", sshPort,
+	}
+	args = append(args, hostKeyOptions...)
+	args = append(args, "-o", "ConnectTimeout=10", sshTarget)
+	cmd := exec.CommandContext(ctx, "gotty", args...)
 
 	session.process = cmd
 
@@ -114,6 +130,9 @@ func (ts *TerminalService) CreateSession(serverID int, host, user, privateKey st
 			session.Status = "stopped"
 			// Clean up temporary SSH key file
 			exec.Command("rm", "-f", keyFile).Run()
+			if knownHostsFile != "" {
+				os.Remove(knownHostsFile)
+			}
 			delete(ts.sessions, sessionID)
 		}()
 
@@ -0,0 +1,522 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// User roles. Viewers can only read; operators manage servers, applications
+// and domains; admins also manage users, API tokens and Xanthus updates.
+const (
+	RoleAdmin    = "admin"
+	RoleOperator = "operator"
+	RoleViewer   = "viewer"
+)
+
+// Roles lists the user roles from most to least privileged
+var Roles = []string{RoleAdmin, RoleOperator, RoleViewer}
+
+// RoleScopes returns the API scopes granted to a role
+func RoleScopes(role string) []string {
+	switch role {
+	case RoleAdmin:
+		return []string{ScopeAll}
+	case RoleOperator:
+		return []string{ScopeVPSRead, ScopeVPSWrite, ScopeAppsRead, ScopeAppsWrite, ScopeDNSRead, ScopeDNSWrite, ScopeVersionsRead, ScopeJobsRead, ScopeJobsWrite, ScopeReconcileRead, ScopeReconcileWrite, ScopeStacksRead, ScopeStacksWrite, ScopeAdoptRead, ScopeAdoptWrite, ScopeBackupsRead, ScopeBackupsWrite, ScopeMetricsRead}
+	case RoleViewer:
+		return []string{ScopeVPSRead, ScopeAppsRead, ScopeDNSRead, ScopeVersionsRead, ScopeJobsRead, ScopeReconcileRead, ScopeStacksRead, ScopeAdoptRead, ScopeBackupsRead, ScopeMetricsRead}
+	default:
+		return []string{}
+	}
+}
+
+const (
+	userKeyPrefix    = "user:"
+	sessionKeyPrefix = "session:"
+	instanceCredKey  = "instance:cloudflare"
+
+	// SessionCookieName is the cookie holding the web UI session ID
+	SessionCookieName = "xanthus_session"
+
+	// SessionTTL is how long a web UI session lasts
+	SessionTTL = 24 * time.Hour
+
+	minPasswordLength = 8
+)
+
+// User and session errors
+var (
+	ErrUserNotFound         = errors.New("user not found")
+	ErrUserExists           = errors.New("user already exists")
+	ErrInvalidCredentials   = errors.New("invalid username or password")
+	ErrInvalidUser          = errors.New("invalid user")
+	ErrLastAdmin            = errors.New("at least one admin must remain")
+	ErrSessionInvalid       = errors.New("session is invalid or has expired")
+	ErrInstanceNotSetUp     = errors.New("Xanthus has not been set up yet")
+	ErrInstanceAlreadySetUp = errors.New("Xanthus is already set up")
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{0,63}$`)
+
+// dummyPasswordHash is compared against when a username doesn't exist, so
+// unknown users can't be told apart by response time
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("xanthus"), bcrypt.DefaultCost)
+	return hash
+})
+
+// User is a local Xanthus user
+type User struct {
+	Username     string     `json:"username"`
+	Role         string     `json:"role"`
+	PasswordHash string     `json:"password_hash"`
+	CreatedAt    time.Time  `json:"created_at"`
+	LastLoginAt  *time.Time `json:"last_login_at,omitempty"`
+}
+
+// Session is a server-side web UI session. Only the SHA-256 of the session ID is stored.
+type Session struct {
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// instanceCredentials is the Cloudflare token shared by all users, encrypted with the instance secret
+type instanceCredentials struct {
+	EncryptedToken string    `json:"encrypted_token"`
+	AccountID      string    `json:"account_id"`
+	ConfiguredAt   time.Time `json:"configured_at"`
+}
+
+// UserService manages local users, their sessions and the Cloudflare token
+// they act with. Users never see the Cloudflare token: it is stored once,
+// encrypted with the instance secret, when the first admin sets Xanthus up.
+type UserService struct {
+	store  utils.StateStore
+	secret string
+	mutex  sync.Mutex
+
+	// Held through Setup, so concurrent setups can't both find the instance not set up
+	setupMutex sync.Mutex
+
+	// Decrypted instance credentials, loaded on first use
+	cfToken   string
+	accountID string
+}
+
+// NewUserService creates a user service. Like API tokens, users must be
+// resolvable before any Cloudflare credentials are known, so when state lives
+// in Cloudflare KV they are kept in the local data directory.
+func NewUserService() *UserService {
+	store := utils.GetStateStore()
+	if utils.UsesCloudflareKV() {
+		local, err := utils.NewLocalStateStore(utils.DataDir())
+		if err != nil {
+			log.Printf("Warning: user accounts unavailable: %v", err)
+		} else {
+			store = local
+		}
+	}
+
+	secret, err := utils.LoadInstanceSecret(utils.DataDir())
+	if err != nil {
+		log.Printf("Warning: instance secret unavailable: %v", err)
+	}
+	return NewUserServiceWithStore(store, secret)
+}
+
+// NewUserServiceWithStore creates a user service backed by store, encrypting
+// the instance credentials with secret
+func NewUserServiceWithStore(store utils.StateStore, secret string) *UserService {
+	return &UserService{store: store, secret: secret}
+}
+
+// IsSetUp reports whether the first admin and the Cloudflare token have been configured
+func (s *UserService) IsSetUp() bool {
+	_, err := s.store.Get("", "", instanceCredKey)
+	return err == nil
+}
+
+// Setup stores the Cloudflare token of the instance and creates the first
+// admin. The admin is deleted again if the token can't be stored, so a failed
+// setup can be retried.
+func (s *UserService) Setup(cfToken, accountID, username, password string) (*User, error) {
+	s.setupMutex.Lock()
+	defer s.setupMutex.Unlock()
+
+	if s.IsSetUp() {
+		return nil, ErrInstanceAlreadySetUp
+	}
+	if s.secret == "" {
+		return nil, fmt.Errorf("instance secret is not available")
+	}
+
+	encrypted, err := utils.EncryptData(cfToken, s.secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt Cloudflare token: %w", err)
+	}
+
+	user, err := s.CreateUser(username, password, RoleAdmin)
+	if err != nil {
+		return nil, err
+	}
+
+	creds := instanceCredentials{EncryptedToken: encrypted, AccountID: accountID, ConfiguredAt: time.Now().UTC()}
+	if err := s.put(instanceCredKey, creds); err != nil {
+		if deleteErr := s.store.Delete("", "", userKeyPrefix+user.Username); deleteErr != nil {
+			log.Printf("Warning: failed to delete admin %s of the failed setup: %v", user.Username, deleteErr)
+		}
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	s.cfToken, s.accountID = cfToken, accountID
+	s.mutex.Unlock()
+
+	log.Printf("👤 Xanthus set up for account %s with admin %s", accountID, user.Username)
+	return user, nil
+}
+
+// InstanceCredentials returns the Cloudflare token and account all users act with
+func (s *UserService) InstanceCredentials() (string, string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.cfToken != "" {
+		return s.cfToken, s.accountID, nil
+	}
+
+	var creds instanceCredentials
+	if err := s.get(instanceCredKey, &creds); err != nil {
+		return "", "", ErrInstanceNotSetUp
+	}
+	token, err := utils.DecryptData(creds.EncryptedToken, s.secret)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decrypt Cloudflare token, was the instance secret changed? %w", err)
+	}
+
+	s.cfToken, s.accountID = token, creds.AccountID
+	return s.cfToken, s.accountID, nil
+}
+
+// SetInstanceToken replaces the Cloudflare token all users act with, keeping the account
+func (s *UserService) SetInstanceToken(cfToken string) error {
+	_, accountID, err := s.InstanceCredentials()
+	if err != nil {
+		return err
+	}
+
+	encrypted, err := utils.EncryptData(cfToken, s.secret)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt Cloudflare token: %w", err)
+	}
+	creds := instanceCredentials{EncryptedToken: encrypted, AccountID: accountID, ConfiguredAt: time.Now().UTC()}
+	if err := s.put(instanceCredKey, creds); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	s.cfToken = cfToken
+	s.mutex.Unlock()
+	return nil
+}
+
+// CreateUser adds a user with a role
+func (s *UserService) CreateUser(username, password, role string) (*User, error) {
+	username = normalizeUsername(username)
+	if !usernamePattern.MatchString(username) {
+		return nil, fmt.Errorf("%w: usernames use lowercase letters, digits, '.', '_' and '-'", ErrInvalidUser)
+	}
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, err := s.load(username); err == nil {
+		return nil, ErrUserExists
+	}
+
+	user := &User{Username: username, Role: role, PasswordHash: hash, CreatedAt: time.Now().UTC()}
+	if err := s.put(userKeyPrefix+username, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GetUser returns a user
+func (s *UserService) GetUser(username string) (*User, error) {
+	return s.load(normalizeUsername(username))
+}
+
+// ListUsers returns every user ordered by username
+func (s *UserService) ListUsers() ([]User, error) {
+	keys, err := s.store.ListKeys("", "", userKeyPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+
+	users := []User{}
+	for _, key := range keys {
+		if user, err := s.load(strings.TrimPrefix(key, userKeyPrefix)); err == nil {
+			users = append(users, *user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	return users, nil
+}
+
+// SetRole changes the role of a user. The last admin can't be demoted.
+func (s *UserService) SetRole(username, role string) (*User, error) {
+	if err := validateRole(role); err != nil {
+		return nil, err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, err := s.load(normalizeUsername(username))
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == RoleAdmin && role != RoleAdmin {
+		if err := s.ensureOtherAdmin(user.Username); err != nil {
+			return nil, err
+		}
+	}
+
+	user.Role = role
+	if err := s.put(userKeyPrefix+user.Username, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetPassword replaces the password of a user and ends their sessions
+func (s *UserService) SetPassword(username, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, err := s.load(normalizeUsername(username))
+	if err != nil {
+		return err
+	}
+	user.PasswordHash = hash
+	if err := s.put(userKeyPrefix+user.Username, user); err != nil {
+		return err
+	}
+	s.deleteSessions(user.Username)
+	return nil
+}
+
+// DeleteUser removes a user and their sessions. The last admin can't be deleted.
+func (s *UserService) DeleteUser(username string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	user, err := s.load(normalizeUsername(username))
+	if err != nil {
+		return err
+	}
+	if user.Role == RoleAdmin {
+		if err := s.ensureOtherAdmin(user.Username); err != nil {
+			return err
+		}
+	}
+
+	if err := s.store.Delete("", "", userKeyPrefix+user.Username); err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+	s.deleteSessions(user.Username)
+	return nil
+}
+
+// Authenticate checks a username and password
+func (s *UserService) Authenticate(username, password string) (*User, error) {
+	user, err := s.load(normalizeUsername(username))
+	if err != nil {
+		// Spend the same time as for a wrong password
+		bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if !user.CheckPassword(password) {
+		return nil, ErrInvalidCredentials
+	}
+
+	s.mutex.Lock()
+	now := time.Now().UTC()
+	user.LastLoginAt = &now
+	if err := s.put(userKeyPrefix+user.Username, user); err != nil {
+		log.Printf("Warning: failed to record login of %s: %v", user.Username, err)
+	}
+	s.mutex.Unlock()
+
+	return user, nil
+}
+
+// CreateSession starts a session for a user and returns its ID, which is only
+// known to the client
+func (s *UserService) CreateSession(username string) (string, *Session, error) {
+	id, err := randomHex(32)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to generate session ID: %w", err)
+	}
+
+	now := time.Now().UTC()
+	session := &Session{Username: normalizeUsername(username), CreatedAt: now, ExpiresAt: now.Add(SessionTTL)}
+	if err := s.put(sessionKeyPrefix+hashAPIToken(id), session); err != nil {
+		return "", nil, err
+	}
+	return id, session, nil
+}
+
+// ResolveSession returns the user of a session ID
+func (s *UserService) ResolveSession(id string) (*User, *Session, error) {
+	if id == "" {
+		return nil, nil, ErrSessionInvalid
+	}
+
+	key := sessionKeyPrefix + hashAPIToken(id)
+	var session Session
+	if err := s.get(key, &session); err != nil {
+		return nil, nil, ErrSessionInvalid
+	}
+	if time.Now().After(session.ExpiresAt) {
+		s.store.Delete("", "", key)
+		return nil, nil, ErrSessionInvalid
+	}
+
+	user, err := s.load(session.Username)
+	if err != nil {
+		// The user was deleted
+		return nil, nil, ErrSessionInvalid
+	}
+	return user, &session, nil
+}
+
+// DeleteSession ends a session
+func (s *UserService) DeleteSession(id string) error {
+	return s.store.Delete("", "", sessionKeyPrefix+hashAPIToken(id))
+}
+
+// CheckPassword reports whether password is the user's password
+func (u *User) CheckPassword(password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password)) == nil
+}
+
+// ensureOtherAdmin fails unless an admin other than username exists
+func (s *UserService) ensureOtherAdmin(username string) error {
+	keys, err := s.store.ListKeys("", "", userKeyPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	for _, key := range keys {
+		other := strings.TrimPrefix(key, userKeyPrefix)
+		if other == username {
+			continue
+		}
+		if user, err := s.load(other); err == nil && user.Role == RoleAdmin {
+			return nil
+		}
+	}
+	return ErrLastAdmin
+}
+
+// deleteSessions ends every session of a user
+func (s *UserService) deleteSessions(username string) {
+	keys, err := s.store.ListKeys("", "", sessionKeyPrefix)
+	if err != nil {
+		log.Printf("Warning: failed to list sessions: %v", err)
+		return
+	}
+	for _, key := range keys {
+		var session Session
+		if err := s.get(key, &session); err == nil && session.Username == username {
+			s.store.Delete("", "", key)
+		}
+	}
+}
+
+// load reads a user record
+func (s *UserService) load(username string) (*User, error) {
+	var user User
+	if err := s.get(userKeyPrefix+username, &user); err != nil {
+		if errors.Is(err, utils.ErrKeyNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// get reads and decodes a record
+func (s *UserService) get(key string, value interface{}) error {
+	data, err := s.store.Get("", "", key)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return nil
+}
+
+// put encodes and writes a record
+func (s *UserService) put(key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	if err := s.store.Put("", "", key, data); err != nil {
+		return fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	return nil
+}
+
+// normalizeUsername makes usernames case-insensitive
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// validateRole checks that role is a known role
+func validateRole(role string) error {
+	for _, r := range Roles {
+		if r == role {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unknown role %q", ErrInvalidUser, role)
+}
+
+// hashPassword checks the password policy and returns the bcrypt hash
+func hashPassword(password string) (string, error) {
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("%w: passwords need at least %d characters", ErrInvalidUser, minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
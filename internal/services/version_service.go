@@ -1,19 +1,69 @@
 package services
 
 import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Default locations of Xanthus release artifacts
+const (
+	SelfUpdateRepository  = "chrishham/xanthus"
+	SelfUpdateChecksums   = "checksums.txt"
+	SelfUpdateSignature   = "checksums.txt.sig"
+	previousBinarySuffix  = ".previous"
+	stagedBinarySuffix    = ".new"
+	updateStateFileSuffix = ".update.json"
+)
+
+// ErrUpdateInProgress is returned when an update or rollback is already running
+var ErrUpdateInProgress = errors.New("update already in progress")
+
 // SelfUpdateService handles version management operations for self-updating
 type SelfUpdateService struct {
 	currentVersion  string
 	previousVersion string
 	updateStatus    *UpdateStatus
 	updateMutex     sync.RWMutex
+
+	client         *http.Client
+	apiBaseURL     string
+	repository     string
+	executablePath string
+	publicKey      ed25519.PublicKey
+	goos           string
+	goarch         string
+	restart        func(executablePath string, env []string) error
+
+	// Per-update working state
+	release     *selfUpdateRelease
+	workDir     string
+	archivePath string
+	stagedPath  string
+}
+
+// SelfUpdateOptions overrides the defaults used by the self-update pipeline
+type SelfUpdateOptions struct {
+	HTTPClient     *http.Client
+	APIBaseURL     string // GitHub API base URL
+	Repository     string // owner/repo hosting the releases
+	ExecutablePath string // Binary to replace; defaults to os.Executable()
+	PublicKey      string // Base64 ed25519 key; when set, checksums.txt.sig is required
+	GOOS           string
+	GOARCH         string
+	// Restart replaces the running process with the binary at executablePath
+	Restart func(executablePath string, env []string) error
 }
 
 // UpdateStatus represents the status of an update operation
@@ -28,15 +78,76 @@ type UpdateStatus struct {
 	EndTime    *time.Time `json:"end_time,omitempty"`
 }
 
+// selfUpdateState is persisted next to the binary so the status and the
+// rollback target survive the re-exec into the new version
+type selfUpdateState struct {
+	InstalledVersion string       `json:"installed_version"`
+	InstalledBinary  string       `json:"installed_binary"` // SHA-256 of the binary the state belongs to
+	PreviousVersion  string       `json:"previous_version"`
+	PreviousBinary   string       `json:"previous_binary"`
+	Status           UpdateStatus `json:"status"`
+}
+
 // NewSelfUpdateService creates a new self-update service instance
 func NewSelfUpdateService() *SelfUpdateService {
-	return &SelfUpdateService{
+	return NewSelfUpdateServiceWithOptions(SelfUpdateOptions{
+		PublicKey: os.Getenv("XANTHUS_UPDATE_PUBLIC_KEY"),
+	})
+}
+
+// NewSelfUpdateServiceWithOptions creates a self-update service with custom options
+func NewSelfUpdateServiceWithOptions(opts SelfUpdateOptions) *SelfUpdateService {
+	s := &SelfUpdateService{
 		currentVersion: getVersionFromEnv(),
 		updateStatus: &UpdateStatus{
 			InProgress: false,
 			Status:     "ready",
 		},
+		client:         opts.HTTPClient,
+		apiBaseURL:     opts.APIBaseURL,
+		repository:     opts.Repository,
+		executablePath: opts.ExecutablePath,
+		goos:           opts.GOOS,
+		goarch:         opts.GOARCH,
+		restart:        opts.Restart,
+	}
+
+	if s.client == nil {
+		s.client = &http.Client{Timeout: 5 * time.Minute}
+	}
+	if s.apiBaseURL == "" {
+		s.apiBaseURL = GitHubBaseURL
+	}
+	if s.repository == "" {
+		s.repository = SelfUpdateRepository
+	}
+	if s.goos == "" {
+		s.goos = runtime.GOOS
+	}
+	if s.goarch == "" {
+		s.goarch = runtime.GOARCH
+	}
+	if s.restart == nil {
+		s.restart = restartProcess
 	}
+	if s.executablePath == "" {
+		if exe, err := os.Executable(); err == nil {
+			if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+				exe = resolved
+			}
+			s.executablePath = exe
+		}
+	}
+	if opts.PublicKey != "" {
+		if key, err := base64.StdEncoding.DecodeString(opts.PublicKey); err == nil && len(key) == ed25519.PublicKeySize {
+			s.publicKey = ed25519.PublicKey(key)
+		} else {
+			log.Printf("Warning: ignoring invalid self-update public key")
+		}
+	}
+
+	s.loadState()
+	return s
 }
 
 // GetCurrentVersion returns the current running version
@@ -71,7 +182,11 @@ func (s *SelfUpdateService) CanRollback() bool {
 	s.updateMutex.RLock()
 	defer s.updateMutex.RUnlock()
 
-	return s.previousVersion != "" && !s.updateStatus.InProgress
+	if s.previousVersion == "" || s.updateStatus.InProgress {
+		return false
+	}
+	_, err := os.Stat(s.previousBinaryPath())
+	return err == nil
 }
 
 // GetUpdateStatus returns the current update status
@@ -84,139 +199,201 @@ func (s *SelfUpdateService) GetUpdateStatus() *UpdateStatus {
 	return &status
 }
 
-// StartUpdate starts the update process to a specific version
+// StartUpdate starts the update process to a specific version in the background
 func (s *SelfUpdateService) StartUpdate(token, accountID, version, releaseNotes string) {
-	s.updateMutex.Lock()
-	defer s.updateMutex.Unlock()
-
-	if s.updateStatus.InProgress {
-		return
+	if s.beginOperation(version, "starting", "Initializing update...") {
+		go s.performUpdate(context.Background(), version)
 	}
+}
 
-	// Set previous version for rollback
-	s.previousVersion = s.currentVersion
+// StartUpdateJob starts the update to a specific version as a job, which
+// succeeds once the new version is installed and Xanthus is restarting
+func (s *SelfUpdateService) StartUpdateJob(jobs *JobManager, token, accountID, version string) (*Job, error) {
+	if !s.beginOperation(version, "starting", "Initializing update...") {
+		return nil, ErrUpdateInProgress
+	}
+	return jobs.Start(token, accountID, JobSpec{Type: JobTypeSelfUpdate, Target: version}, func(ctx context.Context) error {
+		return s.performUpdate(ctx, version)
+	}), nil
+}
 
-	// Initialize update status
-	s.updateStatus = &UpdateStatus{
-		InProgress: true,
-		Version:    version,
-		Status:     "starting",
-		Progress:   0,
-		Message:    "Initializing update...",
-		StartTime:  time.Now(),
+// StartRollback starts the rollback process to the previous version in the background
+func (s *SelfUpdateService) StartRollback(token, accountID, version string) {
+	if s.beginOperation(version, "rolling_back", "Starting rollback...") {
+		go s.performRollback(context.Background(), version)
 	}
+}
 
-	// Start the actual update process
-	go s.performUpdate(token, accountID, version, releaseNotes)
+// StartRollbackJob starts the rollback to the previous version as a job
+func (s *SelfUpdateService) StartRollbackJob(jobs *JobManager, token, accountID, version string) (*Job, error) {
+	if !s.beginOperation(version, "rolling_back", "Starting rollback...") {
+		return nil, ErrUpdateInProgress
+	}
+	return jobs.Start(token, accountID, JobSpec{Type: JobTypeSelfRollback, Target: version}, func(ctx context.Context) error {
+		return s.performRollback(ctx, version)
+	}), nil
 }
 
-// StartRollback starts the rollback process to the previous version
-func (s *SelfUpdateService) StartRollback(token, accountID, version string) {
+// beginOperation initializes the status of an update or rollback, unless one is already in progress
+func (s *SelfUpdateService) beginOperation(version, status, message string) bool {
 	s.updateMutex.Lock()
 	defer s.updateMutex.Unlock()
 
 	if s.updateStatus.InProgress {
-		return
+		return false
 	}
 
-	// Initialize rollback status
 	s.updateStatus = &UpdateStatus{
 		InProgress: true,
 		Version:    version,
-		Status:     "rolling_back",
+		Status:     status,
 		Progress:   0,
-		Message:    "Starting rollback...",
+		Message:    message,
 		StartTime:  time.Now(),
 	}
-
-	// Start the actual rollback process
-	go s.performRollback(token, accountID, version)
+	return true
 }
 
 // performUpdate performs the actual update process
-func (s *SelfUpdateService) performUpdate(token, accountID, version, releaseNotes string) {
+func (s *SelfUpdateService) performUpdate(ctx context.Context, version string) error {
+	defer s.cleanupWorkDir()
+
 	steps := []struct {
 		name     string
 		progress int
 		action   func() error
 	}{
 		{"Validating system", 10, s.validateSystem},
-		{"Creating backup", 20, s.createBackup},
-		{"Downloading new version", 40, func() error { return s.downloadVersion(version) }},
+		{"Fetching release information", 20, func() error { return s.fetchRelease(version) }},
+		{"Downloading new version", 40, s.downloadVersion},
 		{"Validating download", 60, s.validateDownload},
-		{"Stopping current instance", 70, s.stopCurrentInstance},
-		{"Installing new version", 80, func() error { return s.installVersion(version) }},
-		{"Starting new instance", 90, s.startNewInstance},
-		{"Validating deployment", 100, s.validateDeployment},
+		{"Extracting binary", 70, s.extractBinary},
+		{"Installing new version", 85, s.installVersion},
 	}
 
 	for _, step := range steps {
 		s.updateStatusProgress(step.progress, step.name)
 
-		if err := step.action(); err != nil {
+		err := StartJobStep(ctx, step.name)
+		if err == nil {
+			err = step.action()
+		}
+		if err != nil {
 			s.updateStatusError(fmt.Sprintf("Failed at step '%s': %v", step.name, err))
-			return
+			return fmt.Errorf("failed at step '%s': %w", step.name, err)
 		}
-
-		time.Sleep(time.Second) // Simulate work
 	}
 
-	// Update completed successfully
 	s.updateMutex.Lock()
-	s.currentVersion = version
-	endTime := time.Now()
-	s.updateStatus = &UpdateStatus{
-		InProgress: false,
-		Version:    version,
-		Status:     "completed",
-		Progress:   100,
-		Message:    "Update completed successfully",
-		StartTime:  s.updateStatus.StartTime,
-		EndTime:    &endTime,
-	}
+	previousVersion := s.currentVersion
+	s.previousVersion = previousVersion
 	s.updateMutex.Unlock()
+
+	return s.restartInto(ctx, version, previousVersion, "completed", "Update completed successfully")
 }
 
 // performRollback performs the actual rollback process
-func (s *SelfUpdateService) performRollback(token, accountID, version string) {
+func (s *SelfUpdateService) performRollback(ctx context.Context, version string) error {
 	steps := []struct {
 		name     string
 		progress int
 		action   func() error
 	}{
-		{"Validating rollback", 10, s.validateSystem},
-		{"Stopping current instance", 30, s.stopCurrentInstance},
-		{"Restoring previous version", 60, func() error { return s.installVersion(version) }},
-		{"Starting previous instance", 80, s.startNewInstance},
-		{"Validating rollback", 100, s.validateDeployment},
+		{"Validating rollback", 20, s.validateRollback},
+		{"Restoring previous version", 60, s.restorePreviousVersion},
 	}
 
 	for _, step := range steps {
 		s.updateStatusProgress(step.progress, step.name)
 
-		if err := step.action(); err != nil {
+		err := StartJobStep(ctx, step.name)
+		if err == nil {
+			err = step.action()
+		}
+		if err != nil {
 			s.updateStatusError(fmt.Sprintf("Failed at rollback step '%s': %v", step.name, err))
-			return
+			return fmt.Errorf("failed at rollback step '%s': %w", step.name, err)
 		}
-
-		time.Sleep(time.Second) // Simulate work
 	}
 
-	// Rollback completed successfully
 	s.updateMutex.Lock()
-	s.currentVersion = version
 	s.previousVersion = "" // Clear previous version after successful rollback
+	s.updateMutex.Unlock()
+
+	return s.restartInto(ctx, version, "", "rolled_back", "Rollback completed successfully")
+}
+
+// restartInto records the outcome the new process should report, then re-executes the binary
+func (s *SelfUpdateService) restartInto(ctx context.Context, version, previousVersion, finalStatus, finalMessage string) error {
+	s.updateStatusProgress(95, "Restarting Xanthus")
+	if err := StartJobStep(ctx, "Restarting Xanthus"); err != nil {
+		s.updateStatusError(fmt.Sprintf("Installed %s but the restart was cancelled", version))
+		return err
+	}
+
+	s.updateMutex.Lock()
 	endTime := time.Now()
 	s.updateStatus = &UpdateStatus{
 		InProgress: false,
 		Version:    version,
-		Status:     "rolled_back",
+		Status:     finalStatus,
 		Progress:   100,
-		Message:    "Rollback completed successfully",
+		Message:    finalMessage,
 		StartTime:  s.updateStatus.StartTime,
 		EndTime:    &endTime,
 	}
+	state := selfUpdateState{
+		InstalledVersion: version,
+		PreviousVersion:  previousVersion,
+		Status:           *s.updateStatus,
+	}
+	if previousVersion != "" {
+		state.PreviousBinary = s.previousBinaryPath()
+	}
 	s.updateMutex.Unlock()
+
+	if err := s.saveState(&state); err != nil {
+		log.Printf("Warning: failed to persist update state: %v", err)
+	}
+
+	// The restart replaces this process, so the job has to be recorded before it
+	CompleteJob(ctx, finalMessage)
+
+	env := setEnv(os.Environ(), "XANTHUS_VERSION", strings.TrimPrefix(version, "v"))
+	if err := s.restart(s.executablePath, env); err != nil {
+		message := fmt.Sprintf("Installed %s but failed to restart: %v", version, err)
+		if previousVersion != "" {
+			// Put back the binary this process runs, so the next start doesn't
+			// run a version that was never started successfully
+			if restoreErr := s.restorePreviousVersion(); restoreErr != nil {
+				log.Printf("Error: failed to restore the previous binary: %v", restoreErr)
+			} else {
+				message = fmt.Sprintf("Failed to restart into %s, kept %s: %v", version, previousVersion, err)
+				state = selfUpdateState{InstalledVersion: previousVersion}
+				s.updateMutex.Lock()
+				s.previousVersion = ""
+				s.updateMutex.Unlock()
+			}
+		}
+		s.updateStatusError(message)
+
+		s.updateMutex.Lock()
+		state.Status = *s.updateStatus
+		s.updateMutex.Unlock()
+		if err := s.saveState(&state); err != nil {
+			log.Printf("Warning: failed to persist update state: %v", err)
+		}
+
+		// The job was completed in anticipation of the restart
+		restartErr := fmt.Errorf("failed to restart into %s: %w", version, err)
+		FailJob(ctx, restartErr)
+		return restartErr
+	}
+
+	s.updateMutex.Lock()
+	s.currentVersion = version
+	s.updateMutex.Unlock()
+	return nil
 }
 
 // updateStatusProgress updates the progress of the current operation
@@ -241,45 +418,169 @@ func (s *SelfUpdateService) updateStatusError(errorMsg string) {
 	s.updateStatus.EndTime = &endTime
 }
 
-// Placeholder implementations for update steps
+// validateSystem checks that the running binary can be located and replaced
 func (s *SelfUpdateService) validateSystem() error {
-	// Check system requirements, disk space, etc.
+	if s.executablePath == "" {
+		return fmt.Errorf("unable to determine the path of the running binary")
+	}
+
+	info, err := os.Stat(s.executablePath)
+	if err != nil {
+		return fmt.Errorf("cannot access running binary: %w", err)
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", s.executablePath)
+	}
+
+	// The binary directory must be writable for the atomic swap
+	probe, err := os.CreateTemp(filepath.Dir(s.executablePath), ".xanthus-write-test-*")
+	if err != nil {
+		return fmt.Errorf("binary directory is not writable: %w", err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	if _, err := releaseAssetName(s.goos, s.goarch); err != nil {
+		return err
+	}
+
 	return nil
 }
 
-func (s *SelfUpdateService) createBackup() error {
-	// Create backup of current data
+// validateRollback checks that a previous binary is available
+func (s *SelfUpdateService) validateRollback() error {
+	if err := s.validateSystem(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(s.previousBinaryPath()); err != nil {
+		return fmt.Errorf("previous binary not found: %w", err)
+	}
 	return nil
 }
 
-func (s *SelfUpdateService) downloadVersion(version string) error {
-	// Download the new version from GitHub releases
+// installVersion atomically swaps the staged binary into place, keeping the current one for rollback
+func (s *SelfUpdateService) installVersion() error {
+	previous := s.previousBinaryPath()
+
+	// Drop any older backup; only one rollback target is kept
+	if err := os.Remove(previous); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove old backup: %w", err)
+	}
+
+	if err := os.Rename(s.executablePath, previous); err != nil {
+		return fmt.Errorf("failed to back up current binary: %w", err)
+	}
+
+	if err := os.Rename(s.stagedPath, s.executablePath); err != nil {
+		// Put the original binary back so the install is left untouched
+		if restoreErr := os.Rename(previous, s.executablePath); restoreErr != nil {
+			log.Printf("Error: failed to restore original binary: %v", restoreErr)
+		}
+		return fmt.Errorf("failed to install new binary: %w", err)
+	}
+
 	return nil
 }
 
-func (s *SelfUpdateService) validateDownload() error {
-	// Validate the downloaded file
+// restorePreviousVersion swaps the backed up binary back into place
+func (s *SelfUpdateService) restorePreviousVersion() error {
+	previous := s.previousBinaryPath()
+	replaced := s.executablePath + ".replaced"
+
+	os.Remove(replaced)
+	if err := os.Rename(s.executablePath, replaced); err != nil {
+		return fmt.Errorf("failed to move current binary aside: %w", err)
+	}
+
+	if err := os.Rename(previous, s.executablePath); err != nil {
+		if restoreErr := os.Rename(replaced, s.executablePath); restoreErr != nil {
+			log.Printf("Error: failed to restore current binary: %v", restoreErr)
+		}
+		return fmt.Errorf("failed to restore previous binary: %w", err)
+	}
+
+	// The replaced binary may still be running on Windows; it is removed on the next update
+	os.Remove(replaced)
 	return nil
 }
 
-func (s *SelfUpdateService) stopCurrentInstance() error {
-	// Stop the current instance gracefully
-	return nil
+// previousBinaryPath returns where the pre-update binary is kept
+func (s *SelfUpdateService) previousBinaryPath() string {
+	return s.executablePath + previousBinarySuffix
 }
 
-func (s *SelfUpdateService) installVersion(version string) error {
-	// Install the new version
-	return nil
+// stateFilePath returns where the update state is persisted
+func (s *SelfUpdateService) stateFilePath() string {
+	return s.executablePath + updateStateFileSuffix
 }
 
-func (s *SelfUpdateService) startNewInstance() error {
-	// Start the new instance
-	return nil
+// loadState restores the outcome of an update performed by the previous process
+func (s *SelfUpdateService) loadState() {
+	if s.executablePath == "" {
+		return
+	}
+
+	data, err := os.ReadFile(s.stateFilePath())
+	if err != nil {
+		return
+	}
+
+	var state selfUpdateState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Warning: ignoring corrupt update state file: %v", err)
+		return
+	}
+
+	// A binary replaced outside the updater makes the state stale
+	if sum, err := fileSHA256(s.executablePath); err != nil || sum != state.InstalledBinary {
+		log.Printf("Warning: discarding update state of a different binary")
+		os.Remove(s.stateFilePath())
+		return
+	}
+
+	// The installed binary is what runs, whatever XANTHUS_VERSION the service
+	// was first started with says
+	if state.InstalledVersion != "" {
+		s.currentVersion = state.InstalledVersion
+	}
+	s.previousVersion = state.PreviousVersion
+	if state.Status.Status != "" {
+		status := state.Status
+		status.InProgress = false
+		s.updateStatus = &status
+	}
 }
 
-func (s *SelfUpdateService) validateDeployment() error {
-	// Validate that the new deployment is working
-	return nil
+// saveState persists the update state next to the binary it belongs to
+func (s *SelfUpdateService) saveState(state *selfUpdateState) error {
+	sum, err := fileSHA256(s.executablePath)
+	if err != nil {
+		return err
+	}
+	state.InstalledBinary = sum
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.stateFilePath() + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.stateFilePath())
+}
+
+// setEnv returns env with key set to value, replacing any existing entry:
+// getenv returns the first entry, so appending wouldn't override it
+func setEnv(env []string, key, value string) []string {
+	result := make([]string, 0, len(env)+1)
+	for _, entry := range env {
+		if !strings.HasPrefix(entry, key+"=") {
+			result = append(result, entry)
+		}
+	}
+	return append(result, key+"="+value)
 }
 
 // getVersionFromEnv gets the version from environment variables or build info
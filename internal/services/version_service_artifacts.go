@@ -0,0 +1,365 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxBinarySize bounds how much data is extracted from a release archive
+const maxBinarySize = 512 << 20
+
+// selfUpdateRelease is the subset of the GitHub release payload used for self-update
+type selfUpdateRelease struct {
+	TagName string            `json:"tag_name"`
+	Assets  []selfUpdateAsset `json:"assets"`
+	byName  map[string]*selfUpdateAsset
+}
+
+// selfUpdateAsset is a downloadable file attached to a release
+type selfUpdateAsset struct {
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// releaseAssetName returns the release archive built for a platform by the release workflow
+func releaseAssetName(goos, goarch string) (string, error) {
+	switch goos + "/" + goarch {
+	case "linux/amd64":
+		return "xanthus-linux-amd64.tar.gz", nil
+	case "linux/arm64":
+		return "xanthus-linux-arm64.tar.gz", nil
+	case "windows/amd64":
+		return "xanthus-windows-amd64.zip", nil
+	case "darwin/amd64":
+		return "xanthus-macos-intel.tar.gz", nil
+	case "darwin/arm64":
+		return "xanthus-macos-arm64.tar.gz", nil
+	default:
+		return "", fmt.Errorf("no release build available for %s/%s", goos, goarch)
+	}
+}
+
+// fetchRelease loads the release metadata for a tag
+func (s *SelfUpdateService) fetchRelease(version string) error {
+	url := fmt.Sprintf("%s/repos/%s/releases/tags/%s", s.apiBaseURL, s.repository, version)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", "Xanthus/1.0")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch release: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GitHub API returned status %d for release %s", resp.StatusCode, version)
+	}
+
+	var release selfUpdateRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return fmt.Errorf("failed to decode release: %w", err)
+	}
+
+	release.byName = make(map[string]*selfUpdateAsset, len(release.Assets))
+	for i := range release.Assets {
+		release.byName[release.Assets[i].Name] = &release.Assets[i]
+	}
+
+	s.release = &release
+	return nil
+}
+
+// downloadVersion downloads the platform archive into a temporary work directory
+func (s *SelfUpdateService) downloadVersion() error {
+	assetName, err := releaseAssetName(s.goos, s.goarch)
+	if err != nil {
+		return err
+	}
+
+	asset, ok := s.release.byName[assetName]
+	if !ok {
+		return fmt.Errorf("release %s has no asset %s", s.release.TagName, assetName)
+	}
+
+	workDir, err := os.MkdirTemp("", "xanthus-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to create work directory: %w", err)
+	}
+	s.workDir = workDir
+
+	s.archivePath = filepath.Join(workDir, assetName)
+	return s.downloadFile(asset.BrowserDownloadURL, s.archivePath)
+}
+
+// validateDownload verifies the archive against checksums.txt and, when a
+// public key is configured, the ed25519 signature of checksums.txt
+func (s *SelfUpdateService) validateDownload() error {
+	checksumAsset, ok := s.release.byName[SelfUpdateChecksums]
+	if !ok {
+		return fmt.Errorf("release %s does not publish %s", s.release.TagName, SelfUpdateChecksums)
+	}
+
+	checksumPath := filepath.Join(s.workDir, SelfUpdateChecksums)
+	if err := s.downloadFile(checksumAsset.BrowserDownloadURL, checksumPath); err != nil {
+		return err
+	}
+
+	checksums, err := os.ReadFile(checksumPath)
+	if err != nil {
+		return fmt.Errorf("failed to read checksums: %w", err)
+	}
+
+	if s.publicKey != nil {
+		if err := s.verifyChecksumSignature(checksums); err != nil {
+			return err
+		}
+	}
+
+	assetName := filepath.Base(s.archivePath)
+	expected, err := lookupChecksum(checksums, assetName)
+	if err != nil {
+		return err
+	}
+
+	actual, err := fileSHA256(s.archivePath)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(expected, actual) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", assetName, expected, actual)
+	}
+
+	return nil
+}
+
+// verifyChecksumSignature checks the detached signature published alongside checksums.txt
+func (s *SelfUpdateService) verifyChecksumSignature(checksums []byte) error {
+	sigAsset, ok := s.release.byName[SelfUpdateSignature]
+	if !ok {
+		return fmt.Errorf("release %s is not signed (%s missing)", s.release.TagName, SelfUpdateSignature)
+	}
+
+	sigPath := filepath.Join(s.workDir, SelfUpdateSignature)
+	if err := s.downloadFile(sigAsset.BrowserDownloadURL, sigPath); err != nil {
+		return err
+	}
+
+	encoded, err := os.ReadFile(sigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read signature: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	if !ed25519.Verify(s.publicKey, checksums, signature) {
+		return fmt.Errorf("signature verification failed for %s", SelfUpdateChecksums)
+	}
+
+	return nil
+}
+
+// extractBinary unpacks the xanthus binary next to the running one so the final rename is atomic
+func (s *SelfUpdateService) extractBinary() error {
+	s.stagedPath = s.executablePath + stagedBinarySuffix
+	os.Remove(s.stagedPath)
+
+	out, err := os.OpenFile(s.stagedPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to create staged binary: %w", err)
+	}
+
+	if strings.HasSuffix(s.archivePath, ".zip") {
+		err = extractFromZip(s.archivePath, out)
+	} else {
+		err = extractFromTarGz(s.archivePath, out)
+	}
+
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(s.stagedPath)
+		return err
+	}
+
+	return nil
+}
+
+// cleanupWorkDir removes downloads and any binary that was staged but not installed
+func (s *SelfUpdateService) cleanupWorkDir() {
+	if s.workDir != "" {
+		os.RemoveAll(s.workDir)
+	}
+	if s.stagedPath != "" {
+		os.Remove(s.stagedPath)
+	}
+	s.release = nil
+	s.workDir = ""
+	s.archivePath = ""
+	s.stagedPath = ""
+}
+
+// downloadFile streams a URL to a local file
+func (s *SelfUpdateService) downloadFile(url, dest string) error {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	req.Header.Set("User-Agent", "Xanthus/1.0")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", path.Base(url), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download of %s returned status %d", path.Base(url), resp.StatusCode)
+	}
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dest, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, resp.Body); err != nil {
+		return fmt.Errorf("failed to write %s: %w", dest, err)
+	}
+
+	return nil
+}
+
+// lookupChecksum finds the sha256 of a file in sha256sum output format
+func lookupChecksum(checksums []byte, fileName string) (string, error) {
+	scanner := bufio.NewScanner(strings.NewReader(string(checksums)))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum marks binary mode with a leading "*"
+		if strings.TrimPrefix(fields[1], "*") == fileName {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("no checksum listed for %s", fileName)
+}
+
+// fileSHA256 returns the hex encoded SHA-256 of a file
+func fileSHA256(filePath string) (string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", filePath, err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", filePath, err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// isXanthusBinary reports whether an archive entry is the xanthus executable
+func isXanthusBinary(name string) bool {
+	base := path.Base(strings.ReplaceAll(name, "\\", "/"))
+	return strings.HasPrefix(base, "xanthus") && !strings.HasSuffix(base, ".txt")
+}
+
+// extractFromTarGz copies the xanthus binary out of a .tar.gz archive
+func extractFromTarGz(archivePath string, out io.Writer) error {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read gzip archive: %w", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read tar archive: %w", err)
+		}
+
+		if header.Typeflag == tar.TypeReg && isXanthusBinary(header.Name) {
+			if _, err := io.Copy(out, io.LimitReader(tr, maxBinarySize)); err != nil {
+				return fmt.Errorf("failed to extract binary: %w", err)
+			}
+			return nil
+		}
+	}
+
+	return fmt.Errorf("archive does not contain a xanthus binary")
+}
+
+// extractFromZip copies the xanthus binary out of a .zip archive
+func extractFromZip(archivePath string, out io.Writer) error {
+	zr, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive: %w", err)
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		if file.FileInfo().IsDir() || !isXanthusBinary(file.Name) {
+			continue
+		}
+
+		rc, err := file.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", file.Name, err)
+		}
+		_, err = io.Copy(out, io.LimitReader(rc, maxBinarySize))
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to extract binary: %w", err)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("archive does not contain a xanthus binary")
+}
+
+// osArgs returns the command line arguments of the running process without the program name
+func osArgs() []string {
+	if len(os.Args) > 1 {
+		return os.Args[1:]
+	}
+	return nil
+}
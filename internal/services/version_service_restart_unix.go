@@ -0,0 +1,12 @@
+//go:build !windows
+
+package services
+
+import "syscall"
+
+// restartProcess replaces the running process image with the binary at executablePath.
+// On success it never returns; listening sockets are closed on exec so the new
+// process can bind the same port.
+func restartProcess(executablePath string, env []string) error {
+	return syscall.Exec(executablePath, append([]string{executablePath}, osArgs()...), env)
+}
@@ -0,0 +1,20 @@
+//go:build windows
+
+package services
+
+import "os"
+
+// restartProcess starts the binary at executablePath as a new process and exits.
+// Windows has no exec(2), so the new instance is spawned before this one terminates.
+func restartProcess(executablePath string, env []string) error {
+	_, err := os.StartProcess(executablePath, append([]string{executablePath}, osArgs()...), &os.ProcAttr{
+		Env:   env,
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+	})
+	if err != nil {
+		return err
+	}
+
+	os.Exit(0)
+	return nil
+}
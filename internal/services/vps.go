@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -17,6 +18,7 @@ type VPSService struct {
 	cf       *CloudflareService
 	cache    *CacheService
 	provider *ProviderResolver
+	keys     *SSHKeyService
 }
 
 // NewVPSService creates a new VPS service instance
@@ -29,124 +31,279 @@ func NewVPSService() *VPSService {
 		cf:       NewCloudflareService(),
 		cache:    NewCacheService(),
 		provider: NewProviderResolver(kvService),
+		keys:     NewSSHKeyService(),
 	}
 }
 
-// CreateOCIVPSWithConfig creates an OCI VPS instance with full configuration
-func (vs *VPSService) CreateOCIVPSWithConfig(
-	token, accountID, ociAuthToken,
-	name, shape, region,
-	sshPublicKey, timezone string,
-	hourlyRate, monthlyRate float64,
-	ocpu, memory float32,
-) (*OCIInstance, *VPSConfig, error) {
-	// Create OCI service
-	ociService, err := NewOCIService(ociAuthToken)
+// CloudProvider returns the provider of a VPS configuration, bound to the account's credentials
+func (vs *VPSService) CloudProvider(token, accountID, provider string) (CloudProvider, error) {
+	return NewCloudProvider(provider, token, accountID)
+}
+
+// CreateServer creates a server on any registered provider with K3s and Helm
+// installed by cloud-init, and stores its configuration. req.Timezone defaults
+// to the provider's timezone for the location. With req.Join the server joins
+// an existing cluster as an agent node instead.
+func (vs *VPSService) CreateServer(ctx context.Context, token, accountID, provider string, req CloudServerRequest) (*CloudServer, *VPSConfig, error) {
+	cp, err := vs.CloudProvider(token, accountID, provider)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sshPublicKey, err := vs.accountSSHPublicKey(token, accountID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := StartJobStep(ctx, "Registering SSH key"); err != nil {
+		return nil, nil, err
+	}
+	sshKeyName, err := cp.RegisterSSHKey(ctx, fmt.Sprintf("xanthus-key-%d", time.Now().Unix()), sshPublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to register SSH key with %s: %w", cp.Name(), err)
+	}
+
+	hourlyRate, monthlyRate, err := cp.Pricing(ctx, req.ServerType, req.Location)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create OCI service: %w", err)
+		log.Printf("Warning: Could not get pricing for %s %s: %v", cp.Name(), req.ServerType, err)
+	}
+
+	if req.Timezone == "" {
+		req.Timezone = vs.provider.ResolveTimezone(cp.Name(), req.Location)
+	}
+	req.SSHKeyName = sshKeyName
+	req.SSHPublicKey = sshPublicKey
+	if req.Join != nil {
+		req.UserData = req.Join.userData(req.Name, req.Timezone)
+	} else {
+		req.UserData = RenderCloudInit(cp.CloudInit(), CloudInitVars{Timezone: req.Timezone})
 	}
 
-	// Create VPS instance
-	instance, err := ociService.CreateVPSWithK3s(context.Background(), name, shape, sshPublicKey, timezone, ocpu, memory)
+	if err := StartJobStep(ctx, fmt.Sprintf("Creating server on %s", cp.Name())); err != nil {
+		return nil, nil, err
+	}
+	server, err := cp.CreateServer(ctx, req)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create OCI instance: %w", err)
+		return nil, nil, fmt.Errorf("failed to create server: %w", err)
 	}
 
-	// Create VPS configuration
+	defaults := vs.provider.GetProviderDefaults(cp.Name())
 	vpsConfig := &VPSConfig{
-		ServerID:           vs.parseOCIInstanceID(instance.ID),
-		Name:               instance.DisplayName,
-		Provider:           "Oracle Cloud Infrastructure (OCI)",
-		Location:           region,
-		Region:             region, // Store actual region
-		ServerType:         shape,
-		PublicIPv4:         instance.PublicIP,
-		CreatedAt:          time.Now().Format(time.RFC3339),
-		Timezone:           timezone,
-		SSHUser:            "ubuntu", // OCI default
-		SSHPort:            22,
+		ServerID:           server.ID,
+		Name:               server.Name,
+		ServerType:         server.ServerType,
+		Location:           server.Location,
+		PublicIPv4:         server.PublicIPv4,
+		CreatedAt:          server.CreatedAt,
+		SSHKeyName:         sshKeyName,
+		SSHUser:            defaults.DefaultSSHUser,
+		SSHPort:            defaults.DefaultSSHPort,
 		HourlyRate:         hourlyRate,
 		MonthlyRate:        monthlyRate,
-		ProviderInstanceID: instance.ID,
-		OCPU:               ocpu,   // Store actual OCPU count
-		Memory:             memory, // Store actual memory in GB
-		Architecture:       "ARM64 Ampere Altra",
+		Timezone:           req.Timezone,
+		Provider:           cp.Name(),
+		ProviderInstanceID: server.InstanceID,
+		OCPU:               server.CPUs,
+		Memory:             server.MemoryGB,
+		Architecture:       server.Architecture,
+		PrivateIPv4:        server.PrivateIPv4,
+		PrivateNetwork:     req.PrivateNetwork,
+	}
+	if req.Join != nil {
+		vpsConfig.ClusterServerID = req.Join.ServerID
 	}
 
-	// Store VPS configuration
-	err = vs.kv.StoreVPSConfig(token, accountID, vpsConfig)
-	if err != nil {
-		// Attempt to cleanup the created instance if config storage fails
-		_ = ociService.TerminateInstance(context.Background(), instance.ID)
+	// A server without a configuration is invisible to Xanthus, so don't leave one behind
+	JobLogf(ctx, "Created server %s (ID: %d, IPv4: %s)", server.Name, server.ID, server.PublicIPv4)
+	if err := vs.kv.StoreVPSConfig(token, accountID, vpsConfig); err != nil {
+		if cleanupErr := cp.DeleteServer(ctx, vpsConfig); cleanupErr != nil {
+			log.Printf("Warning: Failed to delete server %s after config storage failed: %v", server.Name, cleanupErr)
+		}
 		return nil, nil, fmt.Errorf("failed to store VPS configuration: %w", err)
 	}
 
-	return instance, vpsConfig, nil
+	return server, vpsConfig, nil
 }
 
-// parseOCIInstanceID converts OCI instance OCID to integer for storage compatibility
-func (vs *VPSService) parseOCIInstanceID(instanceID string) int {
-	// Since OCI uses OCIDs (not simple integers), we'll use a hash approach
-	// This is a simple approach - in production you might want a more sophisticated mapping
-	hash := 0
-	for _, char := range instanceID {
-		hash = hash*31 + int(char)
+// DeleteServer deletes a server, all applications deployed on it and its
+// configuration. Agent nodes leave their cluster first; server nodes can't be
+// deleted while agents are joined to them. A server whose configuration is
+// lost or corrupt is deleted by ID through the default provider.
+func (vs *VPSService) DeleteServer(ctx context.Context, token, accountID string, serverID int) (*VPSConfig, error) {
+	vpsConfig, err := vs.kv.GetVPSConfig(token, accountID, serverID)
+	if err != nil {
+		log.Printf("Warning: Could not get VPS config for server %d, deleting it through %s: %v", serverID, ProviderHetzner, err)
+		vpsConfig = &VPSConfig{ServerID: serverID, Name: fmt.Sprintf("%d", serverID), Provider: ProviderHetzner}
+	}
+
+	cluster := clusterServiceFor(vs)
+	agents, err := cluster.agents(token, accountID, serverID)
+	if err != nil {
+		return vpsConfig, err
+	}
+	if len(agents) > 0 {
+		return vpsConfig, fmt.Errorf("%w: %s is the server node of %d agent nodes, delete them first", ErrInvalidServerRequest, vpsConfig.Name, len(agents))
+	}
+
+	cp, err := vs.CloudProvider(token, accountID, vpsConfig.Provider)
+	if err != nil {
+		return vpsConfig, err
+	}
+
+	if vpsConfig.IsAgent() {
+		if err := cluster.leave(ctx, token, accountID, vpsConfig); err != nil {
+			return vpsConfig, err
+		}
+	}
+
+	// Delete all applications associated with this VPS
+	if err := StartJobStep(ctx, "Deleting applications"); err != nil {
+		return vpsConfig, err
+	}
+	if err := vs.deleteAssociatedApplications(token, accountID, fmt.Sprintf("%d", serverID)); err != nil {
+		log.Printf("Warning: Failed to delete associated applications for VPS %d: %v", serverID, err)
+		// Continue with VPS deletion even if application cleanup fails
 	}
-	if hash < 0 {
-		hash = -hash
+
+	if err := StartJobStep(ctx, fmt.Sprintf("Deleting server on %s", cp.Name())); err != nil {
+		return vpsConfig, err
+	}
+	if err := cp.DeleteServer(ctx, vpsConfig); err != nil {
+		return vpsConfig, fmt.Errorf("failed to delete server: %w", err)
+	}
+
+	// Clean up VPS configuration from KV
+	if err := vs.kv.DeleteVPSConfig(token, accountID, serverID); err != nil {
+		log.Printf("Warning: Could not delete VPS config for server %d: %v", serverID, err)
 	}
-	// Use last 8 digits to avoid overflow and ensure uniqueness within reasonable bounds
-	return hash % 100000000
+
+	return vpsConfig, nil
 }
 
-// DeleteOCIVPS deletes an OCI VPS instance and cleans up configuration
-func (vs *VPSService) DeleteOCIVPS(token, accountID, ociAuthToken string, serverID int) error {
-	// Get VPS configuration to get the actual OCI instance ID
+// PowerAction powers a server off or on, or reboots it, through its provider
+func (vs *VPSService) PowerAction(ctx context.Context, token, accountID string, serverID int, action string) error {
 	vpsConfig, err := vs.kv.GetVPSConfig(token, accountID, serverID)
 	if err != nil {
 		return fmt.Errorf("failed to get VPS config: %w", err)
 	}
 
-	// We need to store the actual OCI instance ID in the config for proper deletion
-	// For now, this is a limitation - we'll need to improve the storage approach
-
-	// Create OCI service
-	ociService, err := NewOCIService(ociAuthToken)
+	cp, err := vs.CloudProvider(token, accountID, vpsConfig.Provider)
 	if err != nil {
-		return fmt.Errorf("failed to create OCI service: %w", err)
+		return err
 	}
 
-	// List instances to find the one with matching name/IP
-	instances, err := ociService.ListInstances(context.Background())
+	return cp.PowerAction(ctx, vpsConfig, action)
+}
+
+// AddExistingServer brings a server Xanthus didn't create under management. It
+// installs the account's SSH key (using req.Password when the key isn't trusted
+// yet), stores the configuration under provider Manual and starts the same K3s
+// bootstrap cloud-init runs on new servers, or with req.Join the agent
+// bootstrap. The bootstrap continues in the background on the server; its
+// progress is reported by the VPS status.
+func (vs *VPSService) AddExistingServer(ctx context.Context, token, accountID string, req ExistingServerRequest) (*VPSConfig, error) {
+	if req.Name == "" || req.Host == "" {
+		return nil, fmt.Errorf("%w: name and host are required", ErrInvalidServerRequest)
+	}
+	if req.SSHUser == "" {
+		req.SSHUser = "root"
+	}
+	if req.SSHPort == 0 {
+		req.SSHPort = 22
+	}
+	if req.SSHPort < 0 || req.SSHPort > 65535 {
+		return nil, fmt.Errorf("%w: invalid SSH port %d", ErrInvalidServerRequest, req.SSHPort)
+	}
+
+	vpsConfig := &VPSConfig{
+		Name:       req.Name,
+		ServerType: "manual",
+		Location:   "self-hosted",
+		PublicIPv4: req.Host,
+		CreatedAt:  time.Now().Format(time.RFC3339),
+		SSHKeyName: "xanthus-manual-key",
+		SSHUser:    req.SSHUser,
+		SSHPort:    req.SSHPort,
+		Provider:   ProviderManual,
+	}
+	vpsConfig.ServerID = hashServerID(ProviderManual + ":" + vpsConfig.SSHAddress())
+
+	if existing, err := vs.kv.GetVPSConfig(token, accountID, vpsConfig.ServerID); err == nil && existing != nil {
+		return nil, fmt.Errorf("%w: %s is already managed as %s", ErrInvalidServerRequest, vpsConfig.SSHAddress(), existing.Name)
+	}
+
+	sshKey, err := vs.keys.KeyPair(token, accountID)
 	if err != nil {
-		return fmt.Errorf("failed to list OCI instances: %w", err)
+		return nil, err
 	}
 
-	var instanceID string
-	for _, instance := range instances {
-		if instance.DisplayName == vpsConfig.Name || instance.PublicIP == vpsConfig.PublicIPv4 {
-			instanceID = instance.ID
-			break
+	if req.Password != "" {
+		if err := StartJobStep(ctx, "Installing SSH key"); err != nil {
+			return nil, err
+		}
+		passwordConn, err := vs.ssh.ConnectWithPassword(vpsConfig.SSHAddress(), req.SSHUser, req.Password)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect with password: %w", err)
+		}
+		err = installAuthorizedKey(vs.ssh, passwordConn, sshKey.PublicKey)
+		passwordConn.Close()
+		if err != nil {
+			return nil, err
 		}
 	}
 
-	if instanceID == "" {
-		return fmt.Errorf("could not find OCI instance for VPS %d", serverID)
+	if err := StartJobStep(ctx, "Inspecting server"); err != nil {
+		return nil, err
 	}
+	conn, err := vs.ssh.ConnectToVPS(vpsConfig.SSHAddress(), req.SSHUser, sshKey.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect with the Xanthus SSH key (add it to ~/.ssh/authorized_keys or provide a password): %w", err)
+	}
+	defer conn.Close()
 
-	// Delete the instance
-	err = ociService.TerminateInstance(context.Background(), instanceID)
+	facts, err := gatherManualServerFacts(vs.ssh, conn)
 	if err != nil {
-		return fmt.Errorf("failed to terminate OCI instance: %w", err)
+		return nil, err
+	}
+	vpsConfig.OCPU = facts.CPUs
+	vpsConfig.Memory = facts.MemoryGB
+	vpsConfig.Architecture = facts.Architecture
+	vpsConfig.Timezone = req.Timezone
+	if vpsConfig.Timezone == "" {
+		vpsConfig.Timezone = facts.Timezone
 	}
 
-	// Remove VPS configuration
-	err = vs.kv.DeleteVPSConfig(token, accountID, serverID)
+	userData := RenderCloudInit(defaultUserData, CloudInitVars{Timezone: vpsConfig.Timezone})
+	if req.Join != nil {
+		userData = req.Join.userData(vpsConfig.Name, vpsConfig.Timezone)
+		vpsConfig.ClusterServerID = req.Join.ServerID
+	}
+	script, err := CloudInitScript(userData)
 	if err != nil {
-		log.Printf("Warning: Failed to delete VPS config for %d: %v", serverID, err)
+		return nil, fmt.Errorf("failed to build bootstrap script: %w", err)
 	}
 
-	return nil
+	if err := StartJobStep(ctx, "Starting K3s bootstrap"); err != nil {
+		return nil, err
+	}
+	if err := vs.kv.StoreVPSConfig(token, accountID, vpsConfig); err != nil {
+		return nil, fmt.Errorf("failed to store VPS configuration: %w", err)
+	}
+
+	if err := startManualBootstrap(vs.ssh, conn, req.SSHUser, script); err != nil {
+		if deleteErr := vs.kv.DeleteVPSConfig(token, accountID, vpsConfig.ServerID); deleteErr != nil {
+			log.Printf("Warning: Failed to remove configuration of %s after bootstrap failed: %v", vpsConfig.Name, deleteErr)
+		}
+		return nil, err
+	}
+
+	log.Printf("✅ Added %s (%s) as server %d, K3s bootstrap running", vpsConfig.Name, vpsConfig.SSHAddress(), vpsConfig.ServerID)
+	return vpsConfig, nil
+}
+
+// accountSSHPublicKey returns the account's SSH public key
+func (vs *VPSService) accountSSHPublicKey(token, accountID string) (string, error) {
+	return vs.keys.PublicKey(token, accountID)
 }
 
 // EnhancedVPS represents a VPS with additional cost and status information
@@ -228,77 +385,6 @@ func (vs *VPSService) EnhanceServersWithCosts(token, accountID string, servers [
 	return nil
 }
 
-// CreateVPSWithConfig creates a VPS and stores its configuration
-func (vs *VPSService) CreateVPSWithConfig(
-	token, accountID, hetznerKey string,
-	name, serverType, location, domain string,
-	sshKeyName, sshPublicKey string,
-	domainCert, domainKey string,
-	hourlyRate, monthlyRate float64,
-) (*HetznerServer, *VPSConfig, error) {
-	// Calculate timezone for the location
-	timezone := vs.provider.ResolveTimezone("Hetzner", location)
-
-	// Create server using Hetzner service
-	server, err := vs.hetzner.CreateServer(hetznerKey, name, serverType, location, sshKeyName, domain, domainCert, domainKey, timezone)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create server: %w", err)
-	}
-
-	// Create VPS configuration
-	vpsConfig := &VPSConfig{
-		ServerID:    server.ID,
-		Name:        server.Name,
-		ServerType:  serverType,
-		Location:    location,
-		PublicIPv4:  server.PublicNet.IPv4.IP,
-		CreatedAt:   server.Created,
-		SSHKeyName:  sshKeyName,
-		SSHUser:     vs.provider.GetProviderDefaults("Hetzner").DefaultSSHUser,
-		SSHPort:     vs.provider.GetProviderDefaults("Hetzner").DefaultSSHPort,
-		HourlyRate:  hourlyRate,
-		MonthlyRate: monthlyRate,
-		Timezone:    timezone,
-		Provider:    "Hetzner",
-	}
-
-	// Store VPS configuration
-	if err := vs.kv.StoreVPSConfig(token, accountID, vpsConfig); err != nil {
-		log.Printf("Warning: Failed to store VPS config: %v", err)
-		// Don't fail the creation, just log the warning
-	}
-
-	return server, vpsConfig, nil
-}
-
-// DeleteVPSAndCleanup deletes a VPS and cleans up its configuration and all associated applications
-func (vs *VPSService) DeleteVPSAndCleanup(token, accountID, hetznerKey string, serverID int) (*VPSConfig, error) {
-	// Get VPS configuration before deletion (for logging)
-	vpsConfig, err := vs.kv.GetVPSConfig(token, accountID, serverID)
-	if err != nil {
-		log.Printf("Warning: Could not get VPS config for server %d: %v", serverID, err)
-	}
-
-	// Delete all applications associated with this VPS
-	if err := vs.deleteAssociatedApplications(token, accountID, fmt.Sprintf("%d", serverID)); err != nil {
-		log.Printf("Warning: Failed to delete associated applications for VPS %d: %v", serverID, err)
-		// Continue with VPS deletion even if application cleanup fails
-	}
-
-	// Delete server from Hetzner
-	if err := vs.hetzner.DeleteServer(hetznerKey, serverID); err != nil {
-		return vpsConfig, fmt.Errorf("failed to delete server: %w", err)
-	}
-
-	// Clean up VPS configuration from KV
-	if err := vs.kv.DeleteVPSConfig(token, accountID, serverID); err != nil {
-		log.Printf("Warning: Could not delete VPS config for server %d: %v", serverID, err)
-		// Don't fail the deletion, just log the warning
-	}
-
-	return vpsConfig, nil
-}
-
 // GetServersFromKV retrieves server list from KV store instead of Hetzner API
 func (vs *VPSService) GetServersFromKV(token, accountID string) ([]HetznerServer, error) {
 	// Check cache first - use accountID for proper user isolation
@@ -342,8 +428,8 @@ func (vs *VPSService) GetServersFromKV(token, accountID string) ([]HetznerServer
 		memory := resourceSpecs.Memory
 		locationDesc := vpsConfig.Location
 
-		// For OCI instances, use stored actual values if available
-		if vpsConfig.Provider == "Oracle Cloud Infrastructure (OCI)" {
+		// For OCI and manually added servers, use stored actual values if available
+		if vpsConfig.Provider == "Oracle Cloud Infrastructure (OCI)" || vpsConfig.Provider == ProviderManual {
 			if vpsConfig.OCPU > 0 {
 				cores = int(vpsConfig.OCPU)
 			}
@@ -393,6 +479,16 @@ func (vs *VPSService) GetServersFromKV(token, accountID string) ([]HetznerServer
 				"ip_address":          vpsConfig.PublicIPv4,
 			},
 		}
+		if vpsConfig.IsAgent() {
+			server.Labels["cluster_role"] = ClusterRoleAgent
+			server.Labels["cluster_server_id"] = strconv.Itoa(vpsConfig.ClusterServerID)
+			if clusterServer, ok := vpsConfigsMap[vpsConfig.ClusterServerID]; ok {
+				server.Labels["cluster_name"] = clusterServer.Name
+			}
+		}
+		if vpsConfig.PrivateIPv4 != "" {
+			server.Labels["private_ip"] = vpsConfig.PrivateIPv4
+		}
 
 		servers = append(servers, server)
 	}
@@ -423,6 +519,32 @@ func (vs *VPSService) UpdateVPSTimezone(token, accountID string, serverID int) e
 	return nil
 }
 
+// TrustHostKey replaces the pinned SSH host key of a server with the key it
+// presents now. Use it after a server was rebuilt or its SSH host keys regenerated.
+func (vs *VPSService) TrustHostKey(token, accountID string, serverID int) (*VPSConfig, error) {
+	vpsConfig, err := vs.kv.GetVPSConfig(token, accountID, serverID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get VPS config: %w", err)
+	}
+
+	key, err := vs.ssh.ScanHostKey(vpsConfig.SSHAddress())
+	if err != nil {
+		return nil, err
+	}
+
+	previous := vpsConfig.HostKeyFingerprint
+	setHostKey(vpsConfig, key)
+	if err := GetKnownHosts().Pin(vpsConfig.SSHAddress(), key); err != nil {
+		return nil, err
+	}
+	if err := vs.kv.StoreVPSConfig(token, accountID, vpsConfig); err != nil {
+		return nil, fmt.Errorf("failed to update VPS config: %w", err)
+	}
+
+	log.Printf("🔐 Re-trusted SSH host key of %s (%s): %s -> %s", vpsConfig.Name, vpsConfig.SSHAddress(), previous, vpsConfig.HostKeyFingerprint)
+	return vpsConfig, nil
+}
+
 // InvalidateVPSCache removes the VPS cache for the given account to force refresh
 func (vs *VPSService) InvalidateVPSCache(accountID string) {
 	cacheKey := "vps_servers:" + accountID
@@ -543,10 +665,11 @@ func (vs *VPSService) getApplicationCountsPerVPS(token, accountID string) (map[s
 	return counts, nil
 }
 
-// CreateOCIVPSConfig creates a VPS configuration for a manually added OCI instance
+// CreateOCIVPSConfig creates a VPS configuration for a manually added OCI
+// instance. instanceID is its OCID, or empty when it couldn't be looked up.
 func (vs *VPSService) CreateOCIVPSConfig(
 	token, accountID string,
-	name, publicIP, username, shape string,
+	name, publicIP, username, shape, instanceID string,
 	serverID int, privateKey, publicKey string,
 ) (*VPSConfig, error) {
 	// Default to Frankfurt region for Oracle Cloud (most common for European users)
@@ -557,19 +680,20 @@ func (vs *VPSService) CreateOCIVPSConfig(
 
 	// Create VPS configuration for OCI
 	vpsConfig := &VPSConfig{
-		ServerID:    serverID,
-		Name:        name,
-		ServerType:  shape,
-		Location:    location,
-		PublicIPv4:  publicIP,
-		CreatedAt:   time.Now().Format(time.RFC3339),
-		SSHKeyName:  "xanthus-oci-key",
-		SSHUser:     username,
-		SSHPort:     22,
-		HourlyRate:  0.0, // OCI instances are managed externally
-		MonthlyRate: 0.0, // Cost tracking handled outside Xanthus
-		Timezone:    timezone,
-		Provider:    "Oracle Cloud Infrastructure (OCI)",
+		ServerID:           serverID,
+		Name:               name,
+		ServerType:         shape,
+		Location:           location,
+		PublicIPv4:         publicIP,
+		CreatedAt:          time.Now().Format(time.RFC3339),
+		SSHKeyName:         "xanthus-oci-key",
+		SSHUser:            username,
+		SSHPort:            22,
+		HourlyRate:         0.0, // OCI instances are managed externally
+		MonthlyRate:        0.0, // Cost tracking handled outside Xanthus
+		Timezone:           timezone,
+		Provider:           "Oracle Cloud Infrastructure (OCI)",
+		ProviderInstanceID: instanceID,
 	}
 
 	// Store VPS configuration
@@ -577,19 +701,17 @@ func (vs *VPSService) CreateOCIVPSConfig(
 		return nil, fmt.Errorf("failed to store OCI VPS config: %w", err)
 	}
 
-	// Store SSH private key for this VPS
+	// Record the SSH public key of this VPS; the private key is only kept in the account's keypair
 	sshKeyData := struct {
-		PrivateKey string `json:"private_key"`
-		PublicKey  string `json:"public_key"`
-		VPSName    string `json:"vps_name"`
-		Provider   string `json:"provider"`
-		CreatedAt  string `json:"created_at"`
+		PublicKey string `json:"public_key"`
+		VPSName   string `json:"vps_name"`
+		Provider  string `json:"provider"`
+		CreatedAt string `json:"created_at"`
 	}{
-		PrivateKey: privateKey,
-		PublicKey:  publicKey,
-		VPSName:    name,
-		Provider:   "Oracle Cloud Infrastructure (OCI)",
-		CreatedAt:  time.Now().Format(time.RFC3339),
+		PublicKey: publicKey,
+		VPSName:   name,
+		Provider:  "Oracle Cloud Infrastructure (OCI)",
+		CreatedAt: time.Now().Format(time.RFC3339),
 	}
 
 	kvKey := fmt.Sprintf("vps:%d:ssh", serverID)
@@ -597,55 +719,70 @@ func (vs *VPSService) CreateOCIVPSConfig(
 		log.Printf("Warning: Failed to store SSH key for OCI VPS %d: %v", serverID, err)
 	}
 
-	// Start K3s setup in the background
-	go vs.setupOCIK3s(token, accountID, vpsConfig, privateKey)
+	// Set up K3s in the background, retrying while the instance may still be booting
+	GetJobManager().Start(token, accountID, JobSpec{
+		Type:        JobTypeVPSSetup,
+		Target:      name,
+		MaxAttempts: 3,
+		RetryDelay:  30 * time.Second,
+	}, func(ctx context.Context) error {
+		return vs.setupOCIK3s(ctx, vpsConfig, privateKey)
+	})
 
 	return vpsConfig, nil
 }
 
-// setupOCIK3s sets up K3s on the OCI instance in the background
-func (vs *VPSService) setupOCIK3s(token, accountID string, vpsConfig *VPSConfig, privateKey string) {
-	log.Printf("Starting K3s setup for OCI instance %s (ID: %d)", vpsConfig.Name, vpsConfig.ServerID)
+// setupOCIK3s installs K3s and Helm on an OCI instance
+func (vs *VPSService) setupOCIK3s(ctx context.Context, vpsConfig *VPSConfig, privateKey string) error {
+	JobLogf(ctx, "Starting K3s setup for OCI instance %s (ID: %d)", vpsConfig.Name, vpsConfig.ServerID)
 
 	// Create SSH connection to the OCI instance
-	sshConn, err := vs.ssh.ConnectToVPS(vpsConfig.PublicIPv4, vpsConfig.SSHUser, privateKey)
+	if err := StartJobStep(ctx, "Connecting to instance"); err != nil {
+		return err
+	}
+	sshConn, err := vs.ssh.ConnectToVPS(vpsConfig.SSHAddress(), vpsConfig.SSHUser, privateKey)
 	if err != nil {
-		log.Printf("Error connecting to OCI instance %s: %v", vpsConfig.Name, err)
-		return
+		return fmt.Errorf("failed to connect to OCI instance %s: %w", vpsConfig.Name, err)
 	}
 	defer sshConn.Close()
 
 	// Update system packages
-	log.Printf("Updating system packages on OCI instance %s", vpsConfig.Name)
+	if err := StartJobStep(ctx, "Updating system packages"); err != nil {
+		return err
+	}
 	if _, err := vs.ssh.ExecuteCommand(sshConn, "sudo apt update && sudo apt upgrade -y"); err != nil {
-		log.Printf("Warning: Failed to update packages on OCI instance %s: %v", vpsConfig.Name, err)
+		JobLogf(ctx, "Warning: Failed to update packages on OCI instance %s: %v", vpsConfig.Name, err)
 	}
 
 	// Install K3s
-	log.Printf("Installing K3s on OCI instance %s", vpsConfig.Name)
+	if err := StartJobStep(ctx, "Installing K3s"); err != nil {
+		return err
+	}
 	k3sInstallCommand := "curl -sfL https://get.k3s.io | sudo sh -s - --write-kubeconfig-mode 644"
 	if _, err := vs.ssh.ExecuteCommand(sshConn, k3sInstallCommand); err != nil {
-		log.Printf("Error installing K3s on OCI instance %s: %v", vpsConfig.Name, err)
-		return
+		return fmt.Errorf("failed to install K3s on OCI instance %s: %w", vpsConfig.Name, err)
 	}
 
 	// Wait for K3s to be ready
-	log.Printf("Waiting for K3s to be ready on OCI instance %s", vpsConfig.Name)
+	if err := StartJobStep(ctx, "Waiting for K3s"); err != nil {
+		return err
+	}
 	readyCommand := "sudo k3s kubectl wait --for=condition=Ready nodes --all --timeout=300s"
 	if _, err := vs.ssh.ExecuteCommand(sshConn, readyCommand); err != nil {
-		log.Printf("Warning: K3s readiness check timeout on OCI instance %s: %v", vpsConfig.Name, err)
+		JobLogf(ctx, "Warning: K3s readiness check timeout on OCI instance %s: %v", vpsConfig.Name, err)
 	}
 
 	// Set up KUBECONFIG environment variable for both ubuntu and root users
-	log.Printf("Setting up KUBECONFIG environment for OCI instance %s", vpsConfig.Name)
-
+	if err := StartJobStep(ctx, "Configuring KUBECONFIG"); err != nil {
+		return err
+	}
 	// Set up for ubuntu user
 	kubeconfigSetupUbuntu := `echo 'export KUBECONFIG=/etc/rancher/k3s/k3s.yaml' >> /home/ubuntu/.bashrc && 
 echo 'source <(kubectl completion bash)' >> /home/ubuntu/.bashrc && 
 echo 'alias k=kubectl' >> /home/ubuntu/.bashrc && 
 echo 'complete -F __start_kubectl k' >> /home/ubuntu/.bashrc`
 	if _, err := vs.ssh.ExecuteCommand(sshConn, kubeconfigSetupUbuntu); err != nil {
-		log.Printf("Warning: Failed to set up KUBECONFIG for ubuntu user on OCI instance %s: %v", vpsConfig.Name, err)
+		JobLogf(ctx, "Warning: Failed to set up KUBECONFIG for ubuntu user on OCI instance %s: %v", vpsConfig.Name, err)
 	}
 
 	// Set up for root user (for sudo operations)
@@ -654,23 +791,26 @@ echo "source <(kubectl completion bash)" >> /root/.bashrc &&
 echo "alias k=kubectl" >> /root/.bashrc && 
 echo "complete -F __start_kubectl k" >> /root/.bashrc'`
 	if _, err := vs.ssh.ExecuteCommand(sshConn, kubeconfigSetupRoot); err != nil {
-		log.Printf("Warning: Failed to set up KUBECONFIG for root user on OCI instance %s: %v", vpsConfig.Name, err)
+		JobLogf(ctx, "Warning: Failed to set up KUBECONFIG for root user on OCI instance %s: %v", vpsConfig.Name, err)
 	}
 
 	// Set up globally in environment
 	globalKubeconfigSetup := `sudo sh -c 'echo "KUBECONFIG=/etc/rancher/k3s/k3s.yaml" >> /etc/environment'`
 	if _, err := vs.ssh.ExecuteCommand(sshConn, globalKubeconfigSetup); err != nil {
-		log.Printf("Warning: Failed to set up global KUBECONFIG on OCI instance %s: %v", vpsConfig.Name, err)
+		JobLogf(ctx, "Warning: Failed to set up global KUBECONFIG on OCI instance %s: %v", vpsConfig.Name, err)
 	}
 
 	// Install Helm
-	log.Printf("Installing Helm on OCI instance %s", vpsConfig.Name)
+	if err := StartJobStep(ctx, "Installing Helm"); err != nil {
+		return err
+	}
 	helmInstallCommand := "curl https://raw.githubusercontent.com/helm/helm/main/scripts/get-helm-3 | bash"
 	if _, err := vs.ssh.ExecuteCommand(sshConn, helmInstallCommand); err != nil {
-		log.Printf("Warning: Failed to install Helm on OCI instance %s: %v", vpsConfig.Name, err)
+		JobLogf(ctx, "Warning: Failed to install Helm on OCI instance %s: %v", vpsConfig.Name, err)
 	}
 
-	log.Printf("✅ K3s setup completed for OCI instance %s (ID: %d)", vpsConfig.Name, vpsConfig.ServerID)
+	JobLogf(ctx, "✅ K3s setup completed for OCI instance %s (ID: %d)", vpsConfig.Name, vpsConfig.ServerID)
+	return nil
 }
 
 // ResolveSSHUser resolves the SSH user for a VPS using the provider resolver
@@ -761,6 +901,14 @@ func (vs *VPSService) getResourceSpecs(provider, serverType string) ResourceSpec
 		return vs.getHetznerResourceSpecs(serverType)
 	}
 
+	if provider == ProviderDigitalOcean {
+		return getDigitalOceanResourceSpecs(serverType)
+	}
+
+	if provider == ProviderManual {
+		return ResourceSpecs{Description: "Self-hosted server", CPUType: "Reported by the server"}
+	}
+
 	return defaultSpecs
 }
 
@@ -826,6 +974,29 @@ func (vs *VPSService) getOCIResourceSpecs(shape string) ResourceSpecs {
 	}
 }
 
+// digitalOceanSizeSlug matches droplet size slugs such as "s-2vcpu-4gb" and "s-1vcpu-512mb-10gb"
+var digitalOceanSizeSlug = regexp.MustCompile(`(\d+)vcpu-(\d+)(gb|mb)`)
+
+// getDigitalOceanResourceSpecs derives resource specifications from a droplet size slug
+func getDigitalOceanResourceSpecs(slug string) ResourceSpecs {
+	specs := ResourceSpecs{
+		Description: fmt.Sprintf("DigitalOcean %s", slug),
+		CPUType:     "Intel/AMD x86",
+	}
+
+	match := digitalOceanSizeSlug.FindStringSubmatch(slug)
+	if match == nil {
+		return specs
+	}
+	specs.Cores, _ = strconv.Atoi(match[1])
+	memory, _ := strconv.Atoi(match[2])
+	specs.Memory = float64(memory)
+	if match[3] == "mb" {
+		specs.Memory /= 1024
+	}
+	return specs
+}
+
 // UpdateOCIVPSLocation updates the location for Oracle Cloud VPS instances from "oracle-cloud" to actual region
 func (vs *VPSService) UpdateOCIVPSLocation(token, accountID string, serverID int, newLocation string) error {
 	// Get existing VPS configuration
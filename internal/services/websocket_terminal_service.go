@@ -40,6 +40,7 @@ type WebSocketTerminalSession struct {
 	cancel       context.CancelFunc
 	connections  map[*websocket.Conn]bool
 	connMutex    sync.RWMutex
+	connectErr   error
 }
 
 // TerminalMessage represents a message sent over WebSocket
@@ -83,7 +84,7 @@ func (s *WebSocketTerminalService) CreateSession(serverID int, host, user, priva
 		Auth: []ssh.AuthMethod{
 			ssh.PublicKeys(signer),
 		},
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // Note: In production, should verify host keys
+		HostKeyCallback: GetKnownHosts().HostKeyCallback(),
 		Timeout:         30 * time.Second,
 	}
 
@@ -112,6 +113,7 @@ func (s *WebSocketTerminalService) CreateSession(serverID int, host, user, priva
 	go func() {
 		if err := s.connectSSH(session, config); err != nil {
 			log.Printf("Failed to connect SSH for session %s: %v", sessionID, err)
+			session.connectErr = err
 			session.Status = "failed"
 		}
 	}()
@@ -123,9 +125,9 @@ func (s *WebSocketTerminalService) CreateSession(serverID int, host, user, priva
 // connectSSH establishes SSH connection for the session
 func (s *WebSocketTerminalService) connectSSH(session *WebSocketTerminalSession, config *ssh.ClientConfig) error {
 	// Connect to SSH server
-	client, err := ssh.Dial("tcp", session.Host+":22", config)
+	client, err := ssh.Dial("tcp", sshAddress(session.Host), config)
 	if err != nil {
-		return fmt.Errorf("failed to connect to SSH server: %v", err)
+		return fmt.Errorf("failed to connect to SSH server: %w", err)
 	}
 
 	session.sshClient = client
@@ -169,6 +171,9 @@ func (s *WebSocketTerminalService) HandleWebSocketConnection(sessionID string, c
 	}
 
 	if session.Status != "connected" {
+		if session.connectErr != nil {
+			return fmt.Errorf("SSH connection failed: %w", session.connectErr)
+		}
 		return fmt.Errorf("SSH connection failed")
 	}
 
@@ -230,6 +235,15 @@ func (s *WebSocketTerminalService) HandleWebSocketConnection(sessionID string, c
 		// Start output forwarding to all WebSocket connections
 		go s.forwardOutput(session, stdout, "stdout")
 		go s.forwardOutput(session, stderr, "stderr")
+
+		// Tell clients when the shell ends so they can detach
+		go func() {
+			sshSession.Wait()
+			s.broadcastToSession(session, map[string]string{
+				"type":    "exit",
+				"message": "Shell exited",
+			})
+		}()
 	}
 
 	// Handle WebSocket messages (input from client)
@@ -393,6 +407,13 @@ func (s *WebSocketTerminalService) ListSessionsForAccount(accountID string) []*W
 	return sessions
 }
 
+// GetActiveSessionCount returns the number of open terminal sessions of every account
+func (s *WebSocketTerminalService) GetActiveSessionCount() int {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return len(s.sessions)
+}
+
 // cleanupRoutine periodically cleans up inactive sessions
 func (s *WebSocketTerminalService) cleanupRoutine() {
 	ticker := time.NewTicker(5 * time.Minute)
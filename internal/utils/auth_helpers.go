@@ -14,21 +14,14 @@ type AuthResult struct {
 	Error     error
 }
 
-// ValidateTokenAndGetAccount validates the Cloudflare token and returns account ID
+// ValidateTokenAndGetAccount returns the Cloudflare token and account ID
+// resolved by the auth middleware for the signed-in user or API token.
 // This extracts the common pattern used across VPS handlers
 func ValidateTokenAndGetAccount(c *gin.Context) (*AuthResult, error) {
-	token, err := c.Cookie("cf_token")
-	if err != nil {
-		return &AuthResult{Valid: false, Error: fmt.Errorf("missing token cookie")}, err
-	}
-
-	if !VerifyCloudflareToken(token) {
-		return &AuthResult{Valid: false, Error: fmt.Errorf("invalid token")}, fmt.Errorf("invalid token")
-	}
-
-	_, accountID, err := CheckKVNamespaceExists(token)
-	if err != nil {
-		return &AuthResult{Valid: false, Error: fmt.Errorf("failed to get account ID: %w", err)}, err
+	token, accountID := c.GetString("cf_token"), c.GetString("account_id")
+	if token == "" || accountID == "" {
+		err := fmt.Errorf("not authenticated")
+		return &AuthResult{Valid: false, Error: err}, err
 	}
 
 	return &AuthResult{
@@ -43,11 +36,7 @@ func ValidateTokenAndGetAccount(c *gin.Context) (*AuthResult, error) {
 func ValidateTokenAndGetAccountJSON(c *gin.Context) (token, accountID string, valid bool) {
 	result, err := ValidateTokenAndGetAccount(c)
 	if err != nil || !result.Valid {
-		if result.Error.Error() == "missing token cookie" || result.Error.Error() == "invalid token" {
-			JSONUnauthorized(c, "Invalid token")
-		} else {
-			JSONInternalServerError(c, "Failed to get account ID")
-		}
+		JSONUnauthorized(c, "Invalid token")
 		return "", "", false
 	}
 	return result.Token, result.AccountID, true
@@ -87,6 +87,11 @@ func CheckKVNamespaceExists(token string) (bool, string, error) {
 
 	accountID := membershipResp.Result[0].Account.ID
 
+	// The namespace is only needed when state lives in Cloudflare KV
+	if !UsesCloudflareKV() {
+		return true, accountID, nil
+	}
+
 	// Check KV namespaces for this account
 	kvReq, err := http.NewRequest("GET", fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/storage/kv/namespaces", accountID), nil)
 	if err != nil {
@@ -163,48 +168,15 @@ func CreateKVNamespace(token, accountID string) error {
 	return nil
 }
 
-// PutKVValue stores a value in Cloudflare KV
+// PutKVValue stores a value in the configured state store
 func PutKVValue(client *http.Client, token, accountID, key string, value interface{}) error {
-	// First, get the Xanthus namespace ID
-	namespaceID, err := GetXanthusNamespaceID(client, token, accountID)
-	if err != nil {
-		return fmt.Errorf("failed to get namespace ID: %v", err)
-	}
-
 	// Marshal value to JSON
 	valueBytes, err := json.Marshal(value)
 	if err != nil {
 		return fmt.Errorf("failed to marshal value: %v", err)
 	}
 
-	// Create request
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/storage/kv/namespaces/%s/values/%s",
-		accountID, namespaceID, key)
-
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(valueBytes))
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to make request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	var kvResp models.CloudflareResponse
-	if err := json.NewDecoder(resp.Body).Decode(&kvResp); err != nil {
-		return fmt.Errorf("failed to decode response: %v", err)
-	}
-
-	if !kvResp.Success {
-		return fmt.Errorf("KV put failed: %v", kvResp.Errors)
-	}
-
-	return nil
+	return stateStoreWithClient(client).Put(token, accountID, key, valueBytes)
 }
 
 // GetXanthusNamespaceID retrieves the Xanthus namespace ID
@@ -242,46 +214,30 @@ func GetXanthusNamespaceID(client *http.Client, token, accountID string) (string
 	return "", fmt.Errorf("Xanthus namespace not found")
 }
 
-// GetKVValue retrieves a value from Cloudflare KV
+// GetKVValue retrieves a value from the configured state store
 func GetKVValue(client *http.Client, token, accountID, key string, result interface{}) error {
-	// Get the Xanthus namespace ID
-	namespaceID, err := GetXanthusNamespaceID(client, token, accountID)
-	if err != nil {
-		return fmt.Errorf("failed to get namespace ID: %v", err)
-	}
-
-	// Create request
-	url := fmt.Sprintf("https://api.cloudflare.com/client/v4/accounts/%s/storage/kv/namespaces/%s/values/%s",
-		accountID, namespaceID, key)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %v", err)
-	}
-
-	req.Header.Set("Authorization", "Bearer "+token)
-
-	resp, err := client.Do(req)
+	data, err := stateStoreWithClient(client).Get(token, accountID, key)
 	if err != nil {
-		return fmt.Errorf("failed to make request: %v", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode == 404 {
-		return fmt.Errorf("key not found in KV")
+		return err
 	}
 
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("KV API returned status %d", resp.StatusCode)
-	}
-
-	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+	if err := json.Unmarshal(data, result); err != nil {
 		return fmt.Errorf("failed to decode response: %v", err)
 	}
 
 	return nil
 }
 
+// stateStoreWithClient returns the configured state store, binding the
+// Cloudflare backend to the caller's HTTP client so its timeout is honored
+func stateStoreWithClient(client *http.Client) StateStore {
+	store := GetStateStore()
+	if cfStore, ok := store.(*CloudflareKVStore); ok {
+		return cfStore.WithClient(client)
+	}
+	return store
+}
+
 // FetchCloudflareDomains fetches all domain zones from Cloudflare
 func FetchCloudflareDomains(token string) ([]models.CloudflareDomain, error) {
 	client := &http.Client{Timeout: 8 * time.Second}
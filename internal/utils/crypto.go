@@ -6,9 +6,12 @@ import (
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"math/big"
+	"os"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v2"
@@ -84,6 +87,44 @@ func DecryptData(encryptedData, token string) (string, error) {
 	return string(plaintext), nil
 }
 
+// EnvSecretKey overrides the generated instance secret
+const EnvSecretKey = "XANTHUS_SECRET_KEY"
+
+// instanceSecretFile holds the generated instance secret inside the data directory
+const instanceSecretFile = "instance.key"
+
+// LoadInstanceSecret returns the secret that encrypts credentials owned by the
+// instance rather than by a user. XANTHUS_SECRET_KEY takes precedence; otherwise
+// a random secret is generated once and kept in dataDir.
+func LoadInstanceSecret(dataDir string) (string, error) {
+	if secret := strings.TrimSpace(os.Getenv(EnvSecretKey)); secret != "" {
+		return secret, nil
+	}
+
+	path := filepath.Join(dataDir, instanceSecretFile)
+	if data, err := os.ReadFile(path); err == nil {
+		if secret := strings.TrimSpace(string(data)); secret != "" {
+			return secret, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read instance secret: %v", err)
+	}
+
+	raw := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+		return "", fmt.Errorf("failed to generate instance secret: %v", err)
+	}
+	secret := hex.EncodeToString(raw)
+
+	if err := os.MkdirAll(dataDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create data directory: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(secret+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write instance secret: %v", err)
+	}
+	return secret, nil
+}
+
 // Base64Encode encodes a string to base64
 func Base64Encode(data string) string {
 	return base64.StdEncoding.EncodeToString([]byte(data))
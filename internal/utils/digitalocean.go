@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// digitalOceanKeyKV is the KV key of the encrypted DigitalOcean API token
+const digitalOceanKeyKV = "config:digitalocean:api_key"
+
+// GetDigitalOceanAPIKey retrieves and decrypts the DigitalOcean API token
+func GetDigitalOceanAPIKey(token, accountID string) (string, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	var encryptedKey string
+	if err := GetKVValue(client, token, accountID, digitalOceanKeyKV, &encryptedKey); err != nil {
+		return "", fmt.Errorf("failed to get DigitalOcean API token: %w", err)
+	}
+
+	apiKey, err := DecryptSecret(token, accountID, encryptedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt DigitalOcean API token: %w", err)
+	}
+	return apiKey, nil
+}
+
+// SetDigitalOceanAPIKey encrypts and stores the DigitalOcean API token
+func SetDigitalOceanAPIKey(token, accountID, apiKey string) error {
+	if apiKey == "" {
+		return fmt.Errorf("DigitalOcean API token is required")
+	}
+
+	encryptedKey, err := EncryptSecret(token, accountID, apiKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt DigitalOcean API token: %w", err)
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	if err := PutKVValue(client, token, accountID, digitalOceanKeyKV, encryptedKey); err != nil {
+		return fmt.Errorf("failed to store DigitalOcean API token: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	externalAPIRequests = Metrics().NewCounter("xanthus_external_api_requests_total",
+		"Requests to external APIs by service and HTTP status code, or \"error\" when no response was received", "service", "code")
+	externalAPIErrors = Metrics().NewCounter("xanthus_external_api_errors_total",
+		"Requests to external APIs that failed or were answered with a 4xx or 5xx status", "service")
+	externalAPIDuration = Metrics().NewHistogram("xanthus_external_api_request_duration_seconds",
+		"Latency of requests to external APIs", DefaultLatencyBuckets, "service")
+)
+
+// externalAPIHosts maps the hosts of external APIs, or their domains, to the
+// service named in metrics
+var externalAPIHosts = []struct{ suffix, service string }{
+	{"api.cloudflare.com", "cloudflare"},
+	{"api.hetzner.cloud", "hetzner"},
+	{"api.digitalocean.com", "digitalocean"},
+	{"oraclecloud.com", "oci"},
+	{"api.github.com", "github"},
+	{"github.com", "github"},
+	{"githubusercontent.com", "github"},
+	{"hub.docker.com", "dockerhub"},
+	{"api.letsencrypt.org", "letsencrypt"},
+}
+
+// ExternalAPIService names the external API served by host, or returns "" for
+// hosts that aren't one
+func ExternalAPIService(host string) string {
+	host = strings.ToLower(host)
+	if h, _, ok := strings.Cut(host, ":"); ok {
+		host = h
+	}
+	for _, api := range externalAPIHosts {
+		if host == api.suffix || strings.HasSuffix(host, "."+api.suffix) {
+			return api.service
+		}
+	}
+	return ""
+}
+
+// ObserveExternalAPIRequest records the latency and outcome of a request to an
+// external API; resp is nil when the request failed
+func ObserveExternalAPIRequest(service string, start time.Time, resp *http.Response, err error) {
+	externalAPIDuration.Observe(time.Since(start).Seconds(), service)
+	code := "error"
+	if err == nil && resp != nil {
+		code = strconv.Itoa(resp.StatusCode)
+	}
+	externalAPIRequests.Inc(service, code)
+	if code == "error" || resp.StatusCode >= 400 {
+		externalAPIErrors.Inc(service)
+	}
+}
+
+// MeteredTransport is an http.RoundTripper recording the latency and errors
+// of requests to external APIs, passing other requests through unmetered
+type MeteredTransport struct {
+	Base http.RoundTripper
+}
+
+// NewMeteredTransport wraps base, http.DefaultTransport when nil
+func NewMeteredTransport(base http.RoundTripper) *MeteredTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &MeteredTransport{Base: base}
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *MeteredTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	service := ExternalAPIService(req.URL.Host)
+	if service == "" {
+		return t.Base.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.Base.RoundTrip(req)
+	ObserveExternalAPIRequest(service, start, resp, err)
+	return resp, err
+}
+
+// MeteredDispatcher records the requests of clients that take an HTTP client
+// as anything with a Do method, like those of the OCI SDK
+type MeteredDispatcher struct {
+	Base interface {
+		Do(req *http.Request) (*http.Response, error)
+	}
+}
+
+// Do sends a request through the wrapped dispatcher
+func (d MeteredDispatcher) Do(req *http.Request) (*http.Response, error) {
+	service := ExternalAPIService(req.URL.Host)
+	if service == "" {
+		return d.Base.Do(req)
+	}
+
+	start := time.Now()
+	resp, err := d.Base.Do(req)
+	ObserveExternalAPIRequest(service, start, resp, err)
+	return resp, err
+}
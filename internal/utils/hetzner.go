@@ -106,7 +106,7 @@ func GetHetznerAPIKey(token, accountID string) (string, error) {
 		} else {
 			log.Printf("GetHetznerAPIKey: Successfully retrieved encrypted key for account %s on attempt %d, attempting decryption", accountID, attempt)
 
-			decryptedKey, err := DecryptData(encryptedKey, token)
+			decryptedKey, err := DecryptSecret(token, accountID, encryptedKey)
 			if err != nil {
 				log.Printf("GetHetznerAPIKey: Decryption failed for account %s: %v", accountID, err)
 				return "", fmt.Errorf("failed to decrypt Hetzner API key: %v", err)
@@ -0,0 +1,538 @@
+package utils
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Secrets in the state store (application passwords, provider API keys) are
+// encrypted with a random data-encryption key (DEK). The DEKs of an account are
+// kept in its keyring, wrapped by a key-encryption key (KEK) derived from either
+// the instance secret or the Cloudflare token, so rotating the token or the
+// secret only re-wraps the keyring instead of bricking every secret.
+//
+// Encrypted values use a versioned envelope: "xan1:<key id>:<base64 nonce+ciphertext>".
+// Values without the prefix are from before keyrings existed and are decrypted
+// with the Cloudflare token, as EncryptData did.
+
+// KEK sources accepted by XANTHUS_KEK_SOURCE
+const (
+	KEKSourceSecret = "secret"
+	KEKSourceToken  = "token"
+)
+
+// EnvKEKSource selects what wraps the data-encryption keys
+const EnvKEKSource = "XANTHUS_KEK_SOURCE"
+
+const (
+	envelopePrefix = "xan1:"
+	keyringKVKey   = "config:encryption:keyring"
+	keyringVersion = 1
+)
+
+// Keyring errors
+var (
+	ErrKeyringLocked = errors.New("keyring cannot be unlocked with the given credentials")
+	ErrUnknownKey    = errors.New("value is encrypted with a key that is not in the keyring")
+)
+
+// storedKeyring is the keyring as persisted: every DEK wrapped by the KEK
+type storedKeyring struct {
+	Version   int          `json:"version"`
+	KEKSource string       `json:"kek_source"`
+	Salt      string       `json:"salt"`
+	Current   string       `json:"current"`
+	Keys      []wrappedKey `json:"keys"`
+	RotatedAt *time.Time   `json:"rotated_at,omitempty"`
+}
+
+// wrappedKey is one DEK encrypted with the KEK
+type wrappedKey struct {
+	ID        string    `json:"id"`
+	Wrapped   string    `json:"wrapped"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// unlockedKeyring holds the plaintext DEKs of an account in memory
+type unlockedKeyring struct {
+	stored  storedKeyring
+	current string
+	keys    map[string][]byte
+	kek     []byte // Wraps stored, so keys can be added without re-wrapping the others
+}
+
+// Keyring encrypts secrets with per-account data-encryption keys
+type Keyring struct {
+	store     StateStore
+	secret    string
+	kekSource string
+
+	mu        sync.Mutex
+	unlocked  map[string]*unlockedKeyring // account ID -> keys
+	rotations map[string]*sync.Mutex      // account ID -> held from BeginRotation until Finish or Abort
+}
+
+// NewKeyring creates a keyring backed by store. New keyrings are wrapped with
+// secret when kekSource is KEKSourceSecret, or with the Cloudflare token.
+func NewKeyring(store StateStore, secret, kekSource string) *Keyring {
+	return &Keyring{
+		store:     store,
+		secret:    secret,
+		kekSource: kekSource,
+		unlocked:  make(map[string]*unlockedKeyring),
+		rotations: make(map[string]*sync.Mutex),
+	}
+}
+
+var (
+	defaultKeyring     *Keyring
+	defaultKeyringOnce sync.Once
+)
+
+// GetKeyring returns the keyring of the configured state store, wrapped as
+// XANTHUS_KEK_SOURCE selects (the instance secret by default)
+func GetKeyring() *Keyring {
+	defaultKeyringOnce.Do(func() {
+		if defaultKeyring != nil {
+			return
+		}
+		source := strings.ToLower(strings.TrimSpace(os.Getenv(EnvKEKSource)))
+		if source != KEKSourceToken {
+			source = KEKSourceSecret
+		}
+		secret, err := LoadInstanceSecret(DataDir())
+		if err != nil && source == KEKSourceSecret {
+			log.Printf("Warning: instance secret unavailable, wrapping keys with the Cloudflare token: %v", err)
+			source = KEKSourceToken
+		}
+		defaultKeyring = NewKeyring(GetStateStore(), secret, source)
+	})
+	return defaultKeyring
+}
+
+// SetKeyring replaces the process-wide keyring
+func SetKeyring(keyring *Keyring) {
+	defaultKeyringOnce.Do(func() {})
+	defaultKeyring = keyring
+}
+
+// EncryptSecret encrypts a secret of an account with its current data-encryption key
+func EncryptSecret(token, accountID, plaintext string) (string, error) {
+	return GetKeyring().Encrypt(token, accountID, plaintext)
+}
+
+// DecryptSecret decrypts a secret written by EncryptSecret, or by EncryptData with token
+func DecryptSecret(token, accountID, value string) (string, error) {
+	return GetKeyring().Decrypt(token, accountID, value)
+}
+
+// IsEnvelope reports whether value was written by EncryptSecret
+func IsEnvelope(value string) bool {
+	return strings.HasPrefix(value, envelopePrefix)
+}
+
+// Encrypt encrypts plaintext with the current key of the account, creating the keyring on first use
+func (k *Keyring) Encrypt(token, accountID, plaintext string) (string, error) {
+	k.mu.Lock()
+	ring, err := k.unlock(token, accountID, true)
+	k.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	return sealEnvelope(ring.current, ring.keys[ring.current], plaintext)
+}
+
+// Decrypt decrypts an envelope with the key it names. Values from before
+// keyrings existed are decrypted with the Cloudflare token.
+func (k *Keyring) Decrypt(token, accountID, value string) (string, error) {
+	if !IsEnvelope(value) {
+		return DecryptData(value, token)
+	}
+
+	k.mu.Lock()
+	ring, err := k.unlock(token, accountID, false)
+	k.mu.Unlock()
+	if err != nil {
+		return "", err
+	}
+	return openEnvelope(ring.keys, value)
+}
+
+// KeyRotation re-encrypts the secrets of an account under a fresh key
+type KeyRotation struct {
+	keyring   *Keyring
+	oldToken  string
+	newToken  string
+	accountID string
+	ring      *unlockedKeyring
+	retired   map[string]bool // Keys in the keyring when the rotation began
+	lock      *sync.Mutex
+	done      bool
+}
+
+// BeginRotation adds a new current key to the keyring of an account. The
+// keyring stays wrapped by the KEK it had, and older keys stay in it, until
+// Finish, so an interrupted rotation leaves every value readable with the old
+// token. Rotations of an account are serialized: BeginRotation waits until the
+// previous one is finished or aborted.
+func (k *Keyring) BeginRotation(oldToken, newToken, accountID string) (*KeyRotation, error) {
+	k.mu.Lock()
+	lock, ok := k.rotations[accountID]
+	if !ok {
+		lock = &sync.Mutex{}
+		k.rotations[accountID] = lock
+	}
+	k.mu.Unlock()
+
+	lock.Lock()
+	rotation, err := k.beginRotation(oldToken, newToken, accountID)
+	if err != nil {
+		lock.Unlock()
+		return nil, err
+	}
+	rotation.lock = lock
+	return rotation, nil
+}
+
+func (k *Keyring) beginRotation(oldToken, newToken, accountID string) (*KeyRotation, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	ring, err := k.unlock(oldToken, accountID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	id, key, err := newDataKey()
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := wrapKey(ring.kek, key)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := ring.stored
+	stored.Current = id
+	stored.Keys = append(append([]wrappedKey(nil), ring.stored.Keys...), wrappedKey{ID: id, Wrapped: wrapped, CreatedAt: time.Now().UTC()})
+	if err := k.put(oldToken, accountID, stored); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string][]byte, len(ring.keys)+1)
+	retired := make(map[string]bool, len(ring.keys))
+	for oldID, oldKey := range ring.keys {
+		keys[oldID] = oldKey
+		retired[oldID] = true
+	}
+	keys[id] = key
+
+	rotated := &unlockedKeyring{stored: stored, current: id, keys: keys, kek: ring.kek}
+	k.unlocked[accountID] = rotated
+	return &KeyRotation{keyring: k, oldToken: oldToken, newToken: newToken, accountID: accountID, ring: rotated, retired: retired}, nil
+}
+
+// Reencrypt decrypts value with any key of the keyring (or the old token for
+// values from before keyrings existed) and encrypts it with the new key
+func (r *KeyRotation) Reencrypt(value string) (string, error) {
+	plaintext, err := r.Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return sealEnvelope(r.ring.current, r.ring.keys[r.ring.current], plaintext)
+}
+
+// Decrypt decrypts value with any key of the keyring, or the old token
+func (r *KeyRotation) Decrypt(value string) (string, error) {
+	if !IsEnvelope(value) {
+		return DecryptData(value, r.oldToken)
+	}
+	return openEnvelope(r.ring.keys, value)
+}
+
+// Encrypt encrypts plaintext with the new key
+func (r *KeyRotation) Encrypt(plaintext string) (string, error) {
+	return sealEnvelope(r.ring.current, r.ring.keys[r.ring.current], plaintext)
+}
+
+// KeyID returns the ID of the new key
+func (r *KeyRotation) KeyID() string {
+	return r.ring.current
+}
+
+// Finish drops the keys that were in the keyring when the rotation began and
+// re-wraps the keyring for the new token (when the KEK is the token) under a
+// fresh salt. Call it only once all secrets have been re-encrypted, and once
+// the instance uses the new token.
+func (r *KeyRotation) Finish() error {
+	if r.done {
+		return fmt.Errorf("key rotation already ended")
+	}
+
+	k := r.keyring
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	ring := k.unlocked[r.accountID]
+	keys := make(map[string][]byte, len(ring.keys))
+	for id, key := range ring.keys {
+		if !r.retired[id] {
+			keys[id] = key
+		}
+	}
+
+	now := time.Now().UTC()
+	if _, err := k.wrap(r.newToken, r.accountID, ring.current, keys, ring.stored.Keys, &now); err != nil {
+		return err
+	}
+	r.done = true
+	r.lock.Unlock()
+	return nil
+}
+
+// Abort ends a rotation that won't be finished, letting the next one begin.
+// The new key stays in the keyring along with the old ones. It does nothing
+// after Finish.
+func (r *KeyRotation) Abort() {
+	if r.done {
+		return
+	}
+	r.done = true
+	r.lock.Unlock()
+}
+
+// unlock returns the keys of an account, loading and unwrapping them on first
+// use. With create, a missing keyring is created. Callers hold k.mu.
+func (k *Keyring) unlock(token, accountID string, create bool) (*unlockedKeyring, error) {
+	if ring, ok := k.unlocked[accountID]; ok {
+		return ring, nil
+	}
+
+	data, err := k.store.Get(token, accountID, keyringKVKey)
+	if errors.Is(err, ErrKeyNotFound) {
+		if !create {
+			return nil, ErrUnknownKey
+		}
+		id, key, err := newDataKey()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("🔑 Creating encryption keyring for account %s (KEK: %s)", accountID, k.kekSource)
+		return k.wrap(token, accountID, id, map[string][]byte{id: key}, nil, nil)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keyring: %w", err)
+	}
+
+	var stored storedKeyring
+	if err := json.Unmarshal(data, &stored); err != nil {
+		return nil, fmt.Errorf("failed to decode keyring: %w", err)
+	}
+	if stored.Version != keyringVersion {
+		return nil, fmt.Errorf("unsupported keyring version %d", stored.Version)
+	}
+
+	salt, err := base64.StdEncoding.DecodeString(stored.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode keyring salt: %w", err)
+	}
+	kek, err := k.deriveKEK(stored.KEKSource, token, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	ring := &unlockedKeyring{stored: stored, current: stored.Current, keys: make(map[string][]byte, len(stored.Keys)), kek: kek}
+	for _, wrapped := range stored.Keys {
+		key, err := unwrapKey(kek, wrapped.Wrapped)
+		if err != nil {
+			return nil, fmt.Errorf("%w (KEK: %s)", ErrKeyringLocked, stored.KEKSource)
+		}
+		ring.keys[wrapped.ID] = key
+	}
+	if _, ok := ring.keys[ring.current]; !ok {
+		return nil, fmt.Errorf("keyring has no current key")
+	}
+
+	k.unlocked[accountID] = ring
+	return ring, nil
+}
+
+// wrap wraps keys with a KEK for token (or the secret) under a fresh salt,
+// makes current the current key and stores the keyring. Callers hold k.mu.
+func (k *Keyring) wrap(token, accountID, current string, keys map[string][]byte, previous []wrappedKey, rotatedAt *time.Time) (*unlockedKeyring, error) {
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	kek, err := k.deriveKEK(k.kekSource, token, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt := make(map[string]time.Time, len(previous))
+	for _, wrapped := range previous {
+		createdAt[wrapped.ID] = wrapped.CreatedAt
+	}
+
+	stored := storedKeyring{
+		Version:   keyringVersion,
+		KEKSource: k.kekSource,
+		Salt:      base64.StdEncoding.EncodeToString(salt),
+		Current:   current,
+		RotatedAt: rotatedAt,
+	}
+	for id, key := range keys {
+		wrapped, err := wrapKey(kek, key)
+		if err != nil {
+			return nil, err
+		}
+		created, ok := createdAt[id]
+		if !ok {
+			created = time.Now().UTC()
+		}
+		stored.Keys = append(stored.Keys, wrappedKey{ID: id, Wrapped: wrapped, CreatedAt: created})
+	}
+
+	if err := k.put(token, accountID, stored); err != nil {
+		return nil, err
+	}
+	ring := &unlockedKeyring{stored: stored, current: current, keys: keys, kek: kek}
+	k.unlocked[accountID] = ring
+	return ring, nil
+}
+
+// put writes a keyring to the store
+func (k *Keyring) put(token, accountID string, stored storedKeyring) error {
+	data, err := json.Marshal(stored)
+	if err != nil {
+		return fmt.Errorf("failed to encode keyring: %w", err)
+	}
+	if err := k.store.Put(token, accountID, keyringKVKey, data); err != nil {
+		return fmt.Errorf("failed to store keyring: %w", err)
+	}
+	return nil
+}
+
+// deriveKEK derives the key-encryption key from the instance secret or the Cloudflare token
+func (k *Keyring) deriveKEK(source, token string, salt []byte) ([]byte, error) {
+	material := token
+	if source == KEKSourceSecret {
+		if k.secret == "" {
+			return nil, fmt.Errorf("%w: the instance secret is not available", ErrKeyringLocked)
+		}
+		material = k.secret
+	}
+	if material == "" {
+		return nil, fmt.Errorf("%w: no Cloudflare token", ErrKeyringLocked)
+	}
+	return argon2.IDKey([]byte(material), salt, 1, 64*1024, 4, 32), nil
+}
+
+// newDataKey generates a random 256-bit data-encryption key and its ID
+func newDataKey() (string, []byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	id := make([]byte, 4)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return "", nil, fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	return hex.EncodeToString(id), key, nil
+}
+
+// wrapKey encrypts a DEK with the KEK
+func wrapKey(kek, key []byte) (string, error) {
+	sealed, err := sealAESGCM(kek, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// unwrapKey decrypts a DEK with the KEK
+func unwrapKey(kek []byte, wrapped string) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, err
+	}
+	return openAESGCM(kek, sealed)
+}
+
+// sealEnvelope encrypts plaintext with a DEK into the envelope format
+func sealEnvelope(keyID string, key []byte, plaintext string) (string, error) {
+	sealed, err := sealAESGCM(key, []byte(plaintext))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt: %w", err)
+	}
+	return envelopePrefix + keyID + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// openEnvelope decrypts an envelope with the key it names
+func openEnvelope(keys map[string][]byte, value string) (string, error) {
+	keyID, payload, found := strings.Cut(strings.TrimPrefix(value, envelopePrefix), ":")
+	if !found {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	key, ok := keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode base64: %w", err)
+	}
+	plaintext, err := openAESGCM(key, sealed)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// sealAESGCM encrypts with AES-256-GCM, prefixing the nonce
+func sealAESGCM(key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// openAESGCM decrypts the output of sealAESGCM
+func openAESGCM(key, sealed []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
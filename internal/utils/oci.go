@@ -89,7 +89,7 @@ func EncodeOCIAuthToken(creds *OCICredentials) (string, error) {
 	return base64.StdEncoding.EncodeToString(jsonData), nil
 }
 
-// GetOCIAuthToken retrieves OCI auth token from Cloudflare KV
+// GetOCIAuthToken retrieves and decrypts the OCI auth token from Cloudflare KV
 func GetOCIAuthToken(token, accountID string) (string, error) {
 	if token == "" {
 		return "", fmt.Errorf("cloudflare token is required")
@@ -110,10 +110,18 @@ func GetOCIAuthToken(token, accountID string) (string, error) {
 		return "", fmt.Errorf("OCI auth token not found in KV store")
 	}
 
-	return ociToken, nil
+	// Tokens stored before secrets were encrypted are plain base64 JSON
+	if !IsEnvelope(ociToken) {
+		return ociToken, nil
+	}
+	decrypted, err := DecryptSecret(token, accountID, ociToken)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt OCI auth token: %w", err)
+	}
+	return decrypted, nil
 }
 
-// SetOCIAuthToken stores OCI auth token in Cloudflare KV
+// SetOCIAuthToken encrypts and stores the OCI auth token in Cloudflare KV
 func SetOCIAuthToken(token, accountID, ociToken string) error {
 	if token == "" {
 		return fmt.Errorf("cloudflare token is required")
@@ -131,9 +139,14 @@ func SetOCIAuthToken(token, accountID, ociToken string) error {
 		return fmt.Errorf("invalid OCI auth token: %w", err)
 	}
 
+	encrypted, err := EncryptSecret(token, accountID, ociToken)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt OCI auth token: %w", err)
+	}
+
 	// Store in KV using the same pattern as Hetzner
 	client := &http.Client{Timeout: 10 * time.Second}
-	err = PutKVValue(client, token, accountID, "oci_token", ociToken)
+	err = PutKVValue(client, token, accountID, "oci_token", encrypted)
 	if err != nil {
 		return fmt.Errorf("failed to store OCI auth token: %w", err)
 	}
@@ -0,0 +1,310 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A small Prometheus registry writing the text exposition format
+// (https://prometheus.io/docs/instrumenting/exposition_formats/). Metrics are
+// registered once, usually in package-level variables, and labelled by value
+// when they are updated.
+
+// MetricKind is the Prometheus type of a metric
+type MetricKind string
+
+const (
+	KindCounter   MetricKind = "counter"
+	KindGauge     MetricKind = "gauge"
+	KindHistogram MetricKind = "histogram"
+)
+
+// DefaultLatencyBuckets are histogram buckets, in seconds, for request latencies
+var DefaultLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// MetricsRegistry holds metrics and writes them in the text exposition format
+type MetricsRegistry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+// metric is anything that can write the lines of one metric family
+type metric interface {
+	name() string
+	write(w io.Writer) error
+}
+
+var defaultRegistry = NewMetricsRegistry()
+
+// Metrics returns the process-wide registry served on /metrics
+func Metrics() *MetricsRegistry {
+	return defaultRegistry
+}
+
+// NewMetricsRegistry creates an empty registry
+func NewMetricsRegistry() *MetricsRegistry {
+	return &MetricsRegistry{names: make(map[string]bool)}
+}
+
+func (r *MetricsRegistry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[m.name()] {
+		panic("metric registered twice: " + m.name())
+	}
+	r.names[m.name()] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// Write writes every metric of the registry, sorted by name
+func (r *MetricsRegistry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name() < metrics[j].name() })
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// family is the name, help and label names shared by every kind of metric
+type family struct {
+	metricName string
+	help       string
+	kind       MetricKind
+	labels     []string
+}
+
+func (f *family) name() string { return f.metricName }
+
+func (f *family) header(w io.Writer) error {
+	help := strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(f.help)
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.metricName, help, f.metricName, f.kind)
+	return err
+}
+
+// key joins label values into a map key
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metric %s has labels %v, got values %v", f.metricName, f.labels, values))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// sample writes one line: name{labels} value. extra adds a label after the
+// metric's own, like the le of histogram buckets.
+func (f *family) sample(w io.Writer, suffix string, values []string, extra []string, value float64) error {
+	pairs := make([]string, 0, len(values)+1)
+	for i, value := range values {
+		pairs = append(pairs, f.labels[i]+`="`+labelEscaper.Replace(value)+`"`)
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+extra[1]+`"`)
+	}
+	labels := ""
+	if len(pairs) > 0 {
+		labels = "{" + strings.Join(pairs, ",") + "}"
+	}
+	_, err := fmt.Fprintf(w, "%s%s%s %s\n", f.metricName, suffix, labels, formatSampleValue(value))
+	return err
+}
+
+// labelEscaper escapes label values as the exposition format requires
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatSampleValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// splitKey turns a map key back into label values
+func splitKey(key string, n int) []string {
+	if n == 0 {
+		return nil
+	}
+	return strings.Split(key, "\xff")
+}
+
+// Counter is a monotonically increasing metric, by label values
+type Counter struct {
+	family
+	mu     sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter registers a counter in the registry
+func (r *MetricsRegistry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{family: family{name, help, KindCounter, labels}, values: make(map[string]float64)}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the counter with the given label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds delta, which must not be negative, to the counter with the given label values
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+// Value returns the counter with the given label values
+func (c *Counter) Value(labelValues ...string) float64 {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[key]
+}
+
+func (c *Counter) write(w io.Writer) error {
+	c.mu.Lock()
+	values := make(map[string]float64, len(c.values))
+	for key, value := range c.values {
+		values[key] = value
+	}
+	c.mu.Unlock()
+
+	if err := c.header(w); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(values) {
+		if err := c.sample(w, "", splitKey(key, len(c.labels)), nil, values[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Histogram counts observations, like request latencies, in buckets
+type Histogram struct {
+	family
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // Per bucket, not cumulative
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram registers a histogram with the given upper bounds, in increasing order
+func (r *MetricsRegistry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	h := &Histogram{family: family{name, help, KindHistogram, labels}, buckets: buckets, series: make(map[string]*histogramSeries)}
+	r.register(h)
+	return h
+}
+
+// Observe records a value in the histogram with the given label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.count++
+	s.sum += value
+}
+
+func (h *Histogram) write(w io.Writer) error {
+	h.mu.Lock()
+	series := make(map[string]histogramSeries, len(h.series))
+	for key, s := range h.series {
+		series[key] = histogramSeries{counts: append([]uint64(nil), s.counts...), count: s.count, sum: s.sum}
+	}
+	h.mu.Unlock()
+
+	if err := h.header(w); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(series) {
+		s, values := series[key], splitKey(key, len(h.labels))
+		cumulative := uint64(0)
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			if err := h.sample(w, "_bucket", values, []string{"le", formatSampleValue(bound)}, float64(cumulative)); err != nil {
+				return err
+			}
+		}
+		if err := h.sample(w, "_bucket", values, []string{"le", "+Inf"}, float64(s.count)); err != nil {
+			return err
+		}
+		if err := h.sample(w, "_sum", values, nil, s.sum); err != nil {
+			return err
+		}
+		if err := h.sample(w, "_count", values, nil, float64(s.count)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MetricSample is one value of a collected metric with its label values
+type MetricSample struct {
+	Value  float64
+	Labels []string
+}
+
+// collected is a metric whose values are read from elsewhere when it is written
+type collected struct {
+	family
+	collect func() []MetricSample
+}
+
+// NewCollected registers a gauge or counter whose samples are returned by
+// collect every time the registry is written, for values that are already
+// tracked elsewhere like the size of a cache
+func (r *MetricsRegistry) NewCollected(name, help string, kind MetricKind, labels []string, collect func() []MetricSample) {
+	r.register(&collected{family: family{name, help, kind, labels}, collect: collect})
+}
+
+func (c *collected) write(w io.Writer) error {
+	if err := c.header(w); err != nil {
+		return err
+	}
+	for _, s := range c.collect() {
+		c.key(s.Labels) // Checks the number of label values
+		if err := c.sample(w, "", s.Labels, nil, s.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
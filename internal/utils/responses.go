@@ -7,6 +7,9 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// JobIDHeader names the job that carried out a request's work, so it can be inspected under /jobs
+const JobIDHeader = "X-Job-ID"
+
 // SuccessResponse represents a standardized success response
 type SuccessResponse struct {
 	Success bool        `json:"success"`
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+)
+
+// ErrKeyNotFound is returned by state stores when a key does not exist
+var ErrKeyNotFound = errors.New("key not found in KV")
+
+// State store backend names accepted by XANTHUS_STATE_BACKEND
+const (
+	StateBackendCloudflare = "cloudflare"
+	StateBackendLocal      = "local"
+)
+
+// DefaultDataDir is the directory used by the local state store when XANTHUS_DATA_DIR is unset
+const DefaultDataDir = "data"
+
+// StateStore is a key/value backend for all persisted Xanthus state.
+// Values are opaque JSON documents; keys use the "prefix:id:field" convention
+// (e.g. "vps:123:config", "app:app-1:password"). Token and account ID are passed
+// through so remote backends can authenticate and local backends can isolate accounts.
+type StateStore interface {
+	// Get returns the raw value stored under key, or ErrKeyNotFound
+	Get(token, accountID, key string) ([]byte, error)
+	// Put stores the raw value under key, replacing any existing value
+	Put(token, accountID, key string, value []byte) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(token, accountID, key string) error
+	// ListKeys returns all keys starting with prefix
+	ListKeys(token, accountID, prefix string) ([]string, error)
+	// Name returns the backend name for logging and diagnostics
+	Name() string
+}
+
+var (
+	stateStore      StateStore = NewCloudflareKVStore()
+	stateStoreMutex sync.RWMutex
+)
+
+// GetStateStore returns the state store selected at startup
+func GetStateStore() StateStore {
+	stateStoreMutex.RLock()
+	defer stateStoreMutex.RUnlock()
+	return stateStore
+}
+
+// SetStateStore replaces the process-wide state store
+func SetStateStore(store StateStore) {
+	stateStoreMutex.Lock()
+	defer stateStoreMutex.Unlock()
+	stateStore = store
+}
+
+// UsesCloudflareKV reports whether state is persisted in Cloudflare KV
+func UsesCloudflareKV() bool {
+	_, ok := GetStateStore().(*CloudflareKVStore)
+	return ok
+}
+
+// NewStateStoreFromEnv builds the state store configured through environment variables.
+// XANTHUS_STATE_BACKEND selects "cloudflare" (default) or "local"; the local backend
+// keeps its files under XANTHUS_DATA_DIR (default "data").
+func NewStateStoreFromEnv() (StateStore, error) {
+	backend := strings.ToLower(strings.TrimSpace(os.Getenv("XANTHUS_STATE_BACKEND")))
+
+	switch backend {
+	case "", StateBackendCloudflare:
+		return NewCloudflareKVStore(), nil
+	case StateBackendLocal:
+		return NewLocalStateStore(DataDir())
+	default:
+		return nil, fmt.Errorf("unknown state backend %q (expected %q or %q)", backend, StateBackendCloudflare, StateBackendLocal)
+	}
+}
+
+// DataDir returns the directory for files Xanthus keeps on local disk (XANTHUS_DATA_DIR)
+func DataDir() string {
+	if dataDir := os.Getenv("XANTHUS_DATA_DIR"); dataDir != "" {
+		return dataDir
+	}
+	return DefaultDataDir
+}
+
+// InitStateStoreFromEnv selects the process-wide state store from the environment
+func InitStateStoreFromEnv() error {
+	store, err := NewStateStoreFromEnv()
+	if err != nil {
+		return err
+	}
+
+	SetStateStore(store)
+	log.Printf("💾 Using %s state store", store.Name())
+	return nil
+}
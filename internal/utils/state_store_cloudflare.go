@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/models"
+)
+
+// CloudflareAPIBaseURL is the Cloudflare v4 API endpoint used by default
+const CloudflareAPIBaseURL = "https://api.cloudflare.com/client/v4"
+
+// CloudflareKVStore persists state in the "Xanthus" Cloudflare Workers KV namespace
+type CloudflareKVStore struct {
+	client  *http.Client
+	baseURL string
+
+	// Namespace IDs are shared between copies bound to different HTTP clients
+	namespaces *namespaceCache
+}
+
+type namespaceCache struct {
+	mutex sync.RWMutex
+	ids   map[string]string
+}
+
+// NewCloudflareKVStore creates a Cloudflare KV backed state store
+func NewCloudflareKVStore() *CloudflareKVStore {
+	return NewCloudflareKVStoreWithURL(CloudflareAPIBaseURL)
+}
+
+// NewCloudflareKVStoreWithURL creates a Cloudflare KV store against a custom API base URL
+func NewCloudflareKVStoreWithURL(baseURL string) *CloudflareKVStore {
+	return &CloudflareKVStore{
+		client:     &http.Client{Timeout: 10 * time.Second},
+		baseURL:    baseURL,
+		namespaces: &namespaceCache{ids: make(map[string]string)},
+	}
+}
+
+// WithClient returns a copy of the store that issues requests with the given client
+func (s *CloudflareKVStore) WithClient(client *http.Client) *CloudflareKVStore {
+	if client == nil {
+		return s
+	}
+	bound := *s
+	bound.client = client
+	return &bound
+}
+
+// Name returns the backend name
+func (s *CloudflareKVStore) Name() string {
+	return StateBackendCloudflare
+}
+
+// namespaceID resolves (and caches) the Xanthus namespace ID for an account
+func (s *CloudflareKVStore) namespaceID(token, accountID string) (string, error) {
+	s.namespaces.mutex.RLock()
+	id, exists := s.namespaces.ids[accountID]
+	s.namespaces.mutex.RUnlock()
+	if exists {
+		return id, nil
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/accounts/%s/storage/kv/namespaces", s.baseURL, accountID), nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error making request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var kvResp models.KVNamespaceResponse
+	if err := json.NewDecoder(resp.Body).Decode(&kvResp); err != nil {
+		return "", fmt.Errorf("error decoding response: %v", err)
+	}
+
+	if !kvResp.Success {
+		return "", fmt.Errorf("KV API failed: %v", kvResp.Errors)
+	}
+
+	for _, ns := range kvResp.Result {
+		if ns.Title == "Xanthus" {
+			s.namespaces.mutex.Lock()
+			s.namespaces.ids[accountID] = ns.ID
+			s.namespaces.mutex.Unlock()
+			return ns.ID, nil
+		}
+	}
+
+	return "", fmt.Errorf("Xanthus namespace not found")
+}
+
+// valueURL builds the URL of a single KV value
+func (s *CloudflareKVStore) valueURL(token, accountID, key string) (string, error) {
+	namespaceID, err := s.namespaceID(token, accountID)
+	if err != nil {
+		return "", fmt.Errorf("failed to get namespace ID: %v", err)
+	}
+
+	return fmt.Sprintf("%s/accounts/%s/storage/kv/namespaces/%s/values/%s",
+		s.baseURL, accountID, namespaceID, key), nil
+}
+
+// Get retrieves a raw value from Cloudflare KV
+func (s *CloudflareKVStore) Get(token, accountID, key string) ([]byte, error) {
+	valueURL, err := s.valueURL(token, accountID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("GET", valueURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrKeyNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("KV API returned status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	return data, nil
+}
+
+// Put stores a raw value in Cloudflare KV
+func (s *CloudflareKVStore) Put(token, accountID, key string, value []byte) error {
+	valueURL, err := s.valueURL(token, accountID, key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", valueURL, bytes.NewReader(value))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var kvResp models.CloudflareResponse
+	if err := json.NewDecoder(resp.Body).Decode(&kvResp); err != nil {
+		return fmt.Errorf("failed to decode response: %v", err)
+	}
+
+	if !kvResp.Success {
+		return fmt.Errorf("KV put failed: %v", kvResp.Errors)
+	}
+
+	return nil
+}
+
+// Delete removes a value from Cloudflare KV
+func (s *CloudflareKVStore) Delete(token, accountID, key string) error {
+	valueURL, err := s.valueURL(token, accountID, key)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("DELETE", valueURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to make request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("KV API returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// ListKeys lists all keys with the given prefix, following Cloudflare's pagination cursor
+func (s *CloudflareKVStore) ListKeys(token, accountID, prefix string) ([]string, error) {
+	namespaceID, err := s.namespaceID(token, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get namespace ID: %v", err)
+	}
+
+	var keys []string
+	cursor := ""
+	for {
+		query := url.Values{}
+		query.Set("prefix", prefix)
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+
+		listURL := fmt.Sprintf("%s/accounts/%s/storage/kv/namespaces/%s/keys?%s",
+			s.baseURL, accountID, namespaceID, query.Encode())
+
+		req, err := http.NewRequest("GET", listURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %v", err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to make request: %v", err)
+		}
+
+		var keysResp struct {
+			Success bool `json:"success"`
+			Result  []struct {
+				Name string `json:"name"`
+			} `json:"result"`
+			ResultInfo struct {
+				Cursor string `json:"cursor"`
+			} `json:"result_info"`
+			Errors []struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"errors"`
+		}
+
+		err = json.NewDecoder(resp.Body).Decode(&keysResp)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode response: %v", err)
+		}
+
+		if !keysResp.Success {
+			return nil, fmt.Errorf("KV API failed: %v", keysResp.Errors)
+		}
+
+		for _, key := range keysResp.Result {
+			keys = append(keys, key.Name)
+		}
+
+		cursor = keysResp.ResultInfo.Cursor
+		if cursor == "" {
+			break
+		}
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,157 @@
+package utils
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LocalStateStore persists state as one file per key on the local filesystem.
+// Each account gets its own directory, and key names are base64url-encoded so
+// that keys containing ":" or "/" are safe on every platform.
+type LocalStateStore struct {
+	dir   string
+	mutex sync.RWMutex
+}
+
+// NewLocalStateStore creates a file-backed state store rooted at dir
+func NewLocalStateStore(dir string) (*LocalStateStore, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("data directory is required for the local state store")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create data directory %s: %w", dir, err)
+	}
+
+	return &LocalStateStore{dir: dir}, nil
+}
+
+// Name returns the backend name
+func (s *LocalStateStore) Name() string {
+	return StateBackendLocal
+}
+
+// Dir returns the root directory of the store
+func (s *LocalStateStore) Dir() string {
+	return s.dir
+}
+
+// accountDir returns the directory holding all keys of an account
+func (s *LocalStateStore) accountDir(accountID string) string {
+	if accountID == "" {
+		accountID = "default"
+	}
+	return filepath.Join(s.dir, "state", base64.RawURLEncoding.EncodeToString([]byte(accountID)))
+}
+
+// keyPath returns the file path for a key
+func (s *LocalStateStore) keyPath(accountID, key string) string {
+	return filepath.Join(s.accountDir(accountID), base64.RawURLEncoding.EncodeToString([]byte(key))+".json")
+}
+
+// Get reads a value from disk
+func (s *LocalStateStore) Get(token, accountID, key string) ([]byte, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data, err := os.ReadFile(s.keyPath(accountID, key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to read key %s: %w", key, err)
+	}
+
+	return data, nil
+}
+
+// Put writes a value to disk atomically (write to a temp file, then rename)
+func (s *LocalStateStore) Put(token, accountID, key string, value []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	dir := s.accountDir(accountID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create account directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	if _, err := tmp.Write(value); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to write key %s: %w", key, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to sync key %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to close key %s: %w", key, err)
+	}
+
+	if err := os.Rename(tmpName, s.keyPath(accountID, key)); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("failed to store key %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Delete removes a value from disk
+func (s *LocalStateStore) Delete(token, accountID, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.Remove(s.keyPath(accountID, key)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete key %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// ListKeys returns all keys of the account that start with prefix, sorted
+func (s *LocalStateStore) ListKeys(token, accountID, prefix string) ([]string, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	entries, err := os.ReadDir(s.accountDir(accountID))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+
+	keys := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+
+		decoded, err := base64.RawURLEncoding.DecodeString(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+
+		key := string(decoded)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
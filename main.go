@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"html/template"
@@ -13,10 +14,13 @@ import (
 	"time"
 
 	"github.com/chrishham/xanthus/internal/handlers"
+	"github.com/chrishham/xanthus/internal/handlers/api"
 	"github.com/chrishham/xanthus/internal/handlers/applications"
 	"github.com/chrishham/xanthus/internal/handlers/vps"
+	"github.com/chrishham/xanthus/internal/middleware"
 	"github.com/chrishham/xanthus/internal/router"
 	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
@@ -32,9 +36,33 @@ func main() {
 	fmt.Printf("🚀 Xanthus %s is starting on http://localhost:%s\n", version, port)
 	fmt.Printf("📊 Platform: %s | Go: %s\n", platform, goVersion)
 
+	// Record the latency and errors of requests to Cloudflare, cloud providers
+	// and GitHub, which are all made through the default transport
+	http.DefaultTransport = utils.NewMeteredTransport(http.DefaultTransport)
+
+	// Select the state store backend (Cloudflare KV or local)
+	if err := utils.InitStateStoreFromEnv(); err != nil {
+		log.Fatal("Failed to initialize state store:", err)
+	}
+
+	// Background jobs act on the Cloudflare account of the instance, or of XANTHUS_CLOUDFLARE_TOKEN
+	registerInstanceAccount()
+	registerBackgroundAccountFromEnv()
+	loadHostKeys()
+
+	// Renew domain certificates before they expire
+	services.GetCertRenewalService().Start(context.Background())
+
+	// Compare stored state with the real infrastructure
+	services.GetReconciler().Start(context.Background())
+
+	// Sample the usage of servers and applications for their charts
+	services.GetMetricsCollector().Start(context.Background())
+
 	// Initialize Gin
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
+	r.Use(middleware.RequestMetrics())
 
 	// Configure security
 	r.SetTrustedProxies([]string{"127.0.0.1", "::1"})
@@ -64,6 +92,9 @@ func main() {
 	webSocketTerminalHandler := handlers.NewWebSocketTerminalHandlerWithService(wsTerminalService)
 	pagesHandler := handlers.NewPagesHandler()
 	versionHandler := handlers.NewVersionHandler()
+	usersHandler := handlers.NewUsersHandler()
+	apiHandler := api.NewHandler(appsHandler, versionHandler, wsTerminalService)
+	metricsHandler := handlers.NewMetricsHandler(wsTerminalService, appsHandler.GetVersionService())
 
 	// Configure routes
 	routeConfig := router.RouteConfig{
@@ -78,6 +109,9 @@ func main() {
 		WebSocketTerminalHandler: webSocketTerminalHandler,
 		PagesHandler:             pagesHandler,
 		VersionHandler:           versionHandler,
+		UsersHandler:             usersHandler,
+		APIHandler:               apiHandler,
+		MetricsHandler:           metricsHandler,
 	}
 
 	router.SetupRoutes(r, routeConfig)
@@ -86,6 +120,48 @@ func main() {
 	log.Fatal(r.Run(":" + port))
 }
 
+// registerInstanceAccount registers the Cloudflare account Xanthus was set up with for background jobs
+func registerInstanceAccount() {
+	users := middleware.GetUserService()
+	if !users.IsSetUp() {
+		log.Println("👤 Xanthus is not set up yet, open the web UI to create the first admin")
+		return
+	}
+
+	token, accountID, err := users.InstanceCredentials()
+	if err != nil {
+		log.Printf("Warning: instance Cloudflare token is not usable: %v", err)
+		return
+	}
+	services.GetBackgroundAccounts().Register(token, accountID)
+}
+
+// loadHostKeys pins the SSH host keys of the servers of every known account
+func loadHostKeys() {
+	kvService := services.NewKVService()
+	for _, account := range services.GetBackgroundAccounts().Accounts() {
+		if err := services.GetKnownHosts().Load(kvService, account.Token, account.AccountID); err != nil {
+			log.Printf("Warning: failed to load SSH host keys for account %s: %v", account.AccountID, err)
+		}
+	}
+}
+
+// registerBackgroundAccountFromEnv registers the Cloudflare account of XANTHUS_CLOUDFLARE_TOKEN
+// for background jobs. Without it, accounts are registered when their users sign in.
+func registerBackgroundAccountFromEnv() {
+	token := os.Getenv("XANTHUS_CLOUDFLARE_TOKEN")
+	if token == "" {
+		return
+	}
+
+	_, accountID, err := utils.CheckKVNamespaceExists(token)
+	if err != nil {
+		log.Printf("Warning: XANTHUS_CLOUDFLARE_TOKEN is not usable, background jobs wait for a login: %v", err)
+		return
+	}
+	services.GetBackgroundAccounts().Register(token, accountID)
+}
+
 // setupTemplates configures HTML templates with helper functions
 func setupTemplates(r *gin.Engine) {
 	// Generate cache busting timestamp
@@ -0,0 +1,524 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chrishham/xanthus/internal/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAPI records requests and answers them with canned envelopes
+type fakeAPI struct {
+	requests []*http.Request
+	bodies   []map[string]interface{}
+	handler  func(w http.ResponseWriter, r *http.Request)
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body := map[string]interface{}{}
+	json.NewDecoder(r.Body).Decode(&body)
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, body)
+	f.handler(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func run(t *testing.T, server *httptest.Server, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	args = append([]string{"--url", server.URL, "--token", "xan_test"}, args...)
+	code := cli.Run(args, strings.NewReader(""), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestVPSList(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": []map[string]interface{}{
+				{"id": 42, "name": "web-1", "provider": "Hetzner", "server_type": "cpx21", "location": "nbg1", "public_ipv4": "192.0.2.1", "monthly_rate": 8.5},
+			},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	t.Run("table", func(t *testing.T) {
+		code, stdout, stderr := run(t, server, "vps", "list")
+		require.Equal(t, 0, code, stderr)
+		assert.Contains(t, stdout, "ID")
+		assert.Contains(t, stdout, "web-1")
+		assert.Contains(t, stdout, "192.0.2.1")
+		assert.Contains(t, stdout, "8.50")
+
+		last := api.requests[len(api.requests)-1]
+		assert.Equal(t, "/api/v1/vps", last.URL.Path)
+		assert.Equal(t, "Bearer xan_test", last.Header.Get("Authorization"))
+	})
+
+	t.Run("json", func(t *testing.T) {
+		code, stdout, stderr := run(t, server, "-o", "json", "vps", "list")
+		require.Equal(t, 0, code, stderr)
+
+		var servers []map[string]interface{}
+		require.NoError(t, json.Unmarshal([]byte(stdout), &servers))
+		require.Len(t, servers, 1)
+		assert.Equal(t, "web-1", servers[0]["name"])
+	})
+}
+
+func TestVPSPower(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "ok"})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "vps", "power", "42", "reboot")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "reboot requested for server 42")
+
+	require.Len(t, api.requests, 1)
+	assert.Equal(t, http.MethodPost, api.requests[0].Method)
+	assert.Equal(t, "/api/v1/vps/42/power", api.requests[0].URL.Path)
+	assert.Equal(t, "reboot", api.bodies[0]["action"])
+}
+
+func TestVPSAdd(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"id": 7, "name": "homelab", "provider": "Manual", "public_ipv4": "192.0.2.10", "ssh_port": 2222},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--url", server.URL, "--token", "xan_test", "vps", "add", "--name", "homelab", "--host", "192.0.2.10", "--user", "ubuntu", "--port", "2222", "--password-stdin"}
+	code := cli.Run(args, strings.NewReader("s3cret\n"), &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "Manual")
+
+	require.Len(t, api.requests, 1)
+	assert.Equal(t, http.MethodPost, api.requests[0].Method)
+	assert.Equal(t, "/api/v1/vps/existing", api.requests[0].URL.Path)
+	assert.Equal(t, map[string]interface{}{
+		"name": "homelab", "host": "192.0.2.10", "ssh_user": "ubuntu", "ssh_port": float64(2222), "password": "s3cret",
+	}, api.bodies[0])
+}
+
+func TestAppDeploy(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"application":      map[string]interface{}{"id": "app-1", "name": "ide", "app_type": "code-server", "status": "Deployed"},
+				"initial_password": "s3cret",
+			},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "app", "deploy",
+		"--type", "code-server", "--name", "ide", "--subdomain", "ide", "--domain", "example.com", "--vps", "42")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "app-1")
+	assert.Contains(t, stdout, "s3cret")
+
+	assert.Equal(t, "/api/v1/applications", api.requests[0].URL.Path)
+	assert.Equal(t, "code-server", api.bodies[0]["app_type"])
+	assert.Equal(t, "42", api.bodies[0]["vps_id"])
+}
+
+func TestDNSConfigureACME(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"domain": "example.com", "issuer": "acme", "dns_only": true, "ssl_mode": "strict"},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "dns", "configure", "--acme", "--dns-only", "example.com")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "acme")
+	assert.Equal(t, "/api/v1/dns/domains", api.requests[0].URL.Path)
+	assert.Equal(t, map[string]interface{}{"domain": "example.com", "issuer": "acme", "dns_only": true}, api.bodies[0])
+}
+
+func TestDNSRenew(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"domain": "example.com", "issuer": "cloudflare-origin", "expires_at": "2041-01-01T00:00:00Z"},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "dns", "renew", "example.com")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "2041-01-01T00:00:00Z")
+	assert.Equal(t, http.MethodPost, api.requests[0].Method)
+	assert.Equal(t, "/api/v1/dns/domains/example.com/renew", api.requests[0].URL.Path)
+}
+
+func TestDNSRemove(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "Domain removed"})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, _, stderr := run(t, server, "dns", "remove", "example.com")
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, http.MethodDelete, api.requests[0].Method)
+	assert.Equal(t, "/api/v1/dns/domains/example.com", api.requests[0].URL.Path)
+}
+
+func TestUserAdd(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"username": "bob", "role": "operator", "created_at": "2026-01-01T00:00:00Z"},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--url", server.URL, "--token", "xan_test", "user", "add", "--role", "operator", "bob"}
+	code := cli.Run(args, strings.NewReader("long enough\n"), &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "operator")
+
+	assert.Equal(t, http.MethodPost, api.requests[0].Method)
+	assert.Equal(t, "/api/v1/users", api.requests[0].URL.Path)
+	assert.Equal(t, map[string]interface{}{"username": "bob", "password": "long enough", "role": "operator"}, api.bodies[0])
+}
+
+func TestUserRole(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"username": "bob", "role": "viewer"},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "user", "role", "bob", "viewer")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "viewer")
+	assert.Equal(t, http.MethodPatch, api.requests[0].Method)
+	assert.Equal(t, "/api/v1/users/bob", api.requests[0].URL.Path)
+	assert.Equal(t, map[string]interface{}{"role": "viewer"}, api.bodies[0])
+}
+
+func TestJobGet(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"id": "job-1", "type": "app.deploy", "target": "code.example.com", "status": "failed",
+				"error": "helm install failed", "attempt": 1, "max_attempts": 1,
+				"created_at": "2026-01-01T00:00:00Z", "started_at": "2026-01-01T00:00:00Z", "finished_at": "2026-01-01T00:01:30Z",
+				"steps": []map[string]interface{}{
+					{"name": "Installing Helm release", "status": "failed", "started_at": "2026-01-01T00:00:10Z"},
+				},
+				"logs": []map[string]interface{}{
+					{"time": "2026-01-01T00:00:10Z", "message": "Installing Helm release"},
+				},
+			},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "job", "get", "job-1")
+	require.Equal(t, 0, code, stderr)
+	assert.Equal(t, "/api/v1/jobs/job-1", api.requests[0].URL.Path)
+	assert.Contains(t, stdout, "helm install failed")
+	assert.Contains(t, stdout, "1m30s")
+	assert.Contains(t, stdout, "Installing Helm release")
+}
+
+func TestJobWatch(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event:status\ndata:{\"type\":\"status\",\"job\":{\"id\":\"job-1\",\"status\":\"running\",\"logs\":[{\"time\":\"2026-01-01T00:00:10Z\",\"message\":\"Installing Helm release\"}]}}\n\n")
+		fmt.Fprint(w, ": keep-alive\n\n")
+		fmt.Fprint(w, "event:log\ndata:{\"type\":\"log\",\"time\":\"2026-01-01T00:00:20Z\",\"message\":\"Pod code-0: Running, 1/1 ready\"}\n\n")
+		fmt.Fprint(w, "event:status\ndata:{\"type\":\"status\",\"job\":{\"id\":\"job-1\",\"status\":\"failed\",\"error\":\"helm install failed\"}}\n\n")
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "job", "watch", "job-1")
+	assert.Equal(t, 1, code)
+	assert.Equal(t, "/api/v1/jobs/job-1/events", api.requests[0].URL.Path)
+	assert.Contains(t, stdout, "Installing Helm release")
+	assert.Contains(t, stdout, "Pod code-0: Running, 1/1 ready")
+	assert.Contains(t, stderr, "job failed: helm install failed")
+}
+
+func TestStackPlan(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"stack": "production",
+				"prune": true,
+				"changes": []map[string]interface{}{
+					{"action": "update", "kind": "application", "name": "code.example.com", "details": []string{"version 4.1.0 → 4.2.0"}},
+				},
+			},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--url", server.URL, "--token", "xan_test", "stack", "plan", "--prune", "-"}
+	code := cli.Run(args, strings.NewReader("name: production\n"), &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "code.example.com")
+	assert.Contains(t, stdout.String(), "version 4.1.0 → 4.2.0")
+
+	assert.Equal(t, "/api/v1/stacks/plan", api.requests[0].URL.Path)
+	assert.Equal(t, map[string]interface{}{"stack": "name: production\n", "prune": true}, api.bodies[0])
+}
+
+func TestAdoptRelease(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"id": "app-1", "name": "grafana", "app_type": "headlamp", "status": "Running"},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "adopt", "release", "--type", "headlamp", "42", "monitoring/grafana")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "app-1")
+
+	assert.Equal(t, "/api/v1/adopt/releases", api.requests[0].URL.Path)
+	assert.Equal(t, map[string]interface{}{"server_id": float64(42), "namespace": "monitoring", "release": "grafana", "app_type": "headlamp"}, api.bodies[0])
+
+	code, _, _ = run(t, server, "adopt", "release", "42", "grafana")
+	assert.Equal(t, 2, code)
+}
+
+func TestVPSRebuild(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"old_server_id": 42,
+				"old_ipv4":      "203.0.113.7",
+				"server":        map[string]interface{}{"server_id": 43, "name": "web", "public_ipv4": "203.0.113.8"},
+				"applications":  []map[string]interface{}{{"id": "app-1", "name": "dev", "status": "Running"}},
+				"dns_records":   []string{"dev.example.com"},
+				"port_forwards": 1,
+			},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "vps", "rebuild", "--replace", "42")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "ID 42 → 43")
+	assert.Contains(t, stdout, "203.0.113.8")
+	assert.Contains(t, stdout, "app-1")
+
+	assert.Equal(t, "/api/v1/vps/42/rebuild", api.requests[0].URL.Path)
+	assert.Equal(t, map[string]interface{}{"replace": true, "restore_backups": false}, api.bodies[0])
+}
+
+func TestVPSJoin(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"id": 43, "name": "worker-1", "cluster_server_id": 42},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "vps", "join", "--name", "worker-1", "--host", "203.0.113.9", "42")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "Node worker-1 (ID 43) joined the cluster of server 42")
+
+	assert.Equal(t, "/api/v1/vps/42/nodes", api.requests[0].URL.Path)
+	assert.Equal(t, map[string]interface{}{"name": "worker-1", "provider": "manual", "host": "203.0.113.9"}, api.bodies[0])
+
+	code, _, _ = run(t, server, "vps", "join", "42")
+	assert.Equal(t, 2, code)
+}
+
+func TestVPSK3sUpgrade(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"from":  "v1.30.4+k3s1",
+				"to":    "v1.31.2+k3s1",
+				"nodes": []map[string]interface{}{{"name": "control", "role": "server", "ready": true, "kubelet_version": "v1.31.2+k3s1"}},
+			},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "vps", "k3s", "upgrade", "42", "v1.31.2+k3s1")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "K3s upgraded from v1.30.4+k3s1 to v1.31.2+k3s1")
+	assert.Contains(t, stdout, "control")
+
+	assert.Equal(t, "/api/v1/vps/42/k3s/upgrade", api.requests[0].URL.Path)
+	assert.Equal(t, map[string]interface{}{"version": "v1.31.2+k3s1"}, api.bodies[0])
+
+	code, _, _ = run(t, server, "vps", "k3s", "upgrade", "42")
+	assert.Equal(t, 2, code)
+}
+
+func TestVPSMetrics(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"success": true,
+			"data": map[string]interface{}{
+				"resolution": "5m",
+				"points": []map[string]interface{}{{
+					"time": "2026-01-01T00:00:00Z", "samples": 5, "cpu_cores": 0.5, "cpu_percent": 25,
+					"memory_bytes": 1 << 30, "memory_total_bytes": 4 << 30,
+					"disk_bytes": 10 << 30, "disk_total_bytes": 40 << 30,
+					"net_rx_bytes_per_sec": 2048, "net_tx_bytes_per_sec": 512,
+				}},
+				"updated_at": "2026-01-01T00:04:00Z",
+			},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "vps", "metrics", "--range", "6h", "42")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "25.0%")
+	assert.Contains(t, stdout, "1.0 GiB / 4.0 GiB")
+	assert.Contains(t, stdout, "2.0 KiB/s")
+
+	assert.Equal(t, "/api/v1/vps/42/metrics", api.requests[0].URL.Path)
+	assert.Equal(t, "6h", api.requests[0].URL.Query().Get("range"))
+
+	code, _, _ = run(t, server, "vps", "metrics")
+	assert.Equal(t, 2, code)
+}
+
+func TestBackupTargetAdd(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"success": true,
+			"data":    map[string]interface{}{"name": "offsite", "endpoint": "https://s3.example.com", "bucket": "backups", "access_key": "AKIA"},
+		})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"--url", server.URL, "--token", "xan_test", "backup", "target", "add", "--name", "offsite", "--endpoint", "https://s3.example.com", "--bucket", "backups", "--access-key", "AKIA"}
+	code := cli.Run(args, strings.NewReader("s3cret\nrepo password\n"), &stdout, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "https://s3.example.com/backups")
+
+	assert.Equal(t, "/api/v1/backups/targets", api.requests[0].URL.Path)
+	assert.Equal(t, map[string]interface{}{
+		"name": "offsite", "endpoint": "https://s3.example.com", "bucket": "backups", "region": "",
+		"access_key": "AKIA", "secret_key": "s3cret", "password": "repo password",
+	}, api.bodies[0])
+
+	code = cli.Run(args, strings.NewReader("s3cret\n"), &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr.String(), "repository password")
+}
+
+func TestBackupRestore(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"success": true, "message": "Snapshot restored"})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, stdout, stderr := run(t, server, "backup", "restore", "app-1", "latest")
+	require.Equal(t, 0, code, stderr)
+	assert.Contains(t, stdout, "Restored app-1 from snapshot latest")
+
+	assert.Equal(t, http.MethodPost, api.requests[0].Method)
+	assert.Equal(t, "/api/v1/applications/app-1/backups/latest/restore", api.requests[0].URL.Path)
+}
+
+func TestAPIErrors(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusForbidden, map[string]interface{}{"success": false, "error": "API token is missing required scope: vps:write"})
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	code, _, stderr := run(t, server, "vps", "delete", "42")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "missing required scope: vps:write")
+	assert.Contains(t, stderr, "403")
+}
+
+func TestUsageErrors(t *testing.T) {
+	api := &fakeAPI{handler: func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request to %s", r.URL.Path)
+	}}
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{"unknown command", []string{"vps", "explode"}, "Commands:"},
+		{"missing argument", []string{"app", "upgrade", "app-1"}, "Usage: xanthusctl app upgrade"},
+		{"missing flag", []string{"vps", "create", "--name", "web-1"}, "Usage: xanthusctl vps create"},
+		{"missing host", []string{"vps", "add", "--name", "homelab"}, "Usage: xanthusctl vps add"},
+		{"bad output format", []string{"-o", "yaml", "vps", "list"}, "unknown output format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, stderr := run(t, server, tt.args...)
+			assert.Equal(t, 2, code)
+			assert.Contains(t, stderr, tt.want)
+		})
+	}
+}
+
+func TestMissingToken(t *testing.T) {
+	t.Setenv(cli.EnvToken, "")
+
+	var stdout, stderr bytes.Buffer
+	code := cli.Run([]string{"vps", "list"}, strings.NewReader(""), &stdout, &stderr)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr.String(), cli.EnvToken)
+}
@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/chrishham/xanthus/internal/handlers/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPI_RoutesRequireKnownScopes(t *testing.T) {
+	handler := api.NewHandler(nil, nil, nil)
+
+	seen := map[string]bool{}
+	for _, route := range handler.Routes() {
+		key := route.Method + " " + route.Path
+		assert.False(t, seen[key], "duplicate route %s", key)
+		seen[key] = true
+
+		assert.NotEmpty(t, route.Scope, key)
+		assert.NotEmpty(t, route.Summary, key)
+		assert.NotNil(t, route.Handler, key)
+	}
+}
+
+func TestAPI_RequiresAuthentication(t *testing.T) {
+	router := setupTestRouter()
+	api.NewHandler(nil, nil, nil).Register(router.Group("/api/v1"))
+
+	req := httptest.NewRequest("GET", "/api/v1/vps", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest("GET", "/api/v1/vps", nil)
+	req.Header.Set("Authorization", "Bearer not-a-xanthus-token")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAPI_OpenAPIDocument(t *testing.T) {
+	router := setupTestRouter()
+	handler := api.NewHandler(nil, nil, nil)
+	handler.Register(router.Group("/api/v1"))
+
+	req := httptest.NewRequest("GET", "/api/v1/openapi.json", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var doc struct {
+		OpenAPI string                                       `json:"openapi"`
+		Paths   map[string]map[string]map[string]interface{} `json:"paths"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+
+	for _, route := range handler.Routes() {
+		path := route.Path
+		for _, segment := range strings.Split(path, "/") {
+			if strings.HasPrefix(segment, ":") {
+				path = strings.Replace(path, segment, "{"+segment[1:]+"}", 1)
+			}
+		}
+		operation, ok := doc.Paths[path][strings.ToLower(route.Method)]
+		require.True(t, ok, "%s %s missing from OpenAPI document", route.Method, path)
+		assert.Equal(t, route.Scope, operation["x-scope"])
+	}
+
+	// The committed document must match the generated one (run "make openapi")
+	committed, err := os.ReadFile("../../../docs/openapi.json")
+	require.NoError(t, err)
+	generated, err := json.MarshalIndent(api.OpenAPIDocument(), "", "  ")
+	require.NoError(t, err)
+	assert.JSONEq(t, string(generated), string(committed))
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/chrishham/xanthus/internal/handlers"
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleMetrics(t *testing.T) {
+	versions := services.NewEnhancedDefaultVersionService(models.NewYAMLConfigLoader(models.NewDefaultApplicationValidator()))
+	metricsHandler := handlers.NewMetricsHandler(services.NewWebSocketTerminalService(), versions)
+
+	router := setupTestRouter()
+	router.GET("/metrics", metricsHandler.HandleMetrics)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/plain; version=0.0.4")
+
+	body := w.Body.String()
+	assert.Contains(t, body, "# TYPE xanthus_jobs_total counter")
+	assert.Contains(t, body, "xanthus_terminal_sessions_active 0")
+	assert.Contains(t, body, "# TYPE xanthus_ssh_connections_cached gauge")
+	assert.Contains(t, body, `xanthus_cache_entries{cache="accounts"}`)
+	assert.Contains(t, body, `xanthus_cache_misses_total{cache="versions"} 0`)
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chrishham/xanthus/internal/middleware"
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestMetrics(t *testing.T) {
+	router := gin.New()
+	router.Use(middleware.RequestMetrics())
+	router.GET("/test-metrics/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, path := range []string{"/test-metrics/1", "/test-metrics/2", "/test-missing"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	var out strings.Builder
+	require.NoError(t, utils.Metrics().Write(&out))
+	assert.Contains(t, out.String(), `xanthus_http_requests_total{method="GET",route="/test-metrics/:id",code="204"} 2`)
+	assert.Contains(t, out.String(), `xanthus_http_requests_total{method="GET",route="unmatched",code="404"} 1`)
+	assert.Contains(t, out.String(), `xanthus_http_request_duration_seconds_count{method="GET",route="/test-metrics/:id"} 2`)
+}
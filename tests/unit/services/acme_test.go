@@ -0,0 +1,322 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/acme"
+
+	"github.com/chrishham/xanthus/internal/services"
+)
+
+// fakeDNS01Solver keeps TXT records in memory
+type fakeDNS01Solver struct {
+	mu      sync.Mutex
+	records map[string]map[string]string // record ID -> name, value
+	nextID  int
+}
+
+func newFakeDNS01Solver() *fakeDNS01Solver {
+	return &fakeDNS01Solver{records: map[string]map[string]string{}}
+}
+
+func (s *fakeDNS01Solver) PresentTXT(ctx context.Context, name, value string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	id := fmt.Sprintf("rec-%d", s.nextID)
+	s.records[id] = map[string]string{"name": name, "value": value}
+	return id, nil
+}
+
+func (s *fakeDNS01Solver) WaitTXT(ctx context.Context, name, value string) error {
+	return nil
+}
+
+func (s *fakeDNS01Solver) CleanUpTXT(ctx context.Context, recordID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, recordID)
+	return nil
+}
+
+func (s *fakeDNS01Solver) has(name, value string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, record := range s.records {
+		if record["name"] == name && record["value"] == value {
+			return true
+		}
+	}
+	return false
+}
+
+// fakeACMEServer is a minimal RFC 8555 CA that validates dns-01 challenges
+// against a fakeDNS01Solver instead of DNS
+type fakeACMEServer struct {
+	t         *testing.T
+	server    *httptest.Server
+	solver    *fakeDNS01Solver
+	accounts  *acme.Client // computes the expected challenge records
+	caKey     *ecdsa.PrivateKey
+	caCert    *x509.Certificate
+	mu        sync.Mutex
+	domains   []string
+	authzs    []map[string]interface{}
+	orderDone bool
+	leaf      []byte
+}
+
+func newFakeACMEServer(t *testing.T, accountKey *ecdsa.PrivateKey, solver *fakeDNS01Solver) *fakeACMEServer {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fake ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	caCert, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	f := &fakeACMEServer{t: t, solver: solver, accounts: &acme.Client{Key: accountKey}, caKey: caKey, caCert: caCert}
+	f.server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+func (f *fakeACMEServer) url(path string) string {
+	return f.server.URL + path
+}
+
+func (f *fakeACMEServer) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+
+	var payload map[string]interface{}
+	if r.Method == http.MethodPost {
+		var jws struct {
+			Payload string `json:"payload"`
+		}
+		require.NoError(f.t, json.NewDecoder(r.Body).Decode(&jws))
+		if jws.Payload != "" {
+			raw, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+			require.NoError(f.t, err)
+			require.NoError(f.t, json.Unmarshal(raw, &payload))
+		}
+	}
+
+	path := r.URL.Path
+	switch {
+	case path == "/directory":
+		f.json(w, http.StatusOK, map[string]interface{}{
+			"newNonce":   f.url("/nonce"),
+			"newAccount": f.url("/account"),
+			"newOrder":   f.url("/order"),
+			"revokeCert": f.url("/revoke"),
+			"keyChange":  f.url("/key-change"),
+		})
+	case path == "/nonce":
+		w.WriteHeader(http.StatusOK)
+	case path == "/account":
+		w.Header().Set("Location", f.url("/account/1"))
+		f.json(w, http.StatusCreated, map[string]interface{}{"status": "valid"})
+	case path == "/order":
+		for _, id := range payload["identifiers"].([]interface{}) {
+			domain := id.(map[string]interface{})["value"].(string)
+			f.domains = append(f.domains, domain)
+			authz := map[string]interface{}{
+				"status":     "pending",
+				"identifier": map[string]interface{}{"type": "dns", "value": strings.TrimPrefix(domain, "*.")},
+				"challenges": []interface{}{
+					map[string]interface{}{"type": "http-01", "url": f.url("/ignored"), "token": "http-token", "status": "pending"},
+					map[string]interface{}{"type": "dns-01", "url": f.url(fmt.Sprintf("/chal/%d", len(f.authzs))), "token": fmt.Sprintf("token-%d", len(f.authzs)), "status": "pending"},
+				},
+			}
+			if strings.HasPrefix(domain, "*.") {
+				authz["wildcard"] = true
+			}
+			f.authzs = append(f.authzs, authz)
+		}
+		w.Header().Set("Location", f.url("/order/1"))
+		f.json(w, http.StatusCreated, f.order())
+	case path == "/order/1":
+		f.json(w, http.StatusOK, f.order())
+	case strings.HasPrefix(path, "/authz/"):
+		var i int
+		fmt.Sscanf(path, "/authz/%d", &i)
+		f.json(w, http.StatusOK, f.authzs[i])
+	case strings.HasPrefix(path, "/chal/"):
+		var i int
+		fmt.Sscanf(path, "/chal/%d", &i)
+		authz := f.authzs[i]
+		challenge := authz["challenges"].([]interface{})[1].(map[string]interface{})
+		expected, err := f.accounts.DNS01ChallengeRecord(challenge["token"].(string))
+		require.NoError(f.t, err)
+		name := "_acme-challenge." + authz["identifier"].(map[string]interface{})["value"].(string)
+
+		status := "invalid"
+		if f.solver.has(name, expected) {
+			status = "valid"
+		}
+		challenge["status"] = status
+		authz["status"] = status
+		f.json(w, http.StatusOK, challenge)
+	case path == "/finalize/1":
+		der, err := base64.RawURLEncoding.DecodeString(payload["csr"].(string))
+		require.NoError(f.t, err)
+		csr, err := x509.ParseCertificateRequest(der)
+		require.NoError(f.t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+			DNSNames:     csr.DNSNames,
+			NotBefore:    time.Now().Add(-time.Minute),
+			NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		}
+		f.leaf, err = x509.CreateCertificate(rand.Reader, template, f.caCert, csr.PublicKey, f.caKey)
+		require.NoError(f.t, err)
+		f.orderDone = true
+		f.json(w, http.StatusOK, f.order())
+	case path == "/cert/1":
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.WriteHeader(http.StatusOK)
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: f.leaf})
+		pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: f.caCert.Raw})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// order returns the current state of the single order
+func (f *fakeACMEServer) order() map[string]interface{} {
+	status := "ready"
+	authzURLs := make([]string, len(f.authzs))
+	for i, authz := range f.authzs {
+		authzURLs[i] = f.url(fmt.Sprintf("/authz/%d", i))
+		if authz["status"] != "valid" {
+			status = "pending"
+		}
+	}
+	identifiers := make([]interface{}, len(f.domains))
+	for i, domain := range f.domains {
+		identifiers[i] = map[string]interface{}{"type": "dns", "value": domain}
+	}
+
+	order := map[string]interface{}{
+		"status":         status,
+		"identifiers":    identifiers,
+		"authorizations": authzURLs,
+		"finalize":       f.url("/finalize/1"),
+	}
+	if f.orderDone {
+		order["status"] = "valid"
+		order["certificate"] = f.url("/cert/1")
+	}
+	return order
+}
+
+func (f *fakeACMEServer) json(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestACMEService_ObtainCertificate(t *testing.T) {
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	solver := newFakeDNS01Solver()
+	ca := newFakeACMEServer(t, accountKey, solver)
+
+	acmeService := services.NewACMEService(ca.url("/directory"), accountKey, "admin@example.com")
+	assert.Equal(t, ca.url("/directory"), acmeService.DirectoryURL())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	cert, err := acmeService.ObtainCertificate(ctx, []string{"example.com", "*.example.com"}, solver)
+	require.NoError(t, err)
+
+	t.Run("returns the chain and a matching key", func(t *testing.T) {
+		block, rest := pem.Decode([]byte(cert.Certificate))
+		require.NotNil(t, block)
+		leaf, err := x509.ParseCertificate(block.Bytes)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{"example.com", "*.example.com"}, leaf.DNSNames)
+		assert.Equal(t, leaf.NotAfter, cert.NotAfter)
+		assert.Equal(t, ca.url("/cert/1"), cert.URL)
+
+		intermediate, _ := pem.Decode(rest)
+		require.NotNil(t, intermediate)
+		assert.Equal(t, ca.caCert.Raw, intermediate.Bytes)
+
+		keyBlock, _ := pem.Decode([]byte(cert.PrivateKey))
+		require.NotNil(t, keyBlock)
+		assert.Equal(t, "PRIVATE KEY", keyBlock.Type)
+		key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+		require.NoError(t, err)
+		assert.True(t, key.(*ecdsa.PrivateKey).PublicKey.Equal(leaf.PublicKey))
+	})
+
+	t.Run("removes the challenge records", func(t *testing.T) {
+		assert.Empty(t, solver.records)
+	})
+}
+
+func TestACMEService_ObtainCertificateFailsWithoutRecords(t *testing.T) {
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca := newFakeACMEServer(t, accountKey, newFakeDNS01Solver())
+
+	// Records are published to a different solver than the one the CA checks
+	acmeService := services.NewACMEService(ca.url("/directory"), accountKey, "")
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	_, err = acmeService.ObtainCertificate(ctx, []string{"example.com"}, newFakeDNS01Solver())
+	assert.Error(t, err)
+
+	_, err = acmeService.ObtainCertificate(ctx, nil, newFakeDNS01Solver())
+	assert.Error(t, err)
+}
+
+func TestACMEDirectoryURL(t *testing.T) {
+	t.Setenv(services.EnvACMEDirectoryURL, "")
+	assert.Equal(t, services.LetsEncryptDirectoryURL, services.ACMEDirectoryURL())
+
+	t.Setenv(services.EnvACMEDirectoryURL, "https://localhost:14000/dir")
+	assert.Equal(t, "https://localhost:14000/dir", services.ACMEDirectoryURL())
+}
+
+func TestCloudflareDNS01Solver_WaitTXTStopsWhenCancelled(t *testing.T) {
+	solver := services.NewCloudflareDNS01Solver(nil, "cf-token", "zone-1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := solver.WaitTXT(ctx, "_acme-challenge.example.invalid", "value")
+	assert.ErrorIs(t, err, context.Canceled)
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+func TestAdoptionService_DiscoverServers(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	keyring := utils.NewKeyring(store, "", utils.KEKSourceToken)
+
+	services.RegisterCloudProvider("Adoption Cloud", func(token, accountID string) (services.CloudProvider, error) {
+		return &namedProvider{name: "Adoption Cloud", fakeProvider: fakeProvider{servers: []services.CloudServer{
+			{ID: 1, Name: "managed", PublicIPv4: "10.0.0.1"},
+			{ID: 2, Name: "added-over-ssh", PublicIPv4: "10.0.0.2"},
+			{ID: 3, Name: "legacy", PublicIPv4: "10.0.0.3", ServerType: "cx22", Location: "nbg1"},
+		}}}, nil
+	})
+
+	kv := services.NewKVServiceWithStore(store)
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:1:config", services.VPSConfig{ServerID: 1, Name: "managed", Provider: "Adoption Cloud", PublicIPv4: "10.0.0.1"}))
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:77:config", services.VPSConfig{ServerID: 77, Name: "byo", Provider: services.ProviderManual, PublicIPv4: "10.0.0.2"}))
+
+	adoption := services.NewAdoptionServiceWithStore(store, keyring, nil)
+	candidates, err := adoption.DiscoverServers(context.Background(), "cf-token", "account-1")
+	require.NoError(t, err)
+
+	// Servers managed by ID or by address are not candidates
+	var found []services.UnmanagedServer
+	for _, server := range candidates.Servers {
+		if server.Provider == "Adoption Cloud" {
+			found = append(found, server)
+		}
+	}
+	require.Len(t, found, 1)
+	assert.Equal(t, services.UnmanagedServer{Provider: "Adoption Cloud", ID: 3, Name: "legacy", PublicIPv4: "10.0.0.3", ServerType: "cx22", Location: "nbg1"}, found[0])
+
+	t.Run("rejects managed, unknown and missing servers", func(t *testing.T) {
+		_, err := adoption.AdoptServer(context.Background(), "cf-token", "account-1", services.AdoptServerRequest{Provider: "Adoption Cloud", ID: 1})
+		assert.ErrorIs(t, err, services.ErrAlreadyManaged)
+
+		_, err = adoption.AdoptServer(context.Background(), "cf-token", "account-1", services.AdoptServerRequest{Provider: "Adoption Cloud", ID: 9})
+		assert.ErrorIs(t, err, services.ErrAdoptionNotFound)
+
+		_, err = adoption.AdoptServer(context.Background(), "cf-token", "account-1", services.AdoptServerRequest{Provider: "nowhere", ID: 3})
+		assert.ErrorIs(t, err, services.ErrInvalidAdoptionRequest)
+	})
+
+	t.Run("rejects releases on unknown servers", func(t *testing.T) {
+		_, err := adoption.AdoptRelease(context.Background(), "cf-token", "account-1", services.AdoptReleaseRequest{ServerID: 5, Namespace: "default", Release: "grafana"})
+		assert.ErrorIs(t, err, services.ErrAdoptionNotFound)
+
+		_, err = adoption.AdoptRelease(context.Background(), "cf-token", "account-1", services.AdoptReleaseRequest{ServerID: 1})
+		assert.ErrorIs(t, err, services.ErrInvalidAdoptionRequest)
+	})
+}
+
+// namedProvider is a fake provider registered under another name
+type namedProvider struct {
+	fakeProvider
+	name string
+}
+
+func (p *namedProvider) Name() string { return p.name }
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+func newTestAPITokenService(t *testing.T) (*services.APITokenService, *utils.LocalStateStore) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	return services.NewAPITokenServiceWithStore(store), store
+}
+
+func TestAPITokenService_CreateAndAuthenticate(t *testing.T) {
+	service, store := newTestAPITokenService(t)
+
+	token, raw, err := service.CreateToken("cf-token", "account-1", "ci", []string{services.ScopeAppsWrite}, 0)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(raw, services.APITokenPrefix))
+	assert.Nil(t, token.ExpiresAt)
+
+	// Neither the token nor the Cloudflare token are stored in plaintext
+	keys, err := store.ListKeys("", "", "")
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	stored, err := store.Get("", "", keys[0])
+	require.NoError(t, err)
+	assert.NotContains(t, string(stored), raw)
+	assert.NotContains(t, string(stored), "cf-token")
+
+	authenticated, cfToken, err := service.Authenticate(raw)
+	require.NoError(t, err)
+	assert.Equal(t, "cf-token", cfToken)
+	assert.Equal(t, "account-1", authenticated.AccountID)
+	assert.True(t, authenticated.HasScope(services.ScopeAppsWrite))
+	assert.False(t, authenticated.HasScope(services.ScopeVPSWrite))
+}
+
+func TestAPITokenService_RejectsInvalidTokens(t *testing.T) {
+	service, _ := newTestAPITokenService(t)
+
+	_, raw, err := service.CreateToken("cf-token", "account-1", "ci", []string{services.ScopeAll}, 0)
+	require.NoError(t, err)
+
+	for _, candidate := range []string{"", "cf-token", "xan_", "xan_abc", raw + "x", raw[:len(raw)-1] + "0"} {
+		if candidate == raw {
+			continue
+		}
+		_, _, err := service.Authenticate(candidate)
+		assert.ErrorIs(t, err, services.ErrAPITokenInvalid, candidate)
+	}
+}
+
+func TestAPITokenService_RevokeAndExpire(t *testing.T) {
+	service, _ := newTestAPITokenService(t)
+
+	token, raw, err := service.CreateToken("cf-token", "account-1", "ci", []string{services.ScopeAll}, 0)
+	require.NoError(t, err)
+
+	// Other accounts cannot revoke the token
+	assert.ErrorIs(t, service.RevokeToken("account-2", token.ID), services.ErrAPITokenNotFound)
+
+	require.NoError(t, service.RevokeToken("account-1", token.ID))
+	_, _, err = service.Authenticate(raw)
+	assert.ErrorIs(t, err, services.ErrAPITokenRevoked)
+
+	_, expiring, err := service.CreateToken("cf-token", "account-1", "short", []string{services.ScopeAll}, time.Nanosecond)
+	require.NoError(t, err)
+	time.Sleep(time.Millisecond)
+	_, _, err = service.Authenticate(expiring)
+	assert.ErrorIs(t, err, services.ErrAPITokenExpired)
+}
+
+func TestAPITokenService_ListTokens(t *testing.T) {
+	service, _ := newTestAPITokenService(t)
+
+	_, _, err := service.CreateToken("cf-token", "account-1", "first", []string{services.ScopeVPSRead}, 0)
+	require.NoError(t, err)
+	_, _, err = service.CreateToken("cf-token", "account-1", "second", []string{services.ScopeVPSRead}, 0)
+	require.NoError(t, err)
+	_, _, err = service.CreateToken("other", "account-2", "foreign", []string{services.ScopeVPSRead}, 0)
+	require.NoError(t, err)
+
+	tokens, err := service.ListTokens("account-1")
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	for _, token := range tokens {
+		assert.Equal(t, "account-1", token.AccountID)
+	}
+}
+
+func TestAPITokenService_ValidateScopes(t *testing.T) {
+	service, _ := newTestAPITokenService(t)
+
+	assert.NoError(t, service.ValidateScopes([]string{services.ScopeVPSRead, services.ScopeAll}))
+	assert.Error(t, service.ValidateScopes(nil))
+	assert.Error(t, service.ValidateScopes([]string{"vps:destroy"}))
+
+	_, _, err := service.CreateToken("cf-token", "account-1", "", []string{services.ScopeAll}, 0)
+	assert.Error(t, err)
+}
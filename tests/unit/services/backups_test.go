@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+func TestBackupService_Targets(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	keyring := utils.NewKeyring(store, "", utils.KEKSourceToken)
+	kv := services.NewKVServiceWithStore(store)
+	backups := services.NewBackupServiceWithStore(store, keyring)
+
+	valid := services.BackupTargetRequest{
+		Name:      "offsite",
+		Endpoint:  "https://s3.example.com/",
+		Bucket:    "backups",
+		AccessKey: "AKIA",
+		SecretKey: "s3cret",
+		Password:  "repo password",
+	}
+
+	t.Run("stores secrets encrypted", func(t *testing.T) {
+		target, err := backups.PutTarget("cf-token", "account-1", valid)
+		require.NoError(t, err)
+		assert.Equal(t, "https://s3.example.com", target.Endpoint)
+
+		var stored map[string]interface{}
+		require.NoError(t, kv.GetValue("cf-token", "account-1", "backup:target:offsite", &stored))
+		assert.NotContains(t, stored, "secret_key")
+		secret, err := keyring.Decrypt("cf-token", "account-1", stored["encrypted_secret_key"].(string))
+		require.NoError(t, err)
+		assert.Equal(t, "s3cret", secret)
+
+		targets, err := backups.ListTargets("cf-token", "account-1")
+		require.NoError(t, err)
+		require.Len(t, targets, 1)
+		assert.Equal(t, "offsite", targets[0].Name)
+	})
+
+	t.Run("rejects invalid targets", func(t *testing.T) {
+		badName := valid
+		badName.Name = "Off Site"
+		badEndpoint := valid
+		badEndpoint.Endpoint = "s3.example.com"
+		noPassword := valid
+		noPassword.Password = ""
+
+		for _, req := range []services.BackupTargetRequest{badName, badEndpoint, noPassword} {
+			_, err := backups.PutTarget("cf-token", "account-1", req)
+			assert.ErrorIs(t, err, services.ErrInvalidBackupRequest)
+		}
+	})
+
+	t.Run("refuses to delete targets in use", func(t *testing.T) {
+		require.NoError(t, kv.PutValue("cf-token", "account-1", "backup:policy:app-1", services.BackupPolicy{AppID: "app-1", Target: "offsite"}))
+		assert.ErrorIs(t, backups.DeleteTarget("cf-token", "account-1", "offsite"), services.ErrBackupTargetInUse)
+
+		require.NoError(t, kv.DeleteValue("cf-token", "account-1", "backup:policy:app-1"))
+		require.NoError(t, backups.DeleteTarget("cf-token", "account-1", "offsite"))
+		assert.ErrorIs(t, backups.DeleteTarget("cf-token", "account-1", "offsite"), services.ErrBackupNotFound)
+	})
+}
+
+func TestBackupService_PolicyValidation(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	keyring := utils.NewKeyring(store, "", utils.KEKSourceToken)
+	backups := services.NewBackupServiceWithStore(store, keyring)
+	ctx := context.Background()
+
+	_, err = backups.SetPolicy(ctx, "cf-token", "account-1", services.BackupPolicy{AppID: "app-1", Target: "offsite", Schedule: "every night"})
+	assert.ErrorIs(t, err, services.ErrInvalidBackupRequest)
+
+	_, err = backups.SetPolicy(ctx, "cf-token", "account-1", services.BackupPolicy{AppID: "app-1", Target: "offsite", Retention: services.BackupRetention{KeepLast: -1}})
+	assert.ErrorIs(t, err, services.ErrInvalidBackupRequest)
+
+	_, err = backups.SetPolicy(ctx, "cf-token", "account-1", services.BackupPolicy{AppID: "app-1", Target: "offsite", Schedule: "30 2 * * 1-5"})
+	assert.ErrorIs(t, err, services.ErrBackupNotFound)
+
+	_, err = backups.GetPolicy("cf-token", "account-1", "app-1")
+	assert.ErrorIs(t, err, services.ErrBackupNotFound)
+
+	err = backups.Restore(ctx, "cf-token", "account-1", "app-1", "../etc")
+	assert.ErrorIs(t, err, services.ErrInvalidBackupRequest)
+	err = backups.Restore(ctx, "cf-token", "account-1", "app-1", "latest")
+	assert.ErrorIs(t, err, services.ErrBackupNotFound)
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// selfSignedPEM returns a PEM certificate for domain expiring at notAfter
+func selfSignedPEM(t *testing.T, domain string, notAfter time.Time) string {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    notAfter.Add(-90 * 24 * time.Hour),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestCertificateNotAfter(t *testing.T) {
+	notAfter := time.Now().Add(60 * 24 * time.Hour).Truncate(time.Second).UTC()
+
+	t.Run("reads the first certificate of a chain", func(t *testing.T) {
+		chain := selfSignedPEM(t, "example.com", notAfter) + selfSignedPEM(t, "root", notAfter.Add(time.Hour))
+		expiry, err := services.CertificateNotAfter(chain)
+		require.NoError(t, err)
+		assert.True(t, notAfter.Equal(expiry))
+	})
+
+	t.Run("skips other PEM blocks", func(t *testing.T) {
+		data := string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")})) + selfSignedPEM(t, "example.com", notAfter)
+		expiry, err := services.CertificateNotAfter(data)
+		require.NoError(t, err)
+		assert.True(t, notAfter.Equal(expiry))
+	})
+
+	t.Run("rejects data without certificates", func(t *testing.T) {
+		_, err := services.CertificateNotAfter("not a certificate")
+		assert.Error(t, err)
+	})
+}
+
+func TestDomainSSLConfig_Expiry(t *testing.T) {
+	notAfter := time.Now().Add(60 * 24 * time.Hour).Truncate(time.Second).UTC()
+	config := &services.DomainSSLConfig{Domain: "example.com", Certificate: selfSignedPEM(t, "example.com", notAfter)}
+
+	expiry, err := config.Expiry()
+	require.NoError(t, err)
+	assert.True(t, notAfter.Equal(expiry))
+
+	config.ExpiresAt = "2030-01-02T03:04:05Z"
+	expiry, err = config.Expiry()
+	require.NoError(t, err)
+	assert.Equal(t, 2030, expiry.Year())
+}
+
+func TestCertRenewalService_NeedsRenewal(t *testing.T) {
+	renewal := services.NewCertRenewalServiceWithKV(services.NewKVService(), 30*24*time.Hour, time.Hour)
+	now := time.Now()
+
+	fresh := &services.DomainSSLConfig{Certificate: selfSignedPEM(t, "example.com", now.Add(90*24*time.Hour))}
+	expiring := &services.DomainSSLConfig{Certificate: selfSignedPEM(t, "example.com", now.Add(10*24*time.Hour))}
+	expired := &services.DomainSSLConfig{Certificate: selfSignedPEM(t, "example.com", now.Add(-time.Hour))}
+	broken := &services.DomainSSLConfig{Certificate: "garbage"}
+
+	assert.False(t, renewal.NeedsRenewal(fresh, now))
+	assert.True(t, renewal.NeedsRenewal(expiring, now))
+	assert.True(t, renewal.NeedsRenewal(expired, now))
+	assert.True(t, renewal.NeedsRenewal(broken, now))
+}
+
+func TestNewCertRenewalService_Environment(t *testing.T) {
+	t.Setenv(services.EnvCertRenewalDays, "10")
+	assert.Equal(t, 10*24*time.Hour, services.NewCertRenewalService().Window())
+
+	t.Setenv(services.EnvCertRenewalDays, "soon")
+	assert.Equal(t, services.DefaultCertRenewalWindow, services.NewCertRenewalService().Window())
+}
+
+func TestCertRenewalService_CheckAccountRecordsExpiry(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	kv := services.NewKVServiceWithStore(store)
+
+	notAfter := time.Now().Add(80 * 24 * time.Hour).Truncate(time.Second).UTC()
+	require.NoError(t, kv.StoreDomainSSLConfig("token", "account", &services.DomainSSLConfig{
+		Domain:      "example.com",
+		Certificate: selfSignedPEM(t, "example.com", notAfter),
+	}))
+
+	renewal := services.NewCertRenewalServiceWithKV(kv, 30*24*time.Hour, time.Hour)
+	require.NoError(t, renewal.CheckAccount(context.Background(), "token", "account"))
+
+	config, err := kv.GetDomainSSLConfig("token", "account", "example.com")
+	require.NoError(t, err)
+	assert.Equal(t, notAfter.Format(time.RFC3339), config.ExpiresAt)
+	assert.Empty(t, config.RenewedAt)
+}
+
+func TestCertRenewalService_CheckAccountRetriesDistribution(t *testing.T) {
+	// The global keyring loads its instance secret from the data directory
+	t.Setenv("XANTHUS_DATA_DIR", t.TempDir())
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	previousStore, previousKeyring := utils.GetStateStore(), utils.GetKeyring()
+	utils.SetStateStore(store)
+	utils.SetKeyring(utils.NewKeyring(store, "", utils.KEKSourceToken))
+	t.Cleanup(func() {
+		utils.SetStateStore(previousStore)
+		utils.SetKeyring(previousKeyring)
+	})
+	_, err = services.NewSSHKeyServiceWithStore(store, nil).KeyPair("token", "account")
+	require.NoError(t, err)
+
+	// Renewed, but not installed on the servers yet
+	kv := services.NewKVServiceWithStore(store)
+	require.NoError(t, kv.StoreDomainSSLConfig("token", "account", &services.DomainSSLConfig{
+		Domain:              "example.com",
+		Certificate:         selfSignedPEM(t, "example.com", time.Now().Add(80*24*time.Hour)),
+		RenewalError:        "failed to install certificate on server 1",
+		DistributionPending: true,
+	}))
+	// A failed renewal is not an installation to retry
+	require.NoError(t, kv.StoreDomainSSLConfig("token", "account", &services.DomainSSLConfig{
+		Domain:       "example.org",
+		Certificate:  selfSignedPEM(t, "example.org", time.Now().Add(80*24*time.Hour)),
+		RenewalError: "failed to create origin certificate",
+	}))
+
+	renewal := services.NewCertRenewalServiceWithKV(kv, 30*24*time.Hour, time.Hour)
+	require.NoError(t, renewal.CheckAccount(context.Background(), "token", "account"))
+
+	config, err := kv.GetDomainSSLConfig("token", "account", "example.com")
+	require.NoError(t, err)
+	assert.False(t, config.DistributionPending)
+	assert.Empty(t, config.RenewalError)
+
+	config, err = kv.GetDomainSSLConfig("token", "account", "example.org")
+	require.NoError(t, err)
+	assert.Equal(t, "failed to create origin certificate", config.RenewalError)
+}
+
+func TestBackgroundAccountRegistry(t *testing.T) {
+	registry := services.NewBackgroundAccountRegistry()
+	registry.Register("token-b", "account-b")
+	registry.Register("token-a", "account-a")
+	registry.Register("token-a2", "account-a")
+	registry.Register("", "account-c")
+
+	assert.Equal(t, []services.BackgroundAccount{
+		{Token: "token-a2", AccountID: "account-a"},
+		{Token: "token-b", AccountID: "account-b"},
+	}, registry.Accounts())
+
+	registry.Forget("account-b")
+	assert.Len(t, registry.Accounts(), 1)
+}
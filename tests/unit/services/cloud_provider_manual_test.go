@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+)
+
+func TestCloudInitScript(t *testing.T) {
+	t.Run("translates packages, files and commands", func(t *testing.T) {
+		script, err := services.CloudInitScript(`#cloud-config
+package_update: true
+package_upgrade: true
+timezone: Europe/Berlin
+packages:
+  - curl
+  - jq
+write_files:
+  - path: /opt/xanthus/setup.sh
+    permissions: '0755'
+    owner: root:root
+    content: |
+      #!/bin/bash
+      echo "it's ready"
+runcmd:
+  - /opt/xanthus/setup.sh
+  - [systemctl, restart, "ssh server"]
+`)
+		require.NoError(t, err)
+
+		assert.Contains(t, script, "set -e\n")
+		assert.Contains(t, script, "timedatectl set-timezone 'Europe/Berlin'\n")
+		assert.Contains(t, script, "apt-get update -y\napt-get upgrade -y\napt-get install -y 'curl' 'jq'\n")
+		assert.Contains(t, script, "chmod '0755' '/opt/xanthus/setup.sh'\n")
+		assert.Contains(t, script, "chown 'root:root' '/opt/xanthus/setup.sh'\n")
+		assert.Contains(t, script, "\n/opt/xanthus/setup.sh\n'systemctl' 'restart' 'ssh server'\n")
+	})
+
+	t.Run("generated script writes and appends files", func(t *testing.T) {
+		if _, err := exec.LookPath("bash"); err != nil {
+			t.Skip("bash not available")
+		}
+		dir := t.TempDir()
+		target := filepath.Join(dir, "etc", "environment")
+		marker := filepath.Join(dir, "ran")
+		require.NoError(t, os.MkdirAll(filepath.Dir(target), 0755))
+		require.NoError(t, os.WriteFile(target, []byte("PATH=/usr/bin\n"), 0644))
+
+		script, err := services.CloudInitScript(`#cloud-config
+write_files:
+  - path: ` + target + `
+    append: true
+    content: |
+      KUBECONFIG=/etc/rancher/k3s/k3s.yaml
+  - path: ` + filepath.Join(dir, "opt", "info.txt") + `
+    encoding: b64
+    content: aGVsbG8gJ3dvcmxkJw==
+runcmd:
+  - touch ` + marker + `
+`)
+		require.NoError(t, err)
+
+		out, err := exec.Command("bash", "-c", script).CombinedOutput()
+		require.NoError(t, err, string(out))
+
+		environment, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "PATH=/usr/bin\nKUBECONFIG=/etc/rancher/k3s/k3s.yaml\n", string(environment))
+
+		info, err := os.ReadFile(filepath.Join(dir, "opt", "info.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, "hello 'world'", string(info))
+
+		assert.FileExists(t, marker)
+	})
+
+	t.Run("rejects invalid documents", func(t *testing.T) {
+		_, err := services.CloudInitScript("write_files: {path: [")
+		assert.Error(t, err)
+
+		_, err = services.CloudInitScript("write_files:\n  - content: orphan\n")
+		assert.Error(t, err)
+	})
+}
+
+func TestManualProvider(t *testing.T) {
+	provider := services.NewManualProvider(services.NewSSHService(), "")
+	ctx := context.Background()
+
+	t.Run("is registered", func(t *testing.T) {
+		for _, alias := range []string{"Manual", "manual", "byo", "ssh"} {
+			name, ok := services.CanonicalProviderName(alias)
+			assert.True(t, ok, alias)
+			assert.Equal(t, services.ProviderManual, name)
+		}
+	})
+
+	t.Run("has no catalog and no price", func(t *testing.T) {
+		locations, err := provider.ListLocations(ctx)
+		require.NoError(t, err)
+		assert.Empty(t, locations)
+
+		hourly, monthly, err := provider.Pricing(ctx, "manual", "")
+		require.NoError(t, err)
+		assert.Zero(t, hourly)
+		assert.Zero(t, monthly)
+	})
+
+	t.Run("servers are added, not created", func(t *testing.T) {
+		_, err := provider.CreateServer(ctx, services.CloudServerRequest{Name: "web-1"})
+		assert.ErrorIs(t, err, services.ErrInvalidServerRequest)
+	})
+
+	t.Run("power actions", func(t *testing.T) {
+		config := &services.VPSConfig{Name: "homelab", PublicIPv4: "192.0.2.10", SSHUser: "root", Provider: services.ProviderManual}
+
+		assert.ErrorIs(t, provider.PowerAction(ctx, config, services.PowerActionOn), services.ErrPowerActionUnsupported)
+		assert.Error(t, provider.PowerAction(ctx, config, "explode"))
+	})
+
+	t.Run("delete only forgets the server", func(t *testing.T) {
+		assert.NoError(t, provider.DeleteServer(ctx, &services.VPSConfig{Name: "homelab", PublicIPv4: "192.0.2.10"}))
+	})
+}
+
+func TestVPSConfig_SSHAddress(t *testing.T) {
+	assert.Equal(t, "192.0.2.10", (&services.VPSConfig{PublicIPv4: "192.0.2.10"}).SSHAddress())
+	assert.Equal(t, "192.0.2.10", (&services.VPSConfig{PublicIPv4: "192.0.2.10", SSHPort: 22}).SSHAddress())
+	assert.Equal(t, "192.0.2.10:2222", (&services.VPSConfig{PublicIPv4: "192.0.2.10", SSHPort: 2222}).SSHAddress())
+	assert.Equal(t, "[2001:db8::1]:2222", (&services.VPSConfig{PublicIPv4: "2001:db8::1", SSHPort: 2222}).SSHAddress())
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+)
+
+// fakeProvider is a CloudProvider that records the calls made to it
+type fakeProvider struct {
+	token, accountID string
+	powerActions     []string
+	servers          []services.CloudServer
+}
+
+func (f *fakeProvider) Name() string { return "Fake Cloud" }
+func (f *fakeProvider) ListLocations(ctx context.Context) ([]services.CloudLocation, error) {
+	return []services.CloudLocation{{Name: "fk1"}}, nil
+}
+func (f *fakeProvider) ListServerTypes(ctx context.Context, location string) ([]services.CloudServerType, error) {
+	return nil, nil
+}
+func (f *fakeProvider) Pricing(ctx context.Context, serverType, location string) (float64, float64, error) {
+	return 0, 0, nil
+}
+func (f *fakeProvider) RegisterSSHKey(ctx context.Context, name, publicKey string) (string, error) {
+	return name, nil
+}
+func (f *fakeProvider) UnregisterSSHKey(ctx context.Context, publicKey string) error {
+	return nil
+}
+func (f *fakeProvider) CloudInit() string { return "timezone: ${TIMEZONE}" }
+func (f *fakeProvider) CreateServer(ctx context.Context, req services.CloudServerRequest) (*services.CloudServer, error) {
+	return &services.CloudServer{ID: 1, Name: req.Name}, nil
+}
+func (f *fakeProvider) DeleteServer(ctx context.Context, config *services.VPSConfig) error {
+	return nil
+}
+func (f *fakeProvider) PowerAction(ctx context.Context, config *services.VPSConfig, action string) error {
+	f.powerActions = append(f.powerActions, action)
+	return nil
+}
+func (f *fakeProvider) ServerExists(ctx context.Context, config *services.VPSConfig) (bool, error) {
+	return true, nil
+}
+func (f *fakeProvider) ListServers(ctx context.Context) ([]services.CloudServer, error) {
+	return f.servers, nil
+}
+
+func TestRenderCloudInit(t *testing.T) {
+	template := "tz=${TIMEZONE} domain=${DOMAIN} cert=${DOMAIN_CERT} key=${DOMAIN_KEY} other=${OTHER}"
+
+	rendered := services.RenderCloudInit(template, services.CloudInitVars{
+		Timezone:   "Europe/Berlin",
+		Domain:     "example.com",
+		DomainCert: "Y2VydA==",
+	})
+
+	assert.Equal(t, "tz=Europe/Berlin domain=example.com cert=Y2VydA== key= other=${OTHER}", rendered)
+
+	agent := services.RenderCloudInit("K3S_URL=https://${K3S_SERVER}:6443 K3S_TOKEN=${K3S_TOKEN} v=${K3S_VERSION} name=${NODE_NAME}", services.CloudInitVars{
+		K3sServer: "10.0.0.2",
+		K3sToken:  "K10abc::server:secret",
+		NodeName:  "worker-1",
+	})
+	assert.Equal(t, "K3S_URL=https://10.0.0.2:6443 K3S_TOKEN=K10abc::server:secret v= name=worker-1", agent)
+}
+
+func TestCloudProviderRegistry(t *testing.T) {
+	var created *fakeProvider
+	services.RegisterCloudProvider("Fake Cloud", func(token, accountID string) (services.CloudProvider, error) {
+		created = &fakeProvider{token: token, accountID: accountID}
+		return created, nil
+	}, "fake")
+
+	t.Run("resolves name and aliases case-insensitively", func(t *testing.T) {
+		for _, alias := range []string{"Fake Cloud", "fake cloud", "FAKE", " fake "} {
+			name, ok := services.CanonicalProviderName(alias)
+			assert.True(t, ok, alias)
+			assert.Equal(t, "Fake Cloud", name, alias)
+		}
+	})
+
+	t.Run("builtin providers are registered", func(t *testing.T) {
+		names := services.CloudProviderNames()
+		assert.Contains(t, names, services.ProviderHetzner)
+		assert.Contains(t, names, services.ProviderOCI)
+		assert.Contains(t, names, "Fake Cloud")
+
+		for _, alias := range []string{"oci", "OCI", services.ProviderOCI} {
+			name, ok := services.CanonicalProviderName(alias)
+			assert.True(t, ok)
+			assert.Equal(t, services.ProviderOCI, name)
+		}
+		name, ok := services.CanonicalProviderName("hetzner")
+		assert.True(t, ok)
+		assert.Equal(t, services.ProviderHetzner, name)
+	})
+
+	t.Run("creates providers bound to the account", func(t *testing.T) {
+		provider, err := services.NewCloudProvider("fake", "cf-token", "account-1")
+		require.NoError(t, err)
+		assert.Equal(t, "Fake Cloud", provider.Name())
+		assert.Equal(t, "cf-token", created.token)
+		assert.Equal(t, "account-1", created.accountID)
+
+		require.NoError(t, provider.PowerAction(context.Background(), &services.VPSConfig{ServerID: 1}, services.PowerActionReboot))
+		assert.Equal(t, []string{services.PowerActionReboot}, created.powerActions)
+	})
+
+	t.Run("rejects unknown providers", func(t *testing.T) {
+		_, ok := services.CanonicalProviderName("aws")
+		assert.False(t, ok)
+
+		_, err := services.NewCloudProvider("aws", "cf-token", "account-1")
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unsupported provider: aws")
+	})
+}
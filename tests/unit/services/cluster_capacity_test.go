@@ -0,0 +1,69 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/services"
+)
+
+const capacityNodes = `{"items": [
+	{"metadata": {"name": "control"}, "status": {
+		"allocatable": {"cpu": "4", "memory": "8Gi"},
+		"conditions": [{"type": "Ready", "status": "True"}]}},
+	{"metadata": {"name": "worker-1"}, "status": {
+		"allocatable": {"cpu": "2", "memory": "4194304Ki"},
+		"conditions": [{"type": "Ready", "status": "True"}]}},
+	{"metadata": {"name": "worker-2"}, "spec": {"unschedulable": true}, "status": {
+		"allocatable": {"cpu": "2", "memory": "4Gi"},
+		"conditions": [{"type": "Ready", "status": "True"}]}},
+	{"metadata": {"name": "worker-3"}, "status": {
+		"allocatable": {"cpu": "2", "memory": "4Gi"},
+		"conditions": [{"type": "Ready", "status": "False"}]}}
+]}`
+
+const capacityPods = `{"items": [
+	{"spec": {"nodeName": "control", "containers": [
+		{"resources": {"requests": {"cpu": "500m", "memory": "512Mi"}}},
+		{"resources": {"requests": {"cpu": "250m"}}}]}},
+	{"spec": {"nodeName": "worker-1", "containers": [
+		{"resources": {"requests": {"cpu": "3", "memory": "1Gi"}}}]}},
+	{"spec": {"nodeName": "worker-2", "containers": [
+		{"resources": {"requests": {"cpu": "1", "memory": "1Gi"}}}]}}
+]}`
+
+func TestParseClusterCapacity(t *testing.T) {
+	info, err := services.ParseClusterCapacity(capacityNodes, capacityPods)
+	require.NoError(t, err)
+
+	// worker-1 is overcommitted and adds no CPU; cordoned and NotReady nodes don't count
+	assert.Equal(t, 2, info.NodeCount)
+	assert.Equal(t, 3.25, info.AvailableCPU)
+	assert.Equal(t, 10, info.AvailableMemoryGB) // 7.5 + 3 GiB
+
+	_, err = services.ParseClusterCapacity("not json", capacityPods)
+	assert.Error(t, err)
+}
+
+func TestEnhancedApplicationValidator_ValidateCapacity(t *testing.T) {
+	validator := services.NewEnhancedApplicationValidator(models.NewDefaultApplicationValidator())
+	app := models.PredefinedApplication{ID: "argocd", Requirements: models.ApplicationRequirements{MinCPU: 1, MinMemory: 2, MinDisk: 5}}
+	cluster := services.ClusterInfo{AvailableCPU: 1.5, AvailableMemoryGB: 2, AvailableDiskGB: 20, KubernetesVersion: "v1.31.2+k3s1", HelmVersion: "v3.16.2", NodeCount: 1}
+
+	assert.NoError(t, validator.ValidateCapacity(app, cluster))
+
+	short := cluster
+	short.AvailableMemoryGB = 1
+	assert.ErrorContains(t, validator.ValidateCapacity(app, short), "requires 2 GB memory")
+
+	short = cluster
+	short.AvailableDiskGB = 4
+	assert.ErrorContains(t, validator.ValidateCapacity(app, short), "requires 5 GB disk")
+
+	short = cluster
+	short.NodeCount = 0
+	assert.ErrorContains(t, validator.ValidateCapacity(app, short), "no available nodes")
+}
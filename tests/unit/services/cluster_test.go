@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+func TestClusterService_JoinRefusals(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	keyring := utils.NewKeyring(store, "", utils.KEKSourceToken)
+
+	kv := services.NewKVServiceWithStore(store)
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:1:config", services.VPSConfig{ServerID: 1, Name: "control", Provider: services.ProviderHetzner, PublicIPv4: "10.0.0.1"}))
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:2:config", services.VPSConfig{ServerID: 2, Name: "worker", Provider: services.ProviderHetzner, ClusterServerID: 1}))
+
+	cluster := services.NewClusterServiceWithStore(store, keyring)
+	ctx := context.Background()
+
+	for name, req := range map[string]services.JoinNodeRequest{
+		"unknown server":        {ServerID: 3, Name: "worker-2"},
+		"agent node as server":  {ServerID: 2, Name: "worker-2"},
+		"invalid node name":     {ServerID: 1, Name: "Worker 2"},
+		"unknown provider":      {ServerID: 1, Name: "worker-2", Provider: "nimbus"},
+		"manual node sans host": {ServerID: 1, Name: "worker-2", Provider: "manual"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := cluster.Join(ctx, "cf-token", "account-1", req)
+			assert.ErrorIs(t, err, services.ErrInvalidClusterRequest)
+		})
+	}
+}
+
+func TestClusterService_Membership(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+
+	kv := services.NewKVServiceWithStore(store)
+	server := &services.VPSConfig{ServerID: 1, Name: "control"}
+	agents := []*services.VPSConfig{
+		{ServerID: 3, Name: "worker-b", ClusterServerID: 1},
+		{ServerID: 2, Name: "worker-a", ClusterServerID: 1},
+	}
+	for _, config := range append(agents, server, &services.VPSConfig{ServerID: 4, Name: "standalone"}) {
+		require.NoError(t, kv.StoreVPSConfig("cf-token", "account-1", config))
+	}
+
+	cluster := services.NewClusterServiceWithStore(store, nil)
+
+	membership, err := cluster.Membership("cf-token", "account-1", server)
+	require.NoError(t, err)
+	assert.Equal(t, &services.ClusterMembership{Role: services.ClusterRoleServer, ServerID: 1, ServerName: "control", Agents: []int{2, 3}}, membership)
+
+	membership, err = cluster.Membership("cf-token", "account-1", agents[0])
+	require.NoError(t, err)
+	assert.Equal(t, &services.ClusterMembership{Role: services.ClusterRoleAgent, ServerID: 1, ServerName: "control"}, membership)
+
+	assert.True(t, agents[0].IsAgent())
+	assert.False(t, server.IsAgent())
+}
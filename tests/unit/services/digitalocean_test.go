@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+)
+
+// fakeDigitalOcean is an httptest stand-in for the parts of the DigitalOcean API Xanthus uses
+type fakeDigitalOcean struct {
+	mu      sync.Mutex
+	keys    []services.DigitalOceanSSHKey
+	created []services.DigitalOceanCreateDropletRequest
+	actions []string
+	deleted []string
+}
+
+func newFakeDigitalOcean(t *testing.T) (*fakeDigitalOcean, *httptest.Server) {
+	fake := &fakeDigitalOcean{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer do-token", r.Header.Get("Authorization"))
+
+		fake.mu.Lock()
+		defer fake.mu.Unlock()
+
+		reply := func(status int, body interface{}) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			json.NewEncoder(w).Encode(body)
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/regions":
+			reply(http.StatusOK, map[string]interface{}{"regions": []services.DigitalOceanRegion{
+				{Slug: "fra1", Name: "Frankfurt 1", Available: true},
+				{Slug: "nyc2", Name: "New York 2", Available: false},
+			}})
+		case r.Method == "GET" && r.URL.Path == "/sizes":
+			reply(http.StatusOK, map[string]interface{}{"sizes": []services.DigitalOceanSize{
+				{Slug: "s-1vcpu-1gb", Memory: 1024, VCPUs: 1, Disk: 25, PriceMonthly: 6, PriceHourly: 0.00893, Regions: []string{"fra1", "nyc1"}, Available: true},
+				{Slug: "s-2vcpu-4gb", Memory: 4096, VCPUs: 2, Disk: 80, PriceMonthly: 24, PriceHourly: 0.03571, Regions: []string{"nyc1"}, Available: true},
+			}})
+		case r.Method == "GET" && r.URL.Path == "/account/keys":
+			reply(http.StatusOK, map[string]interface{}{"ssh_keys": fake.keys})
+		case r.Method == "POST" && r.URL.Path == "/account/keys":
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			key := services.DigitalOceanSSHKey{ID: len(fake.keys) + 1, Name: body["name"], PublicKey: body["public_key"], Fingerprint: "aa:bb:cc"}
+			fake.keys = append(fake.keys, key)
+			reply(http.StatusCreated, map[string]interface{}{"ssh_key": key})
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/account/keys/"):
+			remaining := fake.keys[:0]
+			for _, key := range fake.keys {
+				if r.URL.Path != fmt.Sprintf("/account/keys/%d", key.ID) {
+					remaining = append(remaining, key)
+				}
+			}
+			fake.keys = remaining
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "POST" && r.URL.Path == "/droplets":
+			var body services.DigitalOceanCreateDropletRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			fake.created = append(fake.created, body)
+			reply(http.StatusAccepted, map[string]interface{}{"droplet": services.DigitalOceanDroplet{ID: 4242, Name: body.Name, Status: "new"}})
+		case r.Method == "GET" && r.URL.Path == "/droplets" && r.URL.Query().Get("page") == "":
+			reply(http.StatusOK, map[string]interface{}{
+				"droplets": []services.DigitalOceanDroplet{{ID: 1, Name: "web-1", SizeSlug: "s-1vcpu-1gb"}},
+				"links":    map[string]interface{}{"pages": map[string]string{"next": "http://" + r.Host + "/droplets?page=2&per_page=200"}},
+			})
+		case r.Method == "GET" && r.URL.Path == "/droplets" && r.URL.Query().Get("page") == "2":
+			reply(http.StatusOK, map[string]interface{}{
+				"droplets": []services.DigitalOceanDroplet{{ID: 2, Name: "arm-1", SizeSlug: "s-2vcpu-4gb", Image: services.DigitalOceanImageInfo{Slug: "ubuntu-24-04-arm64"}}},
+				"links":    map[string]interface{}{},
+			})
+		case r.Method == "GET" && r.URL.Path == "/droplets/4242":
+			reply(http.StatusOK, map[string]interface{}{"droplet": services.DigitalOceanDroplet{
+				ID: 4242, Name: "web-1", Status: "active", CreatedAt: "2026-01-02T03:04:05Z",
+				Networks: services.DigitalOceanNetworks{V4: []services.DigitalOceanNetwork{
+					{IPAddress: "10.0.0.2", Type: "private"},
+					{IPAddress: "203.0.113.7", Type: "public"},
+				}},
+			}})
+		case r.Method == "POST" && strings.HasSuffix(r.URL.Path, "/actions"):
+			var body map[string]string
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+			fake.actions = append(fake.actions, r.URL.Path+" "+body["type"])
+			reply(http.StatusCreated, map[string]interface{}{"action": map[string]string{"status": "in-progress"}})
+		case r.Method == "DELETE" && r.URL.Path == "/droplets/4242":
+			fake.deleted = append(fake.deleted, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == "DELETE":
+			reply(http.StatusNotFound, services.DigitalOceanError{ID: "not_found", Message: "The resource you were accessing could not be found."})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+func newTestDigitalOceanProvider(t *testing.T) (*fakeDigitalOcean, *services.DigitalOceanProvider) {
+	fake, server := newFakeDigitalOcean(t)
+	service := services.NewDigitalOceanServiceWithBaseURL(server.URL)
+	return fake, services.NewDigitalOceanProviderWithService(service, "do-token")
+}
+
+func TestDigitalOceanProvider_Registered(t *testing.T) {
+	for _, alias := range []string{"DigitalOcean", "digitalocean", "do"} {
+		name, ok := services.CanonicalProviderName(alias)
+		assert.True(t, ok, alias)
+		assert.Equal(t, services.ProviderDigitalOcean, name)
+	}
+}
+
+func TestDigitalOceanProvider_Catalog(t *testing.T) {
+	_, provider := newTestDigitalOceanProvider(t)
+	ctx := context.Background()
+
+	locations, err := provider.ListLocations(ctx)
+	require.NoError(t, err)
+	require.Len(t, locations, 1, "unavailable regions are skipped")
+	assert.Equal(t, services.CloudLocation{Name: "fra1", Description: "Frankfurt 1", City: "Frankfurt"}, locations[0])
+
+	types, err := provider.ListServerTypes(ctx, "fra1")
+	require.NoError(t, err)
+	require.Len(t, types, 1)
+	assert.Equal(t, "s-1vcpu-1gb", types[0].Name)
+	assert.Equal(t, 1.0, types[0].MemoryGB)
+	assert.Equal(t, 6.0, types[0].MonthlyPrice)
+
+	all, err := provider.ListServerTypes(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, all, 2)
+
+	hourly, monthly, err := provider.Pricing(ctx, "s-2vcpu-4gb", "nyc1")
+	require.NoError(t, err)
+	assert.Equal(t, 0.03571, hourly)
+	assert.Equal(t, 24.0, monthly)
+
+	_, _, err = provider.Pricing(ctx, "s-64vcpu-256gb", "nyc1")
+	assert.Error(t, err)
+}
+
+func TestDigitalOceanProvider_RegisterSSHKey(t *testing.T) {
+	fake, provider := newTestDigitalOceanProvider(t)
+	ctx := context.Background()
+
+	fingerprint, err := provider.RegisterSSHKey(ctx, "xanthus-key-1", "ssh-rsa AAAA xanthus")
+	require.NoError(t, err)
+	assert.Equal(t, "aa:bb:cc", fingerprint)
+
+	// The same public key is reused rather than uploaded again
+	fingerprint, err = provider.RegisterSSHKey(ctx, "xanthus-key-2", "ssh-rsa AAAA xanthus\n")
+	require.NoError(t, err)
+	assert.Equal(t, "aa:bb:cc", fingerprint)
+	assert.Len(t, fake.keys, 1)
+
+	// Unregistering removes the key; unknown keys are ignored
+	require.NoError(t, provider.UnregisterSSHKey(ctx, "ssh-ed25519 BBBB xanthus"))
+	assert.Len(t, fake.keys, 1)
+	require.NoError(t, provider.UnregisterSSHKey(ctx, "ssh-rsa AAAA xanthus"))
+	assert.Empty(t, fake.keys)
+}
+
+func TestDigitalOceanProvider_ServerLifecycle(t *testing.T) {
+	fake, provider := newTestDigitalOceanProvider(t)
+	ctx := context.Background()
+
+	userData := services.RenderCloudInit(provider.CloudInit(), services.CloudInitVars{Timezone: "Europe/Berlin"})
+	server, err := provider.CreateServer(ctx, services.CloudServerRequest{
+		Name:       "web-1",
+		ServerType: "s-1vcpu-1gb",
+		Location:   "fra1",
+		SSHKeyName: "aa:bb:cc",
+		UserData:   userData,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 4242, server.ID)
+	assert.Equal(t, "203.0.113.7", server.PublicIPv4)
+	assert.Equal(t, "fra1", server.Location)
+
+	require.Len(t, fake.created, 1)
+	created := fake.created[0]
+	assert.Equal(t, "ubuntu-24-04-x64", created.Image)
+	assert.Equal(t, []string{"aa:bb:cc"}, created.SSHKeys)
+	assert.Contains(t, created.UserData, "Europe/Berlin")
+	assert.NotContains(t, created.UserData, "${TIMEZONE}")
+
+	config := &services.VPSConfig{ServerID: server.ID, Provider: services.ProviderDigitalOcean}
+	for _, action := range []string{services.PowerActionOff, services.PowerActionOn, services.PowerActionReboot} {
+		require.NoError(t, provider.PowerAction(ctx, config, action))
+	}
+	assert.Equal(t, []string{
+		"/droplets/4242/actions power_off",
+		"/droplets/4242/actions power_on",
+		"/droplets/4242/actions reboot",
+	}, fake.actions)
+	assert.Error(t, provider.PowerAction(ctx, config, "explode"))
+
+	require.NoError(t, provider.DeleteServer(ctx, config))
+	assert.Equal(t, []string{"/droplets/4242"}, fake.deleted)
+
+	// A droplet deleted outside Xanthus is not an error
+	require.NoError(t, provider.DeleteServer(ctx, &services.VPSConfig{ServerID: 1}))
+}
+
+func TestDigitalOceanProvider_ListServersFollowsPages(t *testing.T) {
+	_, provider := newTestDigitalOceanProvider(t)
+
+	servers, err := provider.ListServers(context.Background())
+	require.NoError(t, err)
+	require.Len(t, servers, 2)
+	assert.Equal(t, "web-1", servers[0].Name)
+	assert.Equal(t, "x86", servers[0].Architecture)
+	assert.Equal(t, "arm-1", servers[1].Name)
+	assert.Equal(t, "arm", servers[1].Architecture)
+}
+
+func TestDigitalOceanProvider_HonoursContext(t *testing.T) {
+	_, provider := newTestDigitalOceanProvider(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := provider.ListServers(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
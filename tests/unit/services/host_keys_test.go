@@ -0,0 +1,76 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/chrishham/xanthus/internal/services"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	t.Helper()
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	key, err := ssh.NewPublicKey(public)
+	require.NoError(t, err)
+	return key
+}
+
+func TestKnownHosts_TrustOnFirstUse(t *testing.T) {
+	hosts := services.NewKnownHosts()
+	callback := hosts.HostKeyCallback()
+	remote := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 22}
+	original := newHostKey(t)
+
+	// Unknown servers are trusted and their key remembered
+	require.NoError(t, callback("203.0.113.7:22", remote, original))
+	_, ok := hosts.Learned("203.0.113.7")
+	assert.True(t, ok)
+
+	config := &services.VPSConfig{ServerID: 1, Name: "web-1", PublicIPv4: "203.0.113.7"}
+	assert.True(t, hosts.Remember(config), "a learned key should be recorded in the config")
+	assert.Equal(t, ssh.FingerprintSHA256(original), config.HostKeyFingerprint)
+	assert.NotEmpty(t, config.HostKey)
+	assert.False(t, hosts.Remember(config), "an already pinned config needs no update")
+
+	// The pinned key is accepted, any other key is refused
+	require.NoError(t, callback("203.0.113.7:22", remote, original))
+	err := callback("203.0.113.7:22", remote, newHostKey(t))
+	require.Error(t, err)
+	assert.ErrorIs(t, err, services.ErrHostKeyMismatch)
+	assert.Contains(t, err.Error(), config.HostKeyFingerprint)
+
+	line, ok := hosts.KnownHostsLine("203.0.113.7")
+	assert.True(t, ok)
+	assert.Contains(t, line, "203.0.113.7")
+
+	// Forgetting the address (e.g. after the server was deleted) allows a new key
+	hosts.Forget("203.0.113.7")
+	require.NoError(t, callback("203.0.113.7:22", remote, newHostKey(t)))
+}
+
+func TestKnownHosts_PinFromConfig(t *testing.T) {
+	hosts := services.NewKnownHosts()
+	pinned := newHostKey(t)
+	config := &services.VPSConfig{
+		ServerID:   2,
+		PublicIPv4: "198.51.100.4",
+		SSHPort:    2222,
+		HostKey:    string(ssh.MarshalAuthorizedKey(pinned)),
+	}
+	assert.False(t, hosts.Remember(config))
+
+	callback := hosts.HostKeyCallback()
+	remote := &net.TCPAddr{IP: net.ParseIP("198.51.100.4"), Port: 2222}
+	require.NoError(t, callback("198.51.100.4:2222", remote, pinned))
+	assert.ErrorIs(t, callback("198.51.100.4:2222", remote, newHostKey(t)), services.ErrHostKeyMismatch)
+
+	// Port 22 of the same host is a different SSH endpoint
+	require.NoError(t, callback("198.51.100.4:22", remote, newHostKey(t)))
+}
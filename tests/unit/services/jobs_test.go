@@ -0,0 +1,236 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+func newJobTestStore(t *testing.T) utils.StateStore {
+	t.Helper()
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	return store
+}
+
+func waitForJob(t *testing.T, jobs *services.JobManager, id string) *services.Job {
+	t.Helper()
+	var job *services.Job
+	require.Eventually(t, func() bool {
+		var err error
+		job, err = jobs.Get("cf-token", "account-1", id)
+		require.NoError(t, err)
+		return job.Finished()
+	}, 5*time.Second, 10*time.Millisecond)
+	return job
+}
+
+func TestJobManager_RecordsStepsAndLogs(t *testing.T) {
+	store := newJobTestStore(t)
+	jobs := services.NewJobManagerWithStore(store)
+
+	job, err := jobs.Run("cf-token", "account-1", services.JobSpec{Type: services.JobTypeAppDeploy, Target: "code.example.com"}, func(ctx context.Context) error {
+		assert.NotEmpty(t, services.JobID(ctx))
+		require.NoError(t, services.StartJobStep(ctx, "Installing Helm release"))
+		services.JobLogf(ctx, "release %s installed", "code-code-server")
+		require.NoError(t, services.StartJobStep(ctx, "Configuring DNS"))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, services.JobSucceeded, job.Status)
+	require.Len(t, job.Steps, 2)
+	assert.Equal(t, services.JobSucceeded, job.Steps[0].Status)
+	assert.Equal(t, services.JobSucceeded, job.Steps[1].Status)
+	assert.Equal(t, "release code-code-server installed", job.Logs[1].Message)
+
+	// The job outlives the manager that ran it
+	stored, err := services.NewJobManagerWithStore(store).Get("cf-token", "account-1", job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, services.JobSucceeded, stored.Status)
+	assert.Len(t, stored.Steps, 2)
+	assert.NotNil(t, stored.FinishedAt)
+
+	_, err = jobs.Get("cf-token", "account-2", job.ID)
+	assert.ErrorIs(t, err, services.ErrJobNotFound)
+}
+
+func TestJobManager_RetriesFailedWork(t *testing.T) {
+	jobs := services.NewJobManagerWithStore(newJobTestStore(t))
+
+	calls := 0
+	job, err := jobs.Run("cf-token", "account-1", services.JobSpec{Type: services.JobTypeAppUpgrade, MaxAttempts: 3, RetryDelay: time.Millisecond}, func(ctx context.Context) error {
+		calls++
+		if calls < 2 {
+			return errors.New("helm timed out")
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, calls)
+	assert.Equal(t, 2, job.Attempt)
+	assert.Equal(t, services.JobSucceeded, job.Status)
+
+	job, err = jobs.Run("cf-token", "account-1", services.JobSpec{Type: services.JobTypeAppUpgrade, MaxAttempts: 2, RetryDelay: time.Millisecond}, func(ctx context.Context) error {
+		return errors.New("chart not found")
+	})
+	require.EqualError(t, err, "chart not found")
+	assert.Equal(t, services.JobFailed, job.Status)
+	assert.Equal(t, "chart not found", job.Error)
+	assert.Equal(t, 2, job.Attempt)
+}
+
+func TestJobManager_Cancel(t *testing.T) {
+	jobs := services.NewJobManagerWithStore(newJobTestStore(t))
+
+	started := make(chan struct{})
+	job := jobs.Start("cf-token", "account-1", services.JobSpec{Type: services.JobTypeVPSSetup}, func(ctx context.Context) error {
+		if err := services.StartJobStep(ctx, "Installing K3s"); err != nil {
+			return err
+		}
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+
+	_, err := jobs.Cancel("cf-token", "account-1", job.ID)
+	require.NoError(t, err)
+
+	finished := waitForJob(t, jobs, job.ID)
+	assert.Equal(t, services.JobCancelled, finished.Status)
+	assert.Equal(t, services.JobCancelled, finished.Steps[0].Status)
+
+	_, err = jobs.Cancel("cf-token", "account-1", job.ID)
+	assert.ErrorIs(t, err, services.ErrJobFinished)
+	_, err = jobs.Cancel("cf-token", "account-1", "job-unknown")
+	assert.ErrorIs(t, err, services.ErrJobNotFound)
+}
+
+func TestJobManager_InterruptedJobsFail(t *testing.T) {
+	store := newJobTestStore(t)
+	jobs := services.NewJobManagerWithStore(store)
+
+	release := make(chan struct{})
+	job := jobs.Start("cf-token", "account-1", services.JobSpec{Type: services.JobTypeVPSCreate}, func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	_, events, _, err := jobs.Subscribe("cf-token", "account-1", job.ID)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		// Let the job finish before its store is removed
+		close(release)
+		for range events {
+		}
+	})
+
+	// A new process sees the job as still running in the store
+	restarted := services.NewJobManagerWithStore(store)
+	stored, err := restarted.Get("cf-token", "account-1", job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, services.JobFailed, stored.Status)
+	assert.Contains(t, stored.Error, "interrupted")
+
+	list, err := restarted.List("cf-token", "account-1", 10)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, services.JobFailed, list[0].Status)
+}
+
+func TestJobManager_CompleteJobBeforeRestart(t *testing.T) {
+	store := newJobTestStore(t)
+	jobs := services.NewJobManagerWithStore(store)
+
+	job, err := jobs.Run("cf-token", "account-1", services.JobSpec{Type: services.JobTypeSelfUpdate}, func(ctx context.Context) error {
+		services.CompleteJob(ctx, "Update completed successfully")
+
+		// The process is replaced at this point, so the job must already be stored as succeeded
+		stored, err := services.NewJobManagerWithStore(store).Get("cf-token", "account-1", services.JobID(ctx))
+		require.NoError(t, err)
+		assert.Equal(t, services.JobSucceeded, stored.Status)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, services.JobSucceeded, job.Status)
+}
+
+func TestJobManager_ListNewestFirst(t *testing.T) {
+	jobs := services.NewJobManagerWithStore(newJobTestStore(t))
+
+	for _, target := range []string{"first", "second", "third"} {
+		_, err := jobs.Run("cf-token", "account-1", services.JobSpec{Type: services.JobTypeVPSPower, Target: target}, func(ctx context.Context) error {
+			return nil
+		})
+		require.NoError(t, err)
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	list, err := jobs.List("cf-token", "account-1", 2)
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "third", list[0].Target)
+	assert.Equal(t, "second", list[1].Target)
+}
+
+func TestJobManager_SubscribeStreamsProgress(t *testing.T) {
+	jobs := services.NewJobManagerWithStore(newJobTestStore(t))
+
+	release := make(chan struct{})
+	started := jobs.Start("cf-token", "account-1", services.JobSpec{Type: services.JobTypeAppDeploy}, func(ctx context.Context) error {
+		<-release
+		require.NoError(t, services.StartJobStep(ctx, "Installing Helm release"))
+		output := services.JobOutput(ctx, "helm: ")
+		_, _ = output.Write([]byte("NAME: code\r\nSTATUS: dep"))
+		_, _ = output.Write([]byte("loyed\n\nwithout newline"))
+		require.NoError(t, output.Close())
+		services.JobPod(ctx, services.PodStatus{Name: "code-0", Ready: "1/1", Status: "Running", Restarts: "0"})
+		return errors.New("helm install failed")
+	})
+
+	_, events, unsubscribe, err := jobs.Subscribe("cf-token", "account-1", started.ID)
+	require.NoError(t, err)
+	defer unsubscribe()
+	require.NotNil(t, events)
+	close(release)
+
+	var logs []string
+	var steps []services.JobStatus
+	var pod *services.PodStatus
+	var final *services.Job
+	for event := range events {
+		switch event.Type {
+		case services.JobEventLog:
+			logs = append(logs, event.Message)
+		case services.JobEventStep:
+			steps = append(steps, event.Step.Status)
+		case services.JobEventPod:
+			pod = event.Pod
+		case services.JobEventStatus:
+			final = event.Job
+		}
+	}
+
+	assert.Equal(t, []string{"Installing Helm release", "helm: NAME: code", "helm: STATUS: deployed", "helm: without newline", "Pod code-0: Running, 1/1 ready"}, logs)
+	assert.Equal(t, []services.JobStatus{services.JobRunning, services.JobFailed}, steps)
+	require.NotNil(t, pod)
+	assert.Equal(t, "1/1", pod.Ready)
+	require.NotNil(t, final)
+	assert.Equal(t, services.JobFailed, final.Status)
+	assert.Equal(t, "helm install failed", final.Error)
+
+	// Finished jobs have nothing more to stream
+	job, events, _, err := jobs.Subscribe("cf-token", "account-1", started.ID)
+	require.NoError(t, err)
+	assert.Nil(t, events)
+	assert.Equal(t, services.JobFailed, job.Status)
+
+	_, _, _, err = jobs.Subscribe("cf-token", "account-2", started.ID)
+	assert.ErrorIs(t, err, services.ErrJobNotFound)
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// staticVersionSource lists a fixed set of releases
+type staticVersionSource []string
+
+func (s staticVersionSource) GetLatestVersion() (string, error)    { return s[0], nil }
+func (s staticVersionSource) GetVersionHistory() ([]string, error) { return s, nil }
+func (s staticVersionSource) GetSourceType() string                { return "static" }
+func (s staticVersionSource) GetSourceName() string                { return "k3s" }
+
+func TestCheckK3sUpgrade(t *testing.T) {
+	tests := []struct {
+		current, target string
+		ok              bool
+	}{
+		{"v1.30.4+k3s1", "v1.30.5+k3s1", true},
+		{"v1.30.4+k3s1", "v1.30.4+k3s2", true},
+		{"v1.30.4+k3s1", "v1.31.2+k3s1", true},
+		{"v1.30.4+k3s1", "1.31.0+k3s1", true},
+		{"v1.30.4+k3s1", "v1.32.0+k3s1", false},
+		{"v1.30.4+k3s1", "v1.30.4+k3s1", false},
+		{"v1.30.4+k3s1", "v1.30.3+k3s1", false},
+		{"v1.30.4+k3s1", "v1.29.9+k3s1", false},
+		{"v1.30.4+k3s1", "v2.30.4+k3s1", false},
+		{"v1.30.4+k3s1", "v1.31.0-rc1+k3s1", false},
+		{"v1.30.4+k3s1", "latest", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.current+" to "+tt.target, func(t *testing.T) {
+			err := services.CheckK3sUpgrade(tt.current, tt.target)
+			if tt.ok {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, services.ErrInvalidUpgradeRequest)
+			}
+		})
+	}
+}
+
+func TestParseK3sExecStart(t *testing.T) {
+	assert.Equal(t, []string{"server", "--write-kubeconfig-mode", "644"}, services.ParseK3sExecStart(
+		"{ path=/usr/local/bin/k3s ; argv[]=/usr/local/bin/k3s server --write-kubeconfig-mode 644 ; ignore_errors=no ; start_time=[n/a] ; pid=0 ; code=(null) ; status=0/0 }\n"))
+	assert.Equal(t, []string{"server"}, services.ParseK3sExecStart(
+		"{ path=/usr/local/bin/k3s ; argv[]=/usr/local/bin/k3s server ; ignore_errors=no }"))
+	assert.Equal(t, []string{"server"}, services.ParseK3sExecStart(""))
+}
+
+func TestK3sUpgradeService_Refusals(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+
+	upgrades := services.NewK3sUpgradeServiceWithStore(store, nil, staticVersionSource{"v1.31.2+k3s1", "v1.30.5+k3s1"})
+	ctx := context.Background()
+
+	_, err = upgrades.Upgrade(ctx, "cf-token", "account-1", 1, "v1.31")
+	assert.ErrorIs(t, err, services.ErrInvalidUpgradeRequest)
+
+	_, err = upgrades.Upgrade(ctx, "cf-token", "account-1", 1, "v1.31.2+k3s1")
+	assert.ErrorIs(t, err, services.ErrInvalidUpgradeRequest, "unknown server")
+
+	_, err = upgrades.Versions("cf-token", "account-1", 1)
+	assert.ErrorIs(t, err, services.ErrInvalidUpgradeRequest, "unknown server")
+}
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+func TestKeyRotationService_Rotate(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	keyring := utils.NewKeyring(store, "", utils.KEKSourceToken)
+	kv := services.NewKVServiceWithStore(store)
+
+	// A legacy Hetzner key, an enveloped app password and a plaintext OCI token
+	hetznerKey, err := utils.EncryptData("hetzner-key", "old-token")
+	require.NoError(t, err)
+	require.NoError(t, kv.PutValue("old-token", "account-1", "config:hetzner:api_key", hetznerKey))
+	appPassword, err := keyring.Encrypt("old-token", "account-1", "app-password")
+	require.NoError(t, err)
+	require.NoError(t, kv.PutValue("old-token", "account-1", "app:app-1:password", map[string]string{"password": appPassword}))
+	require.NoError(t, kv.PutValue("old-token", "account-1", "oci_token", "b2NpLXRva2Vu"))
+	require.NoError(t, kv.PutValue("old-token", "account-1", "app:app-1", map[string]string{"name": "not a secret"}))
+	_, err = services.NewBackupServiceWithStore(store, keyring).PutTarget("old-token", "account-1", services.BackupTargetRequest{
+		Name: "offsite", Endpoint: "https://s3.example.com", Bucket: "backups", AccessKey: "AKIA", SecretKey: "s3cret", Password: "repo password",
+	})
+	require.NoError(t, err)
+
+	result, err := services.NewKeyRotationServiceWithStore(store, keyring).Rotate("old-token", "new-token", "account-1", nil)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"config:hetzner:api_key", "oci_token", "app:app-1:password", "backup:target:offsite"}, result.Reencrypted)
+
+	restarted := utils.NewKeyring(store, "", utils.KEKSourceToken)
+	decrypt := func(value string) string {
+		t.Helper()
+		assert.True(t, utils.IsEnvelope(value))
+		plaintext, err := restarted.Decrypt("new-token", "account-1", value)
+		require.NoError(t, err)
+		return plaintext
+	}
+
+	var value string
+	require.NoError(t, kv.GetValue("new-token", "account-1", "config:hetzner:api_key", &value))
+	assert.Equal(t, "hetzner-key", decrypt(value))
+	require.NoError(t, kv.GetValue("new-token", "account-1", "oci_token", &value))
+	assert.Equal(t, "b2NpLXRva2Vu", decrypt(value))
+
+	var password map[string]string
+	require.NoError(t, kv.GetValue("new-token", "account-1", "app:app-1:password", &password))
+	assert.Equal(t, "app-password", decrypt(password["password"]))
+
+	var target map[string]string
+	require.NoError(t, kv.GetValue("new-token", "account-1", "backup:target:offsite", &target))
+	assert.Equal(t, "s3cret", decrypt(target["encrypted_secret_key"]))
+	assert.Equal(t, "repo password", decrypt(target["encrypted_password"]))
+}
+
+// failingKeyringStore fails to store the keyring wrapped for new-token
+type failingKeyringStore struct {
+	utils.StateStore
+}
+
+func (s failingKeyringStore) Put(token, accountID, key string, value []byte) error {
+	if token == "new-token" && key == "config:encryption:keyring" {
+		return errors.New("disk full")
+	}
+	return s.StateStore.Put(token, accountID, key, value)
+}
+
+func TestKeyRotationService_RotateRestoresTokenWhenRewrapFails(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	keyring := utils.NewKeyring(failingKeyringStore{store}, "", utils.KEKSourceToken)
+	kv := services.NewKVServiceWithStore(store)
+
+	appPassword, err := keyring.Encrypt("old-token", "account-1", "app-password")
+	require.NoError(t, err)
+	require.NoError(t, kv.PutValue("old-token", "account-1", "app:app-1:password", map[string]string{"password": appPassword}))
+
+	var stored []string
+	storeToken := func(token string) error {
+		stored = append(stored, token)
+		return nil
+	}
+	_, err = services.NewKeyRotationServiceWithStore(store, keyring).Rotate("old-token", "new-token", "account-1", storeToken)
+	require.Error(t, err)
+	assert.Equal(t, []string{"new-token", "old-token"}, stored)
+
+	// After a restart the keyring still unlocks with the restored token
+	var password map[string]string
+	require.NoError(t, kv.GetValue("old-token", "account-1", "app:app-1:password", &password))
+	plaintext, err := utils.NewKeyring(store, "", utils.KEKSourceToken).Decrypt("old-token", "account-1", password["password"])
+	require.NoError(t, err)
+	assert.Equal(t, "app-password", plaintext)
+}
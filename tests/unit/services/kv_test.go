@@ -13,6 +13,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
 )
 
 func TestKVService_NewKVService(t *testing.T) {
@@ -736,3 +737,48 @@ func createMockKVNamespace(id, title string) services.KVNamespace {
 		Title: title,
 	}
 }
+
+func TestKVService_WithLocalStore(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+
+	service := services.NewKVServiceWithStore(store)
+
+	t.Run("VPS configs round trip", func(t *testing.T) {
+		require.NoError(t, service.StoreVPSConfig("token", "account-1", createMockVPSConfig(1, "vps-one")))
+		require.NoError(t, service.StoreVPSConfig("token", "account-1", createMockVPSConfig(2, "vps-two")))
+
+		config, err := service.GetVPSConfig("token", "account-1", 1)
+		require.NoError(t, err)
+		assert.Equal(t, "vps-one", config.Name)
+
+		configs, err := service.ListVPSConfigs("token", "account-1")
+		require.NoError(t, err)
+		assert.Len(t, configs, 2)
+		assert.Equal(t, "vps-two", configs[2].Name)
+
+		require.NoError(t, service.UpdateVPSConfig("token", "account-1", 1, map[string]interface{}{"ssh_user": "ubuntu"}))
+		config, err = service.GetVPSConfig("token", "account-1", 1)
+		require.NoError(t, err)
+		assert.Equal(t, "ubuntu", config.SSHUser)
+
+		require.NoError(t, service.DeleteVPSConfig("token", "account-1", 2))
+		_, err = service.GetVPSConfig("token", "account-1", 2)
+		assert.Error(t, err)
+	})
+
+	t.Run("domain SSL configs round trip", func(t *testing.T) {
+		require.NoError(t, service.StoreDomainSSLConfig("token", "account-1", createMockDomainSSLConfig("example.com")))
+
+		configs, err := service.ListDomainSSLConfigs("token", "account-1")
+		require.NoError(t, err)
+		require.Contains(t, configs, "example.com")
+		assert.Equal(t, "cert-example.com", configs["example.com"].CertificateID)
+	})
+
+	t.Run("missing keys return an error", func(t *testing.T) {
+		var value map[string]interface{}
+		err := service.GetValue("token", "account-1", "does-not-exist", &value)
+		assert.ErrorIs(t, err, utils.ErrKeyNotFound)
+	})
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/services"
+)
+
+const nodeMetricsOutput = `cpu  1000 0 500 8000 500 0 0 0 0 0
+NET 10000 20000
+cpu  1100 0 600 8300 500 0 0 0 0 0
+NET 15000 20500
+MEM 4294967296 1073741824
+DISK 42949672960 10737418240
+CPUS 2
+`
+
+func TestParseNodeMetrics(t *testing.T) {
+	sample, err := services.ParseNodeMetrics(nodeMetricsOutput)
+	require.NoError(t, err)
+
+	// 200 of 500 jiffies busy
+	assert.InDelta(t, 40, sample.CPUPercent, 0.001)
+	assert.InDelta(t, 0.8, sample.CPUCores, 0.001)
+	assert.Equal(t, float64(1<<30), sample.MemoryBytes)
+	assert.Equal(t, float64(4<<30), sample.MemoryTotalBytes)
+	assert.Equal(t, float64(10<<30), sample.DiskBytes)
+	assert.Equal(t, float64(40<<30), sample.DiskTotalBytes)
+	assert.Equal(t, 5000.0, sample.NetRxBytesPerSec)
+	assert.Equal(t, 500.0, sample.NetTxBytesPerSec)
+
+	_, err = services.ParseNodeMetrics("bash: nproc: command not found")
+	assert.Error(t, err)
+}
+
+func TestParsePodMetrics(t *testing.T) {
+	top := `kube-system   coredns-6799fbcd5-x2k9p      3m     15Mi
+code-server   dev-code-server-7d9f-abcde   250m   512Mi
+argocd        ci-argocd-server-5c6-fghij   20m    128Mi
+`
+	releases := `code-server dev-code-server-7d9f-abcde dev-code-server
+argocd ci-argocd-server-5c6-fghij ci-argocd
+`
+	pods := services.ParsePodMetrics(top, releases)
+	require.Len(t, pods, 3)
+
+	assert.Equal(t, "dev-code-server-7d9f-abcde", pods[0].Name)
+	assert.Equal(t, "dev-code-server", pods[0].Release)
+	assert.InDelta(t, 0.25, pods[0].CPUCores, 0.001)
+	assert.InDelta(t, 512<<20, pods[0].MemoryBytes, 1)
+	assert.Equal(t, "coredns-6799fbcd5-x2k9p", pods[2].Name)
+	assert.Empty(t, pods[2].Release)
+
+	app := &models.Application{Subdomain: "ci", AppType: "argocd", Namespace: "argocd"}
+	usage := services.ApplicationUsage(app, append(pods, services.PodUsage{Namespace: "argocd", Name: "ci-argocd-repo-server-0", CPUCores: 0.01, MemoryBytes: 1 << 20}))
+	assert.InDelta(t, 0.03, usage.CPUCores, 0.001)
+	assert.InDelta(t, 129<<20, usage.MemoryBytes, 1)
+}
+
+func TestMetricsHistory_Downsampling(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := &services.MetricsHistory{}
+
+	// Four hours of a sample a minute, alternating between 1 and 3 cores
+	var now time.Time
+	for i := 0; i < 240; i++ {
+		now = start.Add(time.Duration(i) * time.Minute)
+		history.Add(services.MetricsPoint{Time: now, CPUCores: float64(1 + 2*(i%2))})
+	}
+
+	// Raw points are kept for three hours
+	assert.Len(t, history.Series["raw"], 181)
+	assert.Len(t, history.Series["5m"], 48)
+	assert.Len(t, history.Series["1h"], 4)
+
+	resolution, points := history.Range(time.Hour, now)
+	assert.Equal(t, "raw", resolution)
+	assert.Len(t, points, 61)
+
+	resolution, points = history.Range(6*time.Hour, now)
+	assert.Equal(t, "5m", resolution)
+	require.Len(t, points, 48)
+	assert.Equal(t, 5, points[0].Samples)
+	assert.InDelta(t, 1.8, points[0].CPUCores, 0.001)
+
+	resolution, points = history.Range(7*24*time.Hour, now)
+	assert.Equal(t, "1h", resolution)
+	require.Len(t, points, 4)
+	assert.Equal(t, 60, points[0].Samples)
+	assert.InDelta(t, 2, points[0].CPUCores, 0.001)
+}
@@ -0,0 +1,30 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/services"
+)
+
+func TestPortForwardManifests(t *testing.T) {
+	app := &models.Application{ID: "app-1", AppType: "code-server", Subdomain: "dev", Namespace: "code-server"}
+
+	service := services.PortForwardServiceYAML(app, "app-1-port-3000", 3000)
+	assert.Contains(t, service, "name: app-1-port-3000\n  namespace: code-server")
+	assert.Contains(t, service, "app.kubernetes.io/instance: dev-code-server")
+	assert.Contains(t, service, "targetPort: 3000")
+
+	// Adopted releases keep their own release name
+	app.ReleaseName = "legacy"
+	service = services.PortForwardServiceYAML(app, "app-1-port-3000", 3000)
+	assert.Contains(t, service, "app.kubernetes.io/instance: legacy")
+
+	ingress := services.PortForwardIngressYAML(app, "app-1-port-3000-ingress", "app-1-port-3000", "api", "example.com")
+	assert.Contains(t, ingress, "name: app-1-port-3000-ingress\n  namespace: code-server")
+	assert.Contains(t, ingress, "secretName: example.com-tls")
+	assert.Contains(t, ingress, "- host: api.example.com")
+	assert.Contains(t, ingress, "name: app-1-port-3000\n")
+}
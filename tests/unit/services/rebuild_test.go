@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+func TestRebuildService_Refusals(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	keyring := utils.NewKeyring(store, "", utils.KEKSourceToken)
+
+	services.RegisterCloudProvider("Rebuild Cloud", func(token, accountID string) (services.CloudProvider, error) {
+		return &namedProvider{name: "Rebuild Cloud"}, nil
+	})
+
+	kv := services.NewKVServiceWithStore(store)
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:1:config", services.VPSConfig{ServerID: 1, Name: "alive", Provider: "Rebuild Cloud", PublicIPv4: "10.0.0.1"}))
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:2:config", services.VPSConfig{ServerID: 2, Name: "byo", Provider: services.ProviderManual, PublicIPv4: "10.0.0.2"}))
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:4:config", services.VPSConfig{ServerID: 4, Name: "worker", Provider: "Rebuild Cloud", ClusterServerID: 1}))
+
+	rebuild := services.NewRebuildServiceWithStore(store, keyring, nil)
+
+	t.Run("refuses servers the provider still has", func(t *testing.T) {
+		_, err := rebuild.Rebuild(context.Background(), "cf-token", "account-1", services.RebuildRequest{ServerID: 1})
+		assert.ErrorIs(t, err, services.ErrServerStillExists)
+
+		// The configuration is left alone
+		config, err := kv.GetVPSConfig("cf-token", "account-1", 1)
+		require.NoError(t, err)
+		assert.Equal(t, "alive", config.Name)
+	})
+
+	t.Run("refuses servers added over SSH", func(t *testing.T) {
+		_, err := rebuild.Rebuild(context.Background(), "cf-token", "account-1", services.RebuildRequest{ServerID: 2, Replace: true})
+		assert.ErrorIs(t, err, services.ErrRebuildUnsupported)
+	})
+
+	t.Run("refuses agent nodes", func(t *testing.T) {
+		_, err := rebuild.Rebuild(context.Background(), "cf-token", "account-1", services.RebuildRequest{ServerID: 4, Replace: true})
+		assert.ErrorIs(t, err, services.ErrRebuildUnsupported)
+	})
+
+	t.Run("fails for unknown servers", func(t *testing.T) {
+		_, err := rebuild.Rebuild(context.Background(), "cf-token", "account-1", services.RebuildRequest{ServerID: 3})
+		assert.Error(t, err)
+	})
+}
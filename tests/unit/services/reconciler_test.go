@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// vanishingProvider is a fake provider on which only server 1 still exists
+type vanishingProvider struct {
+	fakeProvider
+}
+
+func (p *vanishingProvider) ServerExists(ctx context.Context, config *services.VPSConfig) (bool, error) {
+	return config.ServerID == 1, nil
+}
+
+func TestReconciler_DetectsAndHealsDrift(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	previous := utils.GetStateStore()
+	utils.SetStateStore(store)
+	t.Cleanup(func() { utils.SetStateStore(previous) })
+
+	services.RegisterCloudProvider("Vanishing Cloud", func(token, accountID string) (services.CloudProvider, error) {
+		return &vanishingProvider{}, nil
+	})
+
+	// Generate the SSH key before the servers exist, so it isn't the legacy CSR key
+	keyring := utils.NewKeyring(store, "", utils.KEKSourceToken)
+	_, err = services.NewSSHKeyServiceWithStore(store, keyring).KeyPair("cf-token", "account-1")
+	require.NoError(t, err)
+
+	kv := services.NewKVServiceWithStore(store)
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:1:config", services.VPSConfig{ServerID: 1, Name: "alive", Provider: "Vanishing Cloud", PublicIPv4: "127.0.0.1", SSHPort: 1, SSHUser: "root"}))
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:2:config", services.VPSConfig{ServerID: 2, Name: "deleted", Provider: "Vanishing Cloud", PublicIPv4: "127.0.0.2", SSHUser: "root"}))
+
+	reconciler := services.NewReconcilerWithStore(store, keyring, time.Hour, false)
+
+	_, err = reconciler.LastReport("cf-token", "account-1")
+	assert.ErrorIs(t, err, services.ErrNoReconcileReport)
+
+	report, err := reconciler.Run(context.Background(), "cf-token", "account-1", false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Servers)
+	assert.Empty(t, report.Errors)
+	require.Len(t, report.Drift, 2)
+
+	assert.Equal(t, services.DriftServerMissing, report.Drift[0].Kind)
+	assert.Equal(t, "vps/2", report.Drift[0].Resource)
+	assert.True(t, report.Drift[0].Healable)
+	assert.False(t, report.Drift[0].Healed)
+
+	// The surviving server can't be reached, which is reported but not healed
+	assert.Equal(t, services.DriftServerUnreachable, report.Drift[1].Kind)
+	assert.Equal(t, "vps/1", report.Drift[1].Resource)
+	assert.False(t, report.Drift[1].Healable)
+
+	// Nothing changes without healing
+	_, err = kv.GetVPSConfig("cf-token", "account-1", 2)
+	require.NoError(t, err)
+
+	report, err = reconciler.Run(context.Background(), "cf-token", "account-1", true)
+	require.NoError(t, err)
+	require.Len(t, report.Drift, 2)
+	assert.True(t, report.Drift[0].Healed)
+	assert.Empty(t, report.Drift[0].HealError)
+
+	_, err = kv.GetVPSConfig("cf-token", "account-1", 2)
+	assert.Error(t, err)
+	_, err = kv.GetVPSConfig("cf-token", "account-1", 1)
+	assert.NoError(t, err)
+
+	last, err := reconciler.LastReport("cf-token", "account-1")
+	require.NoError(t, err)
+	assert.True(t, last.Heal)
+	assert.True(t, last.Drift[0].Healed)
+}
+
+func TestApplicationStatusFromHelm(t *testing.T) {
+	assert.Equal(t, "Running", services.ApplicationStatusFromHelm("deployed"))
+	assert.Equal(t, "Failed", services.ApplicationStatusFromHelm("failed"))
+	assert.Equal(t, "Deploying", services.ApplicationStatusFromHelm("pending-install"))
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+func newSSHKeyTestStore(t *testing.T) (utils.StateStore, *utils.Keyring) {
+	t.Helper()
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	return store, utils.NewKeyring(store, "", utils.KEKSourceToken)
+}
+
+func TestSSHKeyService_GeneratesDedicatedKey(t *testing.T) {
+	store, keyring := newSSHKeyTestStore(t)
+	keys := services.NewSSHKeyServiceWithStore(store, keyring)
+
+	pair, err := keys.KeyPair("cf-token", "account-1")
+	require.NoError(t, err)
+	assert.False(t, pair.Legacy)
+	assert.True(t, strings.HasPrefix(pair.PublicKey, "ssh-ed25519 "))
+
+	signer, err := ssh.ParsePrivateKey([]byte(pair.PrivateKey))
+	require.NoError(t, err)
+	assert.Equal(t, ssh.FingerprintSHA256(signer.PublicKey()), pair.Fingerprint)
+
+	// The key is stored once, with the private half encrypted
+	again, err := keys.KeyPair("cf-token", "account-1")
+	require.NoError(t, err)
+	assert.Equal(t, pair.Fingerprint, again.Fingerprint)
+
+	var stored map[string]string
+	require.NoError(t, services.NewKVServiceWithStore(store).GetValue("cf-token", "account-1", "config:ssh:keypair", &stored))
+	assert.True(t, utils.IsEnvelope(stored["encrypted_private_key"]))
+	assert.NotContains(t, stored["encrypted_private_key"], "PRIVATE KEY")
+
+	// Rotating the data-encryption key keeps the SSH key readable
+	_, err = services.NewKeyRotationServiceWithStore(store, keyring).Rotate("cf-token", "new-token", "account-1", nil)
+	require.NoError(t, err)
+	rotated, err := keys.KeyPair("new-token", "account-1")
+	require.NoError(t, err)
+	assert.Equal(t, pair.PrivateKey, rotated.PrivateKey)
+}
+
+func TestSSHKeyService_LegacyKeyUntilRotated(t *testing.T) {
+	store, keyring := newSSHKeyTestStore(t)
+	kv := services.NewKVServiceWithStore(store)
+	keys := services.NewSSHKeyServiceWithStore(store, keyring)
+
+	csr, err := services.NewCloudflareService().GenerateCSR()
+	require.NoError(t, err)
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "config:ssl:csr", csr))
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:7:config", services.VPSConfig{ServerID: 7, Name: "old-server"}))
+
+	// Servers created before dedicated keys still trust the CSR key
+	legacy, err := keys.KeyPair("cf-token", "account-1")
+	require.NoError(t, err)
+	assert.True(t, legacy.Legacy)
+	assert.Equal(t, csr.PrivateKey, legacy.PrivateKey)
+
+	csrPublicKey, err := services.NewCloudflareService().ConvertPrivateKeyToSSH(csr.PrivateKey)
+	require.NoError(t, err)
+	assert.Equal(t, csrPublicKey, legacy.PublicKey)
+
+	// Without reachable servers the rotation fails and nothing changes
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:7:config", services.VPSConfig{ServerID: 7, Name: "old-server", PublicIPv4: "127.0.0.1", SSHPort: 1, SSHUser: "root"}))
+	_, err = keys.RotateKey(context.Background(), "cf-token", "account-1")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "old-server")
+	unchanged, err := keys.KeyPair("cf-token", "account-1")
+	require.NoError(t, err)
+	assert.True(t, unchanged.Legacy)
+
+	// Once the servers are gone the CSR key is no longer used for SSH
+	require.NoError(t, kv.DeleteValue("cf-token", "account-1", "vps:7:config"))
+	dedicated, err := keys.KeyPair("cf-token", "account-1")
+	require.NoError(t, err)
+	assert.False(t, dedicated.Legacy)
+	assert.NotEqual(t, legacy.Fingerprint, dedicated.Fingerprint)
+
+	result, err := keys.RotateKey(context.Background(), "cf-token", "account-1")
+	require.NoError(t, err)
+	assert.Equal(t, dedicated.Fingerprint, result.OldFingerprint)
+	assert.Empty(t, result.Servers)
+
+	current, err := keys.KeyPair("cf-token", "account-1")
+	require.NoError(t, err)
+	assert.Equal(t, result.Fingerprint, current.Fingerprint)
+	assert.NotEqual(t, dedicated.Fingerprint, current.Fingerprint)
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/models"
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+// stackCatalog is an application catalog with code-server only
+type stackCatalog struct{}
+
+func (stackCatalog) GetApplications() []models.PredefinedApplication { return nil }
+func (stackCatalog) GetCategories() []string                         { return nil }
+func (stackCatalog) RefreshCatalog() error                           { return nil }
+func (stackCatalog) GetApplicationByID(id string) (*models.PredefinedApplication, bool) {
+	if id != "code-server" {
+		return nil, false
+	}
+	return &models.PredefinedApplication{ID: id, Version: "4.1.0"}, true
+}
+
+const testStack = `
+name: production
+servers:
+  - name: web-1
+    location: nbg1
+    type: cpx21
+  - name: web-2
+    location: fsn1
+    type: cpx31
+domains:
+  - domain: example.com
+applications:
+  - type: code-server
+    subdomain: code
+    domain: example.com
+    server: web-1
+    version: 4.2.0
+    values:
+      resources:
+        limits:
+          memory: 2Gi
+  - type: code-server
+    subdomain: dev
+    domain: example.com
+    server: web-2
+`
+
+func TestParseStack(t *testing.T) {
+	stack, err := services.ParseStack([]byte(testStack))
+	require.NoError(t, err)
+	assert.Equal(t, "production", stack.Name)
+	require.Len(t, stack.Applications, 2)
+	assert.Equal(t, "code.example.com", stack.Applications[0].Host())
+
+	_, err = services.ParseStack([]byte("name: x\nservers:\n  - name: a\n    location: nbg1\n    type: cpx21\n    size: big\n"))
+	assert.Error(t, err, "unknown fields are rejected")
+
+	_, err = services.ParseStack([]byte("name: x\ndomains:\n  - domain: example.com\napplications:\n  - type: code-server\n    subdomain: a\n    domain: example.com\n    server: missing\n"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "server missing is not part of the stack")
+}
+
+func TestStackService_Plan(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	kv := services.NewKVServiceWithStore(store)
+
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:1:config", services.VPSConfig{ServerID: 1, Name: "web-1", Provider: services.ProviderHetzner, Location: "nbg1", ServerType: "cpx21"}))
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "vps:3:config", services.VPSConfig{ServerID: 3, Name: "old", Provider: services.ProviderHetzner, Location: "nbg1", ServerType: "cpx11"}))
+	require.NoError(t, kv.StoreDomainSSLConfig("cf-token", "account-1", &services.DomainSSLConfig{Domain: "example.com", ZoneID: "zone"}))
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "app:app-1", models.Application{ID: "app-1", AppType: "code-server", AppVersion: "4.1.0", Subdomain: "code", Domain: "example.com", VPSID: "1", VPSName: "web-1"}))
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "app:app-2", models.Application{ID: "app-2", AppType: "code-server", AppVersion: "4.1.0", Subdomain: "legacy", Domain: "example.com", VPSID: "3", VPSName: "old"}))
+
+	stack, err := services.ParseStack([]byte(testStack))
+	require.NoError(t, err)
+	stacks := services.NewStackServiceWithStore(store, stackCatalog{})
+
+	type change struct{ action, kind, name string }
+	summarize := func(plan *services.StackPlan) []change {
+		var changes []change
+		for _, c := range plan.Changes {
+			changes = append(changes, change{c.Action, c.Kind, c.Name})
+		}
+		return changes
+	}
+
+	plan, err := stacks.Plan("cf-token", "account-1", stack, false)
+	require.NoError(t, err)
+	assert.False(t, plan.Blocked())
+	assert.Equal(t, []change{
+		{services.StackActionCreate, services.StackKindServer, "web-2"},
+		{services.StackActionUpdate, services.StackKindApplication, "code.example.com"},
+		{services.StackActionCreate, services.StackKindApplication, "dev.example.com"},
+	}, summarize(plan))
+	assert.Equal(t, []string{"version 4.1.0 → 4.2.0", "values changed"}, plan.Changes[1].Details)
+
+	// Pruning deletes what the stack doesn't mention, applications first
+	plan, err = stacks.Plan("cf-token", "account-1", stack, true)
+	require.NoError(t, err)
+	assert.Equal(t, []change{
+		{services.StackActionCreate, services.StackKindServer, "web-2"},
+		{services.StackActionUpdate, services.StackKindApplication, "code.example.com"},
+		{services.StackActionCreate, services.StackKindApplication, "dev.example.com"},
+		{services.StackActionDelete, services.StackKindApplication, "legacy.example.com"},
+		{services.StackActionDelete, services.StackKindServer, "old"},
+	}, summarize(plan))
+
+	// Stored values in another layout compare equal
+	require.NoError(t, kv.PutValue("cf-token", "account-1", "app:app-1", models.Application{ID: "app-1", AppType: "code-server", AppVersion: "4.2.0", Subdomain: "code", Domain: "example.com", VPSID: "1", VPSName: "web-1", Values: "resources: {limits: {memory: 2Gi}}"}))
+	plan, err = stacks.Plan("cf-token", "account-1", stack, false)
+	require.NoError(t, err)
+	assert.Len(t, plan.Changes, 2)
+
+	// Servers are never replaced in place
+	stack.Servers[0].Type = "cpx41"
+	plan, err = stacks.Plan("cf-token", "account-1", stack, false)
+	require.NoError(t, err)
+	assert.True(t, plan.Blocked())
+	assert.Equal(t, services.StackActionBlocked, plan.Changes[0].Action)
+	assert.Contains(t, plan.Changes[0].Details, "type cpx21 → cpx41")
+}
@@ -0,0 +1,239 @@
+package services
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+func newTestUserService(t *testing.T) *services.UserService {
+	t.Helper()
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	return services.NewUserServiceWithStore(store, "instance-secret")
+}
+
+func TestUserService_Setup(t *testing.T) {
+	users := newTestUserService(t)
+	assert.False(t, users.IsSetUp())
+
+	_, _, err := users.InstanceCredentials()
+	assert.ErrorIs(t, err, services.ErrInstanceNotSetUp)
+
+	admin, err := users.Setup("cf-token", "account-1", "Alice", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", admin.Username)
+	assert.Equal(t, services.RoleAdmin, admin.Role)
+	assert.NotContains(t, admin.PasswordHash, "correct horse")
+	assert.True(t, users.IsSetUp())
+
+	_, err = users.Setup("other-token", "account-2", "bob", "correct horse")
+	assert.ErrorIs(t, err, services.ErrInstanceAlreadySetUp)
+
+	t.Run("credentials survive a restart", func(t *testing.T) {
+		store, err := utils.NewLocalStateStore(t.TempDir())
+		require.NoError(t, err)
+		first := services.NewUserServiceWithStore(store, "instance-secret")
+		_, err = first.Setup("cf-token", "account-1", "alice", "correct horse")
+		require.NoError(t, err)
+
+		token, accountID, err := services.NewUserServiceWithStore(store, "instance-secret").InstanceCredentials()
+		require.NoError(t, err)
+		assert.Equal(t, "cf-token", token)
+		assert.Equal(t, "account-1", accountID)
+
+		_, _, err = services.NewUserServiceWithStore(store, "wrong-secret").InstanceCredentials()
+		assert.Error(t, err)
+	})
+}
+
+// failingCredentialsStore fails to store the instance credentials
+type failingCredentialsStore struct {
+	utils.StateStore
+}
+
+func (s failingCredentialsStore) Put(token, accountID, key string, value []byte) error {
+	if key == "instance:cloudflare" {
+		return errors.New("disk full")
+	}
+	return s.StateStore.Put(token, accountID, key, value)
+}
+
+func TestUserService_SetupIsAtomic(t *testing.T) {
+	t.Run("concurrent setups create one admin", func(t *testing.T) {
+		users := newTestUserService(t)
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		succeeded := 0
+		for _, name := range []string{"alice", "bob", "carol", "dave"} {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := users.Setup("cf-token", "account-1", name, "correct horse"); err == nil {
+					mu.Lock()
+					succeeded++
+					mu.Unlock()
+				} else {
+					assert.ErrorIs(t, err, services.ErrInstanceAlreadySetUp)
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, succeeded)
+		list, err := users.ListUsers()
+		require.NoError(t, err)
+		assert.Len(t, list, 1)
+	})
+
+	t.Run("a failed setup can be retried", func(t *testing.T) {
+		store, err := utils.NewLocalStateStore(t.TempDir())
+		require.NoError(t, err)
+
+		_, err = services.NewUserServiceWithStore(failingCredentialsStore{store}, "instance-secret").Setup("cf-token", "account-1", "alice", "correct horse")
+		require.Error(t, err)
+
+		users := services.NewUserServiceWithStore(store, "instance-secret")
+		assert.False(t, users.IsSetUp())
+		_, err = users.Setup("cf-token", "account-1", "alice", "correct horse")
+		require.NoError(t, err)
+	})
+}
+
+func TestUserService_Authenticate(t *testing.T) {
+	users := newTestUserService(t)
+	_, err := users.CreateUser("bob", "hunter2hunter2", services.RoleOperator)
+	require.NoError(t, err)
+
+	user, err := users.Authenticate("BOB", "hunter2hunter2")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", user.Username)
+	assert.NotNil(t, user.LastLoginAt)
+
+	_, err = users.Authenticate("bob", "wrong password")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+
+	_, err = users.Authenticate("nobody", "hunter2hunter2")
+	assert.ErrorIs(t, err, services.ErrInvalidCredentials)
+}
+
+func TestUserService_CreateUserValidation(t *testing.T) {
+	users := newTestUserService(t)
+
+	_, err := users.CreateUser("carol", "short", services.RoleViewer)
+	assert.ErrorIs(t, err, services.ErrInvalidUser)
+
+	_, err = users.CreateUser("carol", "long enough", "superuser")
+	assert.ErrorIs(t, err, services.ErrInvalidUser)
+
+	_, err = users.CreateUser("not a name", "long enough", services.RoleViewer)
+	assert.ErrorIs(t, err, services.ErrInvalidUser)
+
+	_, err = users.CreateUser("carol", "long enough", services.RoleViewer)
+	require.NoError(t, err)
+	_, err = users.CreateUser("Carol", "long enough", services.RoleViewer)
+	assert.ErrorIs(t, err, services.ErrUserExists)
+}
+
+func TestUserService_Sessions(t *testing.T) {
+	users := newTestUserService(t)
+	_, err := users.CreateUser("dave", "long enough", services.RoleViewer)
+	require.NoError(t, err)
+
+	sessionID, session, err := users.CreateSession("dave")
+	require.NoError(t, err)
+	assert.Equal(t, services.SessionTTL, session.ExpiresAt.Sub(session.CreatedAt))
+
+	user, _, err := users.ResolveSession(sessionID)
+	require.NoError(t, err)
+	assert.Equal(t, "dave", user.Username)
+
+	_, _, err = users.ResolveSession("not-a-session")
+	assert.ErrorIs(t, err, services.ErrSessionInvalid)
+
+	t.Run("password change ends sessions", func(t *testing.T) {
+		require.NoError(t, users.SetPassword("dave", "another password"))
+		_, _, err := users.ResolveSession(sessionID)
+		assert.ErrorIs(t, err, services.ErrSessionInvalid)
+	})
+
+	t.Run("logout ends the session", func(t *testing.T) {
+		sessionID, _, err := users.CreateSession("dave")
+		require.NoError(t, err)
+		require.NoError(t, users.DeleteSession(sessionID))
+		_, _, err = users.ResolveSession(sessionID)
+		assert.ErrorIs(t, err, services.ErrSessionInvalid)
+	})
+
+	t.Run("deleting the user ends sessions", func(t *testing.T) {
+		sessionID, _, err := users.CreateSession("dave")
+		require.NoError(t, err)
+		require.NoError(t, users.DeleteUser("dave"))
+		_, _, err = users.ResolveSession(sessionID)
+		assert.ErrorIs(t, err, services.ErrSessionInvalid)
+	})
+}
+
+func TestUserService_LastAdmin(t *testing.T) {
+	users := newTestUserService(t)
+	_, err := users.Setup("cf-token", "account-1", "alice", "long enough")
+	require.NoError(t, err)
+
+	_, err = users.SetRole("alice", services.RoleViewer)
+	assert.ErrorIs(t, err, services.ErrLastAdmin)
+	assert.ErrorIs(t, users.DeleteUser("alice"), services.ErrLastAdmin)
+
+	_, err = users.CreateUser("erin", "long enough", services.RoleAdmin)
+	require.NoError(t, err)
+
+	user, err := users.SetRole("alice", services.RoleOperator)
+	require.NoError(t, err)
+	assert.Equal(t, services.RoleOperator, user.Role)
+
+	assert.ErrorIs(t, users.DeleteUser("erin"), services.ErrLastAdmin)
+
+	list, err := users.ListUsers()
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, "alice", list[0].Username)
+	assert.Equal(t, "erin", list[1].Username)
+}
+
+func TestRoleScopes(t *testing.T) {
+	admin := services.RoleScopes(services.RoleAdmin)
+	operator := services.RoleScopes(services.RoleOperator)
+	viewer := services.RoleScopes(services.RoleViewer)
+
+	assert.True(t, services.HasScope(admin, services.ScopeUsersManage))
+
+	assert.True(t, services.HasScope(operator, services.ScopeVPSWrite))
+	assert.True(t, services.HasScope(operator, services.ScopeAppsWrite))
+	assert.False(t, services.HasScope(operator, services.ScopeUsersManage))
+	assert.False(t, services.HasScope(operator, services.ScopeTokensManage))
+
+	assert.True(t, services.HasScope(viewer, services.ScopeVPSRead))
+	assert.False(t, services.HasScope(viewer, services.ScopeVPSWrite))
+	assert.False(t, services.HasScope(viewer, services.ScopeAppsWrite))
+	assert.True(t, services.HasScope(viewer, services.ScopeJobsRead))
+	assert.False(t, services.HasScope(viewer, services.ScopeJobsWrite))
+	assert.True(t, services.HasScope(operator, services.ScopeReconcileWrite))
+	assert.True(t, services.HasScope(viewer, services.ScopeReconcileRead))
+	assert.False(t, services.HasScope(viewer, services.ScopeReconcileWrite))
+	assert.True(t, services.HasScope(operator, services.ScopeStacksWrite))
+	assert.False(t, services.HasScope(viewer, services.ScopeStacksWrite))
+	assert.True(t, services.HasScope(operator, services.ScopeAdoptWrite))
+	assert.True(t, services.HasScope(operator, services.ScopeBackupsWrite))
+	assert.True(t, services.HasScope(viewer, services.ScopeBackupsRead))
+	assert.False(t, services.HasScope(viewer, services.ScopeBackupsWrite))
+	assert.True(t, services.HasScope(viewer, services.ScopeAdoptRead))
+	assert.False(t, services.HasScope(viewer, services.ScopeAdoptWrite))
+
+	assert.Empty(t, services.RoleScopes("superuser"))
+}
@@ -0,0 +1,303 @@
+package services
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/services"
+)
+
+// releaseServer serves a fake GitHub release containing a linux/amd64 archive
+type releaseServer struct {
+	*httptest.Server
+	archive   []byte
+	checksums string
+	signature string
+}
+
+func newReleaseServer(t *testing.T, binary []byte) *releaseServer {
+	rs := &releaseServer{archive: buildTarGz(t, "xanthus-linux-amd64", binary)}
+	sum := sha256.Sum256(rs.archive)
+	rs.checksums = fmt.Sprintf("%s  xanthus-linux-amd64.tar.gz\n", hex.EncodeToString(sum[:]))
+
+	rs.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/chrishham/xanthus/releases/tags/v2.0.0":
+			assets := []map[string]string{
+				{"name": "xanthus-linux-amd64.tar.gz", "browser_download_url": rs.URL + "/download/xanthus-linux-amd64.tar.gz"},
+				{"name": "checksums.txt", "browser_download_url": rs.URL + "/download/checksums.txt"},
+			}
+			if rs.signature != "" {
+				assets = append(assets, map[string]string{"name": "checksums.txt.sig", "browser_download_url": rs.URL + "/download/checksums.txt.sig"})
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"tag_name": "v2.0.0", "assets": assets})
+		case "/download/xanthus-linux-amd64.tar.gz":
+			w.Write(rs.archive)
+		case "/download/checksums.txt":
+			w.Write([]byte(rs.checksums))
+		case "/download/checksums.txt.sig":
+			w.Write([]byte(rs.signature))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(rs.Close)
+	return rs
+}
+
+func buildTarGz(t *testing.T, name string, content []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+	_, err := tw.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return buf.Bytes()
+}
+
+func waitForUpdate(t *testing.T, service *services.SelfUpdateService) *services.UpdateStatus {
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if status := service.GetUpdateStatus(); !status.InProgress && status.Status != "starting" && status.Status != "rolling_back" {
+			return status
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("update did not finish in time")
+	return nil
+}
+
+func TestSelfUpdateService_Update(t *testing.T) {
+	t.Setenv("XANTHUS_VERSION", "")
+
+	newOptions := func(rs *releaseServer, exe string, restarted *string, publicKey string) services.SelfUpdateOptions {
+		return services.SelfUpdateOptions{
+			HTTPClient:     rs.Client(),
+			APIBaseURL:     rs.URL,
+			ExecutablePath: exe,
+			PublicKey:      publicKey,
+			GOOS:           "linux",
+			GOARCH:         "amd64",
+			Restart: func(executablePath string, env []string) error {
+				*restarted = executablePath
+				return nil
+			},
+		}
+	}
+
+	writeExecutable := func(t *testing.T) string {
+		exe := filepath.Join(t.TempDir(), "xanthus")
+		require.NoError(t, os.WriteFile(exe, []byte("old binary"), 0755))
+		return exe
+	}
+
+	t.Run("swaps binary and restarts", func(t *testing.T) {
+		rs := newReleaseServer(t, []byte("new binary"))
+		exe := writeExecutable(t)
+		restarted := ""
+
+		service := services.NewSelfUpdateServiceWithOptions(newOptions(rs, exe, &restarted, ""))
+		currentVersion := service.GetCurrentVersion()
+		service.StartUpdate("token", "account", "v2.0.0", "")
+		status := waitForUpdate(t, service)
+
+		assert.Equal(t, "completed", status.Status, status.Error)
+		assert.Equal(t, exe, restarted)
+
+		data, err := os.ReadFile(exe)
+		require.NoError(t, err)
+		assert.Equal(t, "new binary", string(data))
+
+		previous, err := os.ReadFile(exe + ".previous")
+		require.NoError(t, err)
+		assert.Equal(t, "old binary", string(previous))
+
+		_, err = os.Stat(exe + ".new")
+		assert.True(t, os.IsNotExist(err))
+
+		// A fresh instance (as after the re-exec) picks up the persisted outcome
+		reloaded := services.NewSelfUpdateServiceWithOptions(newOptions(rs, exe, &restarted, ""))
+		assert.Equal(t, "v2.0.0", reloaded.GetCurrentVersion())
+		assert.Equal(t, currentVersion, reloaded.GetPreviousVersion())
+		assert.Equal(t, "completed", reloaded.GetUpdateStatus().Status)
+		assert.True(t, reloaded.CanRollback())
+	})
+
+	t.Run("replaces XANTHUS_VERSION for the restarted process", func(t *testing.T) {
+		t.Setenv("XANTHUS_VERSION", "1.0.0")
+		rs := newReleaseServer(t, []byte("new binary"))
+		exe := writeExecutable(t)
+
+		var restartEnv []string
+		options := newOptions(rs, exe, new(string), "")
+		options.Restart = func(executablePath string, env []string) error {
+			restartEnv = env
+			return nil
+		}
+		service := services.NewSelfUpdateServiceWithOptions(options)
+		service.StartUpdate("token", "account", "v2.0.0", "")
+		require.Equal(t, "completed", waitForUpdate(t, service).Status)
+
+		var versions []string
+		for _, entry := range restartEnv {
+			if value, ok := strings.CutPrefix(entry, "XANTHUS_VERSION="); ok {
+				versions = append(versions, value)
+			}
+		}
+		assert.Equal(t, []string{"2.0.0"}, versions)
+
+		// A later restart with the old variable still reports the installed version
+		reloaded := services.NewSelfUpdateServiceWithOptions(options)
+		assert.Equal(t, "v2.0.0", reloaded.GetCurrentVersion())
+	})
+
+	t.Run("restores the previous binary when the restart fails", func(t *testing.T) {
+		rs := newReleaseServer(t, []byte("new binary"))
+		exe := writeExecutable(t)
+
+		options := newOptions(rs, exe, new(string), "")
+		options.Restart = func(executablePath string, env []string) error {
+			return errors.New("exec format error")
+		}
+		service := services.NewSelfUpdateServiceWithOptions(options)
+		currentVersion := service.GetCurrentVersion()
+		service.StartUpdate("token", "account", "v2.0.0", "")
+		status := waitForUpdate(t, service)
+		assert.Equal(t, "failed", status.Status)
+		assert.Contains(t, status.Error, "exec format error")
+
+		data, err := os.ReadFile(exe)
+		require.NoError(t, err)
+		assert.Equal(t, "old binary", string(data))
+
+		reloaded := services.NewSelfUpdateServiceWithOptions(options)
+		assert.Equal(t, currentVersion, reloaded.GetCurrentVersion())
+		assert.False(t, reloaded.CanRollback())
+	})
+
+	t.Run("fails the job when the restart fails", func(t *testing.T) {
+		rs := newReleaseServer(t, []byte("new binary"))
+		exe := writeExecutable(t)
+
+		options := newOptions(rs, exe, new(string), "")
+		options.Restart = func(executablePath string, env []string) error {
+			return errors.New("exec format error")
+		}
+		service := services.NewSelfUpdateServiceWithOptions(options)
+		jobs := services.NewJobManagerWithStore(newJobTestStore(t))
+		job, err := service.StartUpdateJob(jobs, "cf-token", "account-1", "v2.0.0")
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			job, err = jobs.Get("cf-token", "account-1", job.ID)
+			require.NoError(t, err)
+			return job.Status == services.JobFailed
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Contains(t, job.Error, "exec format error")
+	})
+
+	t.Run("discards the state of a binary replaced outside the updater", func(t *testing.T) {
+		rs := newReleaseServer(t, []byte("new binary"))
+		exe := writeExecutable(t)
+
+		options := newOptions(rs, exe, new(string), "")
+		service := services.NewSelfUpdateServiceWithOptions(options)
+		service.StartUpdate("token", "account", "v2.0.0", "")
+		require.Equal(t, "completed", waitForUpdate(t, service).Status)
+
+		t.Setenv("XANTHUS_VERSION", "3.0.0")
+		require.NoError(t, os.WriteFile(exe, []byte("package manager binary"), 0755))
+
+		reloaded := services.NewSelfUpdateServiceWithOptions(options)
+		assert.Equal(t, "3.0.0", reloaded.GetCurrentVersion())
+		assert.Equal(t, "ready", reloaded.GetUpdateStatus().Status)
+		_, err := os.Stat(exe + ".update.json")
+		assert.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("rejects checksum mismatch", func(t *testing.T) {
+		rs := newReleaseServer(t, []byte("new binary"))
+		rs.checksums = "0000000000000000000000000000000000000000000000000000000000000000  xanthus-linux-amd64.tar.gz\n"
+		exe := writeExecutable(t)
+		restarted := ""
+
+		service := services.NewSelfUpdateServiceWithOptions(newOptions(rs, exe, &restarted, ""))
+		service.StartUpdate("token", "account", "v2.0.0", "")
+		status := waitForUpdate(t, service)
+
+		assert.Equal(t, "failed", status.Status)
+		assert.Contains(t, status.Error, "checksum mismatch")
+		assert.Empty(t, restarted)
+
+		data, err := os.ReadFile(exe)
+		require.NoError(t, err)
+		assert.Equal(t, "old binary", string(data))
+	})
+
+	t.Run("verifies signature when public key is configured", func(t *testing.T) {
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+		encodedKey := base64.StdEncoding.EncodeToString(publicKey)
+
+		rs := newReleaseServer(t, []byte("new binary"))
+		exe := writeExecutable(t)
+		restarted := ""
+
+		// Unsigned release is refused
+		service := services.NewSelfUpdateServiceWithOptions(newOptions(rs, exe, &restarted, encodedKey))
+		service.StartUpdate("token", "account", "v2.0.0", "")
+		status := waitForUpdate(t, service)
+		assert.Equal(t, "failed", status.Status)
+		assert.Contains(t, status.Error, "not signed")
+
+		// Signed release is accepted
+		rs.signature = base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(rs.checksums)))
+		service = services.NewSelfUpdateServiceWithOptions(newOptions(rs, exe, &restarted, encodedKey))
+		service.StartUpdate("token", "account", "v2.0.0", "")
+		status = waitForUpdate(t, service)
+		assert.Equal(t, "completed", status.Status, status.Error)
+	})
+
+	t.Run("rolls back to previous binary", func(t *testing.T) {
+		rs := newReleaseServer(t, []byte("new binary"))
+		exe := writeExecutable(t)
+		restarted := ""
+
+		service := services.NewSelfUpdateServiceWithOptions(newOptions(rs, exe, &restarted, ""))
+		previousVersion := service.GetCurrentVersion()
+		service.StartUpdate("token", "account", "v2.0.0", "")
+		require.Equal(t, "completed", waitForUpdate(t, service).Status)
+
+		service = services.NewSelfUpdateServiceWithOptions(newOptions(rs, exe, &restarted, ""))
+		require.True(t, service.CanRollback())
+		service.StartRollback("token", "account", previousVersion)
+		status := waitForUpdate(t, service)
+		assert.Equal(t, "rolled_back", status.Status, status.Error)
+
+		data, err := os.ReadFile(exe)
+		require.NoError(t, err)
+		assert.Equal(t, "old binary", string(data))
+		assert.False(t, service.CanRollback())
+	})
+}
@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStore(t *testing.T) utils.StateStore {
+	t.Helper()
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+	return store
+}
+
+func TestKeyring_EncryptDecrypt(t *testing.T) {
+	keyring := utils.NewKeyring(newTestStore(t), "instance-secret", utils.KEKSourceSecret)
+
+	encrypted, err := keyring.Encrypt("cf-token", "account-1", "hunter2")
+	require.NoError(t, err)
+	assert.True(t, utils.IsEnvelope(encrypted))
+	assert.NotContains(t, encrypted, "hunter2")
+
+	decrypted, err := keyring.Decrypt("cf-token", "account-1", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", decrypted)
+
+	t.Run("secret keyring does not depend on the token", func(t *testing.T) {
+		decrypted, err := keyring.Decrypt("rotated-token", "account-1", encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, "hunter2", decrypted)
+	})
+
+	t.Run("legacy values are decrypted with the token", func(t *testing.T) {
+		legacy, err := utils.EncryptData("old secret", "cf-token")
+		require.NoError(t, err)
+		assert.False(t, utils.IsEnvelope(legacy))
+
+		decrypted, err := keyring.Decrypt("cf-token", "account-1", legacy)
+		require.NoError(t, err)
+		assert.Equal(t, "old secret", decrypted)
+	})
+}
+
+func TestKeyring_Persistence(t *testing.T) {
+	store := newTestStore(t)
+	encrypted, err := utils.NewKeyring(store, "instance-secret", utils.KEKSourceSecret).Encrypt("cf-token", "account-1", "hunter2")
+	require.NoError(t, err)
+
+	decrypted, err := utils.NewKeyring(store, "instance-secret", utils.KEKSourceSecret).Decrypt("cf-token", "account-1", encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", decrypted)
+
+	_, err = utils.NewKeyring(store, "wrong-secret", utils.KEKSourceSecret).Decrypt("cf-token", "account-1", encrypted)
+	assert.ErrorIs(t, err, utils.ErrKeyringLocked)
+}
+
+func TestKeyring_RotationWithTokenKEK(t *testing.T) {
+	store := newTestStore(t)
+	keyring := utils.NewKeyring(store, "", utils.KEKSourceToken)
+
+	encrypted, err := keyring.Encrypt("old-token", "account-1", "hunter2")
+	require.NoError(t, err)
+	legacy, err := utils.EncryptData("legacy", "old-token")
+	require.NoError(t, err)
+
+	rotation, err := keyring.BeginRotation("old-token", "new-token", "account-1")
+	require.NoError(t, err)
+
+	reencrypted, err := rotation.Reencrypt(encrypted)
+	require.NoError(t, err)
+	assert.Contains(t, reencrypted, rotation.KeyID())
+	reencryptedLegacy, err := rotation.Reencrypt(legacy)
+	require.NoError(t, err)
+	require.NoError(t, rotation.Finish())
+
+	// A fresh process can only unlock the keyring with the new token
+	restarted := utils.NewKeyring(store, "", utils.KEKSourceToken)
+	_, err = restarted.Decrypt("old-token", "account-1", reencrypted)
+	assert.ErrorIs(t, err, utils.ErrKeyringLocked)
+
+	restarted = utils.NewKeyring(store, "", utils.KEKSourceToken)
+	decrypted, err := restarted.Decrypt("new-token", "account-1", reencrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", decrypted)
+	decrypted, err = restarted.Decrypt("new-token", "account-1", reencryptedLegacy)
+	require.NoError(t, err)
+	assert.Equal(t, "legacy", decrypted)
+
+	// The retired key is gone
+	_, err = restarted.Decrypt("new-token", "account-1", encrypted)
+	assert.ErrorIs(t, err, utils.ErrUnknownKey)
+}
+
+func TestKeyring_InterruptedRotationKeepsOldKEK(t *testing.T) {
+	store := newTestStore(t)
+	keyring := utils.NewKeyring(store, "", utils.KEKSourceToken)
+
+	encrypted, err := keyring.Encrypt("old-token", "account-1", "hunter2")
+	require.NoError(t, err)
+
+	rotation, err := keyring.BeginRotation("old-token", "new-token", "account-1")
+	require.NoError(t, err)
+	reencrypted, err := rotation.Reencrypt(encrypted)
+	require.NoError(t, err)
+	rotation.Abort()
+
+	// The instance restarts still using the old token
+	restarted := utils.NewKeyring(store, "", utils.KEKSourceToken)
+	for _, value := range []string{encrypted, reencrypted} {
+		decrypted, err := restarted.Decrypt("old-token", "account-1", value)
+		require.NoError(t, err)
+		assert.Equal(t, "hunter2", decrypted)
+	}
+}
+
+func TestKeyring_RotationsAreSerialized(t *testing.T) {
+	keyring := utils.NewKeyring(newTestStore(t), "instance-secret", utils.KEKSourceSecret)
+
+	first, err := keyring.BeginRotation("cf-token", "cf-token", "account-1")
+	require.NoError(t, err)
+
+	began := make(chan *utils.KeyRotation)
+	go func() {
+		second, err := keyring.BeginRotation("cf-token", "cf-token", "account-1")
+		assert.NoError(t, err)
+		began <- second
+	}()
+
+	select {
+	case <-began:
+		t.Fatal("second rotation began before the first finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	encrypted, err := first.Encrypt("hunter2")
+	require.NoError(t, err)
+	require.NoError(t, first.Finish())
+
+	second := <-began
+	reencrypted, err := second.Reencrypt(encrypted)
+	require.NoError(t, err)
+	require.NoError(t, second.Finish())
+
+	decrypted, err := keyring.Decrypt("cf-token", "account-1", reencrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", decrypted)
+}
@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/chrishham/xanthus/internal/utils"
+)
+
+func TestMetricsRegistry_Write(t *testing.T) {
+	registry := utils.NewMetricsRegistry()
+	requests := registry.NewCounter("test_requests_total", "Requests by path", "path")
+	latency := registry.NewHistogram("test_latency_seconds", "Latency", []float64{0.1, 1})
+	registry.NewCollected("test_sessions", "Open sessions", utils.KindGauge, nil, func() []utils.MetricSample {
+		return []utils.MetricSample{{Value: 3}}
+	})
+
+	requests.Inc("/a")
+	requests.Add(2, `/b "quoted"`)
+	latency.Observe(0.05)
+	latency.Observe(0.5)
+	latency.Observe(5)
+
+	var out strings.Builder
+	require.NoError(t, registry.Write(&out))
+	assert.Equal(t, `# HELP test_latency_seconds Latency
+# TYPE test_latency_seconds histogram
+test_latency_seconds_bucket{le="0.1"} 1
+test_latency_seconds_bucket{le="1"} 2
+test_latency_seconds_bucket{le="+Inf"} 3
+test_latency_seconds_sum 5.55
+test_latency_seconds_count 3
+# HELP test_requests_total Requests by path
+# TYPE test_requests_total counter
+test_requests_total{path="/a"} 1
+test_requests_total{path="/b \"quoted\""} 2
+# HELP test_sessions Open sessions
+# TYPE test_sessions gauge
+test_sessions 3
+`, out.String())
+
+	assert.Panics(t, func() { registry.NewCounter("test_requests_total", "Again") })
+	assert.Panics(t, func() { requests.Inc() })
+}
+
+// stubTransport answers every request with a fixed status, or fails
+type stubTransport struct {
+	status int
+	err    error
+}
+
+func (s stubTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &http.Response{StatusCode: s.status, Body: http.NoBody, Request: req}, nil
+}
+
+func TestMeteredTransport(t *testing.T) {
+	assert.Equal(t, "cloudflare", utils.ExternalAPIService("api.cloudflare.com"))
+	assert.Equal(t, "oci", utils.ExternalAPIService("iaas.eu-frankfurt-1.oraclecloud.com:443"))
+	assert.Equal(t, "github", utils.ExternalAPIService("objects.githubusercontent.com"))
+	assert.Empty(t, utils.ExternalAPIService("example.com"))
+	assert.Empty(t, utils.ExternalAPIService("notgithub.com"))
+
+	send := func(transport http.RoundTripper, url string) {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		require.NoError(t, err)
+		if resp, err := transport.RoundTrip(req); err == nil {
+			resp.Body.Close()
+		}
+	}
+	send(utils.NewMeteredTransport(stubTransport{status: http.StatusOK}), "https://api.hetzner.cloud/v1/servers")
+	send(utils.NewMeteredTransport(stubTransport{status: http.StatusTooManyRequests}), "https://api.hetzner.cloud/v1/servers")
+	send(utils.NewMeteredTransport(stubTransport{err: errors.New("connection refused")}), "https://api.hetzner.cloud/v1/servers")
+	send(utils.NewMeteredTransport(stubTransport{status: http.StatusOK}), "https://example.com/")
+
+	var out strings.Builder
+	require.NoError(t, utils.Metrics().Write(&out))
+	assert.Contains(t, out.String(), `xanthus_external_api_requests_total{service="hetzner",code="200"} 1`)
+	assert.Contains(t, out.String(), `xanthus_external_api_requests_total{service="hetzner",code="429"} 1`)
+	assert.Contains(t, out.String(), `xanthus_external_api_requests_total{service="hetzner",code="error"} 1`)
+	assert.Contains(t, out.String(), `xanthus_external_api_errors_total{service="hetzner"} 2`)
+	assert.Contains(t, out.String(), `xanthus_external_api_request_duration_seconds_count{service="hetzner"} 3`)
+	assert.NotContains(t, out.String(), `example`)
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chrishham/xanthus/internal/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalStateStore_PutGetDelete(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+
+	err = store.Put("token", "account-1", "vps:123:config", []byte(`{"name":"test"}`))
+	require.NoError(t, err)
+
+	data, err := store.Get("token", "account-1", "vps:123:config")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"test"}`, string(data))
+
+	// Overwrite replaces the value
+	err = store.Put("token", "account-1", "vps:123:config", []byte(`{"name":"updated"}`))
+	require.NoError(t, err)
+	data, err = store.Get("token", "account-1", "vps:123:config")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"updated"}`, string(data))
+
+	require.NoError(t, store.Delete("token", "account-1", "vps:123:config"))
+	_, err = store.Get("token", "account-1", "vps:123:config")
+	assert.ErrorIs(t, err, utils.ErrKeyNotFound)
+
+	// Deleting a missing key is not an error
+	assert.NoError(t, store.Delete("token", "account-1", "vps:123:config"))
+}
+
+func TestLocalStateStore_ListKeys(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+
+	for _, key := range []string{"app:b", "app:a", "app:a:password", "vps:1:config", "config:ssl:csr"} {
+		require.NoError(t, store.Put("token", "account-1", key, []byte(`{}`)))
+	}
+
+	keys, err := store.ListKeys("token", "account-1", "app:")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app:a", "app:a:password", "app:b"}, keys)
+
+	keys, err = store.ListKeys("token", "account-1", "")
+	require.NoError(t, err)
+	assert.Len(t, keys, 5)
+
+	keys, err = store.ListKeys("token", "unknown-account", "app:")
+	require.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestLocalStateStore_AccountIsolation(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+
+	require.NoError(t, store.Put("token", "account-1", "config:hetzner:api_key", []byte(`"secret"`)))
+
+	_, err = store.Get("token", "account-2", "config:hetzner:api_key")
+	assert.ErrorIs(t, err, utils.ErrKeyNotFound)
+}
+
+func TestLocalStateStore_Persistence(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := utils.NewLocalStateStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, store.Put("token", "account-1", "app:app-1", []byte(`{"id":"app-1"}`)))
+
+	reopened, err := utils.NewLocalStateStore(dir)
+	require.NoError(t, err)
+	data, err := reopened.Get("token", "account-1", "app:app-1")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"app-1"}`, string(data))
+}
+
+func TestKVValueHelpers_UseConfiguredStore(t *testing.T) {
+	store, err := utils.NewLocalStateStore(t.TempDir())
+	require.NoError(t, err)
+
+	previous := utils.GetStateStore()
+	utils.SetStateStore(store)
+	defer utils.SetStateStore(previous)
+
+	assert.False(t, utils.UsesCloudflareKV())
+
+	value := map[string]interface{}{"key1": "value1", "key2": float64(123)}
+	require.NoError(t, utils.PutKVValue(&http.Client{}, "token", "account-1", "test-key", value))
+
+	var result map[string]interface{}
+	require.NoError(t, utils.GetKVValue(&http.Client{}, "token", "account-1", "test-key", &result))
+	assert.Equal(t, value, result)
+
+	err = utils.GetKVValue(&http.Client{}, "token", "account-1", "missing", &result)
+	assert.ErrorIs(t, err, utils.ErrKeyNotFound)
+}
+
+func TestCloudflareKVStore_AgainstMockAPI(t *testing.T) {
+	values := map[string]string{}
+	namespaceLookups := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		base := "/accounts/account-1/storage/kv/namespaces"
+
+		switch {
+		case r.URL.Path == base:
+			namespaceLookups++
+			w.Write([]byte(`{"success":true,"result":[{"id":"ns-1","title":"Xanthus"}]}`))
+		case strings.HasPrefix(r.URL.Path, base+"/ns-1/values/"):
+			key := strings.TrimPrefix(r.URL.Path, base+"/ns-1/values/")
+			switch r.Method {
+			case "PUT":
+				var body json.RawMessage
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+				values[key] = string(body)
+				w.Write([]byte(`{"success":true}`))
+			case "GET":
+				value, ok := values[key]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write([]byte(value))
+			case "DELETE":
+				delete(values, key)
+				w.Write([]byte(`{"success":true}`))
+			}
+		case r.URL.Path == base+"/ns-1/keys":
+			// Paginate: first page returns a cursor
+			if r.URL.Query().Get("cursor") == "" {
+				w.Write([]byte(`{"success":true,"result":[{"name":"app:a"}],"result_info":{"cursor":"next"}}`))
+				return
+			}
+			w.Write([]byte(`{"success":true,"result":[{"name":"app:b"}],"result_info":{"cursor":""}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	store := utils.NewCloudflareKVStoreWithURL(server.URL)
+
+	require.NoError(t, store.Put("test-token", "account-1", "app:a", []byte(`{"id":"a"}`)))
+	data, err := store.Get("test-token", "account-1", "app:a")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"a"}`, string(data))
+
+	keys, err := store.ListKeys("test-token", "account-1", "app:")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"app:a", "app:b"}, keys)
+
+	require.NoError(t, store.Delete("test-token", "account-1", "app:a"))
+	_, err = store.Get("test-token", "account-1", "app:a")
+	assert.ErrorIs(t, err, utils.ErrKeyNotFound)
+
+	// Namespace ID is resolved once and cached
+	assert.Equal(t, 1, namespaceLookups)
+}
+
+func TestNewStateStoreFromEnv(t *testing.T) {
+	t.Run("defaults to cloudflare", func(t *testing.T) {
+		t.Setenv("XANTHUS_STATE_BACKEND", "")
+		store, err := utils.NewStateStoreFromEnv()
+		require.NoError(t, err)
+		assert.Equal(t, utils.StateBackendCloudflare, store.Name())
+	})
+
+	t.Run("local backend uses data dir", func(t *testing.T) {
+		dir := t.TempDir()
+		t.Setenv("XANTHUS_STATE_BACKEND", "local")
+		t.Setenv("XANTHUS_DATA_DIR", dir)
+		store, err := utils.NewStateStoreFromEnv()
+		require.NoError(t, err)
+		require.Equal(t, utils.StateBackendLocal, store.Name())
+		assert.Equal(t, dir, store.(*utils.LocalStateStore).Dir())
+	})
+
+	t.Run("rejects unknown backend", func(t *testing.T) {
+		t.Setenv("XANTHUS_STATE_BACKEND", "etcd")
+		_, err := utils.NewStateStoreFromEnv()
+		assert.Error(t, err)
+	})
+}
@@ -1,5 +1,7 @@
 // Applications Management Module - Alpine.js component
 // Version: 2025-07-05-token-support
+import { MetricsCharts } from './common/metrics-charts.js';
+
 export function applicationsManagement() {
     return {
         applications: window.initialApplications || [],
@@ -7,6 +9,7 @@ export function applicationsManagement() {
         loading: false,
         loadingTitle: 'Processing...',
         loadingMessage: 'Please wait while the operation completes.',
+        jobProgress: { steps: [], lines: [] }, // Live progress of the job behind the loading modal
         autoRefreshEnabled: true, // Enabled by default for real-time status updates
         refreshInterval: 30000, // 30 seconds - good balance between freshness and performance
         intervalId: null,
@@ -451,6 +454,7 @@ export function applicationsManagement() {
 
         async createApplication(formData) {
             this.setLoadingState('Deploying Application', `Deploying "${formData.name}"...`);
+            const stopFollowing = this.followJob('app.deploy', `${formData.subdomain}.${formData.domain}`);
             try {
                 const response = await fetch('/applications/create', {
                     method: 'POST',
@@ -541,6 +545,7 @@ export function applicationsManagement() {
                 console.error('Error creating application:', error);
                 Swal.fire('Error', 'Failed to deploy application', 'error');
             } finally {
+                stopFollowing();
                 this.loading = false;
             }
         },
@@ -662,6 +667,7 @@ export function applicationsManagement() {
 
         async upgradeApplication(appId, version) {
             this.setLoadingState('Changing Version', 'Changing application version...');
+            const stopFollowing = this.followJob('app.upgrade', appId);
             try {
                 const response = await fetch(`/applications/${appId}/upgrade`, {
                     method: 'POST',
@@ -683,6 +689,7 @@ export function applicationsManagement() {
                 console.error('Error upgrading application:', error);
                 Swal.fire('Error', 'Failed to change application version', 'error');
             } finally {
+                stopFollowing();
                 this.loading = false;
             }
         },
@@ -934,6 +941,16 @@ export function applicationsManagement() {
             }
         },
 
+        async showMetricsModal(app) {
+            await MetricsCharts.show(`Metrics of "${app.name}"`, `/api/v1/applications/${app.id}/metrics`, series => `
+                <p class="text-xs text-gray-500 mb-2">Usage of the application's pods, ${series.resolution} resolution, updated ${new Date(series.updated_at).toLocaleString()}</p>
+                <div class="grid grid-cols-2 gap-3">
+                    ${MetricsCharts.chart('CPU', series.points, p => p.cpu_cores, v => `${(v * 1000).toFixed(0)}m`)}
+                    ${MetricsCharts.chart('Memory', series.points, p => p.memory_bytes, MetricsCharts.formatBytes)}
+                </div>
+            `);
+        },
+
         async confirmDeleteApplication(appId, appName) {
             const result = await Swal.fire({
                 title: 'Delete Application?',
@@ -973,6 +990,228 @@ export function applicationsManagement() {
             }
         },
 
+        // Backups of the application's persistent volumes: sets up a backup
+        // policy when there is none, otherwise lists the snapshots to restore
+        async showBackupsModal(app) {
+            this.setLoadingState('Loading Backups', `Retrieving backups of "${app.name}"...`);
+            let policy = null;
+            let snapshots = [];
+            let targets = [];
+            try {
+                const policyResponse = await fetch(`/api/v1/applications/${app.id}/backup`);
+                if (policyResponse.ok) {
+                    policy = (await policyResponse.json()).data;
+                    const snapshotsResponse = await fetch(`/api/v1/applications/${app.id}/backups`);
+                    const snapshotsData = await snapshotsResponse.json();
+                    if (!snapshotsResponse.ok) {
+                        Swal.fire('Error', snapshotsData.error || 'Failed to list backups', 'error');
+                        return;
+                    }
+                    snapshots = snapshotsData.data || [];
+                } else if (policyResponse.status === 404) {
+                    const targetsResponse = await fetch('/api/v1/backups/targets');
+                    targets = targetsResponse.ok ? ((await targetsResponse.json()).data || []) : [];
+                } else {
+                    const data = await policyResponse.json();
+                    Swal.fire('Error', data.error || 'Failed to load backup policy', 'error');
+                    return;
+                }
+            } catch (error) {
+                console.error('Error loading backups:', error);
+                Swal.fire('Error', 'Failed to load backups', 'error');
+                return;
+            } finally {
+                this.loading = false;
+            }
+
+            if (!policy) {
+                await this.showBackupPolicyModal(app, targets);
+                return;
+            }
+
+            const rows = snapshots.map(snapshot => `
+                <tr class="border-t border-gray-200">
+                    <td class="py-2 font-mono text-xs">${snapshot.short_id}</td>
+                    <td class="py-2 text-xs">${this.formatDate(snapshot.time)}</td>
+                    <td class="py-2 text-right">
+                        <button data-snapshot="${snapshot.id}" class="restore-snapshot text-xs px-2 py-1 border border-orange-300 text-orange-700 bg-orange-50 rounded hover:bg-orange-100">Restore</button>
+                    </td>
+                </tr>
+            `).join('');
+
+            const result = await Swal.fire({
+                title: `Backups of ${app.name}`,
+                html: `
+                    <div class="text-left text-sm">
+                        <p class="mb-2">Backing up <strong>${policy.volumes.join(', ')}</strong> to <strong>${policy.target}</strong> on <code>${policy.schedule}</code>.</p>
+                        ${snapshots.length === 0
+                            ? '<p class="text-gray-500">No backups yet.</p>'
+                            : `<table class="w-full"><thead><tr class="text-xs text-gray-500"><th class="text-left">Snapshot</th><th class="text-left">Time</th><th></th></tr></thead><tbody>${rows}</tbody></table>`}
+                    </div>
+                `,
+                showCancelButton: true,
+                showDenyButton: true,
+                confirmButtonText: 'Back Up Now',
+                confirmButtonColor: '#2563eb',
+                denyButtonText: 'Stop Backups',
+                cancelButtonText: 'Close',
+                didOpen: () => {
+                    document.querySelectorAll('.restore-snapshot').forEach(button => {
+                        button.addEventListener('click', () => {
+                            Swal.close();
+                            this.confirmRestoreBackup(app, button.dataset.snapshot);
+                        });
+                    });
+                }
+            });
+
+            if (result.isConfirmed) {
+                await this.runBackup(app);
+            } else if (result.isDenied) {
+                await this.deleteBackupPolicy(app);
+            }
+        },
+
+        async showBackupPolicyModal(app, targets) {
+            if (targets.length === 0) {
+                Swal.fire({
+                    title: 'No Backup Targets',
+                    html: 'Add an S3-compatible bucket first, e.g. with <code>xanthusctl backup target add</code>.',
+                    icon: 'info',
+                    confirmButtonColor: '#2563eb'
+                });
+                return;
+            }
+
+            const options = targets.map(target => `<option value="${target.name}">${target.name} (${target.bucket})</option>`).join('');
+            const { value: policy } = await Swal.fire({
+                title: `Back Up ${app.name}`,
+                html: `
+                    <div class="text-left">
+                        <label class="block text-sm font-medium text-gray-700 mb-1">Target:</label>
+                        <select id="backup-target" class="swal2-input m-0 mb-4 w-full">${options}</select>
+                        <label class="block text-sm font-medium text-gray-700 mb-1">Schedule (cron, server time):</label>
+                        <input id="backup-schedule" class="swal2-input m-0 mb-4 w-full" value="0 3 * * *">
+                        <p class="text-xs text-gray-500">Keeps the last 7 daily and 4 weekly backups.</p>
+                    </div>
+                `,
+                showCancelButton: true,
+                confirmButtonText: 'Enable Backups',
+                confirmButtonColor: '#2563eb',
+                preConfirm: () => ({
+                    target: document.getElementById('backup-target').value,
+                    schedule: document.getElementById('backup-schedule').value.trim()
+                })
+            });
+            if (!policy) {
+                return;
+            }
+
+            this.setLoadingState('Enabling Backups', `Installing the backup schedule of "${app.name}"...`);
+            const stopFollowing = this.followJob('backup.policy', app.id);
+            try {
+                const response = await fetch(`/api/v1/applications/${app.id}/backup`, {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(policy)
+                });
+                const data = await response.json();
+                if (response.ok) {
+                    Swal.fire('Backups Enabled', `Backing up ${data.data.volumes.join(', ')} on "${data.data.schedule}".`, 'success');
+                } else {
+                    Swal.fire('Error', data.error || 'Failed to enable backups', 'error');
+                }
+            } catch (error) {
+                console.error('Error setting backup policy:', error);
+                Swal.fire('Error', 'Failed to enable backups', 'error');
+            } finally {
+                stopFollowing();
+                this.loading = false;
+            }
+        },
+
+        async runBackup(app) {
+            this.setLoadingState('Backing Up', `Backing up "${app.name}"...`);
+            const stopFollowing = this.followJob('backup.run', app.id);
+            try {
+                const response = await fetch(`/api/v1/applications/${app.id}/backups`, { method: 'POST' });
+                const data = await response.json();
+                if (response.ok) {
+                    Swal.fire('Backed Up!', `"${app.name}" has been backed up.`, 'success');
+                } else {
+                    Swal.fire('Error', data.error || 'Backup failed', 'error');
+                }
+            } catch (error) {
+                console.error('Error backing up application:', error);
+                Swal.fire('Error', 'Backup failed', 'error');
+            } finally {
+                stopFollowing();
+                this.loading = false;
+            }
+        },
+
+        async confirmRestoreBackup(app, snapshotId) {
+            const result = await Swal.fire({
+                title: 'Restore Backup?',
+                text: `"${app.name}" will be stopped and its volumes replaced with snapshot ${snapshotId.substring(0, 8)}. Changes made since are lost.`,
+                icon: 'warning',
+                showCancelButton: true,
+                confirmButtonColor: '#dc2626',
+                cancelButtonColor: '#6b7280',
+                confirmButtonText: 'Yes, restore it!'
+            });
+            if (!result.isConfirmed) {
+                return;
+            }
+
+            this.setLoadingState('Restoring Backup', `Restoring "${app.name}"...`);
+            const stopFollowing = this.followJob('backup.restore', app.id);
+            try {
+                const response = await fetch(`/api/v1/applications/${app.id}/backups/${snapshotId}/restore`, { method: 'POST' });
+                const data = await response.json();
+                if (response.ok) {
+                    Swal.fire('Restored!', `"${app.name}" has been restored.`, 'success');
+                    await this.refreshApplications();
+                } else {
+                    Swal.fire('Error', data.error || 'Restore failed', 'error');
+                }
+            } catch (error) {
+                console.error('Error restoring backup:', error);
+                Swal.fire('Error', 'Restore failed', 'error');
+            } finally {
+                stopFollowing();
+                this.loading = false;
+            }
+        },
+
+        async deleteBackupPolicy(app) {
+            const result = await Swal.fire({
+                title: 'Stop Backups?',
+                text: `Scheduled backups of "${app.name}" stop. Existing backups stay in their bucket.`,
+                icon: 'warning',
+                showCancelButton: true,
+                confirmButtonColor: '#dc2626',
+                cancelButtonColor: '#6b7280',
+                confirmButtonText: 'Stop backups'
+            });
+            if (!result.isConfirmed) {
+                return;
+            }
+
+            try {
+                const response = await fetch(`/api/v1/applications/${app.id}/backup`, { method: 'DELETE' });
+                const data = await response.json();
+                if (response.ok) {
+                    Swal.fire('Stopped', `Backups of "${app.name}" have been stopped.`, 'success');
+                } else {
+                    Swal.fire('Error', data.error || 'Failed to stop backups', 'error');
+                }
+            } catch (error) {
+                console.error('Error deleting backup policy:', error);
+                Swal.fire('Error', 'Failed to stop backups', 'error');
+            }
+        },
+
         formatDate(dateString) {
             return new Date(dateString).toLocaleDateString('en-US', {
                 year: 'numeric',
@@ -989,6 +1228,66 @@ export function applicationsManagement() {
             this.loading = true;
         },
 
+        // Shows the steps, Helm output and pod status of a running job in the
+        // loading modal. The request that starts the job only answers once it
+        // finished, so the job is looked up by type and target and followed
+        // over server-sent events. Returns a function that stops following.
+        followJob(type, target) {
+            let stopped = false;
+            let source = null;
+            this.jobProgress = { steps: [], lines: [] };
+
+            const addLine = (message) => {
+                this.jobProgress.lines = [...this.jobProgress.lines, message].slice(-6);
+            };
+
+            const attach = async () => {
+                while (!stopped && !source) {
+                    try {
+                        const response = await fetch('/api/v1/jobs?limit=10');
+                        if (response.ok) {
+                            const { data } = await response.json();
+                            const job = (data || []).find(j => j.type === type && j.target === target && !j.finished_at);
+                            if (job && !stopped) {
+                                source = new EventSource(`/api/v1/jobs/${job.id}/events`);
+                                source.addEventListener('status', (event) => {
+                                    const { job } = JSON.parse(event.data);
+                                    this.jobProgress.steps = job.steps;
+                                    if (job.finished_at) {
+                                        source.close();
+                                    }
+                                });
+                                source.addEventListener('step', (event) => {
+                                    const { step } = JSON.parse(event.data);
+                                    const steps = this.jobProgress.steps.filter(s => s.name !== step.name);
+                                    this.jobProgress.steps = [...steps, step];
+                                    this.loadingMessage = step.name + '...';
+                                });
+                                source.addEventListener('log', (event) => addLine(JSON.parse(event.data).message));
+                                source.addEventListener('pod', (event) => {
+                                    const { pod } = JSON.parse(event.data);
+                                    addLine(`Pod ${pod.name}: ${pod.status}, ${pod.ready} ready`);
+                                });
+                                return;
+                            }
+                        }
+                    } catch (error) {
+                        console.error('Error following job progress:', error);
+                    }
+                    await new Promise(resolve => setTimeout(resolve, 2000));
+                }
+            };
+            attach();
+
+            return () => {
+                stopped = true;
+                if (source) {
+                    source.close();
+                }
+                this.jobProgress = { steps: [], lines: [] };
+            };
+        },
+
         getPredefinedAppIcon(appType) {
             const app = this.predefinedApps.find(a => a.id === appType);
             return app ? app.icon : '📦';
@@ -0,0 +1,114 @@
+// Metrics Charts - SVG charts of the usage history of servers and applications
+export class MetricsCharts {
+    static ranges = [
+        { value: '1h', label: 'Last hour' },
+        { value: '6h', label: 'Last 6 hours' },
+        { value: '24h', label: 'Last 24 hours' },
+        { value: '7d', label: 'Last 7 days' },
+        { value: '30d', label: 'Last 30 days' }
+    ];
+
+    // Format a byte count with a binary unit
+    static formatBytes(bytes) {
+        const units = ['B', 'KiB', 'MiB', 'GiB', 'TiB'];
+        let value = bytes || 0;
+        let unit = 0;
+        while (value >= 1024 && unit < units.length - 1) {
+            value /= 1024;
+            unit++;
+        }
+        return `${value.toFixed(unit === 0 ? 0 : 1)} ${units[unit]}`;
+    }
+
+    // Render a line chart of the values of points; max fixes the top of the
+    // y axis, otherwise it's scaled to the largest value
+    static chart(title, points, value, format, max) {
+        const values = points.map(value);
+        const latest = values.length ? format(values[values.length - 1]) : '-';
+        if (values.length < 2) {
+            return `
+                <div class="border border-gray-200 rounded-md p-2">
+                    <div class="flex justify-between text-xs"><span class="font-medium text-gray-700">${title}</span><span class="text-gray-900">${latest}</span></div>
+                    <div class="text-xs text-gray-500 py-6 text-center">Not enough samples yet</div>
+                </div>
+            `;
+        }
+
+        const width = 360, height = 80;
+        const top = max || Math.max(...values) || 1;
+        const start = new Date(points[0].time).getTime();
+        const span = (new Date(points[points.length - 1].time).getTime() - start) || 1;
+        const coordinates = points.map((point, i) => {
+            const x = (new Date(point.time).getTime() - start) / span * width;
+            const y = height - Math.min(values[i] / top, 1) * height;
+            return `${x.toFixed(1)},${y.toFixed(1)}`;
+        }).join(' ');
+
+        return `
+            <div class="border border-gray-200 rounded-md p-2">
+                <div class="flex justify-between text-xs"><span class="font-medium text-gray-700">${title}</span><span class="text-gray-900">${latest}</span></div>
+                <svg viewBox="0 0 ${width} ${height}" preserveAspectRatio="none" class="w-full h-20 mt-1">
+                    <polygon points="0,${height} ${coordinates} ${width},${height}" fill="#ccfbf1"></polygon>
+                    <polyline points="${coordinates}" fill="none" stroke="#0d9488" stroke-width="1.5" vector-effect="non-scaling-stroke"></polyline>
+                </svg>
+                <div class="flex justify-between text-[10px] text-gray-400"><span>${new Date(points[0].time).toLocaleString()}</span><span>max ${format(top)}</span></div>
+            </div>
+        `;
+    }
+
+    // Show the usage history served at url in a modal, with a range selector;
+    // render turns a metrics series into the charts
+    static async show(title, url, render) {
+        const load = async (range) => {
+            const response = await fetch(`${url}?range=${range}`);
+            const data = await response.json();
+            if (response.status === 404) {
+                return '<p class="text-sm text-gray-600 py-6">No metrics were collected yet. They are sampled every minute.</p>';
+            }
+            if (!response.ok) {
+                return `<p class="text-sm text-red-600 py-6">${data.error || 'Failed to load metrics'}</p>`;
+            }
+            return render(data.data);
+        };
+
+        let content;
+        try {
+            content = await load(this.ranges[0].value);
+        } catch (error) {
+            console.error('Error loading metrics:', error);
+            Swal.fire('Error', 'Failed to load metrics', 'error');
+            return;
+        }
+
+        const options = this.ranges.map(range => `<option value="${range.value}">${range.label}</option>`).join('');
+        Swal.fire({
+            title,
+            html: `
+                <div class="text-left">
+                    <select id="metrics-range" class="mb-3 p-1 text-sm border border-gray-300 rounded-md">${options}</select>
+                    <div id="metrics-content">${content}</div>
+                </div>
+            `,
+            width: 860,
+            showCloseButton: true,
+            confirmButtonText: 'Close',
+            didOpen: () => {
+                const select = document.getElementById('metrics-range');
+                select.addEventListener('change', async () => {
+                    const container = document.getElementById('metrics-content');
+                    container.style.opacity = '0.5';
+                    try {
+                        container.innerHTML = await load(select.value);
+                    } catch (error) {
+                        console.error('Error loading metrics:', error);
+                        container.innerHTML = '<p class="text-sm text-red-600 py-6">Failed to load metrics</p>';
+                    } finally {
+                        container.style.opacity = '1';
+                    }
+                });
+            }
+        });
+    }
+}
+
+export default MetricsCharts;
@@ -26,6 +26,16 @@ export function vpsCreationWizard() {
             memory: 6
         },
         
+        // Existing server added over SSH (provider Manual)
+        manualServer: {
+            name: '',
+            host: '',
+            sshUser: 'root',
+            sshPort: 22,
+            password: '',
+            timezone: ''
+        },
+        
         // Hetzner: Location and Server Type
         locations: [],
         selectedLocation: null,
@@ -583,9 +593,10 @@ export function vpsCreationWizard() {
             
             try {
                 const requestBody = {
+                    provider: 'oci',
                     name: this.serverName,
-                    shape: 'VM.Standard.A1.Flex', // Always Free tier ARM64
-                    region: this.ociLocation,
+                    server_type: 'VM.Standard.A1.Flex', // Always Free tier ARM64
+                    location: this.ociLocation,
                     timezone: 'UTC',
                     ocpu: this.ociConfig.ocpu,
                     memory: this.ociConfig.memory
@@ -596,7 +607,7 @@ export function vpsCreationWizard() {
                     requestBody.oci_token = this.ociToken;
                 }
 
-                const response = await fetch('/vps/oci/create', {
+                const response = await fetch('/vps/create', {
                     method: 'POST',
                     headers: {
                         'Content-Type': 'application/json',
@@ -618,8 +629,8 @@ export function vpsCreationWizard() {
                             <div class="text-left">
                                 <p class="mb-2">Your OCI instance "${this.serverName}" has been created and configured.</p>
                                 <p class="mb-2">K3s and Helm are being installed automatically.</p>
-                                <p class="mb-2"><strong>Instance ID:</strong> ${data.server.oci_id}</p>
-                                <p class="mb-2"><strong>IP Address:</strong> ${data.server.public_net.ipv4.ip}</p>
+                                <p class="mb-2"><strong>Instance ID:</strong> ${data.config.provider_instance_id}</p>
+                                <p class="mb-2"><strong>IP Address:</strong> ${data.config.public_ipv4}</p>
                                 <p class="text-sm text-gray-600">You will be redirected to the VPS management page.</p>
                             </div>
                         `,
@@ -696,6 +707,59 @@ export function vpsCreationWizard() {
             } finally {
                 this.creating = false;
             }
+        },
+        
+        async addExistingServer() {
+            if (!this.manualServer.name || !this.manualServer.host) return;
+            
+            this.creating = true;
+            this.loading = true;
+            this.loadingMessage = `Connecting to ${this.manualServer.host} and starting K3s setup...`;
+            
+            try {
+                const response = await fetch('/vps/add-existing', {
+                    method: 'POST',
+                    headers: {
+                        'Content-Type': 'application/json',
+                    },
+                    body: JSON.stringify({
+                        name: this.manualServer.name,
+                        host: this.manualServer.host,
+                        ssh_user: this.manualServer.sshUser,
+                        ssh_port: this.manualServer.sshPort,
+                        password: this.manualServer.password,
+                        timezone: this.manualServer.timezone
+                    })
+                });
+                
+                const data = await response.json();
+                
+                if (response.ok) {
+                    await Swal.fire({
+                        title: 'Server Added Successfully!',
+                        html: `
+                            <div class="text-left">
+                                <p class="mb-2">"${this.manualServer.name}" has been added to Xanthus.</p>
+                                <p class="mb-2">K3s setup is running in the background and may take 5-10 minutes.</p>
+                                <p class="text-sm text-gray-600">You will be redirected to the VPS management page.</p>
+                            </div>
+                        `,
+                        icon: 'success',
+                        confirmButtonText: 'Go to VPS Management'
+                    });
+                    
+                    window.location.href = '/vps';
+                } else {
+                    this.loading = false;
+                    Swal.fire('Error', data.error || 'Failed to add server', 'error');
+                }
+            } catch (error) {
+                console.error('Error adding existing server:', error);
+                this.loading = false;
+                Swal.fire('Error', 'Failed to add server', 'error');
+            } finally {
+                this.creating = false;
+            }
         }
     }
-}
\ No newline at end of file
+}
@@ -1,4 +1,5 @@
 // VPS Management Module - Alpine.js component
+import { MetricsCharts } from './common/metrics-charts.js';
 
 export function vpsManagement() {
     return {
@@ -322,16 +323,7 @@ export function vpsManagement() {
         async deleteServer(serverId, serverName) {
             this.setLoadingState('Deleting VPS', `Deleting VPS "${serverName}"...`);
             try {
-                // Get server object to determine provider
-                const server = this.servers.find(s => s.id === serverId);
-                const provider = server?.labels?.provider?.toLowerCase();
-                
-                // Determine the correct endpoint based on provider
-                const deleteEndpoint = (provider && (provider.includes('oracle') || provider.includes('oci'))) 
-                    ? '/vps/oci/delete' 
-                    : '/vps/delete';
-                
-                const response = await fetch(deleteEndpoint, {
+                const response = await fetch('/vps/delete', {
                     method: 'POST',
                     headers: {
                         'Content-Type': 'application/x-www-form-urlencoded',
@@ -367,6 +359,31 @@ export function vpsManagement() {
             await this.performServerAction('reboot', serverId, serverName, 'rebooting');
         },
 
+        async trustHostKey(serverId, serverName) {
+            const result = await Swal.fire({
+                title: 'Re-trust SSH host key?',
+                html: `Xanthus refuses to connect to "${serverName}" when its SSH host key changes.<br><br>Only continue if you rebuilt the server or regenerated its host keys; otherwise the connection may be intercepted.`,
+                icon: 'warning',
+                showCancelButton: true,
+                confirmButtonColor: '#DC2626',
+                confirmButtonText: 'Trust current key'
+            });
+            if (!result.isConfirmed) return;
+
+            try {
+                const response = await fetch(`/vps/${serverId}/trust-host-key`, { method: 'POST' });
+                const data = await response.json();
+                if (response.ok) {
+                    Swal.fire('Host key trusted', `"${serverName}" is now pinned to ${data.data.fingerprint}.`, 'success');
+                } else {
+                    Swal.fire('Error', data.error || 'Failed to trust the host key', 'error');
+                }
+            } catch (error) {
+                console.error('Error trusting host key:', error);
+                Swal.fire('Error', 'Failed to trust the host key', 'error');
+            }
+        },
+
         async performServerAction(action, serverId, serverName, actionText) {
             const actionTitles = {
                 'poweroff': 'Powering Off VPS',
@@ -1427,6 +1444,224 @@ export function vpsManagement() {
             }
         },
 
+        async showClusterNodes(server) {
+            this.setLoadingState('Loading Cluster', `Retrieving the nodes of "${server.name}"...`);
+            let nodes = [];
+            try {
+                const response = await fetch(`/api/v1/vps/${server.id}/nodes`);
+                const data = await response.json();
+                if (!response.ok) {
+                    Swal.fire('Error', data.error || 'Failed to list nodes', 'error');
+                    return;
+                }
+                nodes = data.data || [];
+            } catch (error) {
+                console.error('Error listing nodes:', error);
+                Swal.fire('Error', 'Failed to list nodes', 'error');
+                return;
+            } finally {
+                this.loading = false;
+            }
+
+            const rows = nodes.map(node => `
+                <tr class="border-t border-gray-200">
+                    <td class="py-2 text-xs font-medium">${node.name}</td>
+                    <td class="py-2 text-xs">${node.role}</td>
+                    <td class="py-2 text-xs">${node.ready ? '✅ Ready' : '⏳ Not ready'}</td>
+                    <td class="py-2 text-xs font-mono">${node.internal_ip}</td>
+                    <td class="py-2 text-xs">${node.kubelet_version}</td>
+                    <td class="py-2 text-xs">${node.cpus} CPU / ${node.memory_gb.toFixed(1)} GB</td>
+                </tr>
+            `).join('');
+
+            Swal.fire({
+                title: 'Cluster Nodes',
+                html: `
+                    <table class="w-full text-left">
+                        <thead><tr class="text-xs text-gray-500">
+                            <th class="py-1">Name</th><th class="py-1">Role</th><th class="py-1">Status</th>
+                            <th class="py-1">Internal IP</th><th class="py-1">Version</th><th class="py-1">Capacity</th>
+                        </tr></thead>
+                        <tbody>${rows}</tbody>
+                    </table>
+                `,
+                width: 800,
+                showCloseButton: true,
+                confirmButtonText: 'Close'
+            });
+        },
+
+        async showJoinNodeModal(server) {
+            const { value: formValues } = await Swal.fire({
+                title: `Add a node to "${server.name}"`,
+                html: `
+                    <div class="text-left space-y-3">
+                        <div>
+                            <label class="block text-sm font-medium text-gray-700 mb-1">Node name</label>
+                            <input id="join-name" class="w-full p-2 border border-gray-300 rounded-md" placeholder="${server.name}-worker-1">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium text-gray-700 mb-1">Server type</label>
+                            <input id="join-type" class="w-full p-2 border border-gray-300 rounded-md" value="${server.server_type.name}">
+                        </div>
+                        <div>
+                            <label class="block text-sm font-medium text-gray-700 mb-1">Or the host of an existing server (SSH as root with the Xanthus key)</label>
+                            <input id="join-host" class="w-full p-2 border border-gray-300 rounded-md" placeholder="203.0.113.10">
+                        </div>
+                        <p class="text-xs text-gray-600">New nodes are created with ${server.labels.provider} in the server's location and connected over a private network where possible.</p>
+                    </div>
+                `,
+                focusConfirm: false,
+                showCancelButton: true,
+                confirmButtonText: 'Add Node',
+                preConfirm: () => {
+                    const name = document.getElementById('join-name').value.trim();
+                    if (!name) {
+                        Swal.showValidationMessage('A node name is required');
+                        return false;
+                    }
+                    const host = document.getElementById('join-host').value.trim();
+                    if (host) {
+                        return { name, host, provider: 'manual' };
+                    }
+                    return { name, server_type: document.getElementById('join-type').value.trim() };
+                }
+            });
+            if (!formValues) return;
+
+            this.setLoadingState('Adding Node', `Joining "${formValues.name}" to the cluster of "${server.name}"...`);
+            try {
+                const response = await fetch(`/api/v1/vps/${server.id}/nodes`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify(formValues)
+                });
+                const data = await response.json();
+                if (response.ok) {
+                    Swal.fire('Node added', `"${data.data.name}" joined the cluster of "${server.name}".`, 'success');
+                    await this.refreshServers();
+                } else {
+                    Swal.fire('Error', data.error || 'Failed to add the node', 'error');
+                }
+            } catch (error) {
+                console.error('Error joining node:', error);
+                Swal.fire('Error', 'Failed to add the node', 'error');
+            } finally {
+                this.loading = false;
+            }
+        },
+
+        async showK3sUpgradeModal(server) {
+            this.setLoadingState('Checking K3s', `Retrieving the K3s releases "${server.name}" can be upgraded to...`);
+            let versions;
+            try {
+                const response = await fetch(`/api/v1/vps/${server.id}/k3s`);
+                const data = await response.json();
+                if (!response.ok) {
+                    Swal.fire('Error', data.error || 'Failed to list K3s versions', 'error');
+                    return;
+                }
+                versions = data.data;
+            } catch (error) {
+                console.error('Error listing K3s versions:', error);
+                Swal.fire('Error', 'Failed to list K3s versions', 'error');
+                return;
+            } finally {
+                this.loading = false;
+            }
+
+            const nodes = versions.nodes.map(node => `
+                <li class="text-xs">${node.name} (${node.role}): ${node.kubelet_version} ${node.ready ? '✅' : '⏳'}</li>
+            `).join('');
+            if (versions.available.length === 0) {
+                Swal.fire({
+                    title: `K3s ${versions.current}`,
+                    html: `<ul class="text-left">${nodes}</ul><p class="text-sm text-gray-600 mt-3">The cluster runs the latest K3s release it can be upgraded to.</p>`,
+                    icon: 'info'
+                });
+                return;
+            }
+
+            const options = versions.available.map(version => `<option value="${version}">${version}</option>`).join('');
+            const { value: version } = await Swal.fire({
+                title: `Upgrade K3s ${versions.current}`,
+                html: `
+                    <div class="text-left space-y-3">
+                        <ul>${nodes}</ul>
+                        <div>
+                            <label class="block text-sm font-medium text-gray-700 mb-1">Upgrade to</label>
+                            <select id="k3s-version" class="w-full p-2 border border-gray-300 rounded-md">${options}</select>
+                        </div>
+                        <p class="text-xs text-gray-600">Nodes are drained and upgraded one at a time, the server node first. Applications may be briefly unavailable.</p>
+                    </div>
+                `,
+                focusConfirm: false,
+                showCancelButton: true,
+                confirmButtonText: 'Upgrade',
+                preConfirm: () => document.getElementById('k3s-version').value
+            });
+            if (!version) return;
+
+            this.setLoadingState('Upgrading K3s', `Upgrading the cluster of "${server.name}" to ${version}...`);
+            try {
+                const response = await fetch(`/api/v1/vps/${server.id}/k3s/upgrade`, {
+                    method: 'POST',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ version })
+                });
+                const data = await response.json();
+                if (response.ok) {
+                    Swal.fire('K3s upgraded', `The cluster of "${server.name}" runs K3s ${data.data.to}.`, 'success');
+                } else {
+                    Swal.fire('Error', data.error || 'Failed to upgrade K3s', 'error');
+                }
+            } catch (error) {
+                console.error('Error upgrading K3s:', error);
+                Swal.fire('Error', 'Failed to upgrade K3s', 'error');
+            } finally {
+                this.loading = false;
+            }
+        },
+
+        async showMetricsModal(server) {
+            await MetricsCharts.show(`Metrics of "${server.name}"`, `/api/v1/vps/${server.id}/metrics`, series => {
+                const points = series.points;
+                const memoryTotal = points.length ? points[points.length - 1].memory_total_bytes : 0;
+                const diskTotal = points.length ? points[points.length - 1].disk_total_bytes : 0;
+                const charts = [
+                    MetricsCharts.chart('CPU', points, p => p.cpu_percent, v => `${v.toFixed(1)}%`, 100),
+                    MetricsCharts.chart('Memory', points, p => p.memory_bytes, MetricsCharts.formatBytes, memoryTotal),
+                    MetricsCharts.chart('Disk', points, p => p.disk_bytes, MetricsCharts.formatBytes, diskTotal),
+                    MetricsCharts.chart('Network in', points, p => p.net_rx_bytes_per_sec, v => `${MetricsCharts.formatBytes(v)}/s`),
+                    MetricsCharts.chart('Network out', points, p => p.net_tx_bytes_per_sec, v => `${MetricsCharts.formatBytes(v)}/s`)
+                ].join('');
+
+                const pods = (series.pods || []).slice(0, 10).map(pod => `
+                    <tr class="border-t border-gray-200">
+                        <td class="py-1 text-xs">${pod.namespace}</td>
+                        <td class="py-1 text-xs font-medium">${pod.name}</td>
+                        <td class="py-1 text-xs">${(pod.cpu_cores * 1000).toFixed(0)}m</td>
+                        <td class="py-1 text-xs">${MetricsCharts.formatBytes(pod.memory_bytes)}</td>
+                    </tr>
+                `).join('');
+                const table = pods ? `
+                    <h4 class="text-sm font-medium text-gray-700 mt-4 mb-1">Top pods</h4>
+                    <table class="w-full text-left">
+                        <thead><tr class="text-xs text-gray-500">
+                            <th class="py-1">Namespace</th><th class="py-1">Pod</th><th class="py-1">CPU</th><th class="py-1">Memory</th>
+                        </tr></thead>
+                        <tbody>${pods}</tbody>
+                    </table>
+                ` : '';
+
+                return `
+                    <p class="text-xs text-gray-500 mb-2">${series.resolution} resolution, updated ${new Date(series.updated_at).toLocaleString()}</p>
+                    <div class="grid grid-cols-2 gap-3">${charts}</div>
+                    ${table}
+                `;
+            });
+        },
+
         // Applications modal functions
         async showApplications(server) {
             this.selectedServer = server;